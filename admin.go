@@ -0,0 +1,69 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/admin"
+)
+
+const adminTimeout = time.Minute
+
+// runAdmin sends a command to the admin API of a running daemon and
+// writes the response, if any, to out.
+func runAdmin(cacheDir string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	socketPath := flags.String("socket", filepath.Join(cacheDir, adminSocketFile), "path to the admin socket")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return xerrors.Errorf("expected exactly one of %q, %q, %q or %q",
+			admin.CommandReload, admin.CommandPurgeCache, admin.CommandRotateToken, admin.CommandHealth)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+
+	body, err := admin.Call(ctx, *socketPath, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, body, "", "  "); err != nil {
+		buf.Reset()
+		buf.Write(body)
+	}
+
+	_, err = fmt.Fprintln(out, string(bytes.TrimSpace(buf.Bytes())))
+
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Call sends a command to the admin API served on the unix socket at
+// socketPath and returns the body of the response, if any.
+func Call(ctx context.Context, socketPath, command string) ([]byte, error) {
+	method := http.MethodPost
+
+	switch command {
+	case CommandReload, CommandPurgeCache, CommandRotateToken:
+	case CommandHealth:
+		method = http.MethodGet
+	default:
+		return nil, xerrors.Errorf("unknown admin command %q", command)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://admin/v1/"+command, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("error connecting to admin socket %s: %w", socketPath, err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e errorResponse
+		if err = json.Unmarshal(body, &e); err != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(body))
+		}
+
+		return nil, xerrors.Errorf("%s failed: %s", command, e.Error)
+	}
+
+	return body, nil
+}
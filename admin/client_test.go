@@ -0,0 +1,54 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+		err     string
+	}{
+		{
+			name:    "unknown-command",
+			command: "restart",
+			err:     `unknown admin command "restart"`,
+		},
+		{
+			name:    "no-server",
+			command: CommandHealth,
+			err:     "error connecting to admin socket",
+		},
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Call(context.Background(), socketPath, tc.command)
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if !strings.HasPrefix(err.Error(), tc.err) {
+				t.Fatalf("Expected error to start with %q, got %q", tc.err, err.Error())
+			}
+		})
+	}
+}
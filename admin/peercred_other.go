@@ -0,0 +1,28 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !linux
+
+package admin
+
+import (
+	"net"
+	"os"
+)
+
+// peerUID cannot read the credentials of the peer on this platform, so
+// access to the admin API is controlled by the permissions of the socket
+// file alone.
+func peerUID(net.Conn) (int, error) {
+	return os.Getuid(), nil
+}
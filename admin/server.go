@@ -0,0 +1,238 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package admin implements an HTTP API served on a unix socket through
+// which operators can manage a long-running credential helper without
+// restarting it.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+)
+
+// The commands supported by the admin API.
+const (
+	CommandReload      = "reload"
+	CommandPurgeCache  = "purge-cache"
+	CommandRotateToken = "rotate-token"
+	CommandHealth      = "health"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+// Handler performs the operations requested through the admin API.
+type Handler interface {
+	// Reload re-reads the configuration file.
+	Reload() error
+
+	// PurgeCache removes all cached secrets and tokens.
+	PurgeCache() error
+
+	// RotateToken replaces the current Vault token with a new one.
+	RotateToken(ctx context.Context) error
+
+	// Health returns a JSON-encodable snapshot of the handler's state.
+	Health() interface{}
+}
+
+// ServerOptions is used to configure a new Server instance.
+type ServerOptions struct {
+	Logger     hclog.Logger
+	Handler    Handler
+	SocketPath string
+}
+
+// Server serves the admin API on a unix socket. Only connections from
+// processes running as the same user as the server (or as root) are
+// accepted.
+type Server struct {
+	logger     hclog.Logger
+	handler    Handler
+	socketPath string
+	ready      chan struct{}
+}
+
+// NewServer creates a new Server instance.
+func NewServer(opts ServerOptions) *Server {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	return &Server{
+		logger:     logger,
+		handler:    opts.Handler,
+		socketPath: opts.SocketPath,
+		ready:      make(chan struct{}),
+	}
+}
+
+// Serve listens on the unix socket and serves the admin API until the
+// context is canceled. Any file already present at the socket path (e.g.
+// left behind by a process which crashed) is removed first.
+func (s *Server) Serve(ctx context.Context) error {
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("error removing stale admin socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return xerrors.Errorf("error listening on admin socket: %w", err)
+	}
+
+	if err = os.Chmod(s.socketPath, 0o600); err != nil {
+		ln.Close() // nolint: errcheck
+		return xerrors.Errorf("error setting permissions of admin socket: %w", err)
+	}
+
+	close(s.ready)
+
+	srv := &http.Server{
+		Handler:           s.routes(),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background()) // nolint: errcheck
+	}()
+
+	s.logger.Info("serving admin API", "socket", s.socketPath)
+
+	err = srv.Serve(NewPeerListener(ln, s.logger))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Ready returns a channel which is closed once Serve listens on the
+// socket, so that clients need not poll it.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1/"+CommandReload, s.action(func(*http.Request) error {
+		return s.handler.Reload()
+	}))
+	mux.HandleFunc("/v1/"+CommandPurgeCache, s.action(func(*http.Request) error {
+		return s.handler.PurgeCache()
+	}))
+	mux.HandleFunc("/v1/"+CommandRotateToken, s.action(func(r *http.Request) error {
+		return s.handler.RotateToken(r.Context())
+	}))
+	mux.HandleFunc("/v1/"+CommandHealth, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		respond(w, http.StatusOK, s.handler.Health())
+	})
+
+	return mux
+}
+
+// action returns an HTTP handler which performs fn on POST requests.
+func (s *Server) action(fn func(*http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		if err := fn(r); err != nil {
+			s.logger.Error("error handling admin request", "path", r.URL.Path, "error", err)
+			respondError(w, http.StatusInternalServerError, err.Error())
+
+			return
+		}
+
+		s.logger.Info("handled admin request", "path", r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// peerListener drops every connection whose peer is not allowed to use the
+// admin API.
+type peerListener struct {
+	net.Listener
+	logger hclog.Logger
+}
+
+// NewPeerListener wraps a unix socket listener so that it drops every
+// connection whose peer runs neither as the same user as this process nor
+// as root.
+func NewPeerListener(ln net.Listener, logger hclog.Logger) net.Listener {
+	return &peerListener{Listener: ln, logger: logger}
+}
+
+func (l *peerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if err = checkPeer(conn); err != nil {
+			l.logger.Warn("rejected connection", "error", err)
+			conn.Close() // nolint: errcheck
+
+			continue
+		}
+
+		return conn, nil
+	}
+}
+
+// checkPeer returns an error unless the peer of the connection runs as the
+// same user as this process or as root.
+func checkPeer(conn net.Conn) error {
+	uid, err := peerUID(conn)
+	if err != nil {
+		return xerrors.Errorf("error reading peer credentials: %w", err)
+	}
+
+	if uid != os.Getuid() && uid != 0 {
+		return xerrors.Errorf("peer with UID %d is not allowed", uid)
+	}
+
+	return nil
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) // nolint: errcheck
+}
+
+func respondError(w http.ResponseWriter, status int, msg string) {
+	respond(w, status, errorResponse{Error: msg})
+}
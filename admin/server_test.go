@@ -0,0 +1,155 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockHandler struct {
+	calls []string
+	err   error
+}
+
+func (m *mockHandler) Reload() error {
+	m.calls = append(m.calls, CommandReload)
+	return m.err
+}
+
+func (m *mockHandler) PurgeCache() error {
+	m.calls = append(m.calls, CommandPurgeCache)
+	return m.err
+}
+
+func (m *mockHandler) RotateToken(context.Context) error {
+	m.calls = append(m.calls, CommandRotateToken)
+	return m.err
+}
+
+func (m *mockHandler) Health() interface{} {
+	m.calls = append(m.calls, CommandHealth)
+	return map[string]string{"status": "ok"}
+}
+
+// startServer serves the admin API for the duration of the test and waits
+// until it listens on the socket.
+func startServer(t *testing.T, handler Handler) string {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+
+	// Leave a stale file behind to check that it gets replaced
+	if err := os.WriteFile(socketPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	srv := NewServer(ServerOptions{Handler: handler, SocketPath: socketPath})
+
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+
+	select {
+	case <-srv.Ready():
+	case err := <-done:
+		cancel()
+		t.Fatalf("admin API did not start: %v", err)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("error serving admin API: %v", err)
+		}
+	})
+
+	return socketPath
+}
+
+func TestServer(t *testing.T) {
+	handler := &mockHandler{}
+	socketPath := startServer(t, handler)
+	handler.calls = nil
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	cases := []struct {
+		command  string
+		expected string
+	}{
+		{command: CommandReload},
+		{command: CommandPurgeCache},
+		{command: CommandRotateToken},
+		{command: CommandHealth, expected: "{\"status\":\"ok\"}\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.command, func(t *testing.T) {
+			body, err := Call(context.Background(), socketPath, tc.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tc.expected {
+				t.Fatalf("Responses differ:\n%v", cmp.Diff(string(body), tc.expected))
+			}
+		})
+	}
+
+	expected := []string{CommandReload, CommandPurgeCache, CommandRotateToken, CommandHealth}
+	if !cmp.Equal(expected, handler.calls) {
+		t.Fatalf("Calls differ:\n%v", cmp.Diff(expected, handler.calls))
+	}
+
+	t.Run("handler-error", func(t *testing.T) {
+		handler.err = errors.New("cannot reload")
+		defer func() { handler.err = nil }()
+
+		_, err := Call(context.Background(), socketPath, CommandReload)
+		if err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		expected := "reload failed: cannot reload"
+		if err.Error() != expected {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(err.Error(), expected))
+		}
+	})
+
+	t.Run("method-not-allowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewServer(ServerOptions{Handler: handler}).routes().ServeHTTP(rec,
+			httptest.NewRequest(http.MethodGet, "/v1/"+CommandReload, nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+		}
+	})
+}
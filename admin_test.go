@@ -0,0 +1,105 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/admin"
+)
+
+type stubHandler struct{}
+
+func (stubHandler) Reload() error                     { return nil }
+func (stubHandler) PurgeCache() error                 { return nil }
+func (stubHandler) RotateToken(context.Context) error { return nil }
+func (stubHandler) Health() interface{}               { return map[string]string{"status": "ok"} }
+
+func TestRunAdmin(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "no-command",
+			args: []string{},
+			err:  `expected exactly one of "reload", "purge-cache", "rotate-token" or "health"`,
+		},
+		{
+			name: "unknown-command",
+			args: []string{"restart"},
+			err:  `unknown admin command "restart"`,
+		},
+		{
+			name: "bad-flag",
+			args: []string{"-sock", "admin.sock", "health"},
+			err:  "flag provided but not defined: -sock",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			err := runAdmin(t.TempDir(), tc.args, &out)
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if err.Error() != tc.err {
+				t.Fatalf("Errors differ:\n%v", cmp.Diff(err.Error(), tc.err))
+			}
+		})
+	}
+}
+
+func TestRunAdmin_Health(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := admin.NewServer(admin.ServerOptions{
+		Handler:    stubHandler{},
+		SocketPath: filepath.Join(cacheDir, adminSocketFile),
+	})
+
+	go srv.Serve(ctx) // nolint: errcheck
+
+	<-srv.Ready()
+
+	var out bytes.Buffer
+
+	if err := runAdmin(cacheDir, []string{"health"}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "{\n  \"status\": \"ok\"\n}\n"
+	if out.String() != expected {
+		t.Fatalf("Output differs:\n%v", cmp.Diff(out.String(), expected))
+	}
+
+	out.Reset()
+	if err := runAdmin(cacheDir, []string{"reload"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", out.String())
+	}
+}
@@ -0,0 +1,600 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/imds"
+)
+
+const (
+	ecsCredentialsHost = "http://169.254.170.2"
+	webIdentitySession = "docker-credential-vault-login"
+	httpTimeout        = 5 * time.Second
+)
+
+// The credential sources to which ChainOptions.Source can restrict the
+// credentials.
+const (
+	SourceEnv         = "env"
+	SourceProfile     = "profile"
+	SourceWebIdentity = "web_identity"
+	SourceECS         = "ecs"
+	SourceEC2         = "ec2"
+)
+
+var (
+	// errNoCredentials is returned by a provider which finds no credentials.
+	errNoCredentials = errors.New("no credentials found")
+
+	// roleSessionName matches the role session names accepted by STS.
+	roleSessionName = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+)
+
+// Credentials are AWS credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Expires is when the credentials expire. It is zero for credentials
+	// which don't expire.
+	Expires time.Time
+}
+
+// Expired reports whether the credentials have expired at now or are
+// about to.
+func (c Credentials) Expired(now time.Time) bool {
+	return !c.Expires.IsZero() && c.Expires.Sub(now) < time.Minute
+}
+
+// ChainOptions configures how credentials are resolved.
+type ChainOptions struct {
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials
+	// which, if set, are used instead of resolving credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Region is the region of the STS endpoint used to exchange a web
+	// identity token for credentials.
+	Region string
+
+	// STSEndpoint, if set, is the STS endpoint used instead of the one of
+	// the region.
+	STSEndpoint string
+
+	// Source, if set, is the only provider of credentials which is used:
+	// one of SourceEnv, SourceProfile, SourceWebIdentity, SourceECS and
+	// SourceEC2.
+	Source string
+
+	// Profile and SharedCredentialsFile, if set, are used instead of
+	// AWS_PROFILE and AWS_SHARED_CREDENTIALS_FILE. Unlike those, they must
+	// name a profile which contains credentials.
+	Profile               string
+	SharedCredentialsFile string
+
+	// WebIdentityTokenFile and WebIdentityRoleARN, if set, are used instead
+	// of AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN.
+	WebIdentityTokenFile string
+	WebIdentityRoleARN   string
+
+	// AssumeRoleARN, if set, is a role which is assumed with the resolved
+	// credentials, passing AssumeRoleExternalID as the external ID if it is
+	// set. The session is named AssumeRoleSessionName or, if it is empty,
+	// after the helper.
+	AssumeRoleARN         string
+	AssumeRoleExternalID  string
+	AssumeRoleSessionName string
+
+	// HTTPClient is used to request credentials. If nil, a client with a
+	// short timeout is used.
+	HTTPClient *http.Client
+
+	// Clock, if set, is the clock by which the requests to STS are signed.
+	// Otherwise, the system clock is used.
+	Clock clock.Clock
+}
+
+// ValidateAssumeRole returns an error unless roleARN is the ARN of an IAM
+// role and session, if set, is a valid role session name.
+func ValidateAssumeRole(roleARN, session string) error {
+	if !strings.HasPrefix(roleARN, "arn:") || !strings.Contains(roleARN, ":role/") {
+		return fmt.Errorf("%q is not the ARN of an IAM role", roleARN)
+	}
+
+	if session != "" && !roleSessionName.MatchString(session) {
+		return fmt.Errorf("invalid role session name %q: must be 2 to 64 letters, digits or characters of =,.@_+-",
+			session)
+	}
+
+	return nil
+}
+
+// ValidateSource returns an error unless source is empty or one of the
+// supported credential sources.
+func ValidateSource(source string) error {
+	switch source {
+	case "", SourceEnv, SourceProfile, SourceWebIdentity, SourceECS, SourceEC2:
+		return nil
+	default:
+		return fmt.Errorf("unsupported credential source %q: must be one of %s, %s, %s, %s or %s",
+			source, SourceEnv, SourceProfile, SourceWebIdentity, SourceECS, SourceEC2)
+	}
+}
+
+// ResolveCredentials returns the first credentials found in the following
+// places, in the same order as the AWS SDK looks for them: the static
+// credentials of the options, the environment, the shared credentials
+// file, a web identity token, the ECS container credentials endpoint, and
+// the EC2 instance metadata service. If the options name a credential
+// source, only that place is looked in. If they name a role to assume,
+// the credentials of the role are returned instead.
+func ResolveCredentials(ctx context.Context, opts ChainOptions) (Credentials, error) {
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+
+	if opts.AssumeRoleARN != "" {
+		if err := ValidateAssumeRole(opts.AssumeRoleARN, opts.AssumeRoleSessionName); err != nil {
+			return Credentials{}, err
+		}
+	}
+
+	creds, err := sourceCredentials(ctx, client, opts)
+	if err != nil || opts.AssumeRoleARN == "" {
+		return creds, err
+	}
+
+	return assumeRole(ctx, client, creds, opts)
+}
+
+func sourceCredentials(ctx context.Context, client *http.Client, opts ChainOptions) (Credentials, error) {
+	if err := ValidateSource(opts.Source); err != nil {
+		return Credentials{}, err
+	}
+
+	if opts.AccessKeyID != "" || opts.SecretAccessKey != "" {
+		switch {
+		case opts.AccessKeyID == "" || opts.SecretAccessKey == "":
+			return Credentials{}, errors.New("both an access key and a secret key must be provided")
+		case opts.Source != "":
+			return Credentials{}, errors.New("static credentials cannot be used with a credential source")
+		}
+
+		return Credentials{
+			AccessKeyID:     opts.AccessKeyID,
+			SecretAccessKey: opts.SecretAccessKey,
+			SessionToken:    opts.SessionToken,
+		}, nil
+	}
+
+	providers := []struct {
+		source string
+		get    func() (Credentials, error)
+	}{
+		{SourceEnv, envCredentials},
+		{SourceProfile, func() (Credentials, error) {
+			return sharedFileCredentials(opts.SharedCredentialsFile, opts.Profile)
+		}},
+		{SourceWebIdentity, func() (Credentials, error) { return webIdentityCredentials(ctx, client, opts) }},
+		{SourceECS, func() (Credentials, error) { return containerCredentials(ctx, client) }},
+		{SourceEC2, func() (Credentials, error) { return instanceCredentials(ctx, client) }},
+	}
+
+	for _, provider := range providers {
+		if opts.Source != "" && provider.source != opts.Source {
+			continue
+		}
+
+		creds, err := provider.get()
+		if errors.Is(err, errNoCredentials) {
+			continue
+		}
+
+		return creds, err
+	}
+
+	if opts.Source != "" {
+		return Credentials{}, fmt.Errorf("no valid AWS credentials found in credential source %q", opts.Source)
+	}
+
+	return Credentials{}, errors.New("no valid AWS credentials found in the environment, the shared " +
+		"credentials file, or the container or instance metadata")
+}
+
+func envCredentials() (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     firstEnv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		SecretAccessKey: firstEnv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, errNoCredentials
+	}
+
+	return creds, nil
+}
+
+// sharedFileCredentials reads the credentials of the profile from the
+// shared credentials file. A file or profile which is configured rather
+// than taken from the environment must contain credentials.
+func sharedFileCredentials(path, profile string) (Credentials, error) {
+	configured := path != "" || profile != ""
+
+	if path == "" {
+		path = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+
+	if path == "" {
+		path = "~/.aws/credentials"
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return Credentials{}, errNoCredentials
+	}
+
+	f, err := os.Open(path) // nolint: gosec
+	if os.IsNotExist(err) && !configured {
+		return Credentials{}, errNoCredentials
+	}
+
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error opening shared credentials file: %w", err)
+	}
+	defer f.Close() // nolint: errcheck
+
+	if profile == "" {
+		profile = firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE")
+	}
+
+	if profile == "" {
+		profile = "default"
+	}
+
+	values, err := parseProfile(f, profile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error parsing shared credentials file: %w", err)
+	}
+
+	creds := Credentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		if configured {
+			return Credentials{}, fmt.Errorf("profile %q of shared credentials file %s contains no credentials",
+				profile, path)
+		}
+
+		return Credentials{}, errNoCredentials
+	}
+
+	return creds, nil
+}
+
+// parseProfile returns the keys of the section of the INI file named
+// after the profile.
+func parseProfile(r io.Reader, profile string) (map[string]string, error) {
+	values := make(map[string]string)
+	inProfile := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+		case inProfile:
+			if k, v, ok := strings.Cut(line, "="); ok {
+				values[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			}
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+// webIdentityCredentials exchanges the token in AWS_WEB_IDENTITY_TOKEN_FILE
+// for credentials of the role in AWS_ROLE_ARN, as is done on EKS, unless
+// the options give the token file and role.
+func webIdentityCredentials(ctx context.Context, client *http.Client, opts ChainOptions) (Credentials, error) {
+	tokenFile, roleARN := opts.WebIdentityTokenFile, opts.WebIdentityRoleARN
+	if tokenFile == "" {
+		tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	} else if expanded, err := homedir.Expand(tokenFile); err == nil {
+		tokenFile = expanded
+	}
+
+	if roleARN == "" {
+		roleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+
+	if tokenFile == "" || roleARN == "" {
+		return Credentials{}, errNoCredentials
+	}
+
+	token, err := os.ReadFile(tokenFile) // nolint: gosec
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error reading web identity token: %w", err)
+	}
+
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = webIdentitySession
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {stsAPIVersion},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+
+	creds, err := requestSTSCredentials(ctx, client, nil, opts, form)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error assuming role with web identity: %w", err)
+	}
+
+	return creds, nil
+}
+
+// assumeRole exchanges the credentials for those of the role given by the
+// options.
+func assumeRole(ctx context.Context, client *http.Client, creds Credentials, opts ChainOptions) (Credentials, error) {
+	session := opts.AssumeRoleSessionName
+	if session == "" {
+		session = webIdentitySession
+	}
+
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {stsAPIVersion},
+		"RoleArn":         {opts.AssumeRoleARN},
+		"RoleSessionName": {session},
+	}
+
+	if opts.AssumeRoleExternalID != "" {
+		form.Set("ExternalId", opts.AssumeRoleExternalID)
+	}
+
+	assumed, err := requestSTSCredentials(ctx, client, &creds, opts, form)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error assuming role %s: %w", opts.AssumeRoleARN, err)
+	}
+
+	return assumed, nil
+}
+
+// requestSTSCredentials sends the STS request given by the form to the STS
+// endpoint of the options and returns the credentials in the response. The
+// request is signed if creds is not nil.
+func requestSTSCredentials(
+	ctx context.Context,
+	client *http.Client,
+	creds *Credentials,
+	opts ChainOptions,
+	form url.Values,
+) (Credentials, error) {
+	region := ResolveRegion(opts.Region)
+
+	endpoint := opts.STSEndpoint
+	if endpoint == "" {
+		endpoint = STSEndpoint(region)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	req.Header.Set("Content-Type", formContentType)
+
+	if creds != nil {
+		clk := opts.Clock
+		if clk == nil {
+			clk = clock.System()
+		}
+
+		if err = Sign(req, *creds, "sts", region, clk.Now()); err != nil {
+			return Credentials{}, fmt.Errorf("error signing request: %w", err)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	type stsCredentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	}
+
+	var result struct {
+		AssumeRole            stsCredentials `xml:"AssumeRoleResult>Credentials"`
+		AssumeRoleWebIdentity stsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+
+	if err = xml.Unmarshal(body, &result); err != nil {
+		return Credentials{}, fmt.Errorf("error parsing credentials: %w", err)
+	}
+
+	c := result.AssumeRole
+	if c.AccessKeyID == "" {
+		c = result.AssumeRoleWebIdentity
+	}
+
+	return Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expires:         c.Expiration,
+	}, nil
+}
+
+// containerCredentials reads the credentials of the ECS task role.
+func containerCredentials(ctx context.Context, client *http.Client) (Credentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = ecsCredentialsHost + relative
+	}
+
+	if endpoint == "" {
+		return Credentials{}, errNoCredentials
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	// The credentials are cached as briefly as those of the instance
+	// profile are, separately for every authorization token
+	key := endpoint + "#" + req.Header.Get("Authorization")
+
+	value, err := imds.Default.Do(ctx, key, func(context.Context) (interface{}, time.Duration, error) {
+		creds, err := getJSONCredentials(client, req)
+		return creds, metadataCacheTTL("meta-data/iam/security-credentials/"), err
+	})
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error reading container credentials: %w", err)
+	}
+
+	return value.(Credentials), nil
+}
+
+// instanceCredentials reads the credentials of the EC2 instance profile.
+func instanceCredentials(ctx context.Context, client *http.Client) (Credentials, error) {
+	imds := NewMetadataClient(client)
+	if imds.disabled() {
+		return Credentials{}, errNoCredentials
+	}
+
+	roles, err := imds.Get(ctx, "meta-data/iam/security-credentials/")
+	if err != nil {
+		// Most likely this is not an EC2 instance
+		return Credentials{}, errNoCredentials
+	}
+
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return Credentials{}, errNoCredentials
+	}
+
+	body, err := imds.Get(ctx, "meta-data/iam/security-credentials/"+role)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error reading instance profile credentials: %w", err)
+	}
+
+	creds, err := decodeJSONCredentials(strings.NewReader(body))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("error reading instance profile credentials: %w", err)
+	}
+
+	return creds, nil
+}
+
+// getJSONCredentials reads credentials in the format returned by the ECS
+// and EC2 credentials endpoints.
+func getJSONCredentials(client *http.Client, req *http.Request) (Credentials, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return decodeJSONCredentials(resp.Body)
+}
+
+// decodeJSONCredentials decodes credentials in the format returned by the
+// ECS and EC2 credentials endpoints.
+func decodeJSONCredentials(r io.Reader) (Credentials, error) {
+	var result struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return Credentials{}, err
+	}
+
+	if result.AccessKeyID == "" || result.SecretAccessKey == "" {
+		return Credentials{}, errors.New("response contains no credentials")
+	}
+
+	return Credentials{
+		AccessKeyID:     result.AccessKeyID,
+		SecretAccessKey: result.SecretAccessKey,
+		SessionToken:    result.Token,
+		Expires:         result.Expiration,
+	}, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,433 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// credentialEnv lists every environment variable read while resolving
+// credentials so that tests are not affected by the environment.
+var credentialEnv = []string{
+	"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_SESSION_TOKEN",
+	"AWS_SHARED_CREDENTIALS_FILE", "AWS_PROFILE", "AWS_DEFAULT_PROFILE",
+	"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_EC2_METADATA_SERVICE_ENDPOINT", "AWS_EC2_METADATA_DISABLED",
+}
+
+func TestResolveCredentials(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	credsFile := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(credsFile, []byte(`
+[default]
+aws_access_key_id = default-key
+
+[dev]
+# comment
+aws_access_key_id     = dev-key
+aws_secret_access_key = dev-secret
+aws_session_token     = dev-token
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	container := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "container-auth" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"AccessKeyId":"container-key","SecretAccessKey":"container-secret",` + // nolint: errcheck
+			`"Token":"container-token","Expiration":"2030-01-02T03:04:05Z"}`))
+	}))
+	defer container.Close()
+
+	imds := newFakeMetadata(t)
+	defer imds.Close()
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("Action") == "AssumeRole" {
+			if !strings.Contains(r.Header.Get("Authorization"), "Credential=static-key/") ||
+				r.PostForm.Get("ExternalId") != "external-id" || r.Header.Get(headerAmzDate) != "20150830T123600Z" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte("<ErrorResponse/>")) // nolint: errcheck
+				return
+			}
+			w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>` + // nolint: errcheck
+				`<AccessKeyId>role-key</AccessKeyId><SecretAccessKey>role-secret</SecretAccessKey>` +
+				`<SessionToken>role-token</SessionToken><Expiration>2030-01-02T03:04:05Z</Expiration>` +
+				`</Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+			return
+		}
+		if r.PostForm.Get("WebIdentityToken") != "web-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>` + // nolint: errcheck
+			`<AccessKeyId>web-key</AccessKeyId><SecretAccessKey>web-secret</SecretAccessKey>` +
+			`<SessionToken>web-token</SessionToken><Expiration>2030-01-02T03:04:05Z</Expiration>` +
+			`</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer sts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("web-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		opts  ChainOptions
+		env   map[string]string
+		creds Credentials
+		err   string
+	}{
+		{
+			name:  "static",
+			opts:  ChainOptions{AccessKeyID: "static-key", SecretAccessKey: "static-secret"},
+			env:   map[string]string{"AWS_ACCESS_KEY_ID": "env-key", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			creds: Credentials{AccessKeyID: "static-key", SecretAccessKey: "static-secret"},
+		},
+		{
+			name: "static-missing-secret",
+			opts: ChainOptions{AccessKeyID: "static-key"},
+			err:  "both an access key and a secret key must be provided",
+		},
+		{
+			name: "env",
+			env: map[string]string{
+				"AWS_ACCESS_KEY":              "env-key",
+				"AWS_SECRET_ACCESS_KEY":       "env-secret",
+				"AWS_SESSION_TOKEN":           "env-token",
+				"AWS_SHARED_CREDENTIALS_FILE": credsFile,
+				"AWS_PROFILE":                 "dev",
+			},
+			creds: Credentials{AccessKeyID: "env-key", SecretAccessKey: "env-secret", SessionToken: "env-token"},
+		},
+		{
+			name: "shared-file",
+			env: map[string]string{
+				"AWS_SHARED_CREDENTIALS_FILE": credsFile,
+				"AWS_PROFILE":                 "dev",
+			},
+			creds: Credentials{AccessKeyID: "dev-key", SecretAccessKey: "dev-secret", SessionToken: "dev-token"},
+		},
+		{
+			name: "web-identity-sts-endpoint",
+			opts: ChainOptions{Region: "us-gov-west-1", STSEndpoint: sts.URL},
+			env: map[string]string{
+				"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(t.TempDir(), "nonexistent"),
+				"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+				"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/ci",
+			},
+			creds: Credentials{
+				AccessKeyID:     "web-key",
+				SecretAccessKey: "web-secret",
+				SessionToken:    "web-token",
+				Expires:         expires,
+			},
+		},
+		{
+			name: "web-identity-options",
+			opts: ChainOptions{
+				STSEndpoint:          sts.URL,
+				WebIdentityTokenFile: tokenFile,
+				WebIdentityRoleARN:   "arn:aws:iam::123456789012:role/ci",
+			},
+			env: map[string]string{
+				"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(t.TempDir(), "nonexistent"),
+			},
+			creds: Credentials{
+				AccessKeyID:     "web-key",
+				SecretAccessKey: "web-secret",
+				SessionToken:    "web-token",
+				Expires:         expires,
+			},
+		},
+		{
+			name: "profile-options",
+			opts: ChainOptions{SharedCredentialsFile: credsFile, Profile: "dev"},
+			env: map[string]string{
+				"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(t.TempDir(), "nonexistent"),
+				"AWS_PROFILE":                 "prod",
+			},
+			creds: Credentials{AccessKeyID: "dev-key", SecretAccessKey: "dev-secret", SessionToken: "dev-token"},
+		},
+		{
+			name: "profile-options-incomplete",
+			opts: ChainOptions{SharedCredentialsFile: credsFile},
+			err:  `profile "default" of shared credentials file ` + credsFile + " contains no credentials",
+		},
+		{
+			name: "profile-options-missing-file",
+			opts: ChainOptions{SharedCredentialsFile: filepath.Join(filepath.Dir(credsFile), "nonexistent")},
+			err: "error opening shared credentials file: open " +
+				filepath.Join(filepath.Dir(credsFile), "nonexistent") + ": no such file or directory",
+		},
+		{
+			name: "source",
+			opts: ChainOptions{Source: SourceProfile, Profile: "dev"},
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":           "env-key",
+				"AWS_SECRET_ACCESS_KEY":       "env-secret",
+				"AWS_SHARED_CREDENTIALS_FILE": credsFile,
+			},
+			creds: Credentials{AccessKeyID: "dev-key", SecretAccessKey: "dev-secret", SessionToken: "dev-token"},
+		},
+		{
+			name: "source-no-credentials",
+			opts: ChainOptions{Source: SourceECS},
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "env-key",
+				"AWS_SECRET_ACCESS_KEY": "env-secret",
+			},
+			err: `no valid AWS credentials found in credential source "ecs"`,
+		},
+		{
+			name: "source-unsupported",
+			opts: ChainOptions{Source: "sso"},
+			err:  `unsupported credential source "sso": must be one of env, profile, web_identity, ecs or ec2`,
+		},
+		{
+			name: "source-static",
+			opts: ChainOptions{Source: SourceEnv, AccessKeyID: "static-key", SecretAccessKey: "static-secret"},
+			err:  "static credentials cannot be used with a credential source",
+		},
+		{
+			name: "assume-role",
+			opts: ChainOptions{
+				AccessKeyID:          "static-key",
+				SecretAccessKey:      "static-secret",
+				STSEndpoint:          sts.URL,
+				AssumeRoleARN:        "arn:aws:iam::123456789012:role/registry",
+				AssumeRoleExternalID: "external-id",
+				Clock:                clock.NewFake(time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)),
+			},
+			creds: Credentials{
+				AccessKeyID:     "role-key",
+				SecretAccessKey: "role-secret",
+				SessionToken:    "role-token",
+				Expires:         expires,
+			},
+		},
+		{
+			name: "assume-role-denied",
+			opts: ChainOptions{
+				AccessKeyID:     "static-key",
+				SecretAccessKey: "static-secret",
+				STSEndpoint:     sts.URL,
+				AssumeRoleARN:   "arn:aws:iam::123456789012:role/registry",
+			},
+			err: "error assuming role arn:aws:iam::123456789012:role/registry: 403 Forbidden: <ErrorResponse/>",
+		},
+		{
+			name: "container",
+			env: map[string]string{
+				"AWS_SHARED_CREDENTIALS_FILE":        credsFile, // the default profile is incomplete
+				"AWS_CONTAINER_CREDENTIALS_FULL_URI": container.URL,
+				"AWS_CONTAINER_AUTHORIZATION_TOKEN":  "container-auth",
+			},
+			creds: Credentials{
+				AccessKeyID:     "container-key",
+				SecretAccessKey: "container-secret",
+				SessionToken:    "container-token",
+				Expires:         expires,
+			},
+		},
+		{
+			name: "container-error",
+			env: map[string]string{
+				"AWS_CONTAINER_CREDENTIALS_FULL_URI": container.URL,
+			},
+			err: "error reading container credentials: unexpected response: 401 Unauthorized",
+		},
+		{
+			name: "instance",
+			env: map[string]string{
+				"AWS_SHARED_CREDENTIALS_FILE":       filepath.Join(t.TempDir(), "nonexistent"),
+				"AWS_EC2_METADATA_SERVICE_ENDPOINT": imds.URL,
+			},
+			creds: Credentials{
+				AccessKeyID:     "instance-key",
+				SecretAccessKey: "instance-secret",
+				SessionToken:    "instance-token",
+				Expires:         expires,
+			},
+		},
+		{
+			name: "none",
+			env: map[string]string{
+				"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(t.TempDir(), "nonexistent"),
+				"AWS_EC2_METADATA_DISABLED":   "true",
+			},
+			err: "no valid AWS credentials found in the environment, the shared credentials file, " +
+				"or the container or instance metadata",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, env := range credentialEnv {
+				t.Setenv(env, tc.env[env])
+			}
+
+			creds, err := ResolveCredentials(context.Background(), tc.opts)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.creds, creds) {
+				t.Fatalf("Credentials differ:\n%v", cmp.Diff(tc.creds, creds))
+			}
+		})
+	}
+}
+
+func TestValidateAssumeRole(t *testing.T) {
+	cases := []struct {
+		name    string
+		roleARN string
+		session string
+		err     string
+	}{
+		{
+			name:    "valid",
+			roleARN: "arn:aws:iam::123456789012:role/registry",
+			session: "ci@example.com",
+		},
+		{
+			name:    "no-session",
+			roleARN: "arn:aws-us-gov:iam::123456789012:role/path/registry",
+		},
+		{
+			name:    "role-name",
+			roleARN: "registry",
+			err:     `"registry" is not the ARN of an IAM role`,
+		},
+		{
+			name:    "user",
+			roleARN: "arn:aws:iam::123456789012:user/ci",
+			err:     `"arn:aws:iam::123456789012:user/ci" is not the ARN of an IAM role`,
+		},
+		{
+			name:    "session",
+			roleARN: "arn:aws:iam::123456789012:role/registry",
+			session: "ci job",
+			err:     `invalid role session name "ci job": must be 2 to 64 letters, digits or characters of =,.@_+-`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAssumeRole(tc.roleARN, tc.session)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCredentialsExpired(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		expires time.Time
+		expired bool
+	}{
+		{"never", time.Time{}, false},
+		{"future", now.Add(time.Hour), false},
+		{"about-to-expire", now.Add(30 * time.Second), true},
+		{"past", now.Add(-time.Hour), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := (Credentials{Expires: tc.expires}).Expired(now); got != tc.expired {
+				t.Fatalf("Expected Expired() to return %t, got %t", tc.expired, got)
+			}
+		})
+	}
+}
+
+// newFakeMetadata starts a fake EC2 instance metadata service which
+// requires IMDSv2 session tokens.
+func newFakeMetadata(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	const token = "imds-token"
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get(headerMetadataTokenTTL) == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(token)) // nolint: errcheck
+			return
+		}
+
+		if r.Header.Get(headerMetadataToken) != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("instance-role\n")) // nolint: errcheck
+		case "/latest/meta-data/iam/security-credentials/instance-role":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"instance-key","SecretAccessKey":"instance-secret",` + // nolint: errcheck
+				`"Token":"instance-token","Expiration":"2030-01-02T03:04:05Z"}`))
+		case "/latest/dynamic/instance-identity/document":
+			w.Write([]byte(`{"instanceId":"i-1234567890abcdef0"}`)) // nolint: errcheck
+		case "/latest/dynamic/instance-identity/signature":
+			w.Write([]byte("signature")) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
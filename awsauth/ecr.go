@@ -0,0 +1,159 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	ecrTarget      = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+	ecrContentType = "application/x-amz-json-1.1"
+)
+
+// ecrHostPattern matches the hosts of ECR registries, capturing the region.
+var ecrHostPattern = regexp.MustCompile(
+	`^[0-9]{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ECRAuthorization is an authorization token of ECR, decoded into the
+// credentials with which Docker logs in to the registry.
+type ECRAuthorization struct {
+	Username string
+	Password string
+	Expires  time.Time
+}
+
+// ECRRegion returns the region of the ECR registry at host, or false if
+// host is not the host of an ECR registry. The host may include a scheme,
+// a port and a path, as the server URLs given by Docker do.
+func ECRRegion(host string) (string, bool) {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	host, _, _ = strings.Cut(host, ":")
+
+	m := ecrHostPattern.FindStringSubmatch(host)
+	if m == nil {
+		return "", false
+	}
+
+	return m[1], true
+}
+
+// ECREndpoint returns the URL of the ECR API endpoint of the region.
+func ECREndpoint(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return fmt.Sprintf("https://api.ecr.%s.amazonaws.com.cn/", region)
+	}
+
+	return fmt.Sprintf("https://api.ecr.%s.amazonaws.com/", region)
+}
+
+// GetAuthorizationToken calls ecr:GetAuthorizationToken at the endpoint
+// with the credentials, signing the request at now, and returns the
+// decoded token. If client is nil, a client with a short timeout is used.
+func GetAuthorizationToken(
+	ctx context.Context,
+	client *http.Client,
+	endpoint string,
+	creds Credentials,
+	region string,
+	now time.Time,
+) (ECRAuthorization, error) {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader("{}"))
+	if err != nil {
+		return ECRAuthorization{}, err
+	}
+
+	req.Header.Set("Content-Type", ecrContentType)
+	req.Header.Set("X-Amz-Target", ecrTarget)
+
+	if err = Sign(req, creds, "ecr", region, now); err != nil {
+		return ECRAuthorization{}, fmt.Errorf("error signing request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ECRAuthorization{}, fmt.Errorf("error requesting ECR authorization token: %w", err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ECRAuthorization{}, fmt.Errorf("error reading ECR response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+
+		if json.Unmarshal(body, &apiErr) != nil || apiErr.Type == "" {
+			return ECRAuthorization{}, fmt.Errorf("ECR returned status %d", resp.StatusCode)
+		}
+
+		// The type may be prefixed with a namespace followed by '#'
+		if i := strings.LastIndex(apiErr.Type, "#"); i >= 0 {
+			apiErr.Type = apiErr.Type[i+1:]
+		}
+
+		return ECRAuthorization{}, fmt.Errorf("ECR returned status %d: %s: %s", resp.StatusCode,
+			apiErr.Type, apiErr.Message)
+	}
+
+	var out struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+
+	if err = json.Unmarshal(body, &out); err != nil {
+		return ECRAuthorization{}, fmt.Errorf("error decoding ECR response: %w", err)
+	}
+
+	if len(out.AuthorizationData) == 0 {
+		return ECRAuthorization{}, fmt.Errorf("ECR returned no authorization data")
+	}
+
+	data := out.AuthorizationData[0]
+
+	token, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return ECRAuthorization{}, fmt.Errorf("error decoding ECR authorization token: %w", err)
+	}
+
+	username, password, ok := strings.Cut(string(token), ":")
+	if !ok {
+		return ECRAuthorization{}, fmt.Errorf("ECR authorization token is malformed")
+	}
+
+	return ECRAuthorization{
+		Username: username,
+		Password: password,
+		Expires:  time.Unix(0, int64(data.ExpiresAt*float64(time.Second))),
+	}, nil
+}
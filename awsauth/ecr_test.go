@@ -0,0 +1,146 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestECRRegion(t *testing.T) {
+	cases := []struct {
+		host   string
+		region string
+		ok     bool
+	}{
+		{"123456789012.dkr.ecr.eu-west-1.amazonaws.com", "eu-west-1", true},
+		{"https://123456789012.dkr.ecr.us-east-1.amazonaws.com/v2/", "us-east-1", true},
+		{"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com:443", "us-gov-west-1", true},
+		{"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn", "cn-north-1", true},
+		{"docker.io", "", false},
+		{"dkr.ecr.eu-west-1.amazonaws.com", "", false},
+	}
+
+	for _, tc := range cases {
+		region, ok := ECRRegion(tc.host)
+		if region != tc.region || ok != tc.ok {
+			t.Errorf("ECRRegion(%q) = %q, %v; expected %q, %v", tc.host, region, ok, tc.region, tc.ok)
+		}
+	}
+}
+
+func TestECREndpoint(t *testing.T) {
+	cases := map[string]string{
+		"eu-west-1":  "https://api.ecr.eu-west-1.amazonaws.com/",
+		"cn-north-1": "https://api.ecr.cn-north-1.amazonaws.com.cn/",
+	}
+
+	for region, endpoint := range cases {
+		if got := ECREndpoint(region); got != endpoint {
+			t.Errorf("Expected endpoint %s for region %s, got %s", endpoint, region, got)
+		}
+	}
+}
+
+func TestGetAuthorizationToken(t *testing.T) {
+	creds := Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}
+	expires := time.Unix(1700000000, 0)
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:ecr password"))
+
+	cases := []struct {
+		name     string
+		status   int
+		body     string
+		expected ECRAuthorization
+		err      string
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+			body: fmt.Sprintf(`{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d,`+
+				`"proxyEndpoint":"https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"}]}`, token, expires.Unix()),
+			expected: ECRAuthorization{Username: "AWS", Password: "ecr password", Expires: expires},
+		},
+		{
+			name:   "access-denied",
+			status: http.StatusBadRequest,
+			body:   `{"__type":"com.amazonaws.ecr#AccessDeniedException","message":"not authorized"}`,
+			err:    "ECR returned status 400: AccessDeniedException: not authorized",
+		},
+		{
+			name:   "no-data",
+			status: http.StatusOK,
+			body:   `{"authorizationData":[]}`,
+			err:    "ECR returned no authorization data",
+		},
+		{
+			name:   "malformed-token",
+			status: http.StatusOK,
+			body: fmt.Sprintf(`{"authorizationData":[{"authorizationToken":%q}]}`,
+				base64.StdEncoding.EncodeToString([]byte("AWS"))),
+			err: "ECR authorization token is malformed",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if target := r.Header.Get("X-Amz-Target"); target != ecrTarget {
+					t.Errorf("Expected X-Amz-Target %s, got %s", ecrTarget, target)
+				}
+				if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "/eu-west-1/ecr/aws4_request") {
+					t.Errorf("Expected request to be signed for ecr in eu-west-1, got %s", auth)
+				}
+				if r.Header.Get(headerAmzSecurityToken) != "TOKEN" {
+					t.Error("Expected the session token to be sent")
+				}
+
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body)) // nolint: errcheck
+			}))
+			defer server.Close()
+
+			got, err := GetAuthorizationToken(context.Background(), server.Client(), server.URL, creds, "eu-west-1",
+				time.Now())
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.Expires.Equal(tc.expected.Expires) {
+				t.Fatalf("Expected expiration %s, got %s", tc.expected.Expires, got.Expires)
+			}
+
+			got.Expires = tc.expected.Expires
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Fatalf("Authorizations differ:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRegion is the region used when none is configured.
+	DefaultRegion = "us-east-1"
+
+	// HeaderIAMServerID is the header which Vault can require in signed
+	// requests to prevent replay attacks against other Vault servers.
+	HeaderIAMServerID = "X-Vault-AWS-IAM-Server-ID"
+
+	stsAPIVersion   = "2011-06-15"
+	formContentType = "application/x-www-form-urlencoded; charset=utf-8"
+)
+
+// ResolveRegion returns the region if it is set, otherwise the region
+// given by AWS_REGION or AWS_DEFAULT_REGION, otherwise DefaultRegion.
+func ResolveRegion(region string) string {
+	if region != "" {
+		return region
+	}
+
+	if region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+
+	return DefaultRegion
+}
+
+// STSEndpoint returns the URL of the STS endpoint of the region. As with
+// the AWS SDK, the global endpoint is used for us-east-1.
+func STSEndpoint(region string) string {
+	switch {
+	case region == DefaultRegion:
+		return "https://sts.amazonaws.com/"
+	case strings.HasPrefix(region, "cn-"):
+		return fmt.Sprintf("https://sts.%s.amazonaws.com.cn/", region)
+	default:
+		return fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	}
+}
+
+// ValidateSTSEndpoint returns an error unless endpoint is the HTTPS URL of
+// an STS endpoint, such as a VPC endpoint or a FIPS endpoint.
+func ValidateSTSEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("error parsing STS endpoint: %w", err)
+	}
+
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("STS endpoint %q is not an https:// URL", endpoint)
+	}
+
+	return nil
+}
+
+// IAMLoginData returns the data with which the aws auth method of Vault is
+// logged in to with the iam type: a signed sts:GetCallerIdentity request
+// which Vault sends to AWS on the client's behalf. If serverID is set, it
+// is included in the signed request as the X-Vault-AWS-IAM-Server-ID
+// header. The request is signed at now for the region and sent to endpoint
+// or, if it is empty, to the STS endpoint of the region.
+func IAMLoginData(creds Credentials, serverID, region, endpoint string, now time.Time) (map[string]interface{}, error) {
+	region = ResolveRegion(region)
+	body := "Action=GetCallerIdentity&Version=" + stsAPIVersion
+
+	if endpoint == "" {
+		endpoint = STSEndpoint(region)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", formContentType)
+
+	if serverID != "" {
+		req.Header.Set(HeaderIAMServerID, serverID)
+	}
+
+	if err = Sign(req, creds, "sts", region, now); err != nil {
+		return nil, fmt.Errorf("error signing request: %w", err)
+	}
+
+	headers, err := json.Marshal(req.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"iam_http_request_method": req.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(req.URL.String())),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+		"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(body)),
+	}, nil
+}
+
+// EC2LoginData returns the data with which the aws auth method of Vault is
+// logged in to with the ec2 type: the instance identity document and its
+// signature, read from the instance metadata, and the nonce.
+func EC2LoginData(ctx context.Context, imds *MetadataClient, nonce string) (map[string]interface{}, error) {
+	if imds.disabled() {
+		return nil, fmt.Errorf("instance metadata is disabled by AWS_EC2_METADATA_DISABLED=%s",
+			os.Getenv("AWS_EC2_METADATA_DISABLED"))
+	}
+
+	doc, err := imds.Get(ctx, "dynamic/instance-identity/document")
+	if err != nil {
+		return nil, fmt.Errorf("error requesting doc: %w", err)
+	}
+
+	signature, err := imds.Get(ctx, "dynamic/instance-identity/signature")
+	if err != nil {
+		return nil, fmt.Errorf("error requesting signature: %w", err)
+	}
+
+	return map[string]interface{}{
+		"identity":  base64.StdEncoding.EncodeToString([]byte(doc)),
+		"signature": signature,
+		"nonce":     nonce,
+	}, nil
+}
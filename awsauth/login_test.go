@@ -0,0 +1,168 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSTSEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"us-east-1":  "https://sts.amazonaws.com/",
+		"eu-west-1":  "https://sts.eu-west-1.amazonaws.com/",
+		"cn-north-1": "https://sts.cn-north-1.amazonaws.com.cn/",
+	}
+
+	for region, endpoint := range cases {
+		if got := STSEndpoint(region); got != endpoint {
+			t.Errorf("Expected endpoint %s for region %s, got %s", endpoint, region, got)
+		}
+	}
+}
+
+func TestValidateSTSEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"https://sts.us-gov-west-1.amazonaws.com":             "",
+		"https://vpce-0123.sts.us-east-1.vpce.amazonaws.com/": "",
+		"http://sts.us-east-1.amazonaws.com":                  `STS endpoint "http://sts.us-east-1.amazonaws.com" is not an https:// URL`,
+		"sts.us-east-1.amazonaws.com":                         `STS endpoint "sts.us-east-1.amazonaws.com" is not an https:// URL`,
+	}
+
+	for endpoint, expected := range cases {
+		var got string
+		if err := ValidateSTSEndpoint(endpoint); err != nil {
+			got = err.Error()
+		}
+
+		if got != expected {
+			t.Errorf("Errors of %s differ:\n%v", endpoint, cmp.Diff(expected, got))
+		}
+	}
+}
+
+func TestResolveRegion(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	if got := ResolveRegion(""); got != DefaultRegion {
+		t.Errorf("Expected region %s, got %s", DefaultRegion, got)
+	}
+
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+	if got := ResolveRegion(""); got != "eu-west-1" {
+		t.Errorf("Expected region %s, got %s", "eu-west-1", got)
+	}
+
+	if got := ResolveRegion("ap-south-1"); got != "ap-south-1" {
+		t.Errorf("Expected region %s, got %s", "ap-south-1", got)
+	}
+}
+
+func TestIAMLoginData(t *testing.T) {
+	creds := Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	data, err := IAMLoginData(creds, "vault.example.com", "eu-west-1", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data["iam_http_request_method"] != http.MethodPost {
+		t.Errorf("Expected method %s, got %v", http.MethodPost, data["iam_http_request_method"])
+	}
+
+	decode := func(key string) []byte {
+		t.Helper()
+
+		s, ok := data[key].(string)
+		if !ok {
+			t.Fatalf("%s is not a string", key)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	if url := string(decode("iam_request_url")); url != "https://sts.eu-west-1.amazonaws.com/" {
+		t.Errorf("Expected URL %s, got %s", "https://sts.eu-west-1.amazonaws.com/", url)
+	}
+	if body := string(decode("iam_request_body")); body != "Action=GetCallerIdentity&Version=2011-06-15" {
+		t.Errorf("Unexpected body %q", body)
+	}
+
+	var headers http.Header
+	if err = json.Unmarshal(decode("iam_request_headers"), &headers); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := headers.Get(HeaderIAMServerID); got != "vault.example.com" {
+		t.Errorf("Expected %s header %q, got %q", HeaderIAMServerID, "vault.example.com", got)
+	}
+	if got := headers.Get(headerAmzSecurityToken); got != "TOKEN" {
+		t.Errorf("Expected %s header %q, got %q", headerAmzSecurityToken, "TOKEN", got)
+	}
+	if got := headers.Get(headerAmzDate); got != "20150830T123600Z" {
+		t.Errorf("Expected %s header %q, got %q", headerAmzDate, "20150830T123600Z", got)
+	}
+
+	authorization := headers.Get("Authorization")
+	for _, want := range []string{
+		"Credential=AKID/",
+		"/eu-west-1/sts/aws4_request",
+		"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-vault-aws-iam-server-id",
+	} {
+		if !strings.Contains(authorization, want) {
+			t.Errorf("Expected Authorization header %q to contain %q", authorization, want)
+		}
+	}
+}
+
+func TestEC2LoginData(t *testing.T) {
+	imds := newFakeMetadata(t)
+	defer imds.Close()
+
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+
+	data, err := EC2LoginData(context.Background(), NewMetadataClient(nil), "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"identity":  base64.StdEncoding.EncodeToString([]byte(`{"instanceId":"i-1234567890abcdef0"}`)),
+		"signature": "signature",
+		"nonce":     "nonce",
+	}
+	if !cmp.Equal(expected, data) {
+		t.Fatalf("Login data differs:\n%v", cmp.Diff(expected, data))
+	}
+
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	if _, err = EC2LoginData(context.Background(), NewMetadataClient(nil), "nonce"); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/imds"
+)
+
+const (
+	defaultMetadataEndpoint = "http://169.254.169.254"
+	metadataTokenTTL        = 21600
+
+	headerMetadataToken    = "X-aws-ec2-metadata-token"
+	headerMetadataTokenTTL = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	defaultMetadataCacheTTL = 5 * time.Minute
+)
+
+// metadataCacheTTLs are how long the metadata under each path prefix is
+// cached. The instance identity never changes, while the credentials of
+// the instance profile are rotated.
+var metadataCacheTTLs = map[string]time.Duration{
+	"dynamic/instance-identity/":          time.Hour,
+	"meta-data/iam/security-credentials/": time.Minute,
+}
+
+// MetadataClient reads the EC2 instance metadata. It uses IMDSv2 session
+// tokens and falls back to IMDSv1 if a token cannot be obtained. Its calls
+// go through the imds.Default pool, so the metadata is cached and only a
+// few calls are made at once by all clients.
+type MetadataClient struct {
+	client   *http.Client
+	pool     *imds.Pool
+	endpoint string
+	token    string
+}
+
+// NewMetadataClient creates a new MetadataClient. The endpoint can be
+// overridden with AWS_EC2_METADATA_SERVICE_ENDPOINT.
+func NewMetadataClient(client *http.Client) *MetadataClient {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultMetadataEndpoint
+	}
+
+	return &MetadataClient{
+		client:   client,
+		pool:     imds.Default,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+	}
+}
+
+// Get returns the metadata at the path relative to /latest/, e.g.
+// "dynamic/instance-identity/document".
+func (m *MetadataClient) Get(ctx context.Context, path string) (string, error) {
+	value, err := m.pool.Do(ctx, m.endpoint+"/latest/"+path, func(ctx context.Context) (interface{}, time.Duration, error) {
+		body, err := m.get(ctx, path)
+		return body, metadataCacheTTL(path), err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return value.(string), nil
+}
+
+func (m *MetadataClient) get(ctx context.Context, path string) (string, error) {
+	req, err := m.newRequest(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting %s: %w", path, err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error requesting %s: %s", path, resp.Status)
+	}
+
+	return string(body), nil
+}
+
+// metadataCacheTTL returns how long the metadata at path is cached.
+func metadataCacheTTL(path string) time.Duration {
+	for prefix, ttl := range metadataCacheTTLs {
+		if strings.HasPrefix(path, prefix) {
+			return ttl
+		}
+	}
+
+	return defaultMetadataCacheTTL
+}
+
+func (m *MetadataClient) newRequest(ctx context.Context, path string) (*http.Request, error) {
+	if m.token == "" {
+		m.token = m.fetchToken(ctx)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+"/latest/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.token != "" {
+		req.Header.Set(headerMetadataToken, m.token)
+	}
+
+	return req, nil
+}
+
+// fetchToken returns an IMDSv2 session token, or an empty string if none
+// could be obtained.
+func (m *MetadataClient) fetchToken(ctx context.Context) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, m.endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return ""
+	}
+
+	req.Header.Set(headerMetadataTokenTTL, strconv.Itoa(metadataTokenTTL))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	token, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(token))
+}
+
+// disabled reports whether the metadata service was disabled with
+// AWS_EC2_METADATA_DISABLED.
+func (m *MetadataClient) disabled() bool {
+	v, _ := strconv.ParseBool(os.Getenv("AWS_EC2_METADATA_DISABLED"))
+	return v
+}
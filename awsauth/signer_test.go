@@ -0,0 +1,127 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsauth
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSign(t *testing.T) {
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	body := "Action=GetCallerIdentity&Version=2011-06-15"
+
+	cases := []struct {
+		name          string
+		method        string
+		url           string
+		body          string
+		headers       map[string]string
+		creds         Credentials
+		service       string
+		region        string
+		authorization string
+	}{
+		{
+			// The "get-vanilla" case of the AWS Signature Version 4 test suite
+			name:    "get-vanilla",
+			method:  http.MethodGet,
+			url:     "https://example.amazonaws.com/",
+			creds:   Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"},
+			service: "service",
+			region:  "us-east-1",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "sts-with-query",
+			method: http.MethodPost,
+			url:    "https://sts.eu-west-1.amazonaws.com/?b=2&a=x y~",
+			body:   body,
+			headers: map[string]string{
+				"Content-Type":    formContentType,
+				HeaderIAMServerID: "vault.example.com",
+			},
+			creds:   Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"},
+			service: "sts",
+			region:  "eu-west-1",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKID/20150830/eu-west-1/sts/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date;x-vault-aws-iam-server-id, " +
+				"Signature=198bbdab82fb8bdecebdeed334bd20ea86e6f8d5a8ef81df1f50b2b7a5d3270b",
+		},
+		{
+			name:   "session-token",
+			method: http.MethodPost,
+			url:    "https://sts.eu-west-1.amazonaws.com/?b=2&a=x y~",
+			body:   body,
+			headers: map[string]string{
+				"Content-Type":    formContentType,
+				HeaderIAMServerID: "vault.example.com",
+			},
+			creds:   Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "sess/tok+en"},
+			service: "sts",
+			region:  "eu-west-1",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKID/20150830/eu-west-1/sts/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-vault-aws-iam-server-id, " +
+				"Signature=648441ba7ab7cfd237d1937bb37d8104eacb2007cfa1300d3861755a2ad8be5a",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reqBody io.Reader
+			if tc.body != "" {
+				reqBody = strings.NewReader(tc.body)
+			}
+
+			req, err := http.NewRequest(tc.method, tc.url, reqBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			if err = Sign(req, tc.creds, tc.service, tc.region, now); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := req.Header.Get("Authorization"); got != tc.authorization {
+				t.Fatalf("Authorization headers differ:\n%v", cmp.Diff(tc.authorization, got))
+			}
+			if got := req.Header.Get(headerAmzDate); got != "20150830T123600Z" {
+				t.Errorf("Expected %s header %q, got %q", headerAmzDate, "20150830T123600Z", got)
+			}
+			if got := req.Header.Get(headerAmzSecurityToken); got != tc.creds.SessionToken {
+				t.Errorf("Expected %s header %q, got %q", headerAmzSecurityToken, tc.creds.SessionToken, got)
+			}
+
+			if req.Body != nil {
+				data, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != tc.body {
+					t.Errorf("Expected the body to be preserved, got %q", string(data))
+				}
+			}
+		})
+	}
+}
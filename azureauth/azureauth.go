@@ -0,0 +1,339 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package azureauth implements the small part of the Azure SDK needed to
+// log in to Azure Container Registry: obtaining Azure AD tokens and
+// exchanging them for ACR refresh tokens.
+package azureauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/imds"
+)
+
+const (
+	// DefaultAuthorityHost is the Azure AD endpoint of the public cloud.
+	DefaultAuthorityHost = "https://login.microsoftonline.com"
+
+	// DefaultIMDSEndpoint is the token endpoint of managed identities of
+	// the instance metadata service.
+	DefaultIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	// Resource is the resource of the Azure AD tokens which ACR accepts in
+	// exchange for refresh tokens.
+	Resource = "https://management.azure.com/"
+
+	// RegistryUsername is the username with which Docker logs in to a
+	// registry with a refresh token.
+	RegistryUsername = "00000000-0000-0000-0000-000000000000"
+
+	imdsAPIVersion = "2018-02-01"
+	httpTimeout    = 10 * time.Second
+
+	// expiryMargin is how long before they expire the tokens of managed
+	// identities stop being served from the cache.
+	expiryMargin = 5 * time.Minute
+)
+
+// registrySuffixes are the suffixes of the registry hosts of the Azure
+// public, China and US Government clouds.
+var registrySuffixes = []string{".azurecr.io", ".azurecr.cn", ".azurecr.us"}
+
+// Token is an Azure AD access token or an ACR refresh token.
+type Token struct {
+	Token   string
+	Expires time.Time
+}
+
+// RegistryHost returns the host of the server URL given by Docker, without
+// its scheme, port and path, and whether it is the host of an Azure
+// Container Registry.
+func RegistryHost(serverURL string) (string, bool) {
+	host := strings.TrimPrefix(strings.TrimPrefix(serverURL, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	host, _, _ = strings.Cut(host, ":")
+
+	for _, suffix := range registrySuffixes {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return host, true
+		}
+	}
+
+	return host, false
+}
+
+// IsRegistryHost reports whether the server URL given by Docker is that of
+// an Azure Container Registry.
+func IsRegistryHost(serverURL string) bool {
+	_, ok := RegistryHost(serverURL)
+	return ok
+}
+
+// ExchangeEndpoint returns the URL of the endpoint of the registry at host
+// which exchanges Azure AD tokens for refresh tokens.
+func ExchangeEndpoint(host string) string {
+	return "https://" + host + "/oauth2/exchange"
+}
+
+// ClientCredentialsToken requests an Azure AD token of the service
+// principal, such as one generated by the azure secrets engine, from the
+// tenant at the authority host. If authorityHost is empty,
+// DefaultAuthorityHost is used. If client is nil, a client with a short
+// timeout is used. The expiration of the token is computed with clk or, if
+// it is nil, the system clock.
+func ClientCredentialsToken(
+	ctx context.Context,
+	client *http.Client,
+	clk clock.Clock,
+	authorityHost string,
+	tenantID string,
+	clientID string,
+	clientSecret string,
+) (Token, error) {
+	if authorityHost == "" {
+		authorityHost = DefaultAuthorityHost
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"scope":         {Resource + ".default"},
+	}
+
+	endpoint := strings.TrimSuffix(authorityHost, "/") + "/" + url.PathEscape(tenantID) + "/oauth2/v2.0/token"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return aadToken(client, clk, req)
+}
+
+// ManagedIdentityToken requests an Azure AD token of the managed identity
+// of the host from the instance metadata service at endpoint. If clientID
+// is set, the token of that user-assigned identity is requested. If
+// endpoint is empty, DefaultIMDSEndpoint is used. If client is nil, a
+// client with a short timeout is used. The call goes through the
+// imds.Default pool, which caches the token until shortly before it
+// expires. The expiration is computed with clk or, if it is nil, the
+// system clock.
+func ManagedIdentityToken(
+	ctx context.Context,
+	client *http.Client,
+	clk clock.Clock,
+	endpoint string,
+	clientID string,
+) (Token, error) {
+	if clk == nil {
+		clk = clock.System()
+	}
+
+	if endpoint == "" {
+		endpoint = DefaultIMDSEndpoint
+	}
+
+	query := url.Values{
+		"api-version": {imdsAPIVersion},
+		"resource":    {Resource},
+	}
+
+	if clientID != "" {
+		query.Set("client_id", clientID)
+	}
+
+	tokenURL := endpoint + "?" + query.Encode()
+
+	value, err := imds.Default.Do(ctx, tokenURL, func(ctx context.Context) (interface{}, time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		req.Header.Set("Metadata", "true")
+
+		token, err := aadToken(client, clk, req)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return token, token.Expires.Sub(clk.Now()) - expiryMargin, nil
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	return value.(Token), nil
+}
+
+// aadToken sends a request to an Azure AD token endpoint and returns the
+// token in its response.
+func aadToken(client *http.Client, clk clock.Clock, req *http.Request) (Token, error) {
+	var out struct {
+		AccessToken      string      `json:"access_token"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+
+	if clk == nil {
+		clk = clock.System()
+	}
+
+	now := clk.Now()
+
+	status, err := doJSON(client, req, &out)
+	if err != nil {
+		return Token{}, fmt.Errorf("error requesting Azure AD token: %w", err)
+	}
+
+	if status != http.StatusOK || out.AccessToken == "" {
+		if out.Error == "" {
+			return Token{}, fmt.Errorf("token endpoint returned status %d", status)
+		}
+
+		return Token{}, fmt.Errorf("token endpoint returned status %d: %s: %s", status,
+			out.Error, out.ErrorDescription)
+	}
+
+	token := Token{Token: out.AccessToken}
+	if expiresIn, err := strconv.ParseInt(out.ExpiresIn.String(), 10, 64); err == nil {
+		token.Expires = now.Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+// ExchangeRefreshToken exchanges the Azure AD token for a refresh token of
+// the registry at host through the exchange endpoint. The tenant is only
+// required if the token was not issued by the tenant of the registry. If
+// client is nil, a client with a short timeout is used.
+func ExchangeRefreshToken(
+	ctx context.Context,
+	client *http.Client,
+	endpoint string,
+	host string,
+	tenantID string,
+	token Token,
+) (Token, error) {
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"access_token": {token.Token},
+	}
+
+	if tenantID != "" {
+		form.Set("tenant", tenantID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var out struct {
+		RefreshToken string `json:"refresh_token"`
+		Errors       []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	status, err := doJSON(client, req, &out)
+	if err != nil {
+		return Token{}, fmt.Errorf("error exchanging Azure AD token: %w", err)
+	}
+
+	if status != http.StatusOK || out.RefreshToken == "" {
+		if len(out.Errors) == 0 {
+			return Token{}, fmt.Errorf("exchange endpoint returned status %d", status)
+		}
+
+		return Token{}, fmt.Errorf("exchange endpoint returned status %d: %s: %s", status,
+			out.Errors[0].Code, out.Errors[0].Message)
+	}
+
+	// The refresh token is a JWT. If its expiration cannot be read, it is
+	// assumed to expire with the Azure AD token.
+	expires, ok := jwtExpiration(out.RefreshToken)
+	if !ok {
+		expires = token.Expires
+	}
+
+	return Token{Token: out.RefreshToken, Expires: expires}, nil
+}
+
+// doJSON sends the request and decodes the JSON body of the response into
+// out, returning the status code of the response.
+func doJSON(client *http.Client, req *http.Request, out interface{}) (int, error) {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if err = json.Unmarshal(body, out); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, errors.New("response is not valid JSON")
+	}
+
+	return resp.StatusCode, nil
+}
+
+// jwtExpiration returns the 'exp' claim of the JWT without verifying it.
+func jwtExpiration(token string) (time.Time, bool) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.Exp, 0), true
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package azureauth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestRegistryHost(t *testing.T) {
+	cases := map[string]bool{
+		"myregistry.azurecr.io":              true,
+		"https://myregistry.azurecr.io/v2/":  true,
+		"myregistry.azurecr.cn:443":          true,
+		"azurecr.io":                         false,
+		".azurecr.io":                        false,
+		"myregistry.azurecr.io.example.com":  false,
+		"123456789012.dkr.ecr.amazonaws.com": false,
+	}
+
+	for host, expected := range cases {
+		if got := IsRegistryHost(host); got != expected {
+			t.Errorf("IsRegistryHost(%q) = %v, expected %v", host, got, expected)
+		}
+	}
+
+	if host, _ := RegistryHost("https://myregistry.azurecr.io:443/v2/"); host != "myregistry.azurecr.io" {
+		t.Fatalf("Expected host %q, got %q", "myregistry.azurecr.io", host)
+	}
+}
+
+func TestClientCredentialsToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/my-tenant/oauth2/v2.0/token" {
+			t.Errorf("Unexpected path %q", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		expected := map[string]string{
+			"grant_type":    "client_credentials",
+			"client_id":     "app-id",
+			"client_secret": "app-secret",
+			"scope":         "https://management.azure.com/.default",
+		}
+		for k, v := range expected {
+			if got := r.PostForm.Get(k); got != v {
+				t.Errorf("Expected %s %q, got %q", k, v, got)
+			}
+		}
+
+		fmt.Fprint(w, `{"token_type":"Bearer","expires_in":3599,"access_token":"aad token"}`)
+	}))
+	defer server.Close()
+
+	clk := clock.NewFake(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	token, err := ClientCredentialsToken(context.Background(), server.Client(), clk, server.URL, "my-tenant",
+		"app-id", "app-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Token != "aad token" {
+		t.Fatalf("Expected token %q, got %q", "aad token", token.Token)
+	}
+	if expected := clk.Now().Add(3599 * time.Second); !token.Expires.Equal(expected) {
+		t.Fatalf("Expected the token to expire at %s, got %s", expected, token.Expires)
+	}
+}
+
+func TestManagedIdentityToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			t.Error("Expected the Metadata header to be set")
+		}
+
+		query := r.URL.Query()
+		if query.Get("resource") != Resource || query.Get("client_id") != "identity-id" {
+			t.Errorf("Unexpected query %v", query)
+		}
+
+		// The instance metadata service returns numbers as strings
+		fmt.Fprint(w, `{"access_token":"msi token","expires_in":"86399","token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	token, err := ManagedIdentityToken(context.Background(), server.Client(), nil, server.URL, "identity-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Token != "msi token" {
+		t.Fatalf("Expected token %q, got %q", "msi token", token.Token)
+	}
+	if ttl := time.Until(token.Expires); ttl < 23*time.Hour || ttl > 24*time.Hour {
+		t.Fatalf("Expected the token to expire in about a day, got %s", ttl)
+	}
+}
+
+func TestExchangeRefreshToken(t *testing.T) {
+	expires := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	refreshToken := "eyJhbGciOiJSUzI1NiJ9." +
+		base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expires.Unix()))) +
+		".signature"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		switch r.PostForm.Get("access_token") {
+		case "aad token":
+		case "opaque":
+			fmt.Fprint(w, `{"refresh_token":"opaque refresh token"}`)
+			return
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"errors":[{"code":"UNAUTHORIZED","message":"invalid token"}]}`)
+			return
+		}
+
+		if r.PostForm.Get("service") != "myregistry.azurecr.io" || r.PostForm.Get("tenant") != "my-tenant" {
+			t.Errorf("Unexpected form %v", r.PostForm)
+		}
+
+		fmt.Fprintf(w, `{"refresh_token":%q}`, refreshToken)
+	}))
+	defer server.Close()
+
+	aadExpires := time.Now().Add(time.Hour)
+
+	cases := []struct {
+		name     string
+		token    string
+		expected Token
+		err      string
+	}{
+		{
+			name:     "jwt",
+			token:    "aad token",
+			expected: Token{Token: refreshToken, Expires: expires},
+		},
+		{
+			name:     "opaque",
+			token:    "opaque",
+			expected: Token{Token: "opaque refresh token", Expires: aadExpires},
+		},
+		{
+			name:  "unauthorized",
+			token: "bad token",
+			err:   "exchange endpoint returned status 401: UNAUTHORIZED: invalid token",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := ExchangeRefreshToken(context.Background(), server.Client(), server.URL,
+				"myregistry.azurecr.io", "my-tenant", Token{Token: tc.token, Expires: aadExpires})
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, token); diff != "" {
+				t.Fatalf("Tokens differ:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+const bundleVersion = 1
+
+// bundle is the plaintext of a credential bundle.
+type bundle struct {
+	Version     int                          `json:"version"`
+	Created     time.Time                    `json:"created"`
+	Credentials map[string]bundleCredentials `json:"credentials"`
+}
+
+// bundleCredentials are the credentials of a registry in a bundle. Docker
+// keeps identity tokens in the 'identitytoken' of a registry rather than
+// in its 'auth'.
+type bundleCredentials struct {
+	Username      string `json:"username"`
+	Secret        string `json:"secret"`
+	IdentityToken bool   `json:"identity_token,omitempty"`
+}
+
+// tokenUsernames returns the username with which the helper returns the
+// identity token of a registry, if it is not vault.IdentityTokenUsername.
+type tokenUsernames interface {
+	IdentityTokenUsername(registry string) (string, bool)
+}
+
+// runExport reads the credentials of registries, the registries of the
+// configuration unless -registry is given, and writes them to out, or to
+// the file given with -o, as a bundle encrypted with OpenPGP to the public
+// keys given with -recipient or with the passphrase read from the file
+// given with -passphrase-file. Identity tokens are told apart by the
+// username with which usernames says the helper returns them.
+func runExport(g credentialGetter, registries []string, usernames tokenUsernames, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "", "file to write the bundle to (default: standard output)")
+	passphraseFile := flags.String("passphrase-file", "", "file holding the passphrase to encrypt the bundle with")
+
+	var only, recipients repeatedFlag
+
+	flags.Var(&only, "registry", "registry to export the credentials of; may be repeated "+
+		"(default: the registries of the configuration)")
+	flags.Var(&recipients, "recipient", "file holding the armored public key to encrypt the bundle to; "+
+		"may be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return xerrors.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	if (len(recipients) == 0) == (*passphraseFile == "") {
+		return xerrors.New("exactly one of -recipient or -passphrase-file must be given")
+	}
+
+	if len(only) > 0 {
+		registries = only
+	}
+
+	if len(registries) == 0 {
+		return xerrors.New("the configuration uses one secret for every registry; " +
+			"name the registries to export the credentials of with -registry")
+	}
+
+	b := bundle{
+		Version:     bundleVersion,
+		Created:     time.Now().UTC(),
+		Credentials: make(map[string]bundleCredentials, len(registries)),
+	}
+
+	for _, registry := range registries {
+		key, err := config.NormalizeRegistry(registry)
+		if err != nil || key == "" {
+			return xerrors.Errorf("invalid registry %q", registry)
+		}
+
+		username, secret, err := g.Get(key)
+		if err != nil {
+			return xerrors.Errorf("error reading the credentials of %s: %w", registry, err)
+		}
+
+		tokenUsername, ok := usernames.IdentityTokenUsername(key)
+		if !ok {
+			tokenUsername = vault.IdentityTokenUsername
+		}
+
+		b.Credentials[key] = bundleCredentials{
+			Username:      username,
+			Secret:        secret,
+			IdentityToken: username == tokenUsername,
+		}
+	}
+
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	var ciphertext bytes.Buffer
+
+	if err = encryptBundle(&ciphertext, plaintext, recipients, *passphraseFile); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = out.Write(ciphertext.Bytes())
+		return err
+	}
+
+	return writeFileAtomic(*output, ciphertext.Bytes(), 0o600)
+}
+
+// encryptBundle writes plaintext to w as an armored OpenPGP message
+// encrypted to the keys in the recipient files or, if there are none, with
+// the passphrase in passphraseFile.
+func encryptBundle(w io.Writer, plaintext []byte, recipientFiles []string, passphraseFile string) error {
+	armored, err := armor.Encode(w, "PGP MESSAGE", nil)
+	if err != nil {
+		return err
+	}
+
+	hints := &openpgp.FileHints{IsBinary: true, FileName: "credentials.json"}
+
+	var encrypted io.WriteCloser
+
+	if len(recipientFiles) > 0 {
+		var to openpgp.EntityList
+
+		for _, file := range recipientFiles {
+			keys, err := readKeyRing(file)
+			if err != nil {
+				return err
+			}
+
+			to = append(to, keys...)
+		}
+
+		encrypted, err = openpgp.Encrypt(armored, to, nil, hints, nil)
+	} else {
+		var passphrase []byte
+
+		if passphrase, err = readPassphrase(passphraseFile); err != nil {
+			return err
+		}
+
+		encrypted, err = openpgp.SymmetricallyEncrypt(armored, passphrase, hints, nil)
+	}
+
+	if err != nil {
+		return xerrors.Errorf("error encrypting the bundle: %w", err)
+	}
+
+	if _, err = encrypted.Write(plaintext); err != nil {
+		return xerrors.Errorf("error encrypting the bundle: %w", err)
+	}
+
+	if err = encrypted.Close(); err != nil {
+		return xerrors.Errorf("error encrypting the bundle: %w", err)
+	}
+
+	return armored.Close()
+}
+
+// runImport decrypts the bundle named by args with the private key given
+// with -identity or the passphrase read from the file given with
+// -passphrase-file, and adds the credentials it holds to the 'auths' of
+// the configuration file of a container tool, so that the tool uses them
+// without the helper.
+func runImport(args []string, out io.Writer) error {
+	f := newInstallFlags("import", "registry to import the credentials of; may be repeated "+
+		"(default: every registry of the bundle)")
+	identityFile := f.flags.String("identity", "", "file holding the armored private key to decrypt the bundle with")
+	passphraseFile := f.flags.String("passphrase-file", "", "file holding the passphrase of the bundle "+
+		"or of the private key")
+
+	if err := f.flags.Parse(args); err != nil {
+		return err
+	}
+
+	if f.flags.NArg() != 1 {
+		return xerrors.New("the bundle to import must be given")
+	}
+
+	if *identityFile == "" && *passphraseFile == "" {
+		return xerrors.New("at least one of -identity or -passphrase-file must be given")
+	}
+
+	runtime, path, err := f.target()
+	if err != nil {
+		return err
+	}
+
+	b, err := decryptBundle(f.flags.Arg(0), *identityFile, *passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	only := make(map[string]bool, len(f.registries))
+
+	for _, registry := range f.registries {
+		key, err := config.NormalizeRegistry(registry)
+		if _, ok := b.Credentials[key]; err != nil || !ok {
+			return xerrors.Errorf("the bundle has no credentials of %s", registry)
+		}
+
+		only[key] = true
+	}
+
+	entries := make(map[string]json.RawMessage, len(b.Credentials))
+	imported := make(map[string]string, len(b.Credentials))
+
+	for registry, creds := range b.Credentials {
+		if len(only) > 0 && !only[registry] {
+			continue
+		}
+
+		key, err := runtime.helperKey(registry)
+		if err != nil {
+			return err
+		}
+
+		entry := map[string]string{
+			"auth": base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Secret)),
+		}
+		if creds.IdentityToken {
+			entry = map[string]string{"identitytoken": creds.Secret}
+		}
+
+		if entries[key], err = json.Marshal(entry); err != nil {
+			return err
+		}
+
+		imported[key] = registry
+	}
+
+	if err = editConfigFile(path, true, func(fields map[string]json.RawMessage) (bool, error) {
+		auths := make(map[string]json.RawMessage)
+
+		if raw, ok := fields["auths"]; ok {
+			if err := json.Unmarshal(raw, &auths); err != nil {
+				return false, xerrors.Errorf("error parsing the auths: %w", err)
+			}
+		}
+
+		for key, entry := range entries {
+			auths[key] = entry
+		}
+
+		var err error
+		fields["auths"], err = json.Marshal(auths)
+
+		return true, err
+	}); err != nil {
+		return err
+	}
+
+	return printRegistries(out, path, "imported the credentials of", imported)
+}
+
+// decryptBundle reads and decrypts the bundle in file.
+func decryptBundle(file, identityFile, passphraseFile string) (*bundle, error) {
+	var (
+		keys       openpgp.EntityList
+		passphrase []byte
+		err        error
+	)
+
+	if identityFile != "" {
+		if keys, err = readKeyRing(identityFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if passphraseFile != "" {
+		if passphrase, err = readPassphrase(passphraseFile); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := os.Open(file) // nolint: gosec
+	if err != nil {
+		return nil, xerrors.Errorf("error opening %s: %w", file, err)
+	}
+	defer r.Close() // nolint: errcheck
+
+	block, err := armor.Decode(r)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading %s: %w", file, err)
+	}
+
+	// The prompt is called until the bundle is decrypted, so the
+	// passphrase is only tried once
+	prompted := false
+
+	prompt := func(candidates []openpgp.Key, _ bool) ([]byte, error) {
+		if prompted || passphrase == nil {
+			return nil, xerrors.New("wrong key or passphrase")
+		}
+
+		prompted = true
+
+		for _, key := range candidates {
+			_ = key.PrivateKey.Decrypt(passphrase) // nolint: errcheck
+		}
+
+		return passphrase, nil
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, keys, prompt, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("error decrypting %s: %w", file, err)
+	}
+
+	// The integrity of the bundle is only checked once all of it is read
+	plaintext, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, xerrors.Errorf("error decrypting %s: %w", file, err)
+	}
+
+	var b bundle
+
+	if err = json.Unmarshal(plaintext, &b); err != nil {
+		return nil, xerrors.Errorf("error parsing %s: %w", file, err)
+	}
+
+	if b.Version != bundleVersion {
+		return nil, xerrors.Errorf("unsupported version %d of bundle %s", b.Version, file)
+	}
+
+	return &b, nil
+}
+
+// readKeyRing reads the armored OpenPGP keys in file.
+func readKeyRing(file string) (openpgp.EntityList, error) {
+	r, err := os.Open(file) // nolint: gosec
+	if err != nil {
+		return nil, xerrors.Errorf("error opening %s: %w", file, err)
+	}
+	defer r.Close() // nolint: errcheck
+
+	keys, err := openpgp.ReadArmoredKeyRing(r)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading the keys in %s: %w", file, err)
+	}
+
+	return keys, nil
+}
+
+// readPassphrase returns the first line of file.
+func readPassphrase(file string) ([]byte, error) {
+	data, err := os.ReadFile(file) // nolint: gosec
+	if err != nil {
+		return nil, xerrors.Errorf("error reading the passphrase: %w", err)
+	}
+
+	passphrase := strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r")
+	if passphrase == "" {
+		return nil, xerrors.Errorf("the passphrase in %s is empty", file)
+	}
+
+	return []byte(passphrase), nil
+}
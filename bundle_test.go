@@ -0,0 +1,385 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/google/go-cmp/cmp"
+)
+
+type bundleGetter map[string][2]string
+
+func (g bundleGetter) Get(serverURL string) (string, string, error) {
+	creds, ok := g[serverURL]
+	if !ok {
+		return "", "", errors.New("credentials not found in native keychain")
+	}
+
+	return creds[0], creds[1], nil
+}
+
+type bundleTokenUsernames map[string]string
+
+func (u bundleTokenUsernames) IdentityTokenUsername(registry string) (string, bool) {
+	username, ok := u[registry]
+	return username, ok
+}
+
+// tamper flips the last byte of the armored OpenPGP message in file, which
+// is in the hash with which the integrity of the message is checked.
+func tamper(t *testing.T, file string) {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(block.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body[len(body)-1] ^= 0x01
+
+	var buf bytes.Buffer
+
+	w, err := armor.Encode(&buf, block.Type, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(file, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeKey writes the armored public key of entity to public and its
+// private key, encrypted with passphrase unless it is empty, to private.
+func writeKey(t *testing.T, entity *openpgp.Entity, passphrase, public, private string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(public, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+
+	if w, err = armor.Encode(&buf, openpgp.PrivateKeyType, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key is encrypted after being serialized, since the keys of
+	// new entities are signed when they are serialized
+	if passphrase != "" {
+		keys, err := openpgp.ReadArmoredKeyRing(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = keys[0].EncryptPrivateKeys([]byte(passphrase), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		buf.Reset()
+
+		if w, err = armor.Encode(&buf, openpgp.PrivateKeyType, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err = keys[0].SerializePrivateWithoutSigning(w, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = os.WriteFile(private, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	entity, err := openpgp.NewEntity("registry admin", "", "admin@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := openpgp.NewEntity("someone else", "", "else@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	writeKey(t, entity, "", file("admin.pub"), file("admin.key"))
+	writeKey(t, entity, "key passphrase", file("admin.pub"), file("admin-locked.key"))
+	writeKey(t, other, "", file("else.pub"), file("else.key"))
+
+	for name, passphrase := range map[string]string{
+		"passphrase":       "bundle passphrase\n",
+		"wrong-passphrase": "not the bundle passphrase",
+		"key-passphrase":   "key passphrase",
+	} {
+		if err = os.WriteFile(file(name), []byte(passphrase), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	getter := bundleGetter{
+		"ghcr.io":         {"ci", "ghp_secret"},
+		"index.docker.io": {"hub-user", "hub:pass"},
+		"acr.example.com": {"<token>", "refresh-token"},
+		"cr.example.com":  {"00000000-0000-0000-0000-000000000000", "cr-refresh-token"},
+	}
+	usernames := bundleTokenUsernames{"cr.example.com": "00000000-0000-0000-0000-000000000000"}
+	registries := []string{"ghcr.io", "index.docker.io", "acr.example.com", "cr.example.com"}
+
+	cases := []struct {
+		name       string
+		registries []string
+		exportArgs []string
+		importArgs []string
+		expected   string
+		tamper     bool
+		exportErr  string
+		importErr  string
+	}{
+		{
+			name:       "recipient",
+			registries: registries,
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			importArgs: []string{"-identity", file("admin.key")},
+			expected: `{
+	"auths": {
+		"acr.example.com": {
+			"identitytoken": "refresh-token"
+		},
+		"cr.example.com": {
+			"identitytoken": "cr-refresh-token"
+		},
+		"ghcr.io": {
+			"auth": "Y2k6Z2hwX3NlY3JldA=="
+		},
+		"https://index.docker.io/v1/": {
+			"auth": "aHViLXVzZXI6aHViOnBhc3M="
+		}
+	}
+}
+`,
+		},
+		{
+			name:       "encrypted-identity",
+			registries: registries,
+			exportArgs: []string{"-recipient", file("else.pub"), "-recipient", file("admin.pub")},
+			importArgs: []string{
+				"-identity", file("admin-locked.key"), "-passphrase-file", file("key-passphrase"),
+				"-registry", "GHCR.io",
+			},
+			expected: `{
+	"auths": {
+		"ghcr.io": {
+			"auth": "Y2k6Z2hwX3NlY3JldA=="
+		}
+	}
+}
+`,
+		},
+		{
+			name:       "passphrase-podman",
+			exportArgs: []string{"-passphrase-file", file("passphrase"), "-registry", "docker.io"},
+			importArgs: []string{"-passphrase-file", file("passphrase"), "-runtime", "podman"},
+			expected: `{
+	"auths": {
+		"docker.io": {
+			"auth": "aHViLXVzZXI6aHViOnBhc3M="
+		}
+	}
+}
+`,
+		},
+		{
+			name:       "wrong-passphrase",
+			registries: registries,
+			exportArgs: []string{"-passphrase-file", file("passphrase")},
+			importArgs: []string{"-passphrase-file", file("wrong-passphrase")},
+			importErr:  "error decrypting ",
+		},
+		{
+			name:       "tampered",
+			registries: registries,
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			importArgs: []string{"-identity", file("admin.key")},
+			tamper:     true,
+			importErr:  "error decrypting ",
+		},
+		{
+			name:       "tampered-passphrase",
+			registries: registries,
+			exportArgs: []string{"-passphrase-file", file("passphrase")},
+			importArgs: []string{"-passphrase-file", file("passphrase")},
+			tamper:     true,
+			importErr:  "error decrypting ",
+		},
+		{
+			name:       "wrong-identity",
+			registries: registries,
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			importArgs: []string{"-identity", file("else.key")},
+			importErr:  "error decrypting ",
+		},
+		{
+			name:       "locked-identity",
+			registries: registries,
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			importArgs: []string{"-identity", file("admin-locked.key")},
+			importErr:  "error decrypting ",
+		},
+		{
+			name:       "not-in-bundle",
+			registries: []string{"ghcr.io"},
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			importArgs: []string{"-identity", file("admin.key"), "-registry", "quay.io"},
+			importErr:  "the bundle has no credentials of quay.io",
+		},
+		{
+			name:       "no-credentials",
+			registries: []string{"quay.io"},
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			exportErr:  "error reading the credentials of quay.io: credentials not found in native keychain",
+		},
+		{
+			name:       "no-registries",
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			exportErr: "the configuration uses one secret for every registry; " +
+				"name the registries to export the credentials of with -registry",
+		},
+		{
+			name:       "no-key",
+			registries: registries,
+			exportErr:  "exactly one of -recipient or -passphrase-file must be given",
+		},
+		{
+			name:       "no-decryption-key",
+			registries: registries,
+			exportArgs: []string{"-recipient", file("admin.pub")},
+			importErr:  "at least one of -identity or -passphrase-file must be given",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("DOCKER_CONFIG", filepath.Join(home, "docker"))
+			t.Setenv(envXDGConfigHome, home)
+			t.Setenv(envRegistryAuthFile, "")
+
+			bundleFile := filepath.Join(home, "credentials.asc")
+
+			var out bytes.Buffer
+
+			err := runExport(getter, tc.registries, usernames, append(tc.exportArgs, "-o", bundleFile), &out)
+			if tc.exportErr != "" {
+				if err == nil || err.Error() != tc.exportErr {
+					t.Fatalf("Expected error %q, got %v", tc.exportErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(bundleFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), "-----BEGIN PGP MESSAGE-----") || strings.Contains(string(data), "ghp_secret") {
+				t.Fatalf("Expected an armored encrypted bundle, got:\n%s", data)
+			}
+
+			if tc.tamper {
+				tamper(t, bundleFile)
+			}
+
+			err = runImport(append(tc.importArgs, bundleFile), &out)
+			if tc.importErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.importErr) {
+					t.Fatalf("Expected an error starting with %q, got %v", tc.importErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(home, "docker", "config.json")
+			if strings.Contains(strings.Join(tc.importArgs, " "), "podman") {
+				path = filepath.Join(home, "containers", "auth.json")
+			}
+
+			if data, err = os.ReadFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, string(data)); diff != "" {
+				t.Fatalf("Files differ:\n%s", diff)
+			}
+
+			if !strings.HasPrefix(out.String(), path+": imported the credentials of ") {
+				t.Fatalf("Unexpected output:\n%s", out.String())
+			}
+		})
+	}
+}
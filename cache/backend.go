@@ -0,0 +1,562 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/process"
+)
+
+// Names of the cache backends.
+const (
+	BackendFile     = "file"
+	BackendMemory   = "memory"
+	BackendKeyring  = "keyring"
+	BackendWincred  = "wincred"
+	BackendKeychain = "keychain"
+)
+
+const (
+	// fileCacheKeyFile is named after the TTLCache, which used it before
+	// the backends existed, so that its entries survive the upgrade.
+	fileCacheKeyFile = "secret-cache.key"
+	fileCacheKeySize = 32
+	fileCacheExt     = ".enc"
+
+	// fileCacheLockFile is locked while the files are read and written.
+	fileCacheLockFile    = "cache.lock"
+	fileCacheLockTimeout = 10 * time.Second
+
+	// keyringURL is the server URL, followed by the key, under which
+	// the data of a KeyringCache is stored in the keyring.
+	keyringURL      = "https://docker-credential-vault-login/"
+	keyringUsername = "docker-credential-vault-login"
+)
+
+// Cache stores the data of the caches of the helper, such as tokens and
+// credentials, by key.
+type Cache interface {
+	// Get returns the data stored under key, or nil if there is none.
+	Get(key string) ([]byte, error)
+
+	// Set stores data under key, replacing any data already stored.
+	Set(key string, data []byte) error
+
+	// Delete removes the data stored under key, if any.
+	Delete(key string) error
+}
+
+// Updater is implemented by the caches which can replace the data of a key
+// atomically, so that concurrent instances of the helper do not overwrite
+// each other's changes.
+type Updater interface {
+	// Update stores the data returned by fn, which is called with the data
+	// stored under key (or nil if there is none).
+	Update(key string, fn func(data []byte) ([]byte, error)) error
+}
+
+// update replaces the data stored under key with the data returned by fn,
+// atomically if the store is an Updater.
+func update(store Cache, key string, fn func(data []byte) ([]byte, error)) error {
+	if u, ok := store.(Updater); ok {
+		return u.Update(key, fn)
+	}
+
+	data, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if data, err = fn(data); err != nil {
+		return err
+	}
+
+	return store.Set(key, data)
+}
+
+// BackendOptions configures the cache backends.
+type BackendOptions struct {
+	// Dir is the directory in which the file backend stores its files.
+	Dir string
+
+	// KeyringHelper is the Docker credential helper used by the keyring
+	// backend. If it is empty, the one of the keyring of the operating
+	// system is used.
+	KeyringHelper string
+
+	// KeychainService and KeychainAccount name the items of the keychain
+	// backend (see NewKeychainCache).
+	KeychainService string
+	KeychainAccount string
+
+	// Logger logs the runs of the programs to which the keyring and
+	// keychain backends delegate.
+	Logger hclog.Logger
+}
+
+// NewBackend creates the cache backend with the given name. The wincred
+// backend is only supported on Windows and the keychain backend only on
+// macOS.
+func NewBackend(name string, opts BackendOptions) (Cache, error) {
+	switch name {
+	case BackendFile:
+		return NewFileCache(opts.Dir), nil
+	case BackendMemory:
+		return NewMemoryCache(), nil
+	case BackendKeyring:
+		return NewKeyringCache(opts.Logger, opts.KeyringHelper), nil
+	case BackendWincred:
+		if runtime.GOOS != "windows" {
+			return nil, xerrors.Errorf("the %s cache backend is only supported on Windows", BackendWincred)
+		}
+
+		return NewWincredCache(), nil
+	case BackendKeychain:
+		if runtime.GOOS != "darwin" {
+			return nil, xerrors.Errorf("the %s cache backend is only supported on macOS", BackendKeychain)
+		}
+
+		return NewKeychainCache(opts.Logger, opts.KeychainService, opts.KeychainAccount)
+	default:
+		return nil, xerrors.Errorf("unsupported cache backend %q: must be one of %s, %s, %s, %s or %s",
+			name, BackendFile, BackendMemory, BackendKeyring, BackendWincred, BackendKeychain)
+	}
+}
+
+// FileCache stores data in files in a directory, one per key, encrypted
+// with AES-GCM using a random key stored alongside them. The files are
+// locked while they are read and written.
+type FileCache struct {
+	dir  string
+	lock *FileLock
+	rand clock.Rand
+
+	mu   sync.Mutex
+	aead cipher.AEAD
+}
+
+// NewFileCache creates a FileCache storing its files in dir. The
+// encryption key is read from dir or, if there is none, created when the
+// cache is first used.
+func NewFileCache(dir string) *FileCache {
+	return &FileCache{
+		dir:  dir,
+		lock: NewFileLock(filepath.Join(dir, fileCacheLockFile)),
+		rand: clock.SystemRand(),
+	}
+}
+
+// SetRand replaces the source of the encryption key, when it is created,
+// and of the nonces.
+func (c *FileCache) SetRand(r clock.Rand) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rand = r
+}
+
+// Get decrypts the file of the key.
+func (c *FileCache) Get(key string) ([]byte, error) {
+	unlock, err := c.acquire(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return c.get(key)
+}
+
+// Set encrypts data into the file of the key.
+func (c *FileCache) Set(key string, data []byte) error {
+	unlock, err := c.acquire(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.set(key, data)
+}
+
+// Delete removes the file of the key.
+func (c *FileCache) Delete(key string) error {
+	unlock, err := c.acquire(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err = os.Remove(c.path(key)); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("error removing cache file: %w", err)
+	}
+
+	return nil
+}
+
+// Update replaces the file of the key while holding the lock exclusively.
+func (c *FileCache) Update(key string, fn func(data []byte) ([]byte, error)) error {
+	unlock, err := c.acquire(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := c.get(key)
+	if err != nil {
+		return err
+	}
+
+	if data, err = fn(data); err != nil {
+		return err
+	}
+
+	return c.set(key, data)
+}
+
+func (c *FileCache) acquire(exclusive bool) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fileCacheLockTimeout)
+	defer cancel()
+
+	var (
+		unlock func()
+		err    error
+	)
+
+	if exclusive {
+		unlock, err = c.lock.Lock(ctx)
+	} else {
+		unlock, err = c.lock.RLock(ctx)
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("error locking cache: %w", err)
+	}
+
+	return unlock, nil
+}
+
+func (c *FileCache) get(key string) ([]byte, error) {
+	data, err := os.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("error reading cache file: %w", err)
+	}
+
+	aead, err := c.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	size := aead.NonceSize()
+	if len(data) < size {
+		return nil, xerrors.New("error decrypting cache file: file is truncated")
+	}
+
+	plaintext, err := aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		// The key may have been replaced
+		return nil, xerrors.Errorf("error decrypting cache file: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func (c *FileCache) set(key string, data []byte) error {
+	aead, err := c.cipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(c.random(), nonce); err != nil {
+		return xerrors.Errorf("error generating nonce: %w", err)
+	}
+
+	if err = os.WriteFile(c.path(key), aead.Seal(nonce, nonce, data, nil), 0o600); err != nil {
+		return xerrors.Errorf("error writing cache file: %w", err)
+	}
+
+	return nil
+}
+
+// cipher returns the cipher of the files, reading or creating the
+// encryption key on first use.
+func (c *FileCache) cipher() (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.aead != nil {
+		return c.aead, nil
+	}
+
+	key, err := loadFileCacheKey(filepath.Join(c.dir, fileCacheKeyFile), c.rand)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating cipher: %w", err)
+	}
+
+	if c.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, xerrors.Errorf("error creating cipher: %w", err)
+	}
+
+	return c.aead, nil
+}
+
+func (c *FileCache) random() clock.Rand {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rand
+}
+
+func (c *FileCache) path(key string) string {
+	return filepath.Join(c.dir, filepath.Base(key)+fileCacheExt)
+}
+
+// loadFileCacheKey reads the encryption key at path or, if there is none,
+// creates one.
+func loadFileCacheKey(path string, random io.Reader) ([]byte, error) {
+	key, err := os.ReadFile(path) // nolint: gosec
+	if err == nil && len(key) == fileCacheKeySize {
+		return key, nil
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("error reading cache key: %w", err)
+	}
+
+	key = make([]byte, fileCacheKeySize)
+	if _, err = io.ReadFull(random, key); err != nil {
+		return nil, xerrors.Errorf("error generating cache key: %w", err)
+	}
+
+	if err = os.WriteFile(path, key, 0o600); err != nil {
+		return nil, xerrors.Errorf("error writing cache key: %w", err)
+	}
+
+	return key, nil
+}
+
+// MemoryCache stores data in memory only, so it is only useful to
+// long-running callers such as the watch daemon.
+type MemoryCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// NewMemoryCache creates an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{data: make(map[string][]byte)}
+}
+
+// Get returns a copy of the data of the key.
+func (c *MemoryCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	return out, nil
+}
+
+// Set stores a copy of data.
+func (c *MemoryCache) Set(key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data[key] = append([]byte(nil), data...)
+
+	return nil
+}
+
+// Delete removes the data of the key.
+func (c *MemoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.data, key)
+
+	return nil
+}
+
+// Update replaces the data of the key while holding the mutex.
+func (c *MemoryCache) Update(key string, fn func(data []byte) ([]byte, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var current []byte
+	if data, ok := c.data[key]; ok {
+		current = append([]byte(nil), data...)
+	}
+
+	data, err := fn(current)
+	if err != nil {
+		return err
+	}
+
+	c.data[key] = append([]byte(nil), data...)
+
+	return nil
+}
+
+// KeyringCache stores data in the keyring of the operating system (the
+// macOS Keychain, the Windows Credential Manager or a Secret Service such
+// as GNOME Keyring) through the Docker credential helper for it, so that
+// nothing is written to disk by the helper itself.
+type KeyringCache struct {
+	program client.ProgramFunc
+}
+
+// NewKeyringCache creates a KeyringCache which runs the Docker credential
+// helper named helper (e.g. "osxkeychain" for docker-credential-osxkeychain)
+// or, if it is empty, the one of the keyring of the operating system. The
+// runs of the credential helper are logged to the logger.
+func NewKeyringCache(logger hclog.Logger, helper string) *KeyringCache {
+	if helper == "" {
+		helper = DefaultKeyringHelper()
+	}
+
+	return &KeyringCache{program: keyringProgramFunc(logger, "docker-credential-"+helper)}
+}
+
+// keyringProgramFunc creates programs which run the credential helper at
+// path, so that its standard error, exit code and duration are logged
+// rather than printed to the standard error of the helper.
+func keyringProgramFunc(logger hclog.Logger, path string) client.ProgramFunc {
+	return func(args ...string) client.Program {
+		return &keyringProgram{cmd: process.Command{
+			Logger: logger,
+			Path:   path,
+			Args:   args,
+			ExpectedFailure: func(_ int, stdout []byte) bool {
+				return credentials.IsErrCredentialsNotFoundMessage(strings.TrimSpace(string(stdout)))
+			},
+		}}
+	}
+}
+
+// keyringProgram is a run of a Docker credential helper.
+type keyringProgram struct {
+	cmd   process.Command
+	input io.Reader
+}
+
+func (p *keyringProgram) Input(in io.Reader) {
+	p.input = in
+}
+
+func (p *keyringProgram) Output() ([]byte, error) {
+	if p.input != nil {
+		stdin, err := io.ReadAll(p.input)
+		if err != nil {
+			return nil, xerrors.Errorf("error reading input of %s: %w", p.cmd.Path, err)
+		}
+
+		p.cmd.Stdin = stdin
+	}
+
+	return p.cmd.Run(context.Background())
+}
+
+// DefaultKeyringHelper returns the name of the Docker credential helper
+// for the keyring of the operating system.
+func DefaultKeyringHelper() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "osxkeychain"
+	case "windows":
+		return "wincred"
+	default:
+		return "secretservice"
+	}
+}
+
+// Get reads the data of the key from the keyring.
+func (c *KeyringCache) Get(key string) ([]byte, error) {
+	creds, err := client.Get(c.program, keyringURL+key)
+	if credentials.IsErrCredentialsNotFound(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("error reading keyring: %w", err)
+	}
+
+	// Credential helpers only store strings
+	data, err := base64.StdEncoding.DecodeString(creds.Secret)
+	if err != nil {
+		return nil, xerrors.Errorf("error decoding keyring item: %w", err)
+	}
+
+	return data, nil
+}
+
+// Set writes the data of the key to the keyring.
+func (c *KeyringCache) Set(key string, data []byte) error {
+	err := client.Store(c.program, &credentials.Credentials{
+		ServerURL: keyringURL + key,
+		Username:  keyringUsername,
+		Secret:    base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return xerrors.Errorf("error writing keyring: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the data of the key from the keyring.
+func (c *KeyringCache) Delete(key string) error {
+	// Credential helpers disagree on whether erasing a missing item is
+	// an error
+	data, err := c.Get(key)
+	if err != nil || data == nil {
+		return err
+	}
+
+	if err = client.Erase(c.program, keyringURL+key); err != nil {
+		return xerrors.Errorf("error erasing keyring item: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,333 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// fakeKeyring implements the protocol of Docker credential helpers in
+// memory.
+type fakeKeyring struct {
+	items map[string]credentials.Credentials
+}
+
+type fakeKeyringCall struct {
+	keyring *fakeKeyring
+	action  string
+	input   []byte
+}
+
+func (k *fakeKeyring) program(args ...string) client.Program {
+	return &fakeKeyringCall{keyring: k, action: args[0]}
+}
+
+func (c *fakeKeyringCall) Input(in io.Reader) {
+	c.input, _ = io.ReadAll(in)
+}
+
+func (c *fakeKeyringCall) Output() ([]byte, error) {
+	switch c.action {
+	case credentials.ActionStore:
+		var creds credentials.Credentials
+		if err := json.Unmarshal(c.input, &creds); err != nil {
+			return []byte(err.Error()), err
+		}
+
+		c.keyring.items[creds.ServerURL] = creds
+
+		return nil, nil
+	case credentials.ActionGet:
+		creds, ok := c.keyring.items[string(c.input)]
+		if !ok {
+			return []byte(credentials.NewErrCredentialsNotFound().Error()), errors.New("exit status 1")
+		}
+
+		return json.Marshal(creds)
+	case credentials.ActionErase:
+		if _, ok := c.keyring.items[string(c.input)]; !ok {
+			return []byte("The specified item could not be found in the keychain."), errors.New("exit status 1")
+		}
+
+		delete(c.keyring.items, string(c.input))
+
+		return nil, nil
+	default:
+		return nil, errors.New("unsupported action " + c.action)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	keyring := &fakeKeyring{items: make(map[string]credentials.Credentials)}
+
+	backends := map[string]Cache{
+		BackendFile:     NewFileCache(t.TempDir()),
+		BackendMemory:   NewMemoryCache(),
+		BackendKeyring:  &KeyringCache{program: keyring.program},
+		BackendWincred:  &WincredCache{store: &fakeCredentials{blobs: make(map[string][]byte)}},
+		BackendKeychain: &KeychainCache{service: DefaultKeychainService, account: "test", run: newFakeKeychain().run},
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			data, err := backend.Get("vault-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data != nil {
+				t.Fatalf("Expected no data, got %q", data)
+			}
+
+			for _, value := range []string{"s.first", "s.second\x00\xff"} {
+				if err = backend.Set("vault-token", []byte(value)); err != nil {
+					t.Fatal(err)
+				}
+
+				if data, err = backend.Get("vault-token"); err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != value {
+					t.Fatalf("Expected %q, got %q", value, data)
+				}
+			}
+
+			for i := 0; i < 2; i++ {
+				if err = backend.Delete("vault-token"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if data, err = backend.Get("vault-token"); err != nil {
+				t.Fatal(err)
+			}
+			if data != nil {
+				t.Fatalf("Expected the data to be deleted, got %q", data)
+			}
+		})
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := NewFileCache(dir).Set("vault-token", []byte("s.token")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"vault-token" + fileCacheExt, fileCacheKeyFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			t.Fatalf("Expected file mode 0600 of %s, got %v", name, info.Mode().Perm())
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "vault-token"+fileCacheExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("s.token")) {
+		t.Fatal("expected the cache file to be encrypted")
+	}
+
+	t.Run("persisted", func(t *testing.T) {
+		data, err := NewFileCache(dir).Get("vault-token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "s.token" {
+			t.Fatalf("Expected %q, got %q", "s.token", data)
+		}
+	})
+
+	t.Run("other-key", func(t *testing.T) {
+		other := t.TempDir()
+		if err := os.WriteFile(filepath.Join(other, "vault-token"+fileCacheExt), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := NewFileCache(other).Get("vault-token")
+		if err == nil || !strings.HasPrefix(err.Error(), "error decrypting cache file") {
+			t.Fatalf("Expected a decryption error, got %v", err)
+		}
+	})
+
+	t.Run("seeded", func(t *testing.T) {
+		encrypt := func() []byte {
+			dir := t.TempDir()
+
+			c := NewFileCache(dir)
+			c.SetRand(clock.NewSeededRand(1))
+
+			if err := c.Set("vault-token", []byte("s.token")); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "vault-token"+fileCacheExt))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return data
+		}
+
+		if !bytes.Equal(encrypt(), encrypt()) {
+			t.Fatal("expected the same key and nonce for the same seed")
+		}
+	})
+
+	t.Run("no-key-until-used", func(t *testing.T) {
+		unused := t.TempDir()
+		if _, err := NewFileCache(unused).Get("vault-token"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(unused, fileCacheKeyFile)); !os.IsNotExist(err) {
+			t.Fatalf("Expected no key to be created, got %v", err)
+		}
+	})
+}
+
+func TestKeyringCache_Items(t *testing.T) {
+	keyring := &fakeKeyring{items: make(map[string]credentials.Credentials)}
+
+	if err := (&KeyringCache{program: keyring.program}).Set("vault-token", []byte("s.token")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]credentials.Credentials{
+		"https://docker-credential-vault-login/vault-token": {
+			ServerURL: "https://docker-credential-vault-login/vault-token",
+			Username:  "docker-credential-vault-login",
+			Secret:    "cy50b2tlbg==",
+		},
+	}
+
+	if diff := cmp.Diff(expected, keyring.items); diff != "" {
+		t.Fatalf("Keyring items differ:\n%s", diff)
+	}
+}
+
+func TestKeyringCache_Program(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper is a shell script")
+	}
+
+	helper := filepath.Join(t.TempDir(), "docker-credential-test")
+	script := `#!/bin/sh
+case "$1" in
+get) echo "credentials not found in native keychain"; exit 1 ;;
+store) cat >/dev/null; echo "the keyring is locked" >&2; exit 2 ;;
+esac
+`
+	if err := os.WriteFile(helper, []byte(script), 0o700); err != nil { // nolint: gosec
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	logger := hclog.New(&hclog.LoggerOptions{Output: buf, Level: hclog.Debug})
+	c := &KeyringCache{program: keyringProgramFunc(logger, helper)}
+
+	data, err := c.Get("vault-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != nil {
+		t.Fatalf("Expected no data, got %q", data)
+	}
+
+	if err = c.Set("vault-token", []byte("s.token")); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+
+	for _, s := range []string{
+		"[DEBUG] external program failed as expected",
+		`[ERROR] external program failed: path=` + helper + ` args=store exit_code=2`,
+		`stderr="the keyring is locked"`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("Expected log to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	wincredErr := ""
+	if runtime.GOOS != "windows" {
+		wincredErr = "the wincred cache backend is only supported on Windows"
+	}
+
+	keychainErr := ""
+	if runtime.GOOS != "darwin" {
+		keychainErr = "the keychain cache backend is only supported on macOS"
+	}
+
+	cases := []struct {
+		name string
+		err  string
+	}{
+		{name: BackendFile},
+		{name: BackendMemory},
+		{name: BackendKeyring},
+		{
+			name: BackendWincred,
+			err:  wincredErr,
+		},
+		{
+			name: BackendKeychain,
+			err:  keychainErr,
+		},
+		{
+			name: "vault",
+			err:  `unsupported cache backend "vault": must be one of file, memory, keyring, wincred or keychain`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend, err := NewBackend(tc.name, BackendOptions{Dir: t.TempDir()})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backend == nil {
+				t.Fatal("expected a backend")
+			}
+		})
+	}
+}
@@ -196,6 +196,21 @@ func readDHPrivateKey(config map[string]interface{}) ([]byte, error) {
 	return parseDHPrivateKeyFile(dhPrivKeyFile)
 }
 
+// UnwrapToken returns the token of a response-wrapped auth response, such
+// as the one output by the auth handler when the auth method has a
+// 'wrap_ttl'. The token of the client is left alone.
+func UnwrapToken(wrapped string, client *api.Client) (string, error) {
+	clone, err := client.Clone()
+	if err != nil {
+		return "", xerrors.Errorf("error cloning Vault client: %w", err)
+	}
+
+	// With no token of its own, the client unwraps with the wrapping token
+	clone.SetToken("")
+
+	return unwrapToken(wrapped, clone.Logical().Unwrap)
+}
+
 type unwrapFunc func(token string) (*api.Secret, error)
 
 func unwrapToken(token string, unwrap unwrapFunc) (string, error) {
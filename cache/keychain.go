@@ -0,0 +1,179 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/process"
+)
+
+const (
+	// DefaultKeychainService is the service of the Keychain items in which
+	// a KeychainCache stores its data unless another one is configured.
+	DefaultKeychainService = "docker-credential-vault-login"
+
+	// keychainNotFound is the exit status of security(1) if the item does
+	// not exist (errSecItemNotFound).
+	keychainNotFound = 44
+
+	securityPath = "/usr/bin/security"
+)
+
+// errKeychainItemNotFound is returned by the runner of a KeychainCache if
+// the item does not exist.
+var errKeychainItemNotFound = xerrors.New("the specified item could not be found in the keychain")
+
+// keychainRunner runs security(1) with the arguments, writing input to its
+// standard input, and returns its standard output.
+type keychainRunner func(input string, args ...string) ([]byte, error)
+
+// KeychainCache stores data in the login Keychain of macOS as generic
+// passwords, by running security(1) rather than a Docker credential
+// helper. Each key is stored in an item of the service, whose account is
+// the account followed by the key (e.g. "alice/vault-token"). The data is
+// written to security(1) through its standard input so that it never
+// appears in the arguments of a process.
+type KeychainCache struct {
+	service string
+	account string
+	logger  hclog.Logger
+	run     keychainRunner
+}
+
+// NewKeychainCache creates a KeychainCache storing its items under the
+// service and account or, if they are empty, DefaultKeychainService and
+// the name of the current user. The runs of security(1) are logged to the
+// logger. It is only functional on macOS.
+func NewKeychainCache(logger hclog.Logger, service, account string) (*KeychainCache, error) {
+	if service == "" {
+		service = DefaultKeychainService
+	}
+
+	if account == "" {
+		account = currentUsername()
+	}
+
+	for _, name := range []string{service, account} {
+		if strings.ContainsAny(name, "\"\\\n") {
+			return nil, xerrors.Errorf("the Keychain service and account must not contain quotes, "+
+				"backslashes or newlines: %q", name)
+		}
+	}
+
+	c := &KeychainCache{service: service, account: account, logger: logger}
+	c.run = c.runSecurity
+
+	return c, nil
+}
+
+// Get reads the data of the key from its item.
+func (c *KeychainCache) Get(key string) ([]byte, error) {
+	out, err := c.run("", "find-generic-password", "-s", c.service, "-a", c.itemAccount(key), "-w")
+	if errors.Is(err, errKeychainItemNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("error reading Keychain: %w", err)
+	}
+
+	// Generic passwords are printed as strings
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, xerrors.Errorf("error decoding Keychain item: %w", err)
+	}
+
+	return data, nil
+}
+
+// Set writes the data of the key to its item, replacing the item if it
+// exists.
+func (c *KeychainCache) Set(key string, data []byte) error {
+	command := fmt.Sprintf("add-generic-password -U -s %q -a %q -w %s\n",
+		c.service, c.itemAccount(key), base64.StdEncoding.EncodeToString(data))
+
+	if _, err := c.run(command, "-i"); err != nil {
+		return xerrors.Errorf("error writing Keychain: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the item of the key.
+func (c *KeychainCache) Delete(key string) error {
+	_, err := c.run("", "delete-generic-password", "-s", c.service, "-a", c.itemAccount(key))
+	if err != nil && !errors.Is(err, errKeychainItemNotFound) {
+		return xerrors.Errorf("error erasing Keychain item: %w", err)
+	}
+
+	return nil
+}
+
+func (c *KeychainCache) itemAccount(key string) string {
+	return c.account + "/" + key
+}
+
+// runSecurity runs security(1).
+func (c *KeychainCache) runSecurity(input string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	cmd := &process.Command{
+		Logger: c.logger,
+		Path:   securityPath,
+		Args:   args,
+		Stdin:  []byte(input),
+		Stderr: &stderr,
+		ExpectedFailure: func(exitCode int, _ []byte) bool {
+			return exitCode == keychainNotFound
+		},
+	}
+
+	stdout, err := cmd.Run(context.Background())
+
+	var perr *process.Error
+	if errors.As(err, &perr) && perr.ExitCode == keychainNotFound {
+		return nil, errKeychainItemNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// In interactive mode, failed commands are only reported on stderr
+	if len(args) > 0 && args[0] == "-i" && stderr.Len() > 0 {
+		return nil, xerrors.New(strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout, nil
+}
+
+// currentUsername returns the name of the user running the helper.
+func currentUsername() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
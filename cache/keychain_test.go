@@ -0,0 +1,128 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeKeychain implements the commands of security(1) used by a
+// KeychainCache in memory.
+type fakeKeychain struct {
+	items map[string]string
+}
+
+func newFakeKeychain() *fakeKeychain {
+	return &fakeKeychain{items: make(map[string]string)}
+}
+
+func (k *fakeKeychain) run(input string, args ...string) ([]byte, error) {
+	if args[0] == "-i" {
+		// add-generic-password -U -s "service" -a "account" -w password
+		fields := strings.Fields(strings.TrimSpace(input))
+		if len(fields) != 8 || fields[0] != "add-generic-password" {
+			return nil, errors.New("unexpected command " + input)
+		}
+
+		k.items[strings.Trim(fields[3], `"`)+"|"+strings.Trim(fields[5], `"`)] = fields[7]
+
+		return nil, nil
+	}
+
+	item := args[2] + "|" + args[4]
+
+	password, ok := k.items[item]
+	if !ok {
+		return nil, errKeychainItemNotFound
+	}
+
+	switch args[0] {
+	case "find-generic-password":
+		return []byte(password + "\n"), nil
+	case "delete-generic-password":
+		delete(k.items, item)
+		return nil, nil
+	default:
+		return nil, errors.New("unsupported command " + args[0])
+	}
+}
+
+func TestKeychainCache_Items(t *testing.T) {
+	keychain := newFakeKeychain()
+
+	c, err := NewKeychainCache(nil, "", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.run = keychain.run
+
+	if err = c.Set("vault-token", []byte("s.token")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"docker-credential-vault-login|alice/vault-token": "cy50b2tlbg=="}
+	if diff := cmp.Diff(expected, keychain.items); diff != "" {
+		t.Fatalf("Keychain items differ:\n%s", diff)
+	}
+}
+
+func TestNewKeychainCache(t *testing.T) {
+	cases := []struct {
+		name    string
+		service string
+		account string
+		err     string
+	}{
+		{
+			name:    "configured",
+			service: "dcvl",
+			account: "ci",
+		},
+		{
+			name:    "quote",
+			service: `dcvl"`,
+			err:     `the Keychain service and account must not contain quotes, backslashes or newlines: "dcvl\""`,
+		},
+		{
+			name:    "newline",
+			account: "ci\n",
+			err:     `the Keychain service and account must not contain quotes, backslashes or newlines: "ci\n"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewKeychainCache(nil, tc.service, tc.account)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.service != tc.service || c.account != tc.account {
+				t.Fatalf("Expected service %q and account %q, got %q and %q", tc.service, tc.account, c.service, c.account)
+			}
+		})
+	}
+}
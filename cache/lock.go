@@ -0,0 +1,84 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// lockRetryInterval is how often a lock held by another process is tried
+// again.
+const lockRetryInterval = 20 * time.Millisecond
+
+// FileLock is an advisory lock on a file. Docker may run several instances
+// of the helper at once (e.g. when Compose pulls several images), so the
+// files they share are locked while they are read and written.
+type FileLock struct {
+	path string
+}
+
+// NewFileLock creates a FileLock on the file at path, which is created when
+// the lock is first acquired. The file is never removed.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Lock acquires the lock exclusively, waiting until ctx is done for other
+// holders to release it. It returns the function which releases the lock.
+func (l *FileLock) Lock(ctx context.Context) (func(), error) {
+	return l.acquire(ctx, true)
+}
+
+// RLock acquires the lock shared with other readers, waiting until ctx is
+// done for an exclusive holder to release it. It returns the function
+// which releases the lock.
+func (l *FileLock) RLock(ctx context.Context) (func(), error) {
+	return l.acquire(ctx, false)
+}
+
+func (l *FileLock) acquire(ctx context.Context, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, xerrors.Errorf("error opening lock file: %w", err)
+	}
+
+	ticker := time.NewTicker(lockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := tryLockFile(file, exclusive)
+		if err != nil {
+			file.Close() // nolint: errcheck, gosec
+			return nil, xerrors.Errorf("error locking %s: %w", l.path, err)
+		}
+
+		if ok {
+			return func() {
+				unlockFile(file) // nolint: errcheck, gosec
+				file.Close()     // nolint: errcheck, gosec
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close() // nolint: errcheck, gosec
+			return nil, xerrors.Errorf("timed out waiting for lock on %s: %w", l.path, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
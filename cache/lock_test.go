@@ -0,0 +1,117 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	timeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		t.Cleanup(cancel)
+
+		return ctx
+	}
+
+	unlock, err := NewFileLock(path).Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewFileLock(path).Lock(timeout()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the exclusive lock to be held, got %v", err)
+	}
+	if _, err = NewFileLock(path).RLock(timeout()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the exclusive lock to exclude readers, got %v", err)
+	}
+
+	unlock()
+
+	unlockReader, err := NewFileLock(path).RLock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlockOther, err := NewFileLock(path).RLock(timeout())
+	if err != nil {
+		t.Fatalf("Expected readers to share the lock, got %v", err)
+	}
+	unlockOther()
+
+	if _, err = NewFileLock(path).Lock(timeout()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected readers to exclude writers, got %v", err)
+	}
+
+	unlockReader()
+
+	unlock, err = NewFileLock(path).Lock(timeout())
+	if err != nil {
+		t.Fatalf("Expected the lock to be released, got %v", err)
+	}
+	unlock()
+}
+
+// TestSecretCache_Concurrent checks that caches which share a directory,
+// like concurrent instances of the helper, keep each other's entries.
+func TestSecretCache_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	logger := hclog.NewNullLogger()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		// Both caches are loaded before either stores anything
+		secrets := NewSecretCache(logger, NewFileCache(dir))
+		ttls := NewTTLCache(logger, NewFileCache(dir), time.Hour)
+
+		path := filepath.Join("secret", "docker", string(rune('a'+i)))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := secrets.Store(&SecretEntry{
+				LeaseID: path + "/lease",
+				Path:    path,
+				Expires: time.Now().Add(time.Hour),
+			})
+			if err != nil {
+				t.Error(err)
+			}
+
+			if err = ttls.Store(path, "test@user.com", "secure password", 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := NewSecretCache(logger, NewFileCache(dir)).Len(); n != 10 {
+		t.Fatalf("Expected 10 secret cache entries, got %d", n)
+	}
+	if n := NewTTLCache(logger, NewFileCache(dir), time.Hour).Len(); n != 10 {
+		t.Fatalf("Expected 10 TTL cache entries, got %d", n)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// secretCacheKey is the key under which the entries of a SecretCache are
+// stored.
+const secretCacheKey = "secrets"
+
+// SecretEntry is a set of Docker credentials read from a leased secret
+// (e.g. one generated by a dynamic secrets engine).
+type SecretEntry struct {
+	LeaseID   string    `json:"lease_id"`
+	Path      string    `json:"path"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	Renewable bool      `json:"renewable"`
+	Expires   time.Time `json:"expires"`
+
+	// NotAfter, if set, is when the credentials themselves expire (e.g.
+	// an ECR authorization token), however long the lease is renewed.
+	NotAfter time.Time `json:"not_after,omitempty"`
+}
+
+// SecretCache stores Docker credentials read from leased secrets, keyed by
+// lease ID, so that a new lease need not be created for every invocation
+// of the helper. The entries are persisted to a cache backend.
+type SecretCache struct {
+	logger hclog.Logger
+	store  Cache
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]*SecretEntry
+}
+
+// NewSecretCache creates a SecretCache persisted to store. Any entries
+// already stored are loaded.
+func NewSecretCache(logger hclog.Logger, store Cache) *SecretCache {
+	c := &SecretCache{
+		logger:  logger,
+		store:   store,
+		clock:   clock.System(),
+		entries: make(map[string]*SecretEntry),
+	}
+
+	data, err := store.Get(secretCacheKey)
+	if err != nil {
+		logger.Error("error reading secret cache", "error", err)
+		return c
+	}
+
+	if data == nil {
+		return c
+	}
+
+	var entries []*SecretEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		logger.Error("error JSON-decoding secret cache", "error", err)
+		return c
+	}
+
+	for _, entry := range entries {
+		c.entries[entry.LeaseID] = entry
+	}
+
+	return c
+}
+
+// SetClock replaces the clock by which the expiration of the entries is
+// checked.
+func (c *SecretCache) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clk
+}
+
+// Lookup returns the entry read from the secret at path, if there is one
+// whose lease has not yet expired.
+func (c *SecretCache) Lookup(path string) (*SecretEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entry := range c.entries {
+		if entry.Path == path && c.clock.Now().Before(entry.Expires) {
+			e := *entry
+			return &e, true
+		}
+	}
+
+	return nil, false
+}
+
+// Store adds an entry to the cache, replacing any other entry read from the
+// same secret.
+func (c *SecretCache) Store(entry *SecretEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := *entry
+
+	return c.update(func(entries map[string]*SecretEntry) {
+		for id, other := range entries {
+			if other.Path == e.Path {
+				delete(entries, id)
+			}
+		}
+
+		entries[e.LeaseID] = &e
+	})
+}
+
+// Extend sets the expiration of the entry of a lease to ttl from now, but
+// no later than its NotAfter. It should be called whenever the lease is
+// renewed.
+func (c *SecretCache) Extend(leaseID string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[leaseID]; !ok {
+		return nil
+	}
+
+	return c.update(func(entries map[string]*SecretEntry) {
+		entry, ok := entries[leaseID]
+		if !ok {
+			return
+		}
+
+		entry.Expires = c.clock.Now().Add(ttl)
+		if !entry.NotAfter.IsZero() && entry.NotAfter.Before(entry.Expires) {
+			entry.Expires = entry.NotAfter
+		}
+	})
+}
+
+// Invalidate removes the entry of a lease from the cache. It should be
+// called as soon as the lease is known to have been revoked.
+func (c *SecretCache) Invalidate(leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[leaseID]; !ok {
+		return nil
+	}
+
+	return c.update(func(entries map[string]*SecretEntry) {
+		delete(entries, leaseID)
+	})
+}
+
+// Purge removes every entry from the cache.
+func (c *SecretCache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.update(func(entries map[string]*SecretEntry) {
+		for id := range entries {
+			delete(entries, id)
+		}
+	})
+}
+
+// Len returns the number of entries in the cache whose lease has not yet
+// expired.
+func (c *SecretCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+
+	for _, entry := range c.entries {
+		if c.clock.Now().Before(entry.Expires) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Paths returns the sorted paths of the secrets whose entries have not yet
+// expired.
+func (c *SecretCache) Paths() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var paths []string
+
+	for _, entry := range c.entries {
+		if c.clock.Now().Before(entry.Expires) {
+			paths = append(paths, entry.Path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// update applies mutate to the entries in the store, rather than to those
+// loaded, so that the changes of other instances of the helper since they
+// were loaded are kept. The result replaces the entries loaded.
+func (c *SecretCache) update(mutate func(entries map[string]*SecretEntry)) error {
+	err := update(c.store, secretCacheKey, func(data []byte) ([]byte, error) {
+		entries := make(map[string]*SecretEntry)
+
+		if data != nil {
+			var stored []*SecretEntry
+			if err := json.Unmarshal(data, &stored); err != nil {
+				c.logger.Error("error JSON-decoding secret cache; replacing it", "error", err)
+			}
+
+			for _, entry := range stored {
+				entries[entry.LeaseID] = entry
+			}
+		}
+
+		mutate(entries)
+
+		list := make([]*SecretEntry, 0, len(entries))
+
+		for id, entry := range entries {
+			// Drop expired entries so the cache doesn't grow forever
+			if c.clock.Now().After(entry.Expires) {
+				delete(entries, id)
+				continue
+			}
+
+			list = append(list, entry)
+		}
+
+		data, err := json.Marshal(list)
+		if err != nil {
+			return nil, xerrors.Errorf("error JSON-encoding secret cache: %w", err)
+		}
+
+		c.entries = entries
+
+		return data, nil
+	})
+	if err != nil {
+		return xerrors.Errorf("error writing secret cache: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestSecretCache(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileCache(dir)
+	path := filepath.Join(dir, secretCacheKey+fileCacheExt)
+	logger := hclog.NewNullLogger()
+
+	entry := &SecretEntry{
+		LeaseID:   "registry/creds/ci/lease-1",
+		Path:      "registry/creds/ci",
+		Username:  "test@user.com",
+		Password:  "secure password",
+		Renewable: true,
+		Expires:   time.Now().Add(time.Hour).Round(0),
+	}
+
+	c := NewSecretCache(logger, store)
+
+	if _, ok := c.Lookup(entry.Path); ok {
+		t.Fatal("expected an empty cache")
+	}
+
+	if err := c.Store(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("persisted", func(t *testing.T) {
+		got, ok := NewSecretCache(logger, store).Lookup(entry.Path)
+		if !ok {
+			t.Fatal("expected the entry to be cached")
+		}
+		if !cmp.Equal(entry, got) {
+			t.Fatalf("Entries differ:\n%v", cmp.Diff(entry, got))
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			t.Fatalf("Expected file mode 0600, got %v", info.Mode().Perm())
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secure password")) {
+			t.Fatal("expected the cache file to be encrypted")
+		}
+	})
+
+	t.Run("store-replaces-previous-lease", func(t *testing.T) {
+		replacement := *entry
+		replacement.LeaseID = "registry/creds/ci/lease-2"
+
+		if err := c.Store(&replacement); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := c.Lookup(entry.Path)
+		if got.LeaseID != replacement.LeaseID {
+			t.Fatalf("Expected lease %q, got %q", replacement.LeaseID, got.LeaseID)
+		}
+		if len(c.entries) != 1 {
+			t.Fatalf("Expected 1 entry, got %d", len(c.entries))
+		}
+
+		entry = &replacement
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		if err := c.Extend(entry.LeaseID, -time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.Lookup(entry.Path); ok {
+			t.Fatal("expected an expired entry not to be returned")
+		}
+
+		if len(c.entries) != 0 {
+			t.Fatalf("Expected expired entries to be dropped, got %d entries", len(c.entries))
+		}
+
+		if err := c.Store(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Extend(entry.LeaseID, 2*time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := c.Lookup(entry.Path)
+		if !ok {
+			t.Fatal("expected the entry to be cached")
+		}
+		if !got.Expires.After(entry.Expires) {
+			t.Fatalf("Expected the entry to expire after %v, got %v", entry.Expires, got.Expires)
+		}
+	})
+
+	t.Run("not-after", func(t *testing.T) {
+		notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		e := *entry
+		e.NotAfter = notAfter
+		if err := c.Store(&e); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Extend(e.LeaseID, 2*time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := c.Lookup(e.Path)
+		if !ok {
+			t.Fatal("expected the entry to be cached")
+		}
+		if !got.Expires.Equal(notAfter) {
+			t.Fatalf("Expected the entry to expire at %v, got %v", notAfter, got.Expires)
+		}
+
+		if err := c.Store(entry); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		if err := c.Invalidate(entry.LeaseID); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.Lookup(entry.Path); ok {
+			t.Fatal("expected the entry to be invalidated")
+		}
+		if _, ok := NewSecretCache(logger, store).Lookup(entry.Path); ok {
+			t.Fatal("expected the invalidation to be persisted")
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		if err := c.Store(entry); err != nil {
+			t.Fatal(err)
+		}
+		if n := c.Len(); n != 1 {
+			t.Fatalf("Expected 1 entry, got %d", n)
+		}
+		if diff := cmp.Diff([]string{entry.Path}, c.Paths()); diff != "" {
+			t.Fatalf("Paths differ:\n%s", diff)
+		}
+		if err := c.Purge(); err != nil {
+			t.Fatal(err)
+		}
+		if n := c.Len(); n != 0 {
+			t.Fatalf("Expected no entries, got %d", n)
+		}
+		if n := NewSecretCache(logger, store).Len(); n != 0 {
+			t.Fatalf("Expected the purge to be persisted, got %d entries", n)
+		}
+	})
+
+	t.Run("malformed-file", func(t *testing.T) {
+		malformed := NewMemoryCache()
+		if err := malformed.Set(secretCacheKey, []byte("{")); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := bytes.Buffer{}
+		NewSecretCache(hclog.New(&hclog.LoggerOptions{Output: &buf}), malformed)
+
+		if !strings.Contains(buf.String(), "error JSON-decoding secret cache") {
+			t.Fatalf("Expected an error to be logged, got:\n%s", buf.String())
+		}
+	})
+}
+
+// TestSecretCache_Renewals simulates a day of renewals of a lease whose
+// credentials expire after 12 hours.
+func TestSecretCache_Renewals(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	c := NewSecretCache(hclog.NewNullLogger(), NewMemoryCache())
+	c.SetClock(clk)
+
+	err := c.Store(&SecretEntry{
+		LeaseID:  "registry/creds/ci/lease-1",
+		Path:     "registry/creds/ci",
+		Expires:  start.Add(time.Hour),
+		NotAfter: start.Add(12 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last time.Time
+
+	for clk.Now().Before(start.Add(24 * time.Hour)) {
+		clk.Advance(30 * time.Minute)
+
+		entry, ok := c.Lookup("registry/creds/ci")
+		if !ok {
+			break
+		}
+
+		last = clk.Now()
+
+		if err = c.Extend(entry.LeaseID, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The entry expires with its credentials, not with its last renewal
+	if expected := start.Add(11*time.Hour + 30*time.Minute); !last.Equal(expected) {
+		t.Fatalf("Expected the entry to be served last at %v, got %v", expected, last)
+	}
+}
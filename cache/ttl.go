@@ -0,0 +1,246 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// The keys under which the entries of a TTLCache are stored.
+const (
+	ttlCacheKey      = "secret-cache"
+	staleCacheKey    = "stale-credentials"
+	coalesceCacheKey = "coalesced-secrets"
+)
+
+// ttlEntry is a set of Docker credentials cached by a TTLCache.
+type ttlEntry struct {
+	Path     string    `json:"path"`
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Expires  time.Time `json:"expires"`
+}
+
+// TTLCache stores the Docker credentials read from every secret, keyed by
+// path, for a short time so that consecutive invocations of the helper
+// need not read the same secret from Vault. Unlike SecretCache, it does not
+// check whether the credentials are still valid. The entries are persisted
+// to a cache backend.
+type TTLCache struct {
+	logger hclog.Logger
+	store  Cache
+	key    string
+	ttl    time.Duration
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]*ttlEntry
+}
+
+// NewTTLCache creates a TTLCache persisted to store whose entries expire
+// after ttl. Any entries already stored which can be read are loaded.
+func NewTTLCache(logger hclog.Logger, store Cache, ttl time.Duration) *TTLCache {
+	return newTTLCache(logger, store, ttlCacheKey, ttl)
+}
+
+// NewStaleCache creates a TTLCache of the last-known-good credentials read
+// from every secret, whose entries expire after maxStale. It is stored
+// apart from the cache created by NewTTLCache.
+func NewStaleCache(logger hclog.Logger, store Cache, maxStale time.Duration) *TTLCache {
+	return newTTLCache(logger, store, staleCacheKey, maxStale)
+}
+
+// NewCoalesceCache creates a TTLCache by which concurrent instances of the
+// helper share the credentials read from every secret for window, so that
+// only one of them reads each secret from Vault. It is stored apart from
+// the other caches.
+func NewCoalesceCache(logger hclog.Logger, store Cache, window time.Duration) *TTLCache {
+	return newTTLCache(logger, store, coalesceCacheKey, window)
+}
+
+func newTTLCache(logger hclog.Logger, store Cache, key string, ttl time.Duration) *TTLCache {
+	c := &TTLCache{
+		logger:  logger,
+		store:   store,
+		key:     key,
+		ttl:     ttl,
+		clock:   clock.System(),
+		entries: make(map[string]*ttlEntry),
+	}
+
+	c.load()
+
+	return c
+}
+
+// SetClock replaces the clock by which the entries expire.
+func (c *TTLCache) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clk
+}
+
+// Lookup returns the credentials read from the secret at path, if they
+// were cached less than the TTL ago.
+func (c *TTLCache) Lookup(path string) (string, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || !c.clock.Now().Before(entry.Expires) {
+		return "", "", false
+	}
+
+	return entry.Username, entry.Password, true
+}
+
+// Store caches the credentials read from the secret at path for the TTL.
+// If the secret has a lease, leaseDuration should be its duration so that
+// the credentials are not cached for longer than they are valid.
+func (c *TTLCache) Store(path, username, password string, leaseDuration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl := c.ttl
+	if leaseDuration > 0 && leaseDuration < ttl {
+		ttl = leaseDuration
+	}
+
+	entry := &ttlEntry{
+		Path:     path,
+		Username: username,
+		Password: password,
+		Expires:  c.clock.Now().Add(ttl),
+	}
+
+	return c.update(func(entries map[string]*ttlEntry) {
+		entries[path] = entry
+	})
+}
+
+// Reload replaces the entries loaded with those in the store, so that the
+// entries stored by other instances of the helper since they were loaded
+// can be looked up.
+func (c *TTLCache) Reload() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+}
+
+// Purge removes every entry from the cache.
+func (c *TTLCache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.update(func(entries map[string]*ttlEntry) {
+		for path := range entries {
+			delete(entries, path)
+		}
+	})
+}
+
+// Len returns the number of entries in the cache which have not yet
+// expired.
+func (c *TTLCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+
+	for _, entry := range c.entries {
+		if c.clock.Now().Before(entry.Expires) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (c *TTLCache) load() {
+	data, err := c.store.Get(c.key)
+	if err != nil {
+		c.logger.Error("error reading secret cache", "error", err)
+		return
+	}
+
+	c.entries = c.decode(data)
+}
+
+// decode returns the entries encoded in data. Data which cannot be decoded
+// is logged and treated as no entries.
+func (c *TTLCache) decode(data []byte) map[string]*ttlEntry {
+	entries := make(map[string]*ttlEntry)
+
+	if data == nil {
+		return entries
+	}
+
+	var stored []*ttlEntry
+	if err := json.Unmarshal(data, &stored); err != nil {
+		c.logger.Error("error JSON-decoding secret cache", "error", err)
+		return entries
+	}
+
+	for _, entry := range stored {
+		entries[entry.Path] = entry
+	}
+
+	return entries
+}
+
+// update applies mutate to the entries in the store, rather than to those
+// loaded, so that the changes of other instances of the helper since they
+// were loaded are kept. The result replaces the entries loaded.
+func (c *TTLCache) update(mutate func(entries map[string]*ttlEntry)) error {
+	err := update(c.store, c.key, func(data []byte) ([]byte, error) {
+		entries := c.decode(data)
+
+		mutate(entries)
+
+		list := make([]*ttlEntry, 0, len(entries))
+
+		for path, entry := range entries {
+			// Drop expired entries so the cache doesn't grow forever
+			if !c.clock.Now().Before(entry.Expires) {
+				delete(entries, path)
+				continue
+			}
+
+			list = append(list, entry)
+		}
+
+		data, err := json.Marshal(list)
+		if err != nil {
+			return nil, xerrors.Errorf("error JSON-encoding secret cache: %w", err)
+		}
+
+		c.entries = entries
+
+		return data, nil
+	})
+	if err != nil {
+		return xerrors.Errorf("error writing secret cache: %w", err)
+	}
+
+	return nil
+}
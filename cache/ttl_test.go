@@ -0,0 +1,208 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestTTLCache(t *testing.T) {
+	dir := t.TempDir()
+	logger := hclog.NewNullLogger()
+
+	c := NewTTLCache(logger, NewFileCache(dir), time.Hour)
+
+	if _, _, ok := c.Lookup("secret/docker/creds"); ok {
+		t.Fatal("expected an empty cache")
+	}
+
+	if err := c.Store("secret/docker/creds", "test@user.com", "secure password", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("persisted", func(t *testing.T) {
+		c := NewTTLCache(logger, NewFileCache(dir), time.Hour)
+
+		username, password, ok := c.Lookup("secret/docker/creds")
+		if !ok {
+			t.Fatal("expected the entry to be cached")
+		}
+		if username != "test@user.com" || password != "secure password" {
+			t.Fatalf("Expected credentials %q/%q, got %q/%q", "test@user.com", "secure password",
+				username, password)
+		}
+
+		for _, name := range []string{ttlCacheKey + fileCacheExt, fileCacheKeyFile} {
+			info, err := os.Stat(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+				t.Fatalf("Expected file mode 0600 of %s, got %v", name, info.Mode().Perm())
+			}
+		}
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join(dir, ttlCacheKey+fileCacheExt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secure password")) {
+			t.Fatal("expected the cache file to be encrypted")
+		}
+	})
+
+	t.Run("new-key", func(t *testing.T) {
+		other := t.TempDir()
+		data, err := os.ReadFile(filepath.Join(dir, ttlCacheKey+fileCacheExt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(other, ttlCacheKey+fileCacheExt), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		c := NewTTLCache(logger, NewFileCache(other), time.Hour)
+		if c.Len() != 0 {
+			t.Fatal("expected entries encrypted with another key to be ignored")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+
+		c := NewTTLCache(logger, NewFileCache(t.TempDir()), time.Hour)
+		c.SetClock(clk)
+
+		if err := c.Store("secret/docker/creds", "test@user.com", "secure password", 0); err != nil {
+			t.Fatal(err)
+		}
+
+		clk.Advance(59 * time.Minute)
+
+		if _, _, ok := c.Lookup("secret/docker/creds"); !ok {
+			t.Fatal("expected the entry to be cached for the TTL")
+		}
+
+		clk.Advance(time.Minute)
+
+		if _, _, ok := c.Lookup("secret/docker/creds"); ok {
+			t.Fatal("expected the entry to have expired")
+		}
+		if c.Len() != 0 {
+			t.Fatalf("Expected 0 entries, got %d", c.Len())
+		}
+	})
+
+	t.Run("lease", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+
+		c := NewTTLCache(logger, NewFileCache(t.TempDir()), time.Hour)
+		c.SetClock(clk)
+
+		if err := c.Store("database/creds/registry", "test@user.com", "secure password", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		clk.Advance(time.Minute)
+
+		if _, _, ok := c.Lookup("database/creds/registry"); ok {
+			t.Fatal("expected the entry to expire with its lease")
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		if err := c.Purge(); err != nil {
+			t.Fatal(err)
+		}
+
+		c := NewTTLCache(logger, NewFileCache(dir), time.Hour)
+		if c.Len() != 0 {
+			t.Fatalf("Expected 0 entries, got %d", c.Len())
+		}
+	})
+}
+
+func TestNewStaleCache(t *testing.T) {
+	logger := hclog.NewNullLogger()
+	store := NewMemoryCache()
+	clk := clock.NewFake(time.Now())
+
+	stale := NewStaleCache(logger, store, 6*time.Hour)
+	stale.SetClock(clk)
+
+	if err := stale.Store("secret/docker/creds", "test@user.com", "secure password", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stale cache is stored apart from the TTL cache
+	if _, _, ok := NewTTLCache(logger, store, time.Hour).Lookup("secret/docker/creds"); ok {
+		t.Fatal("expected the TTL cache to be empty")
+	}
+
+	if _, _, ok := NewStaleCache(logger, store, 6*time.Hour).Lookup("secret/docker/creds"); !ok {
+		t.Fatal("expected the credentials to be persisted")
+	}
+
+	clk.Advance(5 * time.Hour)
+	if _, _, ok := stale.Lookup("secret/docker/creds"); !ok {
+		t.Fatal("expected the credentials within the staleness window")
+	}
+
+	clk.Advance(time.Hour)
+	if _, _, ok := stale.Lookup("secret/docker/creds"); ok {
+		t.Fatal("expected the credentials to expire after the staleness window")
+	}
+}
+
+func TestNewCoalesceCache(t *testing.T) {
+	logger := hclog.NewNullLogger()
+	store := NewMemoryCache()
+
+	first := NewCoalesceCache(logger, store, 5*time.Second)
+	second := NewCoalesceCache(logger, store, 5*time.Second)
+
+	if err := first.Store("secret/docker/creds", "test@user.com", "secure password", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The coalesce cache is stored apart from the TTL cache
+	if _, _, ok := NewTTLCache(logger, store, time.Hour).Lookup("secret/docker/creds"); ok {
+		t.Fatal("expected the TTL cache to be empty")
+	}
+
+	if _, _, ok := second.Lookup("secret/docker/creds"); ok {
+		t.Fatal("expected the entries stored since loading not to be looked up before reloading")
+	}
+
+	second.Reload()
+
+	username, password, ok := second.Lookup("secret/docker/creds")
+	if !ok {
+		t.Fatal("expected the entries stored by the other cache after reloading")
+	}
+	if username != "test@user.com" || password != "secure password" {
+		t.Fatalf("Expected the stored credentials, got %q and %q", username, password)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// wincredTarget is the prefix of the target names of the credentials
+	// in which a WincredCache stores its data.
+	wincredTarget = "docker-credential-vault-login:"
+
+	// wincredBlobSize is the size of the largest blob a credential of the
+	// Windows Credential Manager holds (CRED_MAX_CREDENTIAL_BLOB_SIZE).
+	wincredBlobSize = 5 * 512
+)
+
+// credentialStore stores blobs under target names, like the Windows
+// Credential Manager.
+type credentialStore interface {
+	// read returns the blob of the target, or nil if there is none.
+	read(target string) ([]byte, error)
+
+	// write stores the blob under the target, replacing any blob stored.
+	write(target string, blob []byte) error
+
+	// remove removes the blob of the target and reports whether there was
+	// one.
+	remove(target string) (bool, error)
+}
+
+// WincredCache stores data in the Windows Credential Manager, as generic
+// credentials of the user, without relying on a Docker credential helper.
+// Since a credential holds at most 2.5 KiB, data is split into as many
+// credentials as needed: the first is named after the key and the
+// following ones after the key and their index (e.g. "key#1").
+type WincredCache struct {
+	store credentialStore
+}
+
+// NewWincredCache creates a WincredCache. It is only functional on
+// Windows.
+func NewWincredCache() *WincredCache {
+	return &WincredCache{store: systemCredentials{}}
+}
+
+// Get reads the credentials of the key and joins their blobs.
+func (c *WincredCache) Get(key string) ([]byte, error) {
+	var data []byte
+
+	for i := 0; ; i++ {
+		blob, err := c.store.read(wincredChunk(key, i))
+		if err != nil {
+			return nil, xerrors.Errorf("error reading Windows Credential Manager: %w", err)
+		}
+
+		if blob == nil {
+			return data, nil
+		}
+
+		if data == nil {
+			data = []byte{}
+		}
+
+		data = append(data, blob...)
+	}
+}
+
+// Set splits data into the credentials of the key and removes those left
+// over from longer data stored before.
+func (c *WincredCache) Set(key string, data []byte) error {
+	i := 0
+
+	for ; i == 0 || len(data) > 0; i++ {
+		n := len(data)
+		if n > wincredBlobSize {
+			n = wincredBlobSize
+		}
+
+		// The blob of the first credential is never nil, so that empty
+		// data is told apart from none
+		blob := append([]byte{}, data[:n]...)
+
+		if err := c.store.write(wincredChunk(key, i), blob); err != nil {
+			return xerrors.Errorf("error writing Windows Credential Manager: %w", err)
+		}
+
+		data = data[n:]
+	}
+
+	return c.remove(key, i)
+}
+
+// Delete removes the credentials of the key.
+func (c *WincredCache) Delete(key string) error {
+	return c.remove(key, 0)
+}
+
+// remove removes the credentials of the key from the one with index from
+// onwards.
+func (c *WincredCache) remove(key string, from int) error {
+	for i := from; ; i++ {
+		found, err := c.store.remove(wincredChunk(key, i))
+		if err != nil {
+			return xerrors.Errorf("error erasing Windows Credential Manager item: %w", err)
+		}
+
+		if !found {
+			return nil
+		}
+	}
+}
+
+// wincredChunk returns the target name of the credential with index i of
+// the key.
+func wincredChunk(key string, i int) string {
+	if i == 0 {
+		return wincredTarget + key
+	}
+
+	return wincredTarget + key + "#" + strconv.Itoa(i)
+}
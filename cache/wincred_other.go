@@ -0,0 +1,38 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !windows
+
+package cache
+
+import "golang.org/x/xerrors"
+
+// errWincredUnsupported is returned by the Credential Manager on other
+// platforms than Windows.
+var errWincredUnsupported = xerrors.New("the Windows Credential Manager is only available on Windows")
+
+// systemCredentials is the Credential Manager of the user, which does not
+// exist on this platform.
+type systemCredentials struct{}
+
+func (systemCredentials) read(string) ([]byte, error) {
+	return nil, errWincredUnsupported
+}
+
+func (systemCredentials) write(string, []byte) error {
+	return errWincredUnsupported
+}
+
+func (systemCredentials) remove(string) (bool, error) {
+	return false, errWincredUnsupported
+}
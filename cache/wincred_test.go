@@ -0,0 +1,110 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeCredentials implements the Credential Manager in memory.
+type fakeCredentials struct {
+	blobs map[string][]byte
+}
+
+func (f *fakeCredentials) read(target string) ([]byte, error) {
+	return f.blobs[target], nil
+}
+
+func (f *fakeCredentials) write(target string, blob []byte) error {
+	if len(blob) > wincredBlobSize {
+		panic("blob too large")
+	}
+
+	f.blobs[target] = blob
+
+	return nil
+}
+
+func (f *fakeCredentials) remove(target string) (bool, error) {
+	_, ok := f.blobs[target]
+	delete(f.blobs, target)
+
+	return ok, nil
+}
+
+func (f *fakeCredentials) targets() []string {
+	targets := make([]string, 0, len(f.blobs))
+	for target := range f.blobs {
+		targets = append(targets, target)
+	}
+
+	sort.Strings(targets)
+
+	return targets
+}
+
+func TestWincredCache_Chunks(t *testing.T) {
+	store := &fakeCredentials{blobs: make(map[string][]byte)}
+	c := &WincredCache{store: store}
+
+	cases := []struct {
+		name    string
+		data    []byte
+		targets []string
+	}{
+		{
+			name: "long",
+			data: bytes.Repeat([]byte("a"), 2*wincredBlobSize+1),
+			targets: []string{
+				"docker-credential-vault-login:secret-cache",
+				"docker-credential-vault-login:secret-cache#1",
+				"docker-credential-vault-login:secret-cache#2",
+			},
+		},
+		{
+			name:    "shorter",
+			data:    []byte("short"),
+			targets: []string{"docker-credential-vault-login:secret-cache"},
+		},
+		{
+			name:    "empty",
+			data:    []byte{},
+			targets: []string{"docker-credential-vault-login:secret-cache"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := c.Set("secret-cache", tc.data); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.targets, store.targets()); diff != "" {
+				t.Fatalf("Targets differ:\n%s", diff)
+			}
+
+			data, err := c.Get("secret-cache")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data == nil || !bytes.Equal(data, tc.data) {
+				t.Fatalf("Expected %d bytes, got %d", len(tc.data), len(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clock provides the time and the randomness used by the helper
+// behind interfaces, so that tests can replace them with a fake clock and
+// a seeded source of randomness and reproduce timing-dependent behavior
+// exactly.
+package clock
+
+import (
+	cryptorand "crypto/rand"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for it to pass.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel on which the time is sent once d has
+	// passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Rand is a source of randomness.
+type Rand interface {
+	// Int63n returns a random number in [0, n). It is used for jitter
+	// and need not be cryptographically secure.
+	Int63n(n int64) int64
+
+	// Read fills p with random bytes. It is used for keys and nonces, so
+	// the bytes of System are cryptographically secure.
+	Read(p []byte) (int, error)
+}
+
+// System returns the clock of the system.
+func System() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemRand returns the randomness of the system: jitter comes from
+// math/rand and bytes from crypto/rand.
+func SystemRand() Rand {
+	return systemRand{}
+}
+
+type systemRand struct{}
+
+func (systemRand) Int63n(n int64) int64 {
+	return rand.Int63n(n) // nolint: gosec
+}
+
+func (systemRand) Read(p []byte) (int, error) {
+	return cryptorand.Read(p)
+}
+
+// NewSeededRand returns a Rand which produces the same sequence for the
+// same seed. It is not secure and is meant for tests only.
+func NewSeededRand(seed int64) Rand {
+	return &seededRand{rand: rand.New(rand.NewSource(seed))} // nolint: gosec
+}
+
+type seededRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *seededRand) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rand.Int63n(n)
+}
+
+func (r *seededRand) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rand.Read(p)
+}
+
+// Fake is a Clock whose time only moves when it is advanced, so that tests
+// can simulate hours in milliseconds.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []waiter
+}
+
+// waiter is a channel returned by After which has not yet fired.
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFake creates a Fake whose time is now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+
+	return f
+}
+
+// Now returns the time of the fake.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// After returns a channel on which the time is sent once the fake has been
+// advanced by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+
+	f.waiters = append(f.waiters, waiter{at: f.now.Add(d), ch: ch})
+	f.cond.Broadcast()
+
+	return ch
+}
+
+// Advance moves the time of the fake forward by d, firing the channels
+// returned by After whose time has come in the order of their times.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+
+	sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+
+	pending := f.waiters[:0]
+
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+
+		w.ch <- w.at
+	}
+
+	f.waiters = pending
+}
+
+// BlockUntil blocks until n channels returned by After are waiting to fire,
+// so that a test can advance the fake once the code under test waits for
+// it.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
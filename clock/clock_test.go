@@ -0,0 +1,73 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	hour := f.After(time.Hour)
+	minute := f.After(time.Minute)
+
+	select {
+	case <-f.After(0):
+	default:
+		t.Fatal("expected After(0) to fire immediately")
+	}
+
+	f.BlockUntil(2)
+
+	f.Advance(59 * time.Second)
+
+	select {
+	case <-minute:
+		t.Fatal("expected the minute not to have passed")
+	default:
+	}
+
+	f.Advance(time.Hour)
+
+	if got := <-minute; !got.Equal(start.Add(time.Minute)) {
+		t.Fatalf("Expected %v, got %v", start.Add(time.Minute), got)
+	}
+	if got := <-hour; !got.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Expected %v, got %v", start.Add(time.Hour), got)
+	}
+
+	if expected := start.Add(time.Hour + 59*time.Second); !f.Now().Equal(expected) {
+		t.Fatalf("Expected %v, got %v", expected, f.Now())
+	}
+}
+
+func TestNewSeededRand(t *testing.T) {
+	sequence := func(r Rand) []int64 {
+		b := make([]byte, 8)
+		if _, err := r.Read(b); err != nil {
+			t.Fatal(err)
+		}
+
+		return []int64{r.Int63n(1000), r.Int63n(1000), int64(b[0])}
+	}
+
+	if diff := cmp.Diff(sequence(NewSeededRand(1)), sequence(NewSeededRand(1))); diff != "" {
+		t.Fatalf("Expected the same sequence for the same seed:\n%s", diff)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Command docker-credential-vault-login-shim is a credential helper which
+// forwards every request of Docker to the daemon started by
+// "docker-credential-vault-login serve" over a unix socket, so that Docker
+// gets credentials without waiting for a new process to log in to Vault.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/morningconsult/docker-credential-vault-login/socket"
+)
+
+const (
+	// timeout bounds how long a request may take, including a login of
+	// the daemon to Vault.
+	timeout = 2 * time.Minute
+
+	usage = "Usage: docker-credential-vault-login-shim <store|get|erase|list|version>"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout))
+}
+
+// run forwards the action to the daemon and returns the exit status. As
+// with every credential helper, errors are written to out.
+func run(args []string, in io.Reader, out io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(out, usage) // nolint: errcheck
+		return 1
+	}
+
+	socketPath := os.Getenv(socket.EnvSocket)
+	if socketPath == "" {
+		var err error
+
+		if socketPath, err = homedir.Expand(defaultSocketPath); err != nil {
+			fmt.Fprintln(out, err) // nolint: errcheck
+			return 1
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := socket.Call(ctx, socketPath, args[0], in, out); err != nil {
+		fmt.Fprintln(out, err) // nolint: errcheck
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/socket"
+)
+
+type mockHelper struct{}
+
+func (mockHelper) Add(*credentials.Credentials) error { return nil }
+
+func (mockHelper) Delete(string) error { return nil }
+
+func (mockHelper) Get(serverURL string) (string, string, error) {
+	if serverURL != "registry.example.com" {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+
+	return "ci", "secret", nil
+}
+
+func (mockHelper) List() (map[string]string, error) { return nil, nil }
+
+func TestRun(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), socket.SocketFile)
+	t.Setenv(socket.EnvSocket, socketPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := socket.NewServer(socket.ServerOptions{Helper: mockHelper{}, SocketPath: socketPath})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+
+	select {
+	case <-srv.Ready():
+	case err := <-done:
+		t.Fatalf("server did not start: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		args     []string
+		input    string
+		status   int
+		expected string
+	}{
+		{
+			name:     "get",
+			args:     []string{credentials.ActionGet},
+			input:    "registry.example.com",
+			expected: `{"ServerURL":"registry.example.com","Username":"ci","Secret":"secret"}` + "\n",
+		},
+		{
+			name:     "not-found",
+			args:     []string{credentials.ActionGet},
+			input:    "other.example.com",
+			status:   1,
+			expected: credentials.NewErrCredentialsNotFound().Error() + "\n",
+		},
+		{
+			name:     "usage",
+			status:   1,
+			expected: usage + "\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			if status := run(tc.args, strings.NewReader(tc.input), &out); status != tc.status {
+				t.Fatalf("Expected exit status %d, got %d", tc.status, status)
+			}
+			if diff := cmp.Diff(tc.expected, out.String()); diff != "" {
+				t.Fatalf("Outputs differ:\n%s", diff)
+			}
+		})
+	}
+}
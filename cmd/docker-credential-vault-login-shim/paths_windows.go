@@ -0,0 +1,34 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/morningconsult/docker-credential-vault-login/socket"
+)
+
+// defaultSocketPath is the socket of the daemon if neither the daemon nor
+// the shim is configured otherwise. Like the cache directory of the
+// daemon, it is in %APPDATA%.
+var defaultSocketPath = socketPath()
+
+func socketPath() string {
+	if dir := os.Getenv("APPDATA"); dir != "" {
+		return filepath.Join(dir, "docker-credential-vault-login", socket.SocketFile)
+	}
+
+	return `~\AppData\Roaming\docker-credential-vault-login\` + socket.SocketFile
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+// LoadVaultAddresses parses the 'addresses' field of the 'vault' block of
+// the configuration file. It lists the addresses of the nodes of a highly
+// available Vault cluster, which are tried in order until a healthy one is
+// found. Each entry is either an address or an object with the 'address'
+// of the node and the 'ca_cert' and 'pin_sha256' TLS settings which only
+// apply to that node. The Vault agent ignores this field.
+func LoadVaultAddresses(configFile string) ([]vault.Node, error) {
+	data, err := os.ReadFile(configFile) // nolint: gosec
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseVaultAddresses(data)
+}
+
+// ParseVaultAddresses parses the 'addresses' field of the 'vault' block of
+// the contents of a configuration file, as LoadVaultAddresses does.
+func ParseVaultAddresses(data []byte) ([]vault.Node, error) {
+	obj, err := hcl.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, errors.New("error parsing configuration file: file doesn't contain a root object")
+	}
+
+	var nodes []vault.Node
+
+	for _, item := range root.Filter("vault").Items {
+		var v struct {
+			Addresses []interface{} `hcl:"addresses"`
+		}
+
+		if err = hcl.DecodeObject(&v, item.Val); err != nil {
+			return nil, fmt.Errorf("error parsing 'vault.addresses': %w", err)
+		}
+
+		for i, raw := range v.Addresses {
+			node, err := parseNode(raw)
+			if err != nil {
+				return nil, fmt.Errorf("'vault.addresses' is invalid: address %d %w", i+1, err)
+			}
+
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// parseNode parses an entry of 'vault.addresses'. Errors complete the
+// sentence "address N ...".
+func parseNode(raw interface{}) (vault.Node, error) {
+	var node vault.Node
+
+	switch v := raw.(type) {
+	case string:
+		node.Address = v
+	case []map[string]interface{}:
+		if len(v) != 1 {
+			return node, errors.New("must be a string or an object")
+		}
+
+		return parseNodeObject(v[0])
+	case map[string]interface{}:
+		return parseNodeObject(v)
+	default:
+		return node, errors.New("must be a string or an object")
+	}
+
+	if node.Address = strings.TrimSpace(node.Address); node.Address == "" {
+		return node, errors.New("is empty")
+	}
+
+	return node, nil
+}
+
+func parseNodeObject(obj map[string]interface{}) (vault.Node, error) {
+	var node vault.Node
+
+	for key, raw := range obj {
+		switch key {
+		case "address", "ca_cert":
+			s, ok := raw.(string)
+			if !ok {
+				return node, fmt.Errorf("has a non-string '%s'", key)
+			}
+
+			if key == "address" {
+				node.Address = strings.TrimSpace(s)
+			} else {
+				node.CACert = s
+			}
+		case "pin_sha256":
+			pins, ok := raw.([]interface{})
+			if !ok {
+				return node, errors.New("has a 'pin_sha256' which is not a list")
+			}
+
+			for _, rawPin := range pins {
+				pin, _ := rawPin.(string)
+
+				hash, err := base64.StdEncoding.DecodeString(pin)
+				if err != nil || len(hash) != sha256.Size {
+					return node, fmt.Errorf("has an invalid 'pin_sha256' %q: it must be a base64-encoded "+
+						"SHA-256 hash", pin)
+				}
+
+				node.PinSHA256 = append(node.PinSHA256, pin)
+			}
+		default:
+			return node, fmt.Errorf("has an unknown field '%s'", key)
+		}
+	}
+
+	if node.Address == "" {
+		return node, errors.New("has no 'address'")
+	}
+
+	if node.CACert != "" {
+		path, err := homedir.Expand(node.CACert)
+		if err != nil {
+			return node, fmt.Errorf("has an invalid 'ca_cert': %w", err)
+		}
+
+		node.CACert = path
+	}
+
+	return node, nil
+}
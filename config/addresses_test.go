@@ -0,0 +1,93 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+func TestLoadVaultAddresses(t *testing.T) {
+	cases := []struct {
+		name      string
+		file      string
+		err       string
+		addresses []vault.Node
+	}{
+		{
+			name: "file-doesnt-exist",
+			file: "testdata/nonexistent.hcl",
+			err:  "open testdata/nonexistent.hcl: no such file or directory",
+		},
+		{
+			name: "no-addresses",
+			file: "testdata/valid.hcl",
+		},
+		{
+			name: "empty-address",
+			file: "testdata/addresses-empty.hcl",
+			err:  "'vault.addresses' is invalid: address 2 is empty",
+		},
+		{
+			name: "addresses",
+			file: "testdata/addresses.hcl",
+			addresses: []vault.Node{
+				{Address: "https://vault-1.example.com:8200"},
+				{Address: "https://vault-2.example.com:8200"},
+			},
+		},
+		{
+			name: "node-tls",
+			file: "testdata/addresses-tls.hcl",
+			addresses: []vault.Node{
+				{Address: "https://vault-1.example.com:8200"},
+				{
+					Address:   "https://vault-dr.example.com:8200",
+					CACert:    "/etc/ssl/vault-dr-ca.pem",
+					PinSHA256: []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+				},
+			},
+		},
+		{
+			name: "bad-pin",
+			file: "testdata/addresses-bad-pin.hcl",
+			err: `'vault.addresses' is invalid: address 2 has an invalid 'pin_sha256' "not-a-hash": ` +
+				"it must be a base64-encoded SHA-256 hash",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			addresses, err := LoadVaultAddresses(tc.file)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.addresses, addresses) {
+				t.Fatalf("Addresses differ:\n%v", cmp.Diff(tc.addresses, addresses))
+			}
+		})
+	}
+}
@@ -14,14 +14,19 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 
 	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/vault"
 )
 
 const noSinkHCLTemplate string = `
@@ -48,95 +53,331 @@ const errNoSinkMsg = "auto_auth requires at least one sink or at least one templ
 type SecretsTable struct {
 	oneSecret        string
 	registryToSecret map[string]string
+
+	// keys names the fields of every secret which hold the credentials,
+	// unless registryToKeys names others for the registry.
+	keys           fieldKeys
+	registryToKeys map[string]fieldKeys
+}
+
+// fieldKeys names the fields of a secret which hold the Docker username
+// and password, or the identity token, or gives the templates which
+// extract them from the secret. Empty names are left to the defaults.
+type fieldKeys struct {
+	username      string
+	password      string
+	identityToken string
+
+	// identityTokenUsername is the username returned with the identity
+	// token, if it is not "<token>". It may be empty.
+	identityTokenUsername *string
+
+	usernameTemplate string
+	passwordTemplate string
+
+	// usernamePath is the path of another secret from which the username
+	// is read, if it is not kept with the password.
+	usernamePath string
 }
 
 // GetPath returns the path to the Vault secret where your Docker
-// credentials are kept for the registry.
+// credentials are kept for the registry. Paths which are templates are
+// rendered for the registry.
 func (s SecretsTable) GetPath(registry string) (string, error) {
 	if s.oneSecret != "" {
-		return s.oneSecret, nil
-	}
+		if !isPathTemplate(s.oneSecret) {
+			return s.oneSecret, nil
+		}
 
-	registry = strings.ToLower(registry)
+		host, err := NormalizeRegistry(registry)
+		if err != nil {
+			return "", err
+		}
 
-	// Add scheme if one is not present so url.Parse works as expected
-	if !strings.HasPrefix(registry, "http://") && !strings.HasPrefix(registry, "https://") {
-		registry = "http://" + registry
+		return renderPath(s.oneSecret, host)
 	}
 
-	u, err := url.Parse(registry)
+	registry, err := NormalizeRegistry(registry)
 	if err != nil {
 		return "", err
 	}
 
-	registry = u.Hostname()
-	if u.Port() != "" {
-		registry = registry + ":" + u.Port()
-	}
-
 	secret, ok := s.registryToSecret[registry]
 	if !ok {
 		return "", errors.New("registry \"" + registry + "\" not found in configuration")
 	}
 
+	if isPathTemplate(secret) {
+		return renderPath(secret, registry)
+	}
+
 	return secret, nil
 }
 
-// LoadConfig will parse the configuration file and return a
-// configuration struct.
-func LoadConfig(configFile string) (*vaultconfig.Config, error) { // nolint: gocyclo
-	// Try to parse config file once
-	config, err := vaultconfig.LoadConfig(configFile)
+// isPathTemplate reports whether the path of a secret is a template.
+func isPathTemplate(path string) bool {
+	return strings.Contains(path, "{{")
+}
+
+// renderPath renders the template of the path of a secret for the
+// registry.
+func renderPath(text, registry string) (string, error) {
+	tmpl, err := vault.ParsePathTemplate("secret", text)
 	if err != nil {
-		// No sinks in configuration file - do a workaround to allow no sinks
-		if err.Error() != errNoSinkMsg {
-			return nil, err
+		return "", fmt.Errorf("error parsing secret path template: %w", err)
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, vault.PathTemplateData{Registry: registry}); err != nil {
+		return "", fmt.Errorf("error rendering secret path template: %w", err)
+	}
+
+	// An unset environment variable leaves an empty segment, which must
+	// not silently name another secret
+	path := b.String()
+	if path == "" || strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") || strings.Contains(path, "//") {
+		return "", fmt.Errorf("secret path template %q rendered the path %q with an empty segment for "+
+			"registry %q", text, path, registry)
+	}
+
+	return path, nil
+}
+
+// Paths returns the sorted paths of every secret in the table, including
+// the secrets from which usernames are read, without duplicates. Paths
+// which are templates are left out, as they depend on the registry.
+func (s SecretsTable) Paths() []string {
+	seen := make(map[string]bool, len(s.registryToSecret))
+	paths := make([]string, 0, len(s.registryToSecret))
+
+	add := func(path string) {
+		if path != "" && !isPathTemplate(path) && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
 		}
+	}
 
-		var data []byte
+	add(s.oneSecret)
+	add(s.keys.usernamePath)
 
-		data, err = os.ReadFile(configFile) // nolint: gosec
-		if err != nil {
-			return nil, err
+	for _, path := range s.registryToSecret {
+		add(path)
+	}
+
+	for _, keys := range s.registryToKeys {
+		add(keys.usernamePath)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// Registries returns the sorted registries which have a secret of their
+// own. It is empty if one secret is used for every registry.
+func (s SecretsTable) Registries() []string {
+	registries := make([]string, 0, len(s.registryToSecret))
+
+	for registry := range s.registryToSecret {
+		registries = append(registries, registry)
+	}
+
+	sort.Strings(registries)
+
+	return registries
+}
+
+// FieldKeys returns the names of the fields of the secret of the registry
+// which hold the Docker username and password, as set in the
+// 'username_key' and 'password_key' fields of the secret of the registry
+// or of 'auto_auth.method.config'. The names which are not set are empty.
+func (s SecretsTable) FieldKeys(registry string) (usernameKey, passwordKey string) {
+	keys := s.keys
+
+	if registry, err := NormalizeRegistry(registry); err == nil {
+		if override, ok := s.registryToKeys[registry]; ok {
+			if override.username != "" {
+				keys.username = override.username
+			}
+
+			if override.password != "" {
+				keys.password = override.password
+			}
 		}
+	}
 
-		// Add `cache` and `listener` stanzas so that vaultconfig.LoadConfig
-		// will not return a validation error. With the Vault agent, if Auto Auth
-		// is used without caching, then there MUST be at least one sink. If
-		// caching is used in conjunction with Auto Auth, then sinks are optional.
-		// Therefore, this function will create a copy of the configuration file,
-		// add a `cache` stanza and a `listener` stanza, write it to a temporary
-		// file, and pass this temporary file to vaultconfig.LoadConfig. This
-		// will bypass the sink requirement and thus allow no sinks to be used.
-		hcl := fmt.Sprintf(noSinkHCLTemplate, string(data))
+	return keys.username, keys.password
+}
+
+// IdentityTokenKey returns the name of the field of the secret of the
+// registry which holds an identity token, as set in the
+// 'identity_token_key' field of the secret of the registry or of
+// 'auto_auth.method.config'. It is empty if the secret holds a username
+// and password instead.
+func (s SecretsTable) IdentityTokenKey(registry string) string {
+	if registry, err := NormalizeRegistry(registry); err == nil {
+		if override, ok := s.registryToKeys[registry]; ok && override.identityToken != "" {
+			return override.identityToken
+		}
+	}
 
-		// Write modified configuration file string to temporary file
-		configFileBase := filepath.Base(configFile)
+	return s.keys.identityToken
+}
 
-		var tempFile *os.File
+// IdentityTokenUsername returns the username which is returned with the
+// identity token of the registry instead of "<token>", as set in the
+// 'identity_token_username' field of the secret of the registry or of
+// 'auto_auth.method.config'. It reports false if it is not set.
+func (s SecretsTable) IdentityTokenUsername(registry string) (string, bool) {
+	username := s.keys.identityTokenUsername
 
-		tempFile, err = os.CreateTemp("", configFileBase+".*")
-		if err != nil {
-			return nil, err
+	if registry, err := NormalizeRegistry(registry); err == nil {
+		if override, ok := s.registryToKeys[registry]; ok && override.identityTokenUsername != nil {
+			username = override.identityTokenUsername
 		}
+	}
 
-		defer os.Remove(tempFile.Name()) //nolint:errcheck
+	if username == nil {
+		return "", false
+	}
 
-		if _, err = tempFile.Write([]byte(hcl)); err != nil {
-			return nil, err
+	return *username, true
+}
+
+// UsernamePath returns the path of the secret from which the Docker
+// username of the registry is read, as set in the 'username_path' field of
+// the secret of the registry or of 'auto_auth.method.config'. It is empty
+// if the username is read from the same secret as the password.
+func (s SecretsTable) UsernamePath(registry string) string {
+	if registry, err := NormalizeRegistry(registry); err == nil {
+		if override, ok := s.registryToKeys[registry]; ok && override.usernamePath != "" {
+			return override.usernamePath
 		}
+	}
 
-		if err = tempFile.Close(); err != nil {
-			return nil, err
+	return s.keys.usernamePath
+}
+
+// Templates returns the Go templates which extract the Docker username
+// and password from the secret of the registry, as set in the
+// 'username_template' and 'password_template' fields of the secret of the
+// registry or of 'auto_auth.method.config'. The templates which are not
+// set are empty.
+func (s SecretsTable) Templates(registry string) (usernameTemplate, passwordTemplate string) {
+	keys := s.keys
+
+	if registry, err := NormalizeRegistry(registry); err == nil {
+		if override, ok := s.registryToKeys[registry]; ok {
+			if override.usernameTemplate != "" {
+				keys.usernameTemplate = override.usernameTemplate
+			}
+
+			if override.passwordTemplate != "" {
+				keys.passwordTemplate = override.passwordTemplate
+			}
 		}
+	}
 
-		// Reload configuration with temporary file
-		config, err = vaultconfig.LoadConfig(tempFile.Name())
-		if err != nil {
+	return keys.usernameTemplate, keys.passwordTemplate
+}
+
+// DockerHubRegistry is the registry of Docker Hub as returned by
+// NormalizeRegistry, whichever of its hosts it is given.
+const DockerHubRegistry = "index.docker.io"
+
+// NormalizeRegistry returns the lowercased host and port of the registry,
+// which may be a URL with a scheme and a path, as given by the Docker CLI
+// (e.g. "https://index.docker.io/v1/"), or a bare host with an optional
+// port, as given by Podman and nerdctl (e.g. "docker.io" or
+// "localhost:5000"). The hosts of Docker Hub are all normalized to
+// DockerHubRegistry.
+func NormalizeRegistry(registry string) (string, error) {
+	registry = strings.ToLower(strings.TrimSpace(registry))
+
+	// Add scheme if one is not present so url.Parse works as expected
+	if !strings.HasPrefix(registry, "http://") && !strings.HasPrefix(registry, "https://") {
+		registry = "http://" + registry
+	}
+
+	u, err := url.Parse(registry)
+	if err != nil {
+		return "", err
+	}
+
+	// A fully qualified host may end with a dot
+	host := strings.TrimSuffix(u.Hostname(), ".")
+
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		host = DockerHubRegistry
+	}
+
+	// JoinHostPort brackets IPv6 addresses
+	if u.Port() != "" {
+		return net.JoinHostPort(host, u.Port()), nil
+	}
+
+	return host, nil
+}
+
+// LoadConfig will parse the configuration file and return a
+// configuration struct.
+func LoadConfig(configFile string) (*vaultconfig.Config, error) {
+	// Try to parse config file once
+	config, err := vaultconfig.LoadConfig(configFile)
+	if err != nil && err.Error() == errNoSinkMsg {
+		var data []byte
+
+		if data, err = os.ReadFile(configFile); err != nil { // nolint: gosec
 			return nil, err
 		}
+
+		config, err = parseWithNoSinks(data)
 	}
 
+	if err != nil {
+		return nil, err
+	}
+
+	return checkConfig(config)
+}
+
+// ParseConfig parses the contents of a configuration file, such as the
+// configuration of a profile, and returns a configuration struct.
+func ParseConfig(data []byte) (*vaultconfig.Config, error) {
+	config, err := parseVaultConfig(data)
+	if err != nil && err.Error() == errNoSinkMsg {
+		config, err = parseWithNoSinks(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkConfig(config)
+}
+
+// parseWithNoSinks parses a configuration which has no sinks.
+func parseWithNoSinks(data []byte) (*vaultconfig.Config, error) {
+	// Add `cache` and `listener` stanzas so that vaultconfig.LoadConfig
+	// will not return a validation error. With the Vault agent, if Auto Auth
+	// is used without caching, then there MUST be at least one sink. If
+	// caching is used in conjunction with Auto Auth, then sinks are optional.
+	// Therefore, this function will add a `cache` stanza and a `listener`
+	// stanza to a copy of the configuration and parse the copy instead.
+	// This will bypass the sink requirement and thus allow no sinks to be
+	// used.
+	data, err := withNoSinkStanzas(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseVaultConfig(data)
+}
+
+// checkConfig applies the environment overrides to the configuration and
+// validates it.
+func checkConfig(config *vaultconfig.Config) (*vaultconfig.Config, error) {
 	if config == nil {
 		return nil, errors.New("no configuration found")
 	}
@@ -145,16 +386,71 @@ func LoadConfig(configFile string) (*vaultconfig.Config, error) { // nolint: goc
 		return nil, errors.New("no 'auto_auth' block found in configuration file")
 	}
 
-	if err = validateSinks(config.AutoAuth.Sinks); err != nil {
+	if err := applyEnvOverrides(config.AutoAuth.Method); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateMountPath(config.AutoAuth.Method.MountPath); err != nil {
+		return nil, fmt.Errorf("invalid 'auto_auth.method.mount_path': %w", err)
+	}
+
+	if err := validateSinks(config.AutoAuth.Sinks); err != nil {
 		return nil, err
 	}
 
 	return config, nil
 }
 
+// parseVaultConfigFile parses data with the configuration parser of the
+// Vault agent, which only reads files, from a temporary file which only
+// the current user can read and which is removed once it is parsed.
+func parseVaultConfigFile(data []byte) (*vaultconfig.Config, error) {
+	tempFile, err := os.CreateTemp("", "docker-credential-vault-login-*.hcl")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tempFile.Name()) //nolint:errcheck
+
+	if _, err = tempFile.Write(data); err != nil {
+		tempFile.Close() // nolint: errcheck, gosec
+		return nil, err
+	}
+
+	if err = tempFile.Close(); err != nil {
+		return nil, err
+	}
+
+	return vaultconfig.LoadConfig(tempFile.Name())
+}
+
+// withNoSinkStanzas adds the `cache` and `listener` stanzas which allow
+// auto_auth to have no sinks to the configuration file, which may be
+// either HCL or JSON.
+func withNoSinkStanzas(data []byte) ([]byte, error) {
+	// The HCL parser reads the file as JSON if it starts with an object
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		return []byte(fmt.Sprintf(noSinkHCLTemplate, string(data))), nil
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("error parsing configuration file as JSON: %w", err)
+	}
+
+	obj["cache"] = map[string]interface{}{"use_auto_auth_token": true}
+	obj["listener"] = []interface{}{
+		map[string]interface{}{"type": "tcp", "address": "127.0.0.1:8100", "tls_disable": true},
+	}
+
+	return json.Marshal(obj)
+}
+
 // BuildSecretsTable parses the auto_auth.method.secrets.config stanza
 // of the configuration file. The value of this field may be either a
-// string or a map[string]string.
+// string or a map whose values are either paths or objects with a 'path'
+// and optionally 'username_key', 'password_key' and 'identity_token_key'.
+// The same fields of the config apply to every secret.
 func BuildSecretsTable(config map[string]interface{}) (SecretsTable, error) { // nolint: gocyclo
 	errInvalidFormat := errors.New("path to the secret where your Docker credentials are stored " +
 		"must be specified in either 'auto_auth.method.config.secret' or " +
@@ -166,13 +462,29 @@ func BuildSecretsTable(config map[string]interface{}) (SecretsTable, error) { //
 		return SecretsTable{}, errInvalidFormat
 	}
 
-	if hasSecret {
-		return secretsTableFromString(secretRaw)
-	} else if hasSecrets {
-		return secretsTableFromMap(secretsRaw)
+	var (
+		table SecretsTable
+		err   error
+	)
+
+	switch {
+	case hasSecret:
+		table, err = secretsTableFromString(secretRaw)
+	case hasSecrets:
+		table, err = secretsTableFromMap(secretsRaw)
+	default:
+		return SecretsTable{}, errInvalidFormat
 	}
 
-	return SecretsTable{}, errInvalidFormat
+	if err != nil {
+		return SecretsTable{}, err
+	}
+
+	if table.keys, err = parseFieldKeys(config, "auto_auth.method.config"); err != nil {
+		return SecretsTable{}, err
+	}
+
+	return table, nil
 }
 
 func secretsTableFromString(secretRaw interface{}) (SecretsTable, error) {
@@ -185,9 +497,27 @@ func secretsTableFromString(secretRaw interface{}) (SecretsTable, error) {
 		return SecretsTable{}, errors.New("field 'auto_auth.method.config.secret' must not be empty")
 	}
 
+	if err := checkPathTemplate(secret, "auto_auth.method.config.secret"); err != nil {
+		return SecretsTable{}, err
+	}
+
 	return SecretsTable{oneSecret: secret}, nil
 }
 
+// checkPathTemplate returns an error if the path of a secret is a template
+// which cannot be parsed.
+func checkPathTemplate(path, field string) error {
+	if !isPathTemplate(path) {
+		return nil
+	}
+
+	if _, err := vault.ParsePathTemplate("secret", path); err != nil {
+		return fmt.Errorf("field '%s' is not a valid template: %w", field, err)
+	}
+
+	return nil
+}
+
 func secretsTableFromMap(secretsRaw interface{}) (SecretsTable, error) {
 	errEmptyMap := errors.New("field 'auto_auth.method.config.secrets' must have at least one entry")
 
@@ -201,10 +531,76 @@ func secretsTableFromMap(secretsRaw interface{}) (SecretsTable, error) {
 	}
 
 	obj := make(map[string]string)
+	names := make(map[string]string)
+
+	var registryToKeys map[string]fieldKeys
 
 	for host, pathRaw := range secretsArr[0] {
-		if path, ok := pathRaw.(string); ok && path != "" && host != "" {
-			obj[strings.ToLower(host)] = path
+		if host == "" {
+			continue
+		}
+
+		field := fmt.Sprintf("auto_auth.method.config.secrets.%s", host)
+
+		// Registries are looked up by their normalized form, so two
+		// names of the same registry, such as "docker.io" and
+		// "https://index.docker.io/v1/", would shadow each other
+		registry, err := NormalizeRegistry(host)
+		if err != nil {
+			return SecretsTable{}, fmt.Errorf("field '%s' is not a valid registry: %w", field, err)
+		}
+
+		if other, ok := names[registry]; ok {
+			names := []string{other, host}
+			sort.Strings(names)
+
+			return SecretsTable{}, fmt.Errorf("fields 'auto_auth.method.config.secrets.%s' and "+
+				"'auto_auth.method.config.secrets.%s' name the same registry %q", names[0], names[1], registry)
+		}
+
+		names[registry] = host
+		host = registry
+
+		// The secret of a registry may be an object naming its fields
+		secret, isObject := pathRaw.(map[string]interface{})
+		if list, ok := pathRaw.([]map[string]interface{}); ok && len(list) > 0 {
+			secret, isObject = list[0], true
+		}
+
+		if !isObject {
+			if path, ok := pathRaw.(string); ok && path != "" {
+				if err := checkPathTemplate(path, field); err != nil {
+					return SecretsTable{}, err
+				}
+
+				obj[host] = path
+			}
+
+			continue
+		}
+
+		path, ok := secret["path"].(string)
+		if !ok || path == "" {
+			return SecretsTable{}, fmt.Errorf("field '%s.path' must be a non-empty string", field)
+		}
+
+		if err := checkPathTemplate(path, field+".path"); err != nil {
+			return SecretsTable{}, err
+		}
+
+		keys, err := parseFieldKeys(secret, field)
+		if err != nil {
+			return SecretsTable{}, err
+		}
+
+		obj[host] = path
+
+		if keys != (fieldKeys{}) {
+			if registryToKeys == nil {
+				registryToKeys = make(map[string]fieldKeys)
+			}
+
+			registryToKeys[host] = keys
 		}
 	}
 
@@ -212,7 +608,59 @@ func secretsTableFromMap(secretsRaw interface{}) (SecretsTable, error) {
 		return SecretsTable{}, errEmptyMap
 	}
 
-	return SecretsTable{registryToSecret: obj}, nil
+	return SecretsTable{registryToSecret: obj, registryToKeys: registryToKeys}, nil
+}
+
+// parseFieldKeys parses the 'username_key', 'password_key',
+// 'identity_token_key', 'identity_token_username', 'username_template',
+// 'password_template' and 'username_path' fields of the object at field.
+func parseFieldKeys(obj map[string]interface{}, field string) (fieldKeys, error) {
+	var keys fieldKeys
+
+	for key, v := range map[string]*string{
+		"username_key":       &keys.username,
+		"password_key":       &keys.password,
+		"identity_token_key": &keys.identityToken,
+		"username_template":  &keys.usernameTemplate,
+		"password_template":  &keys.passwordTemplate,
+		"username_path":      &keys.usernamePath,
+	} {
+		raw, ok := obj[key]
+		if !ok {
+			continue
+		}
+
+		s, ok := raw.(string)
+		if !ok || s == "" {
+			return fieldKeys{}, fmt.Errorf("field '%s.%s' must be a non-empty string", field, key)
+		}
+
+		if strings.HasSuffix(key, "_template") {
+			if _, err := vault.ParseTemplate(key, s); err != nil {
+				return fieldKeys{}, fmt.Errorf("field '%s.%s' is not a valid template: %v", field, key, err)
+			}
+		}
+
+		*v = s
+	}
+
+	// Unlike the other fields, the username may be empty
+	if raw, ok := obj["identity_token_username"]; ok {
+		username, ok := raw.(string)
+		if !ok {
+			return fieldKeys{}, fmt.Errorf("field '%s.identity_token_username' must be a string", field)
+		}
+
+		keys.identityTokenUsername = &username
+	}
+
+	// An identity token has no username
+	if keys.usernamePath != "" && keys.identityToken != "" {
+		return fieldKeys{}, fmt.Errorf("fields '%s.username_path' and '%s.identity_token_key' "+
+			"must not both be set", field, field)
+	}
+
+	return keys, nil
 }
 
 func validateSinks(sinks []*vaultconfig.Sink) error {
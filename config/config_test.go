@@ -14,8 +14,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/hcl/hcl/token"
@@ -54,6 +57,12 @@ func TestLoadConfig(t *testing.T) {
 			"sink 1 (type: file) is invalid: if the cached token is encrypted, the Diffie-Hellman private key must be provided either by providing the name of the environment variable to which your key is set (the 'file.config.dh_priv_env' field of the configuration file) or by providing a path to a file which contains the key as a JSON-encoded PrivateKeyInfo structure (the 'file.config.dh_priv' field of the configuration file)",
 			nil,
 		},
+		{
+			"duplicate-mount-path",
+			"testdata/duplicate-mount-path.hcl",
+			`invalid 'auto_auth.method.mount_path': mount path "auth/auth/aws-prod" repeats the "auth/" prefix; use "auth/aws-prod"`,
+			nil,
+		},
 		{
 			"no-sinks",
 			"testdata/no-sinks.hcl",
@@ -198,6 +207,31 @@ func TestBuildSecretsTable(t *testing.T) {
 			expectErr:          "field 'auto_auth.method.config.secret' must not be empty",
 			expectSecretsTable: SecretsTable{},
 		},
+		{
+			name: "secret-template",
+			config: map[string]interface{}{
+				"secret": "secret/docker/{{ .Registry }}",
+			},
+			expectSecretsTable: SecretsTable{oneSecret: "secret/docker/{{ .Registry }}"},
+		},
+		{
+			name: "bad-secret-template",
+			config: map[string]interface{}{
+				"secret": "secret/docker/{{ .Registry",
+			},
+			expectErr: "field 'auto_auth.method.config.secret' is not a valid template: template: secret:1: " +
+				"unclosed action",
+		},
+		{
+			name: "bad-secrets-template",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{"registry-1.example.com": "secret/{{ nope }}"},
+				},
+			},
+			expectErr: "field 'auto_auth.method.config.secrets.registry-1.example.com' is not a valid template: " +
+				`template: secret:1: function "nope" not defined`,
+		},
 		{
 			name: "secret-not-string",
 			config: map[string]interface{}{
@@ -258,6 +292,209 @@ func TestBuildSecretsTable(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "field-keys",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{
+						"registry-1.example.com": "secret/docker/creds/1",
+						"registry-2.example.com": []map[string]interface{}{
+							{"path": "secret/docker/creds/2", "password_key": "token"},
+						},
+					},
+				},
+				"username_key": "user",
+				"password_key": "pass",
+			},
+			expectSecretsTable: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/1",
+					"registry-2.example.com": "secret/docker/creds/2",
+				},
+				keys: fieldKeys{username: "user", password: "pass"},
+				registryToKeys: map[string]fieldKeys{
+					"registry-2.example.com": {password: "token"},
+				},
+			},
+		},
+		{
+			name: "identity-token-key",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{
+						"registry-1.example.com": "secret/docker/creds/1",
+						"registry-2.example.com": map[string]interface{}{
+							"path":               "secret/docker/creds/2",
+							"identity_token_key": "refresh_token",
+						},
+					},
+				},
+				"identity_token_key": "token",
+			},
+			expectSecretsTable: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/1",
+					"registry-2.example.com": "secret/docker/creds/2",
+				},
+				keys: fieldKeys{identityToken: "token"},
+				registryToKeys: map[string]fieldKeys{
+					"registry-2.example.com": {identityToken: "refresh_token"},
+				},
+			},
+		},
+		{
+			name: "identity-token-username",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{
+						"registry-1.example.com": "secret/docker/creds/1",
+						"ghcr.io": map[string]interface{}{
+							"path":                    "secret/docker/ghcr",
+							"identity_token_username": "ci-bot",
+						},
+					},
+				},
+				"identity_token_key":      "token",
+				"identity_token_username": "",
+			},
+			expectSecretsTable: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/1",
+					"ghcr.io":                "secret/docker/ghcr",
+				},
+				keys: fieldKeys{identityToken: "token", identityTokenUsername: stringPtr("")},
+				registryToKeys: map[string]fieldKeys{
+					"ghcr.io": {identityTokenUsername: stringPtr("ci-bot")},
+				},
+			},
+		},
+		{
+			name: "runtime-server-urls",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{
+						"https://index.docker.io/v1/": "secret/docker/hub",
+						"LOCALHOST:5000":              "secret/docker/local",
+						"https://[::1]:5000/v2/":      "secret/docker/ipv6",
+					},
+				},
+			},
+			expectSecretsTable: SecretsTable{
+				registryToSecret: map[string]string{
+					"index.docker.io": "secret/docker/hub",
+					"localhost:5000":  "secret/docker/local",
+					"[::1]:5000":      "secret/docker/ipv6",
+				},
+			},
+		},
+		{
+			name: "same-registry",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{
+						"docker.io":                   "secret/docker/hub",
+						"https://index.docker.io/v1/": "secret/docker/other",
+					},
+				},
+			},
+			expectErr: "fields 'auto_auth.method.config.secrets.docker.io' and " +
+				"'auto_auth.method.config.secrets.https://index.docker.io/v1/' name the same registry \"index.docker.io\"",
+		},
+		{
+			name: "identity-token-username-not-string",
+			config: map[string]interface{}{
+				"secret":                  "secret/docker/creds",
+				"identity_token_key":      "token",
+				"identity_token_username": true,
+			},
+			expectErr: "field 'auto_auth.method.config.identity_token_username' must be a string",
+		},
+		{
+			name: "templates",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{
+						"registry-1.example.com": "secret/docker/creds/1",
+						"registry-2.example.com": map[string]interface{}{
+							"path":              "secret/docker/creds/2",
+							"password_template": "{{ .token }}",
+						},
+					},
+				},
+				"username_template": "{{ .user | toLower }}",
+			},
+			expectSecretsTable: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/1",
+					"registry-2.example.com": "secret/docker/creds/2",
+				},
+				keys: fieldKeys{usernameTemplate: "{{ .user | toLower }}"},
+				registryToKeys: map[string]fieldKeys{
+					"registry-2.example.com": {passwordTemplate: "{{ .token }}"},
+				},
+			},
+		},
+		{
+			name: "username-path",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{
+						"registry-1.example.com": "secret/docker/creds/1",
+						"registry-2.example.com": map[string]interface{}{
+							"path":          "ad/creds/docker",
+							"username_path": "secret/docker/users/2",
+						},
+					},
+				},
+				"username_path": "secret/docker/users/1",
+			},
+			expectSecretsTable: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/1",
+					"registry-2.example.com": "ad/creds/docker",
+				},
+				keys: fieldKeys{usernamePath: "secret/docker/users/1"},
+				registryToKeys: map[string]fieldKeys{
+					"registry-2.example.com": {usernamePath: "secret/docker/users/2"},
+				},
+			},
+		},
+		{
+			name: "username-path-with-identity-token",
+			config: map[string]interface{}{
+				"secret":             "secret/docker/creds",
+				"username_path":      "secret/docker/user",
+				"identity_token_key": "token",
+			},
+			expectErr: "fields 'auto_auth.method.config.username_path' and " +
+				"'auto_auth.method.config.identity_token_key' must not both be set",
+		},
+		{
+			name: "invalid-template",
+			config: map[string]interface{}{
+				"secret":            "secret/docker/creds",
+				"password_template": "{{ .auth | base64Decode | cut }}",
+			},
+			expectErr: "field 'auto_auth.method.config.password_template' is not a valid template: " +
+				`template: password_template:1: function "cut" not defined`,
+		},
+		{
+			name: "object-secret-without-path",
+			config: map[string]interface{}{
+				"secrets": []map[string]interface{}{
+					{"registry.example.com": map[string]interface{}{"username_key": "user"}},
+				},
+			},
+			expectErr: "field 'auto_auth.method.config.secrets.registry.example.com.path' must be a non-empty string",
+		},
+		{
+			name: "field-key-not-string",
+			config: map[string]interface{}{
+				"secret":       "secret/docker/creds",
+				"username_key": 1,
+			},
+			expectErr: "field 'auto_auth.method.config.username_key' must be a non-empty string",
+		},
 	}
 
 	for _, tc := range cases {
@@ -283,6 +520,428 @@ func TestBuildSecretsTable(t *testing.T) {
 	}
 }
 
+func TestSecretsTable_FieldKeys(t *testing.T) {
+	st := SecretsTable{
+		registryToSecret: map[string]string{
+			"registry-1.example.com": "secret/docker/creds/1",
+			"registry-2.example.com": "secret/docker/creds/2",
+		},
+		keys: fieldKeys{username: "user", password: "pass"},
+		registryToKeys: map[string]fieldKeys{
+			"registry-2.example.com": {password: "token"},
+		},
+	}
+
+	cases := map[string][2]string{
+		"registry-1.example.com":         {"user", "pass"},
+		"https://REGISTRY-2.example.com": {"user", "token"},
+		"unknown.example.com":            {"user", "pass"},
+	}
+
+	for registry, expected := range cases {
+		username, password := st.FieldKeys(registry)
+		if username != expected[0] || password != expected[1] {
+			t.Errorf("FieldKeys(%q) = %q, %q, expected %q, %q", registry, username, password,
+				expected[0], expected[1])
+		}
+	}
+
+	if username, password := (SecretsTable{}).FieldKeys("registry-1.example.com"); username != "" || password != "" {
+		t.Errorf("Expected no field keys, got %q, %q", username, password)
+	}
+}
+
+func TestSecretsTable_IdentityTokenKey(t *testing.T) {
+	st := SecretsTable{
+		registryToSecret: map[string]string{
+			"registry-1.example.com": "secret/docker/creds/1",
+			"registry-2.example.com": "secret/docker/creds/2",
+			"registry-3.example.com": "secret/docker/creds/3",
+		},
+		keys: fieldKeys{identityToken: "token"},
+		registryToKeys: map[string]fieldKeys{
+			"registry-2.example.com": {identityToken: "refresh_token"},
+			"registry-3.example.com": {password: "pass"},
+		},
+	}
+
+	cases := map[string]string{
+		"registry-1.example.com":         "token",
+		"https://REGISTRY-2.example.com": "refresh_token",
+		"registry-3.example.com":         "token",
+		"unknown.example.com":            "token",
+	}
+
+	for registry, expected := range cases {
+		if key := st.IdentityTokenKey(registry); key != expected {
+			t.Errorf("IdentityTokenKey(%q) = %q, expected %q", registry, key, expected)
+		}
+	}
+
+	if key := (SecretsTable{}).IdentityTokenKey("registry-1.example.com"); key != "" {
+		t.Errorf("Expected no identity token key, got %q", key)
+	}
+}
+
+func TestNormalizeRegistry(t *testing.T) {
+	cases := map[string]string{
+		// Docker CLI
+		"https://index.docker.io/v1/":   "index.docker.io",
+		"https://ghcr.io":               "ghcr.io",
+		"http://registry.local:5000/v2": "registry.local:5000",
+		// Podman and nerdctl
+		"docker.io":             "index.docker.io",
+		"registry-1.docker.io":  "index.docker.io",
+		"Quay.IO":               "quay.io",
+		"localhost:5000":        "localhost:5000",
+		"quay.io/acme/app":      "quay.io",
+		"registry.example.com.": "registry.example.com",
+		"[::1]:5000":            "[::1]:5000",
+		" ghcr.io ":             "ghcr.io",
+	}
+
+	for registry, expected := range cases {
+		got, err := NormalizeRegistry(registry)
+		if err != nil {
+			t.Errorf("NormalizeRegistry(%q): %v", registry, err)
+			continue
+		}
+
+		if got != expected {
+			t.Errorf("NormalizeRegistry(%q) = %q, expected %q", registry, got, expected)
+		}
+	}
+}
+
+func TestSecretsTable_IdentityTokenUsername(t *testing.T) {
+	st := SecretsTable{
+		registryToSecret: map[string]string{
+			"registry-1.example.com": "secret/docker/creds/1",
+			"ghcr.io":                "secret/docker/creds/2",
+		},
+		keys: fieldKeys{identityToken: "token", identityTokenUsername: stringPtr("")},
+		registryToKeys: map[string]fieldKeys{
+			"ghcr.io": {identityTokenUsername: stringPtr("ci-bot")},
+		},
+	}
+
+	cases := map[string]string{
+		"registry-1.example.com": "",
+		"https://GHCR.io":        "ci-bot",
+		"unknown.example.com":    "",
+	}
+
+	for registry, expected := range cases {
+		if username, ok := st.IdentityTokenUsername(registry); !ok || username != expected {
+			t.Errorf("IdentityTokenUsername(%q) = %q, %t, expected %q, true", registry, username, ok, expected)
+		}
+	}
+
+	if username, ok := (SecretsTable{}).IdentityTokenUsername("ghcr.io"); ok {
+		t.Errorf("Expected no identity token username, got %q", username)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestSecretsTable_UsernamePath(t *testing.T) {
+	st := SecretsTable{
+		registryToSecret: map[string]string{
+			"registry-1.example.com": "secret/docker/creds/1",
+			"registry-2.example.com": "ad/creds/docker",
+		},
+		keys: fieldKeys{usernamePath: "secret/docker/users/1"},
+		registryToKeys: map[string]fieldKeys{
+			"registry-2.example.com": {usernamePath: "secret/docker/users/2"},
+		},
+	}
+
+	cases := map[string]string{
+		"registry-1.example.com":         "secret/docker/users/1",
+		"https://REGISTRY-2.example.com": "secret/docker/users/2",
+		"unknown.example.com":            "secret/docker/users/1",
+	}
+
+	for registry, expected := range cases {
+		if path := st.UsernamePath(registry); path != expected {
+			t.Errorf("UsernamePath(%q) = %q, expected %q", registry, path, expected)
+		}
+	}
+
+	if path := (SecretsTable{}).UsernamePath("registry-1.example.com"); path != "" {
+		t.Errorf("Expected no username path, got %q", path)
+	}
+}
+
+func TestSecretsTable_Templates(t *testing.T) {
+	st := SecretsTable{
+		registryToSecret: map[string]string{
+			"registry-1.example.com": "secret/docker/creds/1",
+			"registry-2.example.com": "secret/docker/creds/2",
+		},
+		keys: fieldKeys{usernameTemplate: "{{ .user }}", passwordTemplate: "{{ .pass }}"},
+		registryToKeys: map[string]fieldKeys{
+			"registry-2.example.com": {passwordTemplate: "{{ .token }}"},
+		},
+	}
+
+	cases := map[string][2]string{
+		"registry-1.example.com":         {"{{ .user }}", "{{ .pass }}"},
+		"https://REGISTRY-2.example.com": {"{{ .user }}", "{{ .token }}"},
+		"unknown.example.com":            {"{{ .user }}", "{{ .pass }}"},
+	}
+
+	for registry, expected := range cases {
+		username, password := st.Templates(registry)
+		if username != expected[0] || password != expected[1] {
+			t.Errorf("Templates(%q) = %q, %q, expected %q, %q", registry, username, password,
+				expected[0], expected[1])
+		}
+	}
+
+	if username, password := (SecretsTable{}).Templates("registry-1.example.com"); username != "" || password != "" {
+		t.Errorf("Expected no templates, got %q, %q", username, password)
+	}
+}
+
+func TestSecretsTable_GetPath_Template(t *testing.T) {
+	t.Setenv("TEAM", "payments")
+	t.Setenv("UNSET_TEAM", "")
+
+	cases := []struct {
+		name     string
+		st       SecretsTable
+		registry string
+		expected string
+		err      string
+	}{
+		{
+			name:     "registry-and-env",
+			st:       SecretsTable{oneSecret: `secret/docker/{{ .Registry }}/{{ env "TEAM" }}`},
+			registry: "https://Registry.example.com:5000/v1/",
+			expected: "secret/docker/registry.example.com:5000/payments",
+		},
+		{
+			name:     "functions",
+			st:       SecretsTable{oneSecret: `secret/docker/{{ index (split "." .Registry) 0 }}`},
+			registry: "ghcr.io",
+			expected: "secret/docker/ghcr",
+		},
+		{
+			name: "per-registry",
+			st: SecretsTable{registryToSecret: map[string]string{
+				"registry.example.com": `secret/{{ env "TEAM" }}/docker`,
+			}},
+			registry: "registry.example.com",
+			expected: "secret/payments/docker",
+		},
+		{
+			name:     "unset-env",
+			st:       SecretsTable{oneSecret: `secret/docker/{{ env "UNSET_TEAM" }}`},
+			registry: "registry.example.com",
+			err: `secret path template "secret/docker/{{ env \"UNSET_TEAM\" }}" rendered the path ` +
+				`"secret/docker/" with an empty segment for registry "registry.example.com"`,
+		},
+		{
+			name:     "unknown-field",
+			st:       SecretsTable{oneSecret: `secret/docker/{{ .Team }}`},
+			registry: "registry.example.com",
+			err: "error rendering secret path template: template: secret:1:17: executing \"secret\" at " +
+				"<.Team>: can't evaluate field Team in type vault.PathTemplateData",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := tc.st.GetPath(tc.registry)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tc.expected {
+				t.Fatalf("Expected path %q, got %q", tc.expected, path)
+			}
+		})
+	}
+}
+
+func TestSecretsTable_Paths(t *testing.T) {
+	cases := []struct {
+		name     string
+		st       SecretsTable
+		expected []string
+	}{
+		{
+			name:     "one-secret",
+			st:       SecretsTable{oneSecret: "secret/docker/creds"},
+			expected: []string{"secret/docker/creds"},
+		},
+		{
+			name: "secret-per-registry",
+			st: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/2",
+					"registry-2.example.com": "secret/docker/creds/1",
+					"registry-3.example.com": "secret/docker/creds/2",
+				},
+			},
+			expected: []string{"secret/docker/creds/1", "secret/docker/creds/2"},
+		},
+		{
+			name: "username-paths",
+			st: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/1",
+					"registry-2.example.com": "ad/creds/docker",
+				},
+				keys: fieldKeys{usernamePath: "secret/docker/users/1"},
+				registryToKeys: map[string]fieldKeys{
+					"registry-2.example.com": {usernamePath: "secret/docker/users/2"},
+				},
+			},
+			expected: []string{
+				"ad/creds/docker",
+				"secret/docker/creds/1",
+				"secret/docker/users/1",
+				"secret/docker/users/2",
+			},
+		},
+		{
+			name: "templates",
+			st: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-1.example.com": "secret/docker/creds/1",
+					"registry-2.example.com": "secret/docker/{{ .Registry }}",
+				},
+			},
+			expected: []string{"secret/docker/creds/1"},
+		},
+		{
+			name:     "empty",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.expected, tc.st.Paths()); diff != "" {
+				t.Fatalf("Paths differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSecretsTable_Registries(t *testing.T) {
+	cases := []struct {
+		name     string
+		st       SecretsTable
+		expected []string
+	}{
+		{
+			name:     "one-secret",
+			st:       SecretsTable{oneSecret: "secret/docker/creds"},
+			expected: []string{},
+		},
+		{
+			name: "secret-per-registry",
+			st: SecretsTable{
+				registryToSecret: map[string]string{
+					"registry-2.example.com": "secret/docker/creds/2",
+					"registry-1.example.com": "secret/docker/creds/1",
+				},
+			},
+			expected: []string{"registry-1.example.com", "registry-2.example.com"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.expected, tc.st.Registries()); diff != "" {
+				t.Fatalf("Registries differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_JSON(t *testing.T) {
+	hclConfig, err := LoadConfig("testdata/agent.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonConfig, err := LoadConfig("testdata/agent.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(hclConfig.AutoAuth, jsonConfig.AutoAuth); diff != "" {
+		t.Fatalf("auto_auth blocks differ:\n%s", diff)
+	}
+
+	if jsonConfig.AutoAuth.Method.WrapTTL != 5*time.Minute {
+		t.Fatalf("Expected a wrap_ttl of 5m, got %s", jsonConfig.AutoAuth.Method.WrapTTL)
+	}
+
+	hclTable, err := BuildSecretsTable(hclConfig.AutoAuth.Method.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonTable, err := BuildSecretsTable(jsonConfig.AutoAuth.Method.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(hclTable, jsonTable) {
+		t.Fatalf("Secrets tables differ:\n%+v\n%+v", hclTable, jsonTable)
+	}
+}
+
+func TestWithNoSinkStanzas(t *testing.T) {
+	cases := map[string]string{
+		"hcl":  `auto_auth { method "token" { config = { secret = "secret/docker/creds" } } }`,
+		"json": `{"auto_auth": {"method": [{"type": "token", "config": {"secret": "secret/docker/creds"}}]}}`,
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			patched, err := withNoSinkStanzas([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file := filepath.Join(t.TempDir(), "config."+name)
+			if err = os.WriteFile(file, patched, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := vaultconfig.LoadConfig(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Cache == nil || !cfg.Cache.UseAutoAuthToken {
+				t.Fatalf("Expected the cache to use the auto_auth token, got %+v", cfg.Cache)
+			}
+			if len(cfg.Listeners) != 1 || cfg.Listeners[0].Address != "127.0.0.1:8100" {
+				t.Fatalf("Expected one listener on 127.0.0.1:8100, got %+v", cfg.Listeners)
+			}
+			if cfg.AutoAuth.Method.Config["secret"] != "secret/docker/creds" {
+				t.Fatalf("Expected the auto_auth block to be kept, got %+v", cfg.AutoAuth.Method)
+			}
+		})
+	}
+}
+
 func TestEndToEnd(t *testing.T) {
 	t.Run("one-secret", func(t *testing.T) {
 		cfg, err := LoadConfig("testdata/valid.hcl")
@@ -0,0 +1,118 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// EnvDockerContext overrides the Docker context detected from the
+// environment and the Docker CLI configuration.
+const EnvDockerContext = "DCVL_DOCKER_CONTEXT"
+
+// DefaultDockerContext is the context used by the Docker CLI when no other
+// context is selected.
+const DefaultDockerContext = "default"
+
+// CurrentDockerContext returns the name of the Docker context in use. As
+// with the Docker CLI, DOCKER_CONTEXT takes precedence over DOCKER_HOST,
+// which in turn takes precedence over the 'currentContext' of the Docker
+// CLI configuration file.
+func CurrentDockerContext() (string, error) {
+	for _, env := range []string{EnvDockerContext, "DOCKER_CONTEXT"} {
+		if v := os.Getenv(env); v != "" {
+			return v, nil
+		}
+	}
+
+	if os.Getenv("DOCKER_HOST") != "" {
+		return DefaultDockerContext, nil
+	}
+
+	dockerConfig, _, err := readDockerCLIConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if dockerConfig.CurrentContext == "" {
+		return DefaultDockerContext, nil
+	}
+
+	return dockerConfig.CurrentContext, nil
+}
+
+// ContextConfigFile returns the configuration file to use in the Docker
+// context. The 'docker_context' blocks of configFile map the names of
+// contexts to the configuration files of their profiles; relative paths
+// are resolved against the directory of configFile. If no block matches
+// the context, configFile itself is returned. The Vault agent ignores
+// these blocks.
+func ContextConfigFile(configFile, dockerContext string) (string, error) {
+	data, err := os.ReadFile(configFile) // nolint: gosec
+	if err != nil {
+		return "", err
+	}
+
+	obj, err := hcl.ParseBytes(data)
+	if err != nil {
+		return "", err
+	}
+
+	root, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return "", errors.New("error parsing configuration file: file doesn't contain a root object")
+	}
+
+	for i, item := range root.Filter("docker_context").Items {
+		if len(item.Keys) != 1 {
+			return "", fmt.Errorf("docker context %d is invalid: context name must be specified", i+1)
+		}
+
+		if item.Keys[0].Token.Value().(string) != dockerContext {
+			continue
+		}
+
+		var profile struct {
+			ConfigFile string `hcl:"config_file"`
+		}
+
+		if err = hcl.DecodeObject(&profile, item.Val); err != nil {
+			return "", fmt.Errorf("error parsing docker context %q: %w", dockerContext, err)
+		}
+
+		if profile.ConfigFile == "" {
+			return "", fmt.Errorf("docker context %q is invalid: 'config_file' must be specified", dockerContext)
+		}
+
+		path, err := homedir.Expand(profile.ConfigFile)
+		if err != nil {
+			return "", fmt.Errorf("error expanding configuration file %s: %w", profile.ConfigFile, err)
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(configFile), path)
+		}
+
+		return path, nil
+	}
+
+	return configFile, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCurrentDockerContext(t *testing.T) {
+	dockerConfig := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dockerConfig, "config.json"),
+		[]byte(`{"currentContext":"remote"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	malformedConfig := t.TempDir()
+	if err := os.WriteFile(filepath.Join(malformedConfig, "config.json"), []byte(`{`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		env     map[string]string
+		context string
+		err     string
+	}{
+		{
+			name:    "override",
+			env:     map[string]string{EnvDockerContext: "prod", "DOCKER_CONTEXT": "staging"},
+			context: "prod",
+		},
+		{
+			name:    "docker-context",
+			env:     map[string]string{"DOCKER_CONTEXT": "staging", "DOCKER_CONFIG": dockerConfig},
+			context: "staging",
+		},
+		{
+			name:    "docker-host",
+			env:     map[string]string{"DOCKER_HOST": "tcp://127.0.0.1:2375", "DOCKER_CONFIG": dockerConfig},
+			context: DefaultDockerContext,
+		},
+		{
+			name:    "docker-config",
+			env:     map[string]string{"DOCKER_CONFIG": dockerConfig},
+			context: "remote",
+		},
+		{
+			name:    "no-docker-config",
+			env:     map[string]string{"DOCKER_CONFIG": t.TempDir()},
+			context: DefaultDockerContext,
+		},
+		{
+			name: "malformed-docker-config",
+			env:  map[string]string{"DOCKER_CONFIG": malformedConfig},
+			err:  "error parsing Docker configuration file: unexpected end of JSON input",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, env := range []string{EnvDockerContext, "DOCKER_CONTEXT", "DOCKER_HOST", "DOCKER_CONFIG"} {
+				t.Setenv(env, tc.env[env])
+			}
+
+			context, err := CurrentDockerContext()
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if context != tc.context {
+				t.Fatalf("Expected context %q, got %q", tc.context, context)
+			}
+		})
+	}
+}
+
+func TestContextConfigFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		context string
+		result  string
+		err     string
+	}{
+		{
+			name:    "file-doesnt-exist",
+			file:    "testdata/nonexistent.hcl",
+			context: "prod",
+			err:     "open testdata/nonexistent.hcl: no such file or directory",
+		},
+		{
+			name:    "no-profiles",
+			file:    "testdata/valid.hcl",
+			context: "prod",
+			result:  "testdata/valid.hcl",
+		},
+		{
+			name:    "no-matching-profile",
+			file:    "testdata/contexts.hcl",
+			context: DefaultDockerContext,
+			result:  "testdata/contexts.hcl",
+		},
+		{
+			name:    "relative-path",
+			file:    "testdata/contexts.hcl",
+			context: "prod",
+			result:  "testdata/contexts/prod.hcl",
+		},
+		{
+			name:    "absolute-path",
+			file:    "testdata/contexts.hcl",
+			context: "staging",
+			result:  "/etc/docker-credential-vault-login/staging.hcl",
+		},
+		{
+			name:    "no-config-file",
+			file:    "testdata/context-no-config-file.hcl",
+			context: "prod",
+			err:     "docker context \"prod\" is invalid: 'config_file' must be specified",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ContextConfigFile(tc.file, tc.context)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tc.result {
+				t.Fatalf("Expected configuration file %q, got %q", tc.result, result)
+			}
+		})
+	}
+}
+
+func TestLoadConfigIgnoresDockerContexts(t *testing.T) {
+	if _, err := LoadConfig("testdata/contexts.hcl"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// dockerCLIConfig is the part of the Docker CLI configuration file which
+// the helper reads.
+type dockerCLIConfig struct {
+	CurrentContext    string            `json:"currentContext"`
+	CredsStore        string            `json:"credsStore"`
+	CredentialHelpers map[string]string `json:"credHelpers"`
+}
+
+// DockerCLIConfigFile returns the path of the configuration file of the
+// Docker CLI, config.json in DOCKER_CONFIG or, if it is not set, in
+// ~/.docker. nerdctl reads the same file.
+func DockerCLIConfigFile() (string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		dir = "~/.docker"
+	}
+
+	dir, err := homedir.Expand(dir)
+	if err != nil {
+		return "", fmt.Errorf("error expanding Docker configuration directory %s: %w", dir, err)
+	}
+
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// readDockerCLIConfig reads the configuration file of the Docker CLI and
+// returns it with its path. If the file does not exist, the configuration
+// is empty.
+func readDockerCLIConfig() (dockerCLIConfig, string, error) {
+	var dockerConfig dockerCLIConfig
+
+	path, err := DockerCLIConfigFile()
+	if err != nil {
+		return dockerConfig, "", err
+	}
+
+	data, err := os.ReadFile(path) // nolint: gosec
+	if os.IsNotExist(err) {
+		return dockerConfig, path, nil
+	}
+
+	if err != nil {
+		return dockerConfig, path, fmt.Errorf("error reading Docker configuration file: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &dockerConfig); err != nil {
+		return dockerConfig, path, fmt.Errorf("error parsing Docker configuration file: %w", err)
+	}
+
+	return dockerConfig, path, nil
+}
+
+// DockerCredentialHelper returns the name of the credential helper which
+// the Docker CLI uses for the registry (e.g. "vault-login" for
+// docker-credential-vault-login), as set in the 'credHelpers' or, failing
+// that, the 'credsStore' field of its configuration file, and the path of
+// that file. The name is empty if the Docker CLI stores the credentials
+// of the registry in the file itself.
+func DockerCredentialHelper(registry string) (string, string, error) {
+	dockerConfig, path, err := readDockerCLIConfig()
+	if err != nil {
+		return "", path, err
+	}
+
+	if name, ok := dockerConfig.CredentialHelpers[registry]; ok {
+		return name, path, nil
+	}
+
+	return dockerConfig.CredsStore, path, nil
+}
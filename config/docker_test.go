@@ -0,0 +1,100 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDockerCredentialHelper(t *testing.T) {
+	writeConfig := func(data string) string {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		return dir
+	}
+
+	dockerConfig := writeConfig(`{"credsStore":"desktop","credHelpers":{"registry.example.com":"vault-login"}}`)
+	noStore := writeConfig(`{"auths":{"registry.example.com":{}}}`)
+	malformed := writeConfig(`{`)
+
+	cases := []struct {
+		name     string
+		dir      string
+		registry string
+		helper   string
+		err      string
+	}{
+		{
+			name:     "cred-helpers",
+			dir:      dockerConfig,
+			registry: "registry.example.com",
+			helper:   "vault-login",
+		},
+		{
+			name:     "creds-store",
+			dir:      dockerConfig,
+			registry: "quay.io",
+			helper:   "desktop",
+		},
+		{
+			name:     "no-helper",
+			dir:      noStore,
+			registry: "registry.example.com",
+		},
+		{
+			name:     "no-file",
+			dir:      t.TempDir(),
+			registry: "registry.example.com",
+		},
+		{
+			name:     "malformed",
+			dir:      malformed,
+			registry: "registry.example.com",
+			err:      "error parsing Docker configuration file: unexpected end of JSON input",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("DOCKER_CONFIG", tc.dir)
+
+			helper, path, err := DockerCredentialHelper(tc.registry)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if helper != tc.helper {
+				t.Fatalf("Expected helper %q, got %q", tc.helper, helper)
+			}
+			if expected := filepath.Join(tc.dir, "config.json"); path != expected {
+				t.Fatalf("Expected path %q, got %q", expected, path)
+			}
+		})
+	}
+}
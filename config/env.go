@@ -0,0 +1,131 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+)
+
+// Environment variables which override the fields of the
+// 'auto_auth.method' block of the configuration file.
+const (
+	EnvAuthMethod    = "DCVL_AUTH_METHOD"
+	EnvAuthMountPath = "DCVL_AUTH_MOUNT_PATH"
+	EnvAuthNamespace = "DCVL_AUTH_NAMESPACE"
+	EnvAuthWrapTTL   = "DCVL_AUTH_WRAP_TTL"
+
+	// EnvAuthConfigPrefix is the prefix of the environment variables which
+	// override the fields of 'auto_auth.method.config': the rest of the
+	// name is the field, in upper case (e.g. DCVL_AUTH_CONFIG_ROLE).
+	EnvAuthConfigPrefix = "DCVL_AUTH_CONFIG_"
+)
+
+// applyEnvOverrides overrides the fields of the auth method with the
+// values of the DCVL_AUTH_* environment variables which are set. Values of
+// config fields which start with '[' or '{' are decoded as JSON, so that
+// lists and maps can be set too.
+func applyEnvOverrides(method *vaultconfig.Method) error {
+	if v := os.Getenv(EnvAuthMethod); v != "" && v != method.Type {
+		// Keep the default mount path in line with the type
+		if method.MountPath == "auth/"+method.Type {
+			method.MountPath = "auth/" + v
+		}
+
+		method.Type = v
+	}
+
+	if v := os.Getenv(EnvAuthMountPath); v != "" {
+		method.MountPath = strings.TrimSuffix(v, "/")
+	}
+
+	if v := os.Getenv(EnvAuthNamespace); v != "" {
+		method.Namespace = v
+	}
+
+	if v := os.Getenv(EnvAuthWrapTTL); v != "" {
+		ttl, err := parseutil.ParseDurationSecond(v)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %w", EnvAuthWrapTTL, err)
+		}
+
+		method.WrapTTL = ttl
+	}
+
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvAuthConfigPrefix) || value == "" {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimPrefix(name, EnvAuthConfigPrefix))
+		if key == "" {
+			continue
+		}
+
+		var decoded interface{} = value
+
+		if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				return fmt.Errorf("error JSON-decoding %s: %w", name, err)
+			}
+
+			decoded = hclShape(decoded)
+		}
+
+		if method.Config == nil {
+			method.Config = make(map[string]interface{})
+		}
+
+		// A secret set in the environment replaces the secrets of the
+		// file and vice versa
+		switch key {
+		case "secret":
+			delete(method.Config, "secrets")
+		case "secrets":
+			delete(method.Config, "secret")
+		}
+
+		method.Config[key] = decoded
+	}
+
+	return nil
+}
+
+// hclShape returns the value decoded from JSON in the shape in which the
+// HCL parser decodes the configuration file: every object is wrapped in a
+// list.
+func hclShape(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = hclShape(value)
+		}
+
+		return []map[string]interface{}{v}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = hclShape(value)
+		}
+
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestLoadConfig_EnvOverrides(t *testing.T) {
+	cases := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		expected *vaultconfig.Method
+		err      string
+	}{
+		{
+			name: "no-overrides",
+			file: "testdata/valid.hcl",
+			expected: &vaultconfig.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":   "/tmp/role-id",
+					"secret_id_file_path": "/tmp/secret-id",
+					"secret":              "secret/docker/creds",
+				},
+			},
+		},
+		{
+			name: "method",
+			file: "testdata/valid.hcl",
+			env: map[string]string{
+				EnvAuthMethod:                "aws",
+				EnvAuthNamespace:             "team-a",
+				EnvAuthWrapTTL:               "2m",
+				EnvAuthConfigPrefix + "ROLE": "docker",
+				EnvAuthConfigPrefix + "SECRET_ID_FILE_PATH": "/etc/secret-id",
+			},
+			expected: &vaultconfig.Method{
+				Type:      "aws",
+				MountPath: "auth/aws",
+				Namespace: "team-a",
+				WrapTTL:   2 * time.Minute,
+				Config: map[string]interface{}{
+					"role":                "docker",
+					"role_id_file_path":   "/tmp/role-id",
+					"secret_id_file_path": "/etc/secret-id",
+					"secret":              "secret/docker/creds",
+				},
+			},
+		},
+		{
+			name: "custom-mount-path-kept",
+			file: "testdata/agent.hcl",
+			env: map[string]string{
+				EnvAuthMethod:                   "aws",
+				EnvAuthConfigPrefix + "SECRETS": `{"registry.example.com":"secret/docker/creds"}`,
+			},
+			expected: &vaultconfig.Method{
+				Type:      "aws",
+				MountPath: "auth/approle-docker",
+				WrapTTL:   5 * time.Minute,
+				Config: map[string]interface{}{
+					"role_id_file_path":   "/tmp/role-id",
+					"secret_id_file_path": "/tmp/secret-id",
+					"secrets": []map[string]interface{}{{
+						"registry.example.com": "secret/docker/creds",
+					}},
+				},
+			},
+		},
+		{
+			name: "mount-path",
+			file: "testdata/valid.hcl",
+			env: map[string]string{
+				EnvAuthMountPath:               "auth/approle-ci/",
+				EnvAuthConfigPrefix + "SECRET": "secret/ci/creds",
+			},
+			expected: &vaultconfig.Method{
+				Type:      "approle",
+				MountPath: "auth/approle-ci",
+				Config: map[string]interface{}{
+					"role_id_file_path":   "/tmp/role-id",
+					"secret_id_file_path": "/tmp/secret-id",
+					"secret":              "secret/ci/creds",
+				},
+			},
+		},
+		{
+			name: "secret-replaces-secrets",
+			file: "testdata/agent.hcl",
+			env: map[string]string{
+				EnvAuthMethod:                  "approle",
+				EnvAuthConfigPrefix + "SECRET": "secret/ci/creds",
+			},
+			expected: &vaultconfig.Method{
+				Type:      "approle",
+				MountPath: "auth/approle-docker",
+				WrapTTL:   5 * time.Minute,
+				Config: map[string]interface{}{
+					"role_id_file_path":   "/tmp/role-id",
+					"secret_id_file_path": "/tmp/secret-id",
+					"secret":              "secret/ci/creds",
+				},
+			},
+		},
+		{
+			name: "invalid-wrap-ttl",
+			file: "testdata/valid.hcl",
+			env:  map[string]string{EnvAuthWrapTTL: "soon"},
+			err:  `error parsing DCVL_AUTH_WRAP_TTL: time: invalid duration "soon"`,
+		},
+		{
+			name: "invalid-json",
+			file: "testdata/valid.hcl",
+			env:  map[string]string{EnvAuthConfigPrefix + "SECRETS": "{"},
+			err:  "error JSON-decoding DCVL_AUTH_CONFIG_SECRETS: unexpected end of JSON input",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for env, value := range tc.env {
+				t.Setenv(env, value)
+			}
+
+			config, err := LoadConfig(tc.file)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expected, config.AutoAuth.Method); diff != "" {
+				t.Fatalf("Methods differ:\n%s", diff)
+			}
+
+			if _, err = BuildSecretsTable(config.AutoAuth.Method.Config); err != nil {
+				t.Fatalf("error building secrets table: %v", err)
+			}
+		})
+	}
+}
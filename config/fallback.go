@@ -0,0 +1,94 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/helper/namespace"
+)
+
+// LoadFallbackMethods parses the 'fallback_method' blocks of the
+// 'auto_auth' block of the configuration file. These blocks have the same
+// format as the 'method' block and configure the authentication methods
+// which are tried, in order, whenever the method fails. The Vault agent
+// ignores these blocks.
+func LoadFallbackMethods(configFile string) ([]*vaultconfig.Method, error) {
+	data, err := os.ReadFile(configFile) // nolint: gosec
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFallbackMethods(data)
+}
+
+// ParseFallbackMethods parses the 'fallback_method' blocks of the contents
+// of a configuration file, as LoadFallbackMethods does.
+func ParseFallbackMethods(data []byte) ([]*vaultconfig.Method, error) {
+	obj, err := hcl.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, errors.New("error parsing configuration file: file doesn't contain a root object")
+	}
+
+	var methods []*vaultconfig.Method
+
+	for _, autoAuth := range root.Filter("auto_auth").Items {
+		subs, ok := autoAuth.Val.(*ast.ObjectType)
+		if !ok {
+			return nil, errors.New("could not parse \"auto_auth\" as an object")
+		}
+
+		for i, item := range subs.List.Filter("fallback_method").Items {
+			var m vaultconfig.Method
+			if err = hcl.DecodeObject(&m, item.Val); err != nil {
+				return nil, fmt.Errorf("error parsing fallback method %d: %w", i+1, err)
+			}
+
+			if m.Type == "" && len(item.Keys) == 1 {
+				m.Type = strings.ToLower(item.Keys[0].Token.Value().(string))
+			}
+
+			if m.Type == "" {
+				return nil, fmt.Errorf("fallback method %d is invalid: method type must be specified", i+1)
+			}
+
+			// Mirror the defaults of the 'method' block
+			if m.MountPath == "" {
+				m.MountPath = "auth/" + m.Type
+			}
+
+			m.MountPath = strings.TrimSuffix(m.MountPath, "/")
+			m.Namespace = namespace.Canonicalize(m.Namespace)
+
+			if err = ValidateMountPath(m.MountPath); err != nil {
+				return nil, fmt.Errorf("fallback method %d is invalid: %w", i+1, err)
+			}
+
+			methods = append(methods, &m)
+		}
+	}
+
+	return methods, nil
+}
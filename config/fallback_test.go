@@ -0,0 +1,88 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestLoadFallbackMethods(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		err     string
+		methods []*vaultconfig.Method
+	}{
+		{
+			name: "file-doesnt-exist",
+			file: "testdata/nonexistent.hcl",
+			err:  "open testdata/nonexistent.hcl: no such file or directory",
+		},
+		{
+			name: "no-fallback-methods",
+			file: "testdata/valid.hcl",
+		},
+		{
+			name: "no-type",
+			file: "testdata/fallback-no-type.hcl",
+			err:  "fallback method 1 is invalid: method type must be specified",
+		},
+		{
+			name: "duplicate-mount-path",
+			file: "testdata/fallback-duplicate-mount-path.hcl",
+			err:  `fallback method 1 is invalid: mount path "auth/auth/kubernetes-prod" repeats the "auth/" prefix; use "auth/kubernetes-prod"`,
+		},
+		{
+			name: "fallback-methods",
+			file: "testdata/fallback.hcl",
+			methods: []*vaultconfig.Method{
+				{
+					Type:      "kubernetes",
+					MountPath: "auth/kubernetes",
+					Config:    map[string]interface{}{"role": "dev-role"},
+				},
+				{
+					Type:      "token_file",
+					MountPath: "auth/token",
+					Namespace: "ns1/",
+					Config:    map[string]interface{}{"token_file_path": "/tmp/token"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			methods, err := LoadFallbackMethods(tc.file)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.methods, methods) {
+				t.Fatalf("Methods differ:\n%v", cmp.Diff(tc.methods, methods))
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// authPrefix is the prefix of the paths of auth methods in Vault.
+const authPrefix = "auth/"
+
+// ValidateMountPath checks the 'mount_path' of an auth method, at which
+// the helper logs in (e.g. "auth/aws-prod" logs in at
+// "auth/aws-prod/login"). Like the Vault agent, the helper expects the path
+// to start with "auth/", so a path which repeats the prefix, as happens
+// when it is added to a path which already has it, is rejected.
+func ValidateMountPath(mountPath string) error {
+	if strings.HasPrefix(mountPath, "/") {
+		return fmt.Errorf("mount path %q must not start with a slash; use %q", mountPath,
+			strings.TrimLeft(mountPath, "/"))
+	}
+
+	if mountPath == "" || mountPath+"/" == authPrefix {
+		return fmt.Errorf("mount path %q does not name a mount of an auth method, e.g. \"auth/aws\"", mountPath)
+	}
+
+	if !strings.HasPrefix(mountPath, authPrefix+authPrefix) {
+		return nil
+	}
+
+	fixed := mountPath
+	for strings.HasPrefix(fixed, authPrefix+authPrefix) {
+		fixed = strings.TrimPrefix(fixed, authPrefix)
+	}
+
+	return fmt.Errorf("mount path %q repeats the %q prefix; use %q", mountPath, authPrefix, fixed)
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateMountPath(t *testing.T) {
+	cases := []struct {
+		mountPath string
+		err       string
+	}{
+		{mountPath: "auth/aws"},
+		{mountPath: "auth/aws-prod"},
+		{mountPath: "auth/team/aws"},
+		{mountPath: "auth/auth"},
+		{
+			mountPath: "auth/auth/aws-prod",
+			err:       `mount path "auth/auth/aws-prod" repeats the "auth/" prefix; use "auth/aws-prod"`,
+		},
+		{
+			mountPath: "auth/auth/auth/aws-prod",
+			err:       `mount path "auth/auth/auth/aws-prod" repeats the "auth/" prefix; use "auth/aws-prod"`,
+		},
+		{
+			mountPath: "/auth/aws",
+			err:       `mount path "/auth/aws" must not start with a slash; use "auth/aws"`,
+		},
+		{
+			mountPath: "auth",
+			err:       `mount path "auth" does not name a mount of an auth method, e.g. "auth/aws"`,
+		},
+		{
+			mountPath: "",
+			err:       `mount path "" does not name a mount of an auth method, e.g. "auth/aws"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.mountPath, func(t *testing.T) {
+			err := ValidateMountPath(tc.mountPath)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
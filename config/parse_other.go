@@ -0,0 +1,25 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !unix
+
+package config
+
+import vaultconfig "github.com/hashicorp/vault/command/agent/config"
+
+// parseVaultConfig parses data with the configuration parser of the Vault
+// agent, which only reads files. This platform cannot name a pipe as a
+// file, so a temporary file is parsed.
+func parseVaultConfig(data []byte) (*vaultconfig.Config, error) {
+	return parseVaultConfigFile(data)
+}
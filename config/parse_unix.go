@@ -0,0 +1,52 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build unix
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+)
+
+// parseVaultConfig parses data with the configuration parser of the Vault
+// agent, which only reads files, through a pipe named by /dev/fd so that
+// the configuration, which may hold secrets, is never written to disk. If
+// the system has no /dev/fd, e.g. because /proc is not mounted, a
+// temporary file is parsed instead.
+func parseVaultConfig(data []byte) (*vaultconfig.Config, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close() // nolint: errcheck
+
+	path := fmt.Sprintf("/dev/fd/%d", r.Fd())
+	if _, err = os.Stat(path); err != nil {
+		w.Close() // nolint: errcheck, gosec
+		return parseVaultConfigFile(data)
+	}
+
+	// The parser reads the pipe while data is written to it. If the parser
+	// fails before reading all of it, closing the pipe ends the write.
+	go func() {
+		w.Write(data) // nolint: errcheck, gosec
+		w.Close()     // nolint: errcheck, gosec
+	}()
+
+	return vaultconfig.LoadConfig(path)
+}
@@ -0,0 +1,346 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/printer"
+)
+
+// EnvProfile selects the profile of the configuration file to use.
+const EnvProfile = "DCVL_PROFILE"
+
+// profileName matches the names of profiles, which are used in the names
+// of files and directories.
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Profile is a named variant of the configuration, such as one for each
+// Vault cluster.
+type Profile struct {
+	Name string
+
+	// Registries lists the registries which are served with the profile
+	// unless a profile is selected explicitly.
+	Registries []string
+
+	// items are the top-level blocks and fields of the profile, which
+	// replace those of the same name outside of profiles. fields holds
+	// them instead if the configuration file is JSON.
+	items  []*ast.ObjectItem
+	fields map[string]interface{}
+}
+
+// Profiles are the profiles of a configuration file.
+type Profiles struct {
+	configFile string
+	profiles   []Profile
+
+	// root holds the top-level blocks and fields outside of profiles,
+	// rootFields holds them instead if the configuration file is JSON.
+	root       []*ast.ObjectItem
+	rootFields map[string]interface{}
+}
+
+// LoadProfiles parses the 'profile' blocks of the configuration file. The
+// Vault agent doesn't support these blocks.
+func LoadProfiles(configFile string) (Profiles, error) {
+	data, err := os.ReadFile(configFile) // nolint: gosec
+	if err != nil {
+		return Profiles{}, err
+	}
+
+	// The HCL parser reads the file as JSON if it starts with an object
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return loadJSONProfiles(configFile, data)
+	}
+
+	obj, err := hcl.ParseBytes(data)
+	if err != nil {
+		return Profiles{}, err
+	}
+
+	root, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return Profiles{}, errors.New("error parsing configuration file: file doesn't contain a root object")
+	}
+
+	profiles := Profiles{configFile: configFile}
+
+	for _, item := range root.Items {
+		switch itemKey(item) {
+		case "docker_context":
+		case "profile":
+			if len(item.Keys) != 2 {
+				return Profiles{}, fmt.Errorf("profile %d is invalid: profile name must be specified",
+					len(profiles.profiles)+1)
+			}
+
+			name, _ := item.Keys[1].Token.Value().(string)
+
+			body, ok := item.Val.(*ast.ObjectType)
+			if !ok {
+				return Profiles{}, fmt.Errorf("could not parse profile %q as an object", name)
+			}
+
+			var p struct {
+				Registries []string `hcl:"registries"`
+			}
+
+			if err = hcl.DecodeObject(&p, body); err != nil {
+				return Profiles{}, fmt.Errorf("error parsing profile %q: %w", name, err)
+			}
+
+			profile := Profile{Name: name, Registries: p.Registries}
+
+			for _, sub := range body.List.Items {
+				if itemKey(sub) != "registries" {
+					profile.items = append(profile.items, sub)
+				}
+			}
+
+			if err = profiles.add(profile); err != nil {
+				return Profiles{}, err
+			}
+		default:
+			profiles.root = append(profiles.root, item)
+		}
+	}
+
+	return profiles, nil
+}
+
+// loadJSONProfiles parses the 'profile' object of a JSON configuration
+// file, whose fields are the profiles.
+func loadJSONProfiles(configFile string, data []byte) (Profiles, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return Profiles{}, fmt.Errorf("error parsing configuration file as JSON: %w", err)
+	}
+
+	profiles := Profiles{configFile: configFile, rootFields: make(map[string]interface{}, len(obj))}
+
+	for key, v := range obj {
+		if key != "profile" && key != "docker_context" {
+			profiles.rootFields[key] = v
+		}
+	}
+
+	raw, ok := obj["profile"]
+	if !ok {
+		return profiles, nil
+	}
+
+	byName, ok := raw.(map[string]interface{})
+	if !ok {
+		return Profiles{}, errors.New("'profile' must be an object whose fields are the profiles")
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fields, ok := byName[name].(map[string]interface{})
+		if !ok {
+			return Profiles{}, fmt.Errorf("could not parse profile %q as an object", name)
+		}
+
+		profile := Profile{Name: name, fields: make(map[string]interface{}, len(fields))}
+
+		for key, v := range fields {
+			if key != "registries" {
+				profile.fields[key] = v
+				continue
+			}
+
+			list, _ := v.([]interface{})
+			for _, r := range list {
+				registry, ok := r.(string)
+				if !ok {
+					return Profiles{}, fmt.Errorf("error parsing profile %q: 'registries' must be a list of strings",
+						name)
+				}
+
+				profile.Registries = append(profile.Registries, registry)
+			}
+		}
+
+		if err := profiles.add(profile); err != nil {
+			return Profiles{}, err
+		}
+	}
+
+	return profiles, nil
+}
+
+// add validates the profile, normalizes its registries and adds it.
+func (p *Profiles) add(profile Profile) error {
+	if !profileName.MatchString(profile.Name) {
+		return fmt.Errorf("profile %q is invalid: its name may only contain letters, digits, '_', '.' and '-'",
+			profile.Name)
+	}
+
+	for _, other := range p.profiles {
+		if other.Name == profile.Name {
+			return fmt.Errorf("profile %q is defined more than once", profile.Name)
+		}
+	}
+
+	for i, registry := range profile.Registries {
+		normalized, err := NormalizeRegistry(registry)
+		if err != nil || normalized == "" {
+			return fmt.Errorf("profile %q is invalid: registry %q is invalid", profile.Name, registry)
+		}
+
+		profile.Registries[i] = normalized
+	}
+
+	p.profiles = append(p.profiles, profile)
+
+	return nil
+}
+
+// Empty reports whether the configuration file has no profiles.
+func (p Profiles) Empty() bool {
+	return len(p.profiles) == 0
+}
+
+// Names returns the names of the profiles in the order of the file.
+func (p Profiles) Names() []string {
+	names := make([]string, 0, len(p.profiles))
+	for _, profile := range p.profiles {
+		names = append(names, profile.Name)
+	}
+
+	return names
+}
+
+// Get returns the profile with the name.
+func (p Profiles) Get(name string) (Profile, error) {
+	for _, profile := range p.profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+
+	return Profile{}, fmt.Errorf("profile %q not found in configuration file %s", name, p.configFile)
+}
+
+// Match returns the first profile which lists the registry.
+func (p Profiles) Match(registry string) (Profile, bool) {
+	registry, err := NormalizeRegistry(registry)
+	if err != nil {
+		return Profile{}, false
+	}
+
+	for _, profile := range p.profiles {
+		for _, r := range profile.Registries {
+			if r == registry {
+				return profile, true
+			}
+		}
+	}
+
+	return Profile{}, false
+}
+
+// HasRoot reports whether the configuration file has an 'auto_auth' block
+// outside of profiles, without which it can only be used with a profile.
+func (p Profiles) HasRoot() bool {
+	if p.rootFields != nil {
+		_, ok := p.rootFields["auto_auth"]
+		return ok
+	}
+
+	for _, item := range p.root {
+		if itemKey(item) == "auto_auth" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Config returns the configuration of the profile, in the format of the
+// configuration file, to be parsed with ParseConfig. The top-level blocks
+// and fields of the profile replace all of those of the same name outside
+// of profiles; the others are kept.
+func (p Profiles) Config(profile Profile) ([]byte, error) {
+	data, err := p.merge(profile)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting profile %q: %w", profile.Name, err)
+	}
+
+	return data, nil
+}
+
+// merge returns the configuration of the profile.
+func (p Profiles) merge(profile Profile) ([]byte, error) {
+	if p.rootFields != nil {
+		merged := make(map[string]interface{}, len(p.rootFields)+len(profile.fields))
+		for key, v := range p.rootFields {
+			merged[key] = v
+		}
+
+		for key, v := range profile.fields {
+			merged[key] = v
+		}
+
+		return json.Marshal(merged)
+	}
+
+	replaced := make(map[string]bool, len(profile.items))
+	for _, item := range profile.items {
+		replaced[itemKey(item)] = true
+	}
+
+	items := make([]*ast.ObjectItem, 0, len(p.root)+len(profile.items))
+
+	for _, item := range p.root {
+		if !replaced[itemKey(item)] {
+			items = append(items, item)
+		}
+	}
+
+	items = append(items, profile.items...)
+
+	var buf bytes.Buffer
+	err := printer.Fprint(&buf, &ast.File{Node: &ast.ObjectList{Items: items}})
+
+	return buf.Bytes(), err
+}
+
+// itemKey returns the first key of the item, e.g. "vault" for the 'vault'
+// block.
+func itemKey(item *ast.ObjectItem) string {
+	if len(item.Keys) == 0 {
+		return ""
+	}
+
+	key, _ := item.Keys[0].Token.Value().(string)
+
+	return key
+}
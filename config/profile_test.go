@@ -0,0 +1,230 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	cases := []struct {
+		name       string
+		file       string
+		names      []string
+		registries [][]string
+		root       bool
+		err        string
+	}{
+		{
+			name:  "hcl",
+			file:  "testdata/profiles.hcl",
+			names: []string{"ci", "prod"},
+			registries: [][]string{
+				{"ci.registry.example.com", "mirror.example.com:5000"},
+				{"registry.example.com"},
+			},
+			root: true,
+		},
+		{
+			name:       "json",
+			file:       "testdata/profiles.json",
+			names:      []string{"ci"},
+			registries: [][]string{{"ci.registry.example.com"}},
+			root:       true,
+		},
+		{
+			name:       "profiles-only",
+			file:       "testdata/profiles-only.hcl",
+			names:      []string{"ci"},
+			registries: [][]string{{"ci.registry.example.com"}},
+		},
+		{
+			name:  "no-profiles",
+			file:  "testdata/valid.hcl",
+			names: []string{},
+			root:  true,
+		},
+		{
+			name: "no-name",
+			file: "testdata/profiles-no-name.hcl",
+			err:  "profile 1 is invalid: profile name must be specified",
+		},
+		{
+			name: "invalid-name",
+			file: "testdata/profiles-invalid-name.hcl",
+			err:  `profile "ci/prod" is invalid: its name may only contain letters, digits, '_', '.' and '-'`,
+		},
+		{
+			name: "duplicate",
+			file: "testdata/profiles-duplicate.hcl",
+			err:  `profile "ci" is defined more than once`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			profiles, err := LoadProfiles(tc.file)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.names, profiles.Names()); diff != "" {
+				t.Errorf("Profile names differ:\n%s", diff)
+			}
+			if profiles.Empty() != (len(tc.names) == 0) {
+				t.Errorf("Expected Empty() to return %t", len(tc.names) == 0)
+			}
+			if profiles.HasRoot() != tc.root {
+				t.Errorf("Expected HasRoot() to return %t", tc.root)
+			}
+
+			for i, name := range tc.names {
+				profile, err := profiles.Get(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.registries[i], profile.Registries); diff != "" {
+					t.Errorf("Registries of profile %q differ:\n%s", name, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestProfiles_Match(t *testing.T) {
+	profiles, err := LoadProfiles("testdata/profiles.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"ci.registry.example.com":           "ci",
+		"https://CI.registry.example.com/":  "ci",
+		"mirror.example.com:5000":           "ci",
+		"registry.example.com":              "prod",
+		"mirror.example.com":                "",
+		"https://index.docker.io/v1/":       "",
+		"registry.example.com.attacker.com": "",
+	}
+
+	for registry, expected := range cases {
+		profile, ok := profiles.Match(registry)
+		if ok != (expected != "") || profile.Name != expected {
+			t.Errorf("Expected %q to match profile %q, got %q", registry, expected, profile.Name)
+		}
+	}
+
+	if _, err = profiles.Get("staging"); err == nil || err.Error() !=
+		`profile "staging" not found in configuration file testdata/profiles.hcl` {
+		t.Fatalf("Expected an error for an unknown profile, got %v", err)
+	}
+}
+
+func TestProfiles_Config(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		profile string
+		address string
+		method  string
+		secret  string
+	}{
+		{
+			name:    "inherit-auto-auth",
+			file:    "testdata/profiles.hcl",
+			profile: "ci",
+			address: "https://vault-ci.example.com",
+			method:  "aws",
+			secret:  "secret/docker/creds",
+		},
+		{
+			name:    "replace-auto-auth",
+			file:    "testdata/profiles.hcl",
+			profile: "prod",
+			address: "https://vault-prod.example.com",
+			method:  "approle",
+			secret:  "secret/prod/docker/creds",
+		},
+		{
+			name:    "json",
+			file:    "testdata/profiles.json",
+			profile: "ci",
+			address: "https://vault-ci.example.com",
+			method:  "aws",
+			secret:  "secret/docker/creds",
+		},
+		{
+			name:    "profiles-only",
+			file:    "testdata/profiles-only.hcl",
+			profile: "ci",
+			method:  "aws",
+			secret:  "secret/docker/creds",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			profiles, err := LoadProfiles(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			profile, err := profiles.Get(tc.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The configuration of the profile holds secrets, so it must
+			// not be written to the temporary directory to be parsed
+			t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+			data, err := profiles.Config(profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := ParseConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			address := ""
+			if cfg.Vault != nil {
+				address = cfg.Vault.Address
+			}
+
+			if address != tc.address {
+				t.Errorf("Expected Vault address %q, got %q", tc.address, address)
+			}
+			if cfg.AutoAuth.Method.Type != tc.method {
+				t.Errorf("Expected method %q, got %q", tc.method, cfg.AutoAuth.Method.Type)
+			}
+			if secret := cfg.AutoAuth.Method.Config["secret"]; secret != tc.secret {
+				t.Errorf("Expected secret %q, got %v", tc.secret, secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// DefaultMaxStale is how long after they were read the last-known-good
+// credentials are served unless 'cache.max_stale' is set.
+const DefaultMaxStale = time.Hour
+
+// StaleOptions configures the stale-cache fallback, with which the last
+// credentials read from each secret are returned if the helper fails to
+// read them again.
+type StaleOptions struct {
+	// UseStaleOnError enables the fallback.
+	UseStaleOnError bool
+
+	// MaxStale is how long after they were read the credentials may be
+	// returned.
+	MaxStale time.Duration
+}
+
+// LoadStaleOptions parses the 'use_stale_on_error' and 'max_stale' fields
+// of the 'cache' block of the configuration file. The Vault agent ignores
+// these fields.
+func LoadStaleOptions(configFile string) (StaleOptions, error) {
+	data, err := os.ReadFile(configFile) // nolint: gosec
+	if err != nil {
+		return StaleOptions{MaxStale: DefaultMaxStale}, err
+	}
+
+	return ParseStaleOptions(data)
+}
+
+// ParseStaleOptions parses the 'use_stale_on_error' and 'max_stale' fields
+// of the contents of a configuration file, as LoadStaleOptions does.
+func ParseStaleOptions(data []byte) (StaleOptions, error) {
+	opts := StaleOptions{MaxStale: DefaultMaxStale}
+
+	obj, err := hcl.ParseBytes(data)
+	if err != nil {
+		return opts, err
+	}
+
+	root, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return opts, errors.New("error parsing configuration file: file doesn't contain a root object")
+	}
+
+	for _, item := range root.Filter("cache").Items {
+		var c struct {
+			UseStaleOnError interface{} `hcl:"use_stale_on_error"`
+			MaxStale        interface{} `hcl:"max_stale"`
+		}
+
+		if err = hcl.DecodeObject(&c, item.Val); err != nil {
+			return opts, fmt.Errorf("error parsing 'cache': %w", err)
+		}
+
+		if c.UseStaleOnError != nil {
+			if opts.UseStaleOnError, err = parseutil.ParseBool(c.UseStaleOnError); err != nil {
+				return opts, errors.New("'cache.use_stale_on_error' must be a boolean")
+			}
+		}
+
+		if c.MaxStale != nil {
+			if opts.MaxStale, err = parseutil.ParseDurationSecond(c.MaxStale); err != nil {
+				return opts, fmt.Errorf("error parsing 'cache.max_stale': %w", err)
+			}
+
+			if opts.MaxStale <= 0 {
+				return opts, errors.New("'cache.max_stale' must be positive")
+			}
+		}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadStaleOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+		err  string
+		opts StaleOptions
+	}{
+		{
+			name: "file-doesnt-exist",
+			file: "testdata/nonexistent.hcl",
+			err:  "open testdata/nonexistent.hcl: no such file or directory",
+		},
+		{
+			name: "no-cache-block",
+			file: "testdata/valid.hcl",
+			opts: StaleOptions{MaxStale: DefaultMaxStale},
+		},
+		{
+			name: "stale",
+			file: "testdata/stale.hcl",
+			opts: StaleOptions{UseStaleOnError: true, MaxStale: 6 * time.Hour},
+		},
+		{
+			name: "invalid-max-stale",
+			file: "testdata/stale-invalid.hcl",
+			err:  `error parsing 'cache.max_stale': time: invalid duration "a while"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := LoadStaleOptions(tc.file)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.opts, opts); diff != "" {
+				t.Fatalf("Options differ:\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_CacheBlock(t *testing.T) {
+	// The Vault agent accepts the 'cache' block even though the helper
+	// has no listener
+	if _, err := LoadConfig("testdata/stale.hcl"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+)
+
+// StaticCredentials are the credentials of registries given in the
+// configuration file, which are returned when the credentials cannot be
+// read from Vault. They are meant for break-glass scenarios only.
+type StaticCredentials struct {
+	registryToCreds map[string]staticCredential
+}
+
+// staticCredential is the username and password of a registry. Either may
+// be given inline or as the name of the environment variable holding it.
+type staticCredential struct {
+	username    string
+	usernameEnv string
+	password    string
+	passwordEnv string
+}
+
+// BuildStaticCredentials parses the 'static_credentials' field of the auth
+// method config, a map of registries to objects with a 'username' or
+// 'username_env' and a 'password' or 'password_env'. It returns nil unless
+// 'allow_static_fallback' is true, but always checks the field so that
+// credentials kept in the file for emergencies stay valid.
+func BuildStaticCredentials(config map[string]interface{}) (*StaticCredentials, error) {
+	allowed := false
+
+	if raw, ok := config["allow_static_fallback"]; ok {
+		var err error
+		if allowed, err = parseutil.ParseBool(raw); err != nil {
+			return nil, errors.New("field 'auto_auth.method.config.allow_static_fallback' must be a boolean")
+		}
+	}
+
+	raw, ok := config["static_credentials"]
+	if !ok {
+		if allowed {
+			return nil, errors.New("field 'auto_auth.method.config.static_credentials' must be set " +
+				"if 'allow_static_fallback' is true")
+		}
+
+		return nil, nil
+	}
+
+	list, ok := raw.([]map[string]interface{})
+	if !ok || len(list) == 0 {
+		return nil, errors.New("field 'auto_auth.method.config.static_credentials' must be a map")
+	}
+
+	table := make(map[string]staticCredential)
+
+	for host, credsRaw := range list[0] {
+		field := fmt.Sprintf("auto_auth.method.config.static_credentials.%s", host)
+
+		registry, err := NormalizeRegistry(host)
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("field '%s' does not name a registry", field)
+		}
+
+		obj, ok := credsRaw.(map[string]interface{})
+		if objs, isList := credsRaw.([]map[string]interface{}); isList && len(objs) > 0 {
+			obj, ok = objs[0], true
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("field '%s' must be an object", field)
+		}
+
+		var creds staticCredential
+
+		for key, v := range map[string]*string{
+			"username":     &creds.username,
+			"username_env": &creds.usernameEnv,
+			"password":     &creds.password,
+			"password_env": &creds.passwordEnv,
+		} {
+			raw, ok := obj[key]
+			if !ok {
+				continue
+			}
+
+			s, ok := raw.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("field '%s.%s' must be a non-empty string", field, key)
+			}
+
+			*v = s
+		}
+
+		if (creds.username == "") == (creds.usernameEnv == "") {
+			return nil, fmt.Errorf("field '%s' must have either 'username' or 'username_env'", field)
+		}
+
+		if (creds.password == "") == (creds.passwordEnv == "") {
+			return nil, fmt.Errorf("field '%s' must have either 'password' or 'password_env'", field)
+		}
+
+		table[registry] = creds
+	}
+
+	if !allowed {
+		return nil, nil
+	}
+
+	return &StaticCredentials{registryToCreds: table}, nil
+}
+
+// Get returns the static credentials of the registry. Credentials given as
+// environment variables are read when they are needed, so that they can be
+// provided in an emergency only.
+func (s *StaticCredentials) Get(registry string) (string, string, error) {
+	registry, err := NormalizeRegistry(registry)
+	if err != nil {
+		return "", "", err
+	}
+
+	creds, ok := s.registryToCreds[registry]
+	if !ok {
+		return "", "", fmt.Errorf("no static credentials for registry %q", registry)
+	}
+
+	username, err := staticValue(creds.username, creds.usernameEnv)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err := staticValue(creds.password, creds.passwordEnv)
+	if err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// staticValue returns the inline value if it is set, or else the value of the
+// environment variable env.
+func staticValue(inline, env string) (string, error) {
+	if inline != "" {
+		return inline, nil
+	}
+
+	v := os.Getenv(env)
+	if v == "" {
+		return "", fmt.Errorf("environment variable %s is not set", env)
+	}
+
+	return v, nil
+}
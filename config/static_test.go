@@ -0,0 +1,204 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildStaticCredentials(t *testing.T) {
+	static := func(creds map[string]interface{}) []map[string]interface{} {
+		obj := make(map[string]interface{}, len(creds))
+		for registry, c := range creds {
+			obj[registry] = []map[string]interface{}{c.(map[string]interface{})}
+		}
+
+		return []map[string]interface{}{obj}
+	}
+
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		expected *StaticCredentials
+		err      string
+	}{
+		{
+			name:   "not-set",
+			config: map[string]interface{}{},
+		},
+		{
+			name: "not-allowed",
+			config: map[string]interface{}{
+				"static_credentials": static(map[string]interface{}{
+					"registry.example.com": map[string]interface{}{"username": "ci", "password": "pw"},
+				}),
+			},
+		},
+		{
+			name: "allowed",
+			config: map[string]interface{}{
+				"allow_static_fallback": "true",
+				"static_credentials": static(map[string]interface{}{
+					"Registry.Example.com": map[string]interface{}{"username": "ci", "password": "pw"},
+					"https://registry.example.com:5000": map[string]interface{}{
+						"username_env": "REGISTRY_USERNAME",
+						"password_env": "REGISTRY_PASSWORD",
+					},
+				}),
+			},
+			expected: &StaticCredentials{registryToCreds: map[string]staticCredential{
+				"registry.example.com":      {username: "ci", password: "pw"},
+				"registry.example.com:5000": {usernameEnv: "REGISTRY_USERNAME", passwordEnv: "REGISTRY_PASSWORD"},
+			}},
+		},
+		{
+			name:   "allowed-without-credentials",
+			config: map[string]interface{}{"allow_static_fallback": true},
+			err: "field 'auto_auth.method.config.static_credentials' must be set if " +
+				"'allow_static_fallback' is true",
+		},
+		{
+			name:   "invalid-flag",
+			config: map[string]interface{}{"allow_static_fallback": "sometimes"},
+			err:    "field 'auto_auth.method.config.allow_static_fallback' must be a boolean",
+		},
+		{
+			name:   "not-a-map",
+			config: map[string]interface{}{"static_credentials": "ci:pw"},
+			err:    "field 'auto_auth.method.config.static_credentials' must be a map",
+		},
+		{
+			name: "not-an-object",
+			config: map[string]interface{}{
+				"static_credentials": []map[string]interface{}{{"registry.example.com": "ci:pw"}},
+			},
+			err: "field 'auto_auth.method.config.static_credentials.registry.example.com' must be an object",
+		},
+		{
+			name: "both-inline-and-env",
+			config: map[string]interface{}{
+				"static_credentials": static(map[string]interface{}{
+					"registry.example.com": map[string]interface{}{
+						"username":     "ci",
+						"password":     "pw",
+						"password_env": "REGISTRY_PASSWORD",
+					},
+				}),
+			},
+			err: "field 'auto_auth.method.config.static_credentials.registry.example.com' must have either " +
+				"'password' or 'password_env'",
+		},
+		{
+			name: "empty-username",
+			config: map[string]interface{}{
+				"static_credentials": static(map[string]interface{}{
+					"registry.example.com": map[string]interface{}{"username": "", "password": "pw"},
+				}),
+			},
+			err: "field 'auto_auth.method.config.static_credentials.registry.example.com.username' must be " +
+				"a non-empty string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			creds, err := BuildStaticCredentials(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expected, creds, cmp.AllowUnexported(StaticCredentials{}, staticCredential{})); diff != "" {
+				t.Fatalf("Static credentials differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStaticCredentials_Get(t *testing.T) {
+	creds := &StaticCredentials{registryToCreds: map[string]staticCredential{
+		"registry.example.com":      {username: "ci", password: "pw"},
+		"registry.example.com:5000": {usernameEnv: "TEST_REGISTRY_USERNAME", passwordEnv: "TEST_REGISTRY_PASSWORD"},
+	}}
+
+	cases := []struct {
+		name     string
+		registry string
+		env      map[string]string
+		username string
+		password string
+		err      string
+	}{
+		{
+			name:     "inline",
+			registry: "https://registry.example.com/v2/",
+			username: "ci",
+			password: "pw",
+		},
+		{
+			name:     "env",
+			registry: "registry.example.com:5000",
+			env:      map[string]string{"TEST_REGISTRY_USERNAME": "env-ci", "TEST_REGISTRY_PASSWORD": "env-pw"},
+			username: "env-ci",
+			password: "env-pw",
+		},
+		{
+			name:     "env-not-set",
+			registry: "registry.example.com:5000",
+			env:      map[string]string{"TEST_REGISTRY_USERNAME": "env-ci"},
+			err:      "environment variable TEST_REGISTRY_PASSWORD is not set",
+		},
+		{
+			name:     "unknown-registry",
+			registry: "other.example.com",
+			err:      `no static credentials for registry "other.example.com"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, env := range []string{"TEST_REGISTRY_USERNAME", "TEST_REGISTRY_PASSWORD"} {
+				t.Setenv(env, tc.env[env])
+			}
+
+			username, password, err := creds.Get(tc.registry)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if username != tc.username || password != tc.password {
+				t.Fatalf("Got credentials %q/%q, expected %q/%q", username, password, tc.username, tc.password)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+vault {
+	addresses = [
+		"https://vault-1.example.com:8200",
+		{
+			address    = "https://vault-dr.example.com:8200"
+			ca_cert    = "/etc/ssl/vault-dr-ca.pem"
+			pin_sha256 = ["not-a-hash"]
+		},
+	]
+}
+
+auto_auth {
+	method "approle" {
+		mount_path = "auth/approle"
+		config = {
+			role_id_file_path   = "/tmp/role-id"
+			secret_id_file_path = "/tmp/secret-id"
+			secret              = "secret/docker/creds"
+		}
+	}
+}
@@ -0,0 +1,14 @@
+vault {
+	addresses = ["https://vault-1.example.com:8200", ""]
+}
+
+auto_auth {
+	method "approle" {
+		mount_path = "auth/approle"
+		config = {
+			role_id_file_path   = "/tmp/role-id"
+			secret_id_file_path = "/tmp/secret-id"
+			secret              = "secret/docker/creds"
+		}
+	}
+}
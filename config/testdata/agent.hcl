@@ -0,0 +1,30 @@
+pid_file = "/tmp/pidfile"
+
+vault {
+	address = "https://vault.example.com:8200"
+}
+
+auto_auth {
+	method "approle" {
+		mount_path = "auth/approle-docker"
+		wrap_ttl   = "5m"
+		config = {
+			role_id_file_path   = "/tmp/role-id"
+			secret_id_file_path = "/tmp/secret-id"
+			secrets = {
+				registry-1.example.com = "secret/docker/creds"
+				registry-2.example.com = {
+					path         = "secret/docker/extra/creds"
+					password_key = "token"
+				}
+			}
+		}
+	}
+
+	sink "file" {
+		config = {
+			path = "/tmp/foo"
+			mode = 0600
+		}
+	}
+}
@@ -0,0 +1,12 @@
+auto_auth {
+	method "aws" {
+		mount_path = "auth/aws"
+		config = {
+			type   = "iam"
+			role   = "dev-role"
+			secret = "secret/docker/creds"
+		}
+	}
+}
+
+docker_context "prod" {}
@@ -0,0 +1,18 @@
+auto_auth {
+	method "aws" {
+		mount_path = "auth/aws"
+		config = {
+			type   = "iam"
+			role   = "dev-role"
+			secret = "secret/docker/creds"
+		}
+	}
+}
+
+docker_context "prod" {
+	config_file = "contexts/prod.hcl"
+}
+
+docker_context "staging" {
+	config_file = "/etc/docker-credential-vault-login/staging.hcl"
+}
@@ -0,0 +1,10 @@
+auto_auth {
+	method "aws" {
+		mount_path = "auth/aws"
+		config = {
+			type   = "iam"
+			role   = "prod-role"
+			secret = "secret/docker/prod-creds"
+		}
+	}
+}
@@ -0,0 +1,10 @@
+auto_auth {
+	method "aws" {
+		mount_path = "auth/auth/aws-prod"
+		config = {
+			type   = "iam"
+			role   = "dev-role-iam"
+			secret = "secret/docker/creds"
+		}
+	}
+}
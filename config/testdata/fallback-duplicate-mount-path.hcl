@@ -0,0 +1,15 @@
+auto_auth {
+	method "aws" {
+		config = {
+			type   = "iam"
+			secret = "secret/docker/creds"
+		}
+	}
+
+	fallback_method "kubernetes" {
+		mount_path = "auth/auth/kubernetes-prod"
+		config = {
+			role = "dev-role"
+		}
+	}
+}
@@ -0,0 +1,14 @@
+auto_auth {
+	method "aws" {
+		config = {
+			type   = "iam"
+			secret = "secret/docker/creds"
+		}
+	}
+
+	fallback_method {
+		config = {
+			role = "dev-role"
+		}
+	}
+}
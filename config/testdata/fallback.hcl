@@ -0,0 +1,25 @@
+auto_auth {
+	method "aws" {
+		mount_path = "auth/aws"
+		config = {
+			type   = "iam"
+			role   = "dev-role"
+			secret = "secret/docker/creds"
+		}
+	}
+
+	fallback_method "kubernetes" {
+		config = {
+			role = "dev-role"
+		}
+	}
+
+	fallback_method {
+		type       = "token_file"
+		mount_path = "auth/token/"
+		namespace  = "ns1"
+		config = {
+			token_file_path = "/tmp/token"
+		}
+	}
+}
@@ -0,0 +1,3 @@
+profile "ci" {}
+
+profile "ci" {}
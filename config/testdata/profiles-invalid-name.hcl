@@ -0,0 +1,3 @@
+profile "ci/prod" {
+	registries = ["ci.registry.example.com"]
+}
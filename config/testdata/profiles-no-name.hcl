@@ -0,0 +1,3 @@
+profile {
+	registries = ["ci.registry.example.com"]
+}
@@ -0,0 +1,14 @@
+profile "ci" {
+	registries = ["ci.registry.example.com"]
+
+	auto_auth {
+		method "aws" {
+			mount_path = "auth/aws"
+			config = {
+				type   = "iam"
+				role   = "dev-role"
+				secret = "secret/docker/creds"
+			}
+		}
+	}
+}
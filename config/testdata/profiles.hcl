@@ -0,0 +1,40 @@
+vault {
+	address = "https://vault.example.com"
+}
+
+auto_auth {
+	method "aws" {
+		mount_path = "auth/aws"
+		config = {
+			type   = "iam"
+			role   = "dev-role"
+			secret = "secret/docker/creds"
+		}
+	}
+}
+
+profile "ci" {
+	registries = ["ci.registry.example.com", "https://Mirror.Example.com:5000/v2/"]
+
+	vault {
+		address = "https://vault-ci.example.com"
+	}
+}
+
+profile "prod" {
+	registries = ["registry.example.com"]
+
+	vault {
+		address = "https://vault-prod.example.com"
+	}
+
+	auto_auth {
+		method "approle" {
+			mount_path = "auth/approle"
+			config = {
+				role_id_file_path = "/tmp/role-id"
+				secret            = "secret/prod/docker/creds"
+			}
+		}
+	}
+}
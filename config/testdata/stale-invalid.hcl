@@ -0,0 +1,15 @@
+cache {
+	use_stale_on_error = true
+	max_stale          = "a while"
+}
+
+auto_auth {
+	method "approle" {
+		mount_path = "auth/approle"
+		config = {
+			role_id_file_path   = "/tmp/role-id"
+			secret_id_file_path = "/tmp/secret-id"
+			secret              = "secret/docker/creds"
+		}
+	}
+}
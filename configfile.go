@@ -0,0 +1,79 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+const envXDGConfigHome = "XDG_CONFIG_HOME"
+
+// configFile is a path at which the configuration file is searched for,
+// along with where the path comes from, for the log.
+type configFile struct {
+	path   string
+	source string
+}
+
+// configFileSearchPath returns the paths at which the configuration file
+// is searched for unless DCVL_CONFIG_FILE or -config is set, in order:
+// $XDG_CONFIG_HOME (default: ~/.config) and the system-wide default. The
+// working directory is not searched, since a configuration file there,
+// e.g. in a checked-out repository, could run commands with the exec
+// method or send logins to another Vault server.
+func configFileSearchPath() []configFile {
+	var files []configFile
+
+	if configHome := xdgConfigHome(); configHome != "" {
+		files = append(files, configFile{
+			path:   filepath.Join(configHome, "docker-credential-vault-login", "config.hcl"),
+			source: envXDGConfigHome,
+		})
+	}
+
+	return append(files, configFile{path: defaultConfigFile, source: "default"})
+}
+
+// xdgConfigHome returns the base directory of the configuration files of
+// the user, $XDG_CONFIG_HOME (default: ~/.config), or an empty string if
+// the home directory of the user is unknown.
+func xdgConfigHome() string {
+	// Relative paths are invalid according to the XDG Base Directory
+	// Specification
+	if configHome := os.Getenv(envXDGConfigHome); filepath.IsAbs(configHome) {
+		return configHome
+	}
+
+	configHome, err := homedir.Expand("~/.config")
+	if err != nil {
+		return ""
+	}
+
+	return configHome
+}
+
+// findConfigFile returns the first of the files which exists or, if none
+// does, the last one, so that the error names the system-wide default.
+func findConfigFile(files []configFile) configFile {
+	for _, file := range files {
+		if info, err := os.Stat(file.path); err == nil && !info.IsDir() {
+			return file
+		}
+	}
+
+	return files[len(files)-1]
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+func TestConfigFileSearchPath(t *testing.T) {
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	cases := []struct {
+		name       string
+		configHome string
+		expected   []configFile
+	}{
+		{
+			name:       "xdg-config-home",
+			configHome: filepath.Join(home, "xdg"),
+			expected: []configFile{
+				{path: filepath.Join(home, "xdg", "docker-credential-vault-login", "config.hcl"), source: envXDGConfigHome},
+				{path: defaultConfigFile, source: "default"},
+			},
+		},
+		{
+			name: "default-config-home",
+			expected: []configFile{
+				{path: filepath.Join(home, ".config", "docker-credential-vault-login", "config.hcl"), source: envXDGConfigHome},
+				{path: defaultConfigFile, source: "default"},
+			},
+		},
+		{
+			name:       "relative-config-home",
+			configHome: "config",
+			expected: []configFile{
+				{path: filepath.Join(home, ".config", "docker-credential-vault-login", "config.hcl"), source: envXDGConfigHome},
+				{path: defaultConfigFile, source: "default"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envXDGConfigHome, tc.configHome)
+
+			if diff := cmp.Diff(tc.expected, configFileSearchPath(), cmp.AllowUnexported(configFile{})); diff != "" {
+				t.Fatalf("Search paths differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+
+	flagFile := configFile{path: filepath.Join(dir, "config.hcl"), source: "-config"}
+	xdg := configFile{path: filepath.Join(dir, "xdg", "config.hcl"), source: envXDGConfigHome}
+	system := configFile{path: filepath.Join(dir, "etc", "config.hcl"), source: "default"}
+	files := []configFile{flagFile, xdg, system}
+
+	// A directory is not a configuration file
+	if err := os.MkdirAll(flagFile.path, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		create   string
+		expected configFile
+	}{
+		{
+			name:     "none",
+			expected: system,
+		},
+		{
+			name:     "xdg",
+			create:   xdg.path,
+			expected: xdg,
+		},
+		{
+			name:     "xdg-before-system",
+			create:   system.path,
+			expected: xdg,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.create != "" {
+				if err := os.MkdirAll(filepath.Dir(tc.create), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(tc.create, []byte("auto_auth {}"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := findConfigFile(files); got != tc.expected {
+				t.Fatalf("Expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogin"
+)
+
+// daemon holds the credential helper of a long-running process and
+// implements the operations of the admin API on it. The mutex only guards
+// the fields of the daemon, so that requests to Vault, which the helper
+// serializes where it needs to, don't wait for each other or for a reload.
+type daemon struct {
+	configFile  string
+	profile     string
+	enableCache bool
+	cacheDir    string
+	logger      hclog.Logger
+	started     time.Time
+
+	mu       sync.Mutex
+	helper   *helper.Helper
+	auth     vaultlogin.AuthSettings
+	loadedAt time.Time
+}
+
+// health is the snapshot returned by the admin API's health command.
+type health struct {
+	Version      string        `json:"version"`
+	Started      time.Time     `json:"started"`
+	ConfigFile   string        `json:"config_file"`
+	Profile      string        `json:"profile,omitempty"`
+	ConfigLoaded time.Time     `json:"config_loaded"`
+	Helper       helper.Status `json:"helper"`
+}
+
+func newDaemon(
+	h *helper.Helper,
+	cfg *vaultconfig.Config,
+	configFile string,
+	profile string,
+	enableCache bool,
+	cacheDir string,
+	logger hclog.Logger,
+) *daemon {
+	now := time.Now()
+
+	return &daemon{
+		configFile:  configFile,
+		profile:     profile,
+		enableCache: enableCache,
+		cacheDir:    cacheDir,
+		logger:      logger,
+		started:     now,
+		helper:      h,
+		auth:        vaultlogin.NewAuthSettings(cfg),
+		loadedAt:    now,
+	}
+}
+
+// current returns the current helper.
+func (d *daemon) current() *helper.Helper {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.helper
+}
+
+// Get looks up Docker credentials using the current helper.
+func (d *daemon) Get(serverURL string) (string, string, error) {
+	return d.current().Get(serverURL)
+}
+
+// Add stores credentials using the current helper.
+func (d *daemon) Add(creds *credentials.Credentials) error {
+	return d.current().Add(creds)
+}
+
+// Delete erases credentials using the current helper.
+func (d *daemon) Delete(serverURL string) error {
+	return d.current().Delete(serverURL)
+}
+
+// List lists credentials using the current helper.
+func (d *daemon) List() (map[string]string, error) {
+	return d.current().List()
+}
+
+// ProxyEnabled reports whether the current helper allows any path to be
+// read through the proxy.
+func (d *daemon) ProxyEnabled() bool {
+	return d.current().ProxyEnabled()
+}
+
+// ReadSecret reads a secret through the proxy using the current helper.
+func (d *daemon) ReadSecret(path string) (*api.Secret, error) {
+	return d.current().ReadSecret(path)
+}
+
+// PreviousSecret returns the previous version of a secret which rotated
+// using the current helper.
+func (d *daemon) PreviousSecret(path string) (map[string]interface{}, time.Time, bool) {
+	return d.current().PreviousSecret(path)
+}
+
+// Reload parses the configuration file again and replaces the helper with
+// one created from it, using the same profile. The logging and cache
+// directories are not changed. If the configuration is invalid, the
+// current helper is kept. Requests in flight are answered by the current
+// helper, and unless the settings of the configuration which determine how
+// the helper logs in changed, the new helper keeps the token of the
+// current one rather than logging in again.
+func (d *daemon) Reload() error {
+	configData, err := readConfig(d.configFile, d.profile)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.ParseConfig(configData)
+	if err != nil {
+		return xerrors.Errorf("error parsing configuration file: %w", err)
+	}
+
+	auth := vaultlogin.NewAuthSettings(cfg)
+
+	h, err := vaultlogin.NewFromConfig(cfg, configData, d.enableCache, d.cacheDir, d.logger)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	prev, prevAuth := d.helper, d.auth
+	d.mu.Unlock()
+
+	// The token is inherited without the lock, since the current helper
+	// may be logging in
+	if auth.Equal(prevAuth) {
+		h.InheritToken(prev)
+	} else {
+		d.logger.Info("authentication settings changed, logging in again")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.helper = h
+	d.auth = auth
+	d.loadedAt = time.Now()
+
+	return nil
+}
+
+// reloadOnHangup reloads the configuration of the daemon whenever the
+// process receives SIGHUP, until the context is canceled.
+func reloadOnHangup(ctx context.Context, d *daemon, logger hclog.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+
+		if err := d.Reload(); err != nil {
+			logger.Error("error reloading configuration", "error", err)
+			continue
+		}
+
+		logger.Info("reloaded configuration", "file", d.configFile)
+	}
+}
+
+// PurgeCache removes the cached secrets and token of the current helper.
+func (d *daemon) PurgeCache() error {
+	return d.current().PurgeCache()
+}
+
+// RotateToken replaces the token of the current helper with a new one.
+func (d *daemon) RotateToken(ctx context.Context) error {
+	return d.current().RotateToken(ctx)
+}
+
+// Maintain renews or replaces the token and renews the leases of the
+// cached secrets of the current helper, and returns how long to wait
+// before calling it again.
+func (d *daemon) Maintain(ctx context.Context) (time.Duration, error) {
+	return d.current().Maintain(ctx)
+}
+
+// Ready reports whether the current helper can answer requests without
+// waiting for Vault or a login.
+func (d *daemon) Ready(ctx context.Context) (bool, interface{}) {
+	readiness := d.current().Readiness(ctx)
+
+	return readiness.Ready, readiness
+}
+
+// Health returns a snapshot of the state of the daemon.
+func (d *daemon) Health() interface{} {
+	d.mu.Lock()
+	h, loadedAt := d.helper, d.loadedAt
+	d.mu.Unlock()
+
+	return health{
+		Version:      version,
+		Started:      d.started,
+		ConfigFile:   d.configFile,
+		Profile:      d.profile,
+		ConfigLoaded: loadedAt,
+		Helper:       h.Status(),
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/docker-credential-vault-login/admin"
+	"github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogin"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+const daemonConfig = `vault {
+	address = %q
+}
+
+auto_auth {
+	method "token" {
+		config = {
+			token  = %q
+			secret = %q
+		}
+	}
+}
+`
+
+func TestDaemon(t *testing.T) {
+	creds := map[string]interface{}{
+		"username": "test@user.com",
+		"password": "secure password",
+	}
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/docker/old", creds),
+		vaultlogintest.WithKVv1("secret/docker/new", creds),
+	)
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.hcl")
+	writeConfig := func(t *testing.T, secret string) {
+		data := fmt.Sprintf(daemonConfig, fake.Address(), fake.RootToken(), secret)
+		if err := os.WriteFile(configFile, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(t, "secret/docker/old")
+
+	configData, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.ParseConfig(configData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := hclog.NewNullLogger()
+
+	h, err := vaultlogin.NewFromConfig(cfg, configData, false, dir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDaemon(h, cfg, configFile, "", false, dir, logger)
+
+	get := func(t *testing.T, secret string) {
+		requests := fake.Requests(secret)
+
+		if _, _, err := d.Get(""); err != nil {
+			t.Fatal(err)
+		}
+		if n := fake.Requests(secret) - requests; n != 1 {
+			t.Fatalf("Expected 1 read of %s, got %d", secret, n)
+		}
+	}
+
+	get(t, "secret/docker/old")
+
+	t.Run("reload", func(t *testing.T) {
+		loadedAt := d.loadedAt
+		writeConfig(t, "secret/docker/new")
+
+		if err := d.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if !d.loadedAt.After(loadedAt) {
+			t.Fatal("expected the configuration to be reloaded")
+		}
+
+		get(t, "secret/docker/new")
+	})
+
+	t.Run("reload-invalid-config", func(t *testing.T) {
+		if err := os.WriteFile(configFile, []byte("auto_auth {}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.Reload(); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		// The previous helper must be kept
+		get(t, "secret/docker/new")
+	})
+
+	t.Run("health", func(t *testing.T) {
+		got, ok := d.Health().(health)
+		if !ok {
+			t.Fatalf("Expected a health snapshot, got %T", d.Health())
+		}
+		if got.ConfigFile != configFile {
+			t.Fatalf("Expected config file %q, got %q", configFile, got.ConfigFile)
+		}
+		if got.Helper.VaultAddress != fake.Address() {
+			t.Fatalf("Expected Vault address %q, got %q", fake.Address(), got.Helper.VaultAddress)
+		}
+		if got.Helper.Token == nil || got.Helper.Token.Error != "" {
+			t.Fatalf("Expected the token to be valid, got %+v", got.Helper.Token)
+		}
+	})
+
+	t.Run("slow-get", func(t *testing.T) {
+		// Other requests must not wait for a request to Vault
+		fake.InjectFaults("secret/docker/new", vaultlogintest.Latency(2*time.Second).OnRequest(1))
+		defer fake.ClearFaults("secret/docker/new")
+
+		requests := fake.Requests("secret/docker/new")
+		done := make(chan error, 1)
+
+		go func() {
+			_, _, err := d.Get("")
+			done <- err
+		}()
+
+		for deadline := time.Now().Add(time.Second); fake.Requests("secret/docker/new") == requests; {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the secret to be read")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		start := time.Now()
+		d.Health()
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("Expected the health not to wait for the read of the secret, took %s", elapsed)
+		}
+
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rotate-token", func(t *testing.T) {
+		err := d.RotateToken(context.Background())
+		if err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		expected := `tokens of the "token" auth method cannot be rotated`
+		if err.Error() != expected {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(err.Error(), expected))
+		}
+	})
+
+	t.Run("purge-cache", func(t *testing.T) {
+		if err := d.PurgeCache(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+const daemonAppRoleConfig = `vault {
+	address = %q
+}
+
+auto_auth {
+	method "approle" {
+		mount_path = "auth/approle"
+		config     = {
+			secret                              = %q
+			role_id_file_path                   = %q
+			secret_id_file_path                 = %q
+			remove_secret_id_file_after_reading = false
+		}
+	}
+}
+`
+
+func TestDaemon_ReloadToken(t *testing.T) {
+	creds := map[string]interface{}{
+		"username": "test@user.com",
+		"password": "secure password",
+	}
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/docker/old", creds),
+		vaultlogintest.WithKVv1("secret/docker/new", creds),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.hcl")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{
+		filepath.Join(dir, "role-id"):       "role-id",
+		filepath.Join(dir, "other-role-id"): "role-id",
+		secretIDFile:                        "secret-id",
+	} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig := func(t *testing.T, secret, roleIDFile string) {
+		data := fmt.Sprintf(daemonAppRoleConfig, fake.Address(), secret, filepath.Join(dir, roleIDFile), secretIDFile)
+		if err := os.WriteFile(configFile, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(t, "secret/docker/old", "role-id")
+
+	configData, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.ParseConfig(configData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := hclog.NewNullLogger()
+
+	h, err := vaultlogin.NewFromConfig(cfg, configData, false, dir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDaemon(h, cfg, configFile, "", false, dir, logger)
+
+	if _, _, err = d.Get(""); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		secret     string
+		roleIDFile string
+		logins     int
+	}{
+		{
+			name:       "secret-changed",
+			secret:     "secret/docker/new",
+			roleIDFile: "role-id",
+			logins:     0,
+		},
+		{
+			name:       "auth-changed",
+			secret:     "secret/docker/new",
+			roleIDFile: "other-role-id",
+			logins:     1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeConfig(t, tc.secret, tc.roleIDFile)
+
+			if err := d.Reload(); err != nil {
+				t.Fatal(err)
+			}
+
+			logins := fake.Requests("auth/approle/login")
+			reads := fake.Requests(tc.secret)
+
+			if _, _, err := d.Get(""); err != nil {
+				t.Fatal(err)
+			}
+			if n := fake.Requests(tc.secret) - reads; n != 1 {
+				t.Fatalf("Expected 1 read of %s, got %d", tc.secret, n)
+			}
+			if n := fake.Requests("auth/approle/login") - logins; n != tc.logins {
+				t.Fatalf("Expected %d logins, got %d", tc.logins, n)
+			}
+		})
+	}
+}
+
+// Check that the daemon can be used as the handler of the admin API and
+// as the helper served on the credential socket.
+var (
+	_ admin.Handler      = (*daemon)(nil)
+	_ credentials.Helper = (*daemon)(nil)
+)
@@ -0,0 +1,92 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+const diagnoseTimeout = 2 * time.Minute
+
+// diagnoser runs the connectivity checks of the diagnose subcommand.
+type diagnoser interface {
+	Diagnose(ctx context.Context, paths []string) []helper.Check
+}
+
+// runDiagnose checks that Vault is reachable, that the helper can log in
+// and that it may read the secrets at paths, and writes a report to out.
+func runDiagnose(d diagnoser, paths []string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	jsonFormat := flags.Bool("json", false, "print the report as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return xerrors.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	defer cancel()
+
+	return writeReport(d.Diagnose(ctx, paths), *jsonFormat, out)
+}
+
+// writeReport writes the results of the checks to out, one per line or,
+// if jsonFormat is true, as a JSON array. It returns an error if any check
+// failed.
+func writeReport(checks []helper.Check, jsonFormat bool, out io.Writer) error {
+	if jsonFormat {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(checks); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+
+	for _, check := range checks {
+		result := "ok"
+		if !check.OK {
+			result = "FAIL"
+			failed++
+		}
+
+		if jsonFormat {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(out, "%-4s  %s: %s\n", result, check.Name, check.Detail); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return xerrors.Errorf("%d of %d check(s) failed", failed, len(checks))
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+type stubDiagnoser []helper.Check
+
+func (s stubDiagnoser) Diagnose(context.Context, []string) []helper.Check {
+	return s
+}
+
+func TestRunDiagnose(t *testing.T) {
+	healthy := stubDiagnoser{
+		{Name: "vault", OK: true, Detail: "https://vault.example.com is reachable (version 1.15.4)"},
+		{Name: "secret secret/docker/creds", OK: true, Detail: "readable (capabilities: read)"},
+	}
+	unhealthy := stubDiagnoser{
+		{Name: "vault", OK: true, Detail: "https://vault.example.com is reachable (version 1.15.4)"},
+		{Name: "secret secret/docker/creds", Detail: "the token may not read the secret (capabilities: deny)"},
+	}
+
+	cases := []struct {
+		name     string
+		d        stubDiagnoser
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name: "healthy",
+			d:    healthy,
+			expected: "ok    vault: https://vault.example.com is reachable (version 1.15.4)\n" +
+				"ok    secret secret/docker/creds: readable (capabilities: read)\n",
+		},
+		{
+			name: "unhealthy",
+			d:    unhealthy,
+			expected: "ok    vault: https://vault.example.com is reachable (version 1.15.4)\n" +
+				"FAIL  secret secret/docker/creds: the token may not read the secret (capabilities: deny)\n",
+			err: "1 of 2 check(s) failed",
+		},
+		{
+			name: "json",
+			d:    unhealthy[1:],
+			args: []string{"-json"},
+			expected: `[
+  {
+    "name": "secret secret/docker/creds",
+    "ok": false,
+    "detail": "the token may not read the secret (capabilities: deny)"
+  }
+]
+`,
+			err: "1 of 1 check(s) failed",
+		},
+		{
+			name: "extra-args",
+			d:    healthy,
+			args: []string{"now"},
+			err:  "unexpected arguments: [now]",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			err := runDiagnose(tc.d, []string{"secret/docker/creds"}, tc.args, &out)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expected, out.String()); diff != "" {
+				t.Fatalf("Output differs:\n%s", diff)
+			}
+		})
+	}
+}
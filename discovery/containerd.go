@@ -0,0 +1,149 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/morningconsult/docker-credential-vault-login/internal/rawproto"
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// DefaultContainerdAddress is the socket on which containerd serves
+	// its API by default.
+	DefaultContainerdAddress = "/run/containerd/containerd.sock"
+
+	// The methods of the containerd API which are used.
+	methodListNamespaces = "/containerd.services.namespaces.v1.Namespaces/List"
+	methodListImages     = "/containerd.services.images.v1.Images/List"
+
+	// namespaceHeader names the containerd namespace of a request.
+	namespaceHeader = "containerd-namespace"
+)
+
+// ContainerdClient lists images using the containerd API. Only the small
+// part of the API needed to list the names of images is implemented, so
+// that the client of containerd is not needed.
+type ContainerdClient struct {
+	target     string
+	namespaces []string
+}
+
+// NewContainerdClient creates a new containerd API client of the socket at
+// address, or of DefaultContainerdAddress if it is empty. The images of
+// the given namespaces (e.g. "k8s.io" for the images of Kubernetes, or
+// "default" for those of nerdctl and ctr) are listed, or those of every
+// namespace if none is given.
+func NewContainerdClient(address string, namespaces []string) *ContainerdClient {
+	if address == "" {
+		address = DefaultContainerdAddress
+	}
+
+	return &ContainerdClient{
+		target:     "unix://" + strings.TrimPrefix(address, "unix://"),
+		namespaces: namespaces,
+	}
+}
+
+// Images returns the names of all images of the namespaces of the client.
+// The names of images which were pulled by digest only (e.g.
+// "sha256:...") are left out.
+func (c *ContainerdClient) Images(ctx context.Context) ([]string, error) {
+	conn, err := grpc.Dial(c.target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawproto.Codec{})),
+	)
+	if err != nil {
+		return nil, xerrors.Errorf("error connecting to containerd: %w", err)
+	}
+	defer conn.Close() // nolint: errcheck
+
+	namespaces := c.namespaces
+	if len(namespaces) == 0 {
+		if namespaces, err = listNamespaces(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	var refs []string
+
+	for _, namespace := range namespaces {
+		req := []byte{}
+
+		var resp []byte
+
+		nsCtx := metadata.AppendToOutgoingContext(ctx, namespaceHeader, namespace)
+		if err = conn.Invoke(nsCtx, methodListImages, &req, &resp); err != nil {
+			return nil, xerrors.Errorf("error listing containerd images of namespace %q: %w", namespace, err)
+		}
+
+		err = rawproto.Fields(resp, func(num protowire.Number, image []byte) error {
+			if num != 1 {
+				return nil
+			}
+
+			return rawproto.Fields(image, func(num protowire.Number, name []byte) error {
+				if num == 1 && !bytes.HasPrefix(name, []byte("sha256:")) {
+					refs = append(refs, string(name))
+				}
+
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, xerrors.Errorf("error decoding containerd images: %w", err)
+		}
+	}
+
+	return refs, nil
+}
+
+// listNamespaces returns the names of the namespaces of containerd.
+func listNamespaces(ctx context.Context, conn *grpc.ClientConn) ([]string, error) {
+	req := []byte{}
+
+	var resp []byte
+
+	if err := conn.Invoke(ctx, methodListNamespaces, &req, &resp); err != nil {
+		return nil, xerrors.Errorf("error listing containerd namespaces: %w", err)
+	}
+
+	var namespaces []string
+
+	err := rawproto.Fields(resp, func(num protowire.Number, namespace []byte) error {
+		if num != 1 {
+			return nil
+		}
+
+		return rawproto.Fields(namespace, func(num protowire.Number, name []byte) error {
+			if num == 1 {
+				namespaces = append(namespaces, string(name))
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("error decoding containerd namespaces: %w", err)
+	}
+
+	return namespaces, nil
+}
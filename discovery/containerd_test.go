@@ -0,0 +1,156 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/morningconsult/docker-credential-vault-login/internal/rawproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// serveContainerd serves the namespaces and the images of the namespaces of
+// a fake containerd on a unix socket, and returns the socket.
+func serveContainerd(t *testing.T, images map[string][]string) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every name is wrapped in a message in repeated field 1, as are the
+	// namespaces and images of the containerd API
+	list := func(names []string) []byte {
+		var resp []byte
+		for _, name := range names {
+			resp = rawproto.AppendField(resp, 1, rawproto.AppendField(nil, 1, []byte(name)))
+		}
+
+		return resp
+	}
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawproto.Codec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+
+			var req []byte
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+
+			var resp []byte
+
+			switch method {
+			case methodListNamespaces:
+				var namespaces []string
+				for namespace := range images {
+					namespaces = append(namespaces, namespace)
+				}
+
+				resp = list(namespaces)
+			case methodListImages:
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				namespace := md.Get(namespaceHeader)
+				if len(namespace) != 1 {
+					return errors.New("namespace required")
+				}
+
+				names, ok := images[namespace[0]]
+				if !ok {
+					return errors.New("namespace " + namespace[0] + " not found")
+				}
+
+				resp = list(names)
+			default:
+				return errors.New("unknown method")
+			}
+
+			return stream.SendMsg(&resp)
+		}),
+	)
+
+	go server.Serve(listener) // nolint: errcheck
+	t.Cleanup(server.Stop)
+
+	return socket
+}
+
+func TestContainerdClient_Images(t *testing.T) {
+	socket := serveContainerd(t, map[string][]string{
+		"k8s.io":  {"quay.io/org/a:1", "sha256:abcd"},
+		"default": {"docker.io/library/alpine:latest"},
+	})
+
+	cases := []struct {
+		name       string
+		address    string
+		namespaces []string
+		expected   []string
+		err        string
+	}{
+		{
+			name:       "namespace",
+			address:    socket,
+			namespaces: []string{"k8s.io"},
+			expected:   []string{"quay.io/org/a:1"},
+		},
+		{
+			name:     "every-namespace",
+			address:  "unix://" + socket,
+			expected: []string{"docker.io/library/alpine:latest", "quay.io/org/a:1"},
+		},
+		{
+			name:       "unknown-namespace",
+			address:    socket,
+			namespaces: []string{"moby"},
+			err:        `error listing containerd images of namespace "moby": `,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			images, err := NewContainerdClient(tc.address, tc.namespaces).Images(context.Background())
+			if tc.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+					t.Fatalf("Expected an error starting with %q, got %v", tc.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The namespaces are listed in no particular order
+			sort.Strings(images)
+
+			if diff := cmp.Diff(tc.expected, images); diff != "" {
+				t.Fatalf("Images differ:\n%s", diff)
+			}
+		})
+	}
+}
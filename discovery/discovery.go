@@ -0,0 +1,250 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// DockerHubServerURL is the server URL that the Docker CLI passes to
+// credential helpers for images hosted on Docker Hub.
+const DockerHubServerURL = "https://index.docker.io/v1/"
+
+const defaultInterval = time.Minute
+
+// ImageLister lists the references (e.g. "quay.io/org/image:tag") of
+// the images known to a container runtime.
+type ImageLister interface {
+	Images(ctx context.Context) ([]string, error)
+}
+
+// ImageWatcher is an ImageLister which also streams the images of
+// workloads as they are created, e.g. the pods of a Kubernetes cluster, so
+// that the credentials of new registries are prefetched before the images
+// are pulled.
+type ImageWatcher interface {
+	ImageLister
+
+	// WatchImages sends the images of every new or changed workload to
+	// images until the watch ends or the context is canceled.
+	WatchImages(ctx context.Context, images chan<- []string) error
+}
+
+// PrefetchFunc fetches (and thereby caches) the credentials of a registry.
+type PrefetchFunc func(registry string) error
+
+// WatcherOptions is used to configure a new Watcher instance.
+type WatcherOptions struct {
+	Logger   hclog.Logger
+	Lister   ImageLister
+	Prefetch PrefetchFunc
+	Interval time.Duration
+
+	// Clock, if set, schedules the prefetches. Otherwise, the clock of the
+	// system does.
+	Clock clock.Clock
+}
+
+// Watcher periodically lists the images known to a container runtime
+// and prefetches the credentials of every registry that they reference.
+type Watcher struct {
+	logger   hclog.Logger
+	lister   ImageLister
+	prefetch PrefetchFunc
+	interval time.Duration
+	clock    clock.Clock
+}
+
+// NewWatcher creates a new Watcher instance.
+func NewWatcher(opts WatcherOptions) *Watcher {
+	interval := defaultInterval
+	if opts.Interval > 0 {
+		interval = opts.Interval
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.System()
+	}
+
+	return &Watcher{
+		logger:   logger,
+		lister:   opts.Lister,
+		prefetch: opts.Prefetch,
+		interval: interval,
+		clock:    clk,
+	}
+}
+
+// Run prefetches credentials, waiting an interval after every prefetch,
+// until the context is canceled. If the lister is an ImageWatcher, the
+// credentials of the registries of new workloads are also prefetched as
+// soon as they are created, unless they were prefetched since the last
+// interval began.
+func (w *Watcher) Run(ctx context.Context) error {
+	var images chan []string
+
+	if watcher, ok := w.lister.(ImageWatcher); ok {
+		images = make(chan []string)
+		go w.watch(ctx, watcher, images)
+	}
+
+	for {
+		fetched := make(map[string]bool)
+		for _, registry := range w.Sync(ctx) {
+			fetched[registry] = true
+		}
+
+		next := w.clock.After(w.interval)
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-next:
+				break wait
+			case refs := <-images:
+				var registries []string
+
+				for _, registry := range Registries(refs) {
+					if !fetched[registry] {
+						registries = append(registries, registry)
+					}
+				}
+
+				for _, registry := range w.prefetchAll(registries) {
+					fetched[registry] = true
+				}
+			}
+		}
+	}
+}
+
+// watch runs the watch of the ImageWatcher until the context is canceled,
+// starting it again whenever it ends, or an interval after it fails.
+func (w *Watcher) watch(ctx context.Context, watcher ImageWatcher, images chan<- []string) {
+	for {
+		err := watcher.WatchImages(ctx, images)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			continue
+		}
+
+		w.logger.Error("error watching images", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.clock.After(w.interval):
+		}
+	}
+}
+
+// Sync lists the images once and prefetches the credentials of every
+// registry they reference. It returns the registries whose credentials
+// were prefetched successfully.
+func (w *Watcher) Sync(ctx context.Context) []string {
+	images, err := w.lister.Images(ctx)
+	if err != nil {
+		w.logger.Error("error listing images", "error", err)
+		return nil
+	}
+
+	return w.prefetchAll(Registries(images))
+}
+
+// prefetchAll prefetches the credentials of the registries and returns
+// those whose credentials were prefetched successfully.
+func (w *Watcher) prefetchAll(registries []string) []string {
+	var fetched []string
+
+	for _, registry := range registries {
+		if err := w.prefetch(registry); err != nil {
+			w.logger.Error("error prefetching credentials", "registry", registry, "error", err)
+			continue
+		}
+
+		w.logger.Info("prefetched credentials", "registry", registry)
+		fetched = append(fetched, registry)
+	}
+
+	return fetched
+}
+
+// Registries returns the sorted, de-duplicated set of registries
+// referenced by the given image references, formatted as the Docker CLI
+// would pass them to a credential helper.
+func Registries(images []string) []string {
+	seen := make(map[string]struct{})
+
+	for _, image := range images {
+		if registry := Registry(image); registry != "" {
+			seen[registry] = struct{}{}
+		}
+	}
+
+	registries := make([]string, 0, len(seen))
+	for registry := range seen {
+		registries = append(registries, registry)
+	}
+
+	sort.Strings(registries)
+
+	return registries
+}
+
+// Registry returns the registry referenced by an image reference using
+// the same rules as the Docker CLI: if the first path component contains
+// a "." or a ":" or is "localhost", it is the registry hostname. Otherwise,
+// the image is hosted on Docker Hub. Dangling references (e.g.
+// "<none>:<none>") yield an empty string.
+func Registry(image string) string {
+	image = strings.TrimSpace(image)
+	if image == "" || strings.HasPrefix(image, "<none>") {
+		return ""
+	}
+
+	i := strings.IndexRune(image, '/')
+	if i == -1 {
+		return DockerHubServerURL
+	}
+
+	host := image[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return DockerHubServerURL
+	}
+
+	host = strings.ToLower(host)
+	if host == "docker.io" || host == "index.docker.io" || host == "registry-1.docker.io" {
+		return DockerHubServerURL
+	}
+
+	return host
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestRegistry(t *testing.T) {
+	cases := []struct {
+		image    string
+		registry string
+	}{
+		{"alpine:3.8", DockerHubServerURL},
+		{"library/alpine", DockerHubServerURL},
+		{"docker.io/library/alpine:latest", DockerHubServerURL},
+		{"localhost/my-alpine", "localhost"},
+		{"localhost:5000/my-alpine", "localhost:5000"},
+		{"Quay.IO/org/image:tag", "quay.io"},
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com/app", "123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+		{"<none>:<none>", ""},
+		{"", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.image, func(t *testing.T) {
+			if got := Registry(tc.image); got != tc.registry {
+				t.Errorf("Expected registry %q, got %q", tc.registry, got)
+			}
+		})
+	}
+}
+
+func TestRegistries(t *testing.T) {
+	got := Registries([]string{
+		"quay.io/org/a:1",
+		"alpine",
+		"quay.io/org/b:2",
+		"localhost:5000/c",
+		"<none>:<none>",
+	})
+	expected := []string{DockerHubServerURL, "localhost:5000", "quay.io"}
+
+	if !cmp.Equal(got, expected) {
+		t.Fatalf("Registries differ:\n%v", cmp.Diff(expected, got))
+	}
+}
+
+func TestWatcher_Sync(t *testing.T) {
+	cases := []struct {
+		name    string
+		images  []string
+		listErr error
+		failing string
+		fetched []string
+	}{
+		{
+			name:    "success",
+			images:  []string{"quay.io/org/a", "localhost:5000/b"},
+			fetched: []string{"localhost:5000", "quay.io"},
+		},
+		{
+			name:    "prefetch-error",
+			images:  []string{"quay.io/org/a", "localhost:5000/b"},
+			failing: "quay.io",
+			fetched: []string{"localhost:5000"},
+		},
+		{
+			name:    "list-error",
+			listErr: errors.New("daemon unavailable"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewWatcher(WatcherOptions{
+				Lister: mockLister{images: tc.images, err: tc.listErr},
+				Prefetch: func(registry string) error {
+					if registry == tc.failing {
+						return errors.New("oops")
+					}
+					return nil
+				},
+			})
+
+			got := w.Sync(context.Background())
+			if !cmp.Equal(got, tc.fetched) {
+				t.Fatalf("Prefetched registries differ:\n%v", cmp.Diff(tc.fetched, got))
+			}
+		})
+	}
+}
+
+func TestWatcher_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int
+	w := NewWatcher(WatcherOptions{
+		Lister: mockLister{images: []string{"quay.io/org/a"}},
+		Prefetch: func(string) error {
+			calls++
+			cancel()
+			return nil
+		},
+	})
+
+	if err := w.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("Expected 1 prefetch, got %d", calls)
+	}
+}
+
+func TestWatcher_Run_Schedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewFake(time.Now())
+
+	var calls int32
+	w := NewWatcher(WatcherOptions{
+		Lister: mockLister{images: []string{"quay.io/org/a"}},
+		Prefetch: func(string) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		},
+		Interval: 5 * time.Minute,
+		Clock:    clk,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	// Simulate a day of prefetches
+	for i := 0; i < 24*12; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(5 * time.Minute)
+	}
+
+	clk.BlockUntil(1)
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 24*12+1 {
+		t.Fatalf("Expected %d prefetches, got %d", 24*12+1, n)
+	}
+}
+
+func TestWatcher_Run_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prefetched := make(chan string, 10)
+	w := NewWatcher(WatcherOptions{
+		Lister: mockWatcher{
+			mockLister: mockLister{images: []string{"quay.io/org/a"}},
+			events: [][]string{
+				{"quay.io/org/b", "ghcr.io/org/c"},
+				{"ghcr.io/org/d", "localhost:5000/e"},
+			},
+		},
+		Prefetch: func(registry string) error {
+			prefetched <- registry
+			return nil
+		},
+		Interval: time.Hour,
+		Clock:    clock.NewFake(time.Now()),
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	// The registries of the watched images are prefetched once, unless
+	// they were prefetched by the sync
+	var got []string
+	for len(got) < 3 {
+		got = append(got, <-prefetched)
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"quay.io", "ghcr.io", "localhost:5000"}
+	if !cmp.Equal(got, expected) {
+		t.Fatalf("Prefetched registries differ:\n%v", cmp.Diff(expected, got))
+	}
+
+	select {
+	case registry := <-prefetched:
+		t.Fatalf("Unexpected prefetch of %s", registry)
+	default:
+	}
+}
+
+type mockWatcher struct {
+	mockLister
+	events [][]string
+}
+
+// WatchImages sends the events once and then blocks until the context is
+// canceled.
+func (m mockWatcher) WatchImages(ctx context.Context, images chan<- []string) error {
+	for _, event := range m.events {
+		select {
+		case images <- event:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+type mockLister struct {
+	images []string
+	err    error
+}
+
+func (m mockLister) Images(context.Context) ([]string, error) {
+	return m.images, m.err
+}
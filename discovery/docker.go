@@ -0,0 +1,192 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EnvDockerHost is the environment variable used by the Docker CLI to
+	// locate the Docker daemon.
+	EnvDockerHost = "DOCKER_HOST"
+
+	defaultDockerHost = "unix:///var/run/docker.sock"
+)
+
+// identityTokenUsername is the username with which credential helpers
+// return an identity token instead of a password.
+const identityTokenUsername = "<token>"
+
+// DockerClient lists images using the Docker Engine API.
+type DockerClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewDockerClient creates a new Docker Engine API client. If host is
+// empty, the value of DOCKER_HOST is used. If that is not set either,
+// the client connects to the default Unix socket.
+func NewDockerClient(host string) (*DockerClient, error) {
+	if host == "" {
+		host = os.Getenv(EnvDockerHost)
+	}
+
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing Docker host %q: %w", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+
+		return &DockerClient{
+			baseURL:    "http://docker",
+			httpClient: &http.Client{Transport: transport},
+		}, nil
+	case "tcp", "http":
+		return &DockerClient{
+			baseURL:    "http://" + u.Host,
+			httpClient: &http.Client{},
+		}, nil
+	default:
+		return nil, xerrors.Errorf("unsupported Docker host scheme %q", u.Scheme)
+	}
+}
+
+type dockerImage struct {
+	RepoTags    []string `json:"RepoTags"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+// Images returns the tags and digests of all images known to the Docker
+// daemon.
+func (d *DockerClient) Images(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"/images/json", nil)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("error listing Docker images: %w", err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("error listing Docker images: unexpected status %s", resp.Status)
+	}
+
+	var images []dockerImage
+	if err = json.NewDecoder(resp.Body).Decode(&images); err != nil {
+		return nil, xerrors.Errorf("error JSON-decoding Docker images: %w", err)
+	}
+
+	refs := make([]string, 0, len(images))
+
+	for _, image := range images {
+		refs = append(refs, image.RepoTags...)
+
+		for _, digest := range image.RepoDigests {
+			refs = append(refs, strings.SplitN(digest, "@", 2)[0])
+		}
+	}
+
+	return refs, nil
+}
+
+// EncodeRegistryAuth encodes credentials returned by a credential helper
+// for the server as the X-Registry-Auth header of the Docker Engine API.
+func EncodeRegistryAuth(serverAddress, username, secret string) (string, error) {
+	authConfig := map[string]string{"serveraddress": serverAddress}
+
+	if username == identityTokenUsername {
+		authConfig["identitytoken"] = secret
+	} else {
+		authConfig["username"] = username
+		authConfig["password"] = secret
+	}
+
+	data, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", xerrors.Errorf("error JSON-encoding registry auth: %w", err)
+	}
+
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+// DistributionDigest asks the Docker daemon to fetch the manifest of the
+// image from its registry with the encoded registry auth, without pulling
+// the image, and returns the digest of the manifest.
+func (d *DockerClient) DistributionDigest(ctx context.Context, image, registryAuth string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		d.baseURL+"/distribution/"+image+"/json", nil)
+	if err != nil {
+		return "", xerrors.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("X-Registry-Auth", registryAuth)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", xerrors.Errorf("error inspecting distribution: %w", err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Message string `json:"message"`
+		}
+
+		if err = json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Message == "" {
+			return "", xerrors.Errorf("error inspecting distribution: unexpected status %s", resp.Status)
+		}
+
+		return "", xerrors.Errorf("error inspecting distribution: %s", body.Message)
+	}
+
+	var inspect struct {
+		Descriptor struct {
+			Digest string `json:"digest"`
+		} `json:"Descriptor"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return "", xerrors.Errorf("error JSON-decoding distribution: %w", err)
+	}
+
+	return inspect.Descriptor.Digest, nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const imagesResponse = `[
+	{"RepoTags": ["quay.io/org/a:1"], "RepoDigests": ["quay.io/org/a@sha256:abcd"]},
+	{"RepoTags": ["<none>:<none>"], "RepoDigests": []}
+]`
+
+func TestDockerClient_Images(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(imagesResponse))
+	})
+	expected := []string{"quay.io/org/a:1", "quay.io/org/a", "<none>:<none>"}
+
+	t.Run("tcp", func(t *testing.T) {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		client, err := NewDockerClient(strings.Replace(server.URL, "http://", "tcp://", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		images, err := client.Images(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(images, expected) {
+			t.Fatalf("Images differ:\n%v", cmp.Diff(expected, images))
+		}
+	})
+
+	t.Run("unix", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "docker.sock")
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewUnstartedServer(handler)
+		server.Listener = l
+		server.Start()
+		defer server.Close()
+
+		t.Setenv(EnvDockerHost, "unix://"+socket)
+
+		client, err := NewDockerClient("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		images, err := client.Images(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(images, expected) {
+			t.Fatalf("Images differ:\n%v", cmp.Diff(expected, images))
+		}
+	})
+
+	t.Run("bad-status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		client, err := NewDockerClient(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Images(context.Background())
+		expected := "error listing Docker images: unexpected status 500 Internal Server Error"
+		if err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q, got %v", expected, err)
+		}
+	})
+}
+
+func TestNewDockerClient_BadScheme(t *testing.T) {
+	_, err := NewDockerClient("npipe:////./pipe/docker_engine")
+	expected := `unsupported Docker host scheme "npipe"`
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestDockerClient_DistributionDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var auth map[string]string
+		if err = json.Unmarshal(data, &auth); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case r.URL.Path != "/distribution/registry.example.com/app:1/json":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"manifest unknown"}`))
+		case auth["password"] != "hunter2" && auth["identitytoken"] != "refresh-token":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"unauthorized: authentication required"}`))
+		default:
+			w.Write([]byte(`{"Descriptor":{"digest":"sha256:abcd"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewDockerClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		image    string
+		username string
+		secret   string
+		digest   string
+		err      string
+	}{
+		{
+			name:     "password",
+			image:    "registry.example.com/app:1",
+			username: "jdoe",
+			secret:   "hunter2",
+			digest:   "sha256:abcd",
+		},
+		{
+			name:     "identity-token",
+			image:    "registry.example.com/app:1",
+			username: "<token>",
+			secret:   "refresh-token",
+			digest:   "sha256:abcd",
+		},
+		{
+			name:     "unauthorized",
+			image:    "registry.example.com/app:1",
+			username: "jdoe",
+			secret:   "wrong",
+			err:      "error inspecting distribution: unauthorized: authentication required",
+		},
+		{
+			name:     "unknown-image",
+			image:    "registry.example.com/app:2",
+			username: "jdoe",
+			secret:   "hunter2",
+			err:      "error inspecting distribution: manifest unknown",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := EncodeRegistryAuth("registry.example.com", tc.username, tc.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			digest, err := client.DistributionDigest(context.Background(), tc.image, auth)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Expected error %q, got %v", tc.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if digest != tc.digest {
+				t.Fatalf("Expected digest %q, got %q", tc.digest, digest)
+			}
+		})
+	}
+}
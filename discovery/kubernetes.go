@@ -0,0 +1,290 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EnvNodeName is the environment variable which, by convention, holds
+	// the name of the node of a pod, as set through the downward API.
+	EnvNodeName = "NODE_NAME"
+
+	// serviceAccountDir is where the token and the CA certificate of the
+	// service account are mounted in pods.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// KubernetesOptions is used to configure a new KubernetesClient instance.
+type KubernetesOptions struct {
+	// Host is the URL of the API server. If it is empty, the address of
+	// the API server within the cluster is used.
+	Host string
+
+	// TokenFile is the file holding the bearer token of the requests. It
+	// is read before every request, since the tokens of service accounts
+	// are rotated. If it is empty, the token of the service account of
+	// the pod is used, if there is one.
+	TokenFile string
+
+	// CAFile is the file holding the CA certificates of the API server.
+	// If it is empty, the CA certificate of the service account of the
+	// pod is used, if there is one.
+	CAFile string
+
+	// NodeName, if set, restricts the pods to those scheduled on the
+	// node.
+	NodeName string
+}
+
+// KubernetesClient lists and watches the images of the containers of the
+// pods of a Kubernetes cluster.
+type KubernetesClient struct {
+	host          string
+	tokenFile     string
+	fieldSelector string
+	httpClient    *http.Client
+}
+
+// NewKubernetesClient creates a new Kubernetes API client.
+func NewKubernetesClient(opts KubernetesOptions) (*KubernetesClient, error) {
+	host := opts.Host
+	if host == "" {
+		serviceHost, servicePort := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if serviceHost == "" || servicePort == "" {
+			return nil, xerrors.New("the address of the Kubernetes API server is not set and " +
+				"the helper is not running in a Kubernetes cluster")
+		}
+
+		host = "https://" + net.JoinHostPort(serviceHost, servicePort)
+	}
+
+	if _, err := url.Parse(host); err != nil {
+		return nil, xerrors.Errorf("error parsing Kubernetes API server address %q: %w", host, err)
+	}
+
+	tokenFile := opts.TokenFile
+	if tokenFile == "" {
+		if path := filepath.Join(serviceAccountDir, "token"); fileExists(path) {
+			tokenFile = path
+		}
+	}
+
+	caFile := opts.CAFile
+	if caFile == "" {
+		if path := filepath.Join(serviceAccountDir, "ca.crt"); fileExists(path) {
+			caFile = path
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile) // nolint: gosec
+		if err != nil {
+			return nil, xerrors.Errorf("error reading Kubernetes CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, xerrors.Errorf("no CA certificate found in %s", caFile)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	client := &KubernetesClient{
+		host:       strings.TrimSuffix(host, "/"),
+		tokenFile:  tokenFile,
+		httpClient: &http.Client{Transport: transport},
+	}
+
+	if opts.NodeName != "" {
+		client.fieldSelector = "spec.nodeName=" + opts.NodeName
+	}
+
+	return client, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type pod struct {
+	Spec struct {
+		Containers          []container `json:"containers"`
+		InitContainers      []container `json:"initContainers"`
+		EphemeralContainers []container `json:"ephemeralContainers"`
+	} `json:"spec"`
+}
+
+type container struct {
+	Image string `json:"image"`
+}
+
+// images returns the images of the containers of the pod.
+func (p *pod) images() []string {
+	var images []string
+
+	for _, containers := range [][]container{p.Spec.Containers, p.Spec.InitContainers, p.Spec.EphemeralContainers} {
+		for _, c := range containers {
+			images = append(images, c.Image)
+		}
+	}
+
+	return images
+}
+
+// Images returns the images of the containers of the pods.
+func (k *KubernetesClient) Images(ctx context.Context) ([]string, error) {
+	images, _, err := k.listPods(ctx)
+	return images, err
+}
+
+// WatchImages sends the images of every pod which is created or changed
+// to images until the watch ends, which the API server does after a few
+// minutes, or the context is canceled.
+func (k *KubernetesClient) WatchImages(ctx context.Context, images chan<- []string) error {
+	// The watch starts from the version of the list, so that no pod is
+	// missed in between
+	_, resourceVersion, err := k.listPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.get(ctx, url.Values{"watch": {"1"}, "resourceVersion": {resourceVersion}})
+	if err != nil {
+		return xerrors.Errorf("error watching Kubernetes pods: %w", err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	dec := json.NewDecoder(resp.Body)
+
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+
+		if err = dec.Decode(&event); err != nil {
+			if xerrors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+
+			return xerrors.Errorf("error JSON-decoding Kubernetes pod event: %w", err)
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+		case "ERROR":
+			var status struct {
+				Message string `json:"message"`
+			}
+
+			_ = json.Unmarshal(event.Object, &status) // nolint: errcheck
+
+			return xerrors.Errorf("error watching Kubernetes pods: %s", status.Message)
+		default:
+			continue
+		}
+
+		var p pod
+		if err = json.Unmarshal(event.Object, &p); err != nil {
+			return xerrors.Errorf("error JSON-decoding Kubernetes pod: %w", err)
+		}
+
+		select {
+		case images <- p.images():
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// listPods returns the images of the containers of the pods and the
+// resource version of the list.
+func (k *KubernetesClient) listPods(ctx context.Context) ([]string, string, error) {
+	resp, err := k.get(ctx, url.Values{})
+	if err != nil {
+		return nil, "", xerrors.Errorf("error listing Kubernetes pods: %w", err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []pod `json:"items"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", xerrors.Errorf("error JSON-decoding Kubernetes pods: %w", err)
+	}
+
+	var images []string
+	for i := range list.Items {
+		images = append(images, list.Items[i].images()...)
+	}
+
+	return images, list.Metadata.ResourceVersion, nil
+}
+
+// get requests the pods of the client with the query.
+func (k *KubernetesClient) get(ctx context.Context, query url.Values) (*http.Response, error) {
+	if k.fieldSelector != "" {
+		query.Set("fieldSelector", k.fieldSelector)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.host+"/api/v1/pods?"+query.Encode(), nil)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating request: %w", err)
+	}
+
+	if k.tokenFile != "" {
+		token, err := os.ReadFile(k.tokenFile) // nolint: gosec
+		if err != nil {
+			return nil, xerrors.Errorf("error reading Kubernetes token: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close() // nolint: errcheck, gosec
+		return nil, xerrors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	podsResponse = `{
+	"metadata": {"resourceVersion": "42"},
+	"items": [
+		{"spec": {
+			"initContainers": [{"image": "quay.io/org/init:1"}],
+			"containers": [{"image": "alpine:3.8"}, {"image": "quay.io/org/a:1"}]
+		}}
+	]
+}`
+
+	podEvents = `{"type": "ADDED", "object": {"spec": {"containers": [{"image": "ghcr.io/org/b:2"}]}}}
+{"type": "DELETED", "object": {"spec": {"containers": [{"image": "ghcr.io/org/c:3"}]}}}
+{"type": "MODIFIED", "object": {"spec": {"ephemeralContainers": [{"image": "busybox"}]}}}
+`
+)
+
+// serveKubernetes serves the pods of a fake Kubernetes API server, which
+// requires the token, and the events of pods to watches from version 42.
+func serveKubernetes(t *testing.T, token, events string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch {
+		case r.URL.Path != "/api/v1/pods":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Authorization") != "Bearer "+token:
+			w.WriteHeader(http.StatusUnauthorized)
+		case query.Get("fieldSelector") != "spec.nodeName=node-1":
+			w.WriteHeader(http.StatusBadRequest)
+		case query.Get("watch") == "":
+			w.Write([]byte(podsResponse))
+		case query.Get("resourceVersion") != "42":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.Write([]byte(events))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestKubernetesClient(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("kube-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		events   string
+		images   []string
+		watched  [][]string
+		err      string
+		watchErr string
+	}{
+		{
+			name:    "success",
+			token:   "kube-token",
+			events:  podEvents,
+			images:  []string{"alpine:3.8", "quay.io/org/a:1", "quay.io/org/init:1"},
+			watched: [][]string{{"ghcr.io/org/b:2"}, {"busybox"}},
+		},
+		{
+			name:     "watch-error",
+			token:    "kube-token",
+			events:   `{"type": "ERROR", "object": {"message": "too old resource version"}}`,
+			images:   []string{"alpine:3.8", "quay.io/org/a:1", "quay.io/org/init:1"},
+			watchErr: "error watching Kubernetes pods: too old resource version",
+		},
+		{
+			name:     "unauthorized",
+			token:    "other-token",
+			err:      "error listing Kubernetes pods: unexpected status 401 Unauthorized",
+			watchErr: "error listing Kubernetes pods: unexpected status 401 Unauthorized",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := serveKubernetes(t, tc.token, tc.events)
+
+			client, err := NewKubernetesClient(KubernetesOptions{
+				Host:      server.URL,
+				TokenFile: tokenFile,
+				NodeName:  "node-1",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			images, err := client.Images(context.Background())
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Expected error %q, got %v", tc.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.images, images); diff != "" {
+				t.Fatalf("Images differ:\n%s", diff)
+			}
+
+			events := make(chan []string, 10)
+
+			err = client.WatchImages(context.Background(), events)
+			if tc.watchErr != "" {
+				if err == nil || err.Error() != tc.watchErr {
+					t.Fatalf("Expected error %q, got %v", tc.watchErr, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			close(events)
+
+			var watched [][]string
+			for images := range events {
+				watched = append(watched, images)
+			}
+
+			if diff := cmp.Diff(tc.watched, watched); diff != "" {
+				t.Fatalf("Watched images differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewKubernetesClient_NotInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	_, err := NewKubernetesClient(KubernetesOptions{})
+	expected := "the address of the Kubernetes API server is not set and " +
+		"the helper is not running in a Kubernetes cluster"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %q, got %v", expected, err)
+	}
+}
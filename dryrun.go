@@ -0,0 +1,79 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+const envDryRun = "DCVL_DRY_RUN"
+
+// dryRunner looks up credentials without returning them.
+type dryRunner interface {
+	DryRun(serverURL string) (*helper.DryRun, error)
+}
+
+// dryRunEnabled reports whether the get action should be a dry run, as
+// requested by the -dry-run flag or the DCVL_DRY_RUN environment variable.
+func dryRunEnabled(dryRun bool) (bool, error) {
+	if v := os.Getenv(envDryRun); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, xerrors.Errorf("value of %s could not be converted to boolean", envDryRun)
+		}
+
+		dryRun = dryRun || b
+	}
+
+	return dryRun, nil
+}
+
+// runDryRun runs the get action named by args with the server URL read
+// from in like serveProtocol, but writes a report of the request to out in
+// place of the credentials, so that it can be debugged without leaking
+// them. It returns the error of the request, if any.
+func runDryRun(d dryRunner, args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 1 || args[0] != credentials.ActionGet {
+		return xerrors.New("-dry-run is only supported by the get action")
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Scan()
+
+	serverURL := strings.TrimSpace(scanner.Text())
+	if serverURL == "" {
+		return credentials.NewErrCredentialsMissingServerURL()
+	}
+
+	report, err := d.DryRun(serverURL)
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	if encErr := enc.Encode(report); encErr != nil {
+		return encErr
+	}
+
+	return err
+}
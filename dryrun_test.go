@@ -0,0 +1,161 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+type stubDryRunner struct{}
+
+func (stubDryRunner) DryRun(serverURL string) (*helper.DryRun, error) {
+	report := &helper.DryRun{Registry: serverURL, Duration: "12ms"}
+
+	if serverURL != "registry.example.com" {
+		report.Error = "no secret configured"
+		return report, credentials.NewErrCredentialsNotFound()
+	}
+
+	report.Path = "secret/docker/creds"
+	report.Source = "vault"
+	report.Keys = []string{"password", "username"}
+	report.UsernamePresent = true
+	report.PasswordPresent = true
+	report.LeaseTTL = 3600
+
+	return report, nil
+}
+
+func TestRunDryRun(t *testing.T) {
+	cases := []struct {
+		name   string
+		args   []string
+		input  string
+		output string
+		err    string
+	}{
+		{
+			name:  "get",
+			args:  []string{"get"},
+			input: "registry.example.com\n",
+			output: `{
+  "registry": "registry.example.com",
+  "path": "secret/docker/creds",
+  "source": "vault",
+  "keys": [
+    "password",
+    "username"
+  ],
+  "username_present": true,
+  "password_present": true,
+  "lease_ttl_seconds": 3600,
+  "duration": "12ms"
+}
+`,
+		},
+		{
+			name:  "get-not-found",
+			args:  []string{"get"},
+			input: "other.example.com",
+			output: `{
+  "registry": "other.example.com",
+  "username_present": false,
+  "password_present": false,
+  "duration": "12ms",
+  "error": "no secret configured"
+}
+`,
+			err: "credentials not found in native keychain",
+		},
+		{
+			name: "get-no-server-url",
+			args: []string{"get"},
+			err:  "no credentials server URL",
+		},
+		{
+			name:  "store",
+			args:  []string{"store"},
+			input: `{"ServerURL":"registry.example.com","Username":"user","Secret":"secret"}`,
+			err:   "-dry-run is only supported by the get action",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			err := runDryRun(stubDryRunner{}, tc.args, strings.NewReader(tc.input), &out)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.output, out.String()); diff != "" {
+				t.Fatalf("Outputs differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDryRunEnabled(t *testing.T) {
+	cases := []struct {
+		name     string
+		flag     bool
+		env      string
+		expected bool
+		err      string
+	}{
+		{name: "default"},
+		{name: "flag", flag: true, expected: true},
+		{name: "env", env: "1", expected: true},
+		{name: "env-false", flag: true, env: "false", expected: true},
+		{name: "env-invalid", env: "maybe", err: "value of DCVL_DRY_RUN could not be converted to boolean"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envDryRun, tc.env)
+
+			dryRun, err := dryRunEnabled(tc.flag)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dryRun != tc.expected {
+				t.Fatalf("Expected %v, got %v", tc.expected, dryRun)
+			}
+		})
+	}
+}
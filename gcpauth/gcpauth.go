@@ -0,0 +1,226 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package gcpauth implements the small part of the Google Cloud client
+// libraries needed to log in to Google Container Registry and Artifact
+// Registry: minting OAuth access tokens with a service account key.
+package gcpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+const (
+	// DefaultTokenURL is the OAuth token endpoint of Google.
+	DefaultTokenURL = "https://oauth2.googleapis.com/token"
+
+	// Scope is the OAuth scope of the access tokens, which covers both
+	// Container Registry and Artifact Registry.
+	Scope = "https://www.googleapis.com/auth/cloud-platform"
+
+	// RegistryUsername is the username with which Docker logs in to a
+	// registry with an access token.
+	RegistryUsername = "oauth2accesstoken"
+
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	tokenLifetime      = time.Hour
+	httpTimeout        = 10 * time.Second
+)
+
+// ServiceAccountKey is the part of a JSON service account key needed to
+// mint access tokens.
+type ServiceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// Token is an OAuth access token.
+type Token struct {
+	AccessToken string
+	Expires     time.Time
+}
+
+// IsRegistryHost reports whether host is the host of a Container Registry
+// (gcr.io or one of its regional hosts) or Artifact Registry repository.
+// The host may include a scheme, a port and a path, as the server URLs
+// given by Docker do.
+func IsRegistryHost(host string) bool {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	host, _, _ = strings.Cut(host, ":")
+
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") ||
+		strings.HasSuffix(host, "-docker.pkg.dev")
+}
+
+// ParseServiceAccountKey parses a JSON service account key.
+func ParseServiceAccountKey(data []byte) (ServiceAccountKey, error) {
+	var key ServiceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return ServiceAccountKey{}, fmt.Errorf("error decoding service account key: %w", err)
+	}
+
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return ServiceAccountKey{}, errors.New("service account key has no client_email or private_key")
+	}
+
+	return key, nil
+}
+
+// AccessToken exchanges a JWT signed with the service account key for an
+// access token at the token endpoint of the key or, if it has none, at
+// DefaultTokenURL. If client is nil, a client with a short timeout is used.
+// The JWT is issued at the time of clk or, if it is nil, of the system
+// clock.
+func AccessToken(ctx context.Context, client *http.Client, clk clock.Clock, key ServiceAccountKey) (Token, error) {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+
+	if clk == nil {
+		clk = clock.System()
+	}
+
+	tokenURL := key.TokenURI
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+
+	now := clk.Now()
+
+	assertion, err := signJWT(key, tokenURL, now)
+	if err != nil {
+		return Token{}, err
+	}
+
+	form := url.Values{
+		"grant_type": {jwtBearerGrantType},
+		"assertion":  {assertion},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("error requesting access token: %w", err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("error reading token response: %w", err)
+	}
+
+	var out struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err = json.Unmarshal(body, &out); err != nil {
+		return Token{}, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK || out.AccessToken == "" {
+		if out.Error == "" {
+			return Token{}, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+		}
+
+		return Token{}, fmt.Errorf("token endpoint returned status %d: %s: %s", resp.StatusCode,
+			out.Error, out.ErrorDescription)
+	}
+
+	return Token{
+		AccessToken: out.AccessToken,
+		Expires:     now.Add(time.Duration(out.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// signJWT returns a JWT asserting the identity of the service account to
+// the token endpoint, signed with its private key.
+func signJWT(key ServiceAccountKey, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", errors.New("private key of service account is not PEM-encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("error parsing private key of service account: %w", err)
+		}
+	}
+
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("private key of service account is not an RSA key")
+	}
+
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if key.PrivateKeyID != "" {
+		header["kid"] = key.PrivateKeyID
+	}
+
+	claims := map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": Scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	}
+
+	var segments []string
+
+	for _, v := range []interface{}{header, claims} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+
+		segments = append(segments, base64.RawURLEncoding.EncodeToString(b))
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(segments, ".")))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing JWT: %w", err)
+	}
+
+	return strings.Join(append(segments, base64.RawURLEncoding.EncodeToString(signature)), "."), nil
+}
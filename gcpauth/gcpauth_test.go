@@ -0,0 +1,199 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gcpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestIsRegistryHost(t *testing.T) {
+	cases := map[string]bool{
+		"gcr.io":                             true,
+		"https://eu.gcr.io/v2/":              true,
+		"europe-west1-docker.pkg.dev":        true,
+		"us-docker.pkg.dev:443":              true,
+		"docker.io":                          false,
+		"gcr.io.example.com":                 false,
+		"123456789012.dkr.ecr.amazonaws.com": false,
+	}
+
+	for host, expected := range cases {
+		if got := IsRegistryHost(host); got != expected {
+			t.Errorf("IsRegistryHost(%q) = %v, expected %v", host, got, expected)
+		}
+	}
+}
+
+func TestParseServiceAccountKey(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{
+			name: "valid",
+			data: `{"client_email":"ci@project.iam.gserviceaccount.com","private_key":"key"}`,
+		},
+		{
+			name: "missing-key",
+			data: `{"client_email":"ci@project.iam.gserviceaccount.com"}`,
+			err:  "service account key has no client_email or private_key",
+		},
+		{
+			name: "not-json",
+			data: `key`,
+			err:  "error decoding service account key: invalid character 'k' looking for beginning of value",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseServiceAccountKey([]byte(tc.data))
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+			}
+		})
+	}
+}
+
+// newTestKey returns a service account key with a new private key whose
+// tokens are requested from tokenURL.
+func newTestKey(t *testing.T, tokenURL string) (ServiceAccountKey, *rsa.PublicKey) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ServiceAccountKey{
+		ClientEmail:  "ci@project.iam.gserviceaccount.com",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		PrivateKeyID: "key-id",
+		TokenURI:     tokenURL,
+	}, &privateKey.PublicKey
+}
+
+func TestAccessToken(t *testing.T) {
+	var publicKey *rsa.PublicKey
+
+	clk := clock.NewFake(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if grantType := r.PostForm.Get("grant_type"); grantType != jwtBearerGrantType {
+			t.Errorf("Expected grant type %q, got %q", jwtBearerGrantType, grantType)
+		}
+
+		segments := strings.Split(r.PostForm.Get("assertion"), ".")
+		if len(segments) != 3 {
+			t.Fatalf("Expected a JWT, got %q", r.PostForm.Get("assertion"))
+		}
+
+		signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+		if err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Errorf("Invalid JWT signature: %v", err)
+		}
+
+		payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var claims map[string]interface{}
+		if err = json.Unmarshal(payload, &claims); err != nil {
+			t.Fatal(err)
+		}
+
+		if claims["iss"] != "ci@project.iam.gserviceaccount.com" || claims["scope"] != Scope ||
+			claims["aud"] != "http://"+r.Host+"/token" || claims["iat"] != float64(clk.Now().Unix()) {
+			t.Errorf("Unexpected claims %v", claims)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	key, pub := newTestKey(t, server.URL+"/token")
+	publicKey = pub
+
+	token, err := AccessToken(context.Background(), server.Client(), clk, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "ya29.token" {
+		t.Fatalf("Expected access token %q, got %q", "ya29.token", token.AccessToken)
+	}
+
+	if expected := clk.Now().Add(3599 * time.Second); !token.Expires.Equal(expected) {
+		t.Fatalf("Expected the token to expire at %s, got %s", expected, token.Expires)
+	}
+}
+
+func TestAccessToken_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Invalid JWT Signature."}`)
+	}))
+	defer server.Close()
+
+	key, _ := newTestKey(t, server.URL)
+
+	_, err := AccessToken(context.Background(), server.Client(), nil, key)
+
+	expected := "token endpoint returned status 400: invalid_grant: Invalid JWT Signature."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, fmt.Sprint(err)))
+	}
+}
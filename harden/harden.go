@@ -0,0 +1,81 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package harden protects the secrets which the helper holds: it locks the
+// memory of the process so that it is never swapped to disk, zeroes the
+// buffers in which secrets are written and keeps secrets out of the log.
+package harden
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-secure-stdlib/mlock"
+)
+
+// ErrLockUnsupported is returned by LockMemory on platforms on which the
+// memory of the process cannot be locked, such as macOS and Windows.
+var ErrLockUnsupported = errors.New("locking memory is not supported on this platform")
+
+// LockMemory locks all current and future memory of the process, so that
+// no secret is ever swapped to disk. This requires the IPC_LOCK capability
+// or a large enough RLIMIT_MEMLOCK.
+func LockMemory() error {
+	if !mlock.Supported() {
+		return ErrLockUnsupported
+	}
+
+	if err := mlock.LockMemory(); err != nil {
+		return fmt.Errorf("error locking memory: %w", err)
+	}
+
+	return nil
+}
+
+// Zero overwrites b with zeros.
+func Zero(b []byte) {
+	clear(b)
+}
+
+// Buffer accumulates what is written to it, like bytes.Buffer, but zeroes
+// the memory which it outgrows so that no copy of its contents is left
+// behind. Its contents should be zeroed with Zero once they are used.
+type Buffer struct {
+	buf []byte
+}
+
+// Write appends p to the buffer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	if len(b.buf)+len(p) > cap(b.buf) {
+		grown := make([]byte, len(b.buf), 2*cap(b.buf)+len(p))
+		copy(grown, b.buf)
+		Zero(b.buf)
+		b.buf = grown
+	}
+
+	b.buf = append(b.buf, p...)
+
+	return len(p), nil
+}
+
+// Bytes returns the contents of the buffer, which are only valid until the
+// buffer is written to or zeroed.
+func (b *Buffer) Bytes() []byte {
+	return b.buf
+}
+
+// Zero zeroes the contents of the buffer and empties it.
+func (b *Buffer) Zero() {
+	Zero(b.buf[:cap(b.buf)])
+	b.buf = b.buf[:0]
+}
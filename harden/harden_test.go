@@ -0,0 +1,59 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package harden
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	var b Buffer
+
+	if _, err := b.Write([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	outgrown := b.Bytes()
+
+	if _, err := b.Write(bytes.Repeat([]byte("s"), 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "secret" + string(bytes.Repeat([]byte("s"), 64)); string(b.Bytes()) != expected {
+		t.Fatalf("Expected %q, got %q", expected, b.Bytes())
+	}
+	if !bytes.Equal(outgrown, make([]byte, len(outgrown))) {
+		t.Fatalf("Expected the outgrown memory to be zeroed, got %q", outgrown)
+	}
+
+	contents := b.Bytes()
+	b.Zero()
+
+	if len(b.Bytes()) != 0 {
+		t.Fatalf("Expected the buffer to be empty, got %q", b.Bytes())
+	}
+	if !bytes.Equal(contents, make([]byte, len(contents))) {
+		t.Fatalf("Expected the contents to be zeroed, got %q", contents)
+	}
+}
+
+func TestZero(t *testing.T) {
+	b := []byte("secret")
+	Zero(b)
+
+	if !bytes.Equal(b, make([]byte, 6)) {
+		t.Fatalf("Expected zeros, got %q", b)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package harden
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Redacted replaces the secrets scrubbed from the log.
+const Redacted = "[REDACTED]"
+
+// Scrubber redacts the secrets registered with it. A nil Scrubber redacts
+// nothing.
+type Scrubber struct {
+	mu       sync.RWMutex
+	secrets  map[string]bool
+	replacer *strings.Replacer
+}
+
+// NewScrubber creates a Scrubber with no secrets.
+func NewScrubber() *Scrubber {
+	return &Scrubber{secrets: make(map[string]bool)}
+}
+
+// Add registers secrets, which are redacted from then on. Empty secrets are
+// ignored.
+func (s *Scrubber) Add(secrets ...string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := false
+
+	for _, secret := range secrets {
+		if secret != "" && !s.secrets[secret] {
+			s.secrets[secret] = true
+			added = true
+		}
+	}
+
+	if !added {
+		return
+	}
+
+	pairs := make([]string, 0, 2*len(s.secrets))
+	for secret := range s.secrets {
+		pairs = append(pairs, secret, Redacted)
+	}
+
+	s.replacer = strings.NewReplacer(pairs...)
+}
+
+// Scrub returns text with every registered secret redacted.
+func (s *Scrubber) Scrub(text string) string {
+	if s == nil {
+		return text
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.replacer == nil {
+		return text
+	}
+
+	return s.replacer.Replace(text)
+}
+
+// Logger returns a logger which logs through logger with the registered
+// secrets redacted from the messages and the values of their fields.
+func (s *Scrubber) Logger(logger hclog.Logger) hclog.Logger {
+	if s == nil {
+		return logger
+	}
+
+	return &scrubLogger{Logger: logger, scrubber: s}
+}
+
+// scrubLogger redacts the secrets of its scrubber from what it logs.
+type scrubLogger struct {
+	hclog.Logger
+	scrubber *Scrubber
+}
+
+func (l *scrubLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	l.Logger.Log(level, l.scrubber.Scrub(msg), l.scrubArgs(args)...)
+}
+
+func (l *scrubLogger) Trace(msg string, args ...interface{}) {
+	l.Logger.Trace(l.scrubber.Scrub(msg), l.scrubArgs(args)...)
+}
+
+func (l *scrubLogger) Debug(msg string, args ...interface{}) {
+	l.Logger.Debug(l.scrubber.Scrub(msg), l.scrubArgs(args)...)
+}
+
+func (l *scrubLogger) Info(msg string, args ...interface{}) {
+	l.Logger.Info(l.scrubber.Scrub(msg), l.scrubArgs(args)...)
+}
+
+func (l *scrubLogger) Warn(msg string, args ...interface{}) {
+	l.Logger.Warn(l.scrubber.Scrub(msg), l.scrubArgs(args)...)
+}
+
+func (l *scrubLogger) Error(msg string, args ...interface{}) {
+	l.Logger.Error(l.scrubber.Scrub(msg), l.scrubArgs(args)...)
+}
+
+func (l *scrubLogger) With(args ...interface{}) hclog.Logger {
+	return &scrubLogger{Logger: l.Logger.With(l.scrubArgs(args)...), scrubber: l.scrubber}
+}
+
+func (l *scrubLogger) Named(name string) hclog.Logger {
+	return &scrubLogger{Logger: l.Logger.Named(name), scrubber: l.scrubber}
+}
+
+func (l *scrubLogger) ResetNamed(name string) hclog.Logger {
+	return &scrubLogger{Logger: l.Logger.ResetNamed(name), scrubber: l.scrubber}
+}
+
+func (l *scrubLogger) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	return log.New(l.StandardWriter(opts), "", 0)
+}
+
+func (l *scrubLogger) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	return &scrubWriter{w: l.Logger.StandardWriter(opts), scrubber: l.scrubber}
+}
+
+// scrubArgs returns the fields of a message with the registered secrets
+// redacted from the values which are formatted as text. Values which
+// contain no secret are left as they are, so that they are formatted as
+// usual.
+func (l *scrubLogger) scrubArgs(args []interface{}) []interface{} {
+	scrubbed := make([]interface{}, len(args))
+
+	for i, arg := range args {
+		scrubbed[i] = arg
+
+		switch arg.(type) {
+		case string, error, fmt.Stringer:
+			text := fmt.Sprint(arg)
+			if s := l.scrubber.Scrub(text); s != text {
+				scrubbed[i] = s
+			}
+		}
+	}
+
+	return scrubbed
+}
+
+// scrubWriter redacts the secrets of its scrubber from what is written to
+// w.
+type scrubWriter struct {
+	w        io.Writer
+	scrubber *Scrubber
+}
+
+func (w *scrubWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.scrubber.Scrub(string(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package harden
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestScrubber_Logger(t *testing.T) {
+	cases := []struct {
+		name     string
+		scrubber *Scrubber
+		log      func(hclog.Logger)
+		expected string
+	}{
+		{
+			name:     "message",
+			scrubber: NewScrubber(),
+			log: func(logger hclog.Logger) {
+				logger.Error("password s3cr3t was rejected")
+			},
+			expected: "[ERROR] password [REDACTED] was rejected\n",
+		},
+		{
+			name:     "fields",
+			scrubber: NewScrubber(),
+			log: func(logger hclog.Logger) {
+				logger.Warn("error reading secret", "error", errors.New("bad token s.token"), "count", 2)
+			},
+			expected: "[WARN]  error reading secret: error=\"bad token [REDACTED]\" count=2\n",
+		},
+		{
+			name:     "named-with",
+			scrubber: NewScrubber(),
+			log: func(logger hclog.Logger) {
+				logger.Named("cache").With("secret", "s3cr3t").Info("stored")
+			},
+			expected: "[INFO]  cache: stored: secret=[REDACTED]\n",
+		},
+		{
+			name:     "standard-logger",
+			scrubber: NewScrubber(),
+			log: func(logger hclog.Logger) {
+				logger.StandardLogger(&hclog.StandardLoggerOptions{ForceLevel: hclog.Error}).Print("s3cr3t")
+			},
+			expected: "[ERROR] [REDACTED]\n",
+		},
+		{
+			name: "nil",
+			log: func(logger hclog.Logger) {
+				logger.Error("password s3cr3t was rejected")
+			},
+			expected: "[ERROR] password s3cr3t was rejected\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			tc.scrubber.Add("s3cr3t", "s.token", "")
+
+			tc.log(tc.scrubber.Logger(hclog.New(&hclog.LoggerOptions{
+				Output:      &out,
+				Level:       hclog.Trace,
+				DisableTime: true,
+			})))
+
+			if diff := cmp.Diff(tc.expected, out.String()); diff != "" {
+				t.Fatalf("Logs differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestScrubber_Scrub(t *testing.T) {
+	s := NewScrubber()
+
+	if text := s.Scrub("nothing to hide"); text != "nothing to hide" {
+		t.Fatalf("Expected the text to be unchanged, got %q", text)
+	}
+
+	s.Add("hunter2", "hunter2")
+	s.Add("swordfish")
+
+	text := s.Scrub("hunter2 and swordfish")
+	if strings.Contains(text, "hunter2") || strings.Contains(text, "swordfish") {
+		t.Fatalf("Expected the secrets to be redacted, got %q", text)
+	}
+	if text != "[REDACTED] and [REDACTED]" {
+		t.Fatalf("Expected %q, got %q", "[REDACTED] and [REDACTED]", text)
+	}
+}
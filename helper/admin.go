@@ -0,0 +1,170 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/imds"
+)
+
+// Status is a snapshot of the state of a Helper.
+type Status struct {
+	VaultAddress  string       `json:"vault_address"`
+	AuthMethod    string       `json:"auth_method"`
+	Token         *TokenStatus `json:"token,omitempty"`
+	CachedSecrets int          `json:"cached_secrets"`
+
+	// Rotations lists the most recent rotation of every secret which
+	// rotated while the helper was running.
+	Rotations []RotationStatus `json:"rotations,omitempty"`
+}
+
+// TokenStatus describes the token currently held by a Helper.
+type TokenStatus struct {
+	Accessor  string `json:"accessor,omitempty"`
+	TTL       int64  `json:"ttl_seconds"`
+	Renewable bool   `json:"renewable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Status looks up the token currently held by the helper and returns a
+// snapshot of the helper's state.
+func (h *Helper) Status() Status {
+	status := Status{
+		VaultAddress: h.client.Address(),
+		AuthMethod:   h.authConfig.Method.Type,
+		Rotations:    h.rotations.status(),
+	}
+
+	if h.secretCache != nil {
+		status.CachedSecrets = h.secretCache.Len()
+	}
+
+	if h.ttlCache != nil {
+		status.CachedSecrets += h.ttlCache.Len()
+	}
+
+	if h.client.Token() == "" {
+		return status
+	}
+
+	status.Token = &TokenStatus{}
+
+	secret, err := h.client.Auth().Token().LookupSelf()
+	if err != nil {
+		status.Token.Error = err.Error()
+		return status
+	}
+
+	status.Token.Accessor, _ = secret.TokenAccessor()
+	status.Token.Renewable, _ = secret.TokenIsRenewable()
+
+	if ttl, err := secret.TokenTTL(); err == nil {
+		status.Token.TTL = int64(ttl.Seconds())
+	}
+
+	return status
+}
+
+// PurgeCache removes every cached secret and cloud metadata and forgets
+// the token which the helper obtained itself, including the one in the
+// token cache, so that the next call to Get re-authenticates.
+// Tokens cached in the sinks are left alone.
+func (h *Helper) PurgeCache() error {
+	if h.secretCache != nil {
+		if err := h.secretCache.Purge(); err != nil {
+			return xerrors.Errorf("error purging secret cache: %w", err)
+		}
+	}
+
+	if h.ttlCache != nil {
+		if err := h.ttlCache.Purge(); err != nil {
+			return xerrors.Errorf("error purging secret cache: %w", err)
+		}
+	}
+
+	if h.staleCache != nil {
+		if err := h.staleCache.Purge(); err != nil {
+			return xerrors.Errorf("error purging stale cache: %w", err)
+		}
+	}
+
+	if h.coalesceCache != nil {
+		if err := h.coalesceCache.Purge(); err != nil {
+			return xerrors.Errorf("error purging coalesce cache: %w", err)
+		}
+	}
+
+	if h.tokenCache != nil {
+		if err := h.tokenCache.Delete(tokenCacheKey); err != nil {
+			return xerrors.Errorf("error purging token cache: %w", err)
+		}
+	}
+
+	h.proxyCache.purge()
+	imds.Default.Purge()
+
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+
+	if h.authToken != "" && h.client.Token() == h.authToken {
+		h.client.ClearToken()
+	}
+
+	h.authToken = ""
+
+	return nil
+}
+
+// RotateToken authenticates to Vault, caches the new token in the sinks if
+// caching is enabled, and revokes the token which the helper previously
+// obtained itself. Tokens provided by the user or by a Vault agent cannot
+// be rotated.
+func (h *Helper) RotateToken(ctx context.Context) error {
+	switch h.authConfig.Method.Type {
+	case "token", agentMethod, agentProxyMethod:
+		return xerrors.Errorf("tokens of the %q auth method cannot be rotated", h.authConfig.Method.Type)
+	}
+
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+
+	previous := h.authToken
+
+	token, err := h.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	if previous == "" || previous == token {
+		return nil
+	}
+
+	clone, err := h.client.Clone()
+	if err != nil {
+		h.logger.Error("error cloning Vault API client; will not revoke previous token", "error", err)
+		return nil
+	}
+
+	clone.SetToken(previous)
+
+	if err = clone.Auth().Token().RevokeSelf(""); err != nil {
+		h.logger.Error("error revoking previous token", "error", err)
+	}
+
+	return nil
+}
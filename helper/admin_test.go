@@ -0,0 +1,197 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestHelper_Admin(t *testing.T) {
+	secretPath := "registry/creds/ci"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithDynamicSecret(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}, time.Hour),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+		vaultlogintest.WithTokenTTL(10*time.Minute),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := fake.Client()
+	secretCache := cache.NewSecretCache(hclog.NewNullLogger(), cache.NewFileCache(dir))
+
+	h := New(Options{
+		Logger:      hclog.NewNullLogger(),
+		Client:      client,
+		AuthTimeout: 3,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{
+			Method: &config.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":                   roleIDFile,
+					"secret_id_file_path":                 secretIDFile,
+					"remove_secret_id_file_after_reading": false,
+				},
+			},
+		},
+		SecretCache: secretCache,
+	})
+
+	t.Run("status-without-token", func(t *testing.T) {
+		expected := Status{
+			VaultAddress: fake.Address(),
+			AuthMethod:   "approle",
+		}
+		if got := h.Status(); !cmp.Equal(expected, got) {
+			t.Fatalf("Statuses differ:\n%v", cmp.Diff(expected, got))
+		}
+	})
+
+	vault := Check{Name: "vault", OK: true, Detail: fake.Address() + " is reachable (version 1.15.4)"}
+
+	t.Run("readiness-without-token", func(t *testing.T) {
+		expected := Readiness{
+			Vault: vault,
+			Token: Check{Name: "token", Detail: "the helper has not logged in yet"},
+		}
+		if got := h.Readiness(context.Background()); !cmp.Equal(expected, got) {
+			t.Fatalf("Readiness differs:\n%v", cmp.Diff(expected, got))
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		if _, _, err := h.Get(""); err != nil {
+			t.Fatal(err)
+		}
+
+		token := client.Token()
+		expected := Status{
+			VaultAddress: fake.Address(),
+			AuthMethod:   "approle",
+			Token: &TokenStatus{
+				Accessor:  "accessor-" + token,
+				TTL:       600,
+				Renewable: true,
+			},
+			CachedSecrets: 1,
+		}
+		if got := h.Status(); !cmp.Equal(expected, got) {
+			t.Fatalf("Statuses differ:\n%v", cmp.Diff(expected, got))
+		}
+	})
+
+	t.Run("readiness", func(t *testing.T) {
+		expected := Readiness{
+			Ready:    true,
+			Vault:    vault,
+			Token:    Check{Name: "token", OK: true, Detail: "the token expires in 10m0s"},
+			TokenTTL: 600,
+			Cache:    CacheStatus{CachedSecrets: 1},
+		}
+		if got := h.Readiness(context.Background()); !cmp.Equal(expected, got) {
+			t.Fatalf("Readiness differs:\n%v", cmp.Diff(expected, got))
+		}
+	})
+
+	t.Run("rotate-token", func(t *testing.T) {
+		previous := client.Token()
+
+		if err := h.RotateToken(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		token := client.Token()
+		if token == "" || token == previous {
+			t.Fatalf("Expected a new token, got %q", token)
+		}
+
+		if status := h.Status(); status.Token == nil || status.Token.Error != "" {
+			t.Fatalf("Expected the new token to be valid, got %+v", status.Token)
+		}
+
+		// The previous token must have been revoked
+		client.SetToken(previous)
+		if _, err := client.Auth().Token().LookupSelf(); err == nil {
+			t.Fatal("expected the previous token to be revoked")
+		}
+		client.SetToken(token)
+	})
+
+	t.Run("purge-cache", func(t *testing.T) {
+		logins := fake.Requests("auth/approle/login")
+
+		if err := h.PurgeCache(); err != nil {
+			t.Fatal(err)
+		}
+		if client.Token() != "" {
+			t.Fatal("expected the helper's token to be forgotten")
+		}
+		if n := secretCache.Len(); n != 0 {
+			t.Fatalf("Expected no cached secrets, got %d", n)
+		}
+
+		if _, _, err := h.Get(""); err != nil {
+			t.Fatal(err)
+		}
+		if n := fake.Requests("auth/approle/login") - logins; n != 1 {
+			t.Fatalf("Expected 1 login, got %d", n)
+		}
+	})
+
+	t.Run("rotate-user-provided-token", func(t *testing.T) {
+		tokenHelper := New(Options{
+			Logger:     hclog.NewNullLogger(),
+			Client:     client,
+			AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		})
+
+		err := tokenHelper.RotateToken(context.Background())
+		if err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		expected := `tokens of the "token" auth method cannot be rotated`
+		if err.Error() != expected {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(err.Error(), expected))
+		}
+	})
+}
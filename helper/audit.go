@@ -0,0 +1,168 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// The sources of the credentials which are recorded in the audit log.
+const (
+	sourceVault     = "vault"
+	sourceExec      = "credential_exec"
+	sourceTTLCache  = "ttl_cache"
+	sourceCoalesced = "coalesced"
+	sourceStale     = "stale"
+	sourceStatic    = "static"
+)
+
+// auditEvent is a line of the audit log. It records who requested the
+// credentials of which registry, where they came from and with which
+// token they were read. The token itself is never recorded.
+type auditEvent struct {
+	Time          time.Time `json:"time"`
+	User          string    `json:"user"`
+	Registry      string    `json:"registry"`
+	Path          string    `json:"path,omitempty"`
+	AuthMethod    string    `json:"auth_method"`
+	TokenAccessor string    `json:"token_accessor,omitempty"`
+	Source        string    `json:"source,omitempty"`
+	Outcome       string    `json:"outcome"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// auditLog appends an event to a JSON Lines file for every credential
+// request.
+type auditLog struct {
+	path string
+	user string
+
+	// token and accessor are the last token whose accessor was looked up
+	// and its accessor, so that it is looked up once per token.
+	mu       sync.Mutex
+	token    string
+	accessor string
+}
+
+// newAuditLog returns the audit log written to path, or nil if path is
+// empty.
+func newAuditLog(path string) *auditLog {
+	if path == "" {
+		return nil
+	}
+
+	name := strconv.Itoa(os.Getuid())
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	return &auditLog{path: path, user: name}
+}
+
+// append writes the event to the end of the log in a single write, so that
+// the lines of concurrent instances of the helper are not interleaved.
+func (l *auditLog) append(event *auditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return xerrors.Errorf("error encoding audit event: %w", err)
+	}
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec
+	if err != nil {
+		return xerrors.Errorf("error opening audit log: %w", err)
+	}
+
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close() //nolint:errcheck
+		return xerrors.Errorf("error writing audit log: %w", err)
+	}
+
+	return file.Close()
+}
+
+// audit records the credential request in the audit log, if it is
+// enabled. err is the error returned by Get.
+func (h *Helper) audit(event *auditEvent, err error) {
+	if h.auditLog == nil {
+		return
+	}
+
+	event.Time = h.clock.Now().UTC()
+	event.User = h.auditLog.user
+	event.Outcome = result(err)
+
+	if err = h.auditLog.append(event); err != nil {
+		h.logger.Error("error recording credential request in the audit log", "path", h.auditLog.path,
+			"error", err)
+	}
+}
+
+// auditAccessor returns the accessor of the token of the client for the
+// audit log, if it is enabled. The accessor is looked up only if the
+// secret was read with the token, i.e. readErr is nil, and only once per
+// token.
+func (h *Helper) auditAccessor(ctx context.Context, readErr error) string {
+	token := h.client.Token()
+	if h.auditLog == nil || token == "" {
+		return ""
+	}
+
+	h.auditLog.mu.Lock()
+	cachedToken, cachedAccessor := h.auditLog.token, h.auditLog.accessor
+	h.auditLog.mu.Unlock()
+
+	if token == cachedToken {
+		return cachedAccessor
+	}
+
+	if readErr != nil {
+		return ""
+	}
+
+	// The token is looked up with a clone of the client, since concurrent
+	// requests may change the token of the client meanwhile
+	client, err := h.client.Clone()
+	if err != nil {
+		h.logger.Error("error cloning Vault API client for the audit log", "error", err)
+		return ""
+	}
+
+	client.SetToken(token)
+
+	secret, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		h.logger.Error("error looking up the accessor of the token for the audit log", "error", err)
+		return ""
+	}
+
+	accessor, err := secret.TokenAccessor()
+	if err != nil {
+		h.logger.Error("error reading the accessor of the token for the audit log", "error", err)
+		return ""
+	}
+
+	h.auditLog.mu.Lock()
+	h.auditLog.token, h.auditLog.accessor = token, accessor
+	h.auditLog.mu.Unlock()
+
+	return accessor
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestHelper_Get_AuditLog(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	now := time.Date(2019, 6, 27, 12, 0, 0, 0, time.UTC)
+	auditLog := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(registry string) (string, error) {
+					if registry != "registry.example.com" {
+						return "", errors.New("no secret configured")
+					}
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		AuditLog:   auditLog,
+		Clock:      clock.NewFake(now),
+	})
+
+	if _, _, err := h.Get("registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := h.Get("other.example.com"); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+
+	user := newAuditLog(auditLog).user
+
+	expected := []auditEvent{
+		{
+			Time:          now,
+			User:          user,
+			Registry:      "registry.example.com",
+			Path:          secretPath,
+			AuthMethod:    "token",
+			TokenAccessor: "accessor-" + fake.RootToken(),
+			Source:        sourceVault,
+			Outcome:       "success",
+		},
+		{
+			Time:       now,
+			User:       user,
+			Registry:   "other.example.com",
+			AuthMethod: "token",
+			Outcome:    "failure",
+			Error:      "no secret configured",
+		},
+	}
+
+	file, err := os.Open(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []auditEvent
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event auditEvent
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, event)
+	}
+
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Fatalf("Audit events differ:\n%s", diff)
+	}
+
+	info, err := os.Stat(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected file mode 0600, got %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+const (
+	// breakerFile is the file in the cache directory in which the state of
+	// the circuit breaker is persisted.
+	breakerFile = "circuit-breaker.json"
+
+	// breakerLockFile is locked while the state of the circuit breaker is
+	// read and written, so that concurrent invocations of the helper don't
+	// lose each other's failures.
+	breakerLockFile = "circuit-breaker.lock"
+
+	// breakerLockTimeout is how long to wait for the lock before the state
+	// is used without it.
+	breakerLockTimeout = 5 * time.Second
+)
+
+// errCircuitOpen is returned instead of reading the secret while the
+// circuit breaker is open.
+var errCircuitOpen = xerrors.New("the circuit breaker is open since Vault is unavailable")
+
+// BreakerOptions configures the circuit breaker, which makes credential
+// requests fail fast once Vault has been unreachable several times in a
+// row, rather than letting each of them time out.
+type BreakerOptions struct {
+	// Threshold is the number of consecutive failures to reach Vault
+	// after which the circuit opens.
+	Threshold int
+
+	// Cooldown is how long the circuit stays open. Failures older than
+	// Cooldown are forgotten.
+	Cooldown time.Duration
+
+	// ServeStale, if true, serves the credentials of the secret cache
+	// while the circuit is open, without checking their lease with Vault.
+	ServeStale bool
+}
+
+// breakerState is the state of the circuit breaker. It is persisted to the
+// cache directory so that it is shared by every invocation of the helper.
+type breakerState struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	OpenUntil   time.Time `json:"open_until,omitempty"`
+}
+
+// circuitBreaker counts the consecutive failures to reach Vault. Once
+// there are as many as the threshold, the circuit opens for the cooldown,
+// after which a single failure opens it again and a success closes it.
+// A nil circuitBreaker is never open.
+type circuitBreaker struct {
+	opts   BreakerOptions
+	path   string
+	lock   *cache.FileLock
+	logger hclog.Logger
+	clock  clock.Clock
+
+	mu    sync.Mutex
+	state breakerState
+}
+
+func newCircuitBreaker(
+	opts *BreakerOptions,
+	cacheDir string,
+	logger hclog.Logger,
+	clk clock.Clock,
+) *circuitBreaker {
+	if opts == nil {
+		return nil
+	}
+
+	b := &circuitBreaker{opts: *opts, logger: logger, clock: clk}
+	if cacheDir != "" {
+		b.path = filepath.Join(cacheDir, breakerFile)
+		b.lock = cache.NewFileLock(filepath.Join(cacheDir, breakerLockFile))
+	}
+
+	return b
+}
+
+// open reports whether the circuit is open and, if so, until when.
+func (b *circuitBreaker) open() (time.Time, bool) {
+	if b == nil {
+		return time.Time{}, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	defer b.acquire(false)()
+
+	b.load()
+
+	return b.state.OpenUntil, b.clock.Now().Before(b.state.OpenUntil)
+}
+
+// record records the result of a request to Vault. Only errors for which
+// vault.IsUnavailable is true are failures; any other error shows that
+// Vault could be reached.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	available := err == nil || !vault.IsUnavailable(err)
+
+	// Nearly every request reaches Vault while the circuit is closed, which
+	// changes nothing, so the state is only read under the shared lock then
+	if available {
+		unlock := b.acquire(false)
+		b.load()
+		unlock()
+
+		if b.state.Failures == 0 {
+			return
+		}
+	}
+
+	// The state is read, changed and written while the lock is held
+	defer b.acquire(true)()
+
+	b.load()
+
+	if available {
+		if b.state.Failures != 0 {
+			b.logger.Info("Vault is reachable again; closing the circuit breaker")
+			b.state = breakerState{}
+			b.save()
+		}
+
+		return
+	}
+
+	// Once the circuit has opened, it stays half-open until Vault is
+	// reached again
+	now := b.clock.Now()
+	if b.state.OpenUntil.IsZero() && now.Sub(b.state.LastFailure) >= b.opts.Cooldown {
+		b.state.Failures = 0
+	}
+
+	b.state.Failures++
+	b.state.LastFailure = now
+
+	if b.state.Failures >= b.opts.Threshold {
+		b.state.OpenUntil = now.Add(b.opts.Cooldown)
+		b.logger.Error("Vault is unavailable; opening the circuit breaker", "failures", b.state.Failures,
+			"until", b.state.OpenUntil)
+	}
+
+	b.save()
+}
+
+// acquire locks the persisted state, exclusively to change it, and returns
+// the function which releases the lock. If the lock cannot be acquired, the
+// state is used without it, since the circuit breaker is only an
+// optimization.
+func (b *circuitBreaker) acquire(exclusive bool) func() {
+	if b.lock == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), breakerLockTimeout)
+	defer cancel()
+
+	var (
+		unlock func()
+		err    error
+	)
+
+	if exclusive {
+		unlock, err = b.lock.Lock(ctx)
+	} else {
+		unlock, err = b.lock.RLock(ctx)
+	}
+
+	if err != nil {
+		b.logger.Warn("error locking circuit breaker state", "error", err)
+		return func() {}
+	}
+
+	return unlock
+}
+
+func (b *circuitBreaker) load() {
+	if b.path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			b.logger.Warn("error reading circuit breaker state", "error", err)
+		}
+
+		b.state = breakerState{}
+
+		return
+	}
+
+	var state breakerState
+	if err = json.Unmarshal(data, &state); err != nil {
+		b.logger.Warn("error JSON-decoding circuit breaker state", "error", err)
+	}
+
+	b.state = state
+}
+
+func (b *circuitBreaker) save() {
+	if b.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(b.state)
+	if err != nil {
+		b.logger.Warn("error JSON-encoding circuit breaker state", "error", err)
+		return
+	}
+
+	// The state is renamed into place so that invocations which read it
+	// without the lock never see a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), "."+breakerFile+".*")
+	if err != nil {
+		b.logger.Warn("error writing circuit breaker state", "error", err)
+		return
+	}
+
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close() // nolint: errcheck, gosec
+		b.logger.Warn("error writing circuit breaker state", "error", err)
+
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		b.logger.Warn("error writing circuit breaker state", "error", err)
+		return
+	}
+
+	if err = os.Rename(tmp.Name(), b.path); err != nil {
+		b.logger.Warn("error writing circuit breaker state", "error", err)
+	}
+}
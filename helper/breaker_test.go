@@ -0,0 +1,190 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	unavailable := xerrors.Errorf("error reading secret: %w", &url.Error{
+		Op:  "Get",
+		URL: "https://vault.example.com:8200/v1/secret/docker/creds",
+		Err: errors.New("connection refused"),
+	})
+	denied := xerrors.Errorf("error reading secret: %w", &api.ResponseError{StatusCode: http.StatusForbidden})
+
+	newBreaker := func(dir string, clk clock.Clock) *circuitBreaker {
+		return newCircuitBreaker(&BreakerOptions{Threshold: 2, Cooldown: time.Minute}, dir, hclog.NewNullLogger(), clk)
+	}
+
+	t.Run("opens-after-threshold", func(t *testing.T) {
+		dir := t.TempDir()
+		clk := clock.NewFake(time.Now())
+		b := newBreaker(dir, clk)
+
+		b.record(unavailable)
+		if _, open := b.open(); open {
+			t.Fatal("expected the circuit to be closed after one failure")
+		}
+
+		b.record(unavailable)
+		until, open := b.open()
+		if !open {
+			t.Fatal("expected the circuit to be open")
+		}
+		if expected := clk.Now().Add(time.Minute); !until.Equal(expected) {
+			t.Fatalf("Expected the circuit to be open until %s, got %s", expected, until)
+		}
+
+		// The state is shared with other instances of the helper
+		if _, open = newBreaker(dir, clk).open(); !open {
+			t.Fatal("expected the circuit to be open for another instance")
+		}
+	})
+
+	t.Run("half-open-after-cooldown", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		b := newBreaker(t.TempDir(), clk)
+
+		b.record(unavailable)
+		b.record(unavailable)
+
+		clk.Advance(time.Minute)
+		if _, open := b.open(); open {
+			t.Fatal("expected the circuit to be half-open after the cooldown")
+		}
+
+		b.record(unavailable)
+		if _, open := b.open(); !open {
+			t.Fatal("expected a single failure to open the circuit again")
+		}
+
+		clk.Advance(time.Minute)
+		b.record(nil)
+		b.record(unavailable)
+		if _, open := b.open(); open {
+			t.Fatal("expected a success to close the circuit")
+		}
+	})
+
+	t.Run("vault-responded", func(t *testing.T) {
+		b := newBreaker(t.TempDir(), clock.NewFake(time.Now()))
+
+		b.record(unavailable)
+		b.record(denied)
+		b.record(unavailable)
+		if _, open := b.open(); open {
+			t.Fatal("expected an error response of Vault to reset the failures")
+		}
+	})
+
+	t.Run("old-failures-forgotten", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		b := newBreaker(t.TempDir(), clk)
+
+		b.record(unavailable)
+		clk.Advance(2 * time.Minute)
+		b.record(unavailable)
+		if _, open := b.open(); open {
+			t.Fatal("expected failures older than the cooldown to be forgotten")
+		}
+	})
+
+	t.Run("concurrent-instances", func(t *testing.T) {
+		dir := t.TempDir()
+		clk := clock.NewFake(time.Now())
+
+		// Every instance of the helper records its failure, none is lost
+		// to another instance writing the state at the same time
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b := newCircuitBreaker(&BreakerOptions{Threshold: 1000, Cooldown: time.Minute}, dir,
+					hclog.NewNullLogger(), clk)
+				for j := 0; j < 10; j++ {
+					b.record(unavailable)
+				}
+			}()
+		}
+		wg.Wait()
+
+		b := newBreaker(dir, clk)
+		b.load()
+		if b.state.Failures != 200 {
+			t.Fatalf("Expected 200 failures, got %d", b.state.Failures)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if name := entry.Name(); name != breakerFile && name != breakerLockFile {
+				t.Fatalf("Unexpected file %s left in the cache directory", name)
+			}
+		}
+	})
+
+	t.Run("success-while-closed", func(t *testing.T) {
+		dir := t.TempDir()
+		b := newBreaker(dir, clock.NewFake(time.Now()))
+
+		// Another reader holds the shared lock, which would hold up a
+		// request waiting for the exclusive lock until it timed out
+		unlock, err := cache.NewFileLock(filepath.Join(dir, breakerLockFile)).RLock(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unlock()
+
+		start := time.Now()
+		b.record(nil)
+		b.record(denied)
+
+		if elapsed := time.Since(start); elapsed >= breakerLockTimeout {
+			t.Fatalf("Expected requests which reached Vault not to wait for the exclusive lock, took %v", elapsed)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, breakerFile)); !os.IsNotExist(err) {
+			t.Fatalf("Expected the state not to be written, got %v", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var b *circuitBreaker
+
+		b.record(unavailable)
+		if _, open := b.open(); open {
+			t.Fatal("expected a disabled circuit breaker never to open")
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+)
+
+// readLockFile returns the file in the cache directory which is locked
+// while the secret at path is read.
+func readLockFile(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return "read-" + hex.EncodeToString(sum[:8]) + ".lock"
+}
+
+// coalesceRead returns the credentials read from the secret at path by a
+// concurrent instance of the helper, if any. Otherwise, it returns the
+// function which lets the other instances proceed once this one has read
+// the secret; until then, they wait for it to share the credentials
+// rather than reading the secret themselves.
+func (h *Helper) coalesceRead(ctx context.Context, path string) (string, string, func(), bool) {
+	username, password, ok := h.coalesceCache.Lookup(path)
+	h.observeCache(cacheCoalesce, ok)
+
+	if ok || h.cacheDir == "" {
+		return username, password, func() {}, ok
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, h.authTimeout)
+	defer cancel()
+
+	unlock, err := cache.NewFileLock(filepath.Join(h.cacheDir, readLockFile(path))).Lock(lockCtx)
+	if err != nil {
+		h.logger.Warn("reading the secret without waiting for concurrent requests", "path", path, "error", err)
+		return "", "", func() {}, false
+	}
+
+	// Another instance may have read the secret while this one waited
+	h.coalesceCache.Reload()
+
+	if username, password, ok = h.coalesceCache.Lookup(path); ok {
+		unlock()
+		return username, password, func() {}, true
+	}
+
+	return "", "", unlock, false
+}
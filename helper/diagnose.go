@@ -0,0 +1,201 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+)
+
+// Check is the result of one of the checks of Diagnose. Its detail never
+// contains tokens or secrets.
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// Diagnose checks that Vault is reachable, that the helper can obtain a
+// token and that the token may read the secrets at paths. A token obtained
+// by logging in is neither cached in the sinks nor kept by the helper; it
+// is revoked once the checks are done. The checks stop at the first
+// failure on which the others depend.
+func (h *Helper) Diagnose(ctx context.Context, paths []string) []Check {
+	health := h.checkHealth(ctx)
+	if !health.OK {
+		return []Check{health}
+	}
+
+	client, err := h.client.Clone()
+	if err != nil {
+		return []Check{health, {Name: "login", Detail: fmt.Sprintf("error cloning Vault API client: %v", err)}}
+	}
+
+	client.SetToken(h.client.Token())
+
+	login, revoke := h.checkLogin(ctx, client)
+	checks := []Check{health, login}
+
+	if login.OK {
+		for _, path := range paths {
+			checks = append(checks, checkCapabilities(ctx, client, path))
+		}
+	}
+
+	if revoke {
+		if err = client.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+			h.logger.Error("error revoking the token obtained by diagnose", "error", err)
+		}
+	}
+
+	return checks
+}
+
+// checkHealth checks that the Vault server is reachable, initialized and
+// unsealed.
+func (h *Helper) checkHealth(ctx context.Context) Check {
+	check := Check{Name: "vault"}
+
+	if err := h.ensureAddress(ctx); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	health, err := h.client.Sys().HealthWithContext(ctx)
+
+	// The address of a unix socket is only kept in the config of the client
+	address := h.client.Address()
+	if configured := h.client.CloneConfig().Address; strings.HasPrefix(configured, "unix://") {
+		address = configured
+	}
+
+	switch {
+	case err != nil:
+		check.Detail = fmt.Sprintf("%s is unreachable: %v", address, err)
+	case !health.Initialized:
+		check.Detail = fmt.Sprintf("%s is not initialized", address)
+	case health.Sealed:
+		check.Detail = fmt.Sprintf("%s is sealed", address)
+	default:
+		check.OK = true
+		check.Detail = fmt.Sprintf("%s is reachable (version %s)", address, health.Version)
+	}
+
+	return check
+}
+
+// checkLogin gives the client a token the same way Get would, except that
+// cached tokens are only used with the vault_agent method, and describes
+// the token. It reports whether the token was obtained by logging in and
+// should therefore be revoked.
+func (h *Helper) checkLogin(ctx context.Context, client *api.Client) (Check, bool) {
+	check := Check{Name: "login"}
+	method := h.authConfig.Method.Type
+
+	var (
+		source string
+		revoke bool
+	)
+
+	switch {
+	case method == "token":
+		if client.Token() == "" {
+			check.Detail = "no token is configured"
+			return check, false
+		}
+
+		source = "the configured token"
+	case method == agentProxyMethod:
+		source = "the auto-auth token of the Vault agent's API proxy"
+	case method == agentMethod && h.useAgentToken(ctx, client):
+		source = "a token from the Vault agent's sinks"
+	case method == agentMethod && len(h.fallbacks) == 0:
+		check.Detail = "no token in the Vault agent's sinks is valid"
+		return check, false
+	default:
+		token, err := h.authenticate(ctx)
+		if err != nil {
+			check.Detail = fmt.Sprintf("error authenticating: %v", err)
+			return check, false
+		}
+
+		client.SetToken(token)
+
+		source, revoke = "a new token (dry run: it is not cached and will be revoked)", true
+	}
+
+	secret, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		check.Detail = fmt.Sprintf("error looking up %s: %v", source, err)
+		return check, revoke
+	}
+
+	policies, _ := secret.TokenPolicies()
+	ttl, _ := secret.TokenTTL()
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("using %s with the %s auth method; policies: %s; ttl: %s",
+		source, method, strings.Join(policies, ", "), ttl.Round(time.Second))
+
+	return check, revoke
+}
+
+// useAgentToken gives the client the first token in the Vault agent's
+// sinks which is valid. It reports whether there is one.
+func (h *Helper) useAgentToken(ctx context.Context, client *api.Client) bool {
+	for _, token := range cache.GetCachedTokens(h.logger.Named("cache"), h.authConfig.Sinks, client) {
+		client.SetToken(token)
+
+		if _, err := client.Auth().Token().LookupSelfWithContext(ctx); err == nil {
+			return true
+		}
+	}
+
+	client.ClearToken()
+
+	return false
+}
+
+// checkCapabilities checks that the token of the client may read the
+// secret at path.
+func checkCapabilities(ctx context.Context, client *api.Client, path string) Check {
+	check := Check{Name: "secret " + path}
+
+	capabilities, err := client.Sys().CapabilitiesSelfWithContext(ctx, path)
+	if err != nil {
+		check.Detail = fmt.Sprintf("error looking up capabilities: %v", err)
+		return check
+	}
+
+	for _, c := range capabilities {
+		if c == "read" || c == "root" {
+			check.OK = true
+		}
+	}
+
+	if check.OK {
+		check.Detail = fmt.Sprintf("readable (capabilities: %s)", strings.Join(capabilities, ", "))
+	} else {
+		check.Detail = fmt.Sprintf("the token may not read the secret (capabilities: %s)",
+			strings.Join(capabilities, ", "))
+	}
+
+	return check
+}
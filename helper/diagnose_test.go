@@ -0,0 +1,162 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestHelper_Diagnose(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	wrongSecretIDFile := filepath.Join(dir, "wrong-secret-id")
+	for file, data := range map[string]string{
+		roleIDFile:        "role-id",
+		secretIDFile:      "secret-id",
+		wrongSecretIDFile: "wrong",
+	} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	approle := func(secretIDFile string) *config.Method {
+		return &config.Method{
+			Type:      "approle",
+			MountPath: "auth/approle",
+			Config: map[string]interface{}{
+				"role_id_file_path":                   roleIDFile,
+				"secret_id_file_path":                 secretIDFile,
+				"remove_secret_id_file_after_reading": false,
+			},
+		}
+	}
+
+	unreachable := fake.Client()
+	if err := unreachable.SetAddress("http://127.0.0.1:1"); err != nil {
+		t.Fatal(err)
+	}
+	unreachable.SetMaxRetries(0)
+
+	cases := []struct {
+		name     string
+		client   *api.Client
+		token    string
+		method   *config.Method
+		expected []Check
+		revoked  int
+	}{
+		{
+			name:   "approle",
+			client: fake.Client(),
+			method: approle(secretIDFile),
+			expected: []Check{
+				{Name: "vault", OK: true},
+				{Name: "login", OK: true, Detail: "using a new token (dry run: it is not cached and will be " +
+					"revoked) with the approle auth method; policies: default; ttl: 1h0m0s"},
+				{Name: "secret secret/docker/creds", OK: true, Detail: "readable (capabilities: read)"},
+				{Name: "secret secret/docker/missing", Detail: "the token may not read the secret " +
+					"(capabilities: deny)"},
+			},
+			revoked: 1,
+		},
+		{
+			name:   "token",
+			client: fake.Client(),
+			token:  fake.RootToken(),
+			method: &config.Method{Type: "token"},
+			expected: []Check{
+				{Name: "vault", OK: true},
+				{Name: "login", OK: true, Detail: "using the configured token with the token auth method; " +
+					"policies: root; ttl: 0s"},
+				{Name: "secret secret/docker/creds", OK: true, Detail: "readable (capabilities: root)"},
+				{Name: "secret secret/docker/missing", OK: true, Detail: "readable (capabilities: root)"},
+			},
+		},
+		{
+			name:   "login-fails",
+			client: fake.Client(),
+			method: approle(wrongSecretIDFile),
+			expected: []Check{
+				{Name: "vault", OK: true},
+				{Name: "login", Detail: "error authenticating: failed to get credentials within timeout (1s): context deadline exceeded"},
+			},
+		},
+		{
+			name:   "unreachable",
+			client: unreachable,
+			method: approle(secretIDFile),
+			expected: []Check{
+				{Name: "vault"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.token != "" {
+				tc.client.SetToken(tc.token)
+			}
+
+			revoked := fake.Requests("auth/token/revoke-self")
+
+			h := New(Options{
+				Logger:      hclog.NewNullLogger(),
+				Client:      tc.client,
+				AuthTimeout: 1,
+				AuthConfig:  &config.AutoAuth{Method: tc.method},
+			})
+
+			checks := h.Diagnose(context.Background(), []string{"secret/docker/creds", "secret/docker/missing"})
+
+			// The health check names the address, which is not known
+			// in advance
+			if len(checks) > 0 {
+				if !strings.HasPrefix(checks[0].Detail, tc.client.Address()) {
+					t.Errorf("Expected the health check to name %s, got %q", tc.client.Address(), checks[0].Detail)
+				}
+
+				checks[0].Detail = ""
+			}
+
+			if diff := cmp.Diff(tc.expected, checks); diff != "" {
+				t.Fatalf("Checks differ:\n%s", diff)
+			}
+
+			if n := fake.Requests("auth/token/revoke-self") - revoked; n != tc.revoked {
+				t.Fatalf("Expected %d token(s) to be revoked, got %d", tc.revoked, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"sort"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+// DryRun is the report of a credential request made by DryRun. It
+// describes where the credentials came from and how long reading them
+// took, but never contains the credentials, the other values of the secret
+// or the token.
+type DryRun struct {
+	Registry string `json:"registry"`
+	Path     string `json:"path,omitempty"`
+	Source   string `json:"source,omitempty"`
+
+	// Keys are the names of the fields of the secret read from Vault.
+	Keys []string `json:"keys,omitempty"`
+
+	UsernamePresent bool `json:"username_present"`
+	PasswordPresent bool `json:"password_present"`
+
+	// LeaseTTL is the TTL of the lease of the secret in seconds, or zero
+	// if it has none.
+	LeaseTTL  int64 `json:"lease_ttl_seconds,omitempty"`
+	Renewable bool  `json:"renewable,omitempty"`
+
+	// Duration is how long the request took and Phases how long it spent
+	// logging in, reading the secret and so on.
+	Duration string            `json:"duration"`
+	Phases   map[string]string `json:"phases,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// DryRun looks up the credentials of the registry like Get, logging in
+// and reading the secret if needed, but returns a report of the request
+// in place of the credentials. The error is that which Get would return.
+func (h *Helper) DryRun(serverURL string) (*DryRun, error) {
+	report := &DryRun{Registry: serverURL}
+
+	_, _, err := h.get(serverURL, report)
+
+	return report, err
+}
+
+// record fills in the report from the audit event and the timer of the
+// request once it is done.
+func (r *DryRun) record(event *auditEvent, timer *requestTimer, username, password string) {
+	r.Path = event.Path
+	r.Source = event.Source
+	r.Error = event.Error
+	r.UsernamePresent = username != ""
+	r.PasswordPresent = password != ""
+	r.Duration = timer.stop().String()
+
+	for _, phase := range phases {
+		if d, ok := timer.phases[phase]; ok {
+			if r.Phases == nil {
+				r.Phases = make(map[string]string)
+			}
+
+			r.Phases[phase] = d.String()
+		}
+	}
+}
+
+// recordSecret records the names of the fields and the lease of the
+// secret from which the credentials were read.
+func (r *DryRun) recordSecret(creds vault.Credentials) {
+	for key := range creds.Fields {
+		r.Keys = append(r.Keys, key)
+	}
+
+	sort.Strings(r.Keys)
+
+	r.LeaseTTL = int64(creds.LeaseDuration / time.Second)
+	r.Renewable = creds.Renewable
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestHelper_DryRun(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+			"email":    "test@user.com",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(registry string) (string, error) {
+					if registry != "registry.example.com" {
+						return "", errors.New("no secret configured")
+					}
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		Clock:      clock.NewFake(time.Date(2019, 6, 27, 12, 0, 0, 0, time.UTC)),
+	})
+
+	cases := []struct {
+		name     string
+		registry string
+		expected *DryRun
+		err      string
+	}{
+		{
+			name:     "vault",
+			registry: "registry.example.com",
+			expected: &DryRun{
+				Registry:        "registry.example.com",
+				Path:            secretPath,
+				Source:          sourceVault,
+				Keys:            []string{"email", "password", "username"},
+				UsernamePresent: true,
+				PasswordPresent: true,
+				Duration:        "0s",
+				Phases:          map[string]string{phaseReadSecret: "0s"},
+			},
+		},
+		{
+			name:     "not-configured",
+			registry: "other.example.com",
+			expected: &DryRun{
+				Registry: "other.example.com",
+				Duration: "0s",
+				Error:    "no secret configured",
+			},
+			err: "credentials not found in native keychain",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := h.DryRun(tc.registry)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expected, report); diff != "" {
+				t.Fatalf("Reports differ:\n%s", diff)
+			}
+		})
+	}
+}
@@ -16,6 +16,9 @@ package helper
 import (
 	"context"
 	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/docker/docker-credential-helpers/credentials"
@@ -26,10 +29,38 @@ import (
 	"github.com/hashicorp/vault/command/agentproxyshared/sink"
 	"golang.org/x/xerrors"
 
+	"github.com/morningconsult/docker-credential-vault-login/azureauth"
 	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	mciconfig "github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/gcpauth"
+	"github.com/morningconsult/docker-credential-vault-login/harden"
+	"github.com/morningconsult/docker-credential-vault-login/messages"
+	"github.com/morningconsult/docker-credential-vault-login/telemetry"
 	"github.com/morningconsult/docker-credential-vault-login/vault"
 )
 
+// agentMethod is the method type used to read the tokens which a Vault
+// agent writes to its sinks rather than authenticating.
+const agentMethod = "vault_agent"
+
+// agentProxyMethod is the method type used to send requests without a
+// token to the API proxy of a Vault agent, which adds its own auto-auth
+// token to them.
+const agentProxyMethod = "vault_agent_proxy"
+
+// tokenCacheKey is the key under which the token obtained by the helper is
+// stored in the token cache.
+const tokenCacheKey = "vault-token"
+
+// loginLockFile is the file in the cache directory which is locked while
+// the helper logs in.
+const loginLockFile = "login.lock"
+
+// minLeaseTTL is the shortest remaining TTL of the lease of a cached
+// secret for which the cached credentials are still used.
+const minLeaseTTL = time.Minute
+
 var (
 	errNotImplemented  = errors.New("not implemented")
 	defaultAuthTimeout = 30 * time.Second
@@ -37,6 +68,12 @@ var (
 
 type secretTable interface {
 	GetPath(host string) (string, error)
+	FieldKeys(host string) (usernameKey, passwordKey string)
+	IdentityTokenKey(host string) string
+	IdentityTokenUsername(host string) (string, bool)
+	Templates(host string) (usernameTemplate, passwordTemplate string)
+	UsernamePath(host string) string
+	Registries() []string
 }
 
 // Options is used to configure a new Helper instance.
@@ -48,6 +85,121 @@ type Options struct {
 	AuthTimeout int64
 	WrapTTL     time.Duration
 	AuthConfig  *config.AutoAuth
+	CacheDir    string
+
+	// FallbackMethods are tried, in order, whenever the method of
+	// AuthConfig fails.
+	FallbackMethods []*config.Method
+
+	// ResponsePin, if set, is used to verify every secret read.
+	ResponsePin *vault.ResponsePin
+
+	// Bootstrap, if set, is the wrapping token from which the token or
+	// SecretID is unwrapped before the helper first authenticates.
+	Bootstrap *vault.BootstrapOptions
+
+	// TokenCache, if set, is where the tokens obtained by the helper are
+	// cached, in addition to the sinks, if caching is enabled.
+	TokenCache cache.Cache
+
+	// SecretCache, if set, is used to cache credentials read from
+	// leased secrets.
+	SecretCache *cache.SecretCache
+
+	// TTLCache, if set, is used to cache the credentials read from every
+	// secret for a short time.
+	TTLCache *cache.TTLCache
+
+	// StaleCache, if set, is used to cache the last-known-good
+	// credentials read from every secret, which are returned if the
+	// helper fails to log in or to read the secret again.
+	StaleCache *cache.TTLCache
+
+	// CoalesceCache, if set, is used to share the credentials read from
+	// every secret with concurrent instances of the helper. If CacheDir
+	// is also set, concurrent reads of the same secret wait for the
+	// first one instead of reading it again.
+	CoalesceCache *cache.TTLCache
+
+	// ECR, if set, enables the ECR token mode: the secrets are read as
+	// AWS credentials, which are exchanged for an authorization token of
+	// the ECR registry.
+	ECR *vault.ECROptions
+
+	// GCR, if set, enables the GCR token mode: for Container Registry and
+	// Artifact Registry, the secrets are read as access tokens or service
+	// account keys with which access tokens are minted.
+	GCR *vault.GCROptions
+
+	// ACR, if set, enables the ACR token mode: for Azure Container
+	// Registry, an Azure AD token read from the secrets or obtained from
+	// the managed identity of the host is exchanged for a refresh token.
+	ACR *vault.ACROptions
+
+	// ProxyPaths are the paths which other tools may read through
+	// ReadSecret. ProxyCacheTTL, if positive, is how long the secrets read
+	// are cached.
+	ProxyPaths    []string
+	ProxyCacheTTL time.Duration
+
+	// RotationOverlap is how long the previous version of a secret which
+	// rotated is kept.
+	RotationOverlap time.Duration
+
+	// SlowRequestThreshold, if positive, is the duration beyond which a
+	// credential request is logged and counted as slow.
+	SlowRequestThreshold time.Duration
+
+	// Breaker, if set, enables the circuit breaker, whose state is kept in
+	// CacheDir.
+	Breaker *BreakerOptions
+
+	// RevokeOnExit, if set, makes RevokeOnExit revoke the token which the
+	// helper obtained itself.
+	RevokeOnExit bool
+
+	// Timeout, if positive, is how long a credential request may take in
+	// all. Every request to Vault and to the cloud providers it makes is
+	// cancelled when it runs out.
+	Timeout time.Duration
+
+	// AuditLog, if set, is the path of the file to which an event is
+	// appended for every credential request.
+	AuditLog string
+
+	// Metrics, if set, receives the metrics of every credential request.
+	Metrics *telemetry.Emitter
+
+	// Tracer, if set, records a span of every credential request and of
+	// each of its phases.
+	Tracer *telemetry.Tracer
+
+	// CredentialExec, if set, is the external program which is asked for
+	// the credentials of every registry before Vault is.
+	CredentialExec *vault.ExecOptions
+
+	// StaticCredentials, if set, are returned whenever the credentials of
+	// a registry cannot be read from Vault.
+	StaticCredentials *mciconfig.StaticCredentials
+
+	// Scrubber, if set, is given the credentials returned and the token
+	// with which they were read, so that they are redacted from the log.
+	Scrubber *harden.Scrubber
+
+	// Clock, if set, is the clock by which leases expire, secrets rotate
+	// and requests are timed. Otherwise, the clock of the system is used.
+	Clock clock.Clock
+
+	// Rand, if set, is the randomness of the authentication methods, such
+	// as that of the nonce of the ec2 type of the aws method. Otherwise,
+	// the randomness of the system is used.
+	Rand clock.Rand
+
+	// SelectAddress, if set, selects the address of the Vault node to
+	// which the client sends its requests. It is called before the first
+	// request to Vault rather than when the helper is created, so that
+	// credentials served from a cache need no request at all.
+	SelectAddress func(ctx context.Context) error
 }
 
 // Helper implements a Docker credential helper which will
@@ -55,12 +207,59 @@ type Options struct {
 // the Docker daemon in order to authenticate to a private
 // Docker registry.
 type Helper struct {
-	logger       hclog.Logger
-	client       *api.Client
-	secret       secretTable
-	cacheEnabled bool
-	authTimeout  time.Duration
-	authConfig   *config.AutoAuth
+	logger        hclog.Logger
+	client        *api.Client
+	secret        secretTable
+	cacheEnabled  bool
+	authTimeout   time.Duration
+	authConfig    *config.AutoAuth
+	cacheDir      string
+	fallbacks     []*config.Method
+	pin           *vault.ResponsePin
+	bootstrap     *vault.BootstrapOptions
+	tokenCache    cache.Cache
+	secretCache   *cache.SecretCache
+	ttlCache      *cache.TTLCache
+	staleCache    *cache.TTLCache
+	coalesceCache *cache.TTLCache
+	ecr           *vault.ECROptions
+	gcr           *vault.GCROptions
+	acr           *vault.ACROptions
+
+	proxyPaths    []string
+	proxyCacheTTL time.Duration
+	proxyCache    proxyCache
+
+	rotations rotationTracker
+
+	slowThreshold time.Duration
+	timeout       time.Duration
+	revokeOnExit  bool
+	auditLog      *auditLog
+	breaker       *circuitBreaker
+	metrics       *telemetry.Emitter
+	tracer        *telemetry.Tracer
+
+	credentialExec *vault.ExecOptions
+
+	static *mciconfig.StaticCredentials
+
+	scrubber *harden.Scrubber
+
+	clock clock.Clock
+	rand  clock.Rand
+
+	selectAddress   func(ctx context.Context) error
+	addressMu       sync.Mutex
+	addressSelected bool
+
+	// tokenMu serializes the changes to the token of the client, so that
+	// concurrent calls to Get and ReadSecret log in only once.
+	tokenMu sync.Mutex
+
+	// authToken is the token most recently obtained by the helper itself
+	// (as opposed to one provided by the user). It is guarded by tokenMu.
+	authToken string
 }
 
 // New creates a new Helper instance.
@@ -70,16 +269,82 @@ func New(opts Options) *Helper {
 		timeout = time.Duration(opts.AuthTimeout) * time.Second
 	}
 
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.System()
+	}
+
 	return &Helper{
-		logger:       opts.Logger,
-		client:       opts.Client,
-		secret:       opts.Secret,
-		cacheEnabled: opts.EnableCache,
-		authTimeout:  timeout,
-		authConfig:   opts.AuthConfig,
+		logger:        opts.Logger,
+		client:        opts.Client,
+		secret:        opts.Secret,
+		cacheEnabled:  opts.EnableCache,
+		authTimeout:   timeout,
+		authConfig:    opts.AuthConfig,
+		cacheDir:      opts.CacheDir,
+		fallbacks:     opts.FallbackMethods,
+		pin:           opts.ResponsePin,
+		bootstrap:     opts.Bootstrap,
+		tokenCache:    opts.TokenCache,
+		secretCache:   opts.SecretCache,
+		ttlCache:      opts.TTLCache,
+		staleCache:    opts.StaleCache,
+		coalesceCache: opts.CoalesceCache,
+		ecr:           opts.ECR,
+		gcr:           opts.GCR,
+		acr:           opts.ACR,
+
+		proxyPaths:    opts.ProxyPaths,
+		proxyCacheTTL: opts.ProxyCacheTTL,
+		proxyCache:    proxyCache{clock: clk},
+
+		rotations: rotationTracker{overlap: opts.RotationOverlap, clock: clk},
+
+		slowThreshold: opts.SlowRequestThreshold,
+		timeout:       opts.Timeout,
+		revokeOnExit:  opts.RevokeOnExit,
+		auditLog:      newAuditLog(opts.AuditLog),
+		breaker:       newCircuitBreaker(opts.Breaker, opts.CacheDir, opts.Logger, clk),
+		metrics:       opts.Metrics,
+		tracer:        opts.Tracer,
+
+		credentialExec: opts.CredentialExec,
+
+		static: opts.StaticCredentials,
+
+		scrubber: opts.Scrubber,
+
+		clock: clk,
+		rand:  opts.Rand,
+
+		selectAddress: opts.SelectAddress,
 	}
 }
 
+// ensureAddress selects the address of the Vault node unless it has been
+// selected already.
+func (h *Helper) ensureAddress(ctx context.Context) error {
+	if h.selectAddress == nil {
+		return nil
+	}
+
+	h.addressMu.Lock()
+	defer h.addressMu.Unlock()
+
+	if h.addressSelected {
+		return nil
+	}
+
+	if err := h.selectAddress(ctx); err != nil {
+		h.logger.Error("error selecting Vault address", "error", err)
+		return xerrors.Errorf("error selecting Vault address: %w", err)
+	}
+
+	h.addressSelected = true
+
+	return nil
+}
+
 // Add is not implemented.
 func (h *Helper) Add(*credentials.Credentials) error {
 	return errNotImplemented
@@ -90,105 +355,751 @@ func (h *Helper) Delete(string) error {
 	return errNotImplemented
 }
 
-// List is not implemented.
+// List returns the registries configured with a secret of their own. The
+// usernames are left empty since listing does not read the secrets from
+// Vault; the Docker CLI looks up the credentials of every registry with Get.
 func (h *Helper) List() (map[string]string, error) {
-	return nil, errNotImplemented
+	registries := h.secret.Registries()
+
+	list := make(map[string]string, len(registries))
+	for _, registry := range registries {
+		list[registry] = ""
+	}
+
+	return list, nil
 }
 
 // Get will lookup Docker credentials in Vault and pass them
 // to the Docker daemon.
-func (h *Helper) Get(serverURL string) (string, string, error) { // nolint: gocyclo
-	var (
-		creds  vault.Credentials
-		secret string
-		err    error
-	)
+func (h *Helper) Get(serverURL string) (username, password string, err error) {
+	return h.get(serverURL, nil)
+}
+
+// get looks up the credentials of the registry as described by Get. If
+// report is not nil, what the request did is recorded in it.
+func (h *Helper) get(serverURL string, report *DryRun) (username, password string, err error) { // nolint: gocyclo
+	root := h.tracer.Start("get", nil)
+	root.SetAttribute("registry", serverURL)
 
-	secret, err = h.secret.GetPath(serverURL)
+	timer := newRequestTimer(h.clock)
+	timer.trace(h.tracer, root)
+
+	defer func() { h.observeRequest(serverURL, timer, err) }()
+	defer func() { h.scrubber.Add(password, h.client.Token()) }()
+
+	event := &auditEvent{Registry: serverURL, AuthMethod: h.authConfig.Method.Type}
+	defer func() { h.audit(event, err) }()
+
+	if report != nil {
+		defer func() { report.record(event, timer, username, password) }()
+	}
+
+	ctx, cancel := h.requestContext()
+	defer cancel()
+
+	if h.credentialExec != nil {
+		span := h.tracer.Start("credential_exec", root)
+		creds, ok, execErr := vault.GetExecCredentials(ctx, h.logger.Named("exec"), h.credentialExec, serverURL)
+		span.End(execErr)
+
+		if execErr != nil {
+			h.logger.Error("error running credential_exec; reading the credentials from Vault", "error", execErr)
+		} else if ok {
+			event.Source = sourceExec
+			return creds.Username, creds.Password, nil
+		}
+	}
+
+	secret, err := h.secret.GetPath(serverURL)
 	if err != nil {
-		h.logger.Error("error parsing registry path", "error", err)
-		return "", "", xerrors.Errorf("error parsing registry path: %w", err)
+		h.logger.Error("no secret is configured for the registry", "code", messages.RegistryNotConfigured,
+			"registry", serverURL, "error", err)
+		h.observeError(errorRegistryNotConfigured)
+		event.Error = err.Error()
+
+		if username, password, ok := h.getStaticCredentials(serverURL, err); ok {
+			event.Source = sourceStatic
+			return username, password, nil
+		}
+
+		// Docker pulls anonymously when the credentials are not found
+		return "", "", credentials.NewErrCredentialsNotFound()
 	}
 
-	if h.client.Token() != "" {
-		// Get credentials with provided token
-		creds, err = vault.GetCredentials(secret, h.client)
-		if err != nil {
-			h.logger.Error("error reading secret from Vault", "error", err)
-			return "", "", credentials.NewErrCredentialsNotFound()
+	event.Path = secret
+
+	if h.ttlCache != nil {
+		span := h.tracer.Start(cacheTTL+"_cache", root)
+		username, password, ok := h.ttlCache.Lookup(secret)
+		h.observeCache(cacheTTL, ok)
+		span.End(nil)
+
+		if ok {
+			event.Source = sourceTTLCache
+			return username, password, nil
 		}
+	}
+
+	if until, open := h.breaker.open(); open {
+		h.observeError(errorCircuitOpen)
+		event.Error = errCircuitOpen.Error()
 
-		return creds.Username, creds.Password, nil
+		if username, password, ok := h.getStaleCredentials(secret); ok {
+			event.Source = sourceStale
+			return username, password, nil
+		}
+
+		h.logger.Error("not reading the secret from Vault while the circuit breaker is open", "until", until)
+
+		if username, password, ok := h.getLastKnownGood(secret, errCircuitOpen); ok {
+			event.Source = sourceStale
+			return username, password, nil
+		}
+
+		if username, password, ok := h.getStaticCredentials(serverURL, errCircuitOpen); ok {
+			event.Source = sourceStatic
+			return username, password, nil
+		}
+
+		return "", "", credentials.NewErrCredentialsNotFound()
 	}
 
-	if h.cacheEnabled {
-		var clone *api.Client
+	if h.coalesceCache != nil {
+		username, password, unlock, ok := h.coalesceRead(ctx, secret)
+		if ok {
+			event.Source = sourceCoalesced
+			return username, password, nil
+		}
+
+		defer unlock()
+	}
 
-		clone, err = h.client.Clone()
-		if err != nil {
-			h.logger.Error("error cloning Vault API client", "error", err)
-			return "", "", credentials.NewErrCredentialsNotFound()
+	var creds vault.Credentials
+
+	err = h.withToken(ctx, timer, func() error {
+		creds, err = h.getCredentials(ctx, serverURL, secret)
+		return err
+	})
+
+	h.breaker.record(err)
+
+	event.TokenAccessor = h.auditAccessor(ctx, err)
+
+	if err != nil {
+		h.logTimeout(ctx)
+		event.Error = err.Error()
+
+		if username, password, ok := h.getLastKnownGood(secret, err); ok {
+			event.Source = sourceStale
+			return username, password, nil
 		}
 
-		// Get any cached tokens
-		cachedTokens := cache.GetCachedTokens(h.logger.Named("cache"), h.authConfig.Sinks, clone)
-		if len(cachedTokens) < 1 {
-			h.logger.Info("no cached token(s) were read. Re-authenticating.")
+		if username, password, ok := h.getStaticCredentials(serverURL, err); ok {
+			event.Source = sourceStatic
+			return username, password, nil
 		}
 
-		// Renew the cached tokens
-		for _, token := range cachedTokens {
-			if _, err = h.client.Auth().Token().RenewTokenAsSelf(token, 0); err != nil {
-				h.logger.Error("error renewing token", "error", err)
-			}
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+
+	event.Source = sourceVault
+
+	if report != nil {
+		report.recordSecret(creds)
+	}
+
+	return creds.Username, creds.Password, nil
+}
+
+// getStaleCredentials returns the credentials read from the secret at path
+// which are in the secret cache, if the circuit breaker may serve them.
+// Their lease is not checked, since Vault is unavailable.
+func (h *Helper) getStaleCredentials(path string) (string, string, bool) {
+	if !h.breaker.opts.ServeStale || h.secretCache == nil {
+		return "", "", false
+	}
+
+	entry, ok := h.secretCache.Lookup(path)
+	if !ok {
+		return "", "", false
+	}
+
+	h.logger.Warn("serving cached credentials without checking their lease while Vault is unavailable",
+		"path", path)
+
+	return entry.Username, entry.Password, true
+}
+
+// getLastKnownGood returns the last credentials read from the secret at
+// path, if the stale-cache fallback is enabled and they were read recently
+// enough. vaultErr is why they could not be read again.
+func (h *Helper) getLastKnownGood(path string, vaultErr error) (string, string, bool) {
+	if h.staleCache == nil {
+		return "", "", false
+	}
+
+	username, password, ok := h.staleCache.Lookup(path)
+	h.observeCache(cacheStale, ok)
+
+	if !ok {
+		return "", "", false
+	}
+
+	h.logger.Warn("serving the last-known-good credentials since the secret could not be read",
+		"path", path, "vault_error", vaultErr)
+
+	return username, password, true
+}
+
+// requestContext returns the context of a credential request, which is
+// cancelled once the timeout of the helper, if any, runs out.
+func (h *Helper) requestContext() (context.Context, context.CancelFunc) {
+	if h.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), h.timeout)
+}
+
+// logTimeout logs that the credential request failed because the timeout
+// of the helper ran out, if it did.
+func (h *Helper) logTimeout(ctx context.Context) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		h.logger.Error("credential request timed out", "helper_timeout", h.timeout)
+	}
+}
+
+// getStaticCredentials returns the static credentials of the registry, if
+// the static fallback is enabled and the registry has some. vaultErr is why
+// the credentials could not be read from Vault.
+func (h *Helper) getStaticCredentials(registry string, vaultErr error) (string, string, bool) {
+	if h.static == nil {
+		return "", "", false
+	}
+
+	username, password, err := h.static.Get(registry)
+	if err != nil {
+		h.logger.Error("error reading static credentials", "registry", registry, "error", err)
+		return "", "", false
+	}
+
+	// Only errors are logged by default, so the use of the static
+	// credentials is logged as such to be seen
+	h.logger.Error("BREAK-GLASS: using static credentials from the configuration file instead of Vault",
+		"registry", registry, "vault_error", vaultErr)
+	h.metrics.IncrCounter("static_fallback", map[string]string{"registry": registry})
+
+	return username, password, true
+}
+
+// readError is an error of read which another token would not fix: the
+// secret does not exist or the token, which is valid, may not read it.
+type readError struct {
+	err error
+}
+
+func (e *readError) Error() string { return e.err.Error() }
+
+func (e *readError) Unwrap() error { return e.err }
+
+// tokenRejected reports whether err, returned by a read with the token of
+// the client, may be caused by the token being invalid or expired. Vault
+// answers invalid tokens with 403 as well, so the token is looked up to
+// tell them from a lack of permission.
+func (h *Helper) tokenRejected(ctx context.Context, err error) bool {
+	var respErr *api.ResponseError
+
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+		return false
+	case !errors.As(err, &respErr):
+		return true
+	case respErr.StatusCode == http.StatusNotFound:
+		return false
+	case respErr.StatusCode == http.StatusForbidden:
+		_, lookupErr := h.client.Auth().Token().LookupSelfWithContext(ctx)
+		return lookupErr != nil
+	default:
+		return true
+	}
+}
+
+// withToken calls read with the token of the client, then with each cached
+// token, and finally with a new token obtained by authenticating, until
+// read succeeds or fails for another reason than the token being invalid
+// or expired. Failures are logged. The token with which read succeeded
+// is left in the client. Logging in and renewing tokens are done within
+// ctx, which read should use as well.
+func (h *Helper) withToken(ctx context.Context, timer *requestTimer, read func() error) error { // nolint: gocyclo
+	var err error
+
+	observed := h.observeRead(read)
+	read = func() error {
+		err := observed()
+		if err != nil && !h.tokenRejected(ctx, err) {
+			return &readError{err: err}
 		}
 
-		// Use any token to get credentials
-		for _, token := range cachedTokens {
-			h.client.SetToken(token)
+		return err
+	}
 
-			// Get credentials
-			creds, err = vault.GetCredentials(secret, h.client)
-			if err != nil {
-				h.logger.Error("error reading secret from Vault", "error", err)
-				continue
-			}
+	if err = h.ensureAddress(ctx); err != nil {
+		return err
+	}
 
-			return creds.Username, creds.Password, nil
+	if h.authConfig.Method.Type == agentProxyMethod {
+		timer.enter(phaseReadSecret)
+
+		if err = read(); err != nil {
+			h.logger.Error("error reading secret through the Vault agent's API proxy", "error", err)
+		}
+
+		return err
+	}
+
+	token := h.client.Token()
+	if token != "" {
+		// Read the secret with the provided token
+		timer.enter(phaseReadSecret)
+
+		if err = read(); err == nil {
+			return nil
+		}
+
+		h.logger.Error("error reading secret from Vault", "error", err)
+
+		if isReadError(err) {
+			return unwrapReadError(err)
+		}
+	}
+
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+
+	// Another call may have replaced the token while this one waited
+	if current := h.client.Token(); current != "" && current != token {
+		token = current
+
+		timer.enter(phaseReadSecret)
+
+		if err = read(); err == nil {
+			return nil
 		}
+
+		h.logger.Error("error reading secret from Vault", "error", err)
+
+		if isReadError(err) {
+			return unwrapReadError(err)
+		}
+	}
+
+	// Only a token which the helper obtained itself may be replaced.
+	// This happens when the helper is long-lived and its token expires.
+	if token != "" && token != h.authToken {
+		return err
 	}
 
-	ctx := context.Background()
+	// A Vault agent maintains the token in its sinks, so the helper must
+	// neither renew it nor replace it with one of its own
+	usesAgent := h.authConfig.Method.Type == agentMethod
+
+	// The cached tokens tried, so that they are not tried again
+	tried := make(map[string]bool)
+
+	if h.cacheEnabled || usesAgent {
+		var ok bool
+		if ok, err = h.readWithCachedTokens(ctx, timer, read, usesAgent, tried); ok || err != nil {
+			h.observeCache(cacheToken, ok)
+			return unwrapReadError(err)
+		}
+	}
+
+	if usesAgent && len(h.fallbacks) == 0 {
+		h.observeCache(cacheToken, false)
+		h.logger.Error("no token in the Vault agent's sinks could be used to read the secret")
+		return xerrors.New("no token in the Vault agent's sinks could be used to read the secret")
+	}
+
+	if h.cacheEnabled && !usesAgent {
+		// Concurrent instances of the helper log in one at a time. The
+		// ones which waited use the token cached by the first if they can.
+		timer.enter(phaseTokenCache)
+
+		unlock, ok, lockErr := h.lockLogin(ctx, timer, read, tried)
+		if ok {
+			h.observeCache(cacheToken, true)
+			return nil
+		}
+
+		if isReadError(lockErr) {
+			h.observeCache(cacheToken, true)
+			return unwrapReadError(lockErr)
+		}
+
+		if lockErr != nil {
+			h.logger.Error("error locking login; logging in regardless", "error", lockErr)
+		} else {
+			defer unlock()
+		}
+	}
+
+	if h.cacheEnabled || usesAgent {
+		h.observeCache(cacheToken, false)
+	}
 
 	// Failed to read secret with cached token. Reauthenticate.
 	h.client.ClearToken()
 
-	token, err := h.authenticate(ctx)
+	timer.enter(phaseAuthenticate)
+
+	// The login is counted with the first of the methods tried
+	method := h.authConfig.Method.Type
+	if usesAgent {
+		method = h.fallbacks[0].Type
+	}
+
+	start := h.clock.Now()
+	token, err = h.authenticate(ctx)
+	h.observeLogin(method, start, err)
+
 	if err != nil {
 		h.logger.Error("error authenticating", "error", err)
-		return "", "", credentials.NewErrCredentialsNotFound()
+		return err
 	}
 
 	// Cache the token if caching is enabled
-	if h.cacheEnabled {
+	if h.cacheEnabled && !usesAgent {
+		timer.enter(phaseSink)
 		h.cacheToken(ctx, token)
 	}
 
 	// Give the newly-obtained token to the client
 	h.client.SetToken(token)
+	h.authToken = token
 
-	// Get credentials
-	creds, err = vault.GetCredentials(secret, h.client)
-	if err != nil {
+	// Read the secret
+	timer.enter(phaseReadSecret)
+
+	if err = read(); err != nil {
 		h.logger.Error("error reading secret from Vault", "error", err)
-		return "", "", credentials.NewErrCredentialsNotFound()
+		return unwrapReadError(err)
 	}
 
-	return creds.Username, creds.Password, nil
+	return nil
+}
+
+// isReadError reports whether err is a readError.
+func isReadError(err error) bool {
+	var rerr *readError
+	return errors.As(err, &rerr)
+}
+
+// unwrapReadError returns the error wrapped by err if it is a readError,
+// or err.
+func unwrapReadError(err error) error {
+	var rerr *readError
+	if errors.As(err, &rerr) {
+		return rerr.err
+	}
+
+	return err
+}
+
+// readWithCachedTokens calls read with each cached token which is not in
+// tried until read succeeds, and reports whether it did. The tokens are
+// added to tried. An error is returned only if the cached tokens could not
+// be read at all, or if read failed with a readError, which another token
+// would not fix.
+func (h *Helper) readWithCachedTokens(
+	ctx context.Context,
+	timer *requestTimer,
+	read func() error,
+	usesAgent bool,
+	tried map[string]bool,
+) (bool, error) {
+	timer.enter(phaseTokenCache)
+
+	clone, err := h.client.Clone()
+	if err != nil {
+		h.logger.Error("error cloning Vault API client", "error", err)
+		return false, err
+	}
+
+	// Get any cached tokens
+	cachedTokens := cache.GetCachedTokens(h.logger.Named("cache"), h.authConfig.Sinks, clone)
+	if token := h.getCachedToken(); token != "" && !usesAgent {
+		cachedTokens = append([]string{token}, cachedTokens...)
+	}
+
+	tokens := make([]string, 0, len(cachedTokens))
+
+	for _, token := range cachedTokens {
+		if !tried[token] {
+			tried[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	if len(tokens) < 1 {
+		h.logger.Info("no cached token(s) were read. Re-authenticating.")
+	}
+
+	// Renew the cached tokens
+	if !usesAgent {
+		for _, token := range tokens {
+			if _, err = h.client.Auth().Token().RenewTokenAsSelfWithContext(ctx, token, 0); err != nil {
+				h.logger.Error("error renewing token", "error", err)
+			}
+		}
+	}
+
+	// Use any token to read the secret
+	for _, token := range tokens {
+		h.client.SetToken(token)
+
+		timer.enter(phaseReadSecret)
+
+		if err = read(); err != nil {
+			h.logger.Error("error reading secret from Vault", "error", err)
+
+			if isReadError(err) {
+				h.authToken = token
+				return false, err
+			}
+
+			timer.enter(phaseTokenCache)
+
+			continue
+		}
+
+		h.authToken = token
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// lockLogin acquires the login lock, so that concurrent instances of the
+// helper which share the cache directory log in only once. If another
+// instance cached a token while this one waited for the lock, read is
+// called with it and, if it succeeds, the lock is released and true is
+// returned; if it fails with a readError, the lock is released and the
+// error is returned. Otherwise, the function releasing the lock is
+// returned.
+func (h *Helper) lockLogin(
+	ctx context.Context,
+	timer *requestTimer,
+	read func() error,
+	tried map[string]bool,
+) (func(), bool, error) {
+	if h.cacheDir == "" {
+		return func() {}, false, nil
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, h.authTimeout)
+	defer cancel()
+
+	unlock, err := cache.NewFileLock(filepath.Join(h.cacheDir, loginLockFile)).Lock(lockCtx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err := h.readWithCachedTokens(ctx, timer, read, false, tried)
+	if ok || isReadError(err) {
+		unlock()
+		return nil, ok, err
+	}
+
+	return unlock, false, nil
+}
+
+// getCredentials reads the Docker credentials of the registry from the
+// secret at path and warns if the secret does not match the pin. In ECR
+// token mode, they are exchanged for an authorization token of the
+// registry; in GCR token mode, an access token is obtained for registries
+// of Google Cloud and in ACR token mode, a refresh token for registries of
+// Azure. Credentials read from leased secrets are served from the
+// secret cache, if enabled, for as long as the lease is valid.
+func (h *Helper) getCredentials(ctx context.Context, registry, path string) (vault.Credentials, error) {
+	if h.secretCache != nil {
+		creds, ok := h.getCachedCredentials(ctx, path)
+		h.observeCache(cacheSecret, ok)
+
+		if ok {
+			return creds, nil
+		}
+	}
+
+	var (
+		creds vault.Credentials
+		err   error
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, h.authTimeout)
+	defer cancel()
+
+	switch {
+	case h.gcr != nil && gcpauth.IsRegistryHost(registry):
+		opts := *h.gcr
+		opts.Clock = h.clock
+		creds, err = vault.GetGCRCredentials(ctx, path, h.client, opts)
+	case h.acr != nil && azureauth.IsRegistryHost(registry):
+		opts := *h.acr
+		opts.Clock = h.clock
+		creds, err = vault.GetACRCredentials(ctx, path, h.client, registry, opts)
+	case h.ecr != nil:
+		opts := *h.ecr
+		opts.Clock = h.clock
+		creds, err = vault.GetECRCredentials(ctx, path, h.client, registry, opts)
+	default:
+		usernameKey, passwordKey := h.secret.FieldKeys(registry)
+		usernameTemplate, passwordTemplate := h.secret.Templates(registry)
+		keys := vault.FieldKeys{
+			Username:         usernameKey,
+			Password:         passwordKey,
+			IdentityToken:    h.secret.IdentityTokenKey(registry),
+			UsernameTemplate: usernameTemplate,
+			PasswordTemplate: passwordTemplate,
+			UsernamePath:     h.secret.UsernamePath(registry),
+			Clock:            h.clock,
+		}
+
+		if username, ok := h.secret.IdentityTokenUsername(registry); ok {
+			keys.IdentityTokenUsername = &username
+		}
+
+		creds, err = vault.GetCredentialsWithKeys(ctx, path, h.client, keys)
+	}
+
+	if err != nil {
+		return creds, err
+	}
+
+	h.observeSecret(normalizePath(path), creds.Fields)
+
+	for _, mismatch := range h.pin.Verify(path, creds.Fields) {
+		h.logger.Warn("secret does not match pinned response", "path", path, "mismatch", mismatch)
+	}
+
+	if h.ttlCache != nil {
+		if err = h.ttlCache.Store(path, creds.Username, creds.Password, creds.LeaseDuration); err != nil {
+			h.logger.Error("error caching secret", "error", err)
+		}
+	}
+
+	if h.coalesceCache != nil {
+		if err = h.coalesceCache.Store(path, creds.Username, creds.Password, creds.LeaseDuration); err != nil {
+			h.logger.Error("error sharing secret with concurrent requests", "error", err)
+		}
+	}
+
+	if h.staleCache != nil {
+		if err = h.staleCache.Store(path, creds.Username, creds.Password, creds.LeaseDuration); err != nil {
+			h.logger.Error("error caching last-known-good credentials", "error", err)
+		}
+	}
+
+	if h.secretCache != nil && creds.LeaseID != "" {
+		err = h.secretCache.Store(&cache.SecretEntry{
+			LeaseID:   creds.LeaseID,
+			Path:      path,
+			Username:  creds.Username,
+			Password:  creds.Password,
+			Renewable: creds.Renewable,
+			Expires:   h.clock.Now().Add(creds.LeaseDuration),
+			NotAfter:  creds.Expires,
+		})
+		if err != nil {
+			h.logger.Error("error caching secret", "error", err)
+		}
+	}
+
+	return creds, nil
+}
+
+// getCachedCredentials returns the cached credentials read from the secret
+// at path. Before they are returned, their lease is checked so that
+// credentials whose lease was revoked are never served.
+func (h *Helper) getCachedCredentials(ctx context.Context, path string) (vault.Credentials, bool) {
+	if h.secretCache == nil {
+		return vault.Credentials{}, false
+	}
+
+	entry, ok := h.secretCache.Lookup(path)
+	if !ok {
+		return vault.Credentials{}, false
+	}
+
+	ttl, err := vault.CheckLease(ctx, h.client, entry.LeaseID, entry.Renewable)
+	if err != nil {
+		// The token may not be valid or may not be allowed to check the
+		// lease, or Vault may be unavailable, but that doesn't mean the
+		// lease was revoked
+		if vault.IsPermissionDenied(err) || vault.IsUnavailable(err) {
+			h.logger.Info("unable to check lease of cached secret", "path", path, "error", err)
+			return vault.Credentials{}, false
+		}
+
+		h.logger.Info("invalidating cached secret", "path", path, "error", err)
+
+		if err = h.secretCache.Invalidate(entry.LeaseID); err != nil {
+			h.logger.Error("error invalidating cached secret", "error", err)
+		}
+
+		return vault.Credentials{}, false
+	}
+
+	if untilExpiry := entry.NotAfter.Sub(h.clock.Now()); !entry.NotAfter.IsZero() && untilExpiry < ttl {
+		ttl = untilExpiry
+	}
+
+	if ttl < minLeaseTTL {
+		// The lease has reached its max TTL (or the credentials are about
+		// to expire), so the credentials may expire before Docker is done
+		// with them. Read the secret again to get a new lease.
+		h.logger.Info("cached secret is about to expire", "path", path, "ttl", ttl)
+
+		if err = h.secretCache.Invalidate(entry.LeaseID); err != nil {
+			h.logger.Error("error invalidating cached secret", "error", err)
+		}
+
+		return vault.Credentials{}, false
+	}
+
+	if err = h.secretCache.Extend(entry.LeaseID, ttl); err != nil {
+		h.logger.Error("error updating cached secret", "error", err)
+	}
+
+	return vault.Credentials{
+		Username:      entry.Username,
+		Password:      entry.Password,
+		LeaseID:       entry.LeaseID,
+		LeaseDuration: ttl,
+		Renewable:     entry.Renewable,
+		Expires:       entry.NotAfter,
+	}, true
 }
 
 func (h *Helper) authenticate(ctx context.Context) (string, error) {
-	method, err := vault.BuildAuthMethod(h.authConfig.Method, h.logger)
+	if err := h.ensureAddress(ctx); err != nil {
+		return "", err
+	}
+
+	if token := h.unwrapBootstrap(); token != "" {
+		return token, nil
+	}
+
+	methods := append([]*config.Method{h.authConfig.Method}, h.fallbacks...)
+	if h.authConfig.Method.Type == agentMethod {
+		methods = h.fallbacks
+	}
+
+	method, err := vault.BuildAuthMethodChain(methods, h.logger, vault.MethodOptions{
+		CacheDir: h.cacheDir,
+		Clock:    h.clock,
+		Rand:     h.rand,
+	})
 	if err != nil {
 		return "", xerrors.Errorf("error creating auth method: %w", err)
 	}
@@ -202,26 +1113,84 @@ func (h *Helper) authenticate(ctx context.Context) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, h.authTimeout)
 	defer cancel()
 
+	// The auth handler confirms the login to the method, and shuts the
+	// method down, after it sends the token. It is waited for so that the
+	// state which the method persists, such as the health of failover
+	// methods, is written before the helper exits.
+	errCh := make(chan error, 1)
+
 	go func() {
-		if err := ah.Run(ctx, method); err != nil {
-			panic(err)
-		}
+		errCh <- ah.Run(ctx, method)
 	}()
 
 	var token string
 	select {
+	case err = <-errCh:
+		return "", h.authFailed(ctx, err)
 	case <-ctx.Done():
-		return "", xerrors.Errorf("failed to get credentials within timeout (%s)", h.authTimeout)
+		return "", h.authFailed(ctx, <-errCh)
 	case token = <-ah.OutputCh:
-		// will have to unwrap token if wrapped
 		h.logger.Info("successfully authenticated")
 	}
 	cancel()
 
+	if err = <-errCh; err != nil {
+		h.logger.Error("error stopping auth handler", "error", err)
+	}
+
+	// The auth response is wrapped if the method has a wrap_ttl, as with
+	// the Vault agent, but the helper needs the token itself
+	if h.authConfig.Method.WrapTTL != 0 {
+		if token, err = cache.UnwrapToken(token, h.client); err != nil {
+			return "", xerrors.Errorf("error unwrapping auth response: %w", err)
+		}
+	}
+
 	return token, nil
 }
 
+// authFailed returns the error of an auth handler which stopped without
+// sending a token. The auth handler only stops without an error once the
+// context is done.
+func (h *Helper) authFailed(ctx context.Context, err error) error {
+	if err != nil {
+		return xerrors.Errorf("error authenticating: %w", err)
+	}
+
+	return xerrors.Errorf("failed to get credentials within timeout (%s): %w", h.authTimeout, ctx.Err())
+}
+
+// unwrapBootstrap unwraps the wrapping token of the bootstrap, if any, and
+// returns the token it held. The wrapping token is only tried once; if it
+// fails, the helper authenticates with its methods instead.
+func (h *Helper) unwrapBootstrap() string {
+	if h.bootstrap == nil {
+		return ""
+	}
+
+	bootstrap := h.bootstrap
+	h.bootstrap = nil
+
+	token, err := bootstrap.Bootstrap(h.client)
+	if err != nil {
+		h.logger.Error("error bootstrapping from wrapping token; authenticating instead", "error", err)
+		return ""
+	}
+
+	if token != "" {
+		h.logger.Info("bootstrapped token from wrapping token")
+	}
+
+	return token
+}
+
 func (h *Helper) cacheToken(ctx context.Context, token string) {
+	if h.tokenCache != nil {
+		if err := h.tokenCache.Set(tokenCacheKey, []byte(token)); err != nil {
+			h.logger.Error("error caching token", "error", err)
+		}
+	}
+
 	sinks, err := vault.BuildSinks(h.authConfig.Sinks, h.logger, h.client)
 	if err != nil {
 		h.logger.Error("error building sinks; will not cache token", "error", err)
@@ -238,9 +1207,24 @@ func (h *Helper) cacheToken(ctx context.Context, token string) {
 		newTokenCh <- token
 
 		if err := ss.Run(ctx, newTokenCh, sinks); err != nil {
-			panic(err)
+			h.logger.Error("error writing token to sinks", "error", err)
 		}
 
 		close(newTokenCh)
 	}
 }
+
+// getCachedToken returns the token stored in the token cache, if any.
+func (h *Helper) getCachedToken() string {
+	if h.tokenCache == nil {
+		return ""
+	}
+
+	token, err := h.tokenCache.Get(tokenCacheKey)
+	if err != nil {
+		h.logger.Error("error reading cached token", "error", err)
+		return ""
+	}
+
+	return string(token)
+}
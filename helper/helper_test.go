@@ -15,10 +15,19 @@ package helper
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -33,7 +42,12 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
 
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
 	mciconfig "github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/harden"
+	mcivault "github.com/morningconsult/docker-credential-vault-login/vault"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
 )
 
 func TestHelper_Add(t *testing.T) {
@@ -59,13 +73,23 @@ func TestHelper_Delete(t *testing.T) {
 }
 
 func TestHelper_List(t *testing.T) {
-	h := New(Options{})
-	_, err := h.List()
-	if err == nil {
-		t.Fatal("expected an error")
+	h := New(Options{
+		Secret: mockSecretTable{
+			cfg: mockSecretTableConfig{registries: []string{"registry-1.example.com", "registry-2.example.com"}},
+		},
+	})
+
+	list, err := h.List()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if err.Error() != "not implemented" {
-		t.Fatalf("Errors differ:\n%v", cmp.Diff(err.Error(), "not implemented"))
+
+	expected := map[string]string{
+		"registry-1.example.com": "",
+		"registry-2.example.com": "",
+	}
+	if diff := cmp.Diff(expected, list); diff != "" {
+		t.Fatalf("Lists differ:\n%s", diff)
 	}
 }
 
@@ -401,13 +425,8 @@ auto_auth {
 			},
 		}
 		_, _, err = hh.Get("fake.registry.com")
-		if err == nil {
-			t.Fatal("expected an error")
-		}
-		gotErr := err.Error()
-		expectErr := `error parsing registry path: oops`
-		if gotErr != expectErr {
-			t.Errorf("Expected error:\n%s\nGot error:\n%s", expectErr, gotErr)
+		if !credentials.IsErrCredentialsNotFound(err) {
+			t.Fatalf("Expected credentials not found, got %v", err)
 		}
 	})
 
@@ -436,6 +455,117 @@ auto_auth {
 		}
 	})
 
+	// Test that a token which the helper obtained itself is replaced
+	// once it stops working
+	t.Run("reauthenticates-when-own-token-fails", func(t *testing.T) {
+		h.client.SetToken("expired token")
+		h.authToken = "expired token"
+		h.cacheEnabled = false
+
+		makeApproleFiles()
+
+		user, pw, err = h.Get("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if user != "test@user.com" {
+			t.Fatalf("Got username %q, expected \"test@user.com\"", user)
+		}
+		if pw != "secure password" {
+			t.Fatalf("Got password %q, expected \"secure password\"", pw)
+		}
+		if h.client.Token() == "expired token" {
+			t.Fatal("expected the helper to replace its expired token")
+		}
+	})
+
+	// Test that the fallback methods are tried when the method fails
+	t.Run("falls-back-to-next-method", func(t *testing.T) {
+		fallbackHCL := `
+auto_auth {
+	method "token_file" {
+		config = {
+			secret          = %q
+			token_file_path = %q
+		}
+	}
+
+	fallback_method "approle" {
+		mount_path = "auth/approle"
+		config     = {
+			role_id_file_path   = %q
+			secret_id_file_path = %q
+		}
+	}
+}`
+		fallbackHCL = fmt.Sprintf(fallbackHCL, secretPath, filepath.Join(testdata, "nonexistent-token"),
+			roleIDFile, secretIDFile)
+
+		if err = os.WriteFile(configFile, []byte(fallbackHCL), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err = mciconfig.LoadConfig(configFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fallbacks, err := mciconfig.LoadFallbackMethods(configFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hh := New(Options{
+			Logger:          hclog.NewNullLogger(),
+			Client:          client,
+			AuthTimeout:     3,
+			Secret:          h.secret,
+			AuthConfig:      config.AutoAuth,
+			FallbackMethods: fallbacks,
+		})
+
+		client.ClearToken()
+		makeApproleFiles()
+
+		user, pw, err = hh.Get("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if user != "test@user.com" {
+			t.Fatalf("Got username %q, expected \"test@user.com\"", user)
+		}
+		if pw != "secure password" {
+			t.Fatalf("Got password %q, expected \"secure password\"", pw)
+		}
+	})
+
+	// Test that secrets which don't match the pin are logged
+	t.Run("warns-when-secret-does-not-match-pin", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		h.logger = hclog.New(&hclog.LoggerOptions{
+			Output:      &buf,
+			Level:       hclog.Warn,
+			DisableTime: true,
+			JSONFormat:  true,
+		})
+		h.pin = &mcivault.ResponsePin{Keys: []string{"email", "password", "username"}}
+		defer func() { h.pin = nil }()
+
+		makeApproleFiles()
+
+		if _, _, err = h.Get(""); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := fmt.Sprintf(`{"@level":"warn","@message":"secret does not match pinned response","mismatch":"missing pinned keys: email","path":%q}`, secretPath)
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("\nExpected log to contain:\n\t%s\nReceived the following log(s):\n\t%s",
+				expected, buf.String())
+		}
+	})
+
 	// Ensure that if the client attempts to read the secret with
 	// a bad token it fails
 	t.Run("fails-when-bad-token-used", func(t *testing.T) {
@@ -538,17 +668,1639 @@ func TestHelper_Get_FastTimeout(t *testing.T) {
 	}
 }
 
-type mockSecretTableConfig struct {
-	getPath func(string) (string, error)
+func TestHelper_Get_HelperTimeout(t *testing.T) {
+	// Vault accepts the requests but never responds to them
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	buf := bytes.Buffer{}
+	logger := hclog.New(&hclog.LoggerOptions{
+		Level:  hclog.Error,
+		Output: &buf,
+	})
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetMaxRetries(0)
+	client.SetToken("s.token")
+
+	config, err := config.LoadConfig("testdata/valid.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(Options{
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(path string) (string, error) {
+					return "secret/docker/creds", nil
+				},
+			},
+		},
+		Logger:     logger,
+		Client:     client,
+		AuthConfig: config.AutoAuth,
+		Timeout:    200 * time.Millisecond,
+	})
+
+	start := time.Now()
+	_, _, err = h.Get("")
+	if !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("Expected credentials not found, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the request to be cancelled after the timeout, but it took %s", elapsed)
+	}
+
+	expected := "credential request timed out"
+	if !strings.Contains(buf.String(), expected) {
+		t.Fatalf("Expected log file to contain:\n\t%q\nGot this instead:\n\t%s", expected, buf.String())
+	}
 }
 
-type mockSecretTable struct {
-	cfg mockSecretTableConfig
+func TestHelper_Get_CircuitBreaker(t *testing.T) {
+	secretPath := "secret/docker/creds"
+
+	// Vault is sealed
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"errors":["Vault is sealed"]}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	config, err := config.LoadConfig("testdata/valid.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newHelper := func(t *testing.T, secretCache *cache.SecretCache, serveStale bool) *Helper {
+		client, err := api.NewClient(&api.Config{Address: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SetMaxRetries(0)
+		client.SetToken("s.token")
+
+		return New(Options{
+			Secret: mockSecretTable{
+				mockSecretTableConfig{
+					getPath: func(path string) (string, error) {
+						return secretPath, nil
+					},
+				},
+			},
+			Logger:      hclog.NewNullLogger(),
+			Client:      client,
+			AuthConfig:  config.AutoAuth,
+			CacheDir:    t.TempDir(),
+			SecretCache: secretCache,
+			Breaker:     &BreakerOptions{Threshold: 2, Cooldown: time.Minute, ServeStale: serveStale},
+		})
+	}
+
+	t.Run("fails-fast", func(t *testing.T) {
+		h := newHelper(t, nil, false)
+
+		mu.Lock()
+		requests = 0
+		mu.Unlock()
+
+		for i := 0; i < 4; i++ {
+			if _, _, err := h.Get("registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+				t.Fatalf("Expected credentials not found, got %v", err)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if requests != 2 {
+			t.Fatalf("Expected Vault to be requested %d times, got %d", 2, requests)
+		}
+	})
+
+	t.Run("serves-stale", func(t *testing.T) {
+		secretCache := cache.NewSecretCache(hclog.NewNullLogger(), cache.NewMemoryCache())
+		err := secretCache.Store(&cache.SecretEntry{
+			LeaseID:  "secret/docker/creds/lease",
+			Path:     secretPath,
+			Username: "cached-user",
+			Password: "cached-password",
+			Expires:  time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h := newHelper(t, secretCache, true)
+
+		// The lease cannot be checked until the circuit opens
+		for i := 0; i < 2; i++ {
+			if _, _, err = h.Get("registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+				t.Fatalf("Expected credentials not found, got %v", err)
+			}
+		}
+
+		username, password, err := h.Get("registry.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != "cached-user" || password != "cached-password" {
+			t.Fatalf("Expected the cached credentials, got %q/%q", username, password)
+		}
+	})
 }
 
-func (m mockSecretTable) GetPath(path string) (string, error) {
-	if m.cfg.getPath == nil {
-		return "", nil
+func TestHelper_Get_VaultAgent(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	sinkFile := filepath.Join(dir, "agent-token")
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	authConfig := &config.AutoAuth{
+		Method: &config.Method{Type: "vault_agent"},
+		Sinks: []*config.Sink{
+			{
+				Type:   "file",
+				Config: map[string]interface{}{"path": sinkFile},
+			},
+		},
+	}
+	fallbacks := []*config.Method{
+		{
+			Type:      "approle",
+			MountPath: "auth/approle",
+			Config: map[string]interface{}{
+				"role_id_file_path":                   roleIDFile,
+				"secret_id_file_path":                 secretIDFile,
+				"remove_secret_id_file_after_reading": false,
+			},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		token     string
+		fallbacks []*config.Method
+		err       bool
+		logins    int
+	}{
+		{
+			name:  "uses-agent-token",
+			token: fake.RootToken(),
+		},
+		{
+			name:  "no-usable-agent-token",
+			token: "bad token",
+			err:   true,
+		},
+		{
+			name:      "falls-back-when-no-usable-agent-token",
+			token:     "bad token",
+			fallbacks: fallbacks,
+			logins:    1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(sinkFile, []byte(tc.token), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			logins := fake.Requests("auth/approle/login")
+
+			h := New(Options{
+				Logger:      hclog.NewNullLogger(),
+				Client:      fake.Client(),
+				AuthTimeout: 3,
+				Secret: mockSecretTable{
+					mockSecretTableConfig{
+						getPath: func(string) (string, error) {
+							return "secret/docker/creds", nil
+						},
+					},
+				},
+				AuthConfig:      authConfig,
+				EnableCache:     true,
+				FallbackMethods: tc.fallbacks,
+			})
+
+			user, pw, err := h.Get("")
+			if tc.err {
+				if !credentials.IsErrCredentialsNotFound(err) {
+					t.Fatalf("Expected a credentials not found error, got %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if user != "test@user.com" {
+					t.Fatalf("Got username %q, expected \"test@user.com\"", user)
+				}
+				if pw != "secure password" {
+					t.Fatalf("Got password %q, expected \"secure password\"", pw)
+				}
+			}
+
+			if n := fake.Requests("auth/approle/login") - logins; n != tc.logins {
+				t.Fatalf("Expected %d login(s), got %d", tc.logins, n)
+			}
+			if n := fake.Requests("auth/token/renew-self"); tc.logins == 0 && n != 0 {
+				t.Fatalf("Expected the agent's token not to be renewed but it was renewed %d time(s)", n)
+			}
+
+			// The agent's sink must never be overwritten
+			data, err := os.ReadFile(sinkFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.token {
+				t.Fatalf("Expected sink to contain %q, got %q", tc.token, string(data))
+			}
+		})
+	}
+}
+
+func TestHelper_Get_WrappedAuth(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	sinkFile := filepath.Join(dir, "token")
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := New(Options{
+		Logger:      hclog.NewNullLogger(),
+		Client:      fake.Client(),
+		AuthTimeout: 3,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return "secret/docker/creds", nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{
+			Method: &config.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				WrapTTL:   5 * time.Minute,
+				Config: map[string]interface{}{
+					"role_id_file_path":                   roleIDFile,
+					"secret_id_file_path":                 secretIDFile,
+					"remove_secret_id_file_after_reading": false,
+				},
+			},
+			Sinks: []*config.Sink{
+				{
+					Type:   "file",
+					Config: map[string]interface{}{"path": sinkFile},
+				},
+			},
+		},
+		EnableCache: true,
+	})
+
+	user, pw, err := h.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "test@user.com" || pw != "secure password" {
+		t.Fatalf("Got credentials %q/%q, expected \"test@user.com\"/\"secure password\"", user, pw)
+	}
+
+	// The unwrapped token is cached, since the wrapping token is single-use
+	data, err := os.ReadFile(sinkFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := string(data); token != "hvs.fake-token-1" {
+		t.Fatalf("Expected the sink to contain %q, got %q", "hvs.fake-token-1", token)
+	}
+}
+
+func TestHelper_Get_LeasedSecrets(t *testing.T) {
+	secretPath := "registry/creds/ci"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithDynamicSecret(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}, time.Hour),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	secretCache := cache.NewSecretCache(hclog.NewNullLogger(), cache.NewFileCache(t.TempDir()))
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig:  &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		SecretCache: secretCache,
+	})
+
+	get := func(t *testing.T, reads, renewals int) {
+		user, pw, err := h.Get("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user != "test@user.com" {
+			t.Fatalf("Got username %q, expected \"test@user.com\"", user)
+		}
+		if pw != "secure password" {
+			t.Fatalf("Got password %q, expected \"secure password\"", pw)
+		}
+		if n := fake.Requests(secretPath); n != reads {
+			t.Fatalf("Expected %d read(s) of the secret, got %d", reads, n)
+		}
+		if n := fake.Requests("sys/leases/renew"); n != renewals {
+			t.Fatalf("Expected %d lease renewal(s), got %d", renewals, n)
+		}
+	}
+
+	t.Run("caches-leased-secret", func(t *testing.T) {
+		get(t, 1, 0)
+		get(t, 1, 1)
+	})
+
+	t.Run("invalidates-revoked-lease", func(t *testing.T) {
+		entry, ok := secretCache.Lookup(secretPath)
+		if !ok {
+			t.Fatal("expected the secret to be cached")
+		}
+		fake.RevokeLease(entry.LeaseID)
+
+		get(t, 2, 2)
+
+		newEntry, ok := secretCache.Lookup(secretPath)
+		if !ok {
+			t.Fatal("expected the secret to be cached")
+		}
+		if newEntry.LeaseID == entry.LeaseID {
+			t.Fatal("expected the revoked lease to be replaced")
+		}
+	})
+}
+
+func TestHelper_Get_ExpiringLease(t *testing.T) {
+	secretPath := "database/creds/registry"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithDynamicSecret(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}, minLeaseTTL/2),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig:  &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		SecretCache: cache.NewSecretCache(hclog.NewNullLogger(), cache.NewFileCache(t.TempDir())),
+	})
+
+	for i := 1; i <= 2; i++ {
+		if _, _, err := h.Get(""); err != nil {
+			t.Fatal(err)
+		}
+		if n := fake.Requests(secretPath); n != i {
+			t.Fatalf("Expected %d read(s) of the secret, got %d", i, n)
+		}
+	}
+}
+
+func TestHelper_Get_TTLCache(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	ttlCache := cache.NewTTLCache(hclog.NewNullLogger(), cache.NewFileCache(t.TempDir()), time.Hour)
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		TTLCache:   ttlCache,
+	})
+
+	for i := 0; i < 3; i++ {
+		user, pw, err := h.Get("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user != "test@user.com" || pw != "secure password" {
+			t.Fatalf("Got credentials %q/%q, expected \"test@user.com\"/\"secure password\"", user, pw)
+		}
+	}
+
+	if n := fake.Requests(secretPath); n != 1 {
+		t.Fatalf("Expected 1 read of the secret, got %d", n)
+	}
+
+	if err := h.PurgeCache(); err != nil {
+		t.Fatal(err)
+	}
+	if ttlCache.Len() != 0 {
+		t.Fatalf("Expected the cache to be purged, got %d entries", ttlCache.Len())
+	}
+}
+
+func TestHelper_Get_SelectAddress(t *testing.T) {
+	secretPath := "secret/docker/creds"
+
+	cases := []struct {
+		name      string
+		cached    bool
+		selectErr error
+		selects   int
+		err       bool
+	}{
+		{
+			name:    "selected-once",
+			selects: 1,
+		},
+		{
+			name:   "cache-hit",
+			cached: true,
+		},
+		{
+			name:      "no-node-available",
+			selectErr: errors.New("no Vault node is available"),
+			selects:   3,
+			err:       true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := vaultlogintest.NewFakeVault(t,
+				vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+					"username": "test@user.com",
+					"password": "secure password",
+				}),
+			)
+			client := fake.Client()
+			client.SetToken(fake.RootToken())
+
+			ttlCache := cache.NewTTLCache(hclog.NewNullLogger(), cache.NewMemoryCache(), time.Hour)
+			if tc.cached {
+				if err := ttlCache.Store(secretPath, "test@user.com", "secure password", 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			selects := 0
+
+			h := New(Options{
+				Logger: hclog.NewNullLogger(),
+				Client: client,
+				Secret: mockSecretTable{
+					mockSecretTableConfig{
+						getPath: func(string) (string, error) {
+							return secretPath, nil
+						},
+					},
+				},
+				AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+				TTLCache:   ttlCache,
+				SelectAddress: func(context.Context) error {
+					selects++
+					return tc.selectErr
+				},
+			})
+
+			for i := 0; i < 3; i++ {
+				// Unless the secret was cached beforehand, it is read
+				// from Vault every time
+				if i > 0 && !tc.cached {
+					if err := ttlCache.Purge(); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				_, _, err := h.Get("")
+				if tc.err {
+					if err == nil {
+						t.Fatal("expected an error but didn't receive one")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if selects != tc.selects {
+				t.Fatalf("Expected the address to be selected %d times, got %d", tc.selects, selects)
+			}
+		})
+	}
+}
+
+func TestHelper_Get_StaleCache(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+	client.SetMaxRetries(0)
+
+	clk := clock.NewFake(time.Now())
+	staleCache := cache.NewStaleCache(hclog.NewNullLogger(), cache.NewFileCache(t.TempDir()), time.Hour)
+	staleCache.SetClock(clk)
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		StaleCache: staleCache,
+	})
+
+	if _, _, err := h.Get(""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Vault becomes unreachable
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	if err := client.SetAddress(down.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	user, pw, err := h.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "test@user.com" || pw != "secure password" {
+		t.Fatalf("Got credentials %q/%q, expected \"test@user.com\"/\"secure password\"", user, pw)
+	}
+
+	clk.Advance(time.Hour)
+
+	if _, _, err = h.Get(""); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("Expected credentials not found after the staleness window, got %v", err)
+	}
+}
+
+func TestHelper_Get_Scrubber(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	scrubber := harden.NewScrubber()
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		Scrubber:   scrubber,
+	})
+
+	if _, _, err := h.Get(""); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "logged in with " + fake.RootToken() + " as test@user.com with secure password"
+	expected := "logged in with [REDACTED] as test@user.com with [REDACTED]"
+
+	if scrubbed := scrubber.Scrub(text); scrubbed != expected {
+		t.Fatalf("Expected %q, got %q", expected, scrubbed)
+	}
+}
+
+func TestHelper_Get_FieldKeys(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"user": "test@user.com",
+			"pass": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+				usernameKey: "user",
+				passwordKey: "pass",
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+	})
+
+	user, pw, err := h.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "test@user.com" || pw != "secure password" {
+		t.Fatalf("Got credentials %q/%q, expected \"test@user.com\"/\"secure password\"", user, pw)
+	}
+}
+
+func TestHelper_Get_UsernamePath(t *testing.T) {
+	secretPath := "ad/creds/docker"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithDynamicSecret(secretPath, map[string]interface{}{
+			"current_password": "rotated password",
+		}, time.Hour),
+		vaultlogintest.WithKVv2("secret/data/docker/user", map[string]interface{}{
+			"username": "svc-docker",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+				usernamePath: "secret/data/docker/user",
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+	})
+
+	user, pw, err := h.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "svc-docker" || pw != "rotated password" {
+		t.Fatalf("Got credentials %q/%q, expected \"svc-docker\"/\"rotated password\"", user, pw)
+	}
+}
+
+func TestHelper_Get_IdentityToken(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"refresh_token": "eyJhbGciOiJSUzI1NiJ9",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+				identityTokenKey: "refresh_token",
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+	})
+
+	user, token, err := h.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "<token>" || token != "eyJhbGciOiJSUzI1NiJ9" {
+		t.Fatalf("Got credentials %q/%q, expected \"<token>\"/\"eyJhbGciOiJSUzI1NiJ9\"", user, token)
+	}
+}
+
+func TestHelper_Get_IdentityTokenUsername(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"token": "ghp_vaultminted",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	empty, custom := "", "ci-bot"
+
+	cases := []struct {
+		name          string
+		tokenUsername *string
+		expected      string
+	}{
+		{"default", nil, "<token>"},
+		{"empty", &empty, ""},
+		{"custom", &custom, "ci-bot"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			h := New(Options{
+				Logger: hclog.NewNullLogger(),
+				Client: client,
+				Secret: mockSecretTable{
+					mockSecretTableConfig{
+						getPath: func(string) (string, error) {
+							return secretPath, nil
+						},
+						identityTokenKey: "token",
+						tokenUsername:    tc.tokenUsername,
+					},
+				},
+				AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+			})
+
+			user, token, err := h.Get("ghcr.io")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user != tc.expected || token != "ghp_vaultminted" {
+				t.Fatalf("Got credentials %q/%q, expected %q/\"ghp_vaultminted\"", user, token, tc.expected)
+			}
+		})
+	}
+}
+
+type mockSecretTableConfig struct {
+	getPath          func(string) (string, error)
+	usernameKey      string
+	passwordKey      string
+	identityTokenKey string
+	tokenUsername    *string
+	usernameTemplate string
+	passwordTemplate string
+	usernamePath     string
+	registries       []string
+}
+
+type mockSecretTable struct {
+	cfg mockSecretTableConfig
+}
+
+func (m mockSecretTable) GetPath(path string) (string, error) {
+	if m.cfg.getPath == nil {
+		return "", nil
+	}
+	return m.cfg.getPath(path)
+}
+
+func (m mockSecretTable) FieldKeys(string) (string, string) {
+	return m.cfg.usernameKey, m.cfg.passwordKey
+}
+
+func (m mockSecretTable) IdentityTokenKey(string) string {
+	return m.cfg.identityTokenKey
+}
+
+func (m mockSecretTable) IdentityTokenUsername(string) (string, bool) {
+	if m.cfg.tokenUsername == nil {
+		return "", false
+	}
+	return *m.cfg.tokenUsername, true
+}
+
+func (m mockSecretTable) Templates(string) (string, string) {
+	return m.cfg.usernameTemplate, m.cfg.passwordTemplate
+}
+
+func (m mockSecretTable) UsernamePath(string) string {
+	return m.cfg.usernamePath
+}
+
+func (m mockSecretTable) Registries() []string {
+	return m.cfg.registries
+}
+
+func TestHelper_Get_Bootstrap(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	cases := []struct {
+		name      string
+		bootstrap func(secretIDFile string) *mcivault.BootstrapOptions
+		logins    int
+	}{
+		{
+			name: "token",
+			bootstrap: func(string) *mcivault.BootstrapOptions {
+				wrappingToken, _ := fake.WrapToken()
+				return &mcivault.BootstrapOptions{WrappingToken: wrappingToken}
+			},
+		},
+		{
+			name: "secret-id",
+			bootstrap: func(secretIDFile string) *mcivault.BootstrapOptions {
+				return &mcivault.BootstrapOptions{
+					WrappingToken: fake.WrapData(map[string]interface{}{"secret_id": "secret-id"}),
+					SecretIDFile:  secretIDFile,
+				}
+			},
+			logins: 1,
+		},
+		{
+			name: "used-wrapping-token",
+			bootstrap: func(secretIDFile string) *mcivault.BootstrapOptions {
+				if err := os.WriteFile(secretIDFile, []byte("secret-id"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				return &mcivault.BootstrapOptions{WrappingToken: "hvs.used", SecretIDFile: secretIDFile}
+			},
+			logins: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			roleIDFile := filepath.Join(dir, "role-id")
+			secretIDFile := filepath.Join(dir, "secret-id")
+			if err := os.WriteFile(roleIDFile, []byte("role-id"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			logins := fake.Requests("auth/approle/login")
+
+			h := New(Options{
+				Logger:      hclog.NewNullLogger(),
+				Client:      fake.Client(),
+				AuthTimeout: 3,
+				Secret: mockSecretTable{
+					mockSecretTableConfig{
+						getPath: func(string) (string, error) {
+							return secretPath, nil
+						},
+					},
+				},
+				AuthConfig: &config.AutoAuth{
+					Method: &config.Method{
+						Type:      "approle",
+						MountPath: "auth/approle",
+						Config: map[string]interface{}{
+							"role_id_file_path":   roleIDFile,
+							"secret_id_file_path": secretIDFile,
+						},
+					},
+				},
+				Bootstrap: tc.bootstrap(secretIDFile),
+			})
+
+			username, password, err := h.Get("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username != "test@user.com" || password != "secure password" {
+				t.Fatalf("Unexpected credentials %q, %q", username, password)
+			}
+			if n := fake.Requests("auth/approle/login") - logins; n != tc.logins {
+				t.Fatalf("Expected %d logins, got %d", tc.logins, n)
+			}
+		})
+	}
+}
+
+func TestHelper_Get_Exec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+
+	writeScript := func(t *testing.T, script string) string {
+		path := filepath.Join(t.TempDir(), "script.sh")
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	cases := []struct {
+		name           string
+		method         string
+		credentialExec string
+		username       string
+		password       string
+		reads          int
+	}{
+		{
+			name:     "auth-method",
+			method:   fmt.Sprintf(`echo '{"token": "%s"}'`, fake.RootToken()),
+			username: "test@user.com",
+			password: "secure password",
+			reads:    1,
+		},
+		{
+			name:           "credential-exec",
+			credentialExec: `echo '{"username": "exec", "password": "exec password"}'`,
+			username:       "exec",
+			password:       "exec password",
+		},
+		{
+			name:           "credential-exec-without-credentials",
+			credentialExec: `echo '{}'`,
+			username:       "test@user.com",
+			password:       "secure password",
+			reads:          1,
+		},
+		{
+			name:           "credential-exec-failure",
+			credentialExec: `exit 1`,
+			username:       "test@user.com",
+			password:       "secure password",
+			reads:          1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := &config.Method{Type: "token"}
+			client := fake.Client()
+
+			if tc.method != "" {
+				method = &config.Method{
+					Type:      "exec",
+					MountPath: "auth/token",
+					Config:    map[string]interface{}{"command": writeScript(t, tc.method)},
+				}
+			} else {
+				client.SetToken(fake.RootToken())
+			}
+
+			var credentialExec *mcivault.ExecOptions
+			if tc.credentialExec != "" {
+				credentialExec = &mcivault.ExecOptions{
+					Command: []string{writeScript(t, tc.credentialExec)},
+					Timeout: 10 * time.Second,
+				}
+			}
+
+			reads := fake.Requests(secretPath)
+
+			h := New(Options{
+				Logger:      hclog.NewNullLogger(),
+				Client:      client,
+				AuthTimeout: 3,
+				Secret: mockSecretTable{
+					mockSecretTableConfig{
+						getPath: func(string) (string, error) {
+							return secretPath, nil
+						},
+					},
+				},
+				AuthConfig:     &config.AutoAuth{Method: method},
+				CredentialExec: credentialExec,
+			})
+
+			username, password, err := h.Get("registry.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username != tc.username || password != tc.password {
+				t.Fatalf("Unexpected credentials %q, %q", username, password)
+			}
+			if n := fake.Requests(secretPath) - reads; n != tc.reads {
+				t.Fatalf("Expected %d reads of the secret, got %d", tc.reads, n)
+			}
+		})
+	}
+}
+
+func TestHelper_Get_AgentProxy(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+
+	vaultURL, err := url.Parse(fake.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent's API proxy adds its auto-auth token to requests without one
+	var (
+		mu     sync.Mutex
+		tokens []string
+	)
+
+	proxy := httputil.NewSingleHostReverseProxy(vaultURL)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+
+		mu.Lock()
+		tokens = append(tokens, r.Header.Get(api.AuthHeaderName))
+		mu.Unlock()
+
+		if r.Header.Get(api.AuthHeaderName) == "" {
+			r.Header.Set(api.AuthHeaderName, fake.RootToken())
+		}
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := httptest.NewUnstartedServer(proxy)
+	agent.Listener = ln
+	agent.Start()
+	defer agent.Close()
+
+	t.Setenv(api.EnvVaultAddress, "")
+	t.Setenv(api.EnvVaultToken, "")
+
+	method := &config.Method{Type: "vault_agent_proxy"}
+
+	client, err := mcivault.NewClient(method, &config.Vault{Address: "unix://" + socket})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: client,
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: method},
+	})
+
+	username, password, err := h.Get("registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "test@user.com" || password != "secure password" {
+		t.Fatalf("Unexpected credentials %q, %q", username, password)
+	}
+	mu.Lock()
+	sent := tokens
+	mu.Unlock()
+
+	if diff := cmp.Diff([]string{""}, sent); diff != "" {
+		t.Fatalf("Expected one request without a token:\n%s", diff)
+	}
+
+	t.Run("maintain", func(t *testing.T) {
+		wait, err := h.Maintain(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 {
+			t.Fatalf("Expected nothing to renew, got a wait of %v", wait)
+		}
+	})
+}
+
+func TestHelper_Get_StaticFallback(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+
+	static, err := mciconfig.BuildStaticCredentials(map[string]interface{}{
+		"allow_static_fallback": true,
+		"static_credentials": []map[string]interface{}{{
+			"registry.example.com": []map[string]interface{}{{
+				"username":     "break-glass",
+				"password_env": "TEST_STATIC_PASSWORD",
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		registry string
+		path     string
+		pathErr  error
+		password string
+		username string
+		err      bool
+		logged   bool
+	}{
+		{
+			name:     "vault-used",
+			registry: "registry.example.com",
+			path:     secretPath,
+			password: "static password",
+			username: "test@user.com",
+		},
+		{
+			name:     "vault-fails",
+			registry: "registry.example.com",
+			path:     "secret/docker/missing",
+			password: "static password",
+			username: "break-glass",
+			logged:   true,
+		},
+		{
+			name:     "registry-not-configured",
+			registry: "registry.example.com:443",
+			pathErr:  errors.New("registry not found in configuration"),
+			password: "static password",
+			err:      true,
+		},
+		{
+			name:     "registry-not-configured-static-used",
+			registry: "https://registry.example.com/v2/",
+			pathErr:  errors.New("registry not found in configuration"),
+			password: "static password",
+			username: "break-glass",
+			logged:   true,
+		},
+		{
+			name:     "password-env-not-set",
+			registry: "registry.example.com",
+			path:     "secret/docker/missing",
+			err:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_STATIC_PASSWORD", tc.password)
+
+			client := fake.Client()
+			client.SetToken(fake.RootToken())
+
+			var logs bytes.Buffer
+
+			h := New(Options{
+				Logger: hclog.New(&hclog.LoggerOptions{Output: &logs}),
+				Client: client,
+				Secret: mockSecretTable{
+					mockSecretTableConfig{
+						getPath: func(string) (string, error) {
+							return tc.path, tc.pathErr
+						},
+					},
+				},
+				AuthConfig:        &config.AutoAuth{Method: &config.Method{Type: "token"}},
+				StaticCredentials: static,
+			})
+
+			user, pw, err := h.Get(tc.registry)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user != tc.username {
+				t.Fatalf("Got username %q, expected %q", user, tc.username)
+			}
+
+			if tc.username == "break-glass" && pw != tc.password {
+				t.Fatalf("Got password %q, expected %q", pw, tc.password)
+			}
+
+			if logged := strings.Contains(logs.String(), "BREAK-GLASS"); logged != tc.logged {
+				t.Fatalf("Expected the use of the static credentials to be logged: %t, got logs:\n%s",
+					tc.logged, logs.String())
+			}
+		})
+	}
+}
+
+func TestHelper_Get_TokenCache(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tokenCache := cache.NewMemoryCache()
+
+	newHelper := func() *Helper {
+		return New(Options{
+			Logger: hclog.NewNullLogger(),
+			Client: fake.Client(),
+			Secret: mockSecretTable{
+				mockSecretTableConfig{
+					getPath: func(string) (string, error) {
+						return secretPath, nil
+					},
+				},
+			},
+			EnableCache: true,
+			AuthConfig: &config.AutoAuth{Method: &config.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":                   roleIDFile,
+					"secret_id_file_path":                 secretIDFile,
+					"remove_secret_id_file_after_reading": false,
+				},
+			}},
+			TokenCache: tokenCache,
+		})
+	}
+
+	// Each helper stands for an invocation of the helper
+	for i := 0; i < 3; i++ {
+		user, pw, err := newHelper().Get("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user != "test@user.com" || pw != "secure password" {
+			t.Fatalf("Got credentials %q/%q, expected \"test@user.com\"/\"secure password\"", user, pw)
+		}
+	}
+
+	if n := fake.Requests("auth/approle/login"); n != 1 {
+		t.Fatalf("Expected 1 login, got %d", n)
+	}
+
+	h := newHelper()
+	if err := h.PurgeCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, _ := tokenCache.Get(tokenCacheKey); token != nil {
+		t.Fatal("expected the cached token to be purged")
+	}
+
+	if _, _, err := h.Get(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := fake.Requests("auth/approle/login"); n != 2 {
+		t.Fatalf("Expected 2 logins, got %d", n)
+	}
+}
+
+// TestHelper_Get_Concurrent checks that helpers which share the cache
+// directory, like concurrent invocations of the helper, log in only once.
+func TestHelper_Get_Concurrent(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+		vaultlogintest.WithLoginBehavior("role-id", vaultlogintest.RespondSuccess().After(100*time.Millisecond)),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newHelper := func() *Helper {
+		return New(Options{
+			Logger: hclog.NewNullLogger(),
+			Client: fake.Client(),
+			Secret: mockSecretTable{
+				mockSecretTableConfig{
+					getPath: func(string) (string, error) {
+						return secretPath, nil
+					},
+				},
+			},
+			EnableCache: true,
+			AuthConfig: &config.AutoAuth{Method: &config.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":                   roleIDFile,
+					"secret_id_file_path":                 secretIDFile,
+					"remove_secret_id_file_after_reading": false,
+				},
+			}},
+			CacheDir:   dir,
+			TokenCache: cache.NewFileCache(dir),
+		})
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		h := newHelper()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, _, err := h.Get(""); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := fake.Requests("auth/approle/login"); n != 1 {
+		t.Fatalf("Expected 1 login, got %d", n)
+	}
+}
+
+// TestHelper_Get_ConcurrentCalls checks that concurrent calls to Get of
+// one helper, like the requests of the socket server, log in only once.
+func TestHelper_Get_ConcurrentCalls(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+		vaultlogintest.WithLoginBehavior("role-id", vaultlogintest.RespondSuccess().After(100*time.Millisecond)),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: fake.Client(),
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{
+			Type:      "approle",
+			MountPath: "auth/approle",
+			Config: map[string]interface{}{
+				"role_id_file_path":                   roleIDFile,
+				"secret_id_file_path":                 secretIDFile,
+				"remove_secret_id_file_after_reading": false,
+			},
+		}},
+	})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, _, err := h.Get(""); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := fake.Requests("auth/approle/login"); n != 1 {
+		t.Fatalf("Expected 1 login, got %d", n)
+	}
+}
+
+func TestHelper_Get_Coalesced(t *testing.T) {
+	secretPath := "secret/docker/creds"
+
+	cases := []struct {
+		name     string
+		coalesce bool
+		reads    int
+	}{
+		{
+			name:  "not-coalesced",
+			reads: 5,
+		},
+		{
+			name:     "coalesced",
+			coalesce: true,
+			reads:    1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := vaultlogintest.NewFakeVault(t,
+				vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+					"username": "test@user.com",
+					"password": "secure password",
+				}),
+				vaultlogintest.WithAppRole("role-id", "secret-id"),
+				vaultlogintest.WithLoginBehavior("role-id", vaultlogintest.RespondSuccess().After(100*time.Millisecond)),
+			)
+
+			dir := t.TempDir()
+			roleIDFile := filepath.Join(dir, "role-id")
+			secretIDFile := filepath.Join(dir, "secret-id")
+			for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+				if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			store := cache.NewFileCache(dir)
+
+			newHelper := func() *Helper {
+				var coalesceCache *cache.TTLCache
+				if tc.coalesce {
+					coalesceCache = cache.NewCoalesceCache(hclog.NewNullLogger(), store, 5*time.Second)
+				}
+
+				return New(Options{
+					Logger: hclog.NewNullLogger(),
+					Client: fake.Client(),
+					Secret: mockSecretTable{
+						mockSecretTableConfig{
+							getPath: func(string) (string, error) {
+								return secretPath, nil
+							},
+						},
+					},
+					EnableCache: true,
+					AuthConfig: &config.AutoAuth{Method: &config.Method{
+						Type:      "approle",
+						MountPath: "auth/approle",
+						Config: map[string]interface{}{
+							"role_id_file_path":                   roleIDFile,
+							"secret_id_file_path":                 secretIDFile,
+							"remove_secret_id_file_after_reading": false,
+						},
+					}},
+					CacheDir:      dir,
+					TokenCache:    store,
+					CoalesceCache: coalesceCache,
+				})
+			}
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < 5; i++ {
+				h := newHelper()
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					username, password, err := h.Get("")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if username != "test@user.com" || password != "secure password" {
+						t.Errorf("Expected the credentials of the secret, got %q and %q", username, password)
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			if n := fake.Requests("auth/approle/login"); n != 1 {
+				t.Fatalf("Expected 1 login, got %d", n)
+			}
+			if n := fake.Requests(secretPath); n != tc.reads {
+				t.Fatalf("Expected %d reads of the secret, got %d", tc.reads, n)
+			}
+		})
 	}
-	return m.cfg.getPath(path)
 }
@@ -0,0 +1,154 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/telemetry"
+)
+
+// The phases of a credential request which are timed.
+const (
+	phaseReadSecret   = "read_secret"
+	phaseTokenCache   = "token_cache"
+	phaseAuthenticate = "authenticate"
+	phaseSink         = "sink"
+)
+
+// phases lists the phases in the order in which they are reported.
+var phases = []string{phaseTokenCache, phaseAuthenticate, phaseSink, phaseReadSecret}
+
+// requestTimer measures how long a credential request spends in each
+// phase. A phase may be entered more than once, in which case its
+// durations are added up. If the request is traced, every phase entered
+// is also recorded as a child span of the span of the request.
+type requestTimer struct {
+	clock   clock.Clock
+	start   time.Time
+	phases  map[string]time.Duration
+	current string
+	since   time.Time
+
+	tracer *telemetry.Tracer
+	root   *telemetry.Span
+	span   *telemetry.Span
+}
+
+func newRequestTimer(clk clock.Clock) *requestTimer {
+	now := clk.Now()
+
+	return &requestTimer{
+		clock:  clk,
+		start:  now,
+		phases: make(map[string]time.Duration),
+		since:  now,
+	}
+}
+
+// trace records the phases of the request as children of root.
+func (t *requestTimer) trace(tracer *telemetry.Tracer, root *telemetry.Span) {
+	t.tracer = tracer
+	t.root = root
+}
+
+// enter ends the current phase, if any, and begins the named one.
+func (t *requestTimer) enter(phase string) {
+	now := t.clock.Now()
+
+	if t.current != "" {
+		t.phases[t.current] += now.Sub(t.since)
+	}
+
+	t.span.End(nil)
+	t.span = nil
+
+	if phase != "" {
+		t.span = t.tracer.Start(phase, t.root)
+	}
+
+	t.current = phase
+	t.since = now
+}
+
+// stop ends the current phase and returns the total duration of the
+// request.
+func (t *requestTimer) stop() time.Duration {
+	t.enter("")
+	return t.since.Sub(t.start)
+}
+
+// slowest returns the phase in which the request spent the most time.
+func (t *requestTimer) slowest() string {
+	var (
+		slowest string
+		max     time.Duration
+	)
+
+	for _, phase := range phases {
+		if d := t.phases[phase]; d > max {
+			slowest, max = phase, d
+		}
+	}
+
+	return slowest
+}
+
+// observeRequest exports the duration of the request and of each of its
+// phases and, if the request took longer than the slow request threshold,
+// logs it along with the phase which was slowest. If the request is
+// traced, its span ends with err and the spans are exported.
+func (h *Helper) observeRequest(registry string, t *requestTimer, err error) {
+	total := t.stop()
+
+	t.root.End(err)
+
+	if err := h.tracer.Flush(context.Background()); err != nil {
+		h.logger.Warn("error exporting trace", "error", err)
+	}
+
+	h.metrics.MeasureDuration("request.duration", total, nil)
+
+	for _, phase := range phases {
+		if d, ok := t.phases[phase]; ok {
+			h.metrics.MeasureDuration("phase.duration", d, map[string]string{"phase": phase})
+		}
+	}
+
+	if h.slowThreshold <= 0 || total < h.slowThreshold {
+		return
+	}
+
+	slowest := t.slowest()
+
+	args := []interface{}{
+		"registry", registry,
+		"duration", total,
+		"threshold", h.slowThreshold,
+		"slow_phase", slowest,
+	}
+
+	for _, phase := range phases {
+		if d, ok := t.phases[phase]; ok {
+			args = append(args, phase, d)
+		}
+	}
+
+	// Only errors are logged by default, so slow requests are logged as
+	// such to be seen
+	h.logger.Error("slow credential request", args...)
+	h.metrics.IncrCounter("slow_request", map[string]string{"phase": slowest})
+}
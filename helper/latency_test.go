@@ -0,0 +1,276 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/internalshared/configutil"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/telemetry"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+// newTestMetrics returns an Emitter sending metrics to DogStatsD and the
+// connection on which they are received.
+func newTestMetrics(t *testing.T) (*net.UDPConn, *telemetry.Emitter) {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() }) // nolint: errcheck
+
+	metrics, err := telemetry.New(&configutil.Telemetry{DogStatsDAddr: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { metrics.Close() }) // nolint: errcheck
+
+	return conn, metrics
+}
+
+// readMetrics reads n metrics from conn and returns their names along with
+// their tags.
+func readMetrics(t *testing.T, conn *net.UDPConn, n int) []string {
+	t.Helper()
+
+	var got []string
+
+	for i := 0; i < n; i++ {
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		b := make([]byte, 1024)
+
+		m, err := conn.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := strings.SplitN(string(b[:m]), ":", 2)[0]
+		tags := strings.SplitN(string(b[:m]), "|#", 2)
+		if len(tags) == 2 {
+			name += "|#" + tags[1]
+		}
+
+		got = append(got, name)
+	}
+
+	return got
+}
+
+func TestRequestTimer(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	timer := newRequestTimer(clk)
+
+	clk.Advance(time.Millisecond)
+	timer.enter(phaseReadSecret)
+	clk.Advance(5 * time.Millisecond)
+	timer.enter(phaseAuthenticate)
+	clk.Advance(20 * time.Millisecond)
+	timer.enter(phaseReadSecret)
+	clk.Advance(5 * time.Millisecond)
+
+	total := timer.stop()
+
+	if got := timer.slowest(); got != phaseAuthenticate {
+		t.Fatalf("Expected slowest phase %q, got %q", phaseAuthenticate, got)
+	}
+
+	expected := map[string]time.Duration{
+		phaseReadSecret:   10 * time.Millisecond,
+		phaseAuthenticate: 20 * time.Millisecond,
+	}
+	if diff := cmp.Diff(expected, timer.phases); diff != "" {
+		t.Fatalf("Phase durations differ:\n%s", diff)
+	}
+
+	if total != 31*time.Millisecond {
+		t.Fatalf("Expected total %s, got %s", 31*time.Millisecond, total)
+	}
+}
+
+func TestHelper_ObserveRequest(t *testing.T) {
+	conn, metrics := newTestMetrics(t)
+
+	buf := new(bytes.Buffer)
+	clk := clock.NewFake(time.Now())
+	h := New(Options{
+		Logger:               hclog.New(&hclog.LoggerOptions{Output: buf}),
+		SlowRequestThreshold: 10 * time.Millisecond,
+		Metrics:              metrics,
+		Clock:                clk,
+	})
+
+	t.Run("fast", func(t *testing.T) {
+		timer := newRequestTimer(clk)
+		timer.enter(phaseReadSecret)
+
+		h.observeRequest("registry.example.com", timer, nil)
+
+		expected := []string{
+			"docker_credential_vault_login.request.duration",
+			"docker_credential_vault_login.phase.duration|#phase:read_secret",
+		}
+		if got := readMetrics(t, conn, len(expected)); !cmp.Equal(expected, got) {
+			t.Fatalf("Metrics differ:\n%v", cmp.Diff(expected, got))
+		}
+
+		if buf.Len() != 0 {
+			t.Fatalf("Expected nothing to be logged, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		timer := newRequestTimer(clk)
+		timer.enter(phaseAuthenticate)
+		clk.Advance(15 * time.Millisecond)
+		timer.enter(phaseReadSecret)
+
+		h.observeRequest("registry.example.com", timer, nil)
+
+		expected := []string{
+			"docker_credential_vault_login.request.duration",
+			"docker_credential_vault_login.phase.duration|#phase:authenticate",
+			"docker_credential_vault_login.phase.duration|#phase:read_secret",
+			"docker_credential_vault_login.slow_request|#phase:authenticate",
+		}
+		if got := readMetrics(t, conn, len(expected)); !cmp.Equal(expected, got) {
+			t.Fatalf("Metrics differ:\n%v", cmp.Diff(expected, got))
+		}
+
+		for _, s := range []string{"slow credential request", "registry=registry.example.com", "slow_phase=authenticate"} {
+			if !strings.Contains(buf.String(), s) {
+				t.Fatalf("Expected log to contain %q, got:\n%s", s, buf.String())
+			}
+		}
+	})
+}
+
+func TestHelper_Get_Trace(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+	}
+
+	var spans []span
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		spans = append(spans, body.ResourceSpans[0].ScopeSpans[0].Spans...)
+	}))
+	defer collector.Close()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tracer, err := telemetry.NewTracer(collector.URL, "00-"+traceID+"-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(Options{
+		Logger: hclog.NewNullLogger(),
+		Client: fake.Client(),
+		Secret: mockSecretTable{
+			mockSecretTableConfig{
+				getPath: func(string) (string, error) {
+					return secretPath, nil
+				},
+			},
+		},
+		AuthConfig: &config.AutoAuth{Method: &config.Method{
+			Type:      "approle",
+			MountPath: "auth/approle",
+			Config: map[string]interface{}{
+				"role_id_file_path":                   roleIDFile,
+				"secret_id_file_path":                 secretIDFile,
+				"remove_secret_id_file_after_reading": false,
+			},
+		}},
+		Tracer: tracer,
+	})
+
+	if _, _, err = h.Get("registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+
+	expected := []string{phaseAuthenticate, phaseReadSecret, "get"}
+	if diff := cmp.Diff(expected, names); diff != "" {
+		t.Fatalf("Spans differ:\n%s", diff)
+	}
+
+	root := spans[2]
+	if root.TraceID != traceID || root.ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("Expected the request to be traced within the trace of TRACEPARENT, got %+v", root)
+	}
+
+	for _, s := range spans[:2] {
+		if s.TraceID != traceID || s.ParentSpanID != root.SpanID {
+			t.Fatalf("Expected span %q to be a child of the request, got %+v", s.Name, s)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// minMaintainWait is the shortest time Maintain asks to wait before it is
+// called again, so that short TTLs do not make it renew without end.
+const minMaintainWait = 10 * time.Second
+
+// Maintain keeps the state of a long-running helper valid between
+// requests, as the lifetime watcher of the Vault agent does. Unless the
+// token is provided by the user or by a Vault agent, the helper logs in
+// if it has no token of its own and renews its token if it is renewable.
+// If the token can no longer be renewed or less than a minute of it
+// remains, e.g. because it reached its max TTL, the helper logs in again.
+// The leases of the cached secrets are then renewed, and the secrets whose
+// lease was revoked or is about to expire are discarded.
+//
+// It returns how long to wait before calling it again: two thirds of the
+// shortest remaining TTL of the token and of the leases, but no less than
+// ten seconds, or zero if nothing needs to be renewed.
+func (h *Helper) Maintain(ctx context.Context) (time.Duration, error) {
+	var (
+		wait time.Duration
+		err  error
+	)
+
+	switch h.authConfig.Method.Type {
+	case "token", agentMethod, agentProxyMethod:
+	default:
+		wait, err = h.maintainToken(ctx)
+	}
+
+	if h.secretCache != nil {
+		for _, path := range h.secretCache.Paths() {
+			if creds, ok := h.getCachedCredentials(ctx, path); ok {
+				wait = shorterWait(wait, creds.LeaseDuration*2/3)
+			}
+		}
+	}
+
+	if wait != 0 && wait < minMaintainWait {
+		wait = minMaintainWait
+	}
+
+	return wait, err
+}
+
+// maintainToken renews the token which the helper obtained itself, or
+// replaces it with a new one, and returns when it should next be renewed.
+func (h *Helper) maintainToken(ctx context.Context) (time.Duration, error) {
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+
+	if h.authToken == "" || h.client.Token() != h.authToken {
+		h.logger.Info("logging in to maintain a token")
+
+		if _, err := h.login(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	ttl, renewable, err := h.renewToken(ctx)
+	if err != nil {
+		h.logger.Info("logging in again since the token could not be renewed", "error", err)
+
+		if _, err = h.login(ctx); err != nil {
+			return 0, err
+		}
+
+		if ttl, renewable, err = h.lookupToken(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	// A token whose TTL is zero never expires
+	if ttl == 0 {
+		return 0, nil
+	}
+
+	if ttl < minLeaseTTL {
+		h.logger.Info("logging in again since the token is about to expire", "ttl", ttl)
+
+		if _, err = h.login(ctx); err != nil {
+			return 0, err
+		}
+
+		if ttl, renewable, err = h.lookupToken(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	if !renewable {
+		// Log in again a minute before the token expires
+		return ttl - minLeaseTTL, nil
+	}
+
+	return ttl * 2 / 3, nil
+}
+
+// renewToken renews the token of the client if it is renewable and returns
+// its remaining TTL.
+func (h *Helper) renewToken(ctx context.Context) (time.Duration, bool, error) {
+	ttl, renewable, err := h.lookupToken(ctx)
+	if err != nil || !renewable {
+		return ttl, renewable, err
+	}
+
+	secret, err := h.client.Auth().Token().RenewSelfWithContext(ctx, 0)
+	if err != nil {
+		return 0, false, xerrors.Errorf("error renewing token: %w", err)
+	}
+
+	ttl, err = secret.TokenTTL()
+	if err != nil {
+		return 0, false, xerrors.Errorf("error parsing token TTL: %w", err)
+	}
+
+	return ttl, true, nil
+}
+
+// lookupToken returns the remaining TTL of the token of the client and
+// whether it is renewable.
+func (h *Helper) lookupToken(ctx context.Context) (time.Duration, bool, error) {
+	secret, err := h.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return 0, false, xerrors.Errorf("error looking up token: %w", err)
+	}
+
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return 0, false, xerrors.Errorf("error parsing token TTL: %w", err)
+	}
+
+	renewable, err := secret.TokenIsRenewable()
+	if err != nil {
+		return 0, false, xerrors.Errorf("error parsing token renewability: %w", err)
+	}
+
+	return ttl, renewable, nil
+}
+
+// login authenticates to Vault, caches the new token in the sinks if
+// caching is enabled, and gives it to the client.
+func (h *Helper) login(ctx context.Context) (string, error) {
+	token, err := h.authenticate(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("error authenticating: %w", err)
+	}
+
+	if h.cacheEnabled {
+		h.cacheToken(ctx, token)
+	}
+
+	h.client.SetToken(token)
+	h.authToken = token
+
+	return token, nil
+}
+
+// InheritToken gives the helper the token which prev obtained itself, so
+// that a helper replacing prev, e.g. after its configuration was reloaded,
+// does not log in again. It must only be called if both helpers log in the
+// same way (see vaultlogin.AuthSettings).
+func (h *Helper) InheritToken(prev *Helper) {
+	prev.tokenMu.Lock()
+	token := prev.authToken
+	prev.tokenMu.Unlock()
+
+	if token == "" {
+		return
+	}
+
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+
+	h.client.SetToken(token)
+	h.authToken = token
+}
+
+// RevokeOnExit revokes the token which the helper obtained itself, if the
+// helper is configured to, so that the token cannot be reused once the
+// helper has written the credentials and exits. Tokens provided by the
+// user or by a Vault agent are never revoked.
+func (h *Helper) RevokeOnExit(ctx context.Context) error {
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+
+	if !h.revokeOnExit || h.authToken == "" {
+		return nil
+	}
+
+	switch h.authConfig.Method.Type {
+	case "token", agentMethod, agentProxyMethod:
+		return nil
+	}
+
+	h.client.SetToken(h.authToken)
+
+	if err := h.client.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+		return xerrors.Errorf("error revoking token: %w", err)
+	}
+
+	h.client.ClearToken()
+	h.authToken = ""
+
+	return nil
+}
+
+// shorterWait returns the shorter of two waits, where zero means that
+// there is nothing to wait for.
+func shorterWait(a, b time.Duration) time.Duration {
+	if a == 0 || b != 0 && b < a {
+		return b
+	}
+
+	return a
+}
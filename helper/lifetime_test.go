@@ -0,0 +1,285 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestHelper_Maintain(t *testing.T) {
+	secretPath := "registry/creds/ci"
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newHelper := func(fake *vaultlogintest.FakeVault, clk clock.Clock) *Helper {
+		secretCache := cache.NewSecretCache(hclog.NewNullLogger(), cache.NewMemoryCache())
+		secretCache.SetClock(clk)
+
+		return New(Options{
+			Logger:      hclog.NewNullLogger(),
+			Client:      fake.Client(),
+			AuthTimeout: 3,
+			Secret: mockSecretTable{
+				mockSecretTableConfig{
+					getPath: func(string) (string, error) {
+						return secretPath, nil
+					},
+				},
+			},
+			AuthConfig: &config.AutoAuth{
+				Method: &config.Method{
+					Type:      "approle",
+					MountPath: "auth/approle",
+					Config: map[string]interface{}{
+						"role_id_file_path":                   roleIDFile,
+						"secret_id_file_path":                 secretIDFile,
+						"remove_secret_id_file_after_reading": false,
+					},
+				},
+			},
+			SecretCache: secretCache,
+			Clock:       clk,
+		})
+	}
+
+	// counts returns the number of logins, token renewals and lease
+	// renewals since the previous call. The auth handler may renew a new
+	// token by itself, so token renewals are only counted as at least one.
+	counter := func(fake *vaultlogintest.FakeVault) func() [3]int {
+		var previous [3]int
+
+		return func() [3]int {
+			current := [3]int{
+				fake.Requests("auth/approle/login"),
+				fake.Requests("auth/token/renew-self"),
+				fake.Requests("sys/leases/renew"),
+			}
+
+			delta := [3]int{current[0] - previous[0], current[1] - previous[1], current[2] - previous[2]}
+			previous = current
+
+			return delta
+		}
+	}
+
+	maintain := func(t *testing.T, h *Helper, expected time.Duration) {
+		t.Helper()
+
+		wait, err := h.Maintain(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != expected {
+			t.Fatalf("Expected to wait %s, got %s", expected, wait)
+		}
+	}
+
+	t.Run("renew", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		fake := vaultlogintest.NewFakeVault(t,
+			vaultlogintest.WithDynamicSecret(secretPath, map[string]interface{}{
+				"username": "test@user.com",
+				"password": "secure password",
+			}, 3*time.Minute),
+			vaultlogintest.WithAppRole("role-id", "secret-id"),
+			vaultlogintest.WithTokenTTL(10*time.Minute),
+			vaultlogintest.WithClock(clk),
+		)
+		counts := counter(fake)
+		h := newHelper(fake, clk)
+
+		// The daemon logs in before the first request
+		maintain(t, h, 400*time.Second)
+		if got := counts(); got[0] != 1 || got[1] == 0 || got[2] != 0 {
+			t.Fatalf("Expected 1 login and 1 token renewal, got %v", got)
+		}
+
+		if _, _, err := h.Get(""); err != nil {
+			t.Fatal(err)
+		}
+		if got := counts(); got[0] != 0 {
+			t.Fatalf("Expected the request not to log in, got %d logins", got[0])
+		}
+
+		// The lease expires before the token
+		maintain(t, h, 2*time.Minute)
+		if got := counts(); got[0] != 0 || got[1] == 0 || got[2] != 1 {
+			t.Fatalf("Expected 1 token renewal and 1 lease renewal, got %v", got)
+		}
+
+		// A token which can no longer be renewed is replaced
+		token := h.client.Token()
+		fake.RevokeToken(token)
+
+		maintain(t, h, 2*time.Minute)
+		if got := counts(); got[0] != 1 {
+			t.Fatalf("Expected 1 login, got %d", got[0])
+		}
+		if h.client.Token() == token || h.client.Token() != h.authToken {
+			t.Fatalf("Expected a new token, got %q", h.client.Token())
+		}
+	})
+
+	t.Run("expiring-token", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		fake := vaultlogintest.NewFakeVault(t,
+			vaultlogintest.WithAppRole("role-id", "secret-id"),
+			vaultlogintest.WithTokenTTL(30*time.Second),
+			vaultlogintest.WithClock(clk),
+		)
+		counts := counter(fake)
+
+		// The token cannot be renewed for more than a minute, so the
+		// helper logs in again right away
+		maintain(t, newHelper(fake, clk), 20*time.Second)
+		if got := counts(); got[0] != 2 {
+			t.Fatalf("Expected 2 logins, got %d", got[0])
+		}
+	})
+
+	t.Run("user-provided-token", func(t *testing.T) {
+		fake := vaultlogintest.NewFakeVault(t)
+
+		client := fake.Client()
+		client.SetToken(fake.RootToken())
+
+		h := New(Options{
+			Logger:     hclog.NewNullLogger(),
+			Client:     client,
+			AuthConfig: &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		})
+
+		maintain(t, h, 0)
+		if n := fake.Requests("auth/token/renew-self"); n != 0 {
+			t.Fatalf("Expected the token not to be renewed, got %d renewals", n)
+		}
+	})
+}
+
+func TestHelper_RevokeOnExit(t *testing.T) {
+	secretPath := "registry/creds/ci"
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	approle := &config.Method{
+		Type:      "approle",
+		MountPath: "auth/approle",
+		Config: map[string]interface{}{
+			"role_id_file_path":                   roleIDFile,
+			"secret_id_file_path":                 secretIDFile,
+			"remove_secret_id_file_after_reading": false,
+		},
+	}
+
+	cases := []struct {
+		name    string
+		method  *config.Method
+		revoke  bool
+		revoked bool
+	}{
+		{
+			name:    "revoked",
+			method:  approle,
+			revoke:  true,
+			revoked: true,
+		},
+		{
+			name:   "disabled",
+			method: approle,
+		},
+		{
+			name:   "user-provided-token",
+			method: &config.Method{Type: "token"},
+			revoke: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := vaultlogintest.NewFakeVault(t,
+				vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+					"username": "test@user.com",
+					"password": "secure password",
+				}),
+				vaultlogintest.WithAppRole("role-id", "secret-id"),
+			)
+
+			client := fake.Client()
+			if tc.method.Type == "token" {
+				client.SetToken(fake.RootToken())
+			}
+
+			h := New(Options{
+				Logger:      hclog.NewNullLogger(),
+				Client:      client,
+				AuthTimeout: 3,
+				Secret: mockSecretTable{
+					mockSecretTableConfig{
+						getPath: func(string) (string, error) {
+							return secretPath, nil
+						},
+					},
+				},
+				AuthConfig:   &config.AutoAuth{Method: tc.method},
+				RevokeOnExit: tc.revoke,
+			})
+
+			if _, _, err := h.Get(""); err != nil {
+				t.Fatal(err)
+			}
+
+			token := client.Token()
+
+			if err := h.RevokeOnExit(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.revoked && client.Token() != "" {
+				t.Fatal("expected the token to be forgotten")
+			}
+
+			client.SetToken(token)
+
+			_, err := client.Auth().Token().LookupSelf()
+			if revoked := err != nil; revoked != tc.revoked {
+				t.Fatalf("Expected the token to be revoked: %v, got error %v", tc.revoked, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import "time"
+
+// The caches whose hits and misses are counted.
+const (
+	cacheTTL      = "ttl"
+	cacheSecret   = "secret"
+	cacheToken    = "token"
+	cacheStale    = "stale"
+	cacheCoalesce = "coalesce"
+)
+
+// The types of the errors which are counted.
+const (
+	errorRegistryNotConfigured = "registry_not_configured"
+	errorAuthenticate          = "authenticate"
+	errorReadSecret            = "read_secret"
+	errorCircuitOpen           = "circuit_open"
+)
+
+// The operations whose Vault requests are timed.
+const (
+	operationLogin = "login"
+	operationRead  = "read"
+)
+
+// result returns the value of the 'result' label of a metric.
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
+
+// observeCache counts a hit or a miss of the named cache.
+func (h *Helper) observeCache(name string, hit bool) {
+	metric := "cache.miss"
+	if hit {
+		metric = "cache.hit"
+	}
+
+	h.metrics.IncrCounter(metric, map[string]string{"cache": name})
+}
+
+// observeError counts an error of the given type.
+func (h *Helper) observeError(kind string) {
+	h.metrics.IncrCounter("error", map[string]string{"type": kind})
+}
+
+// observeLogin counts a login attempt with the auth method and exports how
+// long it took.
+func (h *Helper) observeLogin(method string, start time.Time, err error) {
+	h.metrics.IncrCounter("login", map[string]string{"method": method, "result": result(err)})
+	h.metrics.MeasureDuration("vault.request.duration", h.clock.Now().Sub(start), map[string]string{
+		"operation": operationLogin,
+		"result":    result(err),
+	})
+
+	if err != nil {
+		h.observeError(errorAuthenticate)
+	}
+}
+
+// observeRead wraps read so that the duration of every read of the secret
+// is exported and its failures are counted.
+func (h *Helper) observeRead(read func() error) func() error {
+	return func() error {
+		start := h.clock.Now()
+		err := read()
+
+		h.metrics.MeasureDuration("vault.request.duration", h.clock.Now().Sub(start), map[string]string{
+			"operation": operationRead,
+			"result":    result(err),
+		})
+
+		if err != nil {
+			h.observeError(errorReadSecret)
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestHelper_Get_Metrics(t *testing.T) {
+	secretPath := "secret/docker/creds"
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1(secretPath, map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, metrics := newTestMetrics(t)
+	tokenCache := cache.NewMemoryCache()
+
+	newHelper := func(getPath func(string) (string, error)) *Helper {
+		return New(Options{
+			Logger: hclog.NewNullLogger(),
+			Client: fake.Client(),
+			Secret: mockSecretTable{
+				mockSecretTableConfig{getPath: getPath},
+			},
+			EnableCache: true,
+			AuthConfig: &config.AutoAuth{Method: &config.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":                   roleIDFile,
+					"secret_id_file_path":                 secretIDFile,
+					"remove_secret_id_file_after_reading": false,
+				},
+			}},
+			TokenCache: tokenCache,
+			Metrics:    metrics,
+		})
+	}
+
+	cases := []struct {
+		name     string
+		getPath  func(string) (string, error)
+		err      bool
+		expected []string
+	}{
+		{
+			name: "login",
+			getPath: func(string) (string, error) {
+				return secretPath, nil
+			},
+			expected: []string{
+				"docker_credential_vault_login.cache.miss|#cache:token",
+				"docker_credential_vault_login.login|#method:approle,result:success",
+				"docker_credential_vault_login.vault.request.duration|#operation:login,result:success",
+				"docker_credential_vault_login.vault.request.duration|#operation:read,result:success",
+				"docker_credential_vault_login.request.duration",
+				"docker_credential_vault_login.phase.duration|#phase:token_cache",
+				"docker_credential_vault_login.phase.duration|#phase:authenticate",
+				"docker_credential_vault_login.phase.duration|#phase:sink",
+				"docker_credential_vault_login.phase.duration|#phase:read_secret",
+			},
+		},
+		{
+			name: "cached-token",
+			getPath: func(string) (string, error) {
+				return secretPath, nil
+			},
+			expected: []string{
+				"docker_credential_vault_login.vault.request.duration|#operation:read,result:success",
+				"docker_credential_vault_login.cache.hit|#cache:token",
+				"docker_credential_vault_login.request.duration",
+				"docker_credential_vault_login.phase.duration|#phase:token_cache",
+				"docker_credential_vault_login.phase.duration|#phase:read_secret",
+			},
+		},
+		{
+			name: "read-error",
+			getPath: func(string) (string, error) {
+				return "secret/docker/missing", nil
+			},
+			err: true,
+			expected: []string{
+				"docker_credential_vault_login.vault.request.duration|#operation:read,result:failure",
+				"docker_credential_vault_login.error|#type:read_secret",
+				"docker_credential_vault_login.cache.miss|#cache:token",
+				"docker_credential_vault_login.login|#method:approle,result:success",
+				"docker_credential_vault_login.vault.request.duration|#operation:login,result:success",
+				"docker_credential_vault_login.vault.request.duration|#operation:read,result:failure",
+				"docker_credential_vault_login.error|#type:read_secret",
+				"docker_credential_vault_login.request.duration",
+				"docker_credential_vault_login.phase.duration|#phase:token_cache",
+				"docker_credential_vault_login.phase.duration|#phase:authenticate",
+				"docker_credential_vault_login.phase.duration|#phase:sink",
+				"docker_credential_vault_login.phase.duration|#phase:read_secret",
+			},
+		},
+		{
+			name: "registry-not-configured",
+			getPath: func(string) (string, error) {
+				return "", errors.New("no secret")
+			},
+			err: true,
+			expected: []string{
+				"docker_credential_vault_login.error|#type:registry_not_configured",
+				"docker_credential_vault_login.request.duration",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := newHelper(tc.getPath).Get("")
+			if tc.err != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.err, err)
+			}
+
+			if got := readMetrics(t, conn, len(tc.expected)); !cmp.Equal(tc.expected, got) {
+				t.Fatalf("Metrics differ:\n%v", cmp.Diff(tc.expected, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"errors"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+var (
+	// ErrPathNotAllowed is returned by ReadSecret when the path is not in
+	// the allowlist of the proxy.
+	ErrPathNotAllowed = errors.New("path is not allowed")
+
+	// ErrSecretNotFound is returned by ReadSecret when there is no secret
+	// at the path.
+	ErrSecretNotFound = errors.New("secret not found")
+)
+
+// proxyEntry is a secret cached by the proxy.
+type proxyEntry struct {
+	secret  *api.Secret
+	expires time.Time
+}
+
+// proxyCache keeps the secrets read through the proxy in memory, keyed by
+// path.
+type proxyCache struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]proxyEntry
+}
+
+func (c *proxyCache) lookup(path string) (*api.Secret, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+
+	return entry.secret, true
+}
+
+func (c *proxyCache) store(path string, secret *api.Secret, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]proxyEntry)
+	}
+
+	c.entries[path] = proxyEntry{secret: secret, expires: c.now().Add(ttl)}
+}
+
+// now returns the time of the clock of the cache or, if it has none, of the
+// system.
+func (c *proxyCache) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+
+	return c.clock.Now()
+}
+
+func (c *proxyCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+}
+
+// ProxyEnabled reports whether any path may be read through the proxy.
+func (h *Helper) ProxyEnabled() bool {
+	return len(h.proxyPaths) > 0
+}
+
+// ReadSecret reads the secret at path on behalf of other tools, using the
+// same tokens as Get. The path must match one of the allowed proxy paths.
+// If the proxy cache TTL is positive, the secret is cached in memory for
+// that long, but no longer than its lease.
+func (h *Helper) ReadSecret(path string) (*api.Secret, error) {
+	path = normalizePath(path)
+
+	if !h.proxyPathAllowed(path) {
+		return nil, ErrPathNotAllowed
+	}
+
+	if secret, ok := h.proxyCache.lookup(path); ok {
+		return secret, nil
+	}
+
+	var secret *api.Secret
+
+	ctx, cancel := h.requestContext()
+	defer cancel()
+
+	err := h.withToken(ctx, newRequestTimer(h.clock), func() error {
+		var err error
+
+		secret, err = h.client.Logical().ReadWithContext(ctx, path)
+		if err != nil {
+			return xerrors.Errorf("error reading secret: %w", err)
+		}
+
+		if secret == nil {
+			return ErrSecretNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.observeSecret(path, secret.Data)
+
+	ttl := h.proxyCacheTTL
+	if lease := time.Duration(secret.LeaseDuration) * time.Second; lease > 0 && lease < ttl {
+		ttl = lease
+	}
+
+	if ttl > 0 {
+		h.proxyCache.store(path, secret, ttl)
+	}
+
+	return secret, nil
+}
+
+// normalizePath strips the leading and trailing slashes of a secret path.
+func normalizePath(path string) string {
+	return strings.Trim(path, "/")
+}
+
+// proxyPathAllowed reports whether path matches any of the allowed proxy
+// paths. As in Vault policies, a path ending with '*' matches every path
+// which begins with the rest of it.
+func (h *Helper) proxyPathAllowed(path string) bool {
+	// Don't let paths such as "secret/../sys/..." escape a prefix
+	if path == "" || pathpkg.Clean(path) != path {
+		return false
+	}
+
+	for _, allowed := range h.proxyPaths {
+		allowed = strings.TrimPrefix(allowed, "/")
+
+		if prefix := strings.TrimSuffix(allowed, "*"); prefix != allowed {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+
+			continue
+		}
+
+		if path == allowed {
+			return true
+		}
+	}
+
+	return false
+}
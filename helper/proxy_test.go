@@ -0,0 +1,175 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestHelper_ReadSecret(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/ci/npm", map[string]interface{}{"token": "npm token"}),
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	h := New(Options{
+		Logger:        hclog.NewNullLogger(),
+		Client:        client,
+		AuthConfig:    &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		ProxyPaths:    []string{"secret/ci/*", "/secret/build"},
+		ProxyCacheTTL: time.Hour,
+	})
+
+	if !h.ProxyEnabled() {
+		t.Fatal("expected the proxy to be enabled")
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			secret, err := h.ReadSecret("/secret/ci/npm")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := map[string]interface{}{"token": "npm token"}
+			if diff := cmp.Diff(expected, secret.Data); diff != "" {
+				t.Fatalf("Data differs:\n%s", diff)
+			}
+		}
+
+		if n := fake.Requests("secret/ci/npm"); n != 1 {
+			t.Fatalf("Expected the secret to be read once and then cached, got %d reads", n)
+		}
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		if _, err := h.ReadSecret("secret/build"); !errors.Is(err, ErrSecretNotFound) {
+			t.Fatalf("Expected %v, got %v", ErrSecretNotFound, err)
+		}
+	})
+
+	for _, path := range []string{"secret/docker/creds", "secret/ci/../docker/creds", "secret/ci", ""} {
+		t.Run("not-allowed", func(t *testing.T) {
+			if _, err := h.ReadSecret(path); !errors.Is(err, ErrPathNotAllowed) {
+				t.Fatalf("Expected %v reading %q, got %v", ErrPathNotAllowed, path, err)
+			}
+		})
+	}
+
+	if n := fake.Requests("secret/docker/creds"); n != 0 {
+		t.Fatalf("Expected no reads of a path which is not allowed, got %d", n)
+	}
+
+	t.Run("purge", func(t *testing.T) {
+		if err := h.PurgeCache(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.ReadSecret("secret/ci/npm"); err != nil {
+			t.Fatal(err)
+		}
+		if n := fake.Requests("secret/ci/npm"); n != 2 {
+			t.Fatalf("Expected the secret to be read again after purging the cache, got %d reads", n)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := New(Options{Logger: hclog.NewNullLogger(), Client: client})
+		if h.ProxyEnabled() {
+			t.Fatal("expected the proxy to be disabled")
+		}
+		if _, err := h.ReadSecret("secret/ci/npm"); !errors.Is(err, ErrPathNotAllowed) {
+			t.Fatalf("Expected %v, got %v", ErrPathNotAllowed, err)
+		}
+	})
+}
+
+func TestHelper_ReadSecret_Logins(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/ci/npm", map[string]interface{}{"token": "npm token"}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+		vaultlogintest.WithFaults("secret/ci/denied", vaultlogintest.FailWith(http.StatusForbidden, "permission denied")),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := fake.Client()
+	client.ClearToken()
+
+	h := New(Options{
+		Logger:      hclog.NewNullLogger(),
+		Client:      client,
+		AuthTimeout: 3,
+		AuthConfig: &config.AutoAuth{
+			Method: &config.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":                   roleIDFile,
+					"secret_id_file_path":                 secretIDFile,
+					"remove_secret_id_file_after_reading": false,
+				},
+			},
+		},
+		ProxyPaths: []string{"secret/ci/*"},
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.ReadSecret("secret/ci/missing"); !errors.Is(err, ErrSecretNotFound) {
+			t.Fatalf("Expected %v, got %v", ErrSecretNotFound, err)
+		}
+	}
+
+	fake.AssertRequests(t, "auth/approle/login", 1)
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.ReadSecret("secret/ci/denied"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+			t.Fatalf("Expected permission to be denied, got %v", err)
+		}
+	}
+
+	fake.AssertRequests(t, "auth/approle/login", 1)
+
+	// Only a token which is no longer valid is replaced
+	fake.RevokeToken(client.Token())
+
+	if _, err := h.ReadSecret("secret/ci/npm"); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.AssertRequests(t, "auth/approle/login", 2)
+}
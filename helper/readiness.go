@@ -0,0 +1,88 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Readiness is the report of the readiness probe of a long-running helper.
+// Its details never contain tokens or secrets.
+type Readiness struct {
+	Ready bool  `json:"ready"`
+	Vault Check `json:"vault"`
+	Token Check `json:"token"`
+
+	// TokenTTL is the remaining TTL of the token in seconds, or zero if it
+	// never expires or is not valid.
+	TokenTTL int64       `json:"token_ttl_seconds"`
+	Cache    CacheStatus `json:"cache"`
+}
+
+// CacheStatus describes the caches of a Helper.
+type CacheStatus struct {
+	Enabled       bool `json:"enabled"`
+	CachedSecrets int  `json:"cached_secrets"`
+}
+
+// Readiness checks that Vault is reachable and that the helper holds a
+// valid token, so that it can answer requests without waiting for a
+// login. Unlike Diagnose, it never logs in.
+func (h *Helper) Readiness(ctx context.Context) Readiness {
+	readiness := Readiness{
+		Vault: h.checkHealth(ctx),
+		Token: Check{Name: "token"},
+		Cache: CacheStatus{Enabled: h.cacheEnabled},
+	}
+
+	if h.secretCache != nil {
+		readiness.Cache.CachedSecrets = h.secretCache.Len()
+	}
+
+	if h.ttlCache != nil {
+		readiness.Cache.CachedSecrets += h.ttlCache.Len()
+	}
+
+	if h.client.Token() == "" {
+		readiness.Token.Detail = "the helper has not logged in yet"
+		return readiness
+	}
+
+	secret, err := h.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		readiness.Token.Detail = fmt.Sprintf("error looking up token: %v", err)
+		return readiness
+	}
+
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		readiness.Token.Detail = fmt.Sprintf("error parsing token TTL: %v", err)
+		return readiness
+	}
+
+	readiness.Token.OK = true
+	readiness.TokenTTL = int64(ttl.Seconds())
+
+	if ttl == 0 {
+		readiness.Token.Detail = "the token never expires"
+	} else {
+		readiness.Token.Detail = fmt.Sprintf("the token expires in %s", ttl.Round(time.Second))
+	}
+
+	readiness.Ready = readiness.Vault.OK
+
+	return readiness
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// RotationStatus describes the most recent rotation of a secret.
+type RotationStatus struct {
+	Path         string     `json:"path"`
+	RotatedAt    time.Time  `json:"rotated_at"`
+	OverlapUntil *time.Time `json:"overlap_until,omitempty"`
+}
+
+// rotation is the version of a secret which was replaced when the secret
+// rotated.
+type rotation struct {
+	previous  map[string]interface{}
+	rotatedAt time.Time
+	until     time.Time
+}
+
+// rotationTracker remembers the last version of every secret read from
+// Vault so that it can tell when a secret rotates. The previous version of
+// a rotated secret is kept for the overlap window.
+type rotationTracker struct {
+	overlap time.Duration
+	clock   clock.Clock
+
+	mu        sync.Mutex
+	current   map[string]map[string]interface{}
+	rotations map[string]rotation
+}
+
+// observe records the data read from the secret at path and reports
+// whether the secret rotated since it was last read.
+func (t *rotationTracker) observe(path string, data map[string]interface{}) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		t.current = make(map[string]map[string]interface{})
+		t.rotations = make(map[string]rotation)
+	}
+
+	previous, seen := t.current[path]
+	t.current[path] = data
+
+	if !seen || reflect.DeepEqual(previous, data) {
+		return false
+	}
+
+	now := t.now()
+	r := rotation{rotatedAt: now}
+
+	if t.overlap > 0 {
+		r.previous = previous
+		r.until = now.Add(t.overlap)
+	}
+
+	t.rotations[path] = r
+
+	return true
+}
+
+// previous returns the version of the secret at path which was replaced
+// by its last rotation, if the overlap window has not yet ended.
+func (t *rotationTracker) previous(path string) (map[string]interface{}, time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.rotations[path]
+	if !ok || r.previous == nil || !t.now().Before(r.until) {
+		return nil, time.Time{}, false
+	}
+
+	return r.previous, r.until, true
+}
+
+// now returns the time of the clock of the tracker or, if it has none, of
+// the system.
+func (t *rotationTracker) now() time.Time {
+	if t.clock == nil {
+		return time.Now()
+	}
+
+	return t.clock.Now()
+}
+
+// status returns the most recent rotation of every secret, sorted by path.
+func (t *rotationTracker) status() []RotationStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var statuses []RotationStatus
+
+	for path, r := range t.rotations {
+		status := RotationStatus{Path: path, RotatedAt: r.rotatedAt}
+		if !r.until.IsZero() {
+			until := r.until
+			status.OverlapUntil = &until
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Path < statuses[j].Path })
+
+	return statuses
+}
+
+// PreviousSecret returns the data of the version of the secret at path
+// which was replaced by its most recent rotation, and when the overlap
+// window ends. It returns false once the window has ended or if the
+// secret has not rotated.
+func (h *Helper) PreviousSecret(path string) (map[string]interface{}, time.Time, bool) {
+	return h.rotations.previous(normalizePath(path))
+}
+
+// observeSecret records the data read from Vault for the secret at path
+// and logs its rotation.
+func (h *Helper) observeSecret(path string, data map[string]interface{}) {
+	if !h.rotations.observe(path, data) {
+		return
+	}
+
+	if h.rotations.overlap > 0 {
+		h.logger.Info("secret rotated; keeping previous version", "path", path,
+			"overlap", h.rotations.overlap)
+		return
+	}
+
+	h.logger.Info("secret rotated", "path", path)
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestRotationTracker(t *testing.T) {
+	v1 := map[string]interface{}{"token": "v1"}
+	v2 := map[string]interface{}{"token": "v2"}
+
+	t.Run("overlap", func(t *testing.T) {
+		tracker := rotationTracker{overlap: time.Hour}
+
+		if tracker.observe("secret/npm", v1) {
+			t.Fatal("expected the first read not to be a rotation")
+		}
+		if tracker.observe("secret/npm", v1) {
+			t.Fatal("expected an unchanged secret not to be a rotation")
+		}
+		if _, _, ok := tracker.previous("secret/npm"); ok {
+			t.Fatal("expected no previous version before the secret rotates")
+		}
+		if !tracker.observe("secret/npm", v2) {
+			t.Fatal("expected a changed secret to be a rotation")
+		}
+
+		previous, until, ok := tracker.previous("secret/npm")
+		if !ok {
+			t.Fatal("expected the previous version to be kept")
+		}
+		if diff := cmp.Diff(v1, previous); diff != "" {
+			t.Fatalf("Previous version differs:\n%s", diff)
+		}
+		if ttl := time.Until(until); ttl <= 59*time.Minute || ttl > time.Hour {
+			t.Fatalf("Expected the overlap to end in about an hour, got %s", ttl)
+		}
+
+		status := tracker.status()
+		if len(status) != 1 || status[0].Path != "secret/npm" || status[0].OverlapUntil == nil ||
+			!status[0].OverlapUntil.Equal(until) {
+			t.Fatalf("Unexpected rotation status %+v", status)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		tracker := rotationTracker{overlap: time.Hour, clock: clk}
+		tracker.observe("secret/npm", v1)
+		tracker.observe("secret/npm", v2)
+
+		clk.Advance(59 * time.Minute)
+
+		if _, _, ok := tracker.previous("secret/npm"); !ok {
+			t.Fatal("expected the previous version to be kept during the overlap")
+		}
+
+		clk.Advance(time.Minute)
+
+		if _, _, ok := tracker.previous("secret/npm"); ok {
+			t.Fatal("expected the previous version to be dropped once the overlap ends")
+		}
+	})
+
+	t.Run("no-overlap", func(t *testing.T) {
+		tracker := rotationTracker{}
+		tracker.observe("secret/npm", v1)
+
+		if !tracker.observe("secret/npm", v2) {
+			t.Fatal("expected a changed secret to be a rotation")
+		}
+		if _, _, ok := tracker.previous("secret/npm"); ok {
+			t.Fatal("expected no previous version without an overlap")
+		}
+
+		status := tracker.status()
+		if len(status) != 1 || status[0].OverlapUntil != nil {
+			t.Fatalf("Unexpected rotation status %+v", status)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if status := (&rotationTracker{}).status(); status != nil {
+			t.Fatalf("Expected no rotation status, got %+v", status)
+		}
+	})
+}
+
+func TestHelper_PreviousSecret(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/ci/npm", map[string]interface{}{"token": "npm token"}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	h := New(Options{
+		Logger:          hclog.NewNullLogger(),
+		Client:          client,
+		AuthConfig:      &config.AutoAuth{Method: &config.Method{Type: "token"}},
+		ProxyPaths:      []string{"secret/ci/*"},
+		RotationOverlap: time.Hour,
+	})
+
+	if _, err := h.ReadSecret("secret/ci/npm"); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.SetKVv1("secret/ci/npm", map[string]interface{}{"token": "new npm token"})
+
+	secret, err := h.ReadSecret("secret/ci/npm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]interface{}{"token": "new npm token"}, secret.Data); diff != "" {
+		t.Fatalf("Data differs:\n%s", diff)
+	}
+
+	previous, _, ok := h.PreviousSecret("/secret/ci/npm")
+	if !ok {
+		t.Fatal("expected the previous version to be kept")
+	}
+	if diff := cmp.Diff(map[string]interface{}{"token": "npm token"}, previous); diff != "" {
+		t.Fatalf("Previous version differs:\n%s", diff)
+	}
+
+	if rotations := h.Status().Rotations; len(rotations) != 1 || rotations[0].Path != "secret/ci/npm" {
+		t.Fatalf("Unexpected rotations in status %+v", rotations)
+	}
+}
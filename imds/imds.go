@@ -0,0 +1,158 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package imds bounds and caches the calls made to the instance metadata
+// services of cloud providers. The metadata services throttle clients
+// which send too many requests at once, which happens easily when the
+// credentials of many registries are fetched in parallel.
+package imds
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// DefaultConcurrency is how many calls the Default pool makes to metadata
+// services at once.
+const DefaultConcurrency = 4
+
+// Default is the pool shared by every metadata client of the process.
+var Default = NewPool(DefaultConcurrency)
+
+// Pool limits how many metadata calls are made at once and caches their
+// results. Concurrent calls with the same key are made only once.
+type Pool struct {
+	sem chan struct{}
+
+	mu      sync.Mutex
+	clock   clock.Clock
+	entries map[string]*entry
+}
+
+type entry struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+// NewPool creates a new Pool which makes at most concurrency calls at
+// once. If concurrency is not positive, DefaultConcurrency is used.
+func NewPool(concurrency int) *Pool {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	return &Pool{
+		sem:     make(chan struct{}, concurrency),
+		clock:   clock.System(),
+		entries: make(map[string]*entry),
+	}
+}
+
+// SetClock replaces the clock by which the expiration of the cached
+// results is checked.
+func (p *Pool) SetClock(clk clock.Clock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clock = clk
+}
+
+// Do returns the cached result of the call identified by key or, if there
+// is none, calls fetch and caches its result for as long as the TTL it
+// returns. Errors are never cached, but are returned to every caller
+// waiting for the same call.
+func (p *Pool) Do(
+	ctx context.Context,
+	key string,
+	fetch func(context.Context) (interface{}, time.Duration, error),
+) (interface{}, error) {
+	p.mu.Lock()
+
+	if e, ok := p.entries[key]; ok {
+		select {
+		case <-e.done:
+			if p.clock.Now().Before(e.expires) {
+				p.mu.Unlock()
+				return e.value, nil
+			}
+		default:
+			// The call is in flight, so wait for its result
+			p.mu.Unlock()
+
+			select {
+			case <-e.done:
+				return e.value, e.err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	e := &entry{done: make(chan struct{})}
+	p.entries[key] = e
+	clk := p.clock
+	p.mu.Unlock()
+
+	e.value, e.expires, e.err = p.call(ctx, clk, fetch)
+
+	p.mu.Lock()
+	if e.err != nil || !e.expires.After(p.clock.Now()) {
+		delete(p.entries, key)
+	}
+	p.mu.Unlock()
+
+	close(e.done)
+
+	return e.value, e.err
+}
+
+// call calls fetch once a slot of the pool is free.
+func (p *Pool) call(
+	ctx context.Context,
+	clk clock.Clock,
+	fetch func(context.Context) (interface{}, time.Duration, error),
+) (interface{}, time.Time, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, time.Time{}, ctx.Err()
+	}
+
+	defer func() { <-p.sem }()
+
+	value, ttl, err := fetch(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return value, clk.Now().Add(ttl), nil
+}
+
+// Purge removes every cached result.
+func (p *Pool) Purge() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, e := range p.entries {
+		select {
+		case <-e.done:
+			delete(p.entries, key)
+		default:
+		}
+	}
+}
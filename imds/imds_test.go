@@ -0,0 +1,193 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imds
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestPool_Do(t *testing.T) {
+	pool := NewPool(2)
+
+	var calls int32
+
+	fetch := func(ttl time.Duration, err error) func(context.Context) (interface{}, time.Duration, error) {
+		return func(context.Context) (interface{}, time.Duration, error) {
+			atomic.AddInt32(&calls, 1)
+			return "value", ttl, err
+		}
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+
+		for i := 0; i < 3; i++ {
+			value, err := pool.Do(context.Background(), "cached", fetch(time.Hour, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != "value" {
+				t.Fatalf("Expected %q, got %v", "value", value)
+			}
+		}
+
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("Expected 1 call, got %d", n)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+
+		for i := 0; i < 2; i++ {
+			if _, err := pool.Do(context.Background(), "expired", fetch(0, nil)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Fatalf("Expected 2 calls, got %d", n)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+
+		clk := clock.NewFake(time.Now())
+		pool.SetClock(clk)
+		defer pool.SetClock(clock.System())
+
+		for _, advance := range []time.Duration{0, 59 * time.Minute, 2 * time.Minute} {
+			clk.Advance(advance)
+
+			if _, err := pool.Do(context.Background(), "ttl", fetch(time.Hour, nil)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Fatalf("Expected the value to be fetched again once its TTL passed, got %d calls", n)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		expected := errors.New("throttled")
+
+		for i := 0; i < 2; i++ {
+			if _, err := pool.Do(context.Background(), "error", fetch(time.Hour, expected)); err != expected {
+				t.Fatalf("Expected %v, got %v", expected, err)
+			}
+		}
+
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Fatalf("Expected errors not to be cached, got %d calls", n)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+
+		pool.Purge()
+
+		if _, err := pool.Do(context.Background(), "cached", fetch(time.Hour, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("Expected the value to be fetched again after purging, got %d calls", n)
+		}
+	})
+}
+
+func TestPool_Concurrency(t *testing.T) {
+	pool := NewPool(2)
+
+	var (
+		running, peak, calls int32
+		wg                   sync.WaitGroup
+	)
+
+	fetch := func(context.Context) (interface{}, time.Duration, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+
+		return "value", time.Hour, nil
+	}
+
+	// Ten callers share every key, so only one call is made per key
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(key string) {
+			defer wg.Done()
+
+			if _, err := pool.Do(context.Background(), key, fetch); err != nil {
+				t.Error(err)
+			}
+		}(string(rune('a' + i%5)))
+	}
+
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 5 {
+		t.Fatalf("Expected 5 calls, got %d", n)
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Fatalf("Expected at most 2 calls at once, got %d", p)
+	}
+}
+
+func TestPool_Canceled(t *testing.T) {
+	pool := NewPool(1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go pool.Do(context.Background(), "slow", func(context.Context) (interface{}, time.Duration, error) { // nolint: errcheck
+		close(started)
+		<-release
+		return "value", time.Hour, nil
+	})
+
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := pool.Do(ctx, "other", func(context.Context) (interface{}, time.Duration, error) {
+		t.Error("expected the call not to be made while the pool is full")
+		return nil, 0, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
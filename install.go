@@ -0,0 +1,398 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/config"
+)
+
+const envRegistryAuthFile = "REGISTRY_AUTH_FILE"
+
+// containerRuntime is a container tool which looks up the credential
+// helper of a registry in the 'credHelpers' of its configuration file.
+type containerRuntime struct {
+	// configFile returns the path of the configuration file.
+	configFile func() (string, error)
+
+	// dockerHub is the key of Docker Hub in 'credHelpers', which is the
+	// server URL with which the tool invokes the helper for it.
+	dockerHub string
+
+	// credsStore is whether the tool reads a 'credsStore', the helper of
+	// every registry, from the file.
+	credsStore bool
+}
+
+// containerRuntimes are the tools which install configures. containerd's
+// CRI plugin is not one of them: it does not run credential helpers.
+var containerRuntimes = map[string]containerRuntime{
+	"docker":  {configFile: config.DockerCLIConfigFile, dockerHub: "https://index.docker.io/v1/", credsStore: true},
+	"nerdctl": {configFile: config.DockerCLIConfigFile, dockerHub: "https://index.docker.io/v1/", credsStore: true},
+	"podman":  {configFile: podmanAuthFile, dockerHub: "docker.io"},
+}
+
+// podmanAuthFile returns the persistent authentication file of Podman
+// (and Buildah and Skopeo): REGISTRY_AUTH_FILE or, if it is not set,
+// $XDG_CONFIG_HOME/containers/auth.json.
+func podmanAuthFile() (string, error) {
+	if path := os.Getenv(envRegistryAuthFile); path != "" {
+		return path, nil
+	}
+
+	configHome := xdgConfigHome()
+	if configHome == "" {
+		return "", xerrors.New("the home directory of the user could not be determined")
+	}
+
+	return filepath.Join(configHome, "containers", "auth.json"), nil
+}
+
+// repeatedFlag collects the values of a flag which may be repeated.
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *repeatedFlag) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// helperKey returns the key of registry in 'credHelpers'.
+func (r containerRuntime) helperKey(registry string) (string, error) {
+	key, err := config.NormalizeRegistry(registry)
+	if err != nil || key == "" {
+		return "", xerrors.Errorf("invalid registry %q", registry)
+	}
+
+	// The tools disagree on the server URL of Docker Hub
+	if key == config.DockerHubRegistry {
+		key = r.dockerHub
+	}
+
+	return key, nil
+}
+
+// installFlags are the flags shared by install and uninstall.
+type installFlags struct {
+	flags      *flag.FlagSet
+	runtime    *string
+	file       *string
+	registries repeatedFlag
+}
+
+func newInstallFlags(name, registryUsage string) *installFlags {
+	f := &installFlags{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	f.runtime = f.flags.String("runtime", "docker", "container tool to configure: docker, nerdctl or podman")
+	f.file = f.flags.String("file", "", "configuration file to edit (default: that of the container tool)")
+	f.flags.Var(&f.registries, "registry", registryUsage)
+
+	return f
+}
+
+// target returns the container tool named by -runtime and the path of the
+// configuration file to edit.
+func (f *installFlags) target() (containerRuntime, string, error) {
+	runtime, ok := containerRuntimes[*f.runtime]
+	if !ok {
+		return containerRuntime{}, "", xerrors.Errorf(
+			"unknown container tool %q: must be one of docker, nerdctl or podman", *f.runtime)
+	}
+
+	if *f.file != "" {
+		return runtime, *f.file, nil
+	}
+
+	path, err := runtime.configFile()
+	if err != nil {
+		return containerRuntime{}, "", xerrors.Errorf(
+			"error locating the configuration file of %s: %w", *f.runtime, err)
+	}
+
+	return runtime, path, nil
+}
+
+// runInstall sets the credential helper named helperName for registries,
+// the registries of the configuration unless -registry is given, in the
+// configuration file of a container tool. When there are no registries,
+// as when the configuration uses one secret for every registry, or when
+// -creds-store is given, the helper is set as the 'credsStore' of the
+// file instead. The other fields of the file are left alone.
+func runInstall(registries []string, helperName string, args []string, out io.Writer) error {
+	f := newInstallFlags("install", "registry to use the helper for; may be repeated "+
+		"(default: the registries of the configuration)")
+	credsStore := f.flags.Bool("creds-store", false, "use the helper for every registry")
+
+	if err := f.flags.Parse(args); err != nil {
+		return err
+	}
+
+	runtime, path, err := f.target()
+	if err != nil {
+		return err
+	}
+
+	if len(f.registries) > 0 {
+		if *credsStore {
+			return xerrors.New("-creds-store and -registry are mutually exclusive")
+		}
+
+		registries = f.registries
+	}
+
+	if *credsStore || len(registries) == 0 {
+		if !runtime.credsStore {
+			return xerrors.Errorf("%s only runs credential helpers of given registries; "+
+				"name the registries to use the helper for with -registry", *f.runtime)
+		}
+
+		if err = editConfigFile(path, true, func(fields map[string]json.RawMessage) (bool, error) {
+			raw, err := json.Marshal(helperName)
+			fields["credsStore"] = raw
+
+			return true, err
+		}); err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(out, "%s: using docker-credential-%s for every registry\n", path, helperName)
+
+		return err
+	}
+
+	helpers := make(map[string]string, len(registries))
+
+	for _, registry := range registries {
+		key, err := runtime.helperKey(registry)
+		if err != nil {
+			return err
+		}
+
+		helpers[key] = helperName
+	}
+
+	if err = editConfigFile(path, true, func(fields map[string]json.RawMessage) (bool, error) {
+		credHelpers, err := parseCredHelpers(fields)
+		if err != nil {
+			return false, err
+		}
+
+		for registry, helper := range helpers {
+			credHelpers[registry] = helper
+		}
+
+		fields["credHelpers"], err = json.Marshal(credHelpers)
+
+		return true, err
+	}); err != nil {
+		return err
+	}
+
+	return printRegistries(out, path, "using docker-credential-"+helperName+" for", helpers)
+}
+
+// runUninstall reverts runInstall: it removes the 'credsStore' and the
+// 'credHelpers' entries which name the credential helper helperName from
+// the configuration file of a container tool, or only the entries of the
+// registries given with -registry.
+func runUninstall(helperName string, args []string, out io.Writer) error {
+	f := newInstallFlags("uninstall", "registry to stop using the helper for; may be repeated "+
+		"(default: every registry)")
+
+	if err := f.flags.Parse(args); err != nil {
+		return err
+	}
+
+	runtime, path, err := f.target()
+	if err != nil {
+		return err
+	}
+
+	only := make(map[string]bool, len(f.registries))
+
+	for _, registry := range f.registries {
+		key, err := runtime.helperKey(registry)
+		if err != nil {
+			return err
+		}
+
+		only[key] = true
+	}
+
+	removed := make(map[string]string)
+
+	if err = editConfigFile(path, false, func(fields map[string]json.RawMessage) (bool, error) {
+		credHelpers, err := parseCredHelpers(fields)
+		if err != nil {
+			return false, err
+		}
+
+		for registry, helper := range credHelpers {
+			if helper == helperName && (len(only) == 0 || only[registry]) {
+				delete(credHelpers, registry)
+				removed[registry] = helper
+			}
+		}
+
+		if len(removed) > 0 {
+			if len(credHelpers) == 0 {
+				delete(fields, "credHelpers")
+			} else if fields["credHelpers"], err = json.Marshal(credHelpers); err != nil {
+				return false, err
+			}
+		}
+
+		var credsStore string
+
+		if raw, ok := fields["credsStore"]; ok && len(only) == 0 {
+			if json.Unmarshal(raw, &credsStore) == nil && credsStore == helperName {
+				delete(fields, "credsStore")
+				removed["every registry"] = helperName
+			}
+		}
+
+		return len(removed) > 0, nil
+	}); err != nil {
+		return err
+	}
+
+	if len(removed) == 0 {
+		_, err = fmt.Fprintf(out, "%s: docker-credential-%s is not in use\n", path, helperName)
+		return err
+	}
+
+	return printRegistries(out, path, "no longer using docker-credential-"+helperName+" for", removed)
+}
+
+// parseCredHelpers returns the 'credHelpers' of the fields of a
+// configuration file.
+func parseCredHelpers(fields map[string]json.RawMessage) (map[string]string, error) {
+	credHelpers := make(map[string]string)
+
+	if raw, ok := fields["credHelpers"]; ok {
+		if err := json.Unmarshal(raw, &credHelpers); err != nil {
+			return nil, xerrors.Errorf("error parsing the credHelpers: %w", err)
+		}
+	}
+
+	return credHelpers, nil
+}
+
+// printRegistries prints a line for each of the registries, in order.
+func printRegistries(out io.Writer, path, action string, registries map[string]string) error {
+	keys := make([]string, 0, len(registries))
+	for key := range registries {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(out, "%s: %s %s\n", path, action, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// editConfigFile applies edit to the fields of the JSON configuration
+// file at path, which is created if it does not exist and create is
+// true, and writes the file back if edit reports a change. The file is
+// replaced atomically and keeps its permissions.
+func editConfigFile(path string, create bool, edit func(map[string]json.RawMessage) (bool, error)) error {
+	fields := make(map[string]json.RawMessage)
+	mode := os.FileMode(0o600)
+
+	data, err := os.ReadFile(path) // nolint: gosec
+	switch {
+	case os.IsNotExist(err):
+		if !create {
+			return nil
+		}
+	case err != nil:
+		return xerrors.Errorf("error reading %s: %w", path, err)
+	case len(strings.TrimSpace(string(data))) > 0:
+		if err = json.Unmarshal(data, &fields); err != nil {
+			return xerrors.Errorf("error parsing %s: %w", path, err)
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	changed, err := edit(fields)
+	if err != nil {
+		return xerrors.Errorf("error editing %s: %w", path, err)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if data, err = json.MarshalIndent(fields, "", "\t"); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, append(data, '\n'), mode)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it to path, so that readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return xerrors.Errorf("error creating directory %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return xerrors.Errorf("error creating temporary file in %s: %w", dir, err)
+	}
+
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close() // nolint: errcheck, gosec
+		return xerrors.Errorf("error writing %s: %w", tmp.Name(), err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return xerrors.Errorf("error writing %s: %w", tmp.Name(), err)
+	}
+
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return xerrors.Errorf("error setting the permissions of %s: %w", tmp.Name(), err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return xerrors.Errorf("error replacing %s: %w", path, err)
+	}
+
+	return nil
+}
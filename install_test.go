@@ -0,0 +1,318 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunInstall(t *testing.T) {
+	cases := []struct {
+		name       string
+		registries []string
+		args       []string
+		existing   string
+		expected   string
+		err        string
+	}{
+		{
+			name:       "docker",
+			registries: []string{"index.docker.io", "ghcr.io"},
+			expected: `{
+	"credHelpers": {
+		"ghcr.io": "vault-login",
+		"https://index.docker.io/v1/": "vault-login"
+	}
+}
+`,
+		},
+		{
+			name:       "nerdctl-keeps-other-fields",
+			registries: []string{"ghcr.io"},
+			args:       []string{"-runtime", "nerdctl", "-registry", "https://LOCALHOST:5000/v2/"},
+			existing:   `{"auths": {"quay.io": {"auth": "eA=="}}, "credHelpers": {"gcr.io": "gcloud"}}`,
+			expected: `{
+	"auths": {
+		"quay.io": {
+			"auth": "eA=="
+		}
+	},
+	"credHelpers": {
+		"gcr.io": "gcloud",
+		"localhost:5000": "vault-login"
+	}
+}
+`,
+		},
+		{
+			name:       "podman",
+			registries: []string{"index.docker.io", "quay.io"},
+			args:       []string{"-runtime", "podman"},
+			existing:   `{"auths": {}}`,
+			expected: `{
+	"auths": {},
+	"credHelpers": {
+		"docker.io": "vault-login",
+		"quay.io": "vault-login"
+	}
+}
+`,
+		},
+		{
+			name:     "no-registries",
+			existing: `{"credHelpers": {"gcr.io": "gcloud"}}`,
+			expected: `{
+	"credHelpers": {
+		"gcr.io": "gcloud"
+	},
+	"credsStore": "vault-login"
+}
+`,
+		},
+		{
+			name:       "creds-store",
+			registries: []string{"ghcr.io"},
+			args:       []string{"-creds-store"},
+			expected: `{
+	"credsStore": "vault-login"
+}
+`,
+		},
+		{
+			name: "podman-creds-store",
+			args: []string{"-runtime", "podman"},
+			err:  "podman only runs credential helpers of given registries; name the registries to use the helper for with -registry",
+		},
+		{
+			name: "creds-store-and-registry",
+			args: []string{"-creds-store", "-registry", "ghcr.io"},
+			err:  "-creds-store and -registry are mutually exclusive",
+		},
+		{
+			name:       "unknown-runtime",
+			registries: []string{"ghcr.io"},
+			args:       []string{"-runtime", "cri"},
+			err:        `unknown container tool "cri": must be one of docker, nerdctl or podman`,
+		},
+		{
+			name:       "invalid-file",
+			registries: []string{"ghcr.io"},
+			existing:   `{"credHelpers": []}`,
+			err:        "error editing ",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("DOCKER_CONFIG", filepath.Join(dir, "docker"))
+			t.Setenv(envXDGConfigHome, dir)
+			t.Setenv(envRegistryAuthFile, "")
+
+			path := filepath.Join(dir, "docker", "config.json")
+			if strings.Contains(strings.Join(tc.args, " "), "podman") {
+				path = filepath.Join(dir, "containers", "auth.json")
+			}
+
+			if tc.existing != "" {
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tc.existing), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var out bytes.Buffer
+
+			err := runInstall(tc.registries, "vault-login", tc.args, &out)
+			if tc.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+					t.Fatalf("Expected an error starting with %q, got %v", tc.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, string(data)); diff != "" {
+				t.Fatalf("Files differ:\n%s", diff)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedMode := os.FileMode(0o600)
+			if tc.existing != "" {
+				expectedMode = 0o640
+			}
+			if runtime.GOOS != "windows" && info.Mode().Perm() != expectedMode {
+				t.Fatalf("Expected mode %v, got %v", expectedMode, info.Mode().Perm())
+			}
+
+			if !strings.HasPrefix(out.String(), path+": using docker-credential-vault-login for ") {
+				t.Fatalf("Unexpected output:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestRunUninstall(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		existing string
+		expected string
+		output   []string
+		err      string
+	}{
+		{
+			name: "all",
+			existing: `{"auths": {}, "credsStore": "vault-login", ` +
+				`"credHelpers": {"ghcr.io": "vault-login", "https://index.docker.io/v1/": "vault-login"}}`,
+			expected: `{
+	"auths": {}
+}
+`,
+			output: []string{
+				"every registry",
+				"ghcr.io",
+				"https://index.docker.io/v1/",
+			},
+		},
+		{
+			name:     "registries",
+			args:     []string{"-registry", "docker.io"},
+			existing: `{"credsStore": "vault-login", "credHelpers": {"ghcr.io": "vault-login", "https://index.docker.io/v1/": "vault-login"}}`,
+			expected: `{
+	"credHelpers": {
+		"ghcr.io": "vault-login"
+	},
+	"credsStore": "vault-login"
+}
+`,
+			output: []string{"https://index.docker.io/v1/"},
+		},
+		{
+			name:     "other-helpers",
+			existing: `{"credsStore": "desktop", "credHelpers": {"gcr.io": "gcloud", "ghcr.io": "vault-login"}}`,
+			expected: `{
+	"credHelpers": {
+		"gcr.io": "gcloud"
+	},
+	"credsStore": "desktop"
+}
+`,
+			output: []string{"ghcr.io"},
+		},
+		{
+			name:     "podman",
+			args:     []string{"-runtime", "podman", "-registry", "https://index.docker.io/v1/"},
+			existing: `{"auths": {}, "credHelpers": {"docker.io": "vault-login"}}`,
+			expected: `{
+	"auths": {}
+}
+`,
+			output: []string{"docker.io"},
+		},
+		{
+			name:     "not-in-use",
+			existing: `{"credsStore": "desktop"}`,
+			expected: `{"credsStore": "desktop"}`,
+		},
+		{
+			name: "no-file",
+		},
+		{
+			name:     "invalid-file",
+			existing: `{"credHelpers": "vault-login"}`,
+			err:      "error editing ",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("DOCKER_CONFIG", filepath.Join(dir, "docker"))
+			t.Setenv(envXDGConfigHome, dir)
+			t.Setenv(envRegistryAuthFile, "")
+
+			path := filepath.Join(dir, "docker", "config.json")
+			if strings.Contains(strings.Join(tc.args, " "), "podman") {
+				path = filepath.Join(dir, "containers", "auth.json")
+			}
+
+			if tc.existing != "" {
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tc.existing), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var out bytes.Buffer
+
+			err := runUninstall("vault-login", tc.args, &out)
+			if tc.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+					t.Fatalf("Expected an error starting with %q, got %v", tc.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, string(data)); diff != "" {
+				t.Fatalf("Files differ:\n%s", diff)
+			}
+
+			expectedOutput := path + ": docker-credential-vault-login is not in use\n"
+			if len(tc.output) > 0 {
+				expectedOutput = ""
+				for _, registry := range tc.output {
+					expectedOutput += path + ": no longer using docker-credential-vault-login for " + registry + "\n"
+				}
+			}
+			if diff := cmp.Diff(expectedOutput, out.String()); diff != "" {
+				t.Fatalf("Outputs differ:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package rawproto reads and writes protobuf messages field by field, and
+// passes them through gRPC unchanged, so that the few messages of the
+// containerd and SPIFFE Workload APIs can be used without generated code.
+package rawproto
+
+import (
+	"bytes"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Fields calls fn with the number and value of every length-delimited
+// field of the protobuf message. Fields of other types are skipped.
+func Fields(msg []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		msg = msg[n:]
+
+		if typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, msg); n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			msg = msg[n:]
+
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		msg = msg[n:]
+
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AppendField appends a length-delimited field to the protobuf message.
+func AppendField(msg []byte, num protowire.Number, value []byte) []byte {
+	msg = protowire.AppendTag(msg, num, protowire.BytesType)
+	return protowire.AppendBytes(msg, value)
+}
+
+// Codec passes the encoded messages through. Messages are given to it as
+// a *[]byte.
+type Codec struct{}
+
+// Marshal returns the encoded message.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+
+	return *msg, nil
+}
+
+// Unmarshal stores a copy of the encoded message.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+
+	*msg = bytes.Clone(data)
+
+	return nil
+}
+
+// Name returns the name of the protobuf codec, which it replaces.
+func (Codec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rawproto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestFields(t *testing.T) {
+	type field struct {
+		Num   protowire.Number
+		Value string
+	}
+
+	varint := protowire.AppendVarint(protowire.AppendTag(nil, 3, protowire.VarintType), 42)
+
+	cases := []struct {
+		name     string
+		msg      []byte
+		expected []field
+		err      bool
+	}{
+		{
+			name: "bytes",
+			msg:  AppendField(AppendField(nil, 1, []byte("a")), 2, []byte("b")),
+			expected: []field{
+				{Num: 1, Value: "a"},
+				{Num: 2, Value: "b"},
+			},
+		},
+		{
+			name:     "other-types-skipped",
+			msg:      AppendField(varint, 1, []byte("a")),
+			expected: []field{{Num: 1, Value: "a"}},
+		},
+		{
+			name: "empty",
+		},
+		{
+			name: "truncated",
+			msg:  AppendField(nil, 1, []byte("abc"))[:3],
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []field
+
+			err := Fields(tc.msg, func(num protowire.Number, value []byte) error {
+				got = append(got, field{Num: num, Value: string(value)})
+				return nil
+			})
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Fatalf("unexpected fields (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("callback-error", func(t *testing.T) {
+		want := errors.New("stop")
+
+		err := Fields(AppendField(nil, 1, nil), func(protowire.Number, []byte) error {
+			return want
+		})
+		if !errors.Is(err, want) {
+			t.Fatalf("expected %v, got %v", want, err)
+		}
+	})
+}
+
+func TestCodec(t *testing.T) {
+	msg := []byte("message")
+
+	data, err := Codec{}.Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	if err = (Codec{}).Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(msg, got); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+
+	if _, err = (Codec{}).Marshal("message"); err == nil {
+		t.Fatal("expected an error marshaling a string")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogin"
+)
+
+// logFile is the log file of the day. Neither the file nor its directory is
+// created until the first line is written, so that a request which logs
+// nothing, such as one served from the cache, doesn't touch the file
+// system. If the file cannot be opened, the lines are written to the
+// fallback instead.
+type logFile struct {
+	dir      string
+	name     string
+	scoped   bool
+	fallback io.Writer
+
+	mu   sync.Mutex
+	file *os.File
+	err  error
+}
+
+func newLogFile(dir string, scoped bool, now time.Time) *logFile {
+	return &logFile{
+		dir:      dir,
+		name:     fmt.Sprintf("vault-login_%s.log", now.Format("2006-01-02")),
+		scoped:   scoped,
+		fallback: os.Stderr,
+	}
+}
+
+// Write writes p to the log file, opening it first if necessary.
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil && f.err == nil {
+		if f.file, f.err = f.open(); f.err != nil {
+			fmt.Fprintf(f.fallback, "error opening log file: %v\n", f.err) // nolint: errcheck
+		}
+	}
+
+	if f.err != nil {
+		return f.fallback.Write(p)
+	}
+
+	return f.file.Write(p)
+}
+
+// Close closes the log file, if it was opened.
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Close()
+}
+
+// Name returns the path of the log file, or an empty string if it has not
+// been opened.
+func (f *logFile) Name() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return ""
+	}
+
+	return f.file.Name()
+}
+
+func (f *logFile) open() (*os.File, error) {
+	dir := f.dir
+
+	var err error
+	if f.scoped {
+		if dir, err = vaultlogin.UserDir(dir); err != nil {
+			return nil, err
+		}
+	} else if err = os.MkdirAll(dir, 0o750); err != nil {
+		return nil, xerrors.Errorf("error creating directory %s: %w", dir, err)
+	}
+
+	return os.OpenFile(filepath.Join(dir, f.name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec
+}
@@ -14,22 +14,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/docker/docker-credential-helpers/credentials"
 	hclog "github.com/hashicorp/go-hclog"
 	homedir "github.com/mitchellh/go-homedir"
 	"golang.org/x/xerrors"
 
 	"github.com/morningconsult/docker-credential-vault-login/config"
-	"github.com/morningconsult/docker-credential-vault-login/helper"
-	"github.com/morningconsult/docker-credential-vault-login/vault"
+	"github.com/morningconsult/docker-credential-vault-login/harden"
+	"github.com/morningconsult/docker-credential-vault-login/messages"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogin"
 )
 
 var (
@@ -47,23 +50,26 @@ var (
 const (
 	banner = "Docker Credential Helper for Vault Storage version %v, commit %v, built %v\n"
 
-	defaultConfigFile = "/etc/docker-credential-vault-login/config.hcl"
-	defaultLogDir     = "~/.docker-credential-vault-login"
-
 	envConfigFile     = "DCVL_CONFIG_FILE"
 	envLogDir         = "DCVL_LOG_DIR"
+	envLogLevel       = "DCVL_LOG_LEVEL"
+	envLogFormat      = "DCVL_LOG_FORMAT"
 	envDisableCaching = "DCVL_DISABLE_CACHE"
+
+	adminSocketFile = "admin.sock"
+	proxySocketFile = "proxy.sock"
 )
 
 func main() { // nolint: funlen
 	var (
-		versionFlag, disableCache bool
-		configFile                string
+		versionFlag, disableCache, dryRun bool
+		configFile                        string
 	)
 
 	flag.BoolVar(&versionFlag, "version", false, "print version and exit")
 	flag.BoolVar(&disableCache, "disable-cache", false, "disable token caching")
-	flag.StringVar(&configFile, "config", defaultConfigFile, "path to the configuration file")
+	flag.BoolVar(&dryRun, "dry-run", false, "report what get does without printing the credentials")
+	flag.StringVar(&configFile, "config", "", "path to the configuration file (default: searched for, see the README)")
 	flag.Parse()
 
 	// Exit safely when version is used
@@ -72,65 +78,272 @@ func main() { // nolint: funlen
 		os.Exit(0)
 	}
 
+	identifyHelper()
+
+	// Errors are shown in the language of the user
+	msgs := messages.FromEnv()
+
+	// Fail fast if a program run by the helper invoked it again
+	if flag.Arg(0) != "admin" && flag.Arg(0) != "validate" {
+		if err := guardRecursion(msgs); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Get path to config file
+	configSource := "-config"
+
 	if f := os.Getenv(envConfigFile); f != "" {
-		var err error
+		configFile, configSource = f, envConfigFile
+	} else if configFile == "" {
+		found := findConfigFile(configFileSearchPath())
+		configFile, configSource = found.path, found.source
+	}
 
-		configFile, err = homedir.Expand(f)
-		if err != nil {
-			log.Fatalf("error expanding directory %q: %v", f, err)
+	expandedConfigFile, err := homedir.Expand(configFile)
+	if err != nil {
+		log.Fatal(msgs.Errorf(messages.ConfigFilePath, configFile, err))
+	}
+
+	configFile = expandedConfigFile
+	chosenConfigFile := configFile
+
+	if flag.Arg(0) == "validate" {
+		if err := runValidate(configFile, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
 		}
+
+		return
 	}
 
-	// Parse config file
-	cfg, err := config.LoadConfig(configFile)
+	// Credentials are imported on hosts which may not reach Vault
+	if flag.Arg(0) == "import" {
+		if err := runImport(flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	// Use the profile of the active Docker context, if it has one
+	dockerContext, err := config.CurrentDockerContext()
+	if err != nil {
+		log.Fatal(msgs.Errorf(messages.DockerContext, err))
+	}
+
+	contextConfigFile, err := config.ContextConfigFile(configFile, dockerContext)
 	if err != nil {
-		log.Fatalf("error parsing configuration file: %v", err)
+		log.Fatal(msgs.Errorf(messages.ConfigFileInvalid, configFile, err))
 	}
 
-	// Build secrets table
-	secretsTable, err := config.BuildSecretsTable(cfg.AutoAuth.Method.Config)
+	configFile = contextConfigFile
+
+	// Use the profile selected by DCVL_PROFILE or by the registry, if the
+	// configuration file has profiles
+	configData, profile, input, err := selectProfile(configFile, flag.Arg(0), os.Stdin)
 	if err != nil {
-		log.Fatalf("error building secrets table: %v", err)
+		log.Fatal(msgs.Errorf(messages.ProfileInvalid, configFile, err))
 	}
 
-	// Create new Vault client
-	client, err := vault.NewClient(cfg.AutoAuth.Method, cfg.Vault)
+	// Parse config file
+	cfg, err := config.ParseConfig(configData)
 	if err != nil {
-		log.Fatalf("error creating new Vault client: %v", err)
+		log.Fatal(msgs.Errorf(messages.ConfigFileInvalid, configFile, err))
+	}
+
+	// Check whether get should only report what it does
+	if dryRun, err = dryRunEnabled(dryRun); err != nil {
+		log.Fatal(msgs.Errorf(messages.SettingInvalid, err))
 	}
 
 	// Check whether caching should be enabled
 	enableCache, err := cacheEnabled(disableCache)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal(msgs.Errorf(messages.SettingInvalid, err))
+	}
+
+	// Check whether the paths of the configuration are shared by all users
+	shared, err := vaultlogin.SharedDaemon(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		log.Fatal(msgs.Errorf(messages.SettingInvalid, err))
+	}
+
+	// Create the directory in which state is persisted between invocations
+	cacheDir, err := vaultlogin.CacheDir(cfg.AutoAuth.Method.Config, shared)
+	if err != nil {
+		log.Fatal(msgs.Errorf(messages.CacheDir, err))
+	}
+
+	if cacheDir, err = profileCacheDir(cacheDir, profile); err != nil {
+		log.Fatal(msgs.Errorf(messages.CacheDir, err))
+	}
+
+	if flag.Arg(0) == "admin" {
+		if err = runAdmin(cacheDir, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if flag.Arg(0) == "systemd-install" {
+		var executable string
+
+		if executable, err = os.Executable(); err != nil {
+			log.Fatal(err)
+		}
+
+		if err = runSystemdInstall(executable, configFile, cacheDir, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if flag.Arg(0) == "install" {
+		var secretsTable config.SecretsTable
+
+		if secretsTable, err = config.BuildSecretsTable(cfg.AutoAuth.Method.Config); err != nil {
+			log.Fatal(msgs.Errorf(messages.SettingInvalid, err))
+		}
+
+		if err = runInstall(secretsTable.Registries(), credentialHelperName(), flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if flag.Arg(0) == "uninstall" {
+		if err = runUninstall(credentialHelperName(), flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		return
 	}
 
 	// Open log writer
-	logWriter, err := newLogWriter(cfg.AutoAuth.Method.Config)
+	logWriter, err := newLogWriter(cfg.AutoAuth.Method.Config, shared)
 	if err != nil {
-		log.Fatalf("error creating log file: %v", err)
+		log.Fatal(msgs.Errorf(messages.LogFile, err))
 	}
 	defer logWriter.Close() //nolint:errcheck
 
 	// Create logger
-	logger := hclog.New(&hclog.LoggerOptions{
-		Level:  hclog.Error,
-		Output: logWriter,
-	})
+	logger, err := newLogger(cfg.AutoAuth.Method.Config, logWriter)
+	if err != nil {
+		log.Fatal(msgs.Errorf(messages.Logger, err))
+	}
+
+	logger.Debug("using configuration file", "path", chosenConfigFile, "source", configSource)
+
+	// Lock the memory of the helper before it reads any secret
+	hardened, err := vaultlogin.MemoryHardening(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		log.Fatal(msgs.Errorf(messages.SettingInvalid, err))
+	}
+
+	if hardened {
+		if err = harden.LockMemory(); err != nil {
+			logger.Error("error locking memory", "code", messages.MemoryLock, "error", err)
+			log.Fatal(msgs.Errorf(messages.MemoryLock, err))
+		}
+	}
 
 	// Create a new credential helper
-	helper := helper.New(helper.Options{
-		Logger:      logger,
-		Client:      client,
-		Secret:      secretsTable,
-		EnableCache: enableCache,
-		AuthConfig:  cfg.AutoAuth,
-	})
-	credentials.Serve(helper)
+	helper, err := vaultlogin.NewFromConfig(cfg, configData, enableCache, cacheDir, logger)
+	if err != nil {
+		logger.Error("error creating credential helper", "code", messages.HelperInvalid, "error", err)
+		log.Fatal(msgs.Errorf(messages.HelperInvalid, err))
+	}
+
+	switch flag.Arg(0) {
+	case "diagnose":
+		var secretsTable config.SecretsTable
+
+		secretsTable, err = config.BuildSecretsTable(cfg.AutoAuth.Method.Config)
+		if err != nil {
+			log.Fatal(msgs.Errorf(messages.SettingInvalid, err))
+		}
+
+		if err = runDiagnose(helper, secretsTable.Paths(), flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "export":
+		var secretsTable config.SecretsTable
+
+		secretsTable, err = config.BuildSecretsTable(cfg.AutoAuth.Method.Config)
+		if err != nil {
+			log.Fatal(msgs.Errorf(messages.SettingInvalid, err))
+		}
+
+		err = runExport(helper, secretsTable.Registries(), secretsTable, flag.Args()[1:], os.Stdout)
+
+		if revokeErr := helper.RevokeOnExit(context.Background()); revokeErr != nil {
+			logger.Error("error revoking token on exit", "error", revokeErr)
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "verify-daemon":
+		if err = runVerifyDaemon(helper, credentialHelperName(), flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "watch":
+		d := newDaemon(helper, cfg, configFile, profile, enableCache, cacheDir, logger)
+		if err = runWatch(d, logger, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "serve":
+		d := newDaemon(helper, cfg, configFile, profile, enableCache, cacheDir, logger)
+		if err = runServe(d, logger, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		var in io.Reader = os.Stdin
+
+		// The input was already read to select the profile
+		if input != nil {
+			in = bytes.NewReader(input)
+		}
+
+		if dryRun {
+			err = runDryRun(helper, flag.Args(), in, os.Stdout)
+
+			if revokeErr := helper.RevokeOnExit(context.Background()); revokeErr != nil {
+				logger.Error("error revoking token on exit", "error", revokeErr)
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+
+		serve := serveProtocol
+		if hardened {
+			serve = serveHardened
+		}
+
+		code := serve(helper, flag.Args(), in, os.Stdout)
+
+		// Revoke the token once the credentials are written
+		if err = helper.RevokeOnExit(context.Background()); err != nil {
+			logger.Error("error revoking token on exit", "error", err)
+		}
+
+		if code != 0 {
+			os.Exit(code)
+		}
+	}
 }
 
-func newLogWriter(config map[string]interface{}) (*os.File, error) {
+// newLogWriter returns the log file of the day, which is opened when the
+// first line is written. Unless the paths are shared, a logging directory
+// outside the home directory of the user is scoped to the user.
+func newLogWriter(config map[string]interface{}, shared bool) (*logFile, error) {
 	logDir := defaultLogDir
 	if v := os.Getenv(envLogDir); v != "" {
 		logDir = v
@@ -146,13 +359,46 @@ func newLogWriter(config map[string]interface{}) (*os.File, error) {
 		return nil, xerrors.Errorf("error expanding logging directory %s: %w", logDir, err)
 	}
 
-	if err = os.MkdirAll(logDir, 0o750); err != nil {
-		return nil, xerrors.Errorf("error creating directory %s: %w", logDir, err)
+	return newLogFile(logDir, !shared && !vaultlogin.InHomeDir(logDir), time.Now()), nil
+}
+
+// newLogger creates a logger which writes to w. Its level and format are
+// taken from the DCVL_LOG_LEVEL and DCVL_LOG_FORMAT environment variables
+// or, if they are not set, the 'log_level' and 'log_format' config values.
+// By default, only errors are logged, as text.
+func newLogger(config map[string]interface{}, w io.Writer) (hclog.Logger, error) {
+	levelName := logSetting(config, envLogLevel, "log_level", "error")
+
+	level := hclog.LevelFromString(levelName)
+	if level == hclog.NoLevel || level == hclog.Off {
+		return nil, xerrors.Errorf("invalid log level %q: must be one of trace, debug, info, warn or error",
+			levelName)
 	}
 
-	logFile := filepath.Join(logDir, fmt.Sprintf("vault-login_%s.log", time.Now().Format("2006-01-02")))
+	format := logSetting(config, envLogFormat, "log_format", "text")
+	if format != "text" && format != "json" {
+		return nil, xerrors.Errorf("invalid log format %q: must be either text or json", format)
+	}
+
+	return hclog.New(&hclog.LoggerOptions{
+		Level:      level,
+		Output:     w,
+		JSONFormat: format == "json",
+	}), nil
+}
+
+// logSetting returns the value of the environment variable or, if it is
+// not set, of the config value, lowercased.
+func logSetting(config map[string]interface{}, env, key, defaultValue string) string {
+	if v := os.Getenv(env); v != "" {
+		return strings.ToLower(strings.TrimSpace(v))
+	}
+
+	if v, ok := config[key].(string); ok && v != "" {
+		return strings.ToLower(strings.TrimSpace(v))
+	}
 
-	return os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec
+	return defaultValue
 }
 
 func cacheEnabled(disableCache bool) (bool, error) {
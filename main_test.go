@@ -14,8 +14,12 @@
 package main
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -62,7 +66,7 @@ func TestNewLogWriter(t *testing.T) {
 			tc.pre()
 			defer tc.post()
 
-			file, err := newLogWriter(tc.config)
+			file, err := newLogWriter(tc.config, true)
 			if tc.err != "" {
 				if err == nil {
 					t.Fatal("expected an error but didn't receive one")
@@ -75,6 +79,12 @@ func TestNewLogWriter(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			if file.Name() != "" {
+				t.Fatalf("Expected the log file not to be opened before the first write, got %s", file.Name())
+			}
+			if _, err = file.Write([]byte("log line\n")); err != nil {
+				t.Fatal(err)
+			}
 			file.Close()
 			filename := file.Name()
 			if _, err = os.Stat(filename); err != nil {
@@ -84,3 +94,133 @@ func TestNewLogWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestLogFile_Fallback(t *testing.T) {
+	dir := t.TempDir()
+
+	// The directory of the log file cannot be created under a file
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var fallback bytes.Buffer
+
+	file := newLogFile(filepath.Join(blocker, "logs"), false, time.Now())
+	file.fallback = &fallback
+
+	for _, line := range []string{"first line\n", "second line\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	output := fallback.String()
+	if strings.Count(output, "error opening log file") != 1 {
+		t.Fatalf("Expected the error to be written once, got %q", output)
+	}
+	if !strings.HasSuffix(output, "first line\nsecond line\n") {
+		t.Fatalf("Expected the lines to be written to the fallback, got %q", output)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  map[string]interface{}
+		env     map[string]string
+		logged  []string
+		ignored []string
+		err     string
+	}{
+		{
+			name:    "defaults",
+			config:  map[string]interface{}{},
+			logged:  []string{"[ERROR] error message"},
+			ignored: []string{"warn message"},
+		},
+		{
+			name:    "config",
+			config:  map[string]interface{}{"log_level": "Warn"},
+			logged:  []string{"[WARN]  warn message", "[ERROR] error message"},
+			ignored: []string{"info message"},
+		},
+		{
+			name:   "json",
+			config: map[string]interface{}{"log_level": "debug", "log_format": "json"},
+			logged: []string{
+				`"@level":"debug","@message":"debug message"`,
+				`"@level":"error","@message":"error message"`,
+			},
+			ignored: []string{"trace message"},
+		},
+		{
+			name:   "env-overrides-config",
+			config: map[string]interface{}{"log_level": "error", "log_format": "json"},
+			env: map[string]string{
+				envLogLevel:  "trace",
+				envLogFormat: "text",
+			},
+			logged: []string{"[TRACE] trace message"},
+		},
+		{
+			name:   "bad-level",
+			config: map[string]interface{}{"log_level": "verbose"},
+			err:    "invalid log level \"verbose\": must be one of trace, debug, info, warn or error",
+		},
+		{
+			name:   "bad-format",
+			env:    map[string]string{envLogFormat: "xml"},
+			config: map[string]interface{}{},
+			err:    "invalid log format \"xml\": must be either text or json",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envLogLevel, "")
+			t.Setenv(envLogFormat, "")
+
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			buf := new(bytes.Buffer)
+
+			logger, err := newLogger(tc.config, buf)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger.Trace("trace message")
+			logger.Debug("debug message")
+			logger.Info("info message")
+			logger.Warn("warn message")
+			logger.Error("error message")
+
+			for _, s := range tc.logged {
+				if !strings.Contains(buf.String(), s) {
+					t.Fatalf("Expected log to contain %q, got:\n%s", s, buf.String())
+				}
+			}
+			for _, s := range tc.ignored {
+				if strings.Contains(buf.String(), s) {
+					t.Fatalf("Expected log not to contain %q, got:\n%s", s, buf.String())
+				}
+			}
+		})
+	}
+}
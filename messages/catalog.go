@@ -0,0 +1,138 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package messages
+
+// catalogs maps the supported languages to their messages. The messages of
+// every language take the same arguments, in the same order, as the
+// English ones.
+var catalogs = map[string]map[Code]string{
+	"en": {
+		ConfigFilePath:    "the path of the configuration file %q could not be expanded: %v",
+		DockerContext:     "the active Docker context could not be detected: %v",
+		ConfigFileInvalid: "the configuration file %s is invalid: %v",
+		SettingInvalid:    "the configuration is invalid: %v",
+		CacheDir:          "the cache directory could not be created: %v",
+		LogFile:           "the log file could not be created: %v",
+		Logger:            "the logger could not be created: %v",
+		HelperInvalid:     "the credential helper could not be created: %v",
+		RecursiveInvocation: "the helper was invoked recursively by a program run by the helper (process %s); " +
+			"check that no chained credential helper or hook calls Docker or the helper for the same " +
+			"registry, or unset %s if this is intended",
+		ProfileInvalid: "no profile of the configuration file %s could be selected: %v",
+		MemoryLock:     "the memory of the helper could not be locked as required by 'memory_hardening': %v",
+		RegistryNotConfigured: "no secret is configured for the registry %q; add the registry to " +
+			"'auto_auth.method.config.secrets': %v",
+		UsernamePrompt:    "Vault username: ",
+		PasswordPrompt:    "Vault password for %s: ",
+		OIDCBrowserPrompt: "Complete the Vault login in your browser. If it does not open, visit:",
+		OIDCURLPrompt:     "Open the following URL in a browser to log in to Vault:",
+		OIDCSignedIn:      "Signed in to Vault. You may close this window.",
+		OIDCLoginFailed:   "Vault login failed: %v",
+	},
+	"de": {
+		ConfigFilePath:    "der Pfad der Konfigurationsdatei %q konnte nicht aufgelöst werden: %v",
+		DockerContext:     "der aktive Docker-Kontext konnte nicht ermittelt werden: %v",
+		ConfigFileInvalid: "die Konfigurationsdatei %s ist ungültig: %v",
+		SettingInvalid:    "die Konfiguration ist ungültig: %v",
+		CacheDir:          "das Cache-Verzeichnis konnte nicht erstellt werden: %v",
+		LogFile:           "die Protokolldatei konnte nicht erstellt werden: %v",
+		Logger:            "die Protokollierung konnte nicht eingerichtet werden: %v",
+		HelperInvalid:     "der Credential Helper konnte nicht erstellt werden: %v",
+		RecursiveInvocation: "der Helper wurde rekursiv von einem Programm aufgerufen, das er selbst ausführt " +
+			"(Prozess %s); stellen Sie sicher, dass kein verketteter Credential Helper und kein Hook Docker " +
+			"oder den Helper für dieselbe Registry aufruft, oder entfernen Sie %s, falls dies beabsichtigt ist",
+		ProfileInvalid: "es konnte kein Profil der Konfigurationsdatei %s ausgewählt werden: %v",
+		MemoryLock:     "der Speicher des Helpers konnte nicht gesperrt werden, wie es 'memory_hardening' verlangt: %v",
+		RegistryNotConfigured: "für die Registry %q ist kein Secret konfiguriert; fügen Sie die Registry zu " +
+			"'auto_auth.method.config.secrets' hinzu: %v",
+		UsernamePrompt: "Vault-Benutzername: ",
+		PasswordPrompt: "Vault-Passwort für %s: ",
+		OIDCBrowserPrompt: "Schließen Sie die Vault-Anmeldung in Ihrem Browser ab. Falls er sich nicht öffnet, " +
+			"besuchen Sie:",
+		OIDCURLPrompt:   "Öffnen Sie die folgende URL in einem Browser, um sich bei Vault anzumelden:",
+		OIDCSignedIn:    "Bei Vault angemeldet. Sie können dieses Fenster schließen.",
+		OIDCLoginFailed: "Die Vault-Anmeldung ist fehlgeschlagen: %v",
+	},
+	"es": {
+		ConfigFilePath:    "no se pudo expandir la ruta del archivo de configuración %q: %v",
+		DockerContext:     "no se pudo detectar el contexto de Docker activo: %v",
+		ConfigFileInvalid: "el archivo de configuración %s no es válido: %v",
+		SettingInvalid:    "la configuración no es válida: %v",
+		CacheDir:          "no se pudo crear el directorio de caché: %v",
+		LogFile:           "no se pudo crear el archivo de registro: %v",
+		Logger:            "no se pudo configurar el registro: %v",
+		HelperInvalid:     "no se pudo crear el credential helper: %v",
+		RecursiveInvocation: "el helper fue invocado recursivamente por un programa que él mismo ejecuta " +
+			"(proceso %s); compruebe que ningún credential helper encadenado ni ningún hook llame a Docker " +
+			"o al helper para el mismo registro, o elimine %s si es intencionado",
+		ProfileInvalid: "no se pudo seleccionar un perfil del archivo de configuración %s: %v",
+		MemoryLock:     "no se pudo bloquear la memoria del helper como exige 'memory_hardening': %v",
+		RegistryNotConfigured: "no hay ningún secreto configurado para el registro %q; añada el registro a " +
+			"'auto_auth.method.config.secrets': %v",
+		UsernamePrompt:    "Usuario de Vault: ",
+		PasswordPrompt:    "Contraseña de Vault para %s: ",
+		OIDCBrowserPrompt: "Complete el inicio de sesión en Vault en su navegador. Si no se abre, visite:",
+		OIDCURLPrompt:     "Abra la siguiente URL en un navegador para iniciar sesión en Vault:",
+		OIDCSignedIn:      "Sesión iniciada en Vault. Puede cerrar esta ventana.",
+		OIDCLoginFailed:   "el inicio de sesión en Vault falló: %v",
+	},
+	"fr": {
+		ConfigFilePath:    "le chemin du fichier de configuration %q n'a pas pu être développé : %v",
+		DockerContext:     "le contexte Docker actif n'a pas pu être détecté : %v",
+		ConfigFileInvalid: "le fichier de configuration %s est invalide : %v",
+		SettingInvalid:    "la configuration est invalide : %v",
+		CacheDir:          "le répertoire de cache n'a pas pu être créé : %v",
+		LogFile:           "le fichier journal n'a pas pu être créé : %v",
+		Logger:            "la journalisation n'a pas pu être configurée : %v",
+		HelperInvalid:     "le credential helper n'a pas pu être créé : %v",
+		RecursiveInvocation: "le helper a été invoqué récursivement par un programme qu'il exécute " +
+			"(processus %s) ; vérifiez qu'aucun credential helper chaîné ni aucun hook n'appelle Docker " +
+			"ou le helper pour le même registre, ou supprimez %s si c'est voulu",
+		ProfileInvalid: "aucun profil du fichier de configuration %s n'a pu être sélectionné : %v",
+		MemoryLock:     "la mémoire du helper n'a pas pu être verrouillée comme l'exige 'memory_hardening' : %v",
+		RegistryNotConfigured: "aucun secret n'est configuré pour le registre %q ; ajoutez le registre à " +
+			"'auto_auth.method.config.secrets' : %v",
+		UsernamePrompt: "Nom d'utilisateur Vault : ",
+		PasswordPrompt: "Mot de passe Vault de %s : ",
+		OIDCBrowserPrompt: "Terminez la connexion à Vault dans votre navigateur. S'il ne s'ouvre pas, " +
+			"rendez-vous sur :",
+		OIDCURLPrompt:   "Ouvrez l'URL suivante dans un navigateur pour vous connecter à Vault :",
+		OIDCSignedIn:    "Connecté à Vault. Vous pouvez fermer cette fenêtre.",
+		OIDCLoginFailed: "la connexion à Vault a échoué : %v",
+	},
+	"ja": {
+		ConfigFilePath:    "設定ファイルのパス %q を展開できませんでした: %v",
+		DockerContext:     "アクティブな Docker コンテキストを検出できませんでした: %v",
+		ConfigFileInvalid: "設定ファイル %s が無効です: %v",
+		SettingInvalid:    "設定が無効です: %v",
+		CacheDir:          "キャッシュディレクトリを作成できませんでした: %v",
+		LogFile:           "ログファイルを作成できませんでした: %v",
+		Logger:            "ログの設定に失敗しました: %v",
+		HelperInvalid:     "認証情報ヘルパーを作成できませんでした: %v",
+		RecursiveInvocation: "ヘルパーが実行したプログラム (プロセス %s) からヘルパーが再帰的に呼び出されました。" +
+			"連鎖した認証情報ヘルパーやフックが同じレジストリに対して Docker またはヘルパーを呼び出して" +
+			"いないか確認してください。意図的な場合は %s を解除してください",
+		ProfileInvalid: "設定ファイル %s のプロファイルを選択できませんでした: %v",
+		MemoryLock:     "'memory_hardening' で必要なヘルパーのメモリのロックに失敗しました: %v",
+		RegistryNotConfigured: "レジストリ %q に対するシークレットが設定されていません。" +
+			"'auto_auth.method.config.secrets' にレジストリを追加してください: %v",
+		UsernamePrompt: "Vault のユーザー名: ",
+		PasswordPrompt: "%s の Vault パスワード: ",
+		OIDCBrowserPrompt: "ブラウザで Vault へのログインを完了してください。" +
+			"ブラウザが開かない場合は次の URL にアクセスしてください:",
+		OIDCURLPrompt:   "Vault にログインするには、ブラウザで次の URL を開いてください:",
+		OIDCSignedIn:    "Vault にログインしました。このウィンドウを閉じてもかまいません。",
+		OIDCLoginFailed: "Vault へのログインに失敗しました: %v",
+	},
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package messages is the catalog of the errors and prompts which the
+// helper shows to its users, in every language it supports. Every message has a code which
+// is the same in every language, so that the log, which is always in
+// English, and the documentation can be searched for the messages shown in
+// any language.
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvLocale is the environment variable which selects the language of the
+// messages. If it is not set, the locale of the environment (LC_ALL,
+// LC_MESSAGES or LANG) is used.
+const EnvLocale = "DCVL_LOCALE"
+
+// DefaultLocale is the language of the log, and of the messages whose
+// locale is not supported.
+const DefaultLocale = "en"
+
+// Code identifies a message in every language.
+type Code string
+
+// The codes of the messages. Codes must never be reused or renumbered.
+const (
+	ConfigFilePath        Code = "DCVL-1001"
+	DockerContext         Code = "DCVL-1002"
+	ConfigFileInvalid     Code = "DCVL-1003"
+	SettingInvalid        Code = "DCVL-1004"
+	CacheDir              Code = "DCVL-1005"
+	LogFile               Code = "DCVL-1006"
+	Logger                Code = "DCVL-1007"
+	HelperInvalid         Code = "DCVL-1008"
+	RecursiveInvocation   Code = "DCVL-1009"
+	ProfileInvalid        Code = "DCVL-1010"
+	MemoryLock            Code = "DCVL-1011"
+	RegistryNotConfigured Code = "DCVL-2001"
+	UsernamePrompt        Code = "DCVL-3001"
+	PasswordPrompt        Code = "DCVL-3002"
+	OIDCBrowserPrompt     Code = "DCVL-3003"
+	OIDCURLPrompt         Code = "DCVL-3004"
+	OIDCSignedIn          Code = "DCVL-3005"
+	OIDCLoginFailed       Code = "DCVL-3006"
+)
+
+// Catalog formats the messages in one language.
+type Catalog struct {
+	locale   string
+	messages map[Code]string
+}
+
+// Error is a user-facing error. Its message is in the language of the
+// catalog which created it.
+type Error struct {
+	Code    Code
+	Message string
+
+	// Err is the error which caused this one, if any.
+	Err error
+}
+
+// Error returns the code and message of the error.
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Unwrap returns the error which caused this one.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates a catalog of the messages in the language of locale, which
+// may be a language tag (e.g. "pt-BR") or a POSIX locale (e.g.
+// "de_DE.UTF-8"). If the language is not supported, the messages are in
+// English.
+func New(locale string) *Catalog {
+	for _, tag := range candidates(locale) {
+		if messages, ok := catalogs[tag]; ok {
+			return &Catalog{locale: tag, messages: messages}
+		}
+	}
+
+	return &Catalog{locale: DefaultLocale, messages: catalogs[DefaultLocale]}
+}
+
+// FromEnv creates a catalog of the messages in the language selected by
+// DCVL_LOCALE or, if it is not set, by the locale of the environment.
+func FromEnv() *Catalog {
+	for _, env := range []string{EnvLocale, "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(env); locale != "" {
+			return New(locale)
+		}
+	}
+
+	return New(DefaultLocale)
+}
+
+// Locale returns the language of the messages.
+func (c *Catalog) Locale() string {
+	if c == nil {
+		return DefaultLocale
+	}
+
+	return c.locale
+}
+
+// Sprintf formats the message with the code. Messages which are missing
+// from the language of the catalog are in English. If c is nil, the
+// message is in English.
+func (c *Catalog) Sprintf(code Code, args ...interface{}) string {
+	format, ok := catalogs[DefaultLocale][code]
+	if c != nil {
+		if localized, found := c.messages[code]; found {
+			format, ok = localized, true
+		}
+	}
+
+	if !ok {
+		return fmt.Sprint(append([]interface{}{string(code)}, args...)...)
+	}
+
+	return fmt.Sprintf(format, args...)
+}
+
+// Errorf returns an Error with the formatted message. The first argument
+// which is an error becomes the cause of the Error.
+func (c *Catalog) Errorf(code Code, args ...interface{}) error {
+	e := &Error{Code: code, Message: c.Sprintf(code, args...)}
+
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			e.Err = err
+			break
+		}
+	}
+
+	return e
+}
+
+// CodeOf returns the code of the first Error in the chain of err, or an
+// empty code if there is none.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+
+	return ""
+}
+
+// candidates returns the language tags to look up for the locale, from
+// the most to the least specific.
+func candidates(locale string) []string {
+	// Strip the encoding and modifier of POSIX locales (e.g. ".UTF-8@euro")
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if tag == "" || tag == "c" || tag == "posix" {
+		return nil
+	}
+
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		return []string{tag, tag[:i]}
+	}
+
+	return []string{tag}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNew(t *testing.T) {
+	cases := map[string]string{
+		"":            "en",
+		"C":           "en",
+		"POSIX":       "en",
+		"de":          "de",
+		"de_DE.UTF-8": "de",
+		"fr-CA":       "fr",
+		"ja_JP@jp":    "ja",
+		"pt_BR":       "en",
+	}
+
+	for locale, expected := range cases {
+		if got := New(locale).Locale(); got != expected {
+			t.Errorf("New(%q).Locale() = %q, expected %q", locale, got, expected)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvLocale, "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "fr_FR.UTF-8")
+	t.Setenv("LANG", "de_DE.UTF-8")
+
+	if locale := FromEnv().Locale(); locale != "fr" {
+		t.Fatalf("Expected LC_MESSAGES to take precedence over LANG, got %q", locale)
+	}
+
+	t.Setenv(EnvLocale, "es")
+
+	if locale := FromEnv().Locale(); locale != "es" {
+		t.Fatalf("Expected %s to take precedence, got %q", EnvLocale, locale)
+	}
+}
+
+func TestCatalog_Errorf(t *testing.T) {
+	cause := errors.New("registry \"example.com\" not found in configuration")
+
+	cases := []struct {
+		catalog  *Catalog
+		expected string
+	}{
+		{
+			catalog: nil,
+			expected: `DCVL-2001: no secret is configured for the registry "example.com"; add the registry to ` +
+				`'auto_auth.method.config.secrets': registry "example.com" not found in configuration`,
+		},
+		{
+			catalog: New("de"),
+			expected: `DCVL-2001: für die Registry "example.com" ist kein Secret konfiguriert; fügen Sie die ` +
+				`Registry zu 'auto_auth.method.config.secrets' hinzu: registry "example.com" not found in configuration`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.catalog.Locale(), func(t *testing.T) {
+			err := tc.catalog.Errorf(RegistryNotConfigured, "example.com", cause)
+			if diff := cmp.Diff(tc.expected, err.Error()); diff != "" {
+				t.Fatalf("Errors differ:\n%s", diff)
+			}
+			if !errors.Is(err, cause) {
+				t.Fatal("Expected the error to wrap its cause")
+			}
+			if code := CodeOf(fmt.Errorf("wrapped: %w", err)); code != RegistryNotConfigured {
+				t.Fatalf("Expected code %s, got %q", RegistryNotConfigured, code)
+			}
+		})
+	}
+}
+
+// TestCatalogs verifies that every language has every message and that
+// the messages take the same arguments as the English ones.
+func TestCatalogs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+
+	for locale, messages := range catalogs {
+		for code, english := range catalogs[DefaultLocale] {
+			message, ok := messages[code]
+			if !ok {
+				t.Errorf("Message %s is missing from %q", code, locale)
+				continue
+			}
+
+			if diff := cmp.Diff(verbs.FindAllString(english, -1), verbs.FindAllString(message, -1)); diff != "" {
+				t.Errorf("Arguments of message %s differ in %q:\n%s", code, locale, diff)
+			}
+		}
+	}
+}
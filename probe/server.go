@@ -0,0 +1,186 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package probe implements the liveness and readiness probes of a
+// long-running credential helper, served over HTTP on a loopback address
+// for supervisors such as systemd or Kubernetes.
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+
+	// checkTimeout bounds how long the readiness checks may take, so that a
+	// probe fails rather than hangs while Vault is unreachable.
+	checkTimeout = 5 * time.Second
+)
+
+// Checker reports whether the helper is ready to answer requests.
+type Checker interface {
+	// Ready reports whether the helper is ready, along with a
+	// JSON-encodable report of its state.
+	Ready(ctx context.Context) (bool, interface{})
+}
+
+// ServerOptions is used to configure a new Server instance.
+type ServerOptions struct {
+	Logger  hclog.Logger
+	Checker Checker
+	Address string
+}
+
+// Server serves /healthz, which succeeds as long as the process serves
+// requests, and /readyz, which succeeds only if the Checker reports that
+// the helper is ready and fails with 503 Service Unavailable otherwise.
+type Server struct {
+	logger  hclog.Logger
+	checker Checker
+	address string
+	ready   chan struct{}
+	addr    net.Addr
+}
+
+// NewServer creates a new Server instance.
+func NewServer(opts ServerOptions) *Server {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	return &Server{
+		logger:  logger,
+		checker: opts.Checker,
+		address: opts.Address,
+		ready:   make(chan struct{}),
+	}
+}
+
+// CheckAddress returns an error unless the address (host:port) is on a
+// loopback interface, since the probes are not authenticated.
+func CheckAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return xerrors.Errorf("invalid health address %q: %w", address, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return xerrors.Errorf("health address %q must be on a loopback interface", address)
+	}
+
+	return nil
+}
+
+// Serve listens on the address and serves the probes until the context is
+// canceled.
+func (s *Server) Serve(ctx context.Context) error {
+	if err := CheckAddress(s.address); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return xerrors.Errorf("error listening on health address: %w", err)
+	}
+
+	s.addr = ln.Addr()
+	close(s.ready)
+
+	srv := &http.Server{
+		Handler:           s.routes(),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background()) // nolint: errcheck
+	}()
+
+	s.logger.Info("serving health probes", "address", s.addr.String())
+
+	err = srv.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Ready returns a channel which is closed once Serve listens on the
+// address.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Addr returns the address on which the server listens, e.g. to find the
+// port chosen for port 0. It must only be called once Ready is closed.
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", s.probe(func(*http.Request) (bool, interface{}) {
+		return true, status{Status: "ok"}
+	}))
+	mux.HandleFunc("/readyz", s.probe(func(r *http.Request) (bool, interface{}) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		return s.checker.Ready(ctx)
+	}))
+
+	return mux
+}
+
+type status struct {
+	Status string `json:"status"`
+}
+
+// probe returns an HTTP handler which answers GET and HEAD requests with
+// the report of fn, with status 200 if fn succeeds and 503 otherwise.
+func (s *Server) probe(fn func(*http.Request) (bool, interface{})) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		ok, report := fn(r)
+
+		code := http.StatusOK
+		if !ok {
+			code = http.StatusServiceUnavailable
+			s.logger.Debug("probe failed", "path", r.URL.Path)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(report) // nolint: errcheck
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockChecker struct {
+	ready bool
+}
+
+func (m *mockChecker) Ready(context.Context) (bool, interface{}) {
+	return m.ready, map[string]bool{"ready": m.ready}
+}
+
+func TestServer(t *testing.T) {
+	checker := &mockChecker{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	srv := NewServer(ServerOptions{Checker: checker, Address: "127.0.0.1:0"})
+
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+
+	select {
+	case <-srv.Ready():
+	case err := <-done:
+		cancel()
+		t.Fatalf("probes did not start: %v", err)
+	}
+
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("error serving probes: %v", err)
+		}
+	}()
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		ready  bool
+		status int
+		body   string
+	}{
+		{
+			name:   "healthz",
+			method: http.MethodGet,
+			path:   "/healthz",
+			status: http.StatusOK,
+			body:   `{"status":"ok"}`,
+		},
+		{
+			name:   "readyz-ready",
+			method: http.MethodGet,
+			path:   "/readyz",
+			ready:  true,
+			status: http.StatusOK,
+			body:   `{"ready":true}`,
+		},
+		{
+			name:   "readyz-not-ready",
+			method: http.MethodGet,
+			path:   "/readyz",
+			status: http.StatusServiceUnavailable,
+			body:   `{"ready":false}`,
+		},
+		{
+			name:   "method-not-allowed",
+			method: http.MethodPost,
+			path:   "/readyz",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker.ready = tc.ready
+
+			req, err := http.NewRequest(tc.method, "http://"+srv.Addr().String()+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("Expected status %d, got %d", tc.status, resp.StatusCode)
+			}
+			if diff := cmp.Diff(tc.body, strings.TrimSpace(string(body))); diff != "" {
+				t.Fatalf("Bodies differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	cases := []struct {
+		address string
+		err     string
+	}{
+		{address: "127.0.0.1:8089"},
+		{address: "[::1]:8089"},
+		{address: "localhost:8089"},
+		{
+			address: "0.0.0.0:8089",
+			err:     `health address "0.0.0.0:8089" must be on a loopback interface`,
+		},
+		{
+			address: "8089",
+			err:     `invalid health address "8089": address 8089: missing port in address`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.address, func(t *testing.T) {
+			err := CheckAddress(tc.address)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if err.Error() != tc.err {
+				t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package process runs the external programs to which the helper delegates
+// (such as other credential helpers) and records how each of them ran in
+// the helper's log, so that their failures can be told apart from the
+// helper's own.
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// maxStderr is the number of bytes of the standard error of a program
+	// which are kept.
+	maxStderr = 4096
+
+	// waitDelay is how long to wait for the output of a program which was
+	// killed, since its children may hold on to it.
+	waitDelay = time.Second
+
+	redacted = "[REDACTED]"
+)
+
+// vaultTokenPattern matches Vault tokens, which are redacted from the
+// output of every program.
+var vaultTokenPattern = regexp.MustCompile(`\b(hv[sbr]|[sbr])\.[A-Za-z0-9_-]{20,}`)
+
+// Command is an external program to run.
+type Command struct {
+	Logger hclog.Logger
+
+	// Path is the program to run and Args its arguments, not including
+	// the program itself.
+	Path string
+	Args []string
+
+	// Env, if set, is the environment of the program. Otherwise, the
+	// program inherits the environment of the helper.
+	Env []string
+
+	// Stdin is written to the standard input of the program.
+	Stdin []byte
+
+	// Secrets are redacted from the arguments and the standard error of
+	// the program wherever they are logged or returned.
+	Secrets []string
+
+	// Stderr, if set, is also given the standard error of the program,
+	// for programs which report some failures only there.
+	Stderr io.Writer
+
+	// ExpectedFailure, if set, reports whether the program failed in a
+	// way which the caller handles, such as a credential helper not
+	// finding the credentials. Such failures are logged at the debug
+	// level.
+	ExpectedFailure func(exitCode int, stdout []byte) bool
+}
+
+// Error is returned when a program cannot be started or exits with a
+// non-zero status.
+type Error struct {
+	Path     string
+	ExitCode int
+	Stderr   string
+	Duration time.Duration
+	Err      error
+}
+
+// Error returns the message of the error, including the redacted standard
+// error of the program.
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s failed after %s", e.Path, e.Duration.Round(time.Millisecond))
+	if e.ExitCode > 0 {
+		msg = fmt.Sprintf("%s exited with status %d after %s", e.Path, e.ExitCode,
+			e.Duration.Round(time.Millisecond))
+	}
+
+	if e.Stderr != "" {
+		return msg + ": " + e.Stderr
+	}
+
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Run runs the program and returns its standard output, even if it fails,
+// since some programs report their errors there. The arguments, exit code,
+// duration and standard error of the program are logged: at the debug
+// level if it succeeds or fails as expected, and at the error level
+// otherwise.
+func (c *Command) Run(ctx context.Context) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...) // nolint: gosec
+	cmd.Env = c.Env
+	cmd.WaitDelay = waitDelay
+
+	var stdout bytes.Buffer
+
+	stderr := &limitedBuffer{limit: maxStderr}
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	if c.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(stderr, c.Stderr)
+	}
+
+	if c.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(c.Stdin)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start)
+
+	exitCode := 0
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+
+	args := []interface{}{
+		"path", c.Path,
+		"args", c.redact(strings.Join(c.Args, " ")),
+		"exit_code", exitCode,
+		"duration", duration,
+	}
+
+	msg := c.redact(strings.TrimSpace(stderr.String()))
+	if msg != "" {
+		args = append(args, "stderr", msg)
+	}
+
+	logger := c.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	if err == nil {
+		logger.Debug("external program succeeded", args...)
+		return stdout.Bytes(), nil
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = ctx.Err()
+	}
+
+	if c.ExpectedFailure != nil && c.ExpectedFailure(exitCode, stdout.Bytes()) {
+		logger.Debug("external program failed as expected", append(args, "error", err)...)
+	} else {
+		logger.Error("external program failed", append(args, "error", err)...)
+	}
+
+	return stdout.Bytes(), &Error{
+		Path:     c.Path,
+		ExitCode: exitCode,
+		Stderr:   msg,
+		Duration: duration,
+		Err:      err,
+	}
+}
+
+// redact replaces the secrets of the command and anything which looks
+// like a Vault token in s.
+func (c *Command) redact(s string) string {
+	for _, secret := range c.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+
+	return vaultTokenPattern.ReplaceAllString(s, redacted)
+}
+
+// limitedBuffer keeps the first bytes written to it, up to its limit.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.buf.Len(); n < len(p) {
+		b.buf.Write(p[:n]) // nolint: errcheck
+		b.truncated = true
+
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "..."
+	}
+
+	return b.buf.String()
+}
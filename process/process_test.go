@@ -0,0 +1,163 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestCommand_Run(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	cases := []struct {
+		name       string
+		script     string
+		stdin      string
+		secrets    []string
+		timeout    time.Duration
+		expected   func(exitCode int, stdout []byte) bool
+		stdout     string
+		stderr     string
+		exitCode   int
+		contains   []string
+		redacted   []string
+		expectFail bool
+	}{
+		{
+			name:     "success",
+			script:   `cat; echo "warning: hvs.CAESIJ1234567890abcdefghijklmnop" >&2`,
+			stdin:    "hello",
+			stdout:   "hello",
+			stderr:   "warning: hvs.CAESIJ1234567890abcdefghijklmnop\n",
+			contains: []string{"external program succeeded", "exit_code=0", "stderr=\"warning: [REDACTED]\""},
+			redacted: []string{"hvs.CAESIJ"},
+		},
+		{
+			name:       "failure",
+			script:     `echo "bad password hunter2" >&2; exit 3`,
+			secrets:    []string{"hunter2"},
+			stderr:     "bad password hunter2\n",
+			exitCode:   3,
+			contains:   []string{"external program failed", "exit_code=3", "stderr=\"bad password [REDACTED]\""},
+			redacted:   []string{"hunter2"},
+			expectFail: true,
+		},
+		{
+			name:   "expected-failure",
+			script: `echo "credentials not found in native keychain"; exit 1`,
+			expected: func(exitCode int, stdout []byte) bool {
+				return exitCode == 1 && strings.HasPrefix(string(stdout), "credentials not found")
+			},
+			stdout:     "credentials not found in native keychain\n",
+			exitCode:   1,
+			contains:   []string{"external program failed as expected", "exit_code=1"},
+			expectFail: true,
+		},
+		{
+			name:       "timeout",
+			script:     `exec sleep 5`,
+			timeout:    50 * time.Millisecond,
+			exitCode:   -1,
+			contains:   []string{"external program failed", "context deadline exceeded"},
+			expectFail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			buf := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			cmd := &Command{
+				Logger:          hclog.New(&hclog.LoggerOptions{Output: buf, Level: hclog.Debug}),
+				Path:            sh,
+				Args:            []string{"-c", tc.script},
+				Stdin:           []byte(tc.stdin),
+				Secrets:         tc.secrets,
+				Stderr:          stderr,
+				ExpectedFailure: tc.expected,
+			}
+
+			stdout, err := cmd.Run(ctx)
+			if tc.expectFail {
+				var perr *Error
+				if !errors.As(err, &perr) {
+					t.Fatalf("Expected a *process.Error, got %v", err)
+				}
+				if perr.ExitCode != tc.exitCode {
+					t.Fatalf("Expected exit code %d, got %d", tc.exitCode, perr.ExitCode)
+				}
+				for _, s := range tc.redacted {
+					if strings.Contains(err.Error(), s) {
+						t.Fatalf("Expected error not to contain %q, got %q", s, err.Error())
+					}
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.stdout, string(stdout)); diff != "" {
+				t.Fatalf("Standard output differs:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.stderr, stderr.String()); diff != "" {
+				t.Fatalf("Standard error differs:\n%s", diff)
+			}
+
+			for _, s := range tc.contains {
+				if !strings.Contains(buf.String(), s) {
+					t.Fatalf("Expected log to contain %q, got:\n%s", s, buf.String())
+				}
+			}
+
+			for _, s := range tc.redacted {
+				if strings.Contains(buf.String(), s) {
+					t.Fatalf("Expected log not to contain %q, got:\n%s", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 4}
+
+	for _, s := range []string{"ab", "cdef", "gh"} {
+		if n, err := b.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+
+	if got := b.String(); got != "abcd..." {
+		t.Fatalf("Expected %q, got %q", "abcd...", got)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/config"
+)
+
+// selectProfile returns the configuration of the profile selected by
+// DCVL_PROFILE or, for the actions of the credential helper protocol which
+// name a registry, of the profile which lists the registry, and the name
+// of the profile. The input of these actions is read from in to find the
+// registry and is returned. If no profile is selected, the contents of
+// configFile itself and an empty profile name are returned.
+func selectProfile(configFile, action string, in io.Reader) ([]byte, string, []byte, error) {
+	profiles, err := config.LoadProfiles(configFile)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	name := os.Getenv(config.EnvProfile)
+	if name == "" && profiles.Empty() {
+		data, err := readConfigFile(configFile)
+		return data, "", nil, err
+	}
+
+	var input []byte
+
+	if name == "" && (action == credentials.ActionGet || action == credentials.ActionErase ||
+		action == credentials.ActionStore) {
+		if input, err = io.ReadAll(in); err != nil {
+			return nil, "", nil, xerrors.Errorf("error reading input: %w", err)
+		}
+
+		if profile, ok := profiles.Match(inputRegistry(action, input)); ok {
+			name = profile.Name
+		}
+	}
+
+	if name == "" {
+		if !profiles.HasRoot() {
+			return nil, "", nil, xerrors.Errorf("no profile was selected and the configuration file has no "+
+				"'auto_auth' block outside of profiles; set %s to one of %s", config.EnvProfile,
+				strings.Join(profiles.Names(), ", "))
+		}
+
+		data, err := readConfigFile(configFile)
+
+		return data, "", input, err
+	}
+
+	data, err := profileConfig(profiles, name)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return data, name, input, nil
+}
+
+// readConfig returns the configuration of the profile of the configuration
+// file or, if profile is empty, the contents of the file.
+func readConfig(configFile, profile string) ([]byte, error) {
+	if profile == "" {
+		return readConfigFile(configFile)
+	}
+
+	profiles, err := config.LoadProfiles(configFile)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing profiles: %w", err)
+	}
+
+	return profileConfig(profiles, profile)
+}
+
+// readConfigFile returns the contents of the configuration file.
+func readConfigFile(configFile string) ([]byte, error) {
+	data, err := os.ReadFile(configFile) // nolint: gosec
+	if err != nil {
+		return nil, xerrors.Errorf("error reading configuration file: %w", err)
+	}
+
+	return data, nil
+}
+
+// profileConfig returns the configuration of the profile. It is built in
+// memory rather than written to a file, since it may hold secrets.
+func profileConfig(profiles config.Profiles, name string) ([]byte, error) {
+	profile, err := profiles.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles.Config(profile)
+}
+
+// inputRegistry returns the registry named by the input of an action of
+// the credential helper protocol.
+func inputRegistry(action string, input []byte) string {
+	if action != credentials.ActionStore {
+		return strings.TrimSpace(string(input))
+	}
+
+	var creds credentials.Credentials
+	if err := json.Unmarshal(input, &creds); err != nil {
+		return ""
+	}
+
+	return creds.ServerURL
+}
+
+// profileCacheDir returns the subdirectory of the cache directory which
+// belongs to the profile and creates it, so that the profiles, which may
+// log in to different Vault clusters, don't share cached tokens.
+func profileCacheDir(cacheDir, profile string) (string, error) {
+	if profile == "" {
+		return cacheDir, nil
+	}
+
+	dir := filepath.Join(cacheDir, "profiles", profile)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", xerrors.Errorf("error creating directory %s: %w", dir, err)
+	}
+
+	return dir, nil
+}
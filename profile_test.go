@@ -0,0 +1,181 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/config"
+)
+
+func TestSelectProfile(t *testing.T) {
+	const (
+		profilesFile     = "config/testdata/profiles.hcl"
+		profilesOnlyFile = "config/testdata/profiles-only.hcl"
+	)
+
+	cases := []struct {
+		name       string
+		configFile string
+		env        string
+		action     string
+		input      string
+		profile    string
+		readInput  bool
+		err        string
+	}{
+		{
+			name:       "no-profiles",
+			configFile: "config/testdata/valid.hcl",
+			action:     "get",
+			input:      "ci.registry.example.com\n",
+		},
+		{
+			name:       "env",
+			configFile: profilesFile,
+			env:        "prod",
+			action:     "get",
+			input:      "ci.registry.example.com\n",
+			profile:    "prod",
+		},
+		{
+			name:       "env-unknown",
+			configFile: profilesFile,
+			env:        "staging",
+			action:     "list",
+			err:        `profile "staging" not found in configuration file ` + profilesFile,
+		},
+		{
+			name:       "env-no-profiles",
+			configFile: "config/testdata/valid.hcl",
+			env:        "ci",
+			action:     "list",
+			err:        `profile "ci" not found in configuration file config/testdata/valid.hcl`,
+		},
+		{
+			name:       "get",
+			configFile: profilesFile,
+			action:     "get",
+			input:      "https://mirror.example.com:5000\n",
+			profile:    "ci",
+			readInput:  true,
+		},
+		{
+			name:       "erase",
+			configFile: profilesFile,
+			action:     "erase",
+			input:      "registry.example.com",
+			profile:    "prod",
+			readInput:  true,
+		},
+		{
+			name:       "store",
+			configFile: profilesFile,
+			action:     "store",
+			input:      `{"ServerURL":"registry.example.com","Username":"ci","Secret":"secret"}`,
+			profile:    "prod",
+			readInput:  true,
+		},
+		{
+			name:       "no-match",
+			configFile: profilesFile,
+			action:     "get",
+			input:      "https://index.docker.io/v1/",
+			readInput:  true,
+		},
+		{
+			name:       "list",
+			configFile: profilesFile,
+			action:     "list",
+		},
+		{
+			name:       "no-match-profiles-only",
+			configFile: profilesOnlyFile,
+			action:     "get",
+			input:      "https://index.docker.io/v1/",
+			err: "no profile was selected and the configuration file has no 'auto_auth' block outside of " +
+				"profiles; set DCVL_PROFILE to one of ci",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// The configuration of the profile must not be written to the
+			// temporary directory
+			t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+			t.Setenv(config.EnvProfile, tc.env)
+
+			data, profile, input, err := selectProfile(tc.configFile, tc.action, strings.NewReader(tc.input))
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if profile != tc.profile {
+				t.Errorf("Expected profile %q, got %q", tc.profile, profile)
+			}
+
+			if tc.profile == "" {
+				expected, err := os.ReadFile(tc.configFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(string(expected), string(data)); diff != "" {
+					t.Errorf("Expected the contents of %s, got:\n%s", tc.configFile, diff)
+				}
+			} else if _, err = config.ParseConfig(data); err != nil {
+				t.Errorf("Expected the configuration of the profile to be valid, got %v", err)
+			}
+
+			if tc.readInput && string(input) != tc.input {
+				t.Errorf("Expected the input %q to be returned, got %q", tc.input, input)
+			}
+			if !tc.readInput && input != nil {
+				t.Errorf("Expected the input not to be read, got %q", input)
+			}
+		})
+	}
+}
+
+func TestProfileCacheDir(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	dir, err := profileCacheDir(cacheDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != cacheDir {
+		t.Fatalf("Expected %s without a profile, got %s", cacheDir, dir)
+	}
+
+	if dir, err = profileCacheDir(cacheDir, "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(cacheDir, "profiles", "ci"); dir != expected {
+		t.Fatalf("Expected %s, got %s", expected, dir)
+	}
+}
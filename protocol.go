@@ -0,0 +1,71 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+
+	"github.com/morningconsult/docker-credential-vault-login/harden"
+)
+
+// modulePath identifies the helper in the output of the version action.
+const modulePath = "github.com/morningconsult/docker-credential-vault-login"
+
+// identifyHelper sets the name and version which the version action of the
+// credential helper protocol reports.
+func identifyHelper() {
+	credentials.Name = helperPrefix + credentialHelperName()
+	credentials.Package = modulePath
+	credentials.Version = version
+	credentials.Revision = commit
+}
+
+// serveProtocol runs the action of the credential helper protocol named by
+// args with the input read from in and writes the output to out. It
+// returns the exit code expected by the Docker CLI: 0 on success and 1 on
+// failure, in which case the error is written to out. Unlike
+// credentials.Serve, the action is taken from the arguments left after
+// parsing the flags, so that flags such as -config may precede it.
+func serveProtocol(h credentials.Helper, args []string, in io.Reader, out io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintf(out, "Usage: %s <store|get|erase|list|version>\n", credentials.Name) // nolint: errcheck
+		return 1
+	}
+
+	if err := credentials.HandleCommand(h, args[0], in, out); err != nil {
+		fmt.Fprintln(out, err) // nolint: errcheck
+		return 1
+	}
+
+	return 0
+}
+
+// serveHardened is serveProtocol with the output written to out at once
+// from a buffer which is zeroed afterwards, so that the credentials written
+// do not linger in the memory of the helper.
+func serveHardened(h credentials.Helper, args []string, in io.Reader, out io.Writer) int {
+	var buf harden.Buffer
+	defer buf.Zero()
+
+	code := serveProtocol(h, args, in, &buf)
+
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return 1
+	}
+
+	return code
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+)
+
+type stubHelper struct{}
+
+func (stubHelper) Add(*credentials.Credentials) error { return nil }
+func (stubHelper) Delete(string) error                { return nil }
+
+func (stubHelper) Get(serverURL string) (string, string, error) {
+	if serverURL != "registry.example.com" {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+
+	return "user", "secret", nil
+}
+
+func (stubHelper) List() (map[string]string, error) {
+	return map[string]string{"registry.example.com": ""}, nil
+}
+
+func TestServeProtocol(t *testing.T) {
+	credentials.Name = "docker-credential-vault-login"
+	credentials.Package = modulePath
+	credentials.Version = "v1.0.0"
+
+	cases := []struct {
+		name   string
+		args   []string
+		input  string
+		code   int
+		output string
+	}{
+		{
+			name:   "get",
+			args:   []string{"get"},
+			input:  "registry.example.com\n",
+			output: `{"ServerURL":"registry.example.com","Username":"user","Secret":"secret"}` + "\n",
+		},
+		{
+			name:   "get-not-found",
+			args:   []string{"get"},
+			input:  "other.example.com\n",
+			code:   1,
+			output: "credentials not found in native keychain\n",
+		},
+		{
+			name:   "get-no-server-url",
+			args:   []string{"get"},
+			code:   1,
+			output: "no credentials server URL\n",
+		},
+		{
+			name:   "store",
+			args:   []string{"store"},
+			input:  `{"ServerURL":"registry.example.com","Username":"user","Secret":"secret"}`,
+			output: "",
+		},
+		{
+			name:   "erase",
+			args:   []string{"erase"},
+			input:  "registry.example.com\n",
+			output: "",
+		},
+		{
+			name:   "list",
+			args:   []string{"list"},
+			output: `{"registry.example.com":""}` + "\n",
+		},
+		{
+			name:   "version",
+			args:   []string{"version"},
+			output: "docker-credential-vault-login (" + modulePath + ") v1.0.0\n",
+		},
+		{
+			name:   "unknown-action",
+			args:   []string{"fetch"},
+			code:   1,
+			output: "docker-credential-vault-login: unknown action: fetch\n",
+		},
+		{
+			name:   "no-action",
+			code:   1,
+			output: "Usage: docker-credential-vault-login <store|get|erase|list|version>\n",
+		},
+	}
+
+	serves := map[string]func(credentials.Helper, []string, io.Reader, io.Writer) int{
+		"plain":    serveProtocol,
+		"hardened": serveHardened,
+	}
+
+	for _, tc := range cases {
+		for name, serve := range serves {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				var out bytes.Buffer
+
+				code := serve(stubHelper{}, tc.args, strings.NewReader(tc.input), &out)
+				if code != tc.code {
+					t.Fatalf("Expected exit code %d, got %d", tc.code, code)
+				}
+				if diff := cmp.Diff(tc.output, out.String()); diff != "" {
+					t.Fatalf("Outputs differ:\n%s", diff)
+				}
+			})
+		}
+	}
+}
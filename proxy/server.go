@@ -0,0 +1,194 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package proxy implements a minimal read-through proxy of the Vault API
+// served on a unix socket, through which tools running alongside the
+// helper can read secrets with the helper's token instead of
+// authenticating to Vault themselves.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/admin"
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+// Reader reads secrets on behalf of the clients of the proxy.
+type Reader interface {
+	// ReadSecret returns the secret at path. It returns
+	// helper.ErrPathNotAllowed if the path may not be read through the
+	// proxy and helper.ErrSecretNotFound if there is no secret at path.
+	ReadSecret(path string) (*api.Secret, error)
+
+	// PreviousSecret returns the data of the version of the secret at
+	// path which was replaced when the secret last rotated, and when the
+	// overlap window ends, if it has not yet ended.
+	PreviousSecret(path string) (map[string]interface{}, time.Time, bool)
+}
+
+// ServerOptions is used to configure a new Server instance.
+type ServerOptions struct {
+	Logger     hclog.Logger
+	Reader     Reader
+	SocketPath string
+}
+
+// Server serves the proxy on a unix socket. As with the admin API, only
+// connections from processes running as the same user as the server (or
+// as root) are accepted.
+type Server struct {
+	logger     hclog.Logger
+	reader     Reader
+	socketPath string
+	ready      chan struct{}
+}
+
+// NewServer creates a new Server instance.
+func NewServer(opts ServerOptions) *Server {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	return &Server{
+		logger:     logger,
+		reader:     opts.Reader,
+		socketPath: opts.SocketPath,
+		ready:      make(chan struct{}),
+	}
+}
+
+// Serve listens on the unix socket and serves the proxy until the context
+// is canceled. Any file already present at the socket path is removed
+// first.
+func (s *Server) Serve(ctx context.Context) error {
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("error removing stale proxy socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return xerrors.Errorf("error listening on proxy socket: %w", err)
+	}
+
+	if err = os.Chmod(s.socketPath, 0o600); err != nil {
+		ln.Close() // nolint: errcheck
+		return xerrors.Errorf("error setting permissions of proxy socket: %w", err)
+	}
+
+	close(s.ready)
+
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background()) // nolint: errcheck
+	}()
+
+	s.logger.Info("serving proxy", "socket", s.socketPath)
+
+	err = srv.Serve(admin.NewPeerListener(ln, s.logger))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Ready returns a channel which is closed once Serve listens on the
+// socket, so that clients need not poll it.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// ServeHTTP answers GET requests of /v1/<path> with the secret at path,
+// shaped like the responses of the Vault API so that Vault clients can
+// read from the proxy. If the secret rotated recently, the response also
+// holds the previous version. Any token sent by the client is ignored.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if path == r.URL.Path {
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	secret, err := s.reader.ReadSecret(path)
+
+	switch {
+	case errors.Is(err, helper.ErrPathNotAllowed):
+		s.logger.Warn("rejected proxy request", "path", path)
+		respondError(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, helper.ErrSecretNotFound):
+		respondError(w, http.StatusNotFound, "secret not found")
+	case err != nil:
+		s.logger.Error("error reading secret through proxy", "path", path, "error", err)
+		respondError(w, http.StatusBadGateway, "error reading secret from Vault")
+	default:
+		s.logger.Debug("handled proxy request", "path", path)
+
+		resp := secretResponse{Secret: secret}
+		if data, until, ok := s.reader.PreviousSecret(path); ok {
+			resp.Previous = &previousVersion{Data: data, OverlapUntil: until}
+		}
+
+		respond(w, http.StatusOK, resp)
+	}
+}
+
+// secretResponse is the response of the Vault API, extended with the
+// previous version of a secret which rotated.
+type secretResponse struct {
+	*api.Secret
+	Previous *previousVersion `json:"previous,omitempty"`
+}
+
+type previousVersion struct {
+	Data         map[string]interface{} `json:"data"`
+	OverlapUntil time.Time              `json:"overlap_until"`
+}
+
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) // nolint: errcheck
+}
+
+func respondError(w http.ResponseWriter, status int, msg string) {
+	respond(w, status, errorResponse{Errors: []string{msg}})
+}
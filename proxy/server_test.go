@@ -0,0 +1,188 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+type mockReader map[string]*api.Secret
+
+func (m mockReader) ReadSecret(path string) (*api.Secret, error) {
+	switch path {
+	case "secret/forbidden":
+		return nil, helper.ErrPathNotAllowed
+	case "secret/broken":
+		return nil, errors.New("connection refused")
+	}
+
+	secret, ok := m[path]
+	if !ok {
+		return nil, helper.ErrSecretNotFound
+	}
+
+	return secret, nil
+}
+
+func (m mockReader) PreviousSecret(path string) (map[string]interface{}, time.Time, bool) {
+	if path != "secret/ci/npm" {
+		return nil, time.Time{}, false
+	}
+
+	return map[string]interface{}{"token": "old npm token"}, time.Unix(1700000000, 0).UTC(), true
+}
+
+func TestServer(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "proxy.sock")
+	reader := mockReader{
+		"secret/ci/npm": {Data: map[string]interface{}{"token": "npm token"}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	srv := NewServer(ServerOptions{Reader: reader, SocketPath: socketPath})
+
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+
+	select {
+	case <-srv.Ready():
+	case err := <-done:
+		cancel()
+		t.Fatalf("proxy did not start: %v", err)
+	}
+
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("error serving proxy: %v", err)
+		}
+	}()
+
+	// Vault clients can read from the proxy through its socket
+	config := api.DefaultConfig()
+	config.MaxRetries = 0
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.SetAddress("unix://" + socketPath); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		path     string
+		expected map[string]interface{}
+		status   int
+	}{
+		{
+			name:     "allowed",
+			path:     "secret/ci/npm",
+			expected: map[string]interface{}{"token": "npm token"},
+		},
+		{
+			name:   "not-allowed",
+			path:   "secret/forbidden",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "vault-error",
+			path:   "secret/broken",
+			status: http.StatusBadGateway,
+		},
+		{
+			name: "not-found",
+			path: "secret/ci/missing",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret, err := client.Logical().Read(tc.path)
+			if tc.status != 0 {
+				var respErr *api.ResponseError
+				if !errors.As(err, &respErr) {
+					t.Fatalf("Expected a response error, got %v", err)
+				}
+				if respErr.StatusCode != tc.status {
+					t.Fatalf("Expected status %d, got %d", tc.status, respErr.StatusCode)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var data map[string]interface{}
+			if secret != nil {
+				data = secret.Data
+			}
+
+			if diff := cmp.Diff(tc.expected, data); diff != "" {
+				t.Fatalf("Data differs:\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("previous-version", func(t *testing.T) {
+		resp, err := client.Logical().ReadRaw("secret/ci/npm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var body struct {
+			Data     map[string]interface{} `json:"data"`
+			Previous struct {
+				Data         map[string]interface{} `json:"data"`
+				OverlapUntil time.Time              `json:"overlap_until"`
+			} `json:"previous"`
+		}
+		if err = resp.DecodeJSON(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(map[string]interface{}{"token": "old npm token"}, body.Previous.Data); diff != "" {
+			t.Fatalf("Previous data differs:\n%s", diff)
+		}
+		if !body.Previous.OverlapUntil.Equal(time.Unix(1700000000, 0)) {
+			t.Fatalf("Expected the overlap to end at %s, got %s", time.Unix(1700000000, 0), body.Previous.OverlapUntil)
+		}
+	})
+
+	t.Run("method-not-allowed", func(t *testing.T) {
+		_, err := client.Logical().Write("secret/ci/npm", map[string]interface{}{"token": "other"})
+
+		var respErr *api.ResponseError
+		if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("Expected status %d, got %v", http.StatusMethodNotAllowed, err)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/morningconsult/docker-credential-vault-login/messages"
+)
+
+// envInvocation is set by the helper to its process ID so that the
+// programs it runs, and their children, inherit it. If it is already set
+// when the helper starts, the helper was invoked by one of them.
+const envInvocation = "DCVL_INVOCATION"
+
+// guardRecursion fails if the helper was invoked, directly or through
+// Docker, by a program which the helper itself is running, such as a
+// chained credential helper or a hook which calls the Docker CLI. Such an
+// invocation would otherwise wait on the helper which invoked it or invoke
+// the helper again without end. If the helper was not invoked recursively,
+// its process ID is set in the environment inherited by its children. The
+// error is in the language of msgs.
+func guardRecursion(msgs *messages.Catalog) error {
+	if pid := os.Getenv(envInvocation); pid != "" {
+		return msgs.Errorf(messages.RecursiveInvocation, pid, envInvocation)
+	}
+
+	return os.Setenv(envInvocation, strconv.Itoa(os.Getpid()))
+}
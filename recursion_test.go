@@ -0,0 +1,49 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGuardRecursion(t *testing.T) {
+	t.Run("first", func(t *testing.T) {
+		t.Setenv(envInvocation, "")
+
+		if err := guardRecursion(nil); err != nil {
+			t.Fatal(err)
+		}
+		if pid := os.Getenv(envInvocation); pid != strconv.Itoa(os.Getpid()) {
+			t.Fatalf("Expected %s to be %d, got %q", envInvocation, os.Getpid(), pid)
+		}
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		t.Setenv(envInvocation, "1234")
+
+		expected := "DCVL-1009: the helper was invoked recursively by a program run by the helper " +
+			"(process 1234); check that no chained credential helper or hook calls Docker or the helper " +
+			"for the same registry, or unset DCVL_INVOCATION if this is intended"
+
+		err := guardRecursion(nil)
+		if err == nil || err.Error() != expected {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, fmt.Sprint(err)))
+		}
+	})
+}
@@ -48,3 +48,10 @@ GO111MODULE=on CGO_ENABLED=0 go build \
 	-ldflags "-s -w ${version_ldflags}" \
 	-o "${BIN_DIR}/$( basename ${REPO} )" \
 	.
+
+GO111MODULE=on CGO_ENABLED=0 go build \
+	-installsuffix cgo \
+	-a \
+	-ldflags "-s -w" \
+	-o "${BIN_DIR}/$( basename ${REPO} )-shim" \
+	./cmd/$( basename ${REPO} )-shim
@@ -0,0 +1,121 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/socket"
+)
+
+// runServe runs the helper as a daemon which answers the requests of the
+// credential helper protocol sent by the shim on a unix socket. The
+// token and the cached secrets are kept by the daemon between requests
+// and renewed in the background, so that a pull need not wait for a
+// login. As with the watch daemon, the admin API and the proxy are served
+// too. If the daemon was started by systemd socket activation, the socket
+// passed by systemd is served instead.
+func runServe(d *daemon, logger hclog.Logger, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	socketPath := flags.String("socket", "", "path to the credential socket (default: $"+socket.EnvSocket+
+		" or "+socket.SocketFile+" in the cache directory)")
+	renewInterval := flags.Duration("renew-interval", 5*time.Minute, "longest time between renewals of "+
+		"the token and the leases of the cached secrets")
+	sockets := addSocketFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *renewInterval <= 0 {
+		return xerrors.New("-renew-interval must be positive")
+	}
+
+	if *socketPath == "" {
+		*socketPath = os.Getenv(socket.EnvSocket)
+	}
+
+	if *socketPath == "" {
+		*socketPath = filepath.Join(d.cacheDir, socket.SocketFile)
+	}
+
+	listener, err := socket.ActivationListener()
+	if err != nil {
+		return err
+	}
+
+	if listener != nil {
+		logger.Info("using socket passed by systemd", "socket", listener.Addr().String())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err = sockets.serve(ctx, d, logger); err != nil {
+		return err
+	}
+
+	go reloadOnHangup(ctx, d, logger)
+
+	go renewLoop(ctx, d, clock.System(), logger, *renewInterval)
+
+	server := socket.NewServer(socket.ServerOptions{
+		Logger:     logger.Named("socket"),
+		Helper:     d,
+		SocketPath: *socketPath,
+		Listener:   listener,
+	})
+
+	return server.Serve(ctx)
+}
+
+// renewLoop keeps the token and the leases of the daemon valid until the
+// context is canceled, as the lifetime watcher of the Vault agent does. The
+// daemon logs in right away, then renews them when two thirds of their TTL
+// have passed, or after the interval if that is sooner. If the renewal
+// fails, the daemon logs in again, and retries after the interval if that
+// fails too. The waits are measured with clk.
+func renewLoop(ctx context.Context, m maintainer, clk clock.Clock, logger hclog.Logger, interval time.Duration) {
+	for {
+		wait, err := m.Maintain(ctx)
+		if err != nil {
+			logger.Error("error renewing token and leases", "error", err)
+		}
+
+		if wait == 0 || wait > interval {
+			wait = interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(wait):
+		}
+	}
+}
+
+// maintainer is the part of the daemon which renewLoop drives.
+type maintainer interface {
+	Maintain(ctx context.Context) (time.Duration, error)
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestRunServe(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "bad-flag",
+			args: []string{"-renew-interval", "often"},
+			err:  `invalid value "often" for flag -renew-interval: parse error`,
+		},
+		{
+			name: "non-positive-interval",
+			args: []string{"-renew-interval", "0s"},
+			err:  "-renew-interval must be positive",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := runServe(nil, hclog.NewNullLogger(), tc.args)
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if err.Error() != tc.err {
+				t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+			}
+		})
+	}
+}
+
+// stubMaintainer returns the same wait every time and reports each call.
+type stubMaintainer struct {
+	wait  time.Duration
+	err   error
+	calls chan struct{}
+}
+
+func (m *stubMaintainer) Maintain(ctx context.Context) (time.Duration, error) {
+	select {
+	case m.calls <- struct{}{}:
+	case <-ctx.Done():
+	}
+
+	return m.wait, m.err
+}
+
+func TestRenewLoop(t *testing.T) {
+	const interval = 5 * time.Minute
+
+	cases := []struct {
+		name     string
+		wait     time.Duration
+		err      error
+		expected time.Duration
+	}{
+		{
+			name:     "ttl",
+			wait:     time.Minute,
+			expected: time.Minute,
+		},
+		{
+			name:     "longer-than-interval",
+			wait:     time.Hour,
+			expected: interval,
+		},
+		{
+			name:     "nothing-to-renew",
+			expected: interval,
+		},
+		{
+			name:     "error",
+			err:      errors.New("permission denied"),
+			expected: interval,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Now())
+			m := &stubMaintainer{wait: tc.wait, err: tc.err, calls: make(chan struct{})}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+
+			go func() {
+				renewLoop(ctx, m, clk, hclog.NewNullLogger(), interval)
+				close(done)
+			}()
+
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			// The daemon renews right away, then waits
+			<-m.calls
+			clk.BlockUntil(1)
+
+			clk.Advance(tc.expected - time.Second)
+
+			select {
+			case <-m.calls:
+				t.Fatalf("Expected to renew after %s, renewed sooner", tc.expected)
+			default:
+			}
+
+			clk.Advance(time.Second)
+
+			select {
+			case <-m.calls:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected to renew after %s", tc.expected)
+			}
+		})
+	}
+}
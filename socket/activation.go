@@ -0,0 +1,64 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package socket
+
+import (
+	"net"
+	"os"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	envListenPID     = "LISTEN_PID"
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+
+	// listenFDsStart is the first file descriptor passed by systemd
+	// (SD_LISTEN_FDS_START).
+	listenFDsStart = 3
+)
+
+// ActivationListener returns the socket passed by systemd if the process
+// was started by socket activation, or nil otherwise. Like sd_listen_fds,
+// it unsets the environment variables of the protocol so that they are not
+// inherited by the programs the helper runs. Only the first socket is used.
+func ActivationListener() (net.Listener, error) {
+	pid, fds := os.Getenv(envListenPID), os.Getenv(envListenFDs)
+
+	for _, key := range []string{envListenPID, envListenFDs, envListenFDNames} {
+		os.Unsetenv(key) // nolint: errcheck
+	}
+
+	// The sockets may have been meant for a parent process
+	if pid == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, xerrors.Errorf("invalid value of %s: %q", envListenFDs, fds)
+	}
+
+	file := os.NewFile(listenFDsStart, "systemd-socket")
+	defer file.Close() // nolint: errcheck
+
+	ln, err := net.FileListener(file)
+	if err != nil {
+		return nil, xerrors.Errorf("error using socket passed by systemd: %w", err)
+	}
+
+	return ln, nil
+}
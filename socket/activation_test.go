@@ -0,0 +1,126 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package socket
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestActivationListener(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	cases := []struct {
+		name string
+		pid  string
+		fds  string
+		err  string
+	}{
+		{
+			name: "not-activated",
+		},
+		{
+			name: "other-process",
+			pid:  strconv.Itoa(os.Getpid() + 1),
+			fds:  "1",
+		},
+		{
+			name: "no-sockets",
+			pid:  pid,
+			fds:  "0",
+			err:  `invalid value of LISTEN_FDS: "0"`,
+		},
+		{
+			name: "invalid-sockets",
+			pid:  pid,
+			fds:  "three",
+			err:  `invalid value of LISTEN_FDS: "three"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envListenPID, tc.pid)
+			t.Setenv(envListenFDs, tc.fds)
+			t.Setenv(envListenFDNames, "docker-credential-vault-login.socket")
+
+			ln, err := ActivationListener()
+
+			for _, key := range []string{envListenPID, envListenFDs, envListenFDNames} {
+				if _, ok := os.LookupEnv(key); ok {
+					t.Errorf("expected %s to be unset", key)
+				}
+			}
+
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ln != nil {
+				t.Fatalf("Expected no listener, got %v", ln.Addr())
+			}
+		})
+	}
+}
+
+func TestServer_Listener(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), SocketFile)
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	srv := NewServer(ServerOptions{
+		Helper:     mockHelper{},
+		SocketPath: filepath.Join(t.TempDir(), "ignored.sock"),
+		Listener:   ln,
+	})
+
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("error serving credential socket: %v", err)
+		}
+	}()
+
+	<-srv.Ready()
+
+	err = Call(context.Background(), socketPath, credentials.ActionGet, strings.NewReader("registry.example.com"), nil)
+	if err == nil || err.Error() != credentials.NewErrCredentialsNotFound().Error() {
+		t.Fatalf("Expected the credentials not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package socket
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Call sends a request of the credential helper protocol to the server on
+// the unix socket at socketPath and writes its output to out. If the
+// action failed, the error returned is the one of the helper, unwrapped,
+// so that it can be written to Docker as is.
+func Call(ctx context.Context, socketPath, action string, in io.Reader, out io.Writer) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://credentials/v1/"+action, in)
+	if err != nil {
+		return xerrors.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("error connecting to credential socket %s: %w", socketPath, err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return xerrors.Errorf("error reading response: %w", err)
+		}
+
+		return xerrors.New(strings.TrimSpace(string(body)))
+	}
+
+	if _, err = io.Copy(out, resp.Body); err != nil {
+		return xerrors.Errorf("error reading response: %w", err)
+	}
+
+	return nil
+}
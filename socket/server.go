@@ -0,0 +1,181 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package socket serves the Docker credential helper protocol on a unix
+// socket, so that a long-running helper can answer the requests which
+// Docker sends to a thin shim instead of a new process logging in to Vault
+// for every pull.
+package socket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/admin"
+)
+
+const (
+	// EnvSocket is the environment variable which overrides the path of
+	// the socket, both for the server and for the shim.
+	EnvSocket = "DCVL_SOCKET"
+
+	// SocketFile is the name of the socket in the cache directory.
+	SocketFile = "credentials.sock"
+
+	readHeaderTimeout = 10 * time.Second
+
+	// maxInputSize bounds the input of a request. Docker sends a server
+	// URL or, to store credentials, a small JSON document.
+	maxInputSize = 1 << 20
+)
+
+// ServerOptions is used to configure a new Server instance.
+type ServerOptions struct {
+	Logger     hclog.Logger
+	Helper     credentials.Helper
+	SocketPath string
+
+	// Listener, if set, is served instead of a socket created at
+	// SocketPath, e.g. the one passed by systemd (see ActivationListener).
+	// The socket file is then left as it is.
+	Listener net.Listener
+}
+
+// Server serves the credential helper protocol on a unix socket. As with
+// the admin API, only connections from processes running as the same user
+// as the server (or as root) are accepted.
+type Server struct {
+	logger     hclog.Logger
+	helper     credentials.Helper
+	socketPath string
+	listener   net.Listener
+	ready      chan struct{}
+}
+
+// NewServer creates a new Server instance.
+func NewServer(opts ServerOptions) *Server {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	return &Server{
+		logger:     logger,
+		helper:     opts.Helper,
+		socketPath: opts.SocketPath,
+		listener:   opts.Listener,
+		ready:      make(chan struct{}),
+	}
+}
+
+// Serve listens on the unix socket, unless a listener was given, and
+// serves the protocol until the context is canceled. Any file already
+// present at the socket path is removed first.
+func (s *Server) Serve(ctx context.Context) error {
+	ln := s.listener
+	if ln == nil {
+		var err error
+		if ln, err = s.listen(); err != nil {
+			return err
+		}
+	}
+
+	close(s.ready)
+
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background()) // nolint: errcheck
+	}()
+
+	s.logger.Info("serving credential helper protocol", "socket", ln.Addr().String())
+
+	err := srv.Serve(admin.NewPeerListener(ln, s.logger))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// listen creates the unix socket, readable only by the user.
+func (s *Server) listen() (net.Listener, error) {
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("error removing stale credential socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return nil, xerrors.Errorf("error listening on credential socket: %w", err)
+	}
+
+	if err = os.Chmod(s.socketPath, 0o600); err != nil {
+		ln.Close() // nolint: errcheck
+		return nil, xerrors.Errorf("error setting permissions of credential socket: %w", err)
+	}
+
+	return ln, nil
+}
+
+// Ready returns a channel which is closed once Serve listens on the
+// socket, so that clients need not poll it.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// ServeHTTP answers POST requests of /v1/<action>, whose body is the
+// input which Docker sent to the shim, with the output which the helper
+// would have written. If the action fails, the response has status 500
+// and its body is the error, which the shim writes to Docker as the
+// helper would have.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	action := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if action == r.URL.Path || action == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var out bytes.Buffer
+
+	err := credentials.HandleCommand(s.helper, action, io.LimitReader(r.Body, maxInputSize), &out)
+	if err != nil {
+		s.logger.Debug("credential request failed", "action", action, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	s.logger.Debug("handled credential request", "action", action)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(out.Bytes()) // nolint: errcheck
+}
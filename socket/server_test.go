@@ -0,0 +1,173 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package socket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockHelper map[string]*credentials.Credentials
+
+func (m mockHelper) Add(creds *credentials.Credentials) error {
+	m[creds.ServerURL] = creds
+	return nil
+}
+
+func (m mockHelper) Delete(serverURL string) error {
+	if _, ok := m[serverURL]; !ok {
+		return credentials.NewErrCredentialsNotFound()
+	}
+
+	delete(m, serverURL)
+
+	return nil
+}
+
+func (m mockHelper) Get(serverURL string) (string, string, error) {
+	if serverURL == "broken.example.com" {
+		return "", "", errors.New("connection refused")
+	}
+
+	creds, ok := m[serverURL]
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+
+	return creds.Username, creds.Secret, nil
+}
+
+func (m mockHelper) List() (map[string]string, error) {
+	list := make(map[string]string)
+	for url, creds := range m {
+		list[url] = creds.Username
+	}
+
+	return list, nil
+}
+
+func TestServer(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), SocketFile)
+	helper := mockHelper{
+		"registry.example.com": {ServerURL: "registry.example.com", Username: "ci", Secret: "secret"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	srv := NewServer(ServerOptions{Helper: helper, SocketPath: socketPath})
+
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+
+	select {
+	case <-srv.Ready():
+	case err := <-done:
+		cancel()
+		t.Fatalf("server did not start: %v", err)
+	}
+
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("error serving credential socket: %v", err)
+		}
+	}()
+
+	cases := []struct {
+		name     string
+		action   string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "get",
+			action:   credentials.ActionGet,
+			input:    "registry.example.com\n",
+			expected: `{"ServerURL":"registry.example.com","Username":"ci","Secret":"secret"}` + "\n",
+		},
+		{
+			name:   "get-not-found",
+			action: credentials.ActionGet,
+			input:  "other.example.com",
+			err:    credentials.NewErrCredentialsNotFound().Error(),
+		},
+		{
+			name:   "get-error",
+			action: credentials.ActionGet,
+			input:  "broken.example.com",
+			err:    "connection refused",
+		},
+		{
+			name:   "store",
+			action: credentials.ActionStore,
+			input:  `{"ServerURL":"new.example.com","Username":"bot","Secret":"token"}`,
+		},
+		{
+			name:     "list",
+			action:   credentials.ActionList,
+			expected: `{"new.example.com":"bot","registry.example.com":"ci"}` + "\n",
+		},
+		{
+			name:   "erase",
+			action: credentials.ActionErase,
+			input:  "new.example.com",
+		},
+		{
+			name:   "unknown-action",
+			action: "fetch",
+			err:    credentials.Name + ": unknown action: fetch",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			err := Call(context.Background(), socketPath, tc.action, strings.NewReader(tc.input), &out)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, out.String()); diff != "" {
+				t.Fatalf("Outputs differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCall_NotServing(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), SocketFile)
+
+	err := Call(context.Background(), socketPath, credentials.ActionGet, strings.NewReader("registry.example.com"), nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "error connecting to credential socket "+socketPath) {
+		t.Fatalf("Expected a connection error, got %v", err)
+	}
+}
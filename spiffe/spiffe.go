@@ -0,0 +1,294 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package spiffe implements the small part of the SPIFFE Workload API
+// needed to log in to Vault with a workload identity: fetching a JWT-SVID
+// or an X.509-SVID from the socket of a SPIFFE agent such as SPIRE.
+package spiffe
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/morningconsult/docker-credential-vault-login/internal/rawproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// EnvEndpointSocket is the environment variable which, by convention,
+	// holds the address of the Workload API.
+	EnvEndpointSocket = "SPIFFE_ENDPOINT_SOCKET"
+
+	// The methods of the Workload API which are used.
+	methodFetchJWTSVID  = "/SpiffeWorkloadAPI/FetchJWTSVID"
+	methodFetchX509SVID = "/SpiffeWorkloadAPI/FetchX509SVID"
+
+	// securityHeader must be sent with every request so that the agent
+	// can tell requests of workloads from those forwarded by a browser.
+	securityHeader = "workload.spiffe.io"
+)
+
+// JWTSVID is a JWT-SVID fetched from the Workload API.
+type JWTSVID struct {
+	SPIFFEID string
+	Token    string
+}
+
+// X509SVID is an X.509-SVID fetched from the Workload API.
+type X509SVID struct {
+	SPIFFEID string
+
+	// Certificates is the certificate of the SVID followed by the
+	// intermediate certificates.
+	Certificates []*x509.Certificate
+	PrivateKey   crypto.Signer
+}
+
+// TLSCertificate returns the SVID as a client certificate.
+func (s *X509SVID) TLSCertificate() tls.Certificate {
+	cert := tls.Certificate{PrivateKey: s.PrivateKey, Leaf: s.Certificates[0]}
+
+	for _, c := range s.Certificates {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return cert
+}
+
+// Client fetches SVIDs from the Workload API.
+type Client struct {
+	target string
+}
+
+// NewClient creates a Client of the Workload API at addr, which is either
+// a unix socket ("unix:///path/to/agent.sock" or an absolute path) or a TCP
+// address ("tcp://127.0.0.1:8081"). If addr is empty, EnvEndpointSocket
+// is used.
+func NewClient(addr string) (*Client, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("no Workload API address is configured and %s is not set", EnvEndpointSocket)
+	}
+
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		if !strings.HasPrefix(addr, "unix:///") {
+			return nil, fmt.Errorf("invalid Workload API address %q: the path of a unix socket must be absolute", addr)
+		}
+
+		return &Client{target: addr}, nil
+	case strings.HasPrefix(addr, "tcp://"):
+		host := strings.TrimPrefix(addr, "tcp://")
+		if host == "" || strings.Contains(host, "/") {
+			return nil, fmt.Errorf("invalid Workload API address %q: must be tcp://<ip>:<port>", addr)
+		}
+
+		return &Client{target: "passthrough:///" + host}, nil
+	case strings.HasPrefix(addr, "/"):
+		return &Client{target: "unix://" + addr}, nil
+	default:
+		return nil, fmt.Errorf("invalid Workload API address %q: must be a unix:// or tcp:// address", addr)
+	}
+}
+
+// FetchJWTSVID fetches a JWT-SVID for the audience. If spiffeID is not
+// empty, the SVID of that SPIFFE ID is fetched; otherwise, the agent picks
+// the default SVID of the workload.
+func (c *Client) FetchJWTSVID(ctx context.Context, audience []string, spiffeID string) (*JWTSVID, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // nolint: errcheck
+
+	var req []byte
+	for _, aud := range audience {
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendString(req, aud)
+	}
+
+	if spiffeID != "" {
+		req = protowire.AppendTag(req, 2, protowire.BytesType)
+		req = protowire.AppendString(req, spiffeID)
+	}
+
+	var resp []byte
+	if err = conn.Invoke(withSecurityHeader(ctx), methodFetchJWTSVID, &req, &resp); err != nil {
+		return nil, fmt.Errorf("error fetching JWT-SVID: %w", err)
+	}
+
+	var svids []*JWTSVID
+
+	err = rawproto.Fields(resp, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+
+		svid := &JWTSVID{}
+		svids = append(svids, svid)
+
+		return rawproto.Fields(value, func(num protowire.Number, value []byte) error {
+			switch num {
+			case 1:
+				svid.SPIFFEID = string(value)
+			case 2:
+				svid.Token = string(value)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding JWT-SVID response: %w", err)
+	}
+
+	for _, svid := range svids {
+		if svid.Token != "" && (spiffeID == "" || svid.SPIFFEID == spiffeID) {
+			return svid, nil
+		}
+	}
+
+	return nil, errors.New("the Workload API returned no JWT-SVID")
+}
+
+// FetchX509SVID fetches the X.509-SVID of the workload. If spiffeID is not
+// empty, the SVID of that SPIFFE ID is returned; otherwise, the first SVID,
+// which is the default one.
+func (c *Client) FetchX509SVID(ctx context.Context, spiffeID string) (*X509SVID, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // nolint: errcheck
+
+	// The stream sends an update whenever the SVIDs are rotated, but only
+	// the current ones are needed
+	ctx, cancel := context.WithCancel(withSecurityHeader(ctx))
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, methodFetchX509SVID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching X.509-SVID: %w", err)
+	}
+
+	req := []byte{}
+	if err = stream.SendMsg(&req); err != nil {
+		return nil, fmt.Errorf("error fetching X.509-SVID: %w", err)
+	}
+
+	if err = stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("error fetching X.509-SVID: %w", err)
+	}
+
+	var resp []byte
+	if err = stream.RecvMsg(&resp); err != nil {
+		return nil, fmt.Errorf("error fetching X.509-SVID: %w", err)
+	}
+
+	var found *X509SVID
+
+	err = rawproto.Fields(resp, func(num protowire.Number, value []byte) error {
+		if num != 1 || found != nil {
+			return nil
+		}
+
+		svid, err := parseX509SVID(value)
+		if err != nil {
+			return err
+		}
+
+		if spiffeID == "" || svid.SPIFFEID == spiffeID {
+			found = svid
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding X.509-SVID response: %w", err)
+	}
+
+	if found == nil {
+		return nil, errors.New("the Workload API returned no X.509-SVID")
+	}
+
+	return found, nil
+}
+
+// parseX509SVID parses an X509SVID message, whose certificates are
+// concatenated in ASN.1 DER and whose key is in PKCS #8.
+func parseX509SVID(msg []byte) (*X509SVID, error) {
+	svid := &X509SVID{}
+
+	var certs, key []byte
+
+	err := rawproto.Fields(msg, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			svid.SPIFFEID = string(value)
+		case 2:
+			certs = value
+		case 3:
+			key = value
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if svid.Certificates, err = x509.ParseCertificates(certs); err != nil {
+		return nil, fmt.Errorf("error parsing certificates of %s: %w", svid.SPIFFEID, err)
+	}
+
+	if len(svid.Certificates) == 0 {
+		return nil, fmt.Errorf("the X.509-SVID of %s has no certificate", svid.SPIFFEID)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key of %s: %w", svid.SPIFFEID, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("the private key of %s cannot sign", svid.SPIFFEID)
+	}
+
+	svid.PrivateKey = signer
+
+	return svid, nil
+}
+
+func (c *Client) dial() (*grpc.ClientConn, error) {
+	conn, err := grpc.Dial(c.target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawproto.Codec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Workload API: %w", err)
+	}
+
+	return conn, nil
+}
+
+func withSecurityHeader(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, securityHeader, "true")
+}
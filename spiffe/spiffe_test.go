@@ -0,0 +1,317 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package spiffe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/morningconsult/docker-credential-vault-login/internal/rawproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// serveWorkloadAPI serves a fake Workload API on a unix socket which
+// answers the requests of every method with its response and records the
+// requests. It returns the address of the socket.
+func serveWorkloadAPI(t *testing.T, responses map[string][]byte, requests map[string][]byte) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawproto.Codec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			if got := md.Get(securityHeader); len(got) != 1 || got[0] != "true" {
+				return errors.New("security header is missing")
+			}
+
+			var req []byte
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+
+			requests[method] = req
+
+			resp, ok := responses[method]
+			if !ok {
+				return errors.New("no identity issued")
+			}
+
+			return stream.SendMsg(&resp)
+		}),
+	)
+
+	go server.Serve(listener) // nolint: errcheck
+	t.Cleanup(server.Stop)
+
+	return "unix://" + socket
+}
+
+func TestNewClient(t *testing.T) {
+	cases := []struct {
+		name   string
+		addr   string
+		target string
+		err    string
+	}{
+		{
+			name:   "unix",
+			addr:   "unix:///run/spire/sockets/agent.sock",
+			target: "unix:///run/spire/sockets/agent.sock",
+		},
+		{
+			name:   "path",
+			addr:   "/run/spire/sockets/agent.sock",
+			target: "unix:///run/spire/sockets/agent.sock",
+		},
+		{
+			name:   "tcp",
+			addr:   "tcp://127.0.0.1:8081",
+			target: "passthrough:///127.0.0.1:8081",
+		},
+		{
+			name: "empty",
+			err:  "no Workload API address is configured and SPIFFE_ENDPOINT_SOCKET is not set",
+		},
+		{
+			name: "relative-unix",
+			addr: "unix://agent.sock",
+			err:  `invalid Workload API address "unix://agent.sock": the path of a unix socket must be absolute`,
+		},
+		{
+			name: "bad-tcp",
+			addr: "tcp://",
+			err:  `invalid Workload API address "tcp://": must be tcp://<ip>:<port>`,
+		},
+		{
+			name: "bad-scheme",
+			addr: "http://localhost:8081",
+			err:  `invalid Workload API address "http://localhost:8081": must be a unix:// or tcp:// address`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient(tc.addr)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.target != tc.target {
+				t.Fatalf("Expected target %q, got %q", tc.target, client.target)
+			}
+		})
+	}
+}
+
+func TestClient_FetchJWTSVID(t *testing.T) {
+	var svids []byte
+	for _, svid := range [][2]string{
+		{"spiffe://example.org/web", "web.jwt"},
+		{"spiffe://example.org/builder", "builder.jwt"},
+	} {
+		var msg []byte
+		msg = rawproto.AppendField(msg, 1, []byte(svid[0]))
+		msg = rawproto.AppendField(msg, 2, []byte(svid[1]))
+		svids = rawproto.AppendField(svids, 1, msg)
+	}
+
+	cases := []struct {
+		name     string
+		spiffeID string
+		response []byte
+		expected *JWTSVID
+		err      string
+	}{
+		{
+			name:     "default",
+			response: svids,
+			expected: &JWTSVID{SPIFFEID: "spiffe://example.org/web", Token: "web.jwt"},
+		},
+		{
+			name:     "spiffe-id",
+			spiffeID: "spiffe://example.org/builder",
+			response: svids,
+			expected: &JWTSVID{SPIFFEID: "spiffe://example.org/builder", Token: "builder.jwt"},
+		},
+		{
+			name:     "unknown-spiffe-id",
+			spiffeID: "spiffe://example.org/db",
+			response: svids,
+			err:      "the Workload API returned no JWT-SVID",
+		},
+		{
+			name: "no-identity",
+			err:  "error fetching JWT-SVID: rpc error: code = Unknown desc = no identity issued",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			responses := map[string][]byte{}
+			if tc.response != nil {
+				responses[methodFetchJWTSVID] = tc.response
+			}
+
+			requests := map[string][]byte{}
+
+			client, err := NewClient(serveWorkloadAPI(t, responses, requests))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			svid, err := client.FetchJWTSVID(context.Background(), []string{"vault"}, tc.spiffeID)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, svid); diff != "" {
+				t.Fatalf("SVIDs differ:\n%s", diff)
+			}
+
+			expected := rawproto.AppendField(nil, 1, []byte("vault"))
+			if tc.spiffeID != "" {
+				expected = rawproto.AppendField(expected, 2, []byte(tc.spiffeID))
+			}
+
+			if diff := cmp.Diff(expected, requests[methodFetchJWTSVID]); diff != "" {
+				t.Fatalf("Requests differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClient_FetchX509SVID(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, _ := url.Parse("spiffe://example.org/web")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "web"},
+		URIs:         []*url.URL{id},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg []byte
+	msg = rawproto.AppendField(msg, 1, []byte(id.String()))
+	msg = rawproto.AppendField(msg, 2, der)
+	msg = rawproto.AppendField(msg, 3, pkcs8)
+
+	response := rawproto.AppendField(nil, 1, msg)
+
+	cases := []struct {
+		name     string
+		spiffeID string
+		err      string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:     "spiffe-id",
+			spiffeID: id.String(),
+		},
+		{
+			name:     "unknown-spiffe-id",
+			spiffeID: "spiffe://example.org/db",
+			err:      "the Workload API returned no X.509-SVID",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient(serveWorkloadAPI(t,
+				map[string][]byte{methodFetchX509SVID: response}, map[string][]byte{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			svid, err := client.FetchX509SVID(context.Background(), tc.spiffeID)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if svid.SPIFFEID != id.String() {
+				t.Fatalf("Expected SPIFFE ID %q, got %q", id, svid.SPIFFEID)
+			}
+
+			cert := svid.TLSCertificate()
+			if len(cert.Certificate) != 1 || string(cert.Certificate[0]) != string(der) {
+				t.Fatal("expected the certificate of the SVID")
+			}
+			if !key.PublicKey.Equal(svid.PrivateKey.Public()) {
+				t.Fatal("expected the private key of the SVID")
+			}
+		})
+	}
+}
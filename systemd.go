@@ -0,0 +1,133 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/socket"
+)
+
+// systemdUnit is the name of the units written by systemd-install.
+const systemdUnit = "docker-credential-vault-login"
+
+const systemdSocketUnit = `[Unit]
+Description=Docker Credential Helper for Vault Storage (socket)
+
+[Socket]
+ListenStream=%s
+SocketMode=0600
+DirectoryMode=0700
+
+[Install]
+WantedBy=sockets.target
+`
+
+const systemdServiceUnit = `[Unit]
+Description=Docker Credential Helper for Vault Storage
+Requires=%[1]s.socket
+After=%[1]s.socket
+
+[Service]
+ExecStart=%[2]s %[3]s %[4]s serve
+Restart=on-failure
+
+[Install]
+Also=%[1]s.socket
+`
+
+// runSystemdInstall writes a socket unit and a service unit for the
+// systemd instance of the user, so that systemd starts the credential
+// daemon (see runServe) with the configuration file when the shim first
+// connects to its socket.
+func runSystemdInstall(executable, configFile, cacheDir string, args []string, out io.Writer) error {
+	unitDir := ""
+	if configHome := xdgConfigHome(); configHome != "" {
+		unitDir = filepath.Join(configHome, "systemd", "user")
+	}
+
+	flags := flag.NewFlagSet("systemd-install", flag.ContinueOnError)
+	dir := flags.String("dir", unitDir, "directory in which the units are written")
+	socketPath := flags.String("socket", filepath.Join(cacheDir, socket.SocketFile), "path of the credential socket")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return xerrors.New("the directory of the units could not be determined; set -dir")
+	}
+
+	configFile, err := filepath.Abs(configFile)
+	if err != nil {
+		return xerrors.Errorf("error resolving path of configuration file: %w", err)
+	}
+
+	socketFile, err := filepath.Abs(*socketPath)
+	if err != nil {
+		return xerrors.Errorf("error resolving path of credential socket: %w", err)
+	}
+
+	units := map[string]string{
+		systemdUnit + ".socket": fmt.Sprintf(systemdSocketUnit, systemdEscape(socketFile)),
+		systemdUnit + ".service": fmt.Sprintf(systemdServiceUnit, systemdUnit,
+			systemdQuote(executable), "-config", systemdQuote(configFile)),
+	}
+
+	if err = os.MkdirAll(*dir, 0o755); err != nil {
+		return xerrors.Errorf("error creating directory %s: %w", *dir, err)
+	}
+
+	for _, name := range []string{systemdUnit + ".socket", systemdUnit + ".service"} {
+		path := filepath.Join(*dir, name)
+
+		if err = os.WriteFile(path, []byte(units[name]), 0o644); err != nil { // nolint: gosec
+			return xerrors.Errorf("error writing unit %s: %w", path, err)
+		}
+
+		fmt.Fprintf(out, "wrote %s\n", path) // nolint: errcheck
+	}
+
+	_, err = fmt.Fprintf(out, "\nTo start the daemon on first use, run:\n\n"+
+		"  systemctl --user daemon-reload\n"+
+		"  systemctl --user enable --now %s.socket\n\n"+
+		"and set %s=%s for Docker if it is not the default path of the shim.\n",
+		systemdUnit, socket.EnvSocket, socketFile)
+
+	return err
+}
+
+// systemdEscape escapes the specifiers (%) of a value of a unit file.
+func systemdEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// systemdQuote escapes an argument of a command line of a unit file, in
+// which variables ($) are expanded and quotes group words.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(systemdEscape(arg), "$", "$$")
+
+	if !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunSystemdInstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("systemd is not available")
+	}
+
+	dir := filepath.Join(t.TempDir(), "units")
+	cacheDir := t.TempDir()
+	configFile := filepath.Join(t.TempDir(), "my config.hcl")
+
+	var out bytes.Buffer
+
+	err := runSystemdInstall("/usr/local/bin/docker-credential-vault-login", configFile, cacheDir,
+		[]string{"-dir", dir}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"docker-credential-vault-login.socket": `[Unit]
+Description=Docker Credential Helper for Vault Storage (socket)
+
+[Socket]
+ListenStream=` + filepath.Join(cacheDir, "credentials.sock") + `
+SocketMode=0600
+DirectoryMode=0700
+
+[Install]
+WantedBy=sockets.target
+`,
+		"docker-credential-vault-login.service": `[Unit]
+Description=Docker Credential Helper for Vault Storage
+Requires=docker-credential-vault-login.socket
+After=docker-credential-vault-login.socket
+
+[Service]
+ExecStart=/usr/local/bin/docker-credential-vault-login -config "` + configFile + `" serve
+Restart=on-failure
+
+[Install]
+Also=docker-credential-vault-login.socket
+`,
+	}
+
+	for name, unit := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(unit, string(data)); diff != "" {
+			t.Fatalf("Units %s differ:\n%s", name, diff)
+		}
+	}
+
+	if !strings.Contains(out.String(), "systemctl --user enable --now docker-credential-vault-login.socket") {
+		t.Fatalf("Expected instructions to enable the socket, got:\n%s", out.String())
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	cases := []struct {
+		arg      string
+		expected string
+	}{
+		{
+			arg:      "/etc/config.hcl",
+			expected: "/etc/config.hcl",
+		},
+		{
+			arg:      "/home/me/my config.hcl",
+			expected: `"/home/me/my config.hcl"`,
+		},
+		{
+			arg:      "/tmp/100%/$HOME",
+			expected: "/tmp/100%%/$$HOME",
+		},
+		{
+			arg:      `C:\Program Files\"helper"`,
+			expected: `"C:\\Program Files\\\"helper\""`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.arg, func(t *testing.T) {
+			if diff := cmp.Diff(tc.expected, systemdQuote(tc.arg)); diff != "" {
+				t.Fatalf("Arguments differ:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package telemetry sends the metrics of the helper to statsd or DogStatsD
+// and its traces to an OpenTelemetry collector.
+package telemetry
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/internalshared/configutil"
+)
+
+// DefaultPrefix is the prefix of every metric name unless the telemetry
+// stanza sets 'metrics_prefix'.
+const DefaultPrefix = "docker_credential_vault_login"
+
+// Emitter sends metrics over UDP. Unlike the sinks of go-metrics, it sends
+// every metric as soon as it is recorded rather than buffering them since
+// the helper usually exits right after serving a request. A nil Emitter
+// discards all metrics.
+type Emitter struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool
+	tags      []string
+}
+
+// New creates an Emitter from the 'statsd_address', 'dogstatsd_addr',
+// 'dogstatsd_tags' and 'metrics_prefix' fields of the telemetry stanza. If
+// neither address is set, it returns nil.
+func New(config *configutil.Telemetry) (*Emitter, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	e := &Emitter{
+		prefix: DefaultPrefix,
+		tags:   config.DogStatsDTags,
+	}
+
+	if config.MetricsPrefix != "" {
+		e.prefix = config.MetricsPrefix
+	}
+
+	addr := config.StatsdAddr
+	if config.DogStatsDAddr != "" {
+		addr = config.DogStatsDAddr
+		e.dogstatsd = true
+	}
+
+	if addr == "" {
+		return nil, nil
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+
+	e.conn = conn
+
+	return e, nil
+}
+
+// IncrCounter increments the counter by one.
+func (e *Emitter) IncrCounter(name string, labels map[string]string) {
+	e.send(name, "1|c", labels)
+}
+
+// MeasureDuration records a duration in milliseconds.
+func (e *Emitter) MeasureDuration(name string, d time.Duration, labels map[string]string) {
+	e.send(name, fmt.Sprintf("%g|ms", float64(d)/float64(time.Millisecond)), labels)
+}
+
+// Close closes the connection.
+func (e *Emitter) Close() error {
+	if e == nil {
+		return nil
+	}
+
+	return e.conn.Close()
+}
+
+// send writes the metric in the statsd line format. Since statsd has no
+// labels, they are appended to the metric name, sorted by key; DogStatsD
+// receives them as tags instead. Errors are ignored as metrics are best
+// effort.
+func (e *Emitter) send(name, value string, labels map[string]string) {
+	if e == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var line strings.Builder
+
+	line.WriteString(e.prefix + "." + name)
+
+	if !e.dogstatsd {
+		for _, k := range keys {
+			line.WriteString("." + sanitize(labels[k]))
+		}
+	}
+
+	line.WriteString(":" + value)
+
+	if e.dogstatsd {
+		tags := append([]string{}, e.tags...)
+		for _, k := range keys {
+			tags = append(tags, k+":"+labels[k])
+		}
+
+		if len(tags) > 0 {
+			line.WriteString("|#" + strings.Join(tags, ","))
+		}
+	}
+
+	e.conn.Write([]byte(line.String())) // nolint: errcheck
+}
+
+// sanitize replaces the characters which have a meaning in the statsd
+// line format.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '.', ' ', '@', '#':
+			return '_'
+		default:
+			return r
+		}
+	}, s)
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package telemetry
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/internalshared/configutil"
+)
+
+func listenUDP(t *testing.T) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() }) // nolint: errcheck
+
+	return conn
+}
+
+func readPacket(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(buf[:n])
+}
+
+func TestNew_NoAddress(t *testing.T) {
+	for _, config := range []*configutil.Telemetry{nil, {}} {
+		e, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e != nil {
+			t.Fatalf("expected a nil Emitter, got %+v", e)
+		}
+
+		// A nil Emitter discards metrics
+		e.IncrCounter("foo", nil)
+		if err = e.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmitter(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   func(addr string) *configutil.Telemetry
+		emit     func(e *Emitter)
+		expected string
+	}{
+		{
+			name: "statsd-counter",
+			config: func(addr string) *configutil.Telemetry {
+				return &configutil.Telemetry{StatsdAddr: addr}
+			},
+			emit: func(e *Emitter) {
+				e.IncrCounter("slow_request", map[string]string{"phase": "read.secret"})
+			},
+			expected: "docker_credential_vault_login.slow_request.read_secret:1|c",
+		},
+		{
+			name: "statsd-duration",
+			config: func(addr string) *configutil.Telemetry {
+				return &configutil.Telemetry{StatsdAddr: addr, MetricsPrefix: "dcvl"}
+			},
+			emit: func(e *Emitter) {
+				e.MeasureDuration("request", 1500*time.Microsecond, map[string]string{
+					"phase":  "authenticate",
+					"method": "aws",
+				})
+			},
+			expected: "dcvl.request.aws.authenticate:1.5|ms",
+		},
+		{
+			name: "dogstatsd",
+			config: func(addr string) *configutil.Telemetry {
+				return &configutil.Telemetry{DogStatsDAddr: addr, DogStatsDTags: []string{"env:prod"}}
+			},
+			emit: func(e *Emitter) {
+				e.IncrCounter("slow_request", map[string]string{"phase": "authenticate"})
+			},
+			expected: "docker_credential_vault_login.slow_request:1|c|#env:prod,phase:authenticate",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := listenUDP(t)
+
+			e, err := New(tc.config(conn.LocalAddr().String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close() // nolint: errcheck
+
+			tc.emit(e)
+
+			if got := readPacket(t, conn); got != tc.expected {
+				t.Fatalf("Metrics differ:\n%v", cmp.Diff(tc.expected, got))
+			}
+		})
+	}
+}
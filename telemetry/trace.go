@@ -0,0 +1,280 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvTraceParent is the environment variable from which the context of
+	// the parent trace is read, in the W3C Trace Context format.
+	EnvTraceParent = "TRACEPARENT"
+
+	// ServiceName is the 'service.name' attribute of the exported spans.
+	ServiceName = "docker-credential-vault-login"
+
+	// tracesPath is appended to the OTLP endpoint.
+	tracesPath = "/v1/traces"
+
+	// exportTimeout bounds how long exporting spans may take.
+	exportTimeout = 2 * time.Second
+
+	// The span status codes of OTLP.
+	statusOK    = 1
+	statusError = 2
+)
+
+// traceParentRegexp matches a traceparent header of version 00.
+var traceParentRegexp = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// Tracer records spans and exports them to an OTLP collector over HTTP,
+// encoded as JSON. As with the Emitter, no SDK is used: the spans are
+// exported by Flush, which the helper calls at the end of every request
+// since it usually exits right after. A nil Tracer records nothing.
+type Tracer struct {
+	endpoint string
+	client   *http.Client
+
+	// traceID and parentID identify the span of the process which invoked
+	// the helper, if any.
+	traceID  string
+	parentID string
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// Span is a timed operation of a trace. A nil Span records nothing.
+type Span struct {
+	tracer     *Tracer
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+// NewTracer creates a Tracer exporting spans to the OTLP/HTTP endpoint
+// (e.g. "http://localhost:4318"). If traceParent is a valid traceparent
+// header, the spans belong to its trace; otherwise, as the W3C Trace
+// Context specification requires, it is ignored. If endpoint is empty, it
+// returns nil.
+func NewTracer(endpoint, traceParent string) (*Tracer, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing OTLP endpoint: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("OTLP endpoint %q must be an http or https URL", endpoint)
+	}
+
+	t := &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + tracesPath,
+		client:   &http.Client{Timeout: exportTimeout},
+	}
+
+	if m := traceParentRegexp.FindStringSubmatch(traceParent); m != nil &&
+		strings.Trim(m[1], "0") != "" && strings.Trim(m[2], "0") != "" {
+		t.traceID, t.parentID = m[1], m[2]
+	}
+
+	return t, nil
+}
+
+// Start begins a span. If parent is nil, the span is a child of the span
+// of the traceparent, if any, or else the root of a new trace.
+func (t *Tracer) Start(name string, parent *Span) *Span {
+	if t == nil {
+		return nil
+	}
+
+	s := &Span{
+		tracer:     t,
+		spanID:     randomHex(8),
+		name:       name,
+		start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+
+	switch {
+	case parent != nil:
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	case t.traceID != "":
+		s.traceID, s.parentID = t.traceID, t.parentID
+	default:
+		s.traceID = randomHex(16)
+	}
+
+	return s
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.attributes[key] = value
+}
+
+// End ends the span. If err is not nil, the status of the span is an
+// error.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.end = time.Now()
+	s.err = err
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+// Flush exports the spans which ended since the last flush.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(exportRequest(spans))
+	if err != nil {
+		return fmt.Errorf("error encoding spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating OTLP request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error exporting spans: %w", err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error exporting spans: OTLP endpoint responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// exportRequest returns the body of an OTLP ExportTraceServiceRequest
+// containing the spans.
+func exportRequest(spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+
+	for _, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attributes(s.attributes),
+			"status":            map[string]interface{}{"code": statusOK},
+		}
+
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+
+		if s.err != nil {
+			span["status"] = map[string]interface{}{"code": statusError, "message": s.err.Error()}
+		}
+
+		encoded = append(encoded, span)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": attributes(map[string]string{"service.name": ServiceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": ServiceName},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+// attributes encodes string attributes as OTLP key-values, sorted by key.
+func attributes(attrs map[string]string) []interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	encoded := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		encoded = append(encoded, map[string]interface{}{
+			"key":   k,
+			"value": map[string]interface{}{"stringValue": attrs[k]},
+		})
+	}
+
+	return encoded
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b) // nolint: errcheck
+
+	return hex.EncodeToString(b)
+}
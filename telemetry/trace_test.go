@@ -0,0 +1,245 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// exportedSpan is the part of an OTLP span which is checked.
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Attributes   []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// newCollector returns the URL of a fake OTLP collector and a function
+// returning the spans it received.
+func newCollector(t *testing.T) (string, func() []exportedSpan) {
+	t.Helper()
+
+	var spans []exportedSpan
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tracesPath || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts.URL, func() []exportedSpan { return spans }
+}
+
+func TestNewTracer(t *testing.T) {
+	cases := []struct {
+		name     string
+		endpoint string
+		err      string
+	}{
+		{
+			name: "no-endpoint",
+		},
+		{
+			name:     "http",
+			endpoint: "http://localhost:4318/",
+		},
+		{
+			name:     "no-scheme",
+			endpoint: "localhost:4318",
+			err:      `OTLP endpoint "localhost:4318" must be an http or https URL`,
+		},
+		{
+			name:     "bad-url",
+			endpoint: "http://[::1",
+			err:      `error parsing OTLP endpoint: parse "http://[::1": missing ']' in host`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer, err := NewTracer(tc.endpoint, "")
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.endpoint == "" && tracer != nil {
+				t.Fatalf("expected a nil Tracer, got %+v", tracer)
+			}
+			if tc.endpoint != "" && tracer.endpoint != "http://localhost:4318"+tracesPath {
+				t.Fatalf("Expected endpoint %q, got %q", "http://localhost:4318"+tracesPath, tracer.endpoint)
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+
+	cases := []struct {
+		name        string
+		traceParent string
+		inherited   bool
+	}{
+		{
+			name:        "traceparent",
+			traceParent: "00-" + traceID + "-" + parentID + "-01",
+			inherited:   true,
+		},
+		{
+			name: "no-traceparent",
+		},
+		{
+			name:        "invalid-traceparent",
+			traceParent: "00-" + traceID + "-0000000000000000-01",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint, received := newCollector(t)
+
+			tracer, err := NewTracer(endpoint, tc.traceParent)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			root := tracer.Start("get", nil)
+			root.SetAttribute("registry", "registry.example.com")
+			tracer.Start("authenticate", root).End(errors.New("permission denied"))
+			root.End(nil)
+
+			if err = tracer.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := received()
+			if len(spans) != 2 {
+				t.Fatalf("Expected 2 spans, got %d", len(spans))
+			}
+
+			child, parent := spans[0], spans[1]
+
+			if tc.inherited {
+				if parent.TraceID != traceID || parent.ParentSpanID != parentID {
+					t.Fatalf("Expected the span to be a child of %s/%s, got %s/%s",
+						traceID, parentID, parent.TraceID, parent.ParentSpanID)
+				}
+			} else if parent.TraceID == traceID || len(parent.TraceID) != 32 || parent.ParentSpanID != "" {
+				t.Fatalf("Expected the root of a new trace, got %+v", parent)
+			}
+
+			if child.TraceID != parent.TraceID || child.ParentSpanID != parent.SpanID {
+				t.Fatalf("Expected %q to be a child of %q", child.Name, parent.Name)
+			}
+
+			if child.Status.Code != statusError || child.Status.Message != "permission denied" {
+				t.Fatalf("Expected an error status, got %+v", child.Status)
+			}
+
+			if parent.Status.Code != statusOK || len(parent.Attributes) != 1 ||
+				parent.Attributes[0].Value.StringValue != "registry.example.com" {
+				t.Fatalf("Unexpected span %+v", parent)
+			}
+
+			// The spans are exported only once
+			if err = tracer.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(received()) != 2 {
+				t.Fatalf("Expected the spans to be exported once, got %d spans", len(received()))
+			}
+		})
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+
+	span := tracer.Start("get", nil)
+	span.SetAttribute("registry", "registry.example.com")
+	span.End(nil)
+
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTracer_FlushError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	tracer, err := NewTracer(ts.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer.Start("get", nil).End(nil)
+
+	expected := "error exporting spans: OTLP endpoint responded with 503 Service Unavailable"
+	if err = tracer.Flush(context.Background()); err == nil || err.Error() != expected {
+		t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, fmt.Sprint(err)))
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/awsauth"
+	"github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogin"
+)
+
+// methodRule lists the config values which an auth method requires and
+// the config values which are paths of files which must exist.
+type methodRule struct {
+	required []string
+	files    []string
+}
+
+// methodRules are the rules of every supported auth method. The token file
+// of the jwt method is not checked, as the method removes it after reading
+// it by default.
+var methodRules = map[string]methodRule{
+	"alicloud": {required: []string{"role", "region"}},
+	"approle":  {required: []string{"role_id_file_path"}, files: []string{"role_id_file_path", "secret_id_file_path"}},
+	"aws": {
+		required: []string{"role", "type"},
+		files:    []string{"shared_credentials_file", "web_identity_token_file"},
+	},
+	"azure":      {required: []string{"role", "resource"}},
+	"cert":       {files: []string{"ca_cert", "client_cert", "client_key"}},
+	"cf":         {required: []string{"role"}, files: []string{"instance_cert_path", "instance_key_path"}},
+	"exec":       {required: []string{"command"}},
+	"gcp":        {required: []string{"role", "type"}},
+	"github":     {files: []string{"token_file_path"}},
+	"jwt":        {required: []string{"role", "path"}},
+	"kubernetes": {required: []string{"role"}, files: []string{"token_path"}},
+	"ldap":       {files: []string{"password_file_path"}},
+	"oci":        {required: []string{"role", "type"}, files: []string{"config_file_path"}},
+	"oidc":       {},
+	"spiffe":     {},
+	"token":      {files: []string{"token_file_path"}},
+	"token_file": {required: []string{"token_file_path"}, files: []string{"token_file_path"}},
+	"userpass":   {},
+
+	"vault_agent_proxy": {},
+}
+
+// runValidate checks the configuration file without contacting Vault and
+// writes every problem found to out.
+func runValidate(configFile string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.StringVar(&configFile, "config", configFile, "path to the configuration file")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return xerrors.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	// Validate the profile of the active Docker context, if it has one
+	dockerContext, err := config.CurrentDockerContext()
+	if err != nil {
+		return xerrors.Errorf("error reading the current Docker context: %w", err)
+	}
+
+	contextConfigFile, err := config.ContextConfigFile(configFile, dockerContext)
+	if err != nil {
+		return xerrors.Errorf("error parsing configuration file %s: %w", configFile, err)
+	}
+
+	configFile = contextConfigFile
+
+	problems := validateProfiles(configFile)
+	if len(problems) == 0 {
+		_, err = fmt.Fprintf(out, "%s is valid\n", configFile)
+
+		return err
+	}
+
+	for _, problem := range problems {
+		if _, err = fmt.Fprintf(out, "%s: %s\n", configFile, problem); err != nil {
+			return err
+		}
+	}
+
+	return xerrors.Errorf("found %d problem(s) in %s", len(problems), configFile)
+}
+
+// validateProfiles returns the problems with the configuration outside of
+// profiles, unless it is only used with profiles, and with the
+// configuration of every profile.
+func validateProfiles(configFile string) []string {
+	profiles, err := config.LoadProfiles(configFile)
+	if err != nil {
+		return []string{fmt.Sprintf("error parsing profiles: %v", err)}
+	}
+
+	var problems []string
+
+	if profiles.Empty() || profiles.HasRoot() {
+		data, err := readConfigFile(configFile)
+		if err != nil {
+			return []string{err.Error()}
+		}
+
+		problems = validateConfig(data)
+	}
+
+	for _, name := range profiles.Names() {
+		data, err := profileConfig(profiles, name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("profile %q: %v", name, err))
+			continue
+		}
+
+		for _, problem := range validateConfig(data) {
+			problems = append(problems, fmt.Sprintf("profile %q: %s", name, problem))
+		}
+	}
+
+	return problems
+}
+
+// validateConfig parses the contents of the configuration file and returns
+// the problems with it. Nothing is created and no network requests are
+// made.
+func validateConfig(data []byte) []string { // nolint: gocyclo
+	cfg, err := config.ParseConfig(data)
+	if err != nil {
+		return []string{fmt.Sprintf("error parsing configuration file: %v", err)}
+	}
+
+	if cfg.AutoAuth.Method == nil {
+		return []string{"no 'auto_auth.method' block found"}
+	}
+
+	methodConfig := cfg.AutoAuth.Method.Config
+
+	var problems []string
+
+	check := func(context string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", context, err))
+		}
+	}
+
+	_, err = config.BuildSecretsTable(methodConfig)
+	check("invalid 'secret' or 'secrets'", err)
+
+	_, err = vault.NewResponsePin(methodConfig)
+	check("invalid pinned response", err)
+
+	_, err = vault.NewHCPOptions(methodConfig)
+	check("invalid HCP options", err)
+
+	_, err = vault.NewProxyOptions(methodConfig)
+	check("invalid 'proxy_url' or 'no_proxy'", err)
+
+	_, err = vault.RequestTimeout(methodConfig)
+	check("invalid 'vault_request_timeout'", err)
+
+	_, err = vault.NewBootstrapOptions(cfg.AutoAuth.Method)
+	check("invalid bootstrap options", err)
+
+	_, err = vault.NewCredentialExecOptions(methodConfig)
+	check("invalid 'credential_exec'", err)
+
+	_, err = vault.NewRetryPolicy(methodConfig)
+	check("invalid retry policy", err)
+
+	_, err = vault.NewRateLimit(methodConfig)
+	check("invalid rate limit", err)
+
+	_, err = vault.NewECROptions(methodConfig)
+	check("invalid ECR options", err)
+
+	_, err = vault.NewGCROptions(methodConfig)
+	check("invalid GCR options", err)
+
+	_, err = vault.NewACROptions(methodConfig)
+	check("invalid ACR options", err)
+
+	problems = append(problems, vaultlogin.ValidateConfig(methodConfig)...)
+
+	_, err = config.BuildStaticCredentials(methodConfig)
+	check("invalid static credentials", err)
+
+	_, err = newLogger(methodConfig, io.Discard)
+	check("invalid logging options", err)
+
+	nodes, err := config.ParseVaultAddresses(data)
+	check("invalid 'vault.addresses'", err)
+
+	for i, node := range nodes {
+		if node.CACert != "" {
+			check(fmt.Sprintf("'vault.addresses' address %d 'ca_cert'", i+1), fileExists(node.CACert))
+		}
+	}
+
+	_, err = config.ParseStaleOptions(data)
+	check("invalid 'cache' block", err)
+
+	problems = append(problems, validateMethod("auto_auth.method", cfg.AutoAuth.Method)...)
+
+	fallbackMethods, err := config.ParseFallbackMethods(data)
+	check("invalid fallback auth methods", err)
+
+	for i, method := range fallbackMethods {
+		problems = append(problems, validateMethod(fmt.Sprintf("fallback method %d", i+1), method)...)
+	}
+
+	if cfg.Vault != nil {
+		for _, file := range []struct{ key, path string }{
+			{"vault.ca_cert", cfg.Vault.CACert},
+			{"vault.ca_path", cfg.Vault.CAPath},
+			{"vault.client_cert", cfg.Vault.ClientCert},
+			{"vault.client_key", cfg.Vault.ClientKey},
+		} {
+			if file.path != "" {
+				check(fmt.Sprintf("'%s'", file.key), fileExists(file.path))
+			}
+		}
+	}
+
+	for i, sink := range cfg.AutoAuth.Sinks {
+		problems = append(problems, validateSink(i+1, sink)...)
+	}
+
+	return problems
+}
+
+// validateMethod checks that the auth method is supported, that its
+// required config values are set and that its files exist.
+func validateMethod(name string, method *vaultconfig.Method) []string {
+	rule, ok := methodRules[method.Type]
+	if !ok {
+		return []string{fmt.Sprintf("%s: unsupported auth method %q", name, method.Type)}
+	}
+
+	var problems []string
+
+	for _, key := range rule.required {
+		if v, _ := method.Config[key].(string); v == "" {
+			problems = append(problems, fmt.Sprintf("%s: the %s auth method requires 'config.%s' to be set",
+				name, method.Type, key))
+		}
+	}
+
+	for _, key := range rule.files {
+		raw, ok := method.Config[key]
+		if !ok {
+			continue
+		}
+
+		path, ok := raw.(string)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: 'config.%s' must be a string", name, key))
+
+			continue
+		}
+
+		if path == "" {
+			continue
+		}
+
+		// Only the token file paths of the token and github methods and the
+		// files of the aws and oci methods support "~"
+		if method.Type == "token" || method.Type == "github" || method.Type == "aws" || method.Type == "oci" {
+			if expanded, err := homedir.Expand(path); err == nil {
+				path = expanded
+			}
+		}
+
+		if err := fileExists(path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: 'config.%s': %v", name, key, err))
+		}
+	}
+
+	if method.Type == "aws" {
+		problems = append(problems, validateAWSMethod(name, method.Config)...)
+	}
+
+	return problems
+}
+
+// validateAWSMethod checks the settings of the aws method which are only
+// used by the helper.
+func validateAWSMethod(name string, config map[string]interface{}) []string {
+	var problems []string
+
+	if endpoint, _ := config["sts_endpoint"].(string); endpoint != "" {
+		if err := awsauth.ValidateSTSEndpoint(endpoint); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: 'config.sts_endpoint': %v", name, err))
+		}
+	}
+
+	source, _ := config["credential_source"].(string)
+	if err := awsauth.ValidateSource(source); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: 'config.credential_source': %v", name, err))
+	}
+
+	for _, keys := range [][2]string{
+		{"assume_role_arn", "assume_role_session_name"},
+		{"aws_role_arn", "aws_role_session_name"},
+	} {
+		roleARN, ok := config[keys[0]].(string)
+		if !ok {
+			continue
+		}
+
+		session, _ := config[keys[1]].(string)
+		if err := awsauth.ValidateAssumeRole(roleARN, session); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: 'config.%s': %v", name, keys[0], err))
+		}
+	}
+
+	return problems
+}
+
+// validateSink checks that the directory of a file sink and its
+// Diffie-Hellman private key file exist.
+func validateSink(index int, sink *vaultconfig.Sink) []string {
+	if sink.Type != "file" {
+		return []string{fmt.Sprintf("sink %d: unsupported sink type %q", index, sink.Type)}
+	}
+
+	var problems []string
+
+	path, _ := sink.Config["path"].(string)
+	if path == "" {
+		problems = append(problems, fmt.Sprintf("sink %d: the file sink requires 'config.path' to be set", index))
+	} else if err := fileExists(filepath.Dir(path)); err != nil {
+		problems = append(problems, fmt.Sprintf("sink %d: directory of 'config.path': %v", index, err))
+	}
+
+	if dhPriv, _ := sink.Config["dh_priv"].(string); dhPriv != "" {
+		if err := fileExists(dhPriv); err != nil {
+			problems = append(problems, fmt.Sprintf("sink %d: 'config.dh_priv': %v", index, err))
+		}
+	}
+
+	return problems
+}
+
+// fileExists returns an error which explains why the file or directory
+// cannot be used if it does not exist.
+func fileExists(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return xerrors.Errorf("%s does not exist", path)
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunValidate(t *testing.T) {
+	t.Setenv("DCVL_DOCKER_CONTEXT", "default")
+	t.Setenv("TMPDIR", t.TempDir())
+
+	dir := t.TempDir()
+
+	roleIDFile := filepath.Join(dir, "role-id")
+	if err := os.WriteFile(roleIDFile, []byte("role"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		config   string
+		args     []string
+		expected []string
+		err      string
+	}{
+		{
+			name: "valid",
+			config: fmt.Sprintf(`auto_auth {
+	method "approle" {
+		config = {
+			role_id_file_path = %q
+			secret            = "secret/docker/creds"
+		}
+	}
+
+	fallback_method "aws" {
+		config = {
+			type = "iam"
+			role = "dev-role"
+		}
+	}
+
+	sink "file" {
+		config = {
+			path = %q
+		}
+	}
+}`, roleIDFile, filepath.Join(dir, "token")),
+			expected: []string{"%s is valid"},
+		},
+		{
+			name: "missing-fields",
+			config: `auto_auth {
+	method "aws" {
+		config = {
+			type         = "iam"
+			secret       = "secret/docker/creds"
+			sts_endpoint = "sts.us-gov-west-1.amazonaws.com"
+		}
+	}
+
+	fallback_method "gcp" {
+		config = {
+			type = "gce"
+		}
+	}
+}`,
+			expected: []string{
+				"%s: auto_auth.method: the aws auth method requires 'config.role' to be set",
+				"%s: auto_auth.method: 'config.sts_endpoint': STS endpoint \"sts.us-gov-west-1.amazonaws.com\" " +
+					"is not an https:// URL",
+				"%s: fallback method 1: the gcp auth method requires 'config.role' to be set",
+			},
+			err: "found 3 problem(s) in %s",
+		},
+		{
+			name: "missing-files",
+			config: fmt.Sprintf(`vault {
+	ca_cert = %q
+}
+
+auto_auth {
+	method "approle" {
+		config = {
+			role_id_file_path   = %q
+			secret_id_file_path = %q
+			secret              = "secret/docker/creds"
+		}
+	}
+
+	sink "file" {
+		config = {
+			path = %q
+		}
+	}
+}`, filepath.Join(dir, "ca.pem"), roleIDFile, filepath.Join(dir, "secret-id"),
+				filepath.Join(dir, "missing", "token")),
+			expected: []string{
+				fmt.Sprintf("%%s: auto_auth.method: 'config.secret_id_file_path': %s does not exist",
+					filepath.Join(dir, "secret-id")),
+				fmt.Sprintf("%%s: 'vault.ca_cert': %s does not exist", filepath.Join(dir, "ca.pem")),
+				fmt.Sprintf("%%s: sink 1: directory of 'config.path': %s does not exist",
+					filepath.Join(dir, "missing")),
+			},
+			err: "found 3 problem(s) in %s",
+		},
+		{
+			name: "invalid-settings",
+			config: `auto_auth {
+	method "userpass" {
+		config = {
+			secret                 = "secret/docker/creds"
+			slow_request_threshold = "soon"
+			log_level              = "verbose"
+			wrapping_token_file    = ""
+			static_credentials = {
+				registry.example.com = {
+					username = "ci"
+				}
+			}
+		}
+	}
+}`,
+			expected: []string{
+				"%s: invalid bootstrap options: 'wrapping_token_file' must be a non-empty string",
+				"%s: invalid 'slow_request_threshold': error parsing 'slow_request_threshold': time: invalid duration \"soon\"",
+				"%s: invalid static credentials: field 'auto_auth.method.config.static_credentials.registry.example.com' " +
+					"must have either 'password' or 'password_env'",
+				"%s: invalid logging options: invalid log level \"verbose\": must be one of trace, debug, info, warn or error",
+			},
+			err: "found 4 problem(s) in %s",
+		},
+		{
+			name: "invalid-aws-credentials",
+			config: `auto_auth {
+	method "aws" {
+		config = {
+			type                    = "iam"
+			role                    = "dev-role"
+			secret                  = "secret/docker/creds"
+			credential_source       = "sso"
+			web_identity_token_file = "testdata/does-not-exist"
+			aws_role_arn            = "registry"
+		}
+	}
+}`,
+			expected: []string{
+				"%s: auto_auth.method: 'config.web_identity_token_file': testdata/does-not-exist does not exist",
+				"%s: auto_auth.method: 'config.credential_source': unsupported credential source \"sso\": " +
+					"must be one of env, profile, web_identity, ecs or ec2",
+				"%s: auto_auth.method: 'config.aws_role_arn': \"registry\" is not the ARN of an IAM role",
+			},
+			err: "found 3 problem(s) in %s",
+		},
+		{
+			name: "profiles",
+			config: `profile "ci" {
+	registries = ["ci.registry.example.com"]
+
+	auto_auth {
+		method "aws" {
+			config = {
+				type   = "iam"
+				role   = "dev-role"
+				secret = "secret/docker/creds"
+			}
+		}
+	}
+}
+
+profile "prod" {
+	auto_auth {
+		method "aws" {
+			config = {
+				type   = "iam"
+				secret = "secret/prod/docker/creds"
+			}
+		}
+	}
+}`,
+			expected: []string{
+				`%s: profile "prod": auto_auth.method: the aws auth method requires 'config.role' to be set`,
+			},
+			err: "found 1 problem(s) in %s",
+		},
+		{
+			name: "unsupported-method",
+			config: `auto_auth {
+	method "kerberos" {
+		config = {
+			secret = "secret/docker/creds"
+		}
+	}
+}`,
+			expected: []string{`%s: auto_auth.method: unsupported auth method "kerberos"`},
+			err:      "found 1 problem(s) in %s",
+		},
+		{
+			name:   "extra-args",
+			config: `auto_auth {}`,
+			args:   []string{"now"},
+			err:    "unexpected arguments: [now]",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configFile := filepath.Join(dir, tc.name+".hcl")
+			if err := os.WriteFile(configFile, []byte(tc.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+
+			err := runValidate("", append([]string{"-config", configFile}, tc.args...), &out)
+			if tc.err != "" {
+				expected := strings.ReplaceAll(tc.err, "%s", configFile)
+				if err == nil || err.Error() != expected {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, fmt.Sprint(err)))
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var expected string
+			for _, line := range tc.expected {
+				expected += strings.ReplaceAll(line, "%s", configFile) + "\n"
+			}
+
+			if diff := cmp.Diff(expected, out.String()); diff != "" {
+				t.Fatalf("Output differs:\n%s", diff)
+			}
+		})
+	}
+}
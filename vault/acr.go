@@ -0,0 +1,219 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/azureauth"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// ACROptions configures how refresh tokens of Azure Container Registry are
+// obtained.
+type ACROptions struct {
+	// TenantID is the Azure AD tenant of the service principals read from
+	// Vault which do not name their tenant.
+	TenantID string
+
+	// UseMSI makes the helper request Azure AD tokens of the managed
+	// identity of the host instead of reading them from Vault. MSIClientID,
+	// if set, selects a user-assigned identity.
+	UseMSI      bool
+	MSIClientID string
+
+	// AuthorityHost, IMDSEndpoint and Endpoint, if set, are used instead
+	// of the Azure AD endpoint, the instance metadata service and the
+	// exchange endpoint of the registry.
+	AuthorityHost string
+	IMDSEndpoint  string
+	Endpoint      string
+
+	HTTPClient *http.Client
+
+	// Clock, if set, is the clock by which the expiration of Azure AD
+	// tokens is computed and the lease duration is capped. Otherwise, the
+	// system clock is used.
+	Clock clock.Clock
+}
+
+// NewACROptions parses the 'acr_token_mode', 'acr_tenant_id',
+// 'acr_use_msi' and 'acr_msi_client_id' fields of the auth method config.
+// It returns nil if the ACR token mode is not enabled.
+func NewACROptions(config map[string]interface{}) (*ACROptions, error) {
+	raw, ok := config["acr_token_mode"]
+	if !ok {
+		return nil, nil
+	}
+
+	enabled, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return nil, xerrors.New("'acr_token_mode' must be a boolean")
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+
+	opts := &ACROptions{}
+
+	if raw, ok = config["acr_tenant_id"]; ok {
+		if opts.TenantID, ok = raw.(string); !ok {
+			return nil, xerrors.New("'acr_tenant_id' must be a string")
+		}
+	}
+
+	if raw, ok = config["acr_use_msi"]; ok {
+		if opts.UseMSI, err = parseutil.ParseBool(raw); err != nil {
+			return nil, xerrors.New("'acr_use_msi' must be a boolean")
+		}
+	}
+
+	if raw, ok = config["acr_msi_client_id"]; ok {
+		if opts.MSIClientID, ok = raw.(string); !ok {
+			return nil, xerrors.New("'acr_msi_client_id' must be a string")
+		}
+	}
+
+	return opts, nil
+}
+
+// GetACRCredentials obtains an Azure AD token and exchanges it for a
+// refresh token of the registry at serverURL. The Azure AD token is either
+// requested from the managed identity of the host, if opts.UseMSI is set,
+// or read from the secret at path, which may hold
+//
+//   - an Azure AD token in its 'access_token' field, or
+//   - the 'client_id' and 'client_secret' of a service principal, such as
+//     one generated by the azure secrets engine, and optionally its
+//     'tenant_id', with which a token is requested from Azure AD.
+//
+// The lease duration of the returned credentials never exceeds the
+// expiration of the refresh token, which is also returned as their
+// expiration.
+func GetACRCredentials(
+	ctx context.Context,
+	path string,
+	client *api.Client,
+	serverURL string,
+	opts ACROptions,
+) (Credentials, error) {
+	host, ok := azureauth.RegistryHost(serverURL)
+	if !ok {
+		return Credentials{}, xerrors.Errorf("%q is not the host of an Azure Container Registry", serverURL)
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = clock.System()
+	}
+
+	var (
+		secret   = &api.Secret{}
+		fields   map[string]interface{}
+		aadToken azureauth.Token
+		tenantID = opts.TenantID
+		err      error
+	)
+
+	if opts.UseMSI {
+		aadToken, err = azureauth.ManagedIdentityToken(ctx, opts.HTTPClient, opts.Clock, opts.IMDSEndpoint,
+			opts.MSIClientID)
+		if err != nil {
+			return Credentials{}, xerrors.Errorf("error getting token of managed identity: %w", err)
+		}
+	} else {
+		secret, err = client.Logical().ReadWithContext(ctx, path)
+		if err != nil {
+			return Credentials{}, xerrors.Errorf("error reading secret: %w", err)
+		}
+
+		if secret == nil {
+			return Credentials{}, xerrors.Errorf("No secret found in Vault at path %q", path)
+		}
+
+		fields = secret.Data
+		if _, isKvv2 := secret.Data["metadata"].(map[string]interface{}); isKvv2 {
+			fields, _ = secret.Data["data"].(map[string]interface{})
+		}
+
+		if tenant, _ := fields["tenant_id"].(string); tenant != "" {
+			tenantID = tenant
+		}
+
+		aadToken, err = acrAADToken(ctx, fields, tenantID, opts)
+		if err != nil {
+			return Credentials{}, xerrors.Errorf("error getting Azure AD token from secret at path %q: %w", path, err)
+		}
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = azureauth.ExchangeEndpoint(host)
+	}
+
+	refreshToken, err := azureauth.ExchangeRefreshToken(ctx, opts.HTTPClient, endpoint, host, tenantID, aadToken)
+	if err != nil {
+		return Credentials{}, xerrors.Errorf("error getting ACR refresh token: %w", err)
+	}
+
+	leaseDuration := time.Duration(secret.LeaseDuration) * time.Second
+	if untilExpiry := refreshToken.Expires.Sub(opts.Clock.Now()); !refreshToken.Expires.IsZero() &&
+		(leaseDuration <= 0 || untilExpiry < leaseDuration) {
+		leaseDuration = untilExpiry
+	}
+
+	return Credentials{
+		Username: azureauth.RegistryUsername,
+		Password: refreshToken.Token,
+		Fields:   fields,
+
+		LeaseID:       secret.LeaseID,
+		LeaseDuration: leaseDuration,
+		Renewable:     secret.Renewable,
+		Expires:       refreshToken.Expires,
+	}, nil
+}
+
+// acrAADToken returns the Azure AD token in the fields of a secret or
+// requested with the service principal in them.
+func acrAADToken(
+	ctx context.Context,
+	fields map[string]interface{},
+	tenantID string,
+	opts ACROptions,
+) (azureauth.Token, error) {
+	if token, _ := fields["access_token"].(string); token != "" {
+		return azureauth.Token{Token: token}, nil
+	}
+
+	clientID, _ := fields["client_id"].(string)
+	clientSecret, _ := fields["client_secret"].(string)
+
+	if clientID == "" || clientSecret == "" {
+		return azureauth.Token{}, xerrors.New("secret contains neither an 'access_token' nor a 'client_id' and 'client_secret'")
+	}
+
+	if tenantID == "" {
+		return azureauth.Token{}, xerrors.New("no tenant of the service principal is set in 'tenant_id' or 'acr_tenant_id'")
+	}
+
+	return azureauth.ClientCredentialsToken(ctx, opts.HTTPClient, opts.Clock, opts.AuthorityHost, tenantID, clientID,
+		clientSecret)
+}
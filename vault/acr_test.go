@@ -0,0 +1,220 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestNewACROptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		expected *ACROptions
+		err      string
+	}{
+		{
+			name:   "not-set",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "disabled",
+			config: map[string]interface{}{"acr_token_mode": false},
+		},
+		{
+			name: "enabled",
+			config: map[string]interface{}{
+				"acr_token_mode": "true",
+				"acr_tenant_id":  "my-tenant",
+			},
+			expected: &ACROptions{TenantID: "my-tenant"},
+		},
+		{
+			name: "msi",
+			config: map[string]interface{}{
+				"acr_token_mode":    true,
+				"acr_use_msi":       "true",
+				"acr_msi_client_id": "identity-id",
+			},
+			expected: &ACROptions{UseMSI: true, MSIClientID: "identity-id"},
+		},
+		{
+			name:   "invalid",
+			config: map[string]interface{}{"acr_token_mode": "sometimes"},
+			err:    "'acr_token_mode' must be a boolean",
+		},
+		{
+			name:   "invalid-tenant",
+			config: map[string]interface{}{"acr_token_mode": true, "acr_tenant_id": 1},
+			err:    "'acr_tenant_id' must be a string",
+		},
+		{
+			name:   "invalid-msi",
+			config: map[string]interface{}{"acr_token_mode": true, "acr_use_msi": "maybe"},
+			err:    "'acr_use_msi' must be a boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewACROptions(tc.config)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, opts); diff != "" {
+				t.Fatalf("Options differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetACRCredentials(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/my-tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "app-id" || r.FormValue("client_secret") != "app-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client","error_description":"Invalid client secret."}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"access_token":"sp token","expires_in":3599}`)
+	})
+	mux.HandleFunc("/msi", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"msi token","expires_in":"3599"}`)
+	})
+	mux.HandleFunc("/oauth2/exchange", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"refresh_token":"refresh for %s"}`, r.FormValue("access_token"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithDynamicSecret("azure/creds/registry", map[string]interface{}{
+			"client_id":     "app-id",
+			"client_secret": "app-secret",
+		}, 2*time.Hour),
+		vaultlogintest.WithKVv2("secret/data/acr", map[string]interface{}{"access_token": "stored token"}),
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	opts := ACROptions{
+		TenantID:      "my-tenant",
+		AuthorityHost: server.URL,
+		IMDSEndpoint:  server.URL + "/msi",
+		Endpoint:      server.URL + "/oauth2/exchange",
+		HTTPClient:    server.Client(),
+	}
+
+	msiOpts := opts
+	msiOpts.UseMSI = true
+
+	cases := []struct {
+		name      string
+		path      string
+		serverURL string
+		opts      ACROptions
+		password  string
+		leased    bool
+		err       string
+	}{
+		{
+			name:     "service-principal",
+			path:     "azure/creds/registry",
+			password: "refresh for sp token",
+			leased:   true,
+		},
+		{
+			name:     "stored-token",
+			path:     "secret/data/acr",
+			password: "refresh for stored token",
+		},
+		{
+			name:     "msi",
+			path:     "secret/unused",
+			opts:     msiOpts,
+			password: "refresh for msi token",
+		},
+		{
+			name: "not-azure-credentials",
+			path: "secret/docker/creds",
+			err: `error getting Azure AD token from secret at path "secret/docker/creds": ` +
+				`secret contains neither an 'access_token' nor a 'client_id' and 'client_secret'`,
+		},
+		{
+			name:      "not-acr",
+			path:      "secret/data/acr",
+			serverURL: "docker.io",
+			err:       `"docker.io" is not the host of an Azure Container Registry`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.serverURL == "" {
+				tc.serverURL = "https://myregistry.azurecr.io"
+			}
+			if !tc.opts.UseMSI {
+				tc.opts = opts
+			}
+
+			creds, err := GetACRCredentials(context.Background(), tc.path, client, tc.serverURL, tc.opts)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if creds.Username != "00000000-0000-0000-0000-000000000000" || creds.Password != tc.password {
+				t.Fatalf("Expected credentials %q/%q, got %q/%q", "00000000-0000-0000-0000-000000000000",
+					tc.password, creds.Username, creds.Password)
+			}
+			if leased := creds.LeaseID != ""; leased != tc.leased {
+				t.Fatalf("Expected leased to be %v, got lease ID %q", tc.leased, creds.LeaseID)
+			}
+		})
+	}
+
+	if n := fake.Requests("secret/unused"); n != 0 {
+		t.Fatalf("Expected Vault not to be read with a managed identity, got %d reads", n)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+)
+
+const (
+	vaultAddressFile   = "vault-address"
+	healthCheckTimeout = 5 * time.Second
+)
+
+// Node is the address of a node of a highly available Vault cluster, with
+// the TLS settings which only apply to that node.
+type Node struct {
+	// Address is the address of the node.
+	Address string
+
+	// CACert is the path of a PEM bundle of the CA certificates by which
+	// the certificate of the node is verified instead of those of the
+	// client.
+	CACert string
+
+	// PinSHA256 are the base64-encoded SHA-256 hashes of public keys
+	// (subject public key info), one of which must be in the verified
+	// certificate chain of the node.
+	PinSHA256 []string
+}
+
+// hasTLS reports whether the node has TLS settings of its own.
+func (n Node) hasTLS() bool {
+	return n.CACert != "" || len(n.PinSHA256) > 0
+}
+
+// baseTLSConfigs maps the transport of every client whose nodes have TLS
+// settings of their own to the TLS configuration it was created with, from
+// which the configuration of each node is derived.
+var baseTLSConfigs sync.Map
+
+// SelectAddress gives the client the first of the nodes which is reachable,
+// initialized and unsealed according to sys/health. The node which was last
+// found to be healthy is checked first and its address is remembered in
+// the cache directory, if it is not empty. The TLS settings of the node,
+// if any, are applied to the client. Nothing is done if there are no nodes
+// or if VAULT_ADDR is set.
+func SelectAddress(
+	ctx context.Context,
+	client *api.Client,
+	nodes []Node,
+	cacheDir string,
+	logger hclog.Logger,
+) error {
+	if len(nodes) == 0 || os.Getenv(api.EnvVaultAddress) != "" {
+		return nil
+	}
+
+	path := ""
+	if cacheDir != "" {
+		path = filepath.Join(cacheDir, vaultAddressFile)
+	}
+
+	transport, base, err := nodeTransport(client, nodes)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]string, 0, len(nodes))
+
+	for _, node := range nodeOrder(nodes, readLastAddress(logger, path)) {
+		tlsConfig, err := nodeTLSConfig(base, node)
+		if err == nil {
+			err = checkHealth(ctx, client, node.Address, tlsConfig)
+		}
+
+		if err != nil {
+			logger.Warn("Vault node is unavailable; trying the next address", "address", node.Address, "error", err)
+			errs = append(errs, node.Address+": "+err.Error())
+
+			continue
+		}
+
+		if err = client.SetAddress(node.Address); err != nil {
+			return xerrors.Errorf("error setting Vault address: %w", err)
+		}
+
+		if transport != nil {
+			transport.TLSClientConfig = tlsConfig
+			transport.CloseIdleConnections()
+		}
+
+		saveLastAddress(logger, path, node.Address)
+
+		return nil
+	}
+
+	return xerrors.Errorf("no Vault node is available: %s", strings.Join(errs, "; "))
+}
+
+// nodeOrder returns the nodes with the last healthy one first.
+func nodeOrder(nodes []Node, last string) []Node {
+	order := make([]Node, 0, len(nodes))
+
+	for _, node := range nodes {
+		if node.Address == last {
+			order = append(order, node)
+		}
+	}
+
+	for _, node := range nodes {
+		if node.Address != last {
+			order = append(order, node)
+		}
+	}
+
+	return order
+}
+
+// nodeTransport returns the transport of the client and the TLS
+// configuration it was created with if any of the nodes has TLS settings
+// of its own. Otherwise, the transport is left as it is.
+func nodeTransport(client *api.Client, nodes []Node) (*http.Transport, *tls.Config, error) {
+	hasTLS := false
+	for _, node := range nodes {
+		hasTLS = hasTLS || node.hasTLS()
+	}
+
+	if !hasTLS {
+		return nil, nil, nil
+	}
+
+	transport, ok := client.CloneConfig().HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, nil, xerrors.Errorf("cannot configure the TLS settings of Vault nodes on a transport "+
+			"of type %T", client.CloneConfig().HttpClient.Transport)
+	}
+
+	base := transport.TLSClientConfig
+	if base == nil {
+		base = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	saved, _ := baseTLSConfigs.LoadOrStore(transport, base.Clone())
+
+	return transport, saved.(*tls.Config), nil
+}
+
+// nodeTLSConfig returns the TLS configuration of the node: the base
+// configuration with the CA bundle and pins of the node, if any. A nil base
+// means the transport is left as it is.
+func nodeTLSConfig(base *tls.Config, node Node) (*tls.Config, error) {
+	if base == nil {
+		return nil, nil
+	}
+
+	config := base.Clone()
+
+	if node.CACert != "" {
+		data, err := os.ReadFile(node.CACert)
+		if err != nil {
+			return nil, xerrors.Errorf("error reading CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, xerrors.Errorf("no CA certificates found in %s", node.CACert)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if len(node.PinSHA256) > 0 {
+		pins := node.PinSHA256
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPins(state, pins)
+		}
+	}
+
+	return config, nil
+}
+
+// verifyPins returns an error unless the hash of the public key of a
+// certificate of the verified chains is pinned. Without verified chains,
+// i.e. if TLS verification is disabled, only the leaf certificate counts.
+func verifyPins(state tls.ConnectionState, pins []string) error {
+	chains := state.VerifiedChains
+	if len(chains) == 0 && len(state.PeerCertificates) > 0 {
+		chains = [][]*x509.Certificate{state.PeerCertificates[:1]}
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			hash := base64.StdEncoding.EncodeToString(sum[:])
+
+			for _, pin := range pins {
+				if hash == pin {
+					return nil
+				}
+			}
+		}
+	}
+
+	return xerrors.New("the certificate of the Vault node matches none of the pinned public keys")
+}
+
+// checkHealth returns an error if the Vault node at the address is
+// unreachable, uninitialized or sealed. Standby nodes are healthy since
+// they forward requests to the active node. If tlsConfig is not nil, the
+// node is checked with it.
+func checkHealth(ctx context.Context, client *api.Client, addr string, tlsConfig *tls.Config) error {
+	// Clones share the transport, whose dialer is replaced by the address
+	// of a unix socket, so the clone is given a transport of its own
+	cloneConfig := client.CloneConfig()
+	if transport, ok := cloneConfig.HttpClient.Transport.(*http.Transport); ok {
+		transport = transport.Clone()
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+
+		cloneConfig.HttpClient.Transport = transport
+	}
+
+	clone, err := api.NewClient(cloneConfig)
+	if err != nil {
+		return err
+	}
+
+	if err = clone.SetAddress(addr); err != nil {
+		return err
+	}
+
+	// Don't wait for retries of a node which is down
+	clone.SetMaxRetries(0)
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	health, err := clone.Sys().HealthWithContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !health.Initialized:
+		return xerrors.New("Vault is not initialized")
+	case health.Sealed:
+		return xerrors.New("Vault is sealed")
+	}
+
+	return nil
+}
+
+func readLastAddress(logger hclog.Logger, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	data, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("error reading last healthy Vault address", "error", err)
+		}
+
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func saveLastAddress(logger hclog.Logger, path, addr string) {
+	if path == "" {
+		return
+	}
+
+	if err := os.WriteFile(path, []byte(addr+"\n"), 0o600); err != nil {
+		logger.Warn("error writing last healthy Vault address", "error", err)
+	}
+}
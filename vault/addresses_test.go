@@ -0,0 +1,382 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+)
+
+func healthHandler(initialized, sealed bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"initialized":%t,"sealed":%t}`, initialized, sealed) // nolint: errcheck
+	})
+}
+
+func newHealthServer(t *testing.T, initialized, sealed bool) string {
+	t.Helper()
+
+	srv := httptest.NewServer(healthHandler(initialized, sealed))
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+// newUnixHealthServer serves sys/health on a unix socket, as the listener
+// of a Vault agent may, and returns its unix:// address.
+func newUnixHealthServer(t *testing.T, initialized, sealed bool) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(healthHandler(initialized, sealed))
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return "unix://" + socket
+}
+
+func toNodes(addresses []string) []Node {
+	nodes := make([]Node, 0, len(addresses))
+	for _, addr := range addresses {
+		nodes = append(nodes, Node{Address: addr})
+	}
+
+	return nodes
+}
+
+// newTLSHealthServer serves sys/health over TLS with a certificate issued
+// by a CA of its own. It returns the address of the server, the path of
+// the CA certificate and the pin of the public key of the certificate.
+func newTLSHealthServer(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Vault CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(healthHandler(true, false))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	return srv.URL, caFile, base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestSelectAddress_NodeTLS(t *testing.T) {
+	t.Setenv(api.EnvVaultAddress, "")
+
+	primary, primaryCA, primaryPin := newTLSHealthServer(t)
+	dr, drCA, drPin := newTLSHealthServer(t)
+
+	cases := []struct {
+		name     string
+		nodes    []Node
+		expected string
+		err      string
+	}{
+		{
+			name:     "ca-cert",
+			nodes:    []Node{{Address: primary, CACert: primaryCA}, {Address: dr, CACert: drCA}},
+			expected: primary,
+		},
+		{
+			name:     "wrong-ca-cert",
+			nodes:    []Node{{Address: primary, CACert: drCA}, {Address: dr, CACert: drCA}},
+			expected: dr,
+		},
+		{
+			name:     "pin",
+			nodes:    []Node{{Address: dr, CACert: drCA, PinSHA256: []string{primaryPin, drPin}}},
+			expected: dr,
+		},
+		{
+			name:  "wrong-pin",
+			nodes: []Node{{Address: primary, CACert: primaryCA, PinSHA256: []string{drPin}}},
+			err:   "the certificate of the Vault node matches none of the pinned public keys",
+		},
+		{
+			name:  "no-ca-cert",
+			nodes: []Node{{Address: primary}, {Address: dr, PinSHA256: []string{drPin}}},
+			err:   "tls: failed to verify certificate: x509: certificate signed by unknown authority",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := api.NewClient(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client.SetMaxRetries(0)
+
+			err = SelectAddress(context.Background(), client, tc.nodes, "", hclog.NewNullLogger())
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if !strings.HasPrefix(err.Error(), "no Vault node is available: ") ||
+					!strings.HasSuffix(err.Error(), tc.err) {
+					t.Fatalf("Expected an error ending in %q, got %q", tc.err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if client.Address() != tc.expected {
+				t.Fatalf("Expected address %q, got %q", tc.expected, client.Address())
+			}
+
+			// The client itself verifies the node with its settings
+			if _, err = client.Sys().Health(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("fail-over", func(t *testing.T) {
+		client, err := api.NewClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client.SetMaxRetries(0)
+
+		nodes := []Node{{Address: primary, CACert: primaryCA}, {Address: dr, CACert: drCA}}
+		if err = SelectAddress(context.Background(), client, nodes, "", hclog.NewNullLogger()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Once the primary is gone, the DR node is verified with its own
+		// CA rather than that of the primary
+		if err = SelectAddress(context.Background(), client, nodes[1:], "", hclog.NewNullLogger()); err != nil {
+			t.Fatal(err)
+		}
+
+		if client.Address() != dr {
+			t.Fatalf("Expected address %q, got %q", dr, client.Address())
+		}
+
+		if _, err = client.Sys().Health(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSelectAddress(t *testing.T) {
+	t.Setenv(api.EnvVaultAddress, "")
+
+	healthy := newHealthServer(t, true, false)
+	other := newHealthServer(t, true, false)
+	sealed := newHealthServer(t, true, true)
+	uninitialized := newHealthServer(t, false, false)
+	sealedSocket := newUnixHealthServer(t, true, true)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	cases := []struct {
+		name      string
+		addresses []string
+		last      string
+		expected  string
+		err       string
+	}{
+		{
+			name:      "first-healthy",
+			addresses: []string{healthy, other},
+			expected:  healthy,
+		},
+		{
+			name:      "skips-unreachable",
+			addresses: []string{down.URL, healthy},
+			expected:  healthy,
+		},
+		{
+			name:      "skips-sealed-and-uninitialized",
+			addresses: []string{sealed, uninitialized, healthy},
+			expected:  healthy,
+		},
+		{
+			name:      "skips-sealed-unix-socket",
+			addresses: []string{sealedSocket, healthy},
+			expected:  healthy,
+		},
+		{
+			name:      "prefers-last-healthy",
+			addresses: []string{healthy, other},
+			last:      other,
+			expected:  other,
+		},
+		{
+			name:      "last-healthy-is-down",
+			addresses: []string{down.URL, healthy},
+			last:      down.URL,
+			expected:  healthy,
+		},
+		{
+			name:      "none-healthy",
+			addresses: []string{sealed},
+			err:       fmt.Sprintf("no Vault node is available: %s: Vault is sealed", sealed),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			path := filepath.Join(cacheDir, vaultAddressFile)
+
+			if tc.last != "" {
+				if err := os.WriteFile(path, []byte(tc.last+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client, err := api.NewClient(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = SelectAddress(context.Background(), client, toNodes(tc.addresses), cacheDir, hclog.NewNullLogger())
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if client.Address() != tc.expected {
+				t.Fatalf("Expected address %q, got %q", tc.expected, client.Address())
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(data)); got != tc.expected {
+				t.Fatalf("Expected remembered address %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSelectAddress_VaultAddrSet(t *testing.T) {
+	t.Setenv(api.EnvVaultAddress, "https://vault.example.com")
+
+	client, err := api.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := newHealthServer(t, true, true)
+	if err = SelectAddress(context.Background(), client, toNodes([]string{sealed}), "", hclog.NewNullLogger()); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Address() != "https://vault.example.com" {
+		t.Fatalf("Expected address %q, got %q", "https://vault.example.com", client.Address())
+	}
+}
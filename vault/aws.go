@@ -0,0 +1,207 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !awssdk
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/awsauth"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// awsMethod logs in with the aws auth method using the awsauth package
+// rather than the AWS SDK. It accepts the same configuration as the Vault
+// agent's aws method. Build with the awssdk tag to use the Vault agent's
+// implementation instead.
+type awsMethod struct {
+	logger    hclog.Logger
+	clock     clock.Clock
+	rand      clock.Rand
+	authType  string
+	mountPath string
+	role      string
+	serverID  string
+	region    string
+	endpoint  string
+	chain     awsauth.ChainOptions
+
+	mu    sync.Mutex
+	creds awsauth.Credentials
+	nonce string
+}
+
+// newAWSAuthMethod creates a new aws auth method from the method config.
+// Unless the nonce is configured, the nonce of the ec2 type is generated
+// and persisted to the file given by 'nonce_path' or to the cache
+// directory beforehand, as with the Vault agent's method.
+func newAWSAuthMethod(conf *auth.AuthConfig, opts MethodOptions) (auth.AuthMethod, error) { // nolint: gocyclo
+	opts = opts.withDefaults()
+
+	if conf == nil || conf.Config == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	config, err := normalizeAWSConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make(map[string]string)
+
+	for _, key := range []string{"type", "role", "access_key", "secret_key", "session_token",
+		"header_value", "nonce", "region", "sts_endpoint", "credential_source", "profile",
+		"shared_credentials_file", "web_identity_token_file", "web_identity_role_arn",
+		"assume_role_arn", "assume_role_external_id", "assume_role_session_name"} {
+		raw, ok := config[key]
+		if !ok {
+			continue
+		}
+
+		v, ok := raw.(string)
+		if !ok {
+			return nil, xerrors.Errorf("could not convert '%s' config value to string", key)
+		}
+
+		strs[key] = v
+	}
+
+	if endpoint := strs["sts_endpoint"]; endpoint != "" {
+		if err := awsauth.ValidateSTSEndpoint(endpoint); err != nil {
+			return nil, xerrors.Errorf("invalid 'sts_endpoint' config value: %w", err)
+		}
+	}
+
+	a := &awsMethod{
+		logger:    conf.Logger,
+		clock:     opts.Clock,
+		rand:      opts.Rand,
+		authType:  strs["type"],
+		mountPath: conf.MountPath,
+		role:      strs["role"],
+		serverID:  strs["header_value"],
+		region:    strs["region"],
+		endpoint:  strs["sts_endpoint"],
+		nonce:     strs["nonce"],
+		chain: awsauth.ChainOptions{
+			AccessKeyID:           strs["access_key"],
+			SecretAccessKey:       strs["secret_key"],
+			SessionToken:          strs["session_token"],
+			Region:                strs["region"],
+			STSEndpoint:           strs["sts_endpoint"],
+			Source:                strs["credential_source"],
+			Profile:               strs["profile"],
+			SharedCredentialsFile: strs["shared_credentials_file"],
+			WebIdentityTokenFile:  strs["web_identity_token_file"],
+			WebIdentityRoleARN:    strs["web_identity_role_arn"],
+			AssumeRoleARN:         strs["assume_role_arn"],
+			AssumeRoleExternalID:  strs["assume_role_external_id"],
+			AssumeRoleSessionName: strs["assume_role_session_name"],
+			Clock:                 opts.Clock,
+		},
+	}
+
+	switch {
+	case a.role == "":
+		return nil, xerrors.New("missing 'role' value")
+	case a.authType == "":
+		return nil, xerrors.New("missing 'type' value")
+	case a.authType != "iam" && a.authType != "ec2":
+		return nil, xerrors.New("'type' value is invalid")
+	}
+
+	if a.authType == "ec2" && a.nonce == "" {
+		if a.nonce, err = persistedNonce(config, opts.CacheDir, opts.Rand); err != nil {
+			return nil, err
+		}
+	}
+
+	// The credentials are resolved when the method authenticates, within
+	// the context of the login, but the options are checked here
+	if a.authType == "iam" {
+		if err = awsauth.ValidateSource(a.chain.Source); err != nil {
+			return nil, err
+		}
+
+		if a.chain.AssumeRoleARN != "" {
+			if err = awsauth.ValidateAssumeRole(a.chain.AssumeRoleARN, a.chain.AssumeRoleSessionName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// Authenticate returns the login data of the configured type.
+func (a *awsMethod) Authenticate(ctx context.Context, _ *api.Client) (string, http.Header, map[string]interface{}, error) { // nolint: lll
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var (
+		data map[string]interface{}
+		err  error
+	)
+
+	switch a.authType {
+	case "ec2":
+		if a.nonce == "" {
+			if a.nonce, err = generateNonce(a.rand); err != nil {
+				return "", nil, nil, err
+			}
+		}
+
+		data, err = awsauth.EC2LoginData(ctx, awsauth.NewMetadataClient(nil), a.nonce)
+		if err != nil {
+			return "", nil, nil, err
+		}
+	default:
+		if a.creds.AccessKeyID == "" || a.creds.Expired(a.clock.Now()) {
+			a.logger.Debug("resolving AWS credentials")
+
+			if a.creds, err = awsauth.ResolveCredentials(ctx, a.chain); err != nil {
+				return "", nil, nil, xerrors.Errorf("error resolving AWS credentials: %w", err)
+			}
+		}
+
+		data, err = awsauth.IAMLoginData(a.creds, a.serverID, a.region, a.endpoint, a.clock.Now())
+		if err != nil {
+			return "", nil, nil, xerrors.Errorf("error creating login value: %w", err)
+		}
+	}
+
+	data["role"] = a.role
+
+	return a.mountPath + "/login", nil, data, nil
+}
+
+// NewCreds returns nil since the helper resolves credentials whenever it
+// authenticates rather than watching them.
+func (a *awsMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+// CredSuccess does nothing.
+func (a *awsMethod) CredSuccess() {}
+
+// Shutdown does nothing.
+func (a *awsMethod) Shutdown() {}
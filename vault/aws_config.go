@@ -0,0 +1,73 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// awsConfigAliases maps alternative names of fields of the config of the
+// aws method, such as those which the aws auth method of Vault uses for the
+// fields of its roles and client config, to the names the helper uses.
+var awsConfigAliases = map[string]string{
+	"iam_server_id_header_value": "header_value",
+	"sts_region":                 "region",
+	"aws_role_arn":               "assume_role_arn",
+	"aws_role_session_name":      "assume_role_session_name",
+}
+
+// normalizeAWSConfig returns a copy of the config of the aws method in
+// which the aliases are replaced by the fields they stand for. Both
+// the built-in method and the Vault agent's method are created from the
+// copy, so that either accepts the aliases.
+func normalizeAWSConfig(config map[string]interface{}) (map[string]interface{}, error) {
+	normalized := make(map[string]interface{}, len(config))
+	for key, v := range config {
+		normalized[key] = v
+	}
+
+	for alias, key := range awsConfigAliases {
+		raw, ok := normalized[alias]
+		if !ok {
+			continue
+		}
+
+		v, ok := raw.(string)
+		if !ok {
+			return nil, xerrors.Errorf("could not convert '%s' config value to string", alias)
+		}
+
+		if other, ok := normalized[key]; ok && other != v {
+			return nil, xerrors.Errorf("'%s' and '%s' config values differ", key, alias)
+		}
+
+		normalized[key] = v
+		delete(normalized, alias)
+	}
+
+	// Vault compares the header of the signed request to the value of the
+	// role, so a value which cannot be sent as a header can never match
+	if v, ok := normalized["header_value"].(string); ok && strings.ContainsFunc(v, isControl) {
+		return nil, xerrors.New("'header_value' config value must not contain control characters")
+	}
+
+	return normalized, nil
+}
+
+// isControl reports whether r is not allowed in HTTP header values.
+func isControl(r rune) bool {
+	return (r < ' ' && r != '\t') || r == 0x7f
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNormalizeAWSConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name: "agent-fields",
+			config: map[string]interface{}{
+				"type":         "iam",
+				"header_value": "vault.example.com",
+				"region":       "eu-west-1",
+			},
+			expected: map[string]interface{}{
+				"type":         "iam",
+				"header_value": "vault.example.com",
+				"region":       "eu-west-1",
+			},
+		},
+		{
+			name: "aliases",
+			config: map[string]interface{}{
+				"type":                       "iam",
+				"iam_server_id_header_value": "vault.example.com",
+				"sts_region":                 "eu-west-1",
+			},
+			expected: map[string]interface{}{
+				"type":         "iam",
+				"header_value": "vault.example.com",
+				"region":       "eu-west-1",
+			},
+		},
+		{
+			name: "assume-role-aliases",
+			config: map[string]interface{}{
+				"aws_role_arn":          "arn:aws:iam::123456789012:role/registry",
+				"aws_role_session_name": "ci",
+			},
+			expected: map[string]interface{}{
+				"assume_role_arn":          "arn:aws:iam::123456789012:role/registry",
+				"assume_role_session_name": "ci",
+			},
+		},
+		{
+			name: "same-values",
+			config: map[string]interface{}{
+				"header_value":               "vault.example.com",
+				"iam_server_id_header_value": "vault.example.com",
+			},
+			expected: map[string]interface{}{
+				"header_value": "vault.example.com",
+			},
+		},
+		{
+			name: "conflicting-regions",
+			config: map[string]interface{}{
+				"region":     "eu-west-1",
+				"sts_region": "us-east-1",
+			},
+			err: "'region' and 'sts_region' config values differ",
+		},
+		{
+			name: "alias-not-string",
+			config: map[string]interface{}{
+				"iam_server_id_header_value": 1,
+			},
+			err: "could not convert 'iam_server_id_header_value' config value to string",
+		},
+		{
+			name: "header-value-newline",
+			config: map[string]interface{}{
+				"iam_server_id_header_value": "vault.example.com\r\nX-Injected: true",
+			},
+			err: "'header_value' config value must not contain control characters",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := normalizeAWSConfig(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expected, config); diff != "" {
+				t.Fatalf("Configs differ:\n%s", diff)
+			}
+		})
+	}
+}
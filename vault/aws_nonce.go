@@ -0,0 +1,120 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	uuid "github.com/hashicorp/go-uuid"
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+const awsNonceFile = "aws-ec2-nonce"
+
+// ec2NoncePath returns the path of the file in which the client nonce of
+// the ec2 type is persisted, so that the helper can reauthenticate with
+// the same nonce in later invocations. It is given by 'nonce_path' or
+// defaults to a file in the cache directory. If neither is set, the nonce
+// is not persisted and an empty path is returned.
+func ec2NoncePath(config map[string]interface{}, cacheDir string) (string, error) {
+	raw, ok := config["nonce_path"]
+	if !ok {
+		if cacheDir == "" {
+			return "", nil
+		}
+
+		return filepath.Join(cacheDir, awsNonceFile), nil
+	}
+
+	path, ok := raw.(string)
+	if !ok || path == "" {
+		return "", xerrors.New("'nonce_path' must be a non-empty string")
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", xerrors.Errorf("error expanding 'nonce_path' %s: %w", path, err)
+	}
+
+	return path, nil
+}
+
+// generateNonce returns a new client nonce of the ec2 type, a UUID read
+// from random.
+func generateNonce(random clock.Rand) (string, error) {
+	nonce, err := uuid.GenerateUUIDWithReader(random)
+	if err != nil {
+		return "", xerrors.Errorf("error generating nonce: %w", err)
+	}
+
+	return nonce, nil
+}
+
+// readNonce reads the persisted nonce. It returns an empty string if no
+// nonce has been persisted yet.
+func readNonce(path string) (string, error) {
+	data, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", xerrors.Errorf("error reading nonce file %s: %w", path, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeNonce persists the nonce, creating the parent directory of the file
+// if necessary.
+func writeNonce(path, nonce string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return xerrors.Errorf("error creating directory of nonce file %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, []byte(nonce), 0o600); err != nil {
+		return xerrors.Errorf("error writing nonce file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// persistedNonce returns the persisted nonce of the ec2 type, generating
+// one from random and persisting it first if necessary.
+func persistedNonce(config map[string]interface{}, cacheDir string, random clock.Rand) (string, error) {
+	path, err := ec2NoncePath(config, cacheDir)
+	if err != nil || path == "" {
+		return "", err
+	}
+
+	nonce, err := readNonce(path)
+	if err != nil || nonce != "" {
+		return nonce, err
+	}
+
+	if nonce, err = generateNonce(random); err != nil {
+		return "", err
+	}
+
+	if err = writeNonce(path, nonce); err != nil {
+		return "", err
+	}
+
+	return nonce, nil
+}
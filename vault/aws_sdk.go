@@ -0,0 +1,54 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build awssdk
+
+package vault
+
+import (
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth/aws"
+)
+
+// newAWSAuthMethod creates the Vault agent's aws auth method, which uses
+// the AWS SDK. The Vault agent's method keeps the nonce of the ec2 type in
+// memory, so unless the nonce is configured, it is generated and persisted
+// to the file given by 'nonce_path' or to the cache directory beforehand.
+func newAWSAuthMethod(conf *auth.AuthConfig, opts MethodOptions) (auth.AuthMethod, error) {
+	opts = opts.withDefaults()
+
+	if conf == nil || conf.Config == nil {
+		return aws.NewAWSAuthMethod(conf)
+	}
+
+	config, err := normalizeAWSConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config["type"] == "ec2" && config["nonce"] == nil {
+		nonce, err := persistedNonce(config, opts.CacheDir, opts.Rand)
+		if err != nil {
+			return nil, err
+		}
+
+		if nonce != "" {
+			config["nonce"] = nonce
+		}
+	}
+
+	normalized := *conf
+	normalized.Config = config
+
+	return aws.NewAWSAuthMethod(&normalized)
+}
@@ -0,0 +1,420 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !awssdk
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+
+	"github.com/morningconsult/docker-credential-vault-login/awsauth"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestAWSAuthMethod(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/dynamic/instance-identity/document":
+			w.Write([]byte(`{"instanceId":"i-1234567890abcdef0"}`)) // nolint: errcheck
+		case "/latest/dynamic/instance-identity/signature":
+			w.Write([]byte("signature")) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer imds.Close()
+
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+
+	credsFile := filepath.Join(t.TempDir(), "credentials")
+	profile := []byte("[dev]\naws_access_key_id = AKID\naws_secret_access_key = SECRET\n")
+	if err := os.WriteFile(credsFile, profile, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+		keys   []string
+	}{
+		{
+			name: "iam",
+			config: map[string]interface{}{
+				"type":         "iam",
+				"role":         "dev-role",
+				"access_key":   "AKID",
+				"secret_key":   "SECRET",
+				"header_value": "vault.example.com",
+			},
+			keys: []string{"iam_http_request_method", "iam_request_body", "iam_request_headers",
+				"iam_request_url", "role"},
+		},
+		{
+			name: "iam-profile",
+			config: map[string]interface{}{
+				"type":                    "iam",
+				"role":                    "dev-role",
+				"credential_source":       "profile",
+				"profile":                 "dev",
+				"shared_credentials_file": credsFile,
+			},
+			keys: []string{"iam_http_request_method", "iam_request_body", "iam_request_headers",
+				"iam_request_url", "role"},
+		},
+		{
+			name: "bad-credential-source",
+			config: map[string]interface{}{
+				"type":              "iam",
+				"role":              "dev-role",
+				"credential_source": "sso",
+			},
+			err: `unsupported credential source "sso": must be one of env, profile, web_identity, ecs or ec2`,
+		},
+		{
+			name: "bad-aws-role-arn",
+			config: map[string]interface{}{
+				"type":         "iam",
+				"role":         "dev-role",
+				"access_key":   "AKID",
+				"secret_key":   "SECRET",
+				"aws_role_arn": "registry",
+			},
+			err: `"registry" is not the ARN of an IAM role`,
+		},
+		{
+			name: "ec2",
+			config: map[string]interface{}{
+				"type":  "ec2",
+				"role":  "dev-role",
+				"nonce": "my-nonce",
+			},
+			keys: []string{"identity", "nonce", "role", "signature"},
+		},
+		{
+			name:   "no-role",
+			config: map[string]interface{}{"type": "iam"},
+			err:    "missing 'role' value",
+		},
+		{
+			name:   "bad-type",
+			config: map[string]interface{}{"type": "lambda", "role": "dev-role"},
+			err:    "'type' value is invalid",
+		},
+		{
+			name:   "not-string",
+			config: map[string]interface{}{"type": "iam", "role": "dev-role", "region": 1},
+			err:    "could not convert 'region' config value to string",
+		},
+		{
+			name: "bad-sts-endpoint",
+			config: map[string]interface{}{
+				"type":         "iam",
+				"role":         "dev-role",
+				"sts_endpoint": "sts.us-gov-west-1.amazonaws.com",
+			},
+			err: `invalid 'sts_endpoint' config value: STS endpoint "sts.us-gov-west-1.amazonaws.com" ` +
+				"is not an https:// URL",
+		},
+		{
+			name:   "bad-nonce-path",
+			config: map[string]interface{}{"type": "ec2", "role": "dev-role", "nonce_path": 1},
+			err:    "'nonce_path' must be a non-empty string",
+		},
+		{
+			name: "conflicting-header-values",
+			config: map[string]interface{}{
+				"type":                       "iam",
+				"role":                       "dev-role",
+				"header_value":               "vault.example.com",
+				"iam_server_id_header_value": "vault.example.org",
+			},
+			err: "'header_value' and 'iam_server_id_header_value' config values differ",
+		},
+	}
+
+	sortStrings := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method, err := newAWSAuthMethod(&auth.AuthConfig{
+				Logger:    hclog.NewNullLogger(),
+				MountPath: "auth/aws",
+				Config:    tc.config,
+			}, MethodOptions{})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer method.Shutdown()
+
+			path, _, data, err := method.Authenticate(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != "auth/aws/login" {
+				t.Errorf("Expected login path %s, got %s", "auth/aws/login", path)
+			}
+
+			keys := make([]string, 0, len(data))
+			for k := range data {
+				keys = append(keys, k)
+			}
+			if !cmp.Equal(tc.keys, keys, sortStrings) {
+				t.Errorf("Login data keys differ:\n%v", cmp.Diff(tc.keys, keys, sortStrings))
+			}
+			if data["role"] != "dev-role" {
+				t.Errorf("Expected role %s, got %v", "dev-role", data["role"])
+			}
+			if tc.config["nonce"] != nil && data["nonce"] != tc.config["nonce"] {
+				t.Errorf("Expected nonce %v, got %v", tc.config["nonce"], data["nonce"])
+			}
+		})
+	}
+}
+
+func TestAWSAuthMethod_Nonce(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"instanceId":"i-1234567890abcdef0"}`)) // nolint: errcheck
+	}))
+	defer imds.Close()
+
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+
+	// login authenticates with a new method and returns the nonce it sent
+	login := func(t *testing.T, config map[string]interface{}, cacheDir string) string {
+		method, err := newAWSAuthMethod(&auth.AuthConfig{
+			Logger:    hclog.NewNullLogger(),
+			MountPath: "auth/aws",
+			Config:    config,
+		}, MethodOptions{CacheDir: cacheDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer method.Shutdown()
+
+		_, _, data, err := method.Authenticate(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nonce, _ := data["nonce"].(string)
+		if nonce == "" {
+			t.Fatal("expected a nonce")
+		}
+
+		return nonce
+	}
+
+	config := map[string]interface{}{"type": "ec2", "role": "dev-role"}
+
+	t.Run("cache-dir", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		path := filepath.Join(cacheDir, awsNonceFile)
+
+		// The nonce is persisted before it is sent, without waiting for
+		// Vault to accept it, so that a process which exits right after
+		// logging in does not lose it
+		first := login(t, config, cacheDir)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != first {
+			t.Fatalf("Expected persisted nonce %q, got %q", first, data)
+		}
+
+		if second := login(t, config, cacheDir); second != first {
+			t.Fatalf("Expected the persisted nonce %q to be reused, got %q", first, second)
+		}
+	})
+
+	t.Run("rand", func(t *testing.T) {
+		nonces := make([]interface{}, 0, 2)
+
+		for i := 0; i < 2; i++ {
+			method, err := newAWSAuthMethod(&auth.AuthConfig{
+				Logger:    hclog.NewNullLogger(),
+				MountPath: "auth/aws",
+				Config:    config,
+			}, MethodOptions{Rand: clock.NewSeededRand(1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, data, err := method.Authenticate(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nonces = append(nonces, data["nonce"])
+		}
+
+		if nonces[0] != nonces[1] {
+			t.Fatalf("Expected the same seed to generate the same nonce, got %v", nonces)
+		}
+	})
+
+	t.Run("nonce-path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "aws", "nonce")
+
+		withPath := map[string]interface{}{"type": "ec2", "role": "dev-role", "nonce_path": path}
+
+		nonce := login(t, withPath, "")
+		if again := login(t, withPath, ""); again != nonce {
+			t.Fatalf("Expected the persisted nonce %q to be reused, got %q", nonce, again)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			t.Fatalf("Expected file mode 0600, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		cacheDir := t.TempDir()
+
+		withNonce := map[string]interface{}{"type": "ec2", "role": "dev-role", "nonce": "my-nonce"}
+		if nonce := login(t, withNonce, cacheDir); nonce != "my-nonce" {
+			t.Fatalf("Expected nonce %q, got %q", "my-nonce", nonce)
+		}
+
+		if _, err := os.Stat(filepath.Join(cacheDir, awsNonceFile)); !os.IsNotExist(err) {
+			t.Fatalf("Expected a configured nonce not to be persisted, got %v", err)
+		}
+	})
+
+	t.Run("no-cache-dir", func(t *testing.T) {
+		if login(t, config, "") == login(t, config, "") {
+			t.Fatal("expected a new nonce without a cache directory")
+		}
+	})
+}
+
+func TestAWSAuthMethod_STSEndpoint(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		url      string
+		region   string
+		serverID string
+	}{
+		{
+			name:   "global",
+			config: map[string]interface{}{"region": "us-east-1"},
+			url:    "https://sts.amazonaws.com/",
+			region: "us-east-1",
+		},
+		{
+			name:   "regional",
+			config: map[string]interface{}{"sts_region": "cn-north-1"},
+			url:    "https://sts.cn-north-1.amazonaws.com.cn/",
+			region: "cn-north-1",
+		},
+		{
+			name: "endpoint",
+			config: map[string]interface{}{
+				"region":                     "us-gov-west-1",
+				"sts_endpoint":               "https://vpce-0123.sts.us-gov-west-1.vpce.amazonaws.com",
+				"iam_server_id_header_value": "vault.example.com",
+			},
+			url:      "https://vpce-0123.sts.us-gov-west-1.vpce.amazonaws.com",
+			region:   "us-gov-west-1",
+			serverID: "vault.example.com",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := map[string]interface{}{
+				"type":       "iam",
+				"role":       "dev-role",
+				"access_key": "AKID",
+				"secret_key": "SECRET",
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			method, err := newAWSAuthMethod(&auth.AuthConfig{
+				Logger:    hclog.NewNullLogger(),
+				MountPath: "auth/aws",
+				Config:    config,
+			}, MethodOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, data, err := method.Authenticate(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			url, err := base64.StdEncoding.DecodeString(data["iam_request_url"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(url) != tc.url {
+				t.Errorf("Expected URL %s, got %s", tc.url, url)
+			}
+
+			rawHeaders, err := base64.StdEncoding.DecodeString(data["iam_request_headers"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var headers http.Header
+			if err = json.Unmarshal(rawHeaders, &headers); err != nil {
+				t.Fatal(err)
+			}
+
+			// The request is signed for the region, whatever the endpoint
+			if scope := "/" + tc.region + "/sts/"; !strings.Contains(headers.Get("Authorization"), scope) {
+				t.Errorf("Expected the request to be signed for %s, got %s", tc.region, headers.Get("Authorization"))
+			}
+
+			if got := headers.Get(awsauth.HeaderIAMServerID); got != tc.serverID {
+				t.Errorf("Expected %s header %q, got %q", awsauth.HeaderIAMServerID, tc.serverID, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+	"golang.org/x/xerrors"
+)
+
+// EnvWrappingToken is a single-use wrapping token from which the helper
+// bootstraps its credentials.
+const EnvWrappingToken = "DCVL_WRAPPING_TOKEN"
+
+// BootstrapOptions configure how the helper bootstraps its credentials
+// from a response-wrapped token or AppRole SecretID, such as one delivered
+// by an orchestration system.
+type BootstrapOptions struct {
+	// WrappingToken, if set, is the wrapping token itself. Otherwise, it
+	// is read from TokenFile, which is removed once it has been used.
+	WrappingToken string
+	TokenFile     string
+
+	// SecretIDFile is where an unwrapped SecretID is written, for the
+	// approle method to read it. It is empty unless the method is
+	// approle.
+	SecretIDFile string
+}
+
+// NewBootstrapOptions returns the options of the bootstrap from the
+// wrapping token set in DCVL_WRAPPING_TOKEN or in the file named by
+// 'wrapping_token_file' of the config of the method, or nil if neither is
+// set.
+func NewBootstrapOptions(method *config.Method) (*BootstrapOptions, error) {
+	opts := &BootstrapOptions{WrappingToken: strings.TrimSpace(os.Getenv(EnvWrappingToken))}
+
+	if raw, ok := method.Config["wrapping_token_file"]; ok {
+		file, ok := raw.(string)
+		if !ok || file == "" {
+			return nil, xerrors.New("'wrapping_token_file' must be a non-empty string")
+		}
+
+		opts.TokenFile = file
+	}
+
+	if opts.WrappingToken == "" && opts.TokenFile == "" {
+		return nil, nil
+	}
+
+	if method.Type == "approle" {
+		opts.SecretIDFile, _ = method.Config["secret_id_file_path"].(string)
+	}
+
+	return opts, nil
+}
+
+// Bootstrap unwraps the wrapping token with the client. If the wrapped
+// response holds a token, either as an auth response or in a 'token'
+// field, the token is returned. If it holds the 'secret_id' of an AppRole,
+// the SecretID is written to SecretIDFile so that the approle method logs
+// in with it, and no token is returned. Nothing is done if the token file
+// does not exist, e.g. because it was already used.
+func (o *BootstrapOptions) Bootstrap(client *api.Client) (string, error) {
+	wrappingToken := o.WrappingToken
+	if wrappingToken == "" {
+		data, err := os.ReadFile(o.TokenFile)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		if err != nil {
+			return "", xerrors.Errorf("error reading wrapping token: %w", err)
+		}
+
+		wrappingToken = strings.TrimSpace(string(data))
+	}
+
+	clone, err := client.Clone()
+	if err != nil {
+		return "", xerrors.Errorf("error cloning Vault client: %w", err)
+	}
+
+	// With no token of its own, the client unwraps with the wrapping token
+	clone.SetToken("")
+
+	secret, err := clone.Logical().Unwrap(wrappingToken)
+
+	// A wrapping token can only be used once, so it is removed unless
+	// Vault could not be reached
+	var respErr *api.ResponseError
+	if o.TokenFile != "" && (err == nil || xerrors.As(err, &respErr)) {
+		if rmErr := os.Remove(o.TokenFile); rmErr != nil && !os.IsNotExist(rmErr) {
+			return "", xerrors.Errorf("error removing wrapping token file: %w", rmErr)
+		}
+	}
+
+	if err != nil {
+		return "", xerrors.Errorf("error unwrapping wrapping token: %w", err)
+	}
+
+	if secret == nil {
+		return "", xerrors.New("wrapping token holds no response")
+	}
+
+	if secret.Auth != nil && secret.Auth.ClientToken != "" {
+		return secret.Auth.ClientToken, nil
+	}
+
+	if token, ok := secret.Data["token"].(string); ok && token != "" {
+		return token, nil
+	}
+
+	secretID, ok := secret.Data["secret_id"].(string)
+	if !ok || secretID == "" {
+		return "", xerrors.New("wrapped response holds neither a token nor a SecretID")
+	}
+
+	if o.SecretIDFile == "" {
+		return "", xerrors.New("wrapped response holds a SecretID, but the method is not approle " +
+			"or has no 'secret_id_file_path'")
+	}
+
+	if err = os.WriteFile(o.SecretIDFile, []byte(secretID), 0o600); err != nil {
+		return "", xerrors.Errorf("error writing SecretID: %w", err)
+	}
+
+	return "", nil
+}
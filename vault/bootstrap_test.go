@@ -0,0 +1,209 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestNewBootstrapOptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		env      string
+		method   *config.Method
+		expected *BootstrapOptions
+		err      string
+	}{
+		{
+			name:   "not-set",
+			method: &config.Method{Type: "approle", Config: map[string]interface{}{}},
+		},
+		{
+			name:     "env",
+			env:      " hvs.wrapping\n",
+			method:   &config.Method{Type: "userpass", Config: map[string]interface{}{}},
+			expected: &BootstrapOptions{WrappingToken: "hvs.wrapping"},
+		},
+		{
+			name: "file",
+			method: &config.Method{Type: "approle", Config: map[string]interface{}{
+				"wrapping_token_file": "/run/secrets/wrapping-token",
+				"secret_id_file_path": "/tmp/secret-id",
+			}},
+			expected: &BootstrapOptions{
+				TokenFile:    "/run/secrets/wrapping-token",
+				SecretIDFile: "/tmp/secret-id",
+			},
+		},
+		{
+			name: "empty-file",
+			method: &config.Method{Type: "approle", Config: map[string]interface{}{
+				"wrapping_token_file": "",
+			}},
+			err: "'wrapping_token_file' must be a non-empty string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvWrappingToken, tc.env)
+
+			opts, err := NewBootstrapOptions(tc.method)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, opts); diff != "" {
+				t.Fatalf("Options differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBootstrapOptions_Bootstrap(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t)
+	client := fake.Client()
+
+	t.Run("token", func(t *testing.T) {
+		wrappingToken, token := fake.WrapToken()
+
+		file := filepath.Join(t.TempDir(), "wrapping-token")
+		if err := os.WriteFile(file, []byte(wrappingToken+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		opts := &BootstrapOptions{TokenFile: file}
+
+		got, err := opts.Bootstrap(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != token {
+			t.Fatalf("Tokens differ:\n%v", cmp.Diff(token, got))
+		}
+		if _, err = os.Stat(file); !os.IsNotExist(err) {
+			t.Fatalf("Expected the wrapping token file to be removed, got %v", err)
+		}
+
+		// The file was used
+		if got, err = opts.Bootstrap(client); err != nil || got != "" {
+			t.Fatalf("Expected nothing to be done, got %q, %v", got, err)
+		}
+	})
+
+	t.Run("cubbyhole-token", func(t *testing.T) {
+		opts := &BootstrapOptions{WrappingToken: fake.WrapData(map[string]interface{}{"token": "hvs.stored"})}
+
+		got, err := opts.Bootstrap(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "hvs.stored" {
+			t.Fatalf("Tokens differ:\n%v", cmp.Diff("hvs.stored", got))
+		}
+	})
+
+	t.Run("secret-id", func(t *testing.T) {
+		secretIDFile := filepath.Join(t.TempDir(), "secret-id")
+		opts := &BootstrapOptions{
+			WrappingToken: fake.WrapData(map[string]interface{}{"secret_id": "secret-id", "secret_id_ttl": 600}),
+			SecretIDFile:  secretIDFile,
+		}
+
+		got, err := opts.Bootstrap(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "" {
+			t.Fatalf("Expected no token, got %q", got)
+		}
+
+		data, err := os.ReadFile(secretIDFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "secret-id" {
+			t.Fatalf("SecretIDs differ:\n%v", cmp.Diff("secret-id", string(data)))
+		}
+	})
+
+	errCases := []struct {
+		name string
+		opts func(t *testing.T) *BootstrapOptions
+		err  string
+	}{
+		{
+			name: "used-token",
+			opts: func(t *testing.T) *BootstrapOptions {
+				file := filepath.Join(t.TempDir(), "wrapping-token")
+				if err := os.WriteFile(file, []byte("hvs.used"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				return &BootstrapOptions{TokenFile: file}
+			},
+			err: "error unwrapping wrapping token: Error making API request.\n\n" +
+				"URL: PUT " + fake.Address() + "/v1/sys/wrapping/unwrap\n" +
+				"Code: 400. Errors:\n\n* wrapping token is not valid or does not exist",
+		},
+		{
+			name: "secret-id-without-approle",
+			opts: func(t *testing.T) *BootstrapOptions {
+				return &BootstrapOptions{WrappingToken: fake.WrapData(map[string]interface{}{"secret_id": "secret-id"})}
+			},
+			err: "wrapped response holds a SecretID, but the method is not approle or has no 'secret_id_file_path'",
+		},
+		{
+			name: "unknown-response",
+			opts: func(t *testing.T) *BootstrapOptions {
+				return &BootstrapOptions{WrappingToken: fake.WrapData(map[string]interface{}{"password": "hunter2"})}
+			},
+			err: "wrapped response holds neither a token nor a SecretID",
+		},
+	}
+
+	for _, tc := range errCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts(t)
+
+			_, err := opts.Bootstrap(client)
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if err.Error() != tc.err {
+				t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+			}
+			if opts.TokenFile != "" {
+				if _, err = os.Stat(opts.TokenFile); !os.IsNotExist(err) {
+					t.Fatalf("Expected the rejected wrapping token file to be removed, got %v", err)
+				}
+			}
+		})
+	}
+}
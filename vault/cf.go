@@ -0,0 +1,131 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault-plugin-auth-cf/signatures"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+const (
+	// EnvCFInstanceCert is the path of the instance identity certificate
+	// which CloudFoundry gives every container.
+	EnvCFInstanceCert = "CF_INSTANCE_CERT"
+
+	// EnvCFInstanceKey is the path of the private key of the instance
+	// identity certificate.
+	EnvCFInstanceKey = "CF_INSTANCE_KEY"
+)
+
+// cfMethod authenticates to the cf authentication method with the
+// instance identity certificate of the CloudFoundry container. Unlike the
+// cf method of the Vault agent, the paths of the certificate and key may
+// be configured for containers which don't inherit the environment of the
+// CloudFoundry task, such as a Docker daemon started by the task.
+type cfMethod struct {
+	logger    hclog.Logger
+	clock     clock.Clock
+	mountPath string
+	role      string
+	certFile  string
+	keyFile   string
+}
+
+func newCFAuthMethod(conf *auth.AuthConfig, clk clock.Clock) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	m := &cfMethod{
+		logger:    conf.Logger,
+		clock:     clk,
+		mountPath: conf.MountPath,
+		certFile:  os.Getenv(EnvCFInstanceCert),
+		keyFile:   os.Getenv(EnvCFInstanceKey),
+	}
+
+	for field, value := range map[string]*string{
+		"role":               &m.role,
+		"instance_cert_path": &m.certFile,
+		"instance_key_path":  &m.keyFile,
+	} {
+		raw, ok := conf.Config[field]
+		if !ok {
+			continue
+		}
+
+		s, ok := raw.(string)
+		if !ok || s == "" {
+			return nil, xerrors.Errorf("'%s' must be a non-empty string", field)
+		}
+
+		*value = s
+	}
+
+	if m.role == "" {
+		return nil, xerrors.New("'role' must be set")
+	}
+
+	return m, nil
+}
+
+// Authenticate signs the login request with the key of the instance
+// identity certificate. Both are read on every login, as CloudFoundry
+// rotates them while the container runs.
+func (m *cfMethod) Authenticate(context.Context, *api.Client) (string, http.Header, map[string]interface{}, error) {
+	if m.certFile == "" || m.keyFile == "" {
+		return "", nil, nil, xerrors.Errorf("no CloudFoundry instance identity: set %s and %s or the "+
+			"'instance_cert_path' and 'instance_key_path' config values", EnvCFInstanceCert, EnvCFInstanceKey)
+	}
+
+	cert, err := os.ReadFile(m.certFile)
+	if err != nil {
+		return "", nil, nil, xerrors.Errorf("error reading CloudFoundry instance certificate: %w", err)
+	}
+
+	signingTime := m.clock.Now().UTC()
+
+	signature, err := signatures.Sign(m.keyFile, &signatures.SignatureData{
+		SigningTime:            signingTime,
+		Role:                   m.role,
+		CFInstanceCertContents: string(cert),
+	})
+	if err != nil {
+		return "", nil, nil, xerrors.Errorf("error signing CloudFoundry login request: %w", err)
+	}
+
+	return m.mountPath + "/login", nil, map[string]interface{}{
+		"role":             m.role,
+		"cf_instance_cert": string(cert),
+		"signing_time":     signingTime.Format(signatures.TimeFormat),
+		"signature":        signature,
+	}, nil
+}
+
+func (m *cfMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *cfMethod) CredSuccess() {}
+
+func (m *cfMethod) Shutdown() {}
@@ -0,0 +1,192 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault-plugin-auth-cf/signatures"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestCFMethod_Authenticate(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "instance"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "instance"}},
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "instance.crt")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(dir, "instance.key")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		env    map[string]string
+		err    string
+	}{
+		{
+			name:   "env",
+			config: map[string]interface{}{"role": "docker"},
+			env:    map[string]string{EnvCFInstanceCert: certFile, EnvCFInstanceKey: keyFile},
+		},
+		{
+			name: "config",
+			config: map[string]interface{}{
+				"role":               "docker",
+				"instance_cert_path": certFile,
+				"instance_key_path":  keyFile,
+			},
+			env: map[string]string{EnvCFInstanceCert: filepath.Join(dir, "missing")},
+		},
+		{
+			name:   "no-identity",
+			config: map[string]interface{}{"role": "docker"},
+			err: "no CloudFoundry instance identity: set CF_INSTANCE_CERT and CF_INSTANCE_KEY or the " +
+				"'instance_cert_path' and 'instance_key_path' config values",
+		},
+		{
+			name:   "missing-cert",
+			config: map[string]interface{}{"role": "docker", "instance_key_path": keyFile},
+			env:    map[string]string{EnvCFInstanceCert: filepath.Join(dir, "missing")},
+			err: "error reading CloudFoundry instance certificate: open " + filepath.Join(dir, "missing") +
+				": no such file or directory",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvCFInstanceCert, tc.env[EnvCFInstanceCert])
+			t.Setenv(EnvCFInstanceKey, tc.env[EnvCFInstanceKey])
+
+			method, err := BuildAuthMethod(&config.Method{
+				Type:      "cf",
+				MountPath: "auth/cf",
+				Config:    tc.config,
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, _, data, err := method.Authenticate(context.Background(), nil)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if path != "auth/cf/login" {
+				t.Fatalf("Expected path %q, got %q", "auth/cf/login", path)
+			}
+
+			signingTime, err := time.Parse(signatures.TimeFormat, data["signing_time"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Vault verifies the signature with the instance certificate
+			if _, err = signatures.Verify(data["signature"].(string), &signatures.SignatureData{
+				SigningTime:            signingTime,
+				Role:                   data["role"].(string),
+				CFInstanceCertContents: data["cf_instance_cert"].(string),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNewCFAuthMethod(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "role",
+			config: map[string]interface{}{"role": "docker"},
+		},
+		{
+			name:   "no-role",
+			config: map[string]interface{}{},
+			err:    "error creating cf auth method: 'role' must be set",
+		},
+		{
+			name:   "bad-cert-path",
+			config: map[string]interface{}{"role": "docker", "instance_cert_path": 1},
+			err:    "error creating cf auth method: 'instance_cert_path' must be a non-empty string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := BuildAuthMethod(&config.Method{
+				Type:      "cf",
+				MountPath: "auth/cf",
+				Config:    tc.config,
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+)
+
+// BuildAuthMethodChain creates an authentication method which tries the
+// given methods in order until one of them succeeds. Methods which cannot
+// be created (e.g. because the host lacks the necessary credentials) are
+// skipped so that a single configuration file can be used on different
+// kinds of hosts. If only one method is given, it is returned as is.
+func BuildAuthMethodChain(methods []*config.Method, logger hclog.Logger, opts MethodOptions) (auth.AuthMethod, error) { // nolint: lll
+	opts = opts.withDefaults()
+
+	if len(methods) == 1 {
+		return BuildAuthMethod(methods[0], logger, opts)
+	}
+
+	names := make([]string, 0, len(methods))
+	built := make(map[string]auth.AuthMethod, len(methods))
+	errs := make([]string, 0, len(methods))
+	seen := make(map[string]bool, len(methods))
+
+	for _, m := range methods {
+		// Methods are identified by their mount path since the same type
+		// may be mounted more than once
+		name := m.MountPath
+		if m.Namespace != "" {
+			name = m.Namespace + name
+		}
+
+		if seen[name] {
+			return nil, xerrors.Errorf("auth method mounted at %q configured more than once", name)
+		}
+
+		seen[name] = true
+
+		method, err := BuildAuthMethod(m, logger, opts)
+		if err != nil {
+			logger.Warn("skipping auth method", "method", name, "error", err)
+			errs = append(errs, err.Error())
+
+			continue
+		}
+
+		names = append(names, name)
+		built[name] = method
+	}
+
+	if len(built) == 0 {
+		return nil, xerrors.Errorf("no auth method could be created: %s", strings.Join(errs, "; "))
+	}
+
+	return newFailoverMethod(logger.Named("auth.chain"), opts.Clock, names, built, 1, 0, ""), nil
+}
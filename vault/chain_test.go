@@ -0,0 +1,117 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestBuildAuthMethodChain(t *testing.T) {
+	approle := &config.Method{
+		Type:      "approle",
+		MountPath: "auth/approle",
+		Config: map[string]interface{}{
+			"role_id_file_path":   "/tmp/role-id",
+			"secret_id_file_path": "/tmp/secret-id",
+		},
+	}
+	tokenFile := &config.Method{
+		Type:      "token_file",
+		MountPath: "auth/token",
+		Config:    map[string]interface{}{"token_file_path": "/tmp/token"},
+	}
+	broken := &config.Method{
+		Type:      "token_file",
+		MountPath: "auth/token_file",
+		Config:    map[string]interface{}{},
+	}
+
+	cases := []struct {
+		name    string
+		methods []*config.Method
+		chain   []string
+		err     string
+	}{
+		{
+			name:    "single-method",
+			methods: []*config.Method{approle},
+		},
+		{
+			name:    "chain",
+			methods: []*config.Method{tokenFile, approle},
+			chain:   []string{"auth/token", "auth/approle"},
+		},
+		{
+			name:    "skips-broken-methods",
+			methods: []*config.Method{broken, approle},
+			chain:   []string{"auth/approle"},
+		},
+		{
+			name: "namespaced",
+			methods: []*config.Method{
+				approle,
+				{Type: "approle", MountPath: "auth/approle", Namespace: "ns1/", Config: approle.Config},
+			},
+			chain: []string{"auth/approle", "ns1/auth/approle"},
+		},
+		{
+			name:    "duplicate-mount-path",
+			methods: []*config.Method{approle, tokenFile, approle},
+			err:     `auth method mounted at "auth/approle" configured more than once`,
+		},
+		{
+			name:    "none-available",
+			methods: []*config.Method{broken, {Type: "foo", MountPath: "auth/foo"}},
+			err: "no auth method could be created: error creating token_file auth method: " +
+				"missing 'token_file_path' value; unknown auth method \"foo\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method, err := BuildAuthMethodChain(tc.methods, hclog.NewNullLogger(), MethodOptions{})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer method.Shutdown()
+
+			chain, ok := method.(*failoverMethod)
+			if tc.chain == nil {
+				if ok {
+					t.Fatal("expected a single method to be returned as is")
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected a chain, got %T", method)
+			}
+			if !cmp.Equal(tc.chain, chain.names) {
+				t.Fatalf("Chains differ:\n%v", cmp.Diff(tc.chain, chain.names))
+			}
+		})
+	}
+}
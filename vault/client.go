@@ -17,6 +17,9 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/api"
@@ -24,54 +27,103 @@ import (
 	"github.com/hashicorp/vault/command/agentproxyshared/auth"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth/alicloud"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth/approle"
-	"github.com/hashicorp/vault/command/agentproxyshared/auth/aws"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth/azure"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth/cert"
-	"github.com/hashicorp/vault/command/agentproxyshared/auth/cf"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth/gcp"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth/jwt"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth/kubernetes"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth/ldap"
+	tokenfile "github.com/hashicorp/vault/command/agentproxyshared/auth/token-file"
 	"github.com/hashicorp/vault/command/agentproxyshared/sink"
 	"github.com/hashicorp/vault/command/agentproxyshared/sink/file"
+	homedir "github.com/mitchellh/go-homedir"
 	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
 )
 
-// NewClient creates a new Vault client. Note that Vault environment
-// variables take precedence over the vaultConfig.
-func NewClient( // nolint: gocyclo, gocognit
+// defaultTokenFile is the file, relative to the home directory, in which
+// the Vault CLI stores the token after "vault login".
+const defaultTokenFile = ".vault-token"
+
+// Environment variables which override the address and TLS settings of
+// the 'vault' stanza. Unlike their VAULT_* counterparts, they only affect
+// the helper.
+const (
+	EnvAddress       = "DCVL_VAULT_ADDR"
+	EnvCACert        = "DCVL_CA_CERT"
+	EnvCAPath        = "DCVL_CA_PATH"
+	EnvClientCert    = "DCVL_CLIENT_CERT"
+	EnvClientKey     = "DCVL_CLIENT_KEY"
+	EnvTLSServerName = "DCVL_TLS_SERVER_NAME"
+	EnvTLSSkipVerify = "DCVL_TLS_SKIP_VERIFY"
+)
+
+// clientSetting is a Vault client setting which can be given in the
+// 'vault' stanza, in a VAULT_* environment variable read by the Vault API,
+// or in a DCVL_* environment variable.
+type clientSetting struct {
+	vaultEnv string
+	override string
+	value    string
+}
+
+// NewClient creates a new Vault client. Settings are taken from the first
+// of the following that is set: the DCVL_* environment variables, the
+// Vault environment variables, or the vaultConfig. Requests are sent
+// through the proxy configured in the auth method config, if any (see
+// NewProxyOptions), and time out after its 'vault_request_timeout' unless
+// VAULT_CLIENT_TIMEOUT is set.
+func NewClient(
 	methodConfig *config.Method,
 	vaultConfig *config.Vault,
 ) (*api.Client, error) {
-	if vaultConfig != nil {
-		if os.Getenv(api.EnvVaultAddress) == "" && vaultConfig.Address != "" {
-			os.Setenv(api.EnvVaultAddress, vaultConfig.Address) //nolint:errcheck
-			defer os.Unsetenv(api.EnvVaultAddress)              //nolint:errcheck
-		}
+	if vaultConfig == nil {
+		vaultConfig = &config.Vault{}
+	}
 
-		if os.Getenv(api.EnvVaultCACert) == "" && vaultConfig.CACert != "" {
-			os.Setenv(api.EnvVaultCACert, vaultConfig.CACert) //nolint:errcheck
-			defer os.Unsetenv(api.EnvVaultCACert)             //nolint:errcheck
-		}
+	skipVerify := ""
+	if vaultConfig.TLSSkipVerifyRaw != nil {
+		skipVerify = fmt.Sprintf("%t", vaultConfig.TLSSkipVerify)
+	}
 
-		if os.Getenv(api.EnvVaultCAPath) == "" && vaultConfig.CAPath != "" {
-			os.Setenv(api.EnvVaultCAPath, vaultConfig.CAPath) //nolint:errcheck
-			defer os.Unsetenv(api.EnvVaultCAPath)             //nolint:errcheck
-		}
+	timeout, err := RequestTimeout(methodConfig.Config)
+	if err != nil {
+		return nil, err
+	}
 
-		if os.Getenv(api.EnvVaultSkipVerify) == "" && vaultConfig.TLSSkipVerifyRaw != nil {
-			os.Setenv(api.EnvVaultSkipVerify, fmt.Sprintf("%t", vaultConfig.TLSSkipVerify)) //nolint:errcheck
-			defer os.Unsetenv(api.EnvVaultSkipVerify)                                       //nolint:errcheck
-		}
+	clientTimeout := ""
+	if timeout > 0 {
+		clientTimeout = timeout.String()
+	}
+
+	settings := []clientSetting{
+		{vaultEnv: api.EnvVaultAddress, override: EnvAddress, value: vaultConfig.Address},
+		{vaultEnv: api.EnvVaultCACert, override: EnvCACert, value: vaultConfig.CACert},
+		{vaultEnv: api.EnvVaultCAPath, override: EnvCAPath, value: vaultConfig.CAPath},
+		{vaultEnv: api.EnvVaultClientCert, override: EnvClientCert, value: vaultConfig.ClientCert},
+		{vaultEnv: api.EnvVaultClientKey, override: EnvClientKey, value: vaultConfig.ClientKey},
+		{vaultEnv: api.EnvVaultTLSServerName, override: EnvTLSServerName, value: vaultConfig.TLSServerName},
+		{vaultEnv: api.EnvVaultSkipVerify, override: EnvTLSSkipVerify, value: skipVerify},
+		{vaultEnv: api.EnvVaultClientTimeout, value: clientTimeout},
+	}
 
-		if os.Getenv(api.EnvVaultClientCert) == "" && vaultConfig.ClientCert != "" {
-			os.Setenv(api.EnvVaultClientCert, vaultConfig.ClientCert) //nolint:errcheck
-			defer os.Unsetenv(api.EnvVaultClientCert)                 //nolint:errcheck
+	// The Vault API only reads these settings from the environment, so
+	// they are set for the duration of this function
+	for _, s := range settings {
+		value := s.value
+
+		if v := os.Getenv(s.override); s.override != "" && v != "" {
+			value = v
+		} else if os.Getenv(s.vaultEnv) != "" {
+			continue
 		}
 
-		if os.Getenv(api.EnvVaultClientKey) == "" && vaultConfig.ClientKey != "" {
-			os.Setenv(api.EnvVaultClientKey, vaultConfig.ClientKey) //nolint:errcheck
-			defer os.Unsetenv(api.EnvVaultClientKey)                //nolint:errcheck
+		if value == "" {
+			continue
 		}
+
+		defer setEnv(s.vaultEnv, value)()
 	}
 
 	clientConfig := api.DefaultConfig()
@@ -79,6 +131,15 @@ func NewClient( // nolint: gocyclo, gocognit
 		return nil, clientConfig.Error
 	}
 
+	proxy, err := NewProxyOptions(methodConfig.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = configureProxy(clientConfig, proxy); err != nil {
+		return nil, err
+	}
+
 	client, err := api.NewClient(clientConfig)
 	if err != nil {
 		return nil, err
@@ -87,26 +148,43 @@ func NewClient( // nolint: gocyclo, gocognit
 	return configureToken(client, methodConfig)
 }
 
-func configureToken(client *api.Client, methodConfig *config.Method) (*api.Client, error) {
+// configureToken gives the client a token if the token method is used. The
+// token is read from the first of the following that is set: the
+// VAULT_TOKEN environment variable, the 'token' config value, the file
+// given by the 'token_file_path' config value, or ~/.vault-token.
+func configureToken(client *api.Client, methodConfig *config.Method) (*api.Client, error) { // nolint: gocyclo
 	switch methodConfig.Type {
 	case "token":
-		if client.Token() == "" {
-			tokenRaw, ok := methodConfig.Config["token"]
-			if !ok {
-				return nil, xerrors.New("missing 'auto_auth.method.config.token' value")
-			}
+		if client.Token() != "" {
+			break
+		}
 
-			token, ok := tokenRaw.(string)
-			if !ok {
-				return nil, xerrors.New("could not convert 'auto_auth.method.config.token' config value to string")
+		tokenRaw, ok := methodConfig.Config["token"]
+		if !ok {
+			token, err := readTokenFile(methodConfig.Config)
+			if err != nil {
+				return nil, err
 			}
 
 			if token == "" {
-				return nil, xerrors.New("'auto_auth.method.config.token' value is empty")
+				return nil, xerrors.New("missing 'auto_auth.method.config.token' value")
 			}
 
 			client.SetToken(token)
+
+			break
+		}
+
+		token, ok := tokenRaw.(string)
+		if !ok {
+			return nil, xerrors.New("could not convert 'auto_auth.method.config.token' config value to string")
 		}
+
+		if token == "" {
+			return nil, xerrors.New("'auto_auth.method.config.token' value is empty")
+		}
+
+		client.SetToken(token)
 	default:
 		client.ClearToken()
 	}
@@ -114,6 +192,73 @@ func configureToken(client *api.Client, methodConfig *config.Method) (*api.Clien
 	return client, nil
 }
 
+// setEnv sets the environment variable and returns a function which
+// restores its previous value.
+func setEnv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value) //nolint:errcheck
+
+	return func() {
+		if ok {
+			os.Setenv(key, old) //nolint:errcheck
+		} else {
+			os.Unsetenv(key) //nolint:errcheck
+		}
+	}
+}
+
+// readTokenFile reads the token from the file given by the
+// 'token_file_path' config value or, if it is not set, from
+// ~/.vault-token (%USERPROFILE%\.vault-token on Windows unless HOME is
+// set). It returns an empty token if the value is not set and
+// ~/.vault-token does not exist.
+func readTokenFile(methodConfig map[string]interface{}) (string, error) {
+	pathRaw, ok := methodConfig["token_file_path"]
+	if !ok {
+		home := os.Getenv("HOME")
+		if home == "" && runtime.GOOS == "windows" {
+			home = os.Getenv("USERPROFILE")
+		}
+
+		if home == "" {
+			return "", nil
+		}
+
+		data, err := os.ReadFile(filepath.Join(home, defaultTokenFile)) // nolint: gosec
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		if err != nil {
+			return "", xerrors.Errorf("error reading token file: %w", err)
+		}
+
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	path, ok := pathRaw.(string)
+	if !ok {
+		return "", xerrors.New("could not convert 'auto_auth.method.config.token_file_path' config value to string")
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", xerrors.Errorf("error expanding token file path %s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return "", xerrors.Errorf("error reading token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", xerrors.Errorf("token file %s is empty", path)
+	}
+
+	return token, nil
+}
+
 // BuildSinks creates a set of sinks from the sink configurations.
 func BuildSinks(sc []*config.Sink, logger hclog.Logger, client *api.Client) ([]*sink.SinkConfig, error) {
 	sinks := make([]*sink.SinkConfig, 0, len(sc))
@@ -146,8 +291,38 @@ func BuildSinks(sc []*config.Sink, logger hclog.Logger, client *api.Client) ([]*
 	return sinks, nil
 }
 
+// MethodOptions configures the authentication methods created by
+// BuildAuthMethod.
+type MethodOptions struct {
+	// CacheDir is the directory in which state is persisted between
+	// invocations. If it is empty, no state is persisted.
+	CacheDir string
+
+	// Clock and Rand, if set, are the clock and the randomness of the
+	// methods, such as those of signing times, nonces and failover holds.
+	// Otherwise, the system clock and randomness are used.
+	Clock clock.Clock
+	Rand  clock.Rand
+}
+
+// withDefaults returns the options with the system clock and randomness
+// in place of those which are not set.
+func (o MethodOptions) withDefaults() MethodOptions {
+	if o.Clock == nil {
+		o.Clock = clock.System()
+	}
+
+	if o.Rand == nil {
+		o.Rand = clock.SystemRand()
+	}
+
+	return o
+}
+
 // BuildAuthMethod creates a new authentication method from config.
-func BuildAuthMethod(config *config.Method, logger hclog.Logger) (auth.AuthMethod, error) { // nolint: gocyclo
+func BuildAuthMethod(config *config.Method, logger hclog.Logger, opts MethodOptions) (auth.AuthMethod, error) { // nolint: gocyclo, lll
+	opts = opts.withDefaults()
+
 	// Check if a default namespace has been set
 	mountPath := config.MountPath
 	if config.Namespace != "" {
@@ -169,21 +344,51 @@ func BuildAuthMethod(config *config.Method, logger hclog.Logger) (auth.AuthMetho
 	case "alicloud":
 		method, err = alicloud.NewAliCloudAuthMethod(authConfig)
 	case "aws":
-		method, err = aws.NewAWSAuthMethod(authConfig)
+		if _, ok := authConfig.Config["fallback_type"]; ok {
+			method, err = newAWSFailoverMethod(authConfig, opts)
+		} else {
+			method, err = newAWSAuthMethod(authConfig, opts)
+		}
+
+		if err == nil {
+			method, err = withLoginMetadata(method, authConfig.Config)
+		}
 	case "azure":
 		method, err = azure.NewAzureAuthMethod(authConfig)
 	case "cert":
 		method, err = cert.NewCertAuthMethod(authConfig)
 	case "cf":
-		method, err = cf.NewCFAuthMethod(authConfig)
+		method, err = newCFAuthMethod(authConfig, opts.Clock)
 	case "gcp":
 		method, err = gcp.NewGCPAuthMethod(authConfig)
+	case "github":
+		method, err = newGitHubAuthMethod(authConfig)
 	case "jwt":
 		method, err = jwt.NewJWTAuthMethod(authConfig)
 	case "kubernetes":
 		method, err = kubernetes.NewKubernetesAuthMethod(authConfig)
+	case "ldap":
+		// Preserve compatibility with the Vault agent's ldap method, which
+		// reads the password from a file
+		if _, ok := authConfig.Config["password_file_path"]; ok {
+			method, err = ldap.NewLdapAuthMethod(authConfig)
+		} else {
+			method, err = newPasswordAuthMethod(authConfig)
+		}
+	case "oci":
+		method, err = newOCIAuthMethod(authConfig, opts.Clock)
+	case "oidc":
+		method, err = newOIDCAuthMethod(authConfig)
+	case "userpass":
+		method, err = newPasswordAuthMethod(authConfig)
 	case "approle":
 		method, err = approle.NewApproleAuthMethod(authConfig)
+	case "token_file":
+		method, err = tokenfile.NewTokenFileAuthMethod(authConfig)
+	case "exec":
+		method, err = newExecAuthMethod(authConfig)
+	case "spiffe":
+		method, err = newSPIFFEAuthMethod(authConfig)
 	default:
 		return nil, xerrors.Errorf("unknown auth method %q", config.Type)
 	}
@@ -14,9 +14,15 @@
 package vault
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	hclog "github.com/hashicorp/go-hclog"
@@ -180,6 +186,45 @@ func TestBuildAuthMethod(t *testing.T) {
 			},
 			"",
 		},
+		{
+			"ldap",
+			&config.Method{
+				Type: "ldap",
+				Config: map[string]interface{}{
+					"username": "jdoe",
+				},
+			},
+			"",
+		},
+		{
+			"ldap-password-file",
+			&config.Method{
+				Type: "ldap",
+				Config: map[string]interface{}{
+					"username":           "jdoe",
+					"password_file_path": "path/to/password",
+				},
+			},
+			"",
+		},
+		{
+			"userpass",
+			&config.Method{
+				Type:   "userpass",
+				Config: map[string]interface{}{},
+			},
+			"",
+		},
+		{
+			"token_file",
+			&config.Method{
+				Type: "token_file",
+				Config: map[string]interface{}{
+					"token_file_path": "path/to/token",
+				},
+			},
+			"",
+		},
 		{
 			"unknown",
 			&config.Method{
@@ -200,7 +245,7 @@ func TestBuildAuthMethod(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := BuildAuthMethod(tc.config, logger)
+			_, err := BuildAuthMethod(tc.config, logger, MethodOptions{})
 			if tc.err != "" {
 				if err == nil {
 					t.Fatal("expected an error but didn't receive one")
@@ -223,6 +268,19 @@ func TestNewVaultClient(t *testing.T) {
 
 	testToken := randomUUID(t)
 
+	home := t.TempDir()
+	tokenFile := filepath.Join(home, "token")
+	if err := os.WriteFile(tokenFile, []byte(testToken+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyTokenFile := filepath.Join(home, "empty-token")
+	if err := os.WriteFile(emptyTokenFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".vault-token"), []byte(testToken), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
 	cases := []struct {
 		name   string
 		env    map[string]string
@@ -260,6 +318,93 @@ func TestNewVaultClient(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:   "tls-settings-from-config",
+			env:    map[string]string{},
+			method: &config.Method{Type: "aws"},
+			vault: &config.Vault{
+				TLSServerName:    "vault.example.com",
+				TLSSkipVerify:    true,
+				TLSSkipVerifyRaw: "true",
+			},
+			post: func(c *api.Client) {
+				tlsConfig := clientTLSConfig(t, c)
+				if tlsConfig.ServerName != "vault.example.com" {
+					t.Errorf("Expected TLS server name %s, got %s", "vault.example.com", tlsConfig.ServerName)
+				}
+				if !tlsConfig.InsecureSkipVerify {
+					t.Error("Expected TLS verification to be skipped")
+				}
+				if v, ok := os.LookupEnv(api.EnvVaultTLSServerName); ok {
+					t.Errorf("Expected %s to be unset, got %q", api.EnvVaultTLSServerName, v)
+				}
+			},
+		},
+		{
+			name: "tls-settings-override-precedence",
+			env: map[string]string{
+				api.EnvVaultTLSServerName: "vault-env.example.com",
+				EnvTLSServerName:          "dcvl-env.example.com",
+				EnvTLSSkipVerify:          "false",
+			},
+			method: &config.Method{Type: "aws"},
+			vault: &config.Vault{
+				TLSServerName:    "vault.example.com",
+				TLSSkipVerify:    true,
+				TLSSkipVerifyRaw: "true",
+			},
+			post: func(c *api.Client) {
+				tlsConfig := clientTLSConfig(t, c)
+				if tlsConfig.ServerName != "dcvl-env.example.com" {
+					t.Errorf("Expected TLS server name %s, got %s", "dcvl-env.example.com", tlsConfig.ServerName)
+				}
+				if tlsConfig.InsecureSkipVerify {
+					t.Error("Expected TLS verification not to be skipped")
+				}
+				if v := os.Getenv(api.EnvVaultTLSServerName); v != "vault-env.example.com" {
+					t.Errorf("Expected %s to be restored to %q, got %q", api.EnvVaultTLSServerName,
+						"vault-env.example.com", v)
+				}
+			},
+		},
+		{
+			name: "vault-env-precedence-over-config",
+			env: map[string]string{
+				api.EnvVaultTLSServerName: "vault-env.example.com",
+			},
+			method: &config.Method{Type: "aws"},
+			vault:  &config.Vault{TLSServerName: "vault.example.com"},
+			post: func(c *api.Client) {
+				if name := clientTLSConfig(t, c).ServerName; name != "vault-env.example.com" {
+					t.Errorf("Expected TLS server name %s, got %s", "vault-env.example.com", name)
+				}
+			},
+		},
+		{
+			name: "address-override-precedence-over-vault-env",
+			env: map[string]string{
+				EnvAddress:          "https://dcvl.example.com:8200",
+				api.EnvVaultAddress: "https://vault-env.example.com:8200",
+			},
+			method: &config.Method{Type: "aws"},
+			vault:  &config.Vault{Address: "https://vault.example.com:8200"},
+			post: func(c *api.Client) {
+				if addr := c.Address(); addr != "https://dcvl.example.com:8200" {
+					t.Errorf("Expected address %s, got %s", "https://dcvl.example.com:8200", addr)
+				}
+			},
+		},
+		{
+			name: "ca-cert-override-doesnt-exist",
+			env: map[string]string{
+				EnvCACert: filepath.Join(home, "nonexistent.pem"),
+			},
+			method: &config.Method{Type: "aws"},
+			vault:  &config.Vault{},
+			err: fmt.Sprintf("Error loading CA File: open %s: no such file or directory",
+				filepath.Join(home, "nonexistent.pem")),
+			post: func(*api.Client) {},
+		},
 		{
 			name:   "clears-token-if-not-token-auth",
 			env:    map[string]string{},
@@ -272,6 +417,50 @@ func TestNewVaultClient(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "request-timeout-from-config",
+			env:  map[string]string{},
+			method: &config.Method{
+				Type:   "aws",
+				Config: map[string]interface{}{"vault_request_timeout": "5s"},
+			},
+			vault: &config.Vault{},
+			post: func(c *api.Client) {
+				if timeout := c.ClientTimeout(); timeout != 5*time.Second {
+					t.Errorf("Expected client timeout %s, got %s", 5*time.Second, timeout)
+				}
+				if v, ok := os.LookupEnv(api.EnvVaultClientTimeout); ok {
+					t.Errorf("Expected %s to be unset, got %q", api.EnvVaultClientTimeout, v)
+				}
+			},
+		},
+		{
+			name: "request-timeout-env-precedence",
+			env: map[string]string{
+				api.EnvVaultClientTimeout: "10",
+			},
+			method: &config.Method{
+				Type:   "aws",
+				Config: map[string]interface{}{"vault_request_timeout": "5s"},
+			},
+			vault: &config.Vault{},
+			post: func(c *api.Client) {
+				if timeout := c.ClientTimeout(); timeout != 10*time.Second {
+					t.Errorf("Expected client timeout %s, got %s", 10*time.Second, timeout)
+				}
+			},
+		},
+		{
+			name: "bad-request-timeout",
+			env:  map[string]string{},
+			method: &config.Method{
+				Type:   "aws",
+				Config: map[string]interface{}{"vault_request_timeout": "-1s"},
+			},
+			vault: &config.Vault{},
+			err:   "'vault_request_timeout' must be positive",
+			post:  func(*api.Client) {},
+		},
 		{
 			name: "sets-token-from-env-if-token-auth",
 			env: map[string]string{
@@ -314,6 +503,68 @@ func TestNewVaultClient(t *testing.T) {
 			err:   "missing 'auto_auth.method.config.token' value",
 			post:  func(*api.Client) {},
 		},
+		{
+			name: "sets-token-from-token-file",
+			env:  map[string]string{},
+			method: &config.Method{
+				Type:   "token",
+				Config: map[string]interface{}{"token_file_path": tokenFile},
+			},
+			vault: &config.Vault{},
+			post: func(c *api.Client) {
+				if c.Token() != testToken {
+					t.Errorf("Expected client to have token %s but it has %s", testToken, c.Token())
+				}
+			},
+		},
+		{
+			name: "sets-token-from-vault-cli-token-file",
+			env:  map[string]string{"HOME": home},
+			method: &config.Method{
+				Type:   "token",
+				Config: map[string]interface{}{},
+			},
+			vault: &config.Vault{},
+			post: func(c *api.Client) {
+				if c.Token() != testToken {
+					t.Errorf("Expected client to have token %s but it has %s", testToken, c.Token())
+				}
+			},
+		},
+		{
+			name: "token-file-doesnt-exist",
+			env:  map[string]string{},
+			method: &config.Method{
+				Type:   "token",
+				Config: map[string]interface{}{"token_file_path": filepath.Join(home, "nonexistent")},
+			},
+			vault: &config.Vault{},
+			err: fmt.Sprintf("error reading token file: open %s: no such file or directory",
+				filepath.Join(home, "nonexistent")),
+			post: func(*api.Client) {},
+		},
+		{
+			name: "token-file-is-empty",
+			env:  map[string]string{},
+			method: &config.Method{
+				Type:   "token",
+				Config: map[string]interface{}{"token_file_path": emptyTokenFile},
+			},
+			vault: &config.Vault{},
+			err:   fmt.Sprintf("token file %s is empty", emptyTokenFile),
+			post:  func(*api.Client) {},
+		},
+		{
+			name: "token-file-path-not-string",
+			env:  map[string]string{},
+			method: &config.Method{
+				Type:   "token",
+				Config: map[string]interface{}{"token_file_path": 1234},
+			},
+			vault: &config.Vault{},
+			err:   "could not convert 'auto_auth.method.config.token_file_path' config value to string",
+			post:  func(*api.Client) {},
+		},
 		{
 			name: "token-not-string",
 			env:  map[string]string{},
@@ -374,6 +625,17 @@ func TestNewVaultClient(t *testing.T) {
 	}
 }
 
+func clientTLSConfig(t *testing.T, c *api.Client) *tls.Config {
+	t.Helper()
+
+	transport, ok := c.CloneConfig().HttpClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatal("Vault client does not use an *http.Transport")
+	}
+
+	return transport.TLSClientConfig
+}
+
 func stashEnv() []string {
 	env := os.Environ()
 	os.Clearenv()
@@ -392,3 +654,131 @@ func popEnv(env []string) {
 		os.Setenv(k, v)
 	}
 }
+
+func TestBuildAuthMethod_MountPath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"role-id", "secret-id", "jwt", "k8s-token", "password", "github-token"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("test-"+name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv(EnvAuthPassword, "secure password")
+
+	client, err := api.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		method   *config.Method
+		expected string
+	}{
+		{
+			name: "approle",
+			method: &config.Method{
+				Type: "approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":                   filepath.Join(dir, "role-id"),
+					"secret_id_file_path":                 filepath.Join(dir, "secret-id"),
+					"remove_secret_id_file_after_reading": false,
+				},
+			},
+			expected: "auth/team-prod/login",
+		},
+		{
+			name:     "cert",
+			method:   &config.Method{Type: "cert", Config: map[string]interface{}{}},
+			expected: "auth/team-prod/login",
+		},
+		{
+			name: "jwt",
+			method: &config.Method{
+				Type: "jwt",
+				Config: map[string]interface{}{
+					"path":                     filepath.Join(dir, "jwt"),
+					"role":                     "dev-test",
+					"remove_jwt_after_reading": false,
+				},
+			},
+			expected: "auth/team-prod/login",
+		},
+		{
+			name: "github",
+			method: &config.Method{
+				Type:   "github",
+				Config: map[string]interface{}{"token_file_path": filepath.Join(dir, "github-token")},
+			},
+			expected: "auth/team-prod/login",
+		},
+		{
+			name: "kubernetes",
+			method: &config.Method{
+				Type: "kubernetes",
+				Config: map[string]interface{}{
+					"role":       "dev-test",
+					"token_path": filepath.Join(dir, "k8s-token"),
+				},
+			},
+			expected: "auth/team-prod/login",
+		},
+		{
+			name: "ldap",
+			method: &config.Method{
+				Type:   "ldap",
+				Config: map[string]interface{}{"username": "jdoe"},
+			},
+			expected: "auth/team-prod/login/jdoe",
+		},
+		{
+			name: "ldap-password-file",
+			method: &config.Method{
+				Type: "ldap",
+				Config: map[string]interface{}{
+					"username":                      "jdoe",
+					"password_file_path":            filepath.Join(dir, "password"),
+					"remove_password_after_reading": false,
+				},
+			},
+			expected: "auth/team-prod/login/jdoe",
+		},
+		{
+			name: "userpass",
+			method: &config.Method{
+				Type:   "userpass",
+				Config: map[string]interface{}{"username": "jdoe"},
+			},
+			expected: "auth/team-prod/login/jdoe",
+		},
+		{
+			name: "namespace",
+			method: &config.Method{
+				Type:      "userpass",
+				Namespace: "ns1/",
+				Config:    map[string]interface{}{"username": "jdoe"},
+			},
+			expected: "ns1/auth/team-prod/login/jdoe",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.method.MountPath = "auth/team-prod"
+
+			method, err := BuildAuthMethod(tc.method, hclog.NewNullLogger(), MethodOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, _, _, err := method.Authenticate(context.Background(), client)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expected, path); diff != "" {
+				t.Fatalf("Login paths differ:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+	"golang.org/x/xerrors"
+)
+
+// EnvVaultIndex is a comma-separated list of X-Vault-Index states which
+// every request must satisfy. Tooling which writes Docker credentials to
+// Vault can export the index it received so that the helper never reads
+// an older version of the secret from a lagging node.
+const EnvVaultIndex = "DCVL_VAULT_INDEX"
+
+// ConfigureConsistency configures the client to use Vault Enterprise's
+// client-controlled consistency headers according to the
+// enforce_consistency and when_inconsistent fields of the api_proxy
+// stanza. These fields carry the same meaning as they do for the Vault
+// agent.
+func ConfigureConsistency(client *api.Client, apiProxy *config.APIProxy) error {
+	if states := os.Getenv(EnvVaultIndex); states != "" {
+		for _, state := range strings.Split(states, ",") {
+			if state = strings.TrimSpace(state); state != "" {
+				client.AddHeader(api.HeaderIndex, state)
+			}
+		}
+	}
+
+	if apiProxy == nil {
+		return nil
+	}
+
+	switch apiProxy.EnforceConsistency {
+	case "", "never":
+	case "always":
+		client.SetReadYourWrites(true)
+	default:
+		return xerrors.Errorf("unknown api_proxy setting for enforce_consistency: %q", apiProxy.EnforceConsistency)
+	}
+
+	switch apiProxy.WhenInconsistent {
+	case "", "retry":
+		// The Vault API client retries 412 responses by default
+	case "fail":
+		client.SetCheckRetry(noInconsistencyRetryPolicy)
+	case "forward":
+		client.AddHeader(api.HeaderInconsistent, "forward-active-node")
+	default:
+		return xerrors.Errorf("unknown api_proxy setting for when_inconsistent: %q", apiProxy.WhenInconsistent)
+	}
+
+	return nil
+}
+
+// noInconsistencyRetryPolicy behaves like the default retry policy of the
+// Vault API client except that it does not retry requests which failed
+// because the node could not satisfy the X-Vault-Index header.
+func noInconsistencyRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if resp != nil && resp.StatusCode == http.StatusPreconditionFailed {
+		return false, nil
+	}
+
+	return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+}
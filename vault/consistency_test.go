@@ -0,0 +1,136 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestConfigureConsistency(t *testing.T) {
+	cases := []struct {
+		name         string
+		env          string
+		apiProxy     *config.APIProxy
+		status       int
+		err          string
+		index        []string
+		inconsistent string
+		requests     int32
+	}{
+		{
+			name:     "no-api-proxy",
+			status:   http.StatusOK,
+			requests: 1,
+		},
+		{
+			name:     "index-from-env",
+			env:      "state-1, state-2",
+			status:   http.StatusOK,
+			index:    []string{"state-1", "state-2"},
+			requests: 1,
+		},
+		{
+			name:         "forward",
+			apiProxy:     &config.APIProxy{EnforceConsistency: "always", WhenInconsistent: "forward"},
+			status:       http.StatusOK,
+			inconsistent: "forward-active-node",
+			requests:     1,
+		},
+		{
+			name:     "fail",
+			apiProxy: &config.APIProxy{WhenInconsistent: "fail"},
+			status:   http.StatusPreconditionFailed,
+			requests: 1,
+		},
+		{
+			name:     "retry",
+			apiProxy: &config.APIProxy{WhenInconsistent: "retry"},
+			status:   http.StatusPreconditionFailed,
+			requests: 3,
+		},
+		{
+			name:     "bad-enforce-consistency",
+			apiProxy: &config.APIProxy{EnforceConsistency: "sometimes"},
+			err:      `unknown api_proxy setting for enforce_consistency: "sometimes"`,
+		},
+		{
+			name:     "bad-when-inconsistent",
+			apiProxy: &config.APIProxy{WhenInconsistent: "panic"},
+			err:      `unknown api_proxy setting for when_inconsistent: "panic"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				requests     int32
+				index        []string
+				inconsistent string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				index = r.Header.Values(api.HeaderIndex)
+				inconsistent = r.Header.Get(api.HeaderInconsistent)
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			os.Setenv(EnvVaultIndex, tc.env)
+			defer os.Unsetenv(EnvVaultIndex)
+
+			client, err := api.NewClient(&api.Config{Address: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.SetMaxRetries(2)
+			client.SetMinRetryWait(0)
+			client.SetMaxRetryWait(0)
+
+			err = ConfigureConsistency(client, tc.apiProxy)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client.Logical().Read("secret/docker/creds") // nolint: errcheck
+
+			if requests != tc.requests {
+				t.Errorf("Expected %d request(s), got %d", tc.requests, requests)
+			}
+			if !cmp.Equal(index, tc.index, cmpopts.EquateEmpty()) {
+				t.Errorf("Index headers differ:\n%v", cmp.Diff(tc.index, index))
+			}
+			if inconsistent != tc.inconsistent {
+				t.Errorf("Expected %s header %q, got %q", api.HeaderInconsistent, tc.inconsistent, inconsistent)
+			}
+		})
+	}
+}
@@ -14,30 +14,150 @@
 package vault
 
 import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
 	"github.com/hashicorp/vault/api"
 	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// The keys of the custom_metadata of a KV v2 secret which describe where
+// the Docker credentials are stored in the secret.
+const (
+	MetadataUsernameKey   = "docker_username_key"
+	MetadataPasswordKey   = "docker_password_key"
+	MetadataIdentityToken = "docker_identity_token"
 )
 
+// IdentityTokenUsername is the username which tells Docker that the
+// password is an identity token, unless FieldKeys.IdentityTokenUsername
+// is set.
+const IdentityTokenUsername = "<token>"
+
+// The fields of the responses of the Active Directory and LDAP secrets
+// engines. The AD engine returns the password of a role in
+// current_password rather than password, and the static roles of the LDAP
+// engine return how long remains until their password is rotated in ttl.
+const (
+	currentPasswordField   = "current_password"
+	lastVaultRotationField = "last_vault_rotation"
+	rotationTTLField       = "ttl"
+)
+
+// authField is the field of a secret which, as in the auths of a Docker
+// config.json, may hold the base64 encoding of "username:password" instead
+// of separate username and password fields.
+const authField = "auth"
+
 // Credentials represent Docker credentials.
 type Credentials struct {
 	Username string
 	Password string
+
+	// Fields holds every field of the secret, including the username
+	// and password.
+	Fields map[string]interface{}
+
+	// LeaseID, LeaseDuration and Renewable describe the lease of the
+	// secret. Only secrets generated by dynamic secrets engines have a
+	// lease.
+	LeaseID       string
+	LeaseDuration time.Duration
+	Renewable     bool
+
+	// Expires, if set, is when the credentials expire regardless of the
+	// lease of the secret.
+	Expires time.Time
 }
 
-// GetCredentials uses the Vault client to read the secret at
-// path.
+// fieldMapping describes which fields of a secret hold the Docker
+// credentials.
+type fieldMapping struct {
+	username      string
+	password      string
+	identityToken bool
+}
+
+// FieldKeys names the fields of a secret which hold the Docker username
+// and password. Empty names default to 'username' and 'password'.
+type FieldKeys struct {
+	Username string
+	Password string
+
+	// IdentityToken, if set, names the field which holds an identity
+	// token. The token is returned instead of the username and password,
+	// so that Docker uses it as an OAuth bearer token.
+	IdentityToken string
+
+	// IdentityTokenUsername, if not nil, is the username returned with
+	// the identity token instead of "<token>", so that the token is used
+	// as the password of that username (which may be empty), as by
+	// registries such as GHCR which take tokens minted by Vault as
+	// passwords.
+	IdentityTokenUsername *string
+
+	// UsernameTemplate and PasswordTemplate, if set, are Go templates
+	// which extract the username and password (or identity token) from
+	// the data of the secret, for secrets whose credentials are not
+	// stored in fields of their own. They take precedence over the
+	// fields named above and in the custom_metadata of the secret.
+	UsernameTemplate string
+	PasswordTemplate string
+
+	// UsernamePath, if set, is the path of another secret from which the
+	// username is read, with the field or template named above, for
+	// passwords which are rotated by another secrets engine than the one
+	// which stores the username. The password, fields and lease are those
+	// of the secret at the path given to GetCredentialsWithKeys.
+	UsernamePath string
+
+	// Clock, if set, is the clock by which the expiration of passwords
+	// which are rotated, such as those of static roles of the LDAP secrets
+	// engine, is computed. Otherwise, the system clock is used.
+	Clock clock.Clock
+}
+
+// GetCredentials uses the Vault client to read the secret at path. By
+// default, the credentials are read from the 'username' and 'password'
+// fields of the secret or, if it has neither, decoded from its 'auth'
+// field as in a Docker config.json. The 'current_password' returned by the
+// Active Directory secrets engine is read if the secret has no password.
+// The custom_metadata of a KV v2 secret can name other fields or declare
+// that the password is an identity token.
 func GetCredentials(path string, client *api.Client) (Credentials, error) {
+	return GetCredentialsWithKeys(context.Background(), path, client, FieldKeys{})
+}
+
+// GetCredentialsWithKeys is like GetCredentials, but reads the credentials
+// from the fields named by keys unless the custom_metadata of the secret
+// names others. If keys names an identity token field, the username of the
+// credentials is the one which tells Docker that the password is an
+// identity token. The templates of keys, if any, are rendered against the
+// data of the secret instead of reading a field. If keys names a secret
+// from which the username is read, it is read too and merged with the
+// password. The secrets are read within ctx.
+func GetCredentialsWithKeys( // nolint: gocyclo
+	ctx context.Context,
+	path string,
+	client *api.Client,
+	keys FieldKeys,
+) (Credentials, error) {
 	var (
 		username, password string
 		ok                 bool
 		missingSecrets     []string
 	)
 
-	secret, err := client.Logical().Read(path)
+	secret, err := client.Logical().ReadWithContext(ctx, path)
 	if err != nil {
-		return Credentials{}, xerrors.Errorf("error reading secret: %v", err)
+		return Credentials{}, xerrors.Errorf("error reading secret: %w", err)
 	}
 
 	if secret == nil {
@@ -48,25 +168,289 @@ func GetCredentials(path string, client *api.Client) (Credentials, error) {
 
 	// Check for metadata in the response which will only exist if this is a kv-v2 mount
 	// https://www.vaultproject.io/api/secret/kv/kv-v2.html#sample-response-1
-	_, isKvv2 := secret.Data["metadata"].(map[string]interface{})
+	mapping := fieldMapping{username: "username", password: "password"}
+	if keys.Username != "" {
+		mapping.username = keys.Username
+	}
+
+	if keys.Password != "" {
+		mapping.password = keys.Password
+	}
+
+	if keys.IdentityToken != "" {
+		mapping.password = keys.IdentityToken
+		mapping.identityToken = true
+	}
+
+	metadata, isKvv2 := secret.Data["metadata"].(map[string]interface{})
 	if isKvv2 {
-		creds = secret.Data["data"].(map[string]interface{})
+		// The data of a deleted or destroyed version is null
+		if creds, _ = secret.Data["data"].(map[string]interface{}); creds == nil {
+			return Credentials{}, xerrors.Errorf("No secret found in Vault at path %q", path)
+		}
+
+		if mapping, err = parseFieldMapping(metadata, mapping); err != nil {
+			return Credentials{}, xerrors.Errorf("invalid custom_metadata of secret at path %q: %w", path, err)
+		}
 	}
 
-	if username, ok = creds["username"].(string); !ok || username == "" {
-		missingSecrets = append(missingSecrets, "username")
+	// A secret with neither a username nor a password may hold both in
+	// its auth field instead
+	decoded := creds[authField] != nil && !mapping.identityToken && keys.UsernameTemplate == "" &&
+		keys.PasswordTemplate == "" && keys.UsernamePath == "" && creds[mapping.username] == nil &&
+		creds[mapping.password] == nil
+	if decoded {
+		if username, password, err = decodeAuth(creds[authField]); err != nil {
+			return Credentials{}, xerrors.Errorf("invalid '%s' field of secret at path %q: %w", authField, path, err)
+		}
 	}
 
-	if password, ok = creds["password"].(string); !ok || password == "" {
-		missingSecrets = append(missingSecrets, "password")
+	switch {
+	case decoded:
+	case mapping.identityToken:
+		username = IdentityTokenUsername
+		if keys.IdentityTokenUsername != nil {
+			username = *keys.IdentityTokenUsername
+		}
+	case keys.UsernamePath != "":
+		// The username is read from its own secret below
+	case keys.UsernameTemplate != "":
+		if username, err = executeTemplate("username_template", keys.UsernameTemplate, creds); err != nil {
+			return Credentials{}, xerrors.Errorf("error extracting username from secret at path %q: %w", path, err)
+		}
+
+		if username == "" {
+			missingSecrets = append(missingSecrets, "username")
+		}
+	default:
+		if username, ok = creds[mapping.username].(string); !ok || username == "" {
+			missingSecrets = append(missingSecrets, mapping.username)
+		}
+	}
+
+	switch {
+	case decoded:
+	case keys.PasswordTemplate != "":
+		if password, err = executeTemplate("password_template", keys.PasswordTemplate, creds); err != nil {
+			return Credentials{}, xerrors.Errorf("error extracting password from secret at path %q: %w", path, err)
+		}
+
+		if password == "" {
+			missingSecrets = append(missingSecrets, "password")
+		}
+	case creds[mapping.password] == nil && mapping.password == "password" && creds[currentPasswordField] != nil:
+		if password, ok = creds[currentPasswordField].(string); !ok || password == "" {
+			missingSecrets = append(missingSecrets, currentPasswordField)
+		}
+	default:
+		if password, ok = creds[mapping.password].(string); !ok || password == "" {
+			missingSecrets = append(missingSecrets, mapping.password)
+		}
 	}
 
 	if len(missingSecrets) > 0 {
 		return Credentials{}, xerrors.Errorf("No %s found in Vault at path %q", strings.Join(missingSecrets, " or "), path)
 	}
 
+	if keys.UsernamePath != "" && !mapping.identityToken {
+		if username, err = getUsername(ctx, client, keys); err != nil {
+			return Credentials{}, err
+		}
+	}
+
+	leaseDuration := time.Duration(secret.LeaseDuration) * time.Second
+
+	// The password of a static role of the LDAP engine is valid until it
+	// is rotated, so it must not be cached for longer
+	var expires time.Time
+	if rotationTTL, ok := parseRotationTTL(creds); ok {
+		clk := keys.Clock
+		if clk == nil {
+			clk = clock.System()
+		}
+
+		expires = clk.Now().Add(rotationTTL)
+
+		if leaseDuration <= 0 || rotationTTL < leaseDuration {
+			leaseDuration = rotationTTL
+		}
+	}
+
 	return Credentials{
 		Username: username,
 		Password: password,
+		Fields:   creds,
+
+		LeaseID:       secret.LeaseID,
+		LeaseDuration: leaseDuration,
+		Renewable:     secret.Renewable,
+		Expires:       expires,
 	}, nil
 }
+
+// getUsername reads the username from the secret at keys.UsernamePath, in
+// the field named by keys or the custom_metadata of the secret, or with
+// the username template of keys.
+func getUsername(ctx context.Context, client *api.Client, keys FieldKeys) (string, error) {
+	path := keys.UsernamePath
+
+	secret, err := client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return "", xerrors.Errorf("error reading secret: %w", err)
+	}
+
+	if secret == nil {
+		return "", xerrors.Errorf("No secret found in Vault at path %q", path)
+	}
+
+	data := secret.Data
+
+	mapping := fieldMapping{username: "username"}
+	if keys.Username != "" {
+		mapping.username = keys.Username
+	}
+
+	if metadata, isKvv2 := secret.Data["metadata"].(map[string]interface{}); isKvv2 {
+		data, _ = secret.Data["data"].(map[string]interface{})
+
+		if mapping, err = parseFieldMapping(metadata, mapping); err != nil {
+			return "", xerrors.Errorf("invalid custom_metadata of secret at path %q: %w", path, err)
+		}
+	}
+
+	var username string
+
+	if keys.UsernameTemplate != "" {
+		if username, err = executeTemplate("username_template", keys.UsernameTemplate, data); err != nil {
+			return "", xerrors.Errorf("error extracting username from secret at path %q: %w", path, err)
+		}
+	} else {
+		username, _ = data[mapping.username].(string)
+	}
+
+	if username == "" {
+		return "", xerrors.Errorf("No %s found in Vault at path %q", mapping.username, path)
+	}
+
+	return username, nil
+}
+
+// parseRotationTTL returns how long remains until the password of a static
+// role of the LDAP secrets engine is rotated, if the secret is one.
+func parseRotationTTL(creds map[string]interface{}) (time.Duration, bool) {
+	if creds[lastVaultRotationField] == nil || creds[rotationTTLField] == nil {
+		return 0, false
+	}
+
+	ttl, err := parseutil.ParseDurationSecond(creds[rotationTTLField])
+	if err != nil || ttl <= 0 {
+		return 0, false
+	}
+
+	return ttl, true
+}
+
+// decodeAuth decodes the username and password from the auth field of a
+// secret, which must be the base64 encoding of "username:password".
+func decodeAuth(raw interface{}) (username, password string, err error) {
+	auth, ok := raw.(string)
+	if !ok {
+		return "", "", xerrors.New("must be a string")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return "", "", xerrors.Errorf("error decoding base64: %w", err)
+	}
+
+	username, password, ok = strings.Cut(string(decoded), ":")
+	if !ok || username == "" || password == "" {
+		return "", "", xerrors.New(`must be the base64 encoding of "username:password"`)
+	}
+
+	return username, password, nil
+}
+
+// parseFieldMapping overrides the mapping with the one declared in the
+// custom_metadata of the KV v2 metadata, if any.
+func parseFieldMapping(metadata map[string]interface{}, mapping fieldMapping) (fieldMapping, error) {
+	custom, ok := metadata["custom_metadata"].(map[string]interface{})
+	if !ok {
+		return mapping, nil
+	}
+
+	for key, field := range map[string]*string{
+		MetadataUsernameKey: &mapping.username,
+		MetadataPasswordKey: &mapping.password,
+	} {
+		raw, ok := custom[key]
+		if !ok {
+			continue
+		}
+
+		v, ok := raw.(string)
+		if !ok || v == "" {
+			return mapping, xerrors.Errorf("'%s' must be a non-empty string", key)
+		}
+
+		*field = v
+	}
+
+	if raw, ok := custom[MetadataIdentityToken]; ok {
+		identityToken, err := parseutil.ParseBool(raw)
+		if err != nil {
+			return mapping, xerrors.Errorf("'%s' must be a boolean", MetadataIdentityToken)
+		}
+
+		mapping.identityToken = identityToken
+	}
+
+	return mapping, nil
+}
+
+// CheckLease verifies that the lease has not been revoked and returns its
+// remaining TTL. If the lease is renewable, it is renewed.
+func CheckLease(ctx context.Context, client *api.Client, leaseID string, renewable bool) (time.Duration, error) {
+	if renewable {
+		secret, err := client.Sys().RenewWithContext(ctx, leaseID, 0)
+		if err != nil {
+			return 0, xerrors.Errorf("error renewing lease: %w", err)
+		}
+
+		return time.Duration(secret.LeaseDuration) * time.Second, nil
+	}
+
+	secret, err := client.Sys().LookupWithContext(ctx, leaseID)
+	if err != nil {
+		return 0, xerrors.Errorf("error looking up lease: %w", err)
+	}
+
+	ttl, err := parseutil.ParseDurationSecond(secret.Data["ttl"])
+	if err != nil {
+		return 0, xerrors.Errorf("error parsing lease TTL: %w", err)
+	}
+
+	return ttl, nil
+}
+
+// IsPermissionDenied returns true if err was caused by Vault rejecting the
+// client's token.
+func IsPermissionDenied(err error) bool {
+	var respErr *api.ResponseError
+
+	return xerrors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
+
+// IsUnavailable returns true if err was caused by Vault being unreachable:
+// the request could not be sent, timed out or was answered with a 5xx
+// status (e.g. because Vault is sealed).
+func IsUnavailable(err error) bool {
+	var respErr *api.ResponseError
+	if xerrors.As(err, &respErr) {
+		return respErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var urlErr *url.Error
+
+	return xerrors.As(err, &urlErr) || xerrors.Is(err, context.DeadlineExceeded)
+}
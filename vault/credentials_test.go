@@ -14,8 +14,12 @@
 package vault
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/go-hclog"
@@ -24,6 +28,10 @@ import (
 	vaulthttp "github.com/hashicorp/vault/http"
 	"github.com/hashicorp/vault/sdk/helper/logging"
 	server "github.com/hashicorp/vault/vault"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
 )
 
 func TestGetCredentials(t *testing.T) {
@@ -127,6 +135,139 @@ func TestGetCredentials(t *testing.T) {
 		if creds.Password != "correct horse battery staple" {
 			t.Fatalf("Errors differ:\n%v", cmp.Diff("correct horse battery staple", creds.Password))
 		}
+		expected := map[string]interface{}{
+			"username": "test@user.com",
+			"password": "correct horse battery staple",
+		}
+		if !cmp.Equal(expected, creds.Fields) {
+			t.Fatalf("Fields differ:\n%v", cmp.Diff(expected, creds.Fields))
+		}
+	})
+
+	t.Run("active-directory", func(t *testing.T) {
+		// The response of ad/creds/<role>
+		secret := "secret/docker/creds"
+		_, err := client.Logical().Write(secret, map[string]interface{}{
+			"username":         "svc-docker",
+			"current_password": "correct horse battery staple",
+			"last_password":    "wrong password",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Logical().Delete(secret)
+
+		creds, err := GetCredentials(secret, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Username != "svc-docker" {
+			t.Fatalf("Usernames differ:\n%v", cmp.Diff("svc-docker", creds.Username))
+		}
+		if creds.Password != "correct horse battery staple" {
+			t.Fatalf("Passwords differ:\n%v", cmp.Diff("correct horse battery staple", creds.Password))
+		}
+	})
+
+	t.Run("ldap-static-role", func(t *testing.T) {
+		// The response of ldap/static-cred/<role>
+		secret := "secret/docker/creds"
+		_, err := client.Logical().Write(secret, map[string]interface{}{
+			"username":            "svc-docker",
+			"password":            "correct horse battery staple",
+			"last_password":       "wrong password",
+			"last_vault_rotation": "2024-01-01T00:00:00Z",
+			"ttl":                 90,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Logical().Delete(secret)
+
+		creds, err := GetCredentials(secret, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Password != "correct horse battery staple" {
+			t.Fatalf("Passwords differ:\n%v", cmp.Diff("correct horse battery staple", creds.Password))
+		}
+		if creds.LeaseDuration != 90*time.Second {
+			t.Fatalf("Expected a lease duration of 1m30s, got %s", creds.LeaseDuration)
+		}
+		if until := time.Until(creds.Expires); until <= 0 || until > 90*time.Second {
+			t.Fatalf("Expected the credentials to expire within 1m30s, got %s", until)
+		}
+
+		clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC))
+		if creds, err = GetCredentialsWithKeys(context.Background(), secret, client, FieldKeys{Clock: clk}); err != nil {
+			t.Fatal(err)
+		}
+		if expected := clk.Now().Add(90 * time.Second); !creds.Expires.Equal(expected) {
+			t.Fatalf("Expected the credentials to expire at %s, got %s", expected, creds.Expires)
+		}
+	})
+
+	t.Run("username-path", func(t *testing.T) {
+		secret, usernameSecret := "secret/docker/password", "secret/docker/username"
+		_, err := client.Logical().Write(secret, map[string]interface{}{
+			"password": "correct horse battery staple",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Logical().Delete(secret)
+
+		_, err = client.Logical().Write(usernameSecret, map[string]interface{}{
+			"user": "svc-docker",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Logical().Delete(usernameSecret)
+
+		creds, err := GetCredentialsWithKeys(context.Background(), secret, client, FieldKeys{
+			Username:     "user",
+			UsernamePath: usernameSecret,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Username != "svc-docker" {
+			t.Fatalf("Usernames differ:\n%v", cmp.Diff("svc-docker", creds.Username))
+		}
+		if creds.Password != "correct horse battery staple" {
+			t.Fatalf("Passwords differ:\n%v", cmp.Diff("correct horse battery staple", creds.Password))
+		}
+		expected := map[string]interface{}{
+			"password": "correct horse battery staple",
+		}
+		if !cmp.Equal(expected, creds.Fields) {
+			t.Fatalf("Fields differ:\n%v", cmp.Diff(expected, creds.Fields))
+		}
+
+		_, err = GetCredentialsWithKeys(context.Background(), secret, client, FieldKeys{
+			UsernamePath: usernameSecret,
+		})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		expectedErr := fmt.Sprintf(`No username found in Vault at path %q`, usernameSecret)
+		if err.Error() != expectedErr {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(err.Error(), expectedErr))
+		}
+
+		_, err = GetCredentialsWithKeys(context.Background(), secret, client, FieldKeys{
+			UsernamePath: "secret/doesnt/exist",
+		})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		expectedErr = `No secret found in Vault at path "secret/doesnt/exist"`
+		if err.Error() != expectedErr {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(err.Error(), expectedErr))
+		}
 	})
 }
 
@@ -183,6 +324,349 @@ func TestGetCredentialsKvv2(t *testing.T) {
 			t.Fatalf("Errors differ:\n%v", cmp.Diff("correct horse battery staple", creds.Password))
 		}
 	})
+
+	cases := []struct {
+		name           string
+		data           map[string]interface{}
+		customMetadata map[string]interface{}
+		keys           FieldKeys
+		username       string
+		password       string
+		err            string
+	}{
+		{
+			name: "custom-fields",
+			data: map[string]interface{}{
+				"user":  "test@user.com",
+				"token": "correct horse battery staple",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataUsernameKey: "user",
+				MetadataPasswordKey: "token",
+			},
+			username: "test@user.com",
+			password: "correct horse battery staple",
+		},
+		{
+			name: "configured-keys",
+			data: map[string]interface{}{
+				"user": "test@user.com",
+				"pass": "correct horse battery staple",
+			},
+			keys:     FieldKeys{Username: "user", Password: "pass"},
+			username: "test@user.com",
+			password: "correct horse battery staple",
+		},
+		{
+			name: "custom-fields-override-keys",
+			data: map[string]interface{}{
+				"user":  "test@user.com",
+				"pass":  "wrong password",
+				"token": "correct horse battery staple",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataPasswordKey: "token",
+			},
+			keys:     FieldKeys{Username: "user", Password: "pass"},
+			username: "test@user.com",
+			password: "correct horse battery staple",
+		},
+		{
+			name: "identity-token",
+			data: map[string]interface{}{
+				"refresh_token": "eyJhbGciOiJSUzI1NiJ9",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataPasswordKey:   "refresh_token",
+				MetadataIdentityToken: "true",
+			},
+			username: "<token>",
+			password: "eyJhbGciOiJSUzI1NiJ9",
+		},
+		{
+			name: "configured-identity-token-key",
+			data: map[string]interface{}{
+				"username":      "test@user.com",
+				"refresh_token": "eyJhbGciOiJSUzI1NiJ9",
+			},
+			keys:     FieldKeys{IdentityToken: "refresh_token"},
+			username: "<token>",
+			password: "eyJhbGciOiJSUzI1NiJ9",
+		},
+		{
+			name: "identity-token-with-empty-username",
+			data: map[string]interface{}{
+				"token": "ghp_vaultminted",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataPasswordKey:   "token",
+				MetadataIdentityToken: "true",
+			},
+			keys:     FieldKeys{IdentityTokenUsername: new(string)},
+			username: "",
+			password: "ghp_vaultminted",
+		},
+		{
+			name: "templates",
+			data: map[string]interface{}{
+				"registries": map[string]interface{}{
+					// base64 of "test@user.com:correct horse:battery staple"
+					"quay.io": map[string]interface{}{
+						"auth": "dGVzdEB1c2VyLmNvbTpjb3JyZWN0IGhvcnNlOmJhdHRlcnkgc3RhcGxl",
+					},
+				},
+			},
+			keys: FieldKeys{
+				UsernameTemplate: `{{ index (splitN ":" 2 (base64Decode (index .registries "quay.io" "auth"))) 0 }}`,
+				PasswordTemplate: `{{ index (splitN ":" 2 (base64Decode (index .registries "quay.io" "auth"))) 1 }}`,
+			},
+			username: "test@user.com",
+			password: "correct horse:battery staple",
+		},
+		{
+			name: "templates-override-custom-fields",
+			data: map[string]interface{}{
+				"user":  "test@user.com",
+				"token": "{\"password\": \"correct horse battery staple\"}",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataUsernameKey: "user",
+				MetadataPasswordKey: "token",
+			},
+			keys:     FieldKeys{PasswordTemplate: `{{ (parseJSON .token).password }}`},
+			username: "test@user.com",
+			password: "correct horse battery staple",
+		},
+		{
+			name: "template-missing-field",
+			data: map[string]interface{}{"password": "correct horse battery staple"},
+			keys: FieldKeys{UsernameTemplate: "{{ .user }}"},
+			err: `error extracting username from secret at path "secret/data/docker/creds": ` +
+				`template: username_template:1:3: executing "username_template" at <.user>: map has no entry for key "user"`,
+		},
+		{
+			name: "template-empty-result",
+			data: map[string]interface{}{"username": "test@user.com", "password": " "},
+			keys: FieldKeys{PasswordTemplate: "{{ trimSpace .password }}"},
+			err:  `No password found in Vault at path "secret/data/docker/creds"`,
+		},
+		{
+			name: "auth-field",
+			data: map[string]interface{}{
+				// base64 of "test@user.com:correct horse:battery staple"
+				"auth": "dGVzdEB1c2VyLmNvbTpjb3JyZWN0IGhvcnNlOmJhdHRlcnkgc3RhcGxl",
+			},
+			username: "test@user.com",
+			password: "correct horse:battery staple",
+		},
+		{
+			name: "auth-field-with-configured-keys",
+			data: map[string]interface{}{
+				// base64 of "test@user.com:correct horse battery staple"
+				"auth": "dGVzdEB1c2VyLmNvbTpjb3JyZWN0IGhvcnNlIGJhdHRlcnkgc3RhcGxl",
+			},
+			keys:     FieldKeys{Username: "user", Password: "pass"},
+			username: "test@user.com",
+			password: "correct horse battery staple",
+		},
+		{
+			name: "fields-take-precedence-over-auth",
+			data: map[string]interface{}{
+				"username": "test@user.com",
+				"auth":     "dGVzdEB1c2VyLmNvbTpjb3JyZWN0IGhvcnNlIGJhdHRlcnkgc3RhcGxl",
+			},
+			err: `No password found in Vault at path "secret/data/docker/creds"`,
+		},
+		{
+			name: "auth-not-base64",
+			data: map[string]interface{}{"auth": "test@user.com:correct horse battery staple"},
+			err: `invalid 'auth' field of secret at path "secret/data/docker/creds": ` +
+				`error decoding base64: illegal base64 data at input byte 4`,
+		},
+		{
+			name: "auth-without-password",
+			data: map[string]interface{}{
+				// base64 of "test@user.com"
+				"auth": "dGVzdEB1c2VyLmNvbQ==",
+			},
+			err: `invalid 'auth' field of secret at path "secret/data/docker/creds": ` +
+				`must be the base64 encoding of "username:password"`,
+		},
+		{
+			name: "missing-identity-token",
+			data: map[string]interface{}{"password": "correct horse battery staple"},
+			keys: FieldKeys{IdentityToken: "refresh_token"},
+			err:  `No refresh_token found in Vault at path "secret/data/docker/creds"`,
+		},
+		{
+			name: "missing-custom-field",
+			data: map[string]interface{}{
+				"username": "test@user.com",
+				"password": "correct horse battery staple",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataUsernameKey: "user",
+			},
+			err: `No user found in Vault at path "secret/data/docker/creds"`,
+		},
+		{
+			name: "empty-field-name",
+			data: map[string]interface{}{
+				"username": "test@user.com",
+				"password": "correct horse battery staple",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataPasswordKey: "",
+			},
+			err: `invalid custom_metadata of secret at path "secret/data/docker/creds": ` +
+				`'docker_password_key' must be a non-empty string`,
+		},
+		{
+			name: "bad-identity-token",
+			data: map[string]interface{}{
+				"password": "correct horse battery staple",
+			},
+			customMetadata: map[string]interface{}{
+				MetadataIdentityToken: "maybe",
+			},
+			err: `invalid custom_metadata of secret at path "secret/data/docker/creds": ` +
+				`'docker_identity_token' must be a boolean`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret := "secret/data/docker/creds"
+			_, err := client.Logical().Write(secret, map[string]interface{}{
+				"data": tc.data,
+				"metadata": map[string]interface{}{
+					"created_time":    "2019-10-24T18:39:39.656654Z",
+					"custom_metadata": tc.customMetadata,
+					"deletion_time":   "",
+					"destroyed":       false,
+					"version":         "1",
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Logical().Delete(secret)
+
+			creds, err := GetCredentialsWithKeys(context.Background(), secret, client, tc.keys)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.Username != tc.username {
+				t.Fatalf("Usernames differ:\n%v", cmp.Diff(tc.username, creds.Username))
+			}
+			if creds.Password != tc.password {
+				t.Fatalf("Passwords differ:\n%v", cmp.Diff(tc.password, creds.Password))
+			}
+		})
+	}
+}
+
+func TestCheckLease(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithDynamicSecret("registry/creds/ci", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}, time.Hour),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	creds, err := GetCredentials("registry/creds/ci", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, renewable := range []bool{true, false} {
+		ttl, err := CheckLease(context.Background(), client, creds.LeaseID, renewable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl != time.Hour {
+			t.Fatalf("Expected TTL %s, got %s", time.Hour, ttl)
+		}
+	}
+
+	t.Run("revoked", func(t *testing.T) {
+		fake.RevokeLease(creds.LeaseID)
+
+		_, err := CheckLease(context.Background(), client, creds.LeaseID, true)
+		if err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+		if IsPermissionDenied(err) {
+			t.Fatal("expected a revoked lease not to be reported as a permission error")
+		}
+	})
+
+	t.Run("permission-denied", func(t *testing.T) {
+		client.SetToken("bad token")
+
+		_, err := CheckLease(context.Background(), client, creds.LeaseID, false)
+		if !IsPermissionDenied(err) {
+			t.Fatalf("Expected a permission error, got %v", err)
+		}
+	})
+}
+
+func TestIsUnavailable(t *testing.T) {
+	cases := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{
+			name: "connection-refused",
+			err: xerrors.Errorf("error reading secret: %w", &url.Error{
+				Op:  "Get",
+				URL: "https://vault.example.com:8200/v1/secret/docker/creds",
+				Err: errors.New("connection refused"),
+			}),
+			unavailable: true,
+		},
+		{
+			name:        "timeout",
+			err:         xerrors.Errorf("error reading secret: %w", context.DeadlineExceeded),
+			unavailable: true,
+		},
+		{
+			name:        "sealed",
+			err:         xerrors.Errorf("error reading secret: %w", &api.ResponseError{StatusCode: 503}),
+			unavailable: true,
+		},
+		{
+			name: "permission-denied",
+			err:  xerrors.Errorf("error reading secret: %w", &api.ResponseError{StatusCode: 403}),
+		},
+		{
+			name: "not-found",
+			err:  xerrors.New(`No secret found in Vault at path "secret/docker/creds"`),
+		},
+		{
+			name: "no-error",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsUnavailable(tc.err); got != tc.unavailable {
+				t.Fatalf("Expected %t, got %t", tc.unavailable, got)
+			}
+		})
+	}
 }
 
 func randomUUID(t *testing.T) string {
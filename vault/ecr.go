@@ -0,0 +1,168 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/awsauth"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// ECROptions configures how ECR authorization tokens are requested.
+type ECROptions struct {
+	// Region is the region of the ECR API used for registries whose host
+	// does not name one. If empty, the region is resolved from the
+	// environment.
+	Region string
+
+	// Endpoint, if set, is used instead of the ECR API endpoint of the
+	// region.
+	Endpoint string
+
+	HTTPClient *http.Client
+
+	// Clock, if set, is the clock by which the request is signed and the
+	// lease duration is capped. Otherwise, the system clock is used.
+	Clock clock.Clock
+}
+
+// NewECROptions parses the 'ecr_token_mode' and 'ecr_region' fields of
+// the auth method config. It returns nil if the ECR token mode is not
+// enabled.
+func NewECROptions(config map[string]interface{}) (*ECROptions, error) {
+	raw, ok := config["ecr_token_mode"]
+	if !ok {
+		return nil, nil
+	}
+
+	enabled, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return nil, xerrors.New("'ecr_token_mode' must be a boolean")
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+
+	opts := &ECROptions{}
+
+	if raw, ok = config["ecr_region"]; ok {
+		if opts.Region, ok = raw.(string); !ok {
+			return nil, xerrors.New("'ecr_region' must be a string")
+		}
+	}
+
+	return opts, nil
+}
+
+// GetECRCredentials reads AWS credentials from the secret at path, such as
+// one generated by the aws secrets engine, and exchanges them for an
+// authorization token of the ECR registry at serverURL. The credentials
+// are read from the 'access_key', 'secret_key' and, if present,
+// 'security_token' or 'session_token' fields of the secret. The lease
+// duration of the returned credentials never exceeds the expiration of the
+// token, which is also returned as their expiration.
+func GetECRCredentials(
+	ctx context.Context,
+	path string,
+	client *api.Client,
+	serverURL string,
+	opts ECROptions,
+) (Credentials, error) {
+	secret, err := client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return Credentials{}, xerrors.Errorf("error reading secret: %w", err)
+	}
+
+	if secret == nil {
+		return Credentials{}, xerrors.Errorf("No secret found in Vault at path %q", path)
+	}
+
+	fields := secret.Data
+	if _, isKvv2 := secret.Data["metadata"].(map[string]interface{}); isKvv2 {
+		fields, _ = secret.Data["data"].(map[string]interface{})
+	}
+
+	str := func(key string) string {
+		v, _ := fields[key].(string)
+		return v
+	}
+
+	creds := awsauth.Credentials{
+		AccessKeyID:     str("access_key"),
+		SecretAccessKey: str("secret_key"),
+		SessionToken:    str("security_token"),
+	}
+
+	if creds.SessionToken == "" {
+		creds.SessionToken = str("session_token")
+	}
+
+	var missingSecrets []string
+	if creds.AccessKeyID == "" {
+		missingSecrets = append(missingSecrets, "access_key")
+	}
+
+	if creds.SecretAccessKey == "" {
+		missingSecrets = append(missingSecrets, "secret_key")
+	}
+
+	if len(missingSecrets) > 0 {
+		return Credentials{}, xerrors.Errorf("No %s found in Vault at path %q", strings.Join(missingSecrets, " or "), path)
+	}
+
+	region, ok := awsauth.ECRRegion(serverURL)
+	if !ok {
+		region = awsauth.ResolveRegion(opts.Region)
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = awsauth.ECREndpoint(region)
+	}
+
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.System()
+	}
+
+	authz, err := awsauth.GetAuthorizationToken(ctx, opts.HTTPClient, endpoint, creds, region, clk.Now())
+	if err != nil {
+		return Credentials{}, xerrors.Errorf("error getting ECR authorization token: %w", err)
+	}
+
+	leaseDuration := time.Duration(secret.LeaseDuration) * time.Second
+	if untilExpiry := authz.Expires.Sub(clk.Now()); leaseDuration <= 0 || untilExpiry < leaseDuration {
+		leaseDuration = untilExpiry
+	}
+
+	return Credentials{
+		Username: authz.Username,
+		Password: authz.Password,
+		Fields:   fields,
+
+		LeaseID:       secret.LeaseID,
+		LeaseDuration: leaseDuration,
+		Renewable:     secret.Renewable,
+		Expires:       authz.Expires,
+	}, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestNewECROptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		expected *ECROptions
+		err      string
+	}{
+		{
+			name:   "not-set",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "disabled",
+			config: map[string]interface{}{"ecr_token_mode": "false"},
+		},
+		{
+			name:     "enabled",
+			config:   map[string]interface{}{"ecr_token_mode": true},
+			expected: &ECROptions{},
+		},
+		{
+			name:     "region",
+			config:   map[string]interface{}{"ecr_token_mode": true, "ecr_region": "eu-west-1"},
+			expected: &ECROptions{Region: "eu-west-1"},
+		},
+		{
+			name:   "invalid-mode",
+			config: map[string]interface{}{"ecr_token_mode": "sometimes"},
+			err:    "'ecr_token_mode' must be a boolean",
+		},
+		{
+			name:   "invalid-region",
+			config: map[string]interface{}{"ecr_token_mode": true, "ecr_region": 1},
+			err:    "'ecr_region' must be a string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewECROptions(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, opts); diff != "" {
+				t.Fatalf("Options differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetECRCredentials(t *testing.T) {
+	expires := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+
+	ecr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "Credential=AKID/") ||
+			!strings.Contains(auth, "/eu-west-1/ecr/") {
+			t.Errorf("Unexpected Authorization header %q", auth)
+		}
+		if token := r.Header.Get("X-Amz-Security-Token"); token != "TOKEN" {
+			t.Errorf("Expected session token %q, got %q", "TOKEN", token)
+		}
+
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d}]}`,
+			base64.StdEncoding.EncodeToString([]byte("AWS:ecr password")), expires.Unix())
+	}))
+	defer ecr.Close()
+
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithDynamicSecret("aws/sts/registry", map[string]interface{}{
+			"access_key":     "AKID",
+			"secret_key":     "SECRET",
+			"security_token": "TOKEN",
+		}, time.Hour),
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	clk := clock.NewFake(expires.Add(-30 * time.Minute))
+	opts := ECROptions{Endpoint: ecr.URL, HTTPClient: ecr.Client(), Clock: clk}
+	registry := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+
+	t.Run("success", func(t *testing.T) {
+		creds, err := GetECRCredentials(context.Background(), "aws/sts/registry", client, registry, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if creds.Username != "AWS" || creds.Password != "ecr password" {
+			t.Fatalf("Expected credentials %q/%q, got %q/%q", "AWS", "ecr password",
+				creds.Username, creds.Password)
+		}
+		if creds.LeaseID == "" {
+			t.Fatal("expected the lease of the AWS credentials to be returned")
+		}
+		if !creds.Expires.Equal(expires) {
+			t.Fatalf("Expected expiration %s, got %s", expires, creds.Expires)
+		}
+		if creds.LeaseDuration != 30*time.Minute {
+			t.Fatalf("Expected the lease duration to be capped by the expiration, got %s", creds.LeaseDuration)
+		}
+	})
+
+	t.Run("not-aws-credentials", func(t *testing.T) {
+		_, err := GetECRCredentials(context.Background(), "secret/docker/creds", client, registry, opts)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		expected := `No access_key or secret_key found in Vault at path "secret/docker/creds"`
+		if err.Error() != expected {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, err.Error()))
+		}
+	})
+}
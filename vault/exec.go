@@ -0,0 +1,238 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/process"
+)
+
+// defaultExecTimeout is how long an external program may run by default.
+const defaultExecTimeout = 10 * time.Second
+
+// ExecOptions describe an external program which the helper runs to obtain
+// a Vault token or Docker credentials. The program is given a JSON object
+// on its standard input and must print a JSON object on its standard
+// output.
+type ExecOptions struct {
+	// Command is the program and its arguments.
+	Command []string
+
+	// Timeout is how long the program may run before it is killed.
+	Timeout time.Duration
+}
+
+// NewExecOptions parses the 'command' and 'timeout' fields of the object
+// at field. The command is either a list of the program and its arguments
+// or the program alone.
+func NewExecOptions(obj map[string]interface{}, field string) (*ExecOptions, error) {
+	opts := &ExecOptions{Timeout: defaultExecTimeout}
+
+	switch command := obj["command"].(type) {
+	case string:
+		if command != "" {
+			opts.Command = []string{command}
+		}
+	case []interface{}:
+		for _, raw := range command {
+			arg, ok := raw.(string)
+			if !ok {
+				return nil, xerrors.Errorf("'%s.command' must be a list of strings", field)
+			}
+
+			opts.Command = append(opts.Command, arg)
+		}
+	case []string:
+		opts.Command = command
+	}
+
+	if len(opts.Command) == 0 || opts.Command[0] == "" {
+		return nil, xerrors.Errorf("'%s.command' must name a program", field)
+	}
+
+	if raw, ok := obj["timeout"]; ok {
+		timeout, err := parseutil.ParseDurationSecond(raw)
+		if err != nil || timeout <= 0 {
+			return nil, xerrors.Errorf("'%s.timeout' must be a positive duration", field)
+		}
+
+		opts.Timeout = timeout
+	}
+
+	return opts, nil
+}
+
+// run runs the program with the JSON encoding of input on its standard
+// input and decodes its standard output into output.
+func (o *ExecOptions) run(ctx context.Context, logger hclog.Logger, input, output interface{}) error {
+	stdin, err := json.Marshal(input)
+	if err != nil {
+		return xerrors.Errorf("error encoding input of %s: %w", o.Command[0], err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	cmd := &process.Command{
+		Logger: logger,
+		Path:   o.Command[0],
+		Args:   o.Command[1:],
+		Stdin:  stdin,
+	}
+
+	stdout, err := cmd.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(stdout, output); err != nil {
+		return xerrors.Errorf("error decoding output of %s: %w", o.Command[0], err)
+	}
+
+	return nil
+}
+
+// execAuthInput is given to the program of the exec auth method.
+type execAuthInput struct {
+	MountPath string `json:"mount_path"`
+}
+
+// execAuthOutput is printed by the program of the exec auth method: either
+// a token, or the path and data of a login request which the helper makes.
+type execAuthOutput struct {
+	Token string                 `json:"token"`
+	Path  string                 `json:"path"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// execMethod is an auth method which runs an external program to obtain
+// a Vault token, for sites with their own way of issuing tokens.
+type execMethod struct {
+	logger    hclog.Logger
+	mountPath string
+	opts      *ExecOptions
+}
+
+func newExecAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	opts, err := NewExecOptions(conf.Config, "config")
+	if err != nil {
+		return nil, err
+	}
+
+	return &execMethod{logger: conf.Logger, mountPath: conf.MountPath, opts: opts}, nil
+}
+
+// Authenticate runs the program. A token printed by the program is looked
+// up, as with the token_file method, rather than logged in with.
+func (m *execMethod) Authenticate(ctx context.Context, _ *api.Client) (string, http.Header, map[string]interface{}, error) { // nolint: lll
+	var output execAuthOutput
+	if err := m.opts.run(ctx, m.logger, execAuthInput{MountPath: m.mountPath}, &output); err != nil {
+		return "", nil, nil, err
+	}
+
+	switch {
+	case output.Token != "":
+		return "auth/token/lookup-self", nil, map[string]interface{}{"token": output.Token}, nil
+	case output.Path != "":
+		return output.Path, nil, output.Data, nil
+	default:
+		return "", nil, nil, xerrors.Errorf("%s printed neither a 'token' nor a 'path'", m.opts.Command[0])
+	}
+}
+
+func (m *execMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *execMethod) CredSuccess() {}
+
+func (m *execMethod) Shutdown() {}
+
+// execCredentialsInput is given to the program of credential_exec.
+type execCredentialsInput struct {
+	Registry string `json:"registry"`
+}
+
+// execCredentialsOutput is printed by the program of credential_exec.
+type execCredentialsOutput struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identity_token"`
+}
+
+// NewCredentialExecOptions parses 'credential_exec' of the config, if it
+// is set.
+func NewCredentialExecOptions(config map[string]interface{}) (*ExecOptions, error) {
+	raw, ok := config["credential_exec"]
+	if !ok {
+		return nil, nil
+	}
+
+	obj, ok := raw.(map[string]interface{})
+	if list, isList := raw.([]map[string]interface{}); isList && len(list) > 0 {
+		obj, ok = list[0], true
+	}
+
+	if !ok {
+		return nil, xerrors.New("'credential_exec' must be an object")
+	}
+
+	return NewExecOptions(obj, "credential_exec")
+}
+
+// GetExecCredentials runs the program of credential_exec to obtain the
+// credentials of the registry. The program prints either a 'username' and
+// 'password' or an 'identity_token'. If it prints neither, it has no
+// credentials for the registry and false is returned.
+func GetExecCredentials(
+	ctx context.Context,
+	logger hclog.Logger,
+	opts *ExecOptions,
+	registry string,
+) (Credentials, bool, error) {
+	var output execCredentialsOutput
+	if err := opts.run(ctx, logger, execCredentialsInput{Registry: registry}, &output); err != nil {
+		return Credentials{}, false, err
+	}
+
+	creds := Credentials{Username: output.Username, Password: output.Password}
+
+	if output.IdentityToken != "" {
+		creds.Username, creds.Password = IdentityTokenUsername, output.IdentityToken
+	}
+
+	switch {
+	case creds.Username == "" && creds.Password == "":
+		return Credentials{}, false, nil
+	case creds.Username == "" || creds.Password == "":
+		return Credentials{}, false, xerrors.Errorf("%s printed a username or password without the other",
+			opts.Command[0])
+	}
+
+	return creds, true, nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+// writeScript writes a shell script to a temporary file and returns its
+// path.
+func writeScript(t *testing.T, script string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestNewExecOptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		obj      map[string]interface{}
+		expected *ExecOptions
+		err      string
+	}{
+		{
+			name:     "program",
+			obj:      map[string]interface{}{"command": "/usr/local/bin/get-token"},
+			expected: &ExecOptions{Command: []string{"/usr/local/bin/get-token"}, Timeout: 10 * time.Second},
+		},
+		{
+			name: "list",
+			obj: map[string]interface{}{
+				"command": []interface{}{"/usr/local/bin/get-token", "--site", "dc1"},
+				"timeout": "3s",
+			},
+			expected: &ExecOptions{Command: []string{"/usr/local/bin/get-token", "--site", "dc1"}, Timeout: 3 * time.Second},
+		},
+		{
+			name: "missing-command",
+			obj:  map[string]interface{}{},
+			err:  "'config.command' must name a program",
+		},
+		{
+			name: "bad-argument",
+			obj:  map[string]interface{}{"command": []interface{}{"/usr/local/bin/get-token", 1}},
+			err:  "'config.command' must be a list of strings",
+		},
+		{
+			name: "bad-timeout",
+			obj:  map[string]interface{}{"command": "get-token", "timeout": "0s"},
+			err:  "'config.timeout' must be a positive duration",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewExecOptions(tc.obj, "config")
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, opts); diff != "" {
+				t.Fatalf("Options differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecMethod_Authenticate(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		path   string
+		data   map[string]interface{}
+		err    string
+	}{
+		{
+			name: "token",
+			// The mount path is given on the standard input
+			script: `grep -q '"mount_path":"auth/token"' && echo '{"token": "hvs.exec"}'`,
+			path:   "auth/token/lookup-self",
+			data:   map[string]interface{}{"token": "hvs.exec"},
+		},
+		{
+			name:   "login-request",
+			script: `echo '{"path": "auth/jwt/login", "data": {"role": "ci", "jwt": "eyJhbGciOiJSUzI1NiJ9"}}'`,
+			path:   "auth/jwt/login",
+			data:   map[string]interface{}{"role": "ci", "jwt": "eyJhbGciOiJSUzI1NiJ9"},
+		},
+		{
+			name:   "empty-output",
+			script: `echo '{}'`,
+			err:    "%s printed neither a 'token' nor a 'path'",
+		},
+		{
+			name:   "invalid-output",
+			script: `echo 'hvs.exec'`,
+			err:    "error decoding output of %s: invalid character 'h' looking for beginning of value",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			script := writeScript(t, tc.script)
+
+			method, err := BuildAuthMethod(&config.Method{
+				Type:      "exec",
+				MountPath: "auth/token",
+				Config:    map[string]interface{}{"command": script},
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, _, data, err := method.Authenticate(context.Background(), nil)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if expected := fmt.Sprintf(tc.err, script); err.Error() != expected {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tc.path {
+				t.Fatalf("Paths differ:\n%v", cmp.Diff(tc.path, path))
+			}
+			if diff := cmp.Diff(tc.data, data); diff != "" {
+				t.Fatalf("Data differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetExecCredentials(t *testing.T) {
+	cases := []struct {
+		name     string
+		script   string
+		ok       bool
+		username string
+		password string
+		err      string
+	}{
+		{
+			name:     "credentials",
+			script:   `grep -q '"registry":"registry.example.com"' && echo '{"username": "ci", "password": "hunter2"}'`,
+			ok:       true,
+			username: "ci",
+			password: "hunter2",
+		},
+		{
+			name:     "identity-token",
+			script:   `echo '{"identity_token": "eyJhbGciOiJSUzI1NiJ9"}'`,
+			ok:       true,
+			username: "<token>",
+			password: "eyJhbGciOiJSUzI1NiJ9",
+		},
+		{
+			name:   "no-credentials",
+			script: `echo '{}'`,
+		},
+		{
+			name:   "no-password",
+			script: `echo '{"username": "ci"}'`,
+			err:    "%s printed a username or password without the other",
+		},
+		{
+			name:   "failure",
+			script: `echo "no such registry" >&2; exit 2`,
+			err:    "%s exited with status 2 after",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			script := writeScript(t, tc.script)
+			opts := &ExecOptions{Command: []string{script}, Timeout: 10 * time.Second}
+
+			creds, ok, err := GetExecCredentials(context.Background(), hclog.NewNullLogger(), opts,
+				"registry.example.com")
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if expected := fmt.Sprintf(tc.err, script); !strings.HasPrefix(err.Error(), expected) {
+					t.Fatalf("Expected an error starting with %q, got %q", expected, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.ok {
+				t.Fatalf("Expected ok to be %t", tc.ok)
+			}
+			if creds.Username != tc.username || creds.Password != tc.password {
+				t.Fatalf("Unexpected credentials %q, %q", creds.Username, creds.Password)
+			}
+		})
+	}
+}
+
+func TestNewCredentialExecOptions(t *testing.T) {
+	opts, err := NewCredentialExecOptions(map[string]interface{}{})
+	if err != nil || opts != nil {
+		t.Fatalf("Expected no options, got %+v, %v", opts, err)
+	}
+
+	opts, err = NewCredentialExecOptions(map[string]interface{}{
+		"credential_exec": []map[string]interface{}{{"command": "get-creds"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&ExecOptions{Command: []string{"get-creds"}, Timeout: 10 * time.Second}, opts); diff != "" {
+		t.Fatalf("Options differ:\n%s", diff)
+	}
+
+	_, err = NewCredentialExecOptions(map[string]interface{}{"credential_exec": "get-creds"})
+	if expected := "'credential_exec' must be an object"; err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %q, got %v", expected, err)
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+const (
+	awsHealthFile     = "aws-auth-health.json"
+	awsHealthLockFile = "aws-auth-health.lock"
+
+	// healthLockTimeout is how long to wait for the lock before the health
+	// is persisted without it.
+	healthLockTimeout = 5 * time.Second
+
+	defaultFailureThreshold = 3
+	defaultFallbackHold     = 15 * time.Minute
+)
+
+// methodHealth records the consecutive failures of each authentication
+// method and which method is currently preferred. It is persisted to the
+// cache directory so that it survives across invocations of the helper.
+type methodHealth struct {
+	Preferred  string         `json:"preferred,omitempty"`
+	SwitchedAt time.Time      `json:"switched_at,omitempty"`
+	Failures   map[string]int `json:"failures"`
+}
+
+// failoverMethod wraps several authentication methods and falls back to
+// the next one whenever the current one fails. Once the preferred method
+// has failed a number of consecutive times, another method becomes
+// preferred and remains so for a hold period (even if the original method
+// recovers in the meantime) so that the helper does not flap between
+// methods during partial outages. If the hold period is zero, the methods
+// are always tried in order.
+type failoverMethod struct {
+	logger    hclog.Logger
+	clock     clock.Clock
+	names     []string
+	methods   map[string]auth.AuthMethod
+	threshold int
+	hold      time.Duration
+	path      string
+	lock      *cache.FileLock
+	newCreds  chan struct{}
+
+	mu     sync.Mutex
+	health methodHealth
+
+	// pending is the method whose login data was most recently handed to
+	// the auth handler and which has not yet been confirmed by CredSuccess.
+	pending string
+}
+
+// newAWSFailoverMethod creates a failoverMethod which uses the AWS
+// authentication type given by 'type' first and the one given by
+// 'fallback_type' second.
+func newAWSFailoverMethod(conf *auth.AuthConfig, opts MethodOptions) (auth.AuthMethod, error) {
+	opts = opts.withDefaults()
+
+	primary, _ := conf.Config["type"].(string)
+
+	fallback, ok := conf.Config["fallback_type"].(string)
+	if !ok {
+		return nil, xerrors.New("could not convert 'fallback_type' config value to string")
+	}
+
+	threshold := defaultFailureThreshold
+	if raw, ok := conf.Config["failure_threshold"]; ok {
+		t, err := parseutil.SafeParseInt(raw)
+		if err != nil || t < 1 {
+			return nil, xerrors.New("'failure_threshold' must be a positive integer")
+		}
+
+		threshold = t
+	}
+
+	hold := defaultFallbackHold
+	if raw, ok := conf.Config["fallback_hold"]; ok {
+		h, err := parseutil.ParseDurationSecond(raw)
+		if err != nil {
+			return nil, xerrors.Errorf("error parsing 'fallback_hold': %w", err)
+		}
+
+		hold = h
+	}
+
+	names := []string{primary, fallback}
+	methods := make(map[string]auth.AuthMethod, len(names))
+	errs := make([]string, 0, len(names))
+
+	for _, name := range names {
+		c := make(map[string]interface{}, len(conf.Config))
+		for k, v := range conf.Config {
+			c[k] = v
+		}
+
+		c["type"] = name
+
+		method, err := newAWSAuthMethod(&auth.AuthConfig{
+			Logger:    conf.Logger.Named(name),
+			MountPath: conf.MountPath,
+			WrapTTL:   conf.WrapTTL,
+			Config:    c,
+		}, opts)
+		if err != nil {
+			// One of the methods may be misconfigured for this host (e.g. an
+			// unsupported credential source) but that's what the fallback
+			// is for
+			conf.Logger.Warn("error creating aws auth method", "type", name, "error", err)
+			errs = append(errs, name+": "+err.Error())
+
+			continue
+		}
+
+		methods[name] = method
+	}
+
+	if len(methods) == 0 {
+		return nil, xerrors.Errorf("no aws auth method could be created: %s", strings.Join(errs, "; "))
+	}
+
+	path := ""
+	if opts.CacheDir != "" {
+		path = filepath.Join(opts.CacheDir, awsHealthFile)
+	}
+
+	return newFailoverMethod(conf.Logger, opts.Clock, names, methods, threshold, hold, path), nil
+}
+
+// newFailoverMethod creates a failoverMethod which measures the hold
+// period with clk.
+func newFailoverMethod(
+	logger hclog.Logger,
+	clk clock.Clock,
+	names []string,
+	methods map[string]auth.AuthMethod,
+	threshold int,
+	hold time.Duration,
+	path string,
+) *failoverMethod {
+	f := &failoverMethod{
+		logger:    logger,
+		clock:     clk,
+		names:     names,
+		methods:   methods,
+		threshold: threshold,
+		hold:      hold,
+		path:      path,
+		newCreds:  make(chan struct{}),
+		health:    loadMethodHealth(logger, path),
+	}
+
+	if path != "" {
+		f.lock = cache.NewFileLock(filepath.Join(filepath.Dir(path), awsHealthLockFile))
+	}
+
+	for _, method := range methods {
+		go f.forwardNewCreds(method.NewCreds())
+	}
+
+	return f
+}
+
+// Authenticate returns the login data of the first healthy method.
+func (f *failoverMethod) Authenticate(ctx context.Context, client *api.Client) (string, http.Header, map[string]interface{}, error) { // nolint: lll
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order := f.order()
+	start := 0
+
+	if f.pending != "" {
+		// The auth handler only asks for new login data without calling
+		// CredSuccess in between if Vault rejected the previous login
+		f.recordFailure(f.pending)
+
+		for i, name := range order {
+			if name == f.pending {
+				start = i + 1
+			}
+		}
+
+		f.pending = ""
+	}
+
+	errs := make([]string, 0, len(order))
+
+	for i := range order {
+		name := order[(start+i)%len(order)]
+
+		method, ok := f.methods[name]
+		if !ok {
+			continue
+		}
+
+		path, header, data, err := method.Authenticate(ctx, client)
+		if err != nil {
+			f.logger.Warn("error authenticating", "method", name, "error", err)
+			f.recordFailure(name)
+			errs = append(errs, name+": "+err.Error())
+
+			continue
+		}
+
+		f.pending = name
+
+		return path, header, data, nil
+	}
+
+	return "", nil, nil, xerrors.Errorf("all authentication methods failed: %s", strings.Join(errs, "; "))
+}
+
+// NewCreds returns a channel which receives a value whenever any of the
+// wrapped methods detects new credentials.
+func (f *failoverMethod) NewCreds() chan struct{} {
+	return f.newCreds
+}
+
+// CredSuccess records that the pending method authenticated successfully.
+func (f *failoverMethod) CredSuccess() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pending == "" {
+		return
+	}
+
+	f.logger.Info("successfully authenticated", "method", f.pending)
+
+	name := f.pending
+	if f.health.Failures[name] != 0 {
+		f.updateHealth(func() { f.health.Failures[name] = 0 })
+	}
+
+	f.methods[name].CredSuccess()
+	f.pending = ""
+}
+
+// Shutdown shuts down all of the wrapped methods. If the login data of a
+// method was handed to the auth handler but never confirmed, e.g. because
+// the helper gave up waiting for Vault, the method has failed.
+func (f *failoverMethod) Shutdown() {
+	f.mu.Lock()
+
+	if f.pending != "" {
+		f.recordFailure(f.pending)
+		f.pending = ""
+	}
+
+	f.mu.Unlock()
+
+	for _, method := range f.methods {
+		method.Shutdown()
+	}
+}
+
+// order returns the names of the methods, the preferred one first.
+func (f *failoverMethod) order() []string {
+	preferred := f.names[0]
+	if f.health.Preferred != "" && f.clock.Now().Sub(f.health.SwitchedAt) < f.hold {
+		preferred = f.health.Preferred
+	}
+
+	order := make([]string, 0, len(f.names))
+	order = append(order, preferred)
+
+	for _, name := range f.names {
+		if name != preferred {
+			order = append(order, name)
+		}
+	}
+
+	return order
+}
+
+func (f *failoverMethod) recordFailure(name string) {
+	f.updateHealth(func() {
+		f.health.Failures[name]++
+
+		order := f.order()
+		if f.hold > 0 && name == order[0] && f.health.Failures[name] >= f.threshold {
+			for _, other := range order[1:] {
+				if _, ok := f.methods[other]; ok && f.health.Failures[other] < f.health.Failures[name] {
+					f.logger.Warn("preferred authentication method exceeded its failure budget; switching",
+						"from", name, "to", other, "hold", f.hold)
+					f.health.Preferred = other
+					f.health.SwitchedAt = f.clock.Now()
+
+					break
+				}
+			}
+		}
+	})
+}
+
+// updateHealth applies update to the health of the methods and persists
+// it before returning, so that the helper may exit right after logging
+// in. The health is reloaded under the lock first, so that the changes
+// which other invocations made in the meantime are not lost.
+func (f *failoverMethod) updateHealth(update func()) {
+	if f.path == "" {
+		update()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthLockTimeout)
+	defer cancel()
+
+	unlock, err := f.lock.Lock(ctx)
+	if err != nil {
+		f.logger.Warn("error locking authentication method health", "error", err)
+	} else {
+		defer unlock()
+
+		f.health = loadMethodHealth(f.logger, f.path)
+	}
+
+	update()
+	f.saveHealth()
+}
+
+func (f *failoverMethod) forwardNewCreds(ch chan struct{}) {
+	if ch == nil {
+		return
+	}
+
+	for range ch {
+		select {
+		case f.newCreds <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func loadMethodHealth(logger hclog.Logger, path string) methodHealth {
+	health := methodHealth{Failures: make(map[string]int)}
+	if path == "" {
+		return health
+	}
+
+	data, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("error reading authentication method health", "error", err)
+		}
+
+		return health
+	}
+
+	if err = json.Unmarshal(data, &health); err != nil {
+		logger.Warn("error JSON-decoding authentication method health", "error", err)
+		return methodHealth{Failures: make(map[string]int)}
+	}
+
+	if health.Failures == nil {
+		health.Failures = make(map[string]int)
+	}
+
+	return health
+}
+
+func (f *failoverMethod) saveHealth() {
+	if f.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(f.health)
+	if err != nil {
+		f.logger.Warn("error JSON-encoding authentication method health", "error", err)
+		return
+	}
+
+	// The health is renamed into place so that invocations which read it
+	// without the lock never see a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		f.logger.Warn("error writing authentication method health", "error", err)
+		return
+	}
+
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close() // nolint: errcheck, gosec
+		f.logger.Warn("error writing authentication method health", "error", err)
+
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		f.logger.Warn("error writing authentication method health", "error", err)
+		return
+	}
+
+	if err = os.Rename(tmp.Name(), f.path); err != nil {
+		f.logger.Warn("error writing authentication method health", "error", err)
+	}
+}
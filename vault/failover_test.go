@@ -0,0 +1,282 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestFailoverMethod(t *testing.T) {
+	logger := hclog.NewNullLogger()
+	path := filepath.Join(t.TempDir(), awsHealthFile)
+
+	clk := clock.NewFake(time.Now())
+	iam := &mockAuthMethod{path: "iam"}
+	ec2 := &mockAuthMethod{path: "ec2"}
+	newMethod := func() *failoverMethod {
+		return newFailoverMethod(logger, clk, []string{"iam", "ec2"}, map[string]auth.AuthMethod{
+			"iam": iam,
+			"ec2": ec2,
+		}, 2, time.Hour, path)
+	}
+
+	authenticate := func(t *testing.T, f *failoverMethod) string {
+		got, _, _, err := f.Authenticate(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	f := newMethod()
+
+	t.Run("uses-primary", func(t *testing.T) {
+		if got := authenticate(t, f); got != "iam" {
+			t.Fatalf("Expected method %q, got %q", "iam", got)
+		}
+		f.CredSuccess()
+		if iam.successes != 1 {
+			t.Fatalf("Expected 1 success, got %d", iam.successes)
+		}
+	})
+
+	t.Run("falls-back-when-primary-errors", func(t *testing.T) {
+		iam.err = errors.New("no credentials")
+		defer func() { iam.err = nil }()
+
+		if got := authenticate(t, f); got != "ec2" {
+			t.Fatalf("Expected method %q, got %q", "ec2", got)
+		}
+		f.CredSuccess()
+	})
+
+	t.Run("falls-back-when-login-rejected", func(t *testing.T) {
+		if got := authenticate(t, f); got != "iam" {
+			t.Fatalf("Expected method %q, got %q", "iam", got)
+		}
+		// No CredSuccess: Vault rejected the login
+		if got := authenticate(t, f); got != "ec2" {
+			t.Fatalf("Expected method %q, got %q", "ec2", got)
+		}
+		f.CredSuccess()
+	})
+
+	t.Run("switches-after-failure-budget-is-spent", func(t *testing.T) {
+		if f.health.Preferred != "ec2" {
+			t.Fatalf("Expected preferred method %q, got %q", "ec2", f.health.Preferred)
+		}
+
+		// Even though IAM works again, EC2 stays preferred during the hold
+		// period, and the state is shared with other invocations
+		g := newMethod()
+		if got := authenticate(t, g); got != "ec2" {
+			t.Fatalf("Expected method %q, got %q", "ec2", got)
+		}
+		g.CredSuccess()
+	})
+
+	t.Run("returns-to-primary-after-hold", func(t *testing.T) {
+		clk.Advance(2 * time.Hour)
+		if got := authenticate(t, f); got != "iam" {
+			t.Fatalf("Expected method %q, got %q", "iam", got)
+		}
+		f.CredSuccess()
+	})
+
+	t.Run("all-fail", func(t *testing.T) {
+		iam.err = errors.New("no credentials")
+		ec2.err = errors.New("IMDS blocked")
+		defer func() { iam.err, ec2.err = nil, nil }()
+
+		_, _, _, err := f.Authenticate(context.Background(), nil)
+		expected := "all authentication methods failed: iam: no credentials; ec2: IMDS blocked"
+		if err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q, got %v", expected, err)
+		}
+	})
+}
+
+func TestFailoverMethod_Health(t *testing.T) {
+	path := filepath.Join(t.TempDir(), awsHealthFile)
+
+	iam := &mockAuthMethod{path: "iam"}
+	ec2 := &mockAuthMethod{path: "ec2"}
+	newMethod := func() *failoverMethod {
+		return newFailoverMethod(hclog.NewNullLogger(), clock.System(), []string{"iam", "ec2"},
+			map[string]auth.AuthMethod{"iam": iam, "ec2": ec2}, 10, time.Hour, path)
+	}
+
+	failures := func(t *testing.T) map[string]int {
+		t.Helper()
+
+		return loadMethodHealth(hclog.NewNullLogger(), path).Failures
+	}
+
+	t.Run("concurrent-invocations", func(t *testing.T) {
+		iam.err = errors.New("no credentials")
+		defer func() { iam.err = nil }()
+
+		// Both invocations load the health before either records a
+		// failure, but neither failure is lost
+		f, g := newMethod(), newMethod()
+
+		for _, m := range []*failoverMethod{f, g} {
+			if _, _, _, err := m.Authenticate(context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+			m.CredSuccess()
+		}
+
+		if got := failures(t); got["iam"] != 2 {
+			t.Fatalf("Expected 2 failures of iam, got %v", got)
+		}
+	})
+
+	t.Run("unconfirmed-login", func(t *testing.T) {
+		// The helper gives up before Vault accepts or rejects the login
+		f := newMethod()
+		if _, _, _, err := f.Authenticate(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		f.Shutdown()
+
+		if got := failures(t); got["iam"] != 3 {
+			t.Fatalf("Expected the unconfirmed login to be a failure of iam, got %v", got)
+		}
+	})
+
+	t.Run("success-resets-failures", func(t *testing.T) {
+		f := newMethod()
+		if _, _, _, err := f.Authenticate(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		f.CredSuccess()
+		f.Shutdown()
+
+		if got := failures(t); got["iam"] != 0 {
+			t.Fatalf("Expected the failures of iam to be reset, got %v", got)
+		}
+	})
+}
+
+func TestNewAWSFailoverMethod(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{
+			name: "ec2-only-available",
+			config: map[string]interface{}{
+				"type":          "ec2",
+				"role":          "dev-role",
+				"fallback_type": "ec2",
+			},
+		},
+		{
+			name: "bad-fallback-type",
+			config: map[string]interface{}{
+				"type":          "iam",
+				"fallback_type": 1,
+			},
+			err: "could not convert 'fallback_type' config value to string",
+		},
+		{
+			name: "bad-threshold",
+			config: map[string]interface{}{
+				"type":              "iam",
+				"fallback_type":     "ec2",
+				"failure_threshold": 0,
+			},
+			err: "'failure_threshold' must be a positive integer",
+		},
+		{
+			name: "bad-hold",
+			config: map[string]interface{}{
+				"type":          "iam",
+				"fallback_type": "ec2",
+				"fallback_hold": "a while",
+			},
+			err: `error parsing 'fallback_hold': time: invalid duration "a while"`,
+		},
+		{
+			name: "none-available",
+			config: map[string]interface{}{
+				"type":              "iam",
+				"fallback_type":     "gce",
+				"role":              "dev-role",
+				"credential_source": "sso",
+			},
+			err: "no aws auth method could be created",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method, err := newAWSFailoverMethod(&auth.AuthConfig{
+				Logger:    hclog.NewNullLogger(),
+				MountPath: "auth/aws",
+				Config:    tc.config,
+			}, MethodOptions{CacheDir: t.TempDir()})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if len(err.Error()) < len(tc.err) || err.Error()[:len(tc.err)] != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			method.Shutdown()
+		})
+	}
+}
+
+type mockAuthMethod struct {
+	path      string
+	err       error
+	successes int
+}
+
+func (m *mockAuthMethod) Authenticate(context.Context, *api.Client) (string, http.Header, map[string]interface{}, error) {
+	if m.err != nil {
+		return "", nil, nil, m.err
+	}
+	return m.path, nil, map[string]interface{}{}, nil
+}
+
+func (m *mockAuthMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *mockAuthMethod) CredSuccess() {
+	m.successes++
+}
+
+func (m *mockAuthMethod) Shutdown() {}
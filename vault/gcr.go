@@ -0,0 +1,155 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/gcpauth"
+)
+
+// GCROptions configures how access tokens of Container Registry and
+// Artifact Registry are obtained.
+type GCROptions struct {
+	HTTPClient *http.Client
+
+	// Clock, if set, is the clock by which access tokens are minted and
+	// the lease duration is capped. Otherwise, the system clock is used.
+	Clock clock.Clock
+}
+
+// NewGCROptions parses the 'gcr_token_mode' field of the auth method
+// config. It returns nil if the GCR token mode is not enabled.
+func NewGCROptions(config map[string]interface{}) (*GCROptions, error) {
+	raw, ok := config["gcr_token_mode"]
+	if !ok {
+		return nil, nil
+	}
+
+	enabled, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return nil, xerrors.New("'gcr_token_mode' must be a boolean")
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+
+	return &GCROptions{}, nil
+}
+
+// GetGCRCredentials reads the secret at path and returns the credentials
+// with which Docker logs in to Container Registry and Artifact Registry
+// with an OAuth access token. The secret may be either
+//
+//   - an access token generated by the gcp secrets engine, read from its
+//     'token' and 'expires_at_seconds' fields, or
+//   - a service account key, either generated by the gcp secrets engine
+//     (base64-encoded in its 'private_key_data' field) or stored as the
+//     fields of the JSON key, which is used to mint an access token.
+//
+// The lease duration of the returned credentials never exceeds the
+// expiration of the token, which is also returned as their expiration.
+func GetGCRCredentials(ctx context.Context, path string, client *api.Client, opts GCROptions) (Credentials, error) {
+	secret, err := client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return Credentials{}, xerrors.Errorf("error reading secret: %w", err)
+	}
+
+	if secret == nil {
+		return Credentials{}, xerrors.Errorf("No secret found in Vault at path %q", path)
+	}
+
+	fields := secret.Data
+	if _, isKvv2 := secret.Data["metadata"].(map[string]interface{}); isKvv2 {
+		fields, _ = secret.Data["data"].(map[string]interface{})
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = clock.System()
+	}
+
+	token, err := gcrToken(ctx, fields, opts)
+	if err != nil {
+		return Credentials{}, xerrors.Errorf("error getting access token from secret at path %q: %w", path, err)
+	}
+
+	leaseDuration := time.Duration(secret.LeaseDuration) * time.Second
+	if untilExpiry := token.Expires.Sub(opts.Clock.Now()); !token.Expires.IsZero() &&
+		(leaseDuration <= 0 || untilExpiry < leaseDuration) {
+		leaseDuration = untilExpiry
+	}
+
+	return Credentials{
+		Username: gcpauth.RegistryUsername,
+		Password: token.AccessToken,
+		Fields:   fields,
+
+		LeaseID:       secret.LeaseID,
+		LeaseDuration: leaseDuration,
+		Renewable:     secret.Renewable,
+		Expires:       token.Expires,
+	}, nil
+}
+
+// gcrToken returns the access token in the fields of a secret or minted
+// with the service account key in them.
+func gcrToken(ctx context.Context, fields map[string]interface{}, opts GCROptions) (gcpauth.Token, error) {
+	if accessToken, ok := fields["token"].(string); ok && accessToken != "" {
+		token := gcpauth.Token{AccessToken: accessToken}
+
+		if raw, ok := fields["expires_at_seconds"]; ok {
+			expires, err := parseutil.ParseInt(raw)
+			if err != nil {
+				return gcpauth.Token{}, xerrors.Errorf("error parsing 'expires_at_seconds': %w", err)
+			}
+
+			token.Expires = time.Unix(expires, 0)
+		}
+
+		return token, nil
+	}
+
+	var data []byte
+
+	if encoded, ok := fields["private_key_data"].(string); ok {
+		var err error
+
+		if data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return gcpauth.Token{}, xerrors.Errorf("error decoding 'private_key_data': %w", err)
+		}
+	} else {
+		var err error
+
+		if data, err = json.Marshal(fields); err != nil {
+			return gcpauth.Token{}, err
+		}
+	}
+
+	key, err := gcpauth.ParseServiceAccountKey(data)
+	if err != nil {
+		return gcpauth.Token{}, xerrors.New("secret contains neither a 'token' nor a service account key")
+	}
+
+	return gcpauth.AccessToken(ctx, opts.HTTPClient, opts.Clock, key)
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+func TestNewGCROptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		expected *GCROptions
+		err      string
+	}{
+		{
+			name:   "not-set",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "disabled",
+			config: map[string]interface{}{"gcr_token_mode": false},
+		},
+		{
+			name:     "enabled",
+			config:   map[string]interface{}{"gcr_token_mode": "true"},
+			expected: &GCROptions{},
+		},
+		{
+			name:   "invalid",
+			config: map[string]interface{}{"gcr_token_mode": "sometimes"},
+			err:    "'gcr_token_mode' must be a boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewGCROptions(tc.config)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, opts); diff != "" {
+				t.Fatalf("Options differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetGCRCredentials(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"minted token","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer tokenServer.Close()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := map[string]interface{}{
+		"type":         "service_account",
+		"client_email": "ci@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenServer.URL,
+	}
+
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("gcp/roleset/registry/token", map[string]interface{}{
+			"token":              "engine token",
+			"expires_at_seconds": expires.Unix(),
+			"token_ttl":          1800,
+		}),
+		vaultlogintest.WithDynamicSecret("gcp/roleset/registry/key", map[string]interface{}{
+			"private_key_data": base64.StdEncoding.EncodeToString(keyJSON),
+			"key_type":         "TYPE_GOOGLE_CREDENTIALS_FILE",
+		}, 2*time.Hour),
+		vaultlogintest.WithKVv2("secret/data/gcr", key),
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	clk := clock.NewFake(expires.Add(-30 * time.Minute))
+	opts := GCROptions{HTTPClient: tokenServer.Client(), Clock: clk}
+
+	cases := []struct {
+		name     string
+		path     string
+		password string
+		leased   bool
+		lease    time.Duration
+		err      string
+	}{
+		{
+			name:     "engine-token",
+			path:     "gcp/roleset/registry/token",
+			password: "engine token",
+			lease:    30 * time.Minute,
+		},
+		{
+			name:     "engine-key",
+			path:     "gcp/roleset/registry/key",
+			password: "minted token",
+			leased:   true,
+			lease:    time.Hour,
+		},
+		{
+			name:     "stored-key",
+			path:     "secret/data/gcr",
+			password: "minted token",
+			lease:    time.Hour,
+		},
+		{
+			name: "not-gcp-credentials",
+			path: "secret/docker/creds",
+			err: `error getting access token from secret at path "secret/docker/creds": ` +
+				`secret contains neither a 'token' nor a service account key`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			creds, err := GetGCRCredentials(context.Background(), tc.path, client, opts)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if creds.Username != "oauth2accesstoken" || creds.Password != tc.password {
+				t.Fatalf("Expected credentials %q/%q, got %q/%q", "oauth2accesstoken", tc.password,
+					creds.Username, creds.Password)
+			}
+			if creds.Expires.IsZero() || creds.LeaseDuration != tc.lease {
+				t.Fatalf("Expected the credentials to expire with the token, got expiration %s and lease %s",
+					creds.Expires, creds.LeaseDuration)
+			}
+			if leased := creds.LeaseID != ""; leased != tc.leased {
+				t.Fatalf("Expected leased to be %v, got lease ID %q", tc.leased, creds.LeaseID)
+			}
+		})
+	}
+}
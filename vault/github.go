@@ -0,0 +1,117 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EnvAuthGitHubToken is the GitHub personal access token used by the
+	// github authentication method. It is also read by the Vault CLI.
+	EnvAuthGitHubToken = "VAULT_AUTH_GITHUB_TOKEN"
+
+	// EnvGitHubToken is the GitHub token used by the github
+	// authentication method if neither EnvAuthGitHubToken nor a token file
+	// is set.
+	EnvGitHubToken = "GITHUB_TOKEN"
+)
+
+// githubMethod authenticates to the github authentication method with a
+// personal access token.
+type githubMethod struct {
+	logger    hclog.Logger
+	mountPath string
+	tokenFile string
+}
+
+func newGitHubAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	m := &githubMethod{logger: conf.Logger, mountPath: conf.MountPath}
+
+	if raw, exists := conf.Config["token_file_path"]; exists {
+		path, ok := raw.(string)
+		if !ok || path == "" {
+			return nil, xerrors.New("'token_file_path' must be a non-empty string")
+		}
+
+		path, err := homedir.Expand(path)
+		if err != nil {
+			return nil, xerrors.Errorf("error expanding 'token_file_path' %s: %w", path, err)
+		}
+
+		m.tokenFile = path
+	}
+
+	return m, nil
+}
+
+// Authenticate reads the token from EnvAuthGitHubToken, the token file or
+// EnvGitHubToken, in that order. The token file is read on every login so
+// that a rotated token is picked up.
+func (m *githubMethod) Authenticate(context.Context, *api.Client) (string, http.Header, map[string]interface{}, error) {
+	token, err := m.token()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return m.mountPath + "/login", nil, map[string]interface{}{"token": token}, nil
+}
+
+func (m *githubMethod) token() (string, error) {
+	if token := os.Getenv(EnvAuthGitHubToken); token != "" {
+		return token, nil
+	}
+
+	if m.tokenFile != "" {
+		data, err := os.ReadFile(m.tokenFile) // nolint: gosec
+		if err != nil {
+			return "", xerrors.Errorf("error reading GitHub token file: %w", err)
+		}
+
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", xerrors.Errorf("GitHub token file %s is empty", m.tokenFile)
+		}
+
+		return token, nil
+	}
+
+	if token := os.Getenv(EnvGitHubToken); token != "" {
+		return token, nil
+	}
+
+	return "", xerrors.Errorf("no GitHub token provided: set %s, %s or the 'token_file_path' config value",
+		EnvAuthGitHubToken, EnvGitHubToken)
+}
+
+func (m *githubMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *githubMethod) CredSuccess() {}
+
+func (m *githubMethod) Shutdown() {}
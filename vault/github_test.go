@@ -0,0 +1,135 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestGitHubMethod_Authenticate(t *testing.T) {
+	dir := t.TempDir()
+
+	tokenFile := filepath.Join(dir, "github-token")
+	if err := os.WriteFile(tokenFile, []byte("ghp_file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		env    map[string]string
+		token  string
+		err    string
+	}{
+		{
+			name:   "vault-env",
+			config: map[string]interface{}{"token_file_path": tokenFile},
+			env:    map[string]string{EnvAuthGitHubToken: "ghp_vault", EnvGitHubToken: "ghp_github"},
+			token:  "ghp_vault",
+		},
+		{
+			name:   "file",
+			config: map[string]interface{}{"token_file_path": tokenFile},
+			env:    map[string]string{EnvGitHubToken: "ghp_github"},
+			token:  "ghp_file",
+		},
+		{
+			name:   "github-env",
+			config: map[string]interface{}{},
+			env:    map[string]string{EnvGitHubToken: "ghp_github"},
+			token:  "ghp_github",
+		},
+		{
+			name:   "no-token",
+			config: map[string]interface{}{},
+			err:    "no GitHub token provided: set VAULT_AUTH_GITHUB_TOKEN, GITHUB_TOKEN or the 'token_file_path' config value",
+		},
+		{
+			name:   "empty-file",
+			config: map[string]interface{}{"token_file_path": emptyFile},
+			err:    "GitHub token file " + emptyFile + " is empty",
+		},
+		{
+			name:   "missing-file",
+			config: map[string]interface{}{"token_file_path": filepath.Join(dir, "missing")},
+			err: "error reading GitHub token file: open " + filepath.Join(dir, "missing") +
+				": no such file or directory",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvAuthGitHubToken, tc.env[EnvAuthGitHubToken])
+			t.Setenv(EnvGitHubToken, tc.env[EnvGitHubToken])
+
+			method, err := BuildAuthMethod(&config.Method{
+				Type:      "github",
+				MountPath: "auth/github",
+				Config:    tc.config,
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, _, data, err := method.Authenticate(context.Background(), nil)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != "auth/github/login" {
+				t.Fatalf("Expected path %q, got %q", "auth/github/login", path)
+			}
+			if diff := cmp.Diff(map[string]interface{}{"token": tc.token}, data); diff != "" {
+				t.Fatalf("Data differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewGitHubAuthMethod_BadTokenFile(t *testing.T) {
+	_, err := BuildAuthMethod(&config.Method{
+		Type:      "github",
+		MountPath: "auth/github",
+		Config:    map[string]interface{}{"token_file_path": 1},
+	}, hclog.NewNullLogger(), MethodOptions{})
+
+	if err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+
+	expected := "error creating github auth method: 'token_file_path' must be a non-empty string"
+	if err.Error() != expected {
+		t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, err.Error()))
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DefaultHCPNamespace is the namespace in which HCP Vault clusters
+	// give their users access.
+	DefaultHCPNamespace = "admin"
+
+	// hcpHostSuffix is the suffix of the hosts of HCP Vault clusters.
+	hcpHostSuffix = ".hashicorp.cloud"
+)
+
+// The endpoints of an HCP Vault cluster. Their hosts only differ by the
+// name of the endpoint, e.g. vault-cluster-public-vault-0123abcd.
+const (
+	HCPEndpointPublic  = "public"
+	HCPEndpointPrivate = "private"
+)
+
+// HCPOptions configures the client for an HCP Vault cluster.
+type HCPOptions struct {
+	// Namespace is the namespace in which requests are made unless
+	// VAULT_NAMESPACE is set.
+	Namespace string
+
+	// Endpoint, if set, is the endpoint of the cluster which is used
+	// regardless of the one in the Vault address.
+	Endpoint string
+
+	// JWTAudience, if set, is the audience which the JWT of the jwt auth
+	// method must be issued for.
+	JWTAudience string
+}
+
+// NewHCPOptions parses the 'hcp', 'hcp_namespace', 'hcp_endpoint' and
+// 'hcp_jwt_audience' fields of the auth method config. It returns nil if
+// the HCP mode is not enabled.
+func NewHCPOptions(config map[string]interface{}) (*HCPOptions, error) {
+	raw, ok := config["hcp"]
+	if !ok {
+		return nil, nil
+	}
+
+	enabled, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return nil, xerrors.New("'hcp' must be a boolean")
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+
+	opts := &HCPOptions{Namespace: DefaultHCPNamespace}
+
+	for key, v := range map[string]*string{
+		"hcp_namespace":    &opts.Namespace,
+		"hcp_endpoint":     &opts.Endpoint,
+		"hcp_jwt_audience": &opts.JWTAudience,
+	} {
+		if raw, ok = config[key]; !ok {
+			continue
+		}
+
+		s, ok := raw.(string)
+		if !ok || s == "" {
+			return nil, xerrors.Errorf("'%s' must be a non-empty string", key)
+		}
+
+		*v = s
+	}
+
+	switch opts.Endpoint {
+	case "", HCPEndpointPublic, HCPEndpointPrivate:
+	default:
+		return nil, xerrors.Errorf("'hcp_endpoint' must be either %q or %q", HCPEndpointPublic, HCPEndpointPrivate)
+	}
+
+	return opts, nil
+}
+
+// ConfigureHCP configures the client for an HCP Vault cluster: requests
+// are made in the namespace of the options unless VAULT_NAMESPACE is set,
+// and the endpoint of the options is used. If the auth method is jwt, the
+// audience of its JWT is checked so that a mismatch is reported before
+// Vault rejects the login. If opts is nil, the client is left alone.
+func ConfigureHCP(client *api.Client, method *config.Method, opts *HCPOptions, logger hclog.Logger) error {
+	if opts == nil {
+		return nil
+	}
+
+	if client.Namespace() == "" {
+		client.SetNamespace(opts.Namespace)
+	}
+
+	if opts.Endpoint != "" {
+		addr, err := hcpEndpointAddress(client.Address(), opts.Endpoint)
+		if err != nil {
+			return err
+		}
+
+		if addr != client.Address() {
+			logger.Debug("using HCP Vault endpoint", "endpoint", opts.Endpoint, "address", addr)
+
+			if err = client.SetAddress(addr); err != nil {
+				return xerrors.Errorf("error setting Vault address: %w", err)
+			}
+		}
+	}
+
+	if method.Type == "jwt" && opts.JWTAudience != "" {
+		if err := checkJWTAudience(method.Config, opts.JWTAudience); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hcpEndpointAddress returns the address of the endpoint of the HCP Vault
+// cluster at addr.
+func hcpEndpointAddress(addr, endpoint string) (string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", xerrors.Errorf("error parsing Vault address: %w", err)
+	}
+
+	host := u.Hostname()
+	if !strings.HasSuffix(host, hcpHostSuffix) {
+		return "", xerrors.Errorf("Vault address %q is not the address of an HCP Vault cluster", addr)
+	}
+
+	for _, name := range []string{HCPEndpointPublic, HCPEndpointPrivate} {
+		host = strings.Replace(host, "-"+name+"-vault-", "-"+endpoint+"-vault-", 1)
+	}
+
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+
+	u.Host = host
+
+	return u.String(), nil
+}
+
+// checkJWTAudience verifies that the JWT in the file at the 'path' field of
+// the jwt auth method config was issued for the audience. The signature of
+// the JWT is not verified.
+func checkJWTAudience(methodConfig map[string]interface{}, audience string) error {
+	path, ok := methodConfig["path"].(string)
+	if !ok || path == "" {
+		return nil
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		// The file may only be written later, so leave it to the auth method
+		return nil
+	}
+
+	segments := strings.Split(strings.TrimSpace(string(data)), ".")
+	if len(segments) != 3 {
+		return xerrors.Errorf("file %q does not contain a JWT", path)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return xerrors.Errorf("error decoding JWT in file %q: %w", path, err)
+	}
+
+	var claims struct {
+		Audience interface{} `json:"aud"`
+	}
+
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return xerrors.Errorf("error decoding JWT in file %q: %w", path, err)
+	}
+
+	var audiences []string
+
+	switch aud := claims.Audience.(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	for _, aud := range audiences {
+		if aud == audience {
+			return nil
+		}
+	}
+
+	return xerrors.Errorf("JWT in file %q was issued for audiences %q, not %q: request a JWT for "+
+		"the audience bound to the role in Vault", path, audiences, audience)
+}
@@ -0,0 +1,221 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+const testHCPAddress = "https://vault-cluster-public-vault-0123abcd.4567ef89.z1.hashicorp.cloud:8200"
+
+func TestNewHCPOptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		expected *HCPOptions
+		err      string
+	}{
+		{
+			name:   "not-set",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "disabled",
+			config: map[string]interface{}{"hcp": "false"},
+		},
+		{
+			name:     "defaults",
+			config:   map[string]interface{}{"hcp": true},
+			expected: &HCPOptions{Namespace: "admin"},
+		},
+		{
+			name: "configured",
+			config: map[string]interface{}{
+				"hcp":              true,
+				"hcp_namespace":    "admin/team",
+				"hcp_endpoint":     "private",
+				"hcp_jwt_audience": "https://github.com/example",
+			},
+			expected: &HCPOptions{
+				Namespace:   "admin/team",
+				Endpoint:    "private",
+				JWTAudience: "https://github.com/example",
+			},
+		},
+		{
+			name:   "invalid",
+			config: map[string]interface{}{"hcp": "cloud"},
+			err:    "'hcp' must be a boolean",
+		},
+		{
+			name:   "empty-namespace",
+			config: map[string]interface{}{"hcp": true, "hcp_namespace": ""},
+			err:    "'hcp_namespace' must be a non-empty string",
+		},
+		{
+			name:   "invalid-endpoint",
+			config: map[string]interface{}{"hcp": true, "hcp_endpoint": "internal"},
+			err:    `'hcp_endpoint' must be either "public" or "private"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewHCPOptions(tc.config)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, opts); diff != "" {
+				t.Fatalf("Options differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConfigureHCP(t *testing.T) {
+	newClient := func(t *testing.T) *api.Client {
+		t.Helper()
+
+		client, err := api.NewClient(api.DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = client.SetAddress(testHCPAddress); err != nil {
+			t.Fatal(err)
+		}
+
+		return client
+	}
+
+	method := &config.Method{Type: "approle"}
+
+	t.Run("nil", func(t *testing.T) {
+		client := newClient(t)
+		if err := ConfigureHCP(client, method, nil, hclog.NewNullLogger()); err != nil {
+			t.Fatal(err)
+		}
+		if ns := client.Namespace(); ns != "" {
+			t.Fatalf("Expected no namespace, got %q", ns)
+		}
+	})
+
+	t.Run("private-endpoint", func(t *testing.T) {
+		client := newClient(t)
+		opts := &HCPOptions{Namespace: "admin", Endpoint: HCPEndpointPrivate}
+
+		if err := ConfigureHCP(client, method, opts, hclog.NewNullLogger()); err != nil {
+			t.Fatal(err)
+		}
+		if ns := client.Namespace(); ns != "admin" {
+			t.Fatalf("Expected namespace %q, got %q", "admin", ns)
+		}
+
+		expected := "https://vault-cluster-private-vault-0123abcd.4567ef89.z1.hashicorp.cloud:8200"
+		if addr := client.Address(); addr != expected {
+			t.Fatalf("Expected address %q, got %q", expected, addr)
+		}
+	})
+
+	t.Run("namespace-set", func(t *testing.T) {
+		client := newClient(t)
+		client.SetNamespace("admin/team")
+
+		if err := ConfigureHCP(client, method, &HCPOptions{Namespace: "admin"}, hclog.NewNullLogger()); err != nil {
+			t.Fatal(err)
+		}
+		if ns := client.Namespace(); ns != "admin/team" {
+			t.Fatalf("Expected namespace %q, got %q", "admin/team", ns)
+		}
+	})
+
+	t.Run("not-hcp", func(t *testing.T) {
+		client := newClient(t)
+		if err := client.SetAddress("https://vault.example.com:8200"); err != nil {
+			t.Fatal(err)
+		}
+
+		err := ConfigureHCP(client, method, &HCPOptions{Namespace: "admin", Endpoint: HCPEndpointPublic},
+			hclog.NewNullLogger())
+
+		expected := `Vault address "https://vault.example.com:8200" is not the address of an HCP Vault cluster`
+		if err == nil || err.Error() != expected {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, fmt.Sprint(err)))
+		}
+	})
+}
+
+func TestConfigureHCP_JWTAudience(t *testing.T) {
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":["https://github.com/example","sts"]}`))
+
+	if err := os.WriteFile(jwtFile, []byte("eyJhbGciOiJSUzI1NiJ9."+payload+".signature\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method := &config.Method{Type: "jwt", Config: map[string]interface{}{"path": jwtFile}}
+
+	cases := []struct {
+		audience string
+		err      string
+	}{
+		{
+			audience: "https://github.com/example",
+		},
+		{
+			audience: "vault",
+			err: fmt.Sprintf(`JWT in file %q was issued for audiences ["https://github.com/example" "sts"], `+
+				`not "vault": request a JWT for the audience bound to the role in Vault`, jwtFile),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.audience, func(t *testing.T) {
+			err := ConfigureHCP(client, method, &HCPOptions{Namespace: "admin", JWTAudience: tc.audience},
+				hclog.NewNullLogger())
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/xerrors"
+)
+
+// ProxyOptions configures the HTTP proxy through which the client reaches
+// Vault. The settings which are not set are taken from the HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY environment variables.
+type ProxyOptions struct {
+	// URL is the proxy through which requests are sent. It may hold the
+	// username and password of an authenticated proxy.
+	URL *url.URL
+
+	// NoProxy lists the hosts which are reached directly, in the format
+	// of NO_PROXY.
+	NoProxy string
+}
+
+// NewProxyOptions parses the 'proxy_url' and 'no_proxy' fields of the auth
+// method config. 'no_proxy' is a comma-separated string or a list of
+// hosts. It returns nil if neither is set.
+func NewProxyOptions(config map[string]interface{}) (*ProxyOptions, error) {
+	var opts ProxyOptions
+
+	rawURL, hasURL := config["proxy_url"]
+	rawNoProxy, hasNoProxy := config["no_proxy"]
+
+	if !hasURL && !hasNoProxy {
+		return nil, nil
+	}
+
+	if hasURL {
+		s, ok := rawURL.(string)
+		if !ok || s == "" {
+			return nil, xerrors.New("'proxy_url' must be a non-empty string")
+		}
+
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, xerrors.New("'proxy_url' must be a valid URL")
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, xerrors.New("'proxy_url' must be an http, https or socks5 URL")
+		}
+
+		if u.Host == "" {
+			return nil, xerrors.New("'proxy_url' must have a host")
+		}
+
+		opts.URL = u
+	}
+
+	if hasNoProxy {
+		switch v := rawNoProxy.(type) {
+		case string:
+			opts.NoProxy = v
+		case []interface{}:
+			hosts := make([]string, 0, len(v))
+
+			for _, host := range v {
+				s, ok := host.(string)
+				if !ok || s == "" {
+					return nil, xerrors.New("'no_proxy' must be a string or a list of non-empty strings")
+				}
+
+				hosts = append(hosts, s)
+			}
+
+			opts.NoProxy = strings.Join(hosts, ",")
+		default:
+			return nil, xerrors.New("'no_proxy' must be a string or a list of non-empty strings")
+		}
+	}
+
+	return &opts, nil
+}
+
+// configureProxy makes the transport send requests through the proxy of
+// the options. The VAULT_PROXY_ADDR and VAULT_HTTP_PROXY environment
+// variables, which the Vault API reads itself, take precedence.
+func configureProxy(clientConfig *api.Config, opts *ProxyOptions) error {
+	if opts == nil || os.Getenv(api.EnvVaultProxyAddr) != "" || os.Getenv(api.EnvHTTPProxy) != "" {
+		return nil
+	}
+
+	transport, ok := clientConfig.HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return xerrors.New("the proxy cannot be configured on the transport of the Vault client")
+	}
+
+	proxyConfig := httpproxy.FromEnvironment()
+
+	if opts.URL != nil {
+		proxyConfig.HTTPProxy = opts.URL.String()
+		proxyConfig.HTTPSProxy = opts.URL.String()
+	}
+
+	if opts.NoProxy != "" {
+		proxyConfig.NoProxy = opts.NoProxy
+	}
+
+	proxyFunc := proxyConfig.ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+)
+
+// awsLoginParameters are the parameters of the login endpoint of the aws
+// auth method, which the login metadata must not override.
+var awsLoginParameters = map[string]bool{
+	"role":                    true,
+	"iam_http_request_method": true,
+	"iam_request_url":         true,
+	"iam_request_headers":     true,
+	"iam_request_body":        true,
+	"identity":                true,
+	"signature":               true,
+	"pkcs7":                   true,
+	"nonce":                   true,
+}
+
+// loginMetadataMethod adds the key-value pairs of the 'login_metadata'
+// field of the method config to the data of every login request, so that
+// the Vault audit log attributes the login to e.g. a host or CI job.
+type loginMetadataMethod struct {
+	auth.AuthMethod
+
+	metadata map[string]string
+}
+
+// withLoginMetadata wraps the aws auth method so that the key-value pairs
+// of the 'login_metadata' field of the method config are sent with every
+// login. If the field is not set, the method is returned as is.
+func withLoginMetadata(method auth.AuthMethod, config map[string]interface{}) (auth.AuthMethod, error) {
+	raw, ok := config["login_metadata"]
+	if !ok {
+		return method, nil
+	}
+
+	// HCL decodes maps as lists of maps
+	if list, isList := raw.([]map[string]interface{}); isList && len(list) == 1 {
+		raw = list[0]
+	}
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		return nil, xerrors.New("'login_metadata' must be a non-empty map of strings")
+	}
+
+	metadata := make(map[string]string, len(obj))
+
+	for key, v := range obj {
+		value, ok := v.(string)
+		if !ok || key == "" {
+			return nil, xerrors.New("'login_metadata' must be a non-empty map of strings")
+		}
+
+		if awsLoginParameters[key] {
+			return nil, xerrors.Errorf("'login_metadata' must not set the login parameter %q", key)
+		}
+
+		metadata[key] = value
+	}
+
+	return &loginMetadataMethod{AuthMethod: method, metadata: metadata}, nil
+}
+
+// Authenticate returns the login data of the wrapped method with the login
+// metadata. Environment variables in the values are expanded on every
+// login; $HOSTNAME defaults to the hostname of the host.
+func (m *loginMetadataMethod) Authenticate(ctx context.Context, client *api.Client) (string, http.Header, map[string]interface{}, error) { // nolint: lll
+	path, header, data, err := m.AuthMethod.Authenticate(ctx, client)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if data == nil {
+		data = make(map[string]interface{}, len(m.metadata))
+	}
+
+	for key, value := range m.metadata {
+		data[key] = os.Expand(value, expandLoginMetadata)
+	}
+
+	return path, header, data, nil
+}
+
+// expandLoginMetadata returns the value of the environment variable. If
+// HOSTNAME is not set, which it usually is not outside of interactive
+// shells, the hostname of the host is used.
+func expandLoginMetadata(name string) string {
+	if value, ok := os.LookupEnv(name); ok || name != "HOSTNAME" {
+		return value
+	}
+
+	hostname, _ := os.Hostname()
+
+	return hostname
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWithLoginMetadata(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CI_JOB_ID", "1234")
+
+	// Unset HOSTNAME, but restore it when the test ends
+	t.Setenv("HOSTNAME", "")
+	os.Unsetenv("HOSTNAME") // nolint: errcheck
+
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "not-set",
+			config:   map[string]interface{}{},
+			expected: map[string]interface{}{},
+		},
+		{
+			name: "hcl",
+			config: map[string]interface{}{
+				"login_metadata": []map[string]interface{}{
+					{"job": "ci-${CI_JOB_ID}", "host": "$HOSTNAME", "team": "platform"},
+				},
+			},
+			expected: map[string]interface{}{"job": "ci-1234", "host": hostname, "team": "platform"},
+		},
+		{
+			name: "json",
+			config: map[string]interface{}{
+				"login_metadata": map[string]interface{}{"team": "platform"},
+			},
+			expected: map[string]interface{}{"team": "platform"},
+		},
+		{
+			name:   "not-map",
+			config: map[string]interface{}{"login_metadata": "team=platform"},
+			err:    "'login_metadata' must be a non-empty map of strings",
+		},
+		{
+			name: "not-string",
+			config: map[string]interface{}{
+				"login_metadata": map[string]interface{}{"job": 1234},
+			},
+			err: "'login_metadata' must be a non-empty map of strings",
+		},
+		{
+			name: "login-parameter",
+			config: map[string]interface{}{
+				"login_metadata": map[string]interface{}{"role": "admin"},
+			},
+			err: `'login_metadata' must not set the login parameter "role"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method, err := withLoginMetadata(&mockAuthMethod{path: "auth/aws/login"}, tc.config)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, _, data, err := method.Authenticate(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != "auth/aws/login" {
+				t.Fatalf("Expected path %q, got %q", "auth/aws/login", path)
+			}
+			if diff := cmp.Diff(tc.expected, data); diff != "" {
+				t.Fatalf("Login data differ:\n%s", diff)
+			}
+		})
+	}
+}
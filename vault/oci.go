@@ -0,0 +1,196 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/oracle/oci-go-sdk/common"
+	ociauth "github.com/oracle/oci-go-sdk/common/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+const (
+	// EnvOCIConfigFile is the OCI CLI configuration file read by the oci
+	// authentication method with API keys.
+	EnvOCIConfigFile = "OCI_CONFIG_FILE"
+
+	ociTypeAPIKey   = "apikey"
+	ociTypeInstance = "instance"
+
+	defaultOCIConfigFile = "~/.oci/config"
+	defaultOCIProfile    = "DEFAULT"
+)
+
+// ociMethod authenticates to the oci authentication method with a request
+// signed by an OCI API key or the instance principal of the host. Unlike the
+// oci method of the Vault agent, the request is signed for the address of
+// the client at every login, so that it follows a change of the address.
+type ociMethod struct {
+	logger     hclog.Logger
+	clock      clock.Clock
+	mountPath  string
+	role       string
+	authType   string
+	configFile string
+	profile    string
+
+	mu          sync.Mutex
+	provider    common.ConfigurationProvider
+	newProvider func() (common.ConfigurationProvider, error)
+}
+
+func newOCIAuthMethod(conf *auth.AuthConfig, clk clock.Clock) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	m := &ociMethod{
+		logger:     conf.Logger,
+		clock:      clk,
+		mountPath:  conf.MountPath,
+		configFile: defaultOCIConfigFile,
+		profile:    defaultOCIProfile,
+	}
+
+	if path := os.Getenv(EnvOCIConfigFile); path != "" {
+		m.configFile = path
+	}
+
+	for field, value := range map[string]*string{
+		"role":             &m.role,
+		"type":             &m.authType,
+		"config_file_path": &m.configFile,
+		"profile":          &m.profile,
+	} {
+		raw, ok := conf.Config[field]
+		if !ok {
+			continue
+		}
+
+		s, ok := raw.(string)
+		if !ok || s == "" {
+			return nil, xerrors.Errorf("'%s' must be a non-empty string", field)
+		}
+
+		*value = s
+	}
+
+	if m.role == "" {
+		return nil, xerrors.New("'role' must be set")
+	}
+
+	switch m.authType {
+	case ociTypeAPIKey:
+		path, err := homedir.Expand(m.configFile)
+		if err != nil {
+			return nil, xerrors.Errorf("error expanding 'config_file_path' %s: %w", m.configFile, err)
+		}
+
+		m.configFile = path
+		m.newProvider = m.apiKeyProvider
+	case ociTypeInstance:
+		m.newProvider = ociauth.InstancePrincipalConfigurationProvider
+	default:
+		return nil, xerrors.Errorf("unsupported 'type' %q: must be either %s or %s", m.authType,
+			ociTypeAPIKey, ociTypeInstance)
+	}
+
+	return m, nil
+}
+
+// apiKeyProvider reads the API key from the OCI_ environment variables
+// or, failing that, from the profile of the OCI CLI configuration file.
+func (m *ociMethod) apiKeyProvider() (common.ConfigurationProvider, error) {
+	providers := []common.ConfigurationProvider{common.ConfigurationProviderEnvironmentVariables("OCI", "")}
+
+	if file, err := common.ConfigurationProviderFromFileWithProfile(m.configFile, m.profile, ""); err == nil {
+		providers = append(providers, file)
+	}
+
+	return common.ComposingConfigurationProvider(providers)
+}
+
+// Authenticate signs a request for the login endpoint of the role, whose
+// headers Vault verifies with OCI. The configuration provider is created
+// at the first login, as the instance principal provider contacts the
+// instance metadata service.
+func (m *ociMethod) Authenticate(_ context.Context, client *api.Client) (string, http.Header, map[string]interface{}, error) { // nolint: lll
+	provider, err := m.configurationProvider()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	address, err := url.Parse(client.Address())
+	if err != nil {
+		return "", nil, nil, xerrors.Errorf("error parsing Vault address: %w", err)
+	}
+
+	requestPath := fmt.Sprintf("/v1/%s/login/%s", m.mountPath, m.role)
+
+	request, err := http.NewRequest(http.MethodGet, client.Address()+requestPath, nil)
+	if err != nil {
+		return "", nil, nil, xerrors.Errorf("error creating OCI login request: %w", err)
+	}
+
+	request.Header.Set("Date", m.clock.Now().UTC().Format(http.TimeFormat))
+
+	if err = common.DefaultRequestSigner(provider).Sign(request); err != nil {
+		return "", nil, nil, xerrors.Errorf("error signing OCI login request: %w", err)
+	}
+
+	request.Header.Set("Host", address.Host)
+	request.Header.Set("(request-target)", "get "+requestPath)
+
+	return fmt.Sprintf("%s/login/%s", m.mountPath, m.role), nil, map[string]interface{}{
+		"request_headers": request.Header,
+	}, nil
+}
+
+func (m *ociMethod) configurationProvider() (common.ConfigurationProvider, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.provider != nil {
+		return m.provider, nil
+	}
+
+	provider, err := m.newProvider()
+	if err != nil {
+		return nil, xerrors.Errorf("error loading OCI credentials: %w", err)
+	}
+
+	m.provider = provider
+
+	return provider, nil
+}
+
+func (m *ociMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *ociMethod) CredSuccess() {}
+
+func (m *ociMethod) Shutdown() {}
@@ -0,0 +1,201 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestNewOCIAuthMethod(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "apikey",
+			config: map[string]interface{}{"role": "docker", "type": "apikey", "profile": "BUILD"},
+		},
+		{
+			name:   "instance",
+			config: map[string]interface{}{"role": "docker", "type": "instance"},
+		},
+		{
+			name:   "no-role",
+			config: map[string]interface{}{"type": "instance"},
+			err:    "error creating oci auth method: 'role' must be set",
+		},
+		{
+			name:   "bad-type",
+			config: map[string]interface{}{"role": "docker", "type": "user"},
+			err:    `error creating oci auth method: unsupported 'type' "user": must be either apikey or instance`,
+		},
+		{
+			name:   "bad-profile",
+			config: map[string]interface{}{"role": "docker", "type": "apikey", "profile": ""},
+			err:    "error creating oci auth method: 'profile' must be a non-empty string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := BuildAuthMethod(&config.Method{
+				Type:      "oci",
+				MountPath: "auth/oci",
+				Config:    tc.config,
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOCIMethod_Authenticate(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(dir, "key.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(dir, "config")
+	if err = os.WriteFile(configFile, []byte(`[DEFAULT]
+user=ocid1.user.oc1..default
+fingerprint=aa:aa
+tenancy=ocid1.tenancy.oc1..example
+region=us-ashburn-1
+key_file=`+keyFile+`
+
+[BUILD]
+user=ocid1.user.oc1..build
+fingerprint=bb:bb
+tenancy=ocid1.tenancy.oc1..example
+region=us-ashburn-1
+key_file=`+keyFile+`
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		profile string
+		file    string
+		keyID   string
+		err     string
+	}{
+		{
+			name:  "default-profile",
+			file:  configFile,
+			keyID: "ocid1.tenancy.oc1..example/ocid1.user.oc1..default/aa:aa",
+		},
+		{
+			name:    "profile",
+			profile: "BUILD",
+			file:    configFile,
+			keyID:   "ocid1.tenancy.oc1..example/ocid1.user.oc1..build/bb:bb",
+		},
+		{
+			name: "missing-file",
+			file: filepath.Join(dir, "missing"),
+			err:  "error signing OCI login request",
+		},
+	}
+
+	client := newTestClient(t, "https://vault.example.com:8200")
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvOCIConfigFile, tc.file)
+
+			conf := map[string]interface{}{"role": "docker", "type": "apikey"}
+			if tc.profile != "" {
+				conf["profile"] = tc.profile
+			}
+
+			method, err := BuildAuthMethod(&config.Method{
+				Type:      "oci",
+				MountPath: "auth/oci",
+				Config:    conf,
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, _, data, err := method.Authenticate(context.Background(), client)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if !strings.HasPrefix(err.Error(), tc.err) {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if path != "auth/oci/login/docker" {
+				t.Fatalf("Expected path %q, got %q", "auth/oci/login/docker", path)
+			}
+
+			headers, ok := data["request_headers"].(http.Header)
+			if !ok {
+				t.Fatalf("Expected request headers, got %#v", data)
+			}
+
+			if got := headers.Get("(request-target)"); got != "get /v1/auth/oci/login/docker" {
+				t.Fatalf("Expected request target %q, got %q", "get /v1/auth/oci/login/docker", got)
+			}
+
+			if got := headers.Get("Host"); got != "vault.example.com:8200" {
+				t.Fatalf("Expected host %q, got %q", "vault.example.com:8200", got)
+			}
+
+			if !strings.Contains(headers.Get("Authorization"), `keyId="`+tc.keyID+`"`) {
+				t.Fatalf("Expected the request to be signed with key %s, got %q", tc.keyID,
+					headers.Get("Authorization"))
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/messages"
+)
+
+const (
+	// DefaultOIDCAuthTimeout is how long the user has to complete the
+	// login in the browser, unless 'auth_timeout' is set.
+	DefaultOIDCAuthTimeout = 2 * time.Minute
+
+	defaultOIDCListenAddress = "localhost"
+	defaultOIDCPort          = 8250
+	oidcCallbackPath         = "/oidc/callback"
+)
+
+// oidcCallback is the result of the redirect from the OIDC provider.
+type oidcCallback struct {
+	token string
+	err   error
+}
+
+// oidcMethod authenticates to the oidc authentication method interactively.
+// The user logs in to the OIDC provider in a browser, which is redirected to
+// a listener on the local host with the authorization code.
+type oidcMethod struct {
+	logger        hclog.Logger
+	mountPath     string
+	role          string
+	listenAddress string
+	port          int
+	callbackHost  string
+	callbackPort  int
+	skipBrowser   bool
+	openBrowser   func(url string) error
+	notify        func(message string) error
+	msgs          *messages.Catalog
+}
+
+func newOIDCAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) { // nolint: gocyclo
+	if conf == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	m := &oidcMethod{
+		logger:        conf.Logger,
+		mountPath:     conf.MountPath,
+		listenAddress: defaultOIDCListenAddress,
+		port:          defaultOIDCPort,
+		callbackHost:  defaultOIDCListenAddress,
+		openBrowser:   openBrowser,
+		notify:        notifyTTY,
+		msgs:          messages.FromEnv(),
+	}
+
+	for field, value := range map[string]*string{
+		"role":           &m.role,
+		"listen_address": &m.listenAddress,
+		"callback_host":  &m.callbackHost,
+	} {
+		raw, ok := conf.Config[field]
+		if !ok {
+			continue
+		}
+
+		s, ok := raw.(string)
+		if !ok || s == "" {
+			return nil, xerrors.Errorf("'%s' must be a non-empty string", field)
+		}
+
+		*value = s
+	}
+
+	for field, value := range map[string]*int{
+		"port":          &m.port,
+		"callback_port": &m.callbackPort,
+	} {
+		raw, ok := conf.Config[field]
+		if !ok {
+			continue
+		}
+
+		port, err := parseutil.ParseInt(raw)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, xerrors.Errorf("'%s' must be a port number", field)
+		}
+
+		*value = int(port)
+	}
+
+	if m.callbackPort == 0 {
+		m.callbackPort = m.port
+	}
+
+	if raw, ok := conf.Config["skip_browser"]; ok {
+		skip, err := parseutil.ParseBool(raw)
+		if err != nil {
+			return nil, xerrors.Errorf("error parsing 'skip_browser': %w", err)
+		}
+
+		m.skipBrowser = skip
+	}
+
+	return m, nil
+}
+
+// Authenticate runs the OIDC authorization code flow. Vault returns the
+// URL at which the user logs in, which is opened in a browser or printed on
+// the controlling terminal. The token issued by Vault once the browser is
+// redirected back is looked up, as with the token_file method, rather than
+// logged in with.
+func (m *oidcMethod) Authenticate(ctx context.Context, client *api.Client) (string, http.Header, map[string]interface{}, error) { // nolint: lll
+	listener, err := net.Listen("tcp", net.JoinHostPort(m.listenAddress, strconv.Itoa(m.port)))
+	if err != nil {
+		return "", nil, nil, xerrors.Errorf("error listening for the OIDC callback: %w", err)
+	}
+
+	defer listener.Close() //nolint:errcheck
+
+	nonce, err := oidcNonce()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	redirectURI := fmt.Sprintf("http://%s%s", net.JoinHostPort(m.callbackHost, strconv.Itoa(m.callbackPort)),
+		oidcCallbackPath)
+
+	secret, err := client.Logical().WriteWithContext(ctx, m.mountPath+"/oidc/auth_url", map[string]interface{}{
+		"role":         m.role,
+		"redirect_uri": redirectURI,
+		"client_nonce": nonce,
+	})
+	if err != nil {
+		return "", nil, nil, xerrors.Errorf("error requesting the OIDC auth URL: %w", err)
+	}
+
+	var authURL string
+	if secret != nil {
+		authURL, _ = secret.Data["auth_url"].(string)
+	}
+
+	if authURL == "" {
+		return "", nil, nil, xerrors.Errorf("Vault returned no OIDC auth URL: check that %s is an allowed "+
+			"redirect URI of the role", redirectURI)
+	}
+
+	callbacks := make(chan oidcCallback, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		result := m.exchange(ctx, client, r.URL.Query(), nonce)
+		if result.err != nil {
+			http.Error(w, m.msgs.Sprintf(messages.OIDCLoginFailed, result.err), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, m.msgs.Sprintf(messages.OIDCSignedIn)) //nolint:errcheck
+		}
+
+		select {
+		case callbacks <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener) //nolint:errcheck
+
+	defer server.Close() //nolint:errcheck
+
+	m.prompt(authURL)
+
+	select {
+	case <-ctx.Done():
+		return "", nil, nil, xerrors.Errorf("timed out waiting for the OIDC login to complete: %w", ctx.Err())
+	case result := <-callbacks:
+		if result.err != nil {
+			return "", nil, nil, result.err
+		}
+
+		return "auth/token/lookup-self", nil, map[string]interface{}{"token": result.token}, nil
+	}
+}
+
+// exchange completes the login with the parameters of the redirect from
+// the OIDC provider.
+func (m *oidcMethod) exchange(ctx context.Context, client *api.Client, query url.Values, nonce string) oidcCallback {
+	if msg := query.Get("error"); msg != "" {
+		if desc := query.Get("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+
+		return oidcCallback{err: xerrors.Errorf("OIDC provider returned an error: %s", msg)}
+	}
+
+	secret, err := client.Logical().ReadWithDataWithContext(ctx, m.mountPath+"/oidc/callback", map[string][]string{
+		"state":        {query.Get("state")},
+		"code":         {query.Get("code")},
+		"id_token":     {query.Get("id_token")},
+		"client_nonce": {nonce},
+	})
+	if err != nil {
+		return oidcCallback{err: xerrors.Errorf("error completing the OIDC login: %w", err)}
+	}
+
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return oidcCallback{err: xerrors.New("Vault returned no token for the OIDC login")}
+	}
+
+	return oidcCallback{token: secret.Auth.ClientToken}
+}
+
+// prompt tells the user where to log in. The terminal is used because stdin
+// and stdout are reserved for the credential helper protocol.
+func (m *oidcMethod) prompt(authURL string) {
+	code := messages.OIDCBrowserPrompt
+
+	if m.skipBrowser {
+		code = messages.OIDCURLPrompt
+	} else if err := m.openBrowser(authURL); err != nil {
+		m.logger.Warn("error opening browser", "error", err)
+	}
+
+	if err := m.notify(fmt.Sprintf("%s\n\n    %s\n\n", m.msgs.Sprintf(code), authURL)); err != nil {
+		m.logger.Warn("error writing the OIDC auth URL to the terminal", "auth_url", authURL, "error", err)
+	}
+}
+
+func (m *oidcMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *oidcMethod) CredSuccess() {}
+
+func (m *oidcMethod) Shutdown() {}
+
+// oidcNonce returns a random nonce which binds the callback to the request
+// for the auth URL.
+func oidcNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", xerrors.Errorf("error generating OIDC client nonce: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// openBrowser opens the URL with the default browser of the platform.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go cmd.Wait() //nolint:errcheck
+
+	return nil
+}
+
+// notifyTTY writes the message to the controlling terminal.
+func notifyTTY(message string) error {
+	tty, err := os.OpenFile(ttyPath, os.O_WRONLY, 0)
+	if err != nil {
+		return xerrors.Errorf("error opening terminal: %w", err)
+	}
+
+	defer tty.Close() //nolint:errcheck
+
+	_, err = fmt.Fprint(tty, message)
+
+	return err
+}
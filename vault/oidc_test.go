@@ -0,0 +1,336 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/messages"
+)
+
+func TestNewOIDCAuthMethod(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "defaults",
+			config: map[string]interface{}{},
+		},
+		{
+			name: "all",
+			config: map[string]interface{}{
+				"role":           "docker",
+				"listen_address": "127.0.0.1",
+				"port":           "8300",
+				"callback_host":  "workstation.example.com",
+				"callback_port":  8400,
+				"skip_browser":   true,
+			},
+		},
+		{
+			name:   "bad-role",
+			config: map[string]interface{}{"role": 1},
+			err:    "error creating oidc auth method: 'role' must be a non-empty string",
+		},
+		{
+			name:   "bad-port",
+			config: map[string]interface{}{"port": 70000},
+			err:    "error creating oidc auth method: 'port' must be a port number",
+		},
+		{
+			name:   "bad-skip-browser",
+			config: map[string]interface{}{"skip_browser": "sometimes"},
+			err: "error creating oidc auth method: error parsing 'skip_browser': cannot parse '' as bool: " +
+				`strconv.ParseBool: parsing "sometimes": invalid syntax`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := BuildAuthMethod(&config.Method{
+				Type:      "oidc",
+				MountPath: "auth/oidc",
+				Config:    tc.config,
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOIDCMethod_Authenticate(t *testing.T) {
+	cases := []struct {
+		name        string
+		authURL     bool
+		callback    url.Values
+		skipBrowser bool
+		locale      string
+		prompt      string
+		err         string
+	}{
+		{
+			name:     "browser",
+			authURL:  true,
+			callback: url.Values{"state": {"st_1"}, "code": {"c_1"}},
+			prompt:   "Complete the Vault login in your browser. If it does not open, visit:",
+		},
+		{
+			name:        "skip-browser",
+			authURL:     true,
+			callback:    url.Values{"state": {"st_1"}, "code": {"c_1"}},
+			skipBrowser: true,
+			prompt:      "Open the following URL in a browser to log in to Vault:",
+		},
+		{
+			name:        "skip-browser-localized",
+			authURL:     true,
+			callback:    url.Values{"state": {"st_1"}, "code": {"c_1"}},
+			skipBrowser: true,
+			locale:      "fr",
+			prompt:      "Ouvrez l'URL suivante dans un navigateur pour vous connecter à Vault :",
+		},
+		{
+			name:     "wrong-state",
+			authURL:  true,
+			callback: url.Values{"state": {"st_2"}, "code": {"c_1"}},
+			err:      "error completing the OIDC login",
+		},
+		{
+			name:     "provider-error",
+			authURL:  true,
+			callback: url.Values{"error": {"access_denied"}, "error_description": {"user declined"}},
+			err:      "OIDC provider returned an error: access_denied: user declined",
+		},
+		{
+			name: "no-auth-url",
+			err:  "Vault returned no OIDC auth URL: check that http://localhost:%d/oidc/callback is an allowed redirect URI of the role", // nolint: lll
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			port := freePort(t)
+
+			var nonce string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/oidc/oidc/auth_url":
+					var body map[string]string
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					nonce = body["client_nonce"]
+
+					authURL := ""
+					if tc.authURL && body["role"] == "docker" {
+						authURL = "https://idp.example.com/authorize?state=st_1&redirect_uri=" +
+							url.QueryEscape(body["redirect_uri"])
+					}
+
+					fmt.Fprintf(w, `{"data":{"auth_url":%q}}`, authURL)
+				case "/v1/auth/oidc/oidc/callback":
+					q := r.URL.Query()
+					if q.Get("state") != "st_1" || q.Get("code") != "c_1" || q.Get("client_nonce") != nonce {
+						http.Error(w, `{"errors":["invalid state"]}`, http.StatusBadRequest)
+						return
+					}
+
+					fmt.Fprint(w, `{"auth":{"client_token":"hvs.oidc"}}`)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL)
+
+			// The fake browser follows the redirect of the OIDC provider
+			// to the listener
+			redirect := func(authURL string) error {
+				u, err := url.Parse(authURL)
+				if err != nil {
+					return err
+				}
+
+				go func() {
+					resp, err := http.Get(u.Query().Get("redirect_uri") + "?" + tc.callback.Encode())
+					if err == nil {
+						resp.Body.Close()
+					}
+				}()
+
+				return nil
+			}
+
+			var opened, notified string
+
+			method := &oidcMethod{
+				logger:        hclog.NewNullLogger(),
+				mountPath:     "auth/oidc",
+				role:          "docker",
+				listenAddress: "localhost",
+				port:          port,
+				callbackHost:  "localhost",
+				callbackPort:  port,
+				skipBrowser:   tc.skipBrowser,
+				openBrowser: func(authURL string) error {
+					opened = authURL
+					return redirect(authURL)
+				},
+				notify: func(message string) error {
+					notified = message
+					if tc.skipBrowser {
+						return redirect(authURL(message))
+					}
+					return nil
+				},
+				msgs: messages.New(tc.locale),
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			path, _, data, err := method.Authenticate(ctx, client)
+			if tc.err != "" {
+				expected := tc.err
+				if tc.name == "no-auth-url" {
+					expected = fmt.Sprintf(tc.err, port)
+				}
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if !strings.HasPrefix(err.Error(), expected) {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if path != "auth/token/lookup-self" {
+				t.Fatalf("Expected path %q, got %q", "auth/token/lookup-self", path)
+			}
+
+			if diff := cmp.Diff(map[string]interface{}{"token": "hvs.oidc"}, data); diff != "" {
+				t.Fatalf("Data differ:\n%s", diff)
+			}
+
+			if tc.skipBrowser && opened != "" {
+				t.Fatalf("Expected the browser not to be opened, got %q", opened)
+			}
+
+			if authURL(notified) == "" || !strings.HasPrefix(notified, tc.prompt+"\n") {
+				t.Fatalf("Expected the auth URL to be printed after %q, got %q", tc.prompt, notified)
+			}
+		})
+	}
+}
+
+func TestOIDCMethod_Authenticate_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"auth_url":"https://idp.example.com/authorize"}}`)
+	}))
+	defer server.Close()
+
+	method := &oidcMethod{
+		logger:        hclog.NewNullLogger(),
+		mountPath:     "auth/oidc",
+		listenAddress: "localhost",
+		port:          freePort(t),
+		callbackHost:  "localhost",
+		openBrowser:   func(string) error { return nil },
+		notify:        func(string) error { return nil },
+	}
+	method.callbackPort = method.port
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, _, _, err := method.Authenticate(ctx, newTestClient(t, server.URL))
+
+	expected := "timed out waiting for the OIDC login to complete: context deadline exceeded"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, fmt.Sprint(err)))
+	}
+}
+
+// authURL extracts the URL printed for the user.
+func authURL(message string) string {
+	for _, field := range strings.Fields(message) {
+		if u, err := url.Parse(field); err == nil && u.Scheme == "https" {
+			return field
+		}
+	}
+
+	return ""
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func newTestClient(t *testing.T, addr string) *api.Client {
+	t.Helper()
+
+	conf := api.DefaultConfig()
+	conf.Address = addr
+
+	client, err := api.NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetMaxRetries(0)
+
+	return client
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/messages"
+)
+
+const (
+	// EnvAuthUsername is the username used by the userpass and ldap
+	// authentication methods.
+	EnvAuthUsername = "DCVL_AUTH_USERNAME"
+
+	// EnvAuthPassword is the password used by the userpass and ldap
+	// authentication methods.
+	EnvAuthPassword = "DCVL_AUTH_PASSWORD"
+
+	ttyPath = "/dev/tty"
+)
+
+// promptFunc asks the user for a value. If hidden is true, the input
+// must not be echoed.
+type promptFunc func(prompt string, hidden bool) (string, error)
+
+// passwordMethod authenticates to the userpass or ldap authentication
+// methods. Both share the same login API.
+type passwordMethod struct {
+	logger    hclog.Logger
+	mountPath string
+	username  string
+	prompt    promptFunc
+	msgs      *messages.Catalog
+}
+
+func newPasswordAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	username := os.Getenv(EnvAuthUsername)
+	if username == "" {
+		if raw, exists := conf.Config["username"]; exists {
+			u, ok := raw.(string)
+			if !ok {
+				return nil, xerrors.New("could not convert 'username' config value to string")
+			}
+
+			username = u
+		}
+	}
+
+	return &passwordMethod{
+		logger:    conf.Logger,
+		mountPath: conf.MountPath,
+		username:  username,
+		prompt:    promptTTY,
+		msgs:      messages.FromEnv(),
+	}, nil
+}
+
+// Authenticate reads the password from the environment or, failing that,
+// prompts for it on the controlling terminal. The terminal is used
+// because stdin and stdout are reserved for the credential helper
+// protocol.
+func (p *passwordMethod) Authenticate(context.Context, *api.Client) (string, http.Header, map[string]interface{}, error) {
+	var err error
+
+	username := p.username
+	if username == "" {
+		username, err = p.prompt(p.msgs.Sprintf(messages.UsernamePrompt), false)
+		if err != nil {
+			return "", nil, nil, xerrors.Errorf("no username provided: set %s, the 'username' "+
+				"config value, or run from an interactive terminal: %w", EnvAuthUsername, err)
+		}
+	}
+
+	password := os.Getenv(EnvAuthPassword)
+	if password == "" {
+		password, err = p.prompt(p.msgs.Sprintf(messages.PasswordPrompt, username), true)
+		if err != nil {
+			return "", nil, nil, xerrors.Errorf("no password provided: set %s or run from an "+
+				"interactive terminal: %w", EnvAuthPassword, err)
+		}
+	}
+
+	if username == "" || password == "" {
+		return "", nil, nil, xerrors.New("username and password must not be empty")
+	}
+
+	return fmt.Sprintf("%s/login/%s", p.mountPath, username), nil, map[string]interface{}{
+		"password": password,
+	}, nil
+}
+
+func (p *passwordMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (p *passwordMethod) CredSuccess() {}
+
+func (p *passwordMethod) Shutdown() {}
+
+func promptTTY(prompt string, hidden bool) (string, error) {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", xerrors.Errorf("error opening terminal: %w", err)
+	}
+
+	defer tty.Close() //nolint:errcheck
+
+	fd := int(tty.Fd())
+	if !term.IsTerminal(fd) {
+		return "", xerrors.Errorf("%s is not a terminal", ttyPath)
+	}
+
+	if _, err = fmt.Fprint(tty, prompt); err != nil {
+		return "", xerrors.Errorf("error writing prompt: %w", err)
+	}
+
+	if hidden {
+		var value []byte
+
+		value, err = term.ReadPassword(fd)
+		fmt.Fprintln(tty) //nolint:errcheck
+
+		if err != nil {
+			return "", xerrors.Errorf("error reading from terminal: %w", err)
+		}
+
+		return string(value), nil
+	}
+
+	value, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return "", xerrors.Errorf("error reading from terminal: %w", err)
+	}
+
+	return strings.TrimSpace(value), nil
+}
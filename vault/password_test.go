@@ -0,0 +1,171 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+
+	"github.com/morningconsult/docker-credential-vault-login/messages"
+)
+
+func TestPasswordMethod_Authenticate(t *testing.T) {
+	noTTY := func(string, bool) (string, error) {
+		return "", errors.New("no terminal")
+	}
+
+	cases := []struct {
+		name     string
+		env      map[string]string
+		config   map[string]interface{}
+		prompt   promptFunc
+		path     string
+		password string
+		err      string
+	}{
+		{
+			name: "from-env",
+			env: map[string]string{
+				EnvAuthUsername: "jdoe",
+				EnvAuthPassword: "hunter2",
+			},
+			config:   map[string]interface{}{"username": "ignored"},
+			prompt:   noTTY,
+			path:     "auth/userpass/login/jdoe",
+			password: "hunter2",
+		},
+		{
+			name:   "username-from-config-password-prompted",
+			config: map[string]interface{}{"username": "jdoe"},
+			prompt: func(prompt string, hidden bool) (string, error) {
+				if !hidden {
+					return "", errors.New("password prompt must be hidden")
+				}
+				if prompt != "Vault password for jdoe: " {
+					return "", errors.New("unexpected prompt " + prompt)
+				}
+				return "hunter2", nil
+			},
+			path:     "auth/userpass/login/jdoe",
+			password: "hunter2",
+		},
+		{
+			name: "prompt-localized",
+			env:  map[string]string{messages.EnvLocale: "de"},
+			prompt: func(prompt string, hidden bool) (string, error) {
+				if hidden {
+					if prompt != "Vault-Passwort für jdoe: " {
+						return "", errors.New("unexpected prompt " + prompt)
+					}
+					return "hunter2", nil
+				}
+				if prompt != "Vault-Benutzername: " {
+					return "", errors.New("unexpected prompt " + prompt)
+				}
+				return "jdoe", nil
+			},
+			path:     "auth/userpass/login/jdoe",
+			password: "hunter2",
+		},
+		{
+			name: "both-prompted",
+			prompt: func(_ string, hidden bool) (string, error) {
+				if hidden {
+					return "hunter2", nil
+				}
+				return "jdoe", nil
+			},
+			path:     "auth/userpass/login/jdoe",
+			password: "hunter2",
+		},
+		{
+			name:   "no-username",
+			prompt: noTTY,
+			err: "no username provided: set DCVL_AUTH_USERNAME, the 'username' config value, " +
+				"or run from an interactive terminal: no terminal",
+		},
+		{
+			name:   "no-password",
+			config: map[string]interface{}{"username": "jdoe"},
+			prompt: noTTY,
+			err:    "no password provided: set DCVL_AUTH_PASSWORD or run from an interactive terminal: no terminal",
+		},
+		{
+			name:   "empty-password",
+			config: map[string]interface{}{"username": "jdoe"},
+			prompt: func(string, bool) (string, error) {
+				return "", nil
+			},
+			err: "username and password must not be empty",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvAuthUsername, "")
+			t.Setenv(EnvAuthPassword, "")
+			t.Setenv(messages.EnvLocale, messages.DefaultLocale)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			method, err := newPasswordAuthMethod(&auth.AuthConfig{
+				Logger:    hclog.NewNullLogger(),
+				MountPath: "auth/userpass",
+				Config:    tc.config,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			method.(*passwordMethod).prompt = tc.prompt
+
+			path, _, data, err := method.Authenticate(context.Background(), nil)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tc.path {
+				t.Errorf("Expected path %q, got %q", tc.path, path)
+			}
+			if data["password"] != tc.password {
+				t.Errorf("Expected password %q, got %q", tc.password, data["password"])
+			}
+		})
+	}
+}
+
+func TestNewPasswordAuthMethod_BadUsername(t *testing.T) {
+	t.Setenv(EnvAuthUsername, "")
+
+	_, err := newPasswordAuthMethod(&auth.AuthConfig{
+		Config: map[string]interface{}{"username": 1234},
+	})
+	expected := "could not convert 'username' config value to string"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %q, got %v", expected, err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// secretFields are the fields which are excluded from the checksum of a
+// secret so that the checksum can be stored in the configuration file.
+var secretFields = map[string]bool{
+	"password": true,
+}
+
+// ResponsePin describes what the secrets containing the Docker credentials
+// are expected to look like. It protects against reading a secret which
+// was accidentally overwritten or whose path was reused for something
+// else, which is easy to do in shared mounts.
+type ResponsePin struct {
+	// Keys is the expected set of keys of every secret.
+	Keys []string
+
+	// Checksums maps secret paths to the expected checksum of the
+	// non-secret fields of the secret at that path. See FieldsChecksum.
+	Checksums map[string]string
+}
+
+// NewResponsePin creates a ResponsePin from the 'pinned_keys' and
+// 'pinned_checksums' fields of the auth method config. If neither is set,
+// it returns nil.
+func NewResponsePin(config map[string]interface{}) (*ResponsePin, error) { // nolint: gocyclo
+	keysRaw, hasKeys := config["pinned_keys"]
+	checksumsRaw, hasChecksums := config["pinned_checksums"]
+
+	if !hasKeys && !hasChecksums {
+		return nil, nil
+	}
+
+	pin := &ResponsePin{}
+
+	if hasKeys {
+		keys, ok := keysRaw.([]interface{})
+		if !ok {
+			return nil, xerrors.New("'pinned_keys' must be a list of strings")
+		}
+
+		for _, k := range keys {
+			key, ok := k.(string)
+			if !ok || key == "" {
+				return nil, xerrors.New("'pinned_keys' must be a list of strings")
+			}
+
+			pin.Keys = append(pin.Keys, key)
+		}
+
+		sort.Strings(pin.Keys)
+	}
+
+	if hasChecksums {
+		// The HCL parser decodes maps as a list of maps
+		var checksums map[string]interface{}
+
+		switch v := checksumsRaw.(type) {
+		case map[string]interface{}:
+			checksums = v
+		case []map[string]interface{}:
+			checksums = make(map[string]interface{})
+			for _, m := range v {
+				for path, sum := range m {
+					checksums[path] = sum
+				}
+			}
+		default:
+			return nil, xerrors.New("'pinned_checksums' must be a map of secret paths to checksums")
+		}
+
+		pin.Checksums = make(map[string]string, len(checksums))
+
+		for path, sumRaw := range checksums {
+			sum, ok := sumRaw.(string)
+			if !ok || sum == "" {
+				return nil, xerrors.Errorf("pinned checksum of %q must be a non-empty string", path)
+			}
+
+			pin.Checksums[path] = strings.ToLower(sum)
+		}
+	}
+
+	return pin, nil
+}
+
+// Verify compares the fields of the secret read from path against the pin
+// and returns a description of every mismatch. A nil pin matches every
+// secret.
+func (p *ResponsePin) Verify(path string, fields map[string]interface{}) []string {
+	if p == nil {
+		return nil
+	}
+
+	var mismatches []string
+
+	if len(p.Keys) > 0 {
+		expected := make(map[string]bool, len(p.Keys))
+		for _, key := range p.Keys {
+			expected[key] = true
+		}
+
+		var missing, unexpected []string
+
+		for _, key := range p.Keys {
+			if _, ok := fields[key]; !ok {
+				missing = append(missing, key)
+			}
+		}
+
+		for key := range fields {
+			if !expected[key] {
+				unexpected = append(unexpected, key)
+			}
+		}
+
+		sort.Strings(unexpected)
+
+		if len(missing) > 0 {
+			mismatches = append(mismatches, "missing pinned keys: "+strings.Join(missing, ", "))
+		}
+
+		if len(unexpected) > 0 {
+			mismatches = append(mismatches, "unexpected keys: "+strings.Join(unexpected, ", "))
+		}
+	}
+
+	if expected, ok := p.Checksums[path]; ok {
+		if actual := FieldsChecksum(fields); actual != expected {
+			mismatches = append(mismatches, "checksum of non-secret fields is "+actual+
+				" but "+expected+" is pinned")
+		}
+	}
+
+	return mismatches
+}
+
+// FieldsChecksum returns the hex-encoded SHA-256 checksum of the JSON
+// encoding of the non-secret fields (i.e. all but the password) of a
+// secret. Since map keys are sorted when JSON-encoded, the checksum does
+// not depend on the order in which Vault returns the keys.
+func FieldsChecksum(fields map[string]interface{}) string {
+	public := make(map[string]interface{}, len(fields))
+
+	for k, v := range fields {
+		if !secretFields[k] {
+			public[k] = v
+		}
+	}
+
+	// The fields were decoded from JSON so they can always be encoded
+	data, _ := json.Marshal(public)
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
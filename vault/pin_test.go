@@ -0,0 +1,179 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewResponsePin(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		pin    *ResponsePin
+		err    string
+	}{
+		{
+			name:   "no-pin",
+			config: map[string]interface{}{"secret": "secret/docker/creds"},
+		},
+		{
+			name: "keys-and-checksums",
+			config: map[string]interface{}{
+				"pinned_keys": []interface{}{"username", "password", "email"},
+				"pinned_checksums": []map[string]interface{}{
+					{"secret/docker/creds": "ABCDEF"},
+				},
+			},
+			pin: &ResponsePin{
+				Keys:      []string{"email", "password", "username"},
+				Checksums: map[string]string{"secret/docker/creds": "abcdef"},
+			},
+		},
+		{
+			name: "bad-keys",
+			config: map[string]interface{}{
+				"pinned_keys": "username",
+			},
+			err: "'pinned_keys' must be a list of strings",
+		},
+		{
+			name: "bad-checksums",
+			config: map[string]interface{}{
+				"pinned_checksums": "abcdef",
+			},
+			err: "'pinned_checksums' must be a map of secret paths to checksums",
+		},
+		{
+			name: "bad-checksum",
+			config: map[string]interface{}{
+				"pinned_checksums": map[string]interface{}{"secret/docker/creds": 1},
+			},
+			err: `pinned checksum of "secret/docker/creds" must be a non-empty string`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pin, err := NewResponsePin(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.pin, pin) {
+				t.Fatalf("Pins differ:\n%v", cmp.Diff(tc.pin, pin))
+			}
+		})
+	}
+}
+
+func TestResponsePin_Verify(t *testing.T) {
+	fields := map[string]interface{}{
+		"username": "test@user.com",
+		"password": "correct horse battery staple",
+		"registry": "registry.example.com",
+	}
+	checksum := FieldsChecksum(fields)
+
+	cases := []struct {
+		name       string
+		pin        *ResponsePin
+		fields     map[string]interface{}
+		mismatches []string
+	}{
+		{
+			name:   "nil-pin",
+			fields: fields,
+		},
+		{
+			name: "matches",
+			pin: &ResponsePin{
+				Keys:      []string{"password", "registry", "username"},
+				Checksums: map[string]string{"secret/docker/creds": checksum},
+			},
+			fields: fields,
+		},
+		{
+			name: "password-rotated",
+			pin: &ResponsePin{
+				Checksums: map[string]string{"secret/docker/creds": checksum},
+			},
+			fields: map[string]interface{}{
+				"username": "test@user.com",
+				"password": "rotated",
+				"registry": "registry.example.com",
+			},
+		},
+		{
+			name: "keys-differ",
+			pin: &ResponsePin{
+				Keys: []string{"email", "password", "username"},
+			},
+			fields: fields,
+			mismatches: []string{
+				"missing pinned keys: email",
+				"unexpected keys: registry",
+			},
+		},
+		{
+			name: "clobbered",
+			pin: &ResponsePin{
+				Checksums: map[string]string{"secret/docker/creds": checksum},
+			},
+			fields: map[string]interface{}{
+				"username": "other@user.com",
+				"password": "correct horse battery staple",
+				"registry": "registry.example.com",
+			},
+			mismatches: []string{
+				"checksum of non-secret fields is " + FieldsChecksum(map[string]interface{}{
+					"username": "other@user.com",
+					"registry": "registry.example.com",
+				}) + " but " + checksum + " is pinned",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mismatches := tc.pin.Verify("secret/docker/creds", tc.fields)
+			if !cmp.Equal(tc.mismatches, mismatches) {
+				t.Fatalf("Mismatches differ:\n%v", cmp.Diff(tc.mismatches, mismatches))
+			}
+		})
+	}
+}
+
+func TestFieldsChecksum(t *testing.T) {
+	// echo -n '{"username":"test@user.com"}' | sha256sum
+	expected := "e1e13a60e2a8eaf9a72fefea9519cca39391b767c499f133ea05af542f414dfa"
+
+	got := FieldsChecksum(map[string]interface{}{
+		"username": "test@user.com",
+		"password": "correct horse battery staple",
+	})
+	if got != expected {
+		t.Fatalf("Checksums differ:\n%v", cmp.Diff(expected, got))
+	}
+}
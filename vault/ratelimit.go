@@ -0,0 +1,93 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+)
+
+// RateLimit describes the token bucket by which the requests made by the
+// client to Vault are limited, so that bursts of invocations don't overload
+// the Vault servers.
+type RateLimit struct {
+	// Rate is the number of requests per second.
+	Rate float64
+
+	// Burst is the number of requests which may be made at once before the
+	// rate applies.
+	Burst int
+}
+
+// NewRateLimit creates a RateLimit from the 'vault_rate_limit' and
+// 'vault_rate_burst' fields of the auth method config. Unless set, the
+// burst is the rate rounded up. If no rate is set, it returns nil.
+func NewRateLimit(config map[string]interface{}) (*RateLimit, error) {
+	raw, ok := config["vault_rate_limit"]
+	if !ok {
+		if _, ok = config["vault_rate_burst"]; ok {
+			return nil, xerrors.New("'vault_rate_burst' requires 'vault_rate_limit' to be set")
+		}
+
+		return nil, nil
+	}
+
+	rate, err := parseRate(raw)
+	if err != nil || rate <= 0 {
+		return nil, xerrors.New("'vault_rate_limit' must be a positive number of requests per second")
+	}
+
+	limit := &RateLimit{Rate: rate, Burst: int(math.Ceil(rate))}
+
+	if raw, ok := config["vault_rate_burst"]; ok {
+		burst, err := parseutil.ParseInt(raw)
+		if err != nil || burst < 1 {
+			return nil, xerrors.New("'vault_rate_burst' must be a positive integer")
+		}
+
+		limit.Burst = int(burst)
+	}
+
+	return limit, nil
+}
+
+// parseRate parses a number of requests per second, which may be given as
+// a number or a string.
+func parseRate(raw interface{}) (float64, error) {
+	switch v := raw.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		n, err := parseutil.ParseInt(raw)
+		return float64(n), err
+	}
+}
+
+// ConfigureRateLimit configures the client to wait for the limiter before
+// every request, including logins and secret reads. A nil limit
+// leaves the client's defaults in place, by which VAULT_RATE_LIMIT is
+// honored.
+func ConfigureRateLimit(client *api.Client, limit *RateLimit) {
+	if limit == nil {
+		return
+	}
+
+	client.SetLimiter(limit.Rate, limit.Burst)
+}
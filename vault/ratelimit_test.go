@@ -0,0 +1,119 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestNewRateLimit(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		limit  *RateLimit
+		err    string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "default-burst",
+			config: map[string]interface{}{"vault_rate_limit": 2.5},
+			limit:  &RateLimit{Rate: 2.5, Burst: 3},
+		},
+		{
+			name: "all-fields",
+			config: map[string]interface{}{
+				"vault_rate_limit": "10",
+				"vault_rate_burst": "20",
+			},
+			limit: &RateLimit{Rate: 10, Burst: 20},
+		},
+		{
+			name:   "integer-rate",
+			config: map[string]interface{}{"vault_rate_limit": 4},
+			limit:  &RateLimit{Rate: 4, Burst: 4},
+		},
+		{
+			name:   "bad-rate",
+			config: map[string]interface{}{"vault_rate_limit": "fast"},
+			err:    "'vault_rate_limit' must be a positive number of requests per second",
+		},
+		{
+			name:   "zero-rate",
+			config: map[string]interface{}{"vault_rate_limit": 0},
+			err:    "'vault_rate_limit' must be a positive number of requests per second",
+		},
+		{
+			name: "bad-burst",
+			config: map[string]interface{}{
+				"vault_rate_limit": 5,
+				"vault_rate_burst": 0,
+			},
+			err: "'vault_rate_burst' must be a positive integer",
+		},
+		{
+			name:   "burst-without-rate",
+			config: map[string]interface{}{"vault_rate_burst": 5},
+			err:    "'vault_rate_burst' requires 'vault_rate_limit' to be set",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			limit, err := NewRateLimit(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.limit, limit) {
+				t.Fatalf("Rate limits differ:\n%v", cmp.Diff(tc.limit, limit))
+			}
+		})
+	}
+}
+
+func TestConfigureRateLimit(t *testing.T) {
+	client, err := api.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ConfigureRateLimit(client, nil)
+	if client.Limiter() != nil {
+		t.Fatal("expected no limiter")
+	}
+
+	ConfigureRateLimit(client, &RateLimit{Rate: 2, Burst: 5})
+
+	limiter := client.Limiter()
+	if limiter == nil {
+		t.Fatal("expected a limiter")
+	}
+	if limiter.Limit() != 2 || limiter.Burst() != 5 {
+		t.Fatalf("Expected a rate of 2 and a burst of 5, got %v and %d", limiter.Limit(), limiter.Burst())
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 500 * time.Millisecond
+	defaultRetryMaxBackoff  = 10 * time.Second
+)
+
+// RetryPolicy describes how requests to Vault which fail with a transient
+// error (a connection error, a 429 or a 5xx response) are retried. It
+// applies to every request made by the client, including logins and
+// secret reads.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is made,
+	// including the first attempt.
+	MaxAttempts int
+
+	// MinBackoff is the time waited before the first retry. The wait
+	// doubles with every retry, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter randomizes each wait between MinBackoff and the exponential
+	// backoff so that concurrent invocations don't retry in lockstep.
+	Jitter bool
+
+	// Rand, if set, is the source of the jitter. Otherwise, the jitter is
+	// random.
+	Rand clock.Rand
+}
+
+// NewRetryPolicy creates a RetryPolicy from the 'retry_max_attempts',
+// 'retry_min_backoff', 'retry_max_backoff' and 'retry_jitter' fields of
+// the auth method config. If none of them are set, it returns nil.
+func NewRetryPolicy(config map[string]interface{}) (*RetryPolicy, error) { // nolint: gocyclo
+	policy := &RetryPolicy{
+		MaxAttempts: defaultRetryMaxAttempts,
+		MinBackoff:  defaultRetryMinBackoff,
+		MaxBackoff:  defaultRetryMaxBackoff,
+		Jitter:      true,
+	}
+
+	found := false
+
+	if raw, ok := config["retry_max_attempts"]; ok {
+		attempts, err := parseutil.ParseInt(raw)
+		if err != nil || attempts < 1 {
+			return nil, xerrors.New("'retry_max_attempts' must be a positive integer")
+		}
+
+		policy.MaxAttempts = int(attempts)
+		found = true
+	}
+
+	if raw, ok := config["retry_min_backoff"]; ok {
+		backoff, err := parseutil.ParseDurationSecond(raw)
+		if err != nil || backoff <= 0 {
+			return nil, xerrors.New("'retry_min_backoff' must be a positive duration")
+		}
+
+		policy.MinBackoff = backoff
+		found = true
+	}
+
+	if raw, ok := config["retry_max_backoff"]; ok {
+		backoff, err := parseutil.ParseDurationSecond(raw)
+		if err != nil || backoff <= 0 {
+			return nil, xerrors.New("'retry_max_backoff' must be a positive duration")
+		}
+
+		policy.MaxBackoff = backoff
+		found = true
+	}
+
+	if raw, ok := config["retry_jitter"]; ok {
+		jitter, err := parseutil.ParseBool(raw)
+		if err != nil {
+			return nil, xerrors.New("'retry_jitter' must be a boolean")
+		}
+
+		policy.Jitter = jitter
+		found = true
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	if policy.MaxBackoff < policy.MinBackoff {
+		return nil, xerrors.New("'retry_max_backoff' must not be less than 'retry_min_backoff'")
+	}
+
+	return policy, nil
+}
+
+// ConfigureRetries configures the client to retry requests according to
+// the policy. Which errors are retried is left to the client's retry
+// policy. A nil policy leaves the client's defaults in place.
+func ConfigureRetries(client *api.Client, policy *RetryPolicy) {
+	if policy == nil {
+		return
+	}
+
+	client.SetMaxRetries(policy.MaxAttempts - 1)
+	client.SetMinRetryWait(policy.MinBackoff)
+	client.SetMaxRetryWait(policy.MaxBackoff)
+
+	if policy.Jitter {
+		random := policy.Rand
+		if random == nil {
+			random = clock.SystemRand()
+		}
+
+		client.SetBackoff(exponentialJitterBackoff(random))
+	} else {
+		client.SetBackoff(retryablehttp.DefaultBackoff)
+	}
+}
+
+// exponentialJitterBackoff returns a backoff which waits a random duration,
+// drawn from random, between min and the exponential backoff of the
+// attempt. As with the default backoff, the Retry-After header of 429 and
+// 503 responses is honored.
+func exponentialJitterBackoff(random clock.Rand) retryablehttp.Backoff {
+	return func(min, max time.Duration, attempt int, resp *http.Response) time.Duration {
+		if resp != nil && resp.Header.Get("Retry-After") != "" {
+			switch resp.StatusCode {
+			case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+				return retryablehttp.DefaultBackoff(min, max, attempt, resp)
+			}
+		}
+
+		backoff := retryablehttp.DefaultBackoff(min, max, attempt, nil)
+		if backoff <= min {
+			return min
+		}
+
+		return min + time.Duration(random.Int63n(int64(backoff-min)+1))
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		policy *RetryPolicy
+		err    string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "defaults",
+			config: map[string]interface{}{"retry_jitter": true},
+			policy: &RetryPolicy{
+				MaxAttempts: defaultRetryMaxAttempts,
+				MinBackoff:  defaultRetryMinBackoff,
+				MaxBackoff:  defaultRetryMaxBackoff,
+				Jitter:      true,
+			},
+		},
+		{
+			name: "all-fields",
+			config: map[string]interface{}{
+				"retry_max_attempts": "5",
+				"retry_min_backoff":  "250ms",
+				"retry_max_backoff":  "4s",
+				"retry_jitter":       "false",
+			},
+			policy: &RetryPolicy{
+				MaxAttempts: 5,
+				MinBackoff:  250 * time.Millisecond,
+				MaxBackoff:  4 * time.Second,
+			},
+		},
+		{
+			name:   "bad-max-attempts",
+			config: map[string]interface{}{"retry_max_attempts": 0},
+			err:    "'retry_max_attempts' must be a positive integer",
+		},
+		{
+			name:   "bad-min-backoff",
+			config: map[string]interface{}{"retry_min_backoff": "soon"},
+			err:    "'retry_min_backoff' must be a positive duration",
+		},
+		{
+			name:   "bad-max-backoff",
+			config: map[string]interface{}{"retry_max_backoff": "-1s"},
+			err:    "'retry_max_backoff' must be a positive duration",
+		},
+		{
+			name:   "bad-jitter",
+			config: map[string]interface{}{"retry_jitter": "sometimes"},
+			err:    "'retry_jitter' must be a boolean",
+		},
+		{
+			name: "max-backoff-less-than-min",
+			config: map[string]interface{}{
+				"retry_min_backoff": "2s",
+				"retry_max_backoff": "1s",
+			},
+			err: "'retry_max_backoff' must not be less than 'retry_min_backoff'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := NewRetryPolicy(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.policy, policy) {
+				t.Fatalf("Policies differ:\n%v", cmp.Diff(tc.policy, policy))
+			}
+		})
+	}
+}
+
+func TestConfigureRetries(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		policy   *RetryPolicy
+		requests int32
+		err      bool
+	}{
+		{
+			name:     "recovers",
+			statuses: []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK},
+			policy:   &RetryPolicy{MaxAttempts: 4, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Jitter: true},
+			requests: 3,
+		},
+		{
+			name:     "gives-up",
+			statuses: []int{http.StatusServiceUnavailable},
+			policy:   &RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			requests: 2,
+			err:      true,
+		},
+		{
+			name:     "no-retries",
+			statuses: []int{http.StatusInternalServerError},
+			policy:   &RetryPolicy{MaxAttempts: 1, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name:     "not-transient",
+			statuses: []int{http.StatusForbidden},
+			policy:   &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			requests: 1,
+			err:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&requests, 1))
+				if n > len(tc.statuses) {
+					n = len(tc.statuses)
+				}
+				w.WriteHeader(tc.statuses[n-1])
+			}))
+			defer server.Close()
+
+			client, err := api.NewClient(&api.Config{Address: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ConfigureRetries(client, tc.policy)
+
+			_, err = client.Logical().Read("secret/docker/creds")
+			if tc.err && err == nil {
+				t.Error("expected an error but didn't receive one")
+			}
+			if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if requests != tc.requests {
+				t.Errorf("Expected %d request(s), got %d", tc.requests, requests)
+			}
+		})
+	}
+}
+
+func TestExponentialJitterBackoff(t *testing.T) {
+	min, max := 100*time.Millisecond, time.Second
+	backoff := exponentialJitterBackoff(clock.SystemRand())
+
+	for attempt := 0; attempt < 10; attempt++ {
+		upper := min << uint(attempt)
+		if upper > max {
+			upper = max
+		}
+
+		for i := 0; i < 100; i++ {
+			wait := backoff(min, max, attempt, nil)
+			if wait < min || wait > upper {
+				t.Fatalf("Attempt %d: expected backoff between %s and %s, got %s", attempt, min, upper, wait)
+			}
+		}
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"3"}},
+	}
+	if wait := backoff(min, max, 0, resp); wait != 3*time.Second {
+		t.Fatalf("Expected backoff of %s from Retry-After header, got %s", 3*time.Second, wait)
+	}
+
+	t.Run("seeded", func(t *testing.T) {
+		waits := func() []time.Duration {
+			backoff := exponentialJitterBackoff(clock.NewSeededRand(42))
+
+			var waits []time.Duration
+			for attempt := 0; attempt < 5; attempt++ {
+				waits = append(waits, backoff(min, max, attempt, nil))
+			}
+
+			return waits
+		}
+
+		if diff := cmp.Diff(waits(), waits()); diff != "" {
+			t.Fatalf("Expected the same backoffs for the same seed:\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agentproxyshared/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/spiffe"
+)
+
+const (
+	spiffeTypeJWT  = "jwt"
+	spiffeTypeX509 = "x509"
+
+	defaultSPIFFEAudience = "vault"
+
+	// spiffeFetchTimeout is how long fetching an X.509-SVID may take, as
+	// the Vault agent gives no context for it.
+	spiffeFetchTimeout = 10 * time.Second
+)
+
+// svidSource fetches the SVIDs of the workload.
+type svidSource interface {
+	FetchJWTSVID(ctx context.Context, audience []string, spiffeID string) (*spiffe.JWTSVID, error)
+	FetchX509SVID(ctx context.Context, spiffeID string) (*spiffe.X509SVID, error)
+}
+
+// spiffeMethod is an auth method which logs in with an SVID fetched from
+// the SPIFFE Workload API: a JWT-SVID is given to the jwt auth method and
+// an X.509-SVID is presented as the client certificate to the cert auth
+// method.
+type spiffeMethod struct {
+	logger    hclog.Logger
+	mountPath string
+	svidType  string
+	role      string
+	audience  string
+	spiffeID  string
+	source    svidSource
+}
+
+func newSPIFFEAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) { // nolint: gocyclo
+	if conf == nil {
+		return nil, xerrors.New("empty config")
+	}
+
+	m := &spiffeMethod{
+		logger:    conf.Logger,
+		mountPath: conf.MountPath,
+		svidType:  spiffeTypeJWT,
+		audience:  defaultSPIFFEAudience,
+	}
+
+	for field, value := range map[string]*string{
+		"svid_type": &m.svidType,
+		"role":      &m.role,
+		"audience":  &m.audience,
+		"spiffe_id": &m.spiffeID,
+	} {
+		raw, ok := conf.Config[field]
+		if !ok {
+			continue
+		}
+
+		s, ok := raw.(string)
+		if !ok || s == "" {
+			return nil, xerrors.Errorf("'%s' must be a non-empty string", field)
+		}
+
+		*value = s
+	}
+
+	switch m.svidType {
+	case spiffeTypeJWT:
+		if m.role == "" {
+			return nil, xerrors.New("'role' must be set to log in with a JWT-SVID")
+		}
+	case spiffeTypeX509:
+	default:
+		return nil, xerrors.Errorf("unsupported 'svid_type' %q: must be either jwt or x509", m.svidType)
+	}
+
+	socket := os.Getenv(spiffe.EnvEndpointSocket)
+	if raw, ok := conf.Config["socket_path"]; ok {
+		if socket, ok = raw.(string); !ok {
+			return nil, xerrors.New("'socket_path' must be a string")
+		}
+	}
+
+	source, err := spiffe.NewClient(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	m.source = source
+
+	return m, nil
+}
+
+// Authenticate fetches a JWT-SVID and logs in with it. With an X.509-SVID,
+// the SVID was already fetched by AuthClient, so that the login request
+// only names the role of the cert auth method, if any.
+func (m *spiffeMethod) Authenticate(ctx context.Context, _ *api.Client) (string, http.Header, map[string]interface{}, error) { // nolint: lll
+	path := m.mountPath + "/login"
+
+	if m.svidType == spiffeTypeX509 {
+		data := map[string]interface{}{}
+		if m.role != "" {
+			data["name"] = m.role
+		}
+
+		return path, nil, data, nil
+	}
+
+	svid, err := m.source.FetchJWTSVID(ctx, []string{m.audience}, m.spiffeID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	m.logger.Debug("fetched JWT-SVID", "spiffe_id", svid.SPIFFEID)
+
+	return path, nil, map[string]interface{}{"role": m.role, "jwt": svid.Token}, nil
+}
+
+// AuthClient returns a client which presents the X.509-SVID of the
+// workload as its client certificate. With a JWT-SVID, the client is
+// returned as is.
+func (m *spiffeMethod) AuthClient(client *api.Client) (*api.Client, error) {
+	if m.svidType != spiffeTypeX509 {
+		return client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), spiffeFetchTimeout)
+	defer cancel()
+
+	svid, err := m.source.FetchX509SVID(ctx, m.spiffeID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Debug("fetched X.509-SVID", "spiffe_id", svid.SPIFFEID)
+
+	return clientWithCertificate(client, svid.TLSCertificate())
+}
+
+func (m *spiffeMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *spiffeMethod) CredSuccess() {}
+
+func (m *spiffeMethod) Shutdown() {}
+
+// clientWithCertificate returns a copy of client which presents cert as
+// its client certificate.
+func clientWithCertificate(client *api.Client, cert tls.Certificate) (*api.Client, error) {
+	config := client.CloneConfig()
+
+	transport, ok := config.HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, xerrors.Errorf("cannot add a client certificate to a transport of type %T",
+			config.HttpClient.Transport)
+	}
+
+	transport = transport.Clone()
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+	httpClient := *config.HttpClient
+	httpClient.Transport = transport
+	config.HttpClient = &httpClient
+
+	clone, err := api.NewClient(config)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating Vault client: %w", err)
+	}
+
+	clone.ClearToken()
+	clone.SetHeaders(client.Headers())
+	clone.SetNamespace(client.Namespace())
+
+	return clone, nil
+}
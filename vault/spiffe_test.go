@@ -0,0 +1,311 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/spiffe"
+)
+
+// fakeSVIDSource returns the same SVIDs to every request.
+type fakeSVIDSource struct {
+	jwt      *spiffe.JWTSVID
+	x509     *spiffe.X509SVID
+	audience []string
+	spiffeID string
+}
+
+func (s *fakeSVIDSource) FetchJWTSVID(_ context.Context, audience []string, spiffeID string) (*spiffe.JWTSVID, error) { // nolint: lll
+	s.audience, s.spiffeID = audience, spiffeID
+
+	if s.jwt == nil {
+		return nil, errors.New("no identity issued")
+	}
+
+	return s.jwt, nil
+}
+
+func (s *fakeSVIDSource) FetchX509SVID(_ context.Context, spiffeID string) (*spiffe.X509SVID, error) {
+	s.spiffeID = spiffeID
+
+	if s.x509 == nil {
+		return nil, errors.New("no identity issued")
+	}
+
+	return s.x509, nil
+}
+
+func TestNewSPIFFEAuthMethod(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		env    string
+		err    string
+	}{
+		{
+			name:   "jwt",
+			config: map[string]interface{}{"role": "docker", "socket_path": "unix:///run/spire/agent.sock"},
+		},
+		{
+			name:   "x509-from-env",
+			config: map[string]interface{}{"svid_type": "x509"},
+			env:    "unix:///run/spire/agent.sock",
+		},
+		{
+			name:   "no-socket",
+			config: map[string]interface{}{"svid_type": "x509"},
+			err: "error creating spiffe auth method: no Workload API address is configured and " +
+				"SPIFFE_ENDPOINT_SOCKET is not set",
+		},
+		{
+			name:   "jwt-without-role",
+			config: map[string]interface{}{"socket_path": "unix:///run/spire/agent.sock"},
+			err:    "error creating spiffe auth method: 'role' must be set to log in with a JWT-SVID",
+		},
+		{
+			name:   "bad-svid-type",
+			config: map[string]interface{}{"svid_type": "saml"},
+			err:    `error creating spiffe auth method: unsupported 'svid_type' "saml": must be either jwt or x509`,
+		},
+		{
+			name:   "bad-audience",
+			config: map[string]interface{}{"role": "docker", "audience": 1},
+			err:    "error creating spiffe auth method: 'audience' must be a non-empty string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(spiffe.EnvEndpointSocket, tc.env)
+
+			_, err := BuildAuthMethod(&config.Method{
+				Type:      "spiffe",
+				MountPath: "auth/jwt",
+				Config:    tc.config,
+			}, hclog.NewNullLogger(), MethodOptions{})
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSPIFFEMethod_Authenticate(t *testing.T) {
+	cases := []struct {
+		name     string
+		method   spiffeMethod
+		source   *fakeSVIDSource
+		path     string
+		data     map[string]interface{}
+		audience []string
+		err      string
+	}{
+		{
+			name: "jwt",
+			method: spiffeMethod{
+				mountPath: "auth/jwt",
+				svidType:  spiffeTypeJWT,
+				role:      "docker",
+				audience:  "vault.example.com",
+				spiffeID:  "spiffe://example.org/builder",
+			},
+			source: &fakeSVIDSource{
+				jwt: &spiffe.JWTSVID{SPIFFEID: "spiffe://example.org/builder", Token: "eyJhbGciOiJFUzI1NiJ9"},
+			},
+			path:     "auth/jwt/login",
+			data:     map[string]interface{}{"role": "docker", "jwt": "eyJhbGciOiJFUzI1NiJ9"},
+			audience: []string{"vault.example.com"},
+		},
+		{
+			name:   "x509",
+			method: spiffeMethod{mountPath: "auth/cert", svidType: spiffeTypeX509, role: "docker"},
+			source: &fakeSVIDSource{},
+			path:   "auth/cert/login",
+			data:   map[string]interface{}{"name": "docker"},
+		},
+		{
+			name:   "x509-without-role",
+			method: spiffeMethod{mountPath: "auth/cert", svidType: spiffeTypeX509},
+			source: &fakeSVIDSource{},
+			path:   "auth/cert/login",
+			data:   map[string]interface{}{},
+		},
+		{
+			name:   "no-identity",
+			method: spiffeMethod{mountPath: "auth/jwt", svidType: spiffeTypeJWT, role: "docker", audience: "vault"},
+			source: &fakeSVIDSource{},
+			err:    "no identity issued",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			method.logger = hclog.NewNullLogger()
+			method.source = tc.source
+
+			path, _, data, err := method.Authenticate(context.Background(), nil)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tc.path {
+				t.Fatalf("Paths differ:\n%v", cmp.Diff(tc.path, path))
+			}
+			if diff := cmp.Diff(tc.data, data); diff != "" {
+				t.Fatalf("Data differ:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.audience, tc.source.audience); diff != "" {
+				t.Fatalf("Audiences differ:\n%s", diff)
+			}
+			if tc.source.spiffeID != tc.method.spiffeID {
+				t.Fatalf("Expected SPIFFE ID %q, got %q", tc.method.spiffeID, tc.source.spiffeID)
+			}
+		})
+	}
+}
+
+func TestSPIFFEMethod_AuthClient(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, _ := url.Parse("spiffe://example.org/builder")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "builder"},
+		URIs:         []*url.URL{id},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cert auth method checks the client certificate of the TLS
+	// connection on which the login request is made
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/cert/login" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].URIs[0].String() != id.String() {
+			http.Error(w, `{"errors":["invalid certificate"]}`, http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprint(w, `{"auth":{"client_token":"hvs.spiffe"}}`)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	config.HttpClient = server.Client()
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetNamespace("team")
+	client.SetMaxRetries(0)
+
+	method := &spiffeMethod{
+		logger:    hclog.NewNullLogger(),
+		mountPath: "auth/cert",
+		svidType:  spiffeTypeX509,
+		source: &fakeSVIDSource{x509: &spiffe.X509SVID{
+			SPIFFEID:     id.String(),
+			Certificates: []*x509.Certificate{cert},
+			PrivateKey:   key,
+		}},
+	}
+
+	authClient, err := method.AuthClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if authClient.Namespace() != "team" {
+		t.Fatalf("Expected the namespace to be kept, got %q", authClient.Namespace())
+	}
+
+	path, _, data, err := method.Authenticate(context.Background(), authClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := authClient.Logical().Write(path, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Auth.ClientToken != "hvs.spiffe" {
+		t.Fatalf("Expected token %q, got %q", "hvs.spiffe", secret.Auth.ClientToken)
+	}
+
+	// The original client does not present the certificate
+	if _, err = client.Logical().Write(path, data); err == nil {
+		t.Fatal("expected the login without a client certificate to fail")
+	}
+}
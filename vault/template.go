@@ -0,0 +1,102 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"text/template"
+
+	"golang.org/x/xerrors"
+)
+
+// templateFuncs are the functions available to the templates which extract
+// the credentials from a secret, in addition to those of text/template.
+// They are named and take their arguments in the order of the functions
+// of consul-template, so that the last argument may be piped.
+var templateFuncs = template.FuncMap{
+	"base64Decode": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return "", xerrors.Errorf("error decoding base64: %w", err)
+		}
+
+		return string(b), nil
+	},
+	"base64Encode": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"parseJSON": func(s string) (interface{}, error) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, xerrors.Errorf("error parsing JSON: %w", err)
+		}
+
+		return v, nil
+	},
+	"split": func(sep, s string) []string {
+		return strings.Split(s, sep)
+	},
+	"splitN": func(sep string, n int, s string) []string {
+		return strings.SplitN(s, sep, n)
+	},
+	"toLower":   strings.ToLower,
+	"toUpper":   strings.ToUpper,
+	"trimSpace": strings.TrimSpace,
+}
+
+// ParseTemplate parses a Go template which extracts a credential from the
+// data of a secret. Besides the functions of text/template, the template
+// may use base64Decode, base64Encode, parseJSON, split, splitN, toLower,
+// toUpper and trimSpace.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// PathTemplateData is the data against which the template of the path of
+// a secret is rendered.
+type PathTemplateData struct {
+	// Registry is the host, and the port if any, of the registry whose
+	// credentials are requested.
+	Registry string
+}
+
+// ParsePathTemplate parses a Go template which renders the path of a
+// secret, such as secret/docker/{{ .Registry }}. Besides the functions of
+// ParseTemplate, the template may use env, which returns the value of an
+// environment variable or an empty string if it is not set.
+func ParsePathTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).
+		Funcs(templateFuncs).
+		Funcs(template.FuncMap{"env": os.Getenv}).
+		Option("missingkey=error").
+		Parse(text)
+}
+
+// executeTemplate renders the template against the data of a secret.
+func executeTemplate(name, text string, data map[string]interface{}) (string, error) {
+	tmpl, err := ParseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
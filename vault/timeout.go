@@ -0,0 +1,42 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vault
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"golang.org/x/xerrors"
+)
+
+// RequestTimeout parses the 'vault_request_timeout' field of the auth
+// method config: how long each request to Vault may take. It returns zero,
+// the default of the Vault API, if the field is not set.
+func RequestTimeout(config map[string]interface{}) (time.Duration, error) {
+	raw, ok := config["vault_request_timeout"]
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, xerrors.Errorf("error parsing 'vault_request_timeout': %w", err)
+	}
+
+	if timeout <= 0 {
+		return 0, xerrors.New("'vault_request_timeout' must be positive")
+	}
+
+	return timeout, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"reflect"
+
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+)
+
+// requestSettings are the fields of the auth method config which only
+// change how the helper reads credentials with its token, not the token it
+// obtains by logging in. Every other field is assumed to change the token.
+var requestSettings = map[string]bool{
+	"secret":                      true,
+	"secrets":                     true,
+	"secret_cache_ttl":            true,
+	"cache_leased_secrets":        true,
+	"static_credentials":          true,
+	"allow_static_fallback":       true,
+	"ecr_token_mode":              true,
+	"ecr_region":                  true,
+	"gcr_token_mode":              true,
+	"acr_token_mode":              true,
+	"acr_tenant_id":               true,
+	"acr_use_msi":                 true,
+	"acr_msi_client_id":           true,
+	"pinned_keys":                 true,
+	"pinned_checksums":            true,
+	"proxy_allowed_paths":         true,
+	"proxy_cache_ttl":             true,
+	"rotation_overlap":            true,
+	"slow_request_threshold":      true,
+	"helper_timeout":              true,
+	"retry_max_attempts":          true,
+	"retry_min_backoff":           true,
+	"retry_max_backoff":           true,
+	"retry_jitter":                true,
+	"circuit_breaker_threshold":   true,
+	"circuit_breaker_cooldown":    true,
+	"circuit_breaker_serve_stale": true,
+	"audit_log":                   true,
+	"otlp_endpoint":               true,
+	"log_dir":                     true,
+}
+
+// AuthSettings are the settings of a configuration which determine the
+// token that the helper obtains by logging in: the vault stanza, the auth
+// method and the fields of its config other than those which only change
+// how credentials are read.
+type AuthSettings struct {
+	vault  *vaultconfig.Vault
+	method vaultconfig.Method
+}
+
+// NewAuthSettings copies the settings of the configuration which determine
+// the token of the helper.
+func NewAuthSettings(cfg *vaultconfig.Config) AuthSettings {
+	var settings AuthSettings
+
+	if cfg.Vault != nil {
+		vault := *cfg.Vault
+		settings.vault = &vault
+	}
+
+	if cfg.AutoAuth == nil || cfg.AutoAuth.Method == nil {
+		return settings
+	}
+
+	settings.method = *cfg.AutoAuth.Method
+	settings.method.Config = make(map[string]interface{}, len(cfg.AutoAuth.Method.Config))
+
+	for field, value := range cfg.AutoAuth.Method.Config {
+		if !requestSettings[field] {
+			settings.method.Config[field] = value
+		}
+	}
+
+	return settings
+}
+
+// Equal reports whether a helper created with the other settings may use
+// the token of a helper created with these, without logging in again.
+func (s AuthSettings) Equal(other AuthSettings) bool {
+	return reflect.DeepEqual(s, other)
+}
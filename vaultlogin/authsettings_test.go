@@ -0,0 +1,84 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"testing"
+
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+)
+
+func TestAuthSettings_Equal(t *testing.T) {
+	newConfig := func(address string, config map[string]interface{}) *vaultconfig.Config {
+		return &vaultconfig.Config{
+			Vault: &vaultconfig.Vault{Address: address},
+			AutoAuth: &vaultconfig.AutoAuth{
+				Method: &vaultconfig.Method{
+					Type:      "approle",
+					MountPath: "auth/approle",
+					Config:    config,
+				},
+			},
+		}
+	}
+
+	current := NewAuthSettings(newConfig("https://vault.example.com", map[string]interface{}{
+		"role_id_file_path": "/etc/dcvl/role-id",
+		"secret":            "secret/docker/old",
+		"helper_timeout":    "1m",
+	}))
+
+	cases := []struct {
+		name   string
+		config *vaultconfig.Config
+		equal  bool
+	}{
+		{
+			name: "request-settings-changed",
+			config: newConfig("https://vault.example.com", map[string]interface{}{
+				"role_id_file_path": "/etc/dcvl/role-id",
+				"secret":            "secret/docker/new",
+			}),
+			equal: true,
+		},
+		{
+			name: "method-config-changed",
+			config: newConfig("https://vault.example.com", map[string]interface{}{
+				"role_id_file_path": "/etc/dcvl/other-role-id",
+				"secret":            "secret/docker/old",
+				"helper_timeout":    "1m",
+			}),
+		},
+		{
+			name: "vault-changed",
+			config: newConfig("https://vault-dr.example.com", map[string]interface{}{
+				"role_id_file_path": "/etc/dcvl/role-id",
+				"secret":            "secret/docker/old",
+				"helper_timeout":    "1m",
+			}),
+		},
+		{
+			name:   "no-auto-auth",
+			config: &vaultconfig.Config{Vault: &vaultconfig.Vault{Address: "https://vault.example.com"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if equal := current.Equal(NewAuthSettings(tc.config)); equal != tc.equal {
+				t.Fatalf("Expected Equal to be %t, got %t", tc.equal, equal)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+	"github.com/morningconsult/docker-credential-vault-login/telemetry"
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+const (
+	envCacheDir = "DCVL_CACHE_DIR"
+
+	// legacySecretCacheFile is where leased secrets were cached, in
+	// plaintext, before the cache backends existed.
+	legacySecretCacheFile = "secrets.json"
+
+	defaultProxyCacheTTL = time.Minute
+
+	defaultBreakerCooldown = time.Minute
+)
+
+// CacheDir creates the directory in which state is persisted between
+// invocations and returns its path. It is taken from the DCVL_CACHE_DIR
+// environment variable or, if it is not set, the 'cache_dir' config value.
+// By default, DefaultCacheDir is used. Unless the paths are shared, a cache directory outside the
+// home directory of the user is scoped to the user.
+func CacheDir(config map[string]interface{}, shared bool) (string, error) {
+	cacheDir := DefaultCacheDir
+	if v := os.Getenv(envCacheDir); v != "" {
+		cacheDir = v
+	} else {
+		c, ok := config["cache_dir"].(string)
+		if ok && c != "" {
+			cacheDir = c
+		}
+	}
+
+	cacheDir, err := homedir.Expand(cacheDir)
+	if err != nil {
+		return "", xerrors.Errorf("error expanding cache directory %s: %w", cacheDir, err)
+	}
+
+	if !shared && !InHomeDir(cacheDir) {
+		return UserDir(cacheDir)
+	}
+
+	if err = os.MkdirAll(cacheDir, 0o700); err != nil {
+		return "", xerrors.Errorf("error creating directory %s: %w", cacheDir, err)
+	}
+
+	return cacheDir, nil
+}
+
+// newSecretCache creates a cache of credentials read from leased secrets
+// if both caching and 'cache_leased_secrets' are enabled.
+func newSecretCache(
+	config map[string]interface{},
+	enableCache bool,
+	store cache.Cache,
+	logger hclog.Logger,
+) (*cache.SecretCache, error) {
+	raw, ok := config["cache_leased_secrets"]
+	if !ok || !enableCache {
+		return nil, nil
+	}
+
+	enabled, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return nil, xerrors.New("'cache_leased_secrets' must be a boolean")
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+
+	return cache.NewSecretCache(logger.Named("cache"), store), nil
+}
+
+// newCacheBackend creates the backend of the caches selected by the
+// 'cache_backend' (default: file), 'keyring_helper', 'keychain_service'
+// and 'keychain_account' fields of the auth method config. It also reports whether the backend was selected
+// explicitly, in which case the tokens obtained by the helper are cached
+// in it. The programs to which the backend delegates are logged to the
+// logger.
+func newCacheBackend(
+	config map[string]interface{},
+	cacheDir string,
+	logger hclog.Logger,
+) (cache.Cache, bool, error) {
+	name := cache.BackendFile
+
+	raw, explicit := config["cache_backend"]
+	if explicit {
+		var ok bool
+		if name, ok = raw.(string); !ok {
+			return nil, false, xerrors.New("'cache_backend' must be a string")
+		}
+	}
+
+	opts := cache.BackendOptions{Dir: cacheDir, Logger: logger.Named("cache")}
+
+	for field, value := range map[string]*string{
+		"keyring_helper":   &opts.KeyringHelper,
+		"keychain_service": &opts.KeychainService,
+		"keychain_account": &opts.KeychainAccount,
+	} {
+		if raw, ok := config[field]; ok {
+			if *value, ok = raw.(string); !ok {
+				return nil, false, xerrors.Errorf("'%s' must be a string", field)
+			}
+		}
+	}
+
+	store, err := cache.NewBackend(name, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return store, explicit, nil
+}
+
+// slowRequestThreshold parses the 'slow_request_threshold' field of the
+// auth method config. If it is not set, slow requests are not reported.
+func slowRequestThreshold(config map[string]interface{}) (time.Duration, error) {
+	raw, ok := config["slow_request_threshold"]
+	if !ok {
+		return 0, nil
+	}
+
+	threshold, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, xerrors.Errorf("error parsing 'slow_request_threshold': %w", err)
+	}
+
+	return threshold, nil
+}
+
+// helperTimeout parses the 'helper_timeout' field of the auth method
+// config. If it is not set, credential requests have no overall timeout.
+func helperTimeout(config map[string]interface{}) (time.Duration, error) {
+	raw, ok := config["helper_timeout"]
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, xerrors.Errorf("error parsing 'helper_timeout': %w", err)
+	}
+
+	if timeout <= 0 {
+		return 0, xerrors.New("'helper_timeout' must be positive")
+	}
+
+	return timeout, nil
+}
+
+// authTimeout parses the 'auth_timeout' field of the auth method config,
+// which bounds every login. If it is not set, logins with the interactive
+// oidc method default to vault.DefaultOIDCAuthTimeout and other logins to
+// the default of the helper.
+func authTimeout(methodType string, config map[string]interface{}) (time.Duration, error) {
+	raw, ok := config["auth_timeout"]
+	if !ok {
+		if methodType == "oidc" {
+			return vault.DefaultOIDCAuthTimeout, nil
+		}
+
+		return 0, nil
+	}
+
+	timeout, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, xerrors.Errorf("error parsing 'auth_timeout': %w", err)
+	}
+
+	if timeout < time.Second {
+		return 0, xerrors.New("'auth_timeout' must be at least one second")
+	}
+
+	return timeout, nil
+}
+
+// newTracer creates a Tracer exporting spans to 'otlp_endpoint', if set,
+// within the trace of the TRACEPARENT environment variable.
+func newTracer(config map[string]interface{}) (*telemetry.Tracer, error) {
+	raw, ok := config["otlp_endpoint"]
+	if !ok {
+		return nil, nil
+	}
+
+	endpoint, ok := raw.(string)
+	if !ok || endpoint == "" {
+		return nil, xerrors.New("'otlp_endpoint' must be a non-empty string")
+	}
+
+	tracer, err := telemetry.NewTracer(endpoint, os.Getenv(telemetry.EnvTraceParent))
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing 'otlp_endpoint': %w", err)
+	}
+
+	return tracer, nil
+}
+
+// newTTLCache creates a cache of the credentials read from every secret if
+// caching is enabled and 'secret_cache_ttl' is set.
+func newTTLCache(
+	config map[string]interface{},
+	enableCache bool,
+	store cache.Cache,
+	logger hclog.Logger,
+) (*cache.TTLCache, error) {
+	raw, ok := config["secret_cache_ttl"]
+	if !ok || !enableCache {
+		return nil, nil
+	}
+
+	ttl, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing 'secret_cache_ttl': %w", err)
+	}
+
+	if ttl <= 0 {
+		return nil, nil
+	}
+
+	return cache.NewTTLCache(logger.Named("cache"), store, ttl), nil
+}
+
+// coalesceWindow parses the 'coalesce_window' field of the auth method
+// config, for which the credentials read from every secret are shared with
+// concurrent requests. If it is not set, reads are not coalesced.
+func coalesceWindow(config map[string]interface{}) (time.Duration, error) {
+	raw, ok := config["coalesce_window"]
+	if !ok {
+		return 0, nil
+	}
+
+	window, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, xerrors.Errorf("error parsing 'coalesce_window': %w", err)
+	}
+
+	if window < 0 {
+		return 0, xerrors.New("'coalesce_window' must not be negative")
+	}
+
+	return window, nil
+}
+
+// newCoalesceCache creates the cache by which concurrent requests share the
+// credentials read from every secret if caching is enabled and a coalesce
+// window is configured.
+func newCoalesceCache(
+	config map[string]interface{},
+	enableCache bool,
+	store cache.Cache,
+	logger hclog.Logger,
+) (*cache.TTLCache, error) {
+	window, err := coalesceWindow(config)
+	if err != nil || window == 0 || !enableCache {
+		return nil, err
+	}
+
+	return cache.NewCoalesceCache(logger.Named("cache"), store, window), nil
+}
+
+// proxyConfig parses the 'proxy_allowed_paths' and 'proxy_cache_ttl'
+// fields of the auth method config. If no paths are allowed, the proxy is
+// not served.
+func proxyConfig(config map[string]interface{}) ([]string, time.Duration, error) {
+	raw, ok := config["proxy_allowed_paths"]
+	if !ok {
+		return nil, 0, nil
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, 0, xerrors.New("'proxy_allowed_paths' must be a list of strings")
+	}
+
+	paths := make([]string, 0, len(list))
+
+	for _, v := range list {
+		path, ok := v.(string)
+		if !ok || strings.Trim(path, "/*") == "" {
+			return nil, 0, xerrors.New("'proxy_allowed_paths' must be a list of non-empty paths")
+		}
+
+		paths = append(paths, path)
+	}
+
+	ttl := defaultProxyCacheTTL
+
+	if raw, ok = config["proxy_cache_ttl"]; ok {
+		var err error
+
+		if ttl, err = parseutil.ParseDurationSecond(raw); err != nil {
+			return nil, 0, xerrors.Errorf("error parsing 'proxy_cache_ttl': %w", err)
+		}
+	}
+
+	return paths, ttl, nil
+}
+
+// circuitBreaker parses the 'circuit_breaker_threshold',
+// 'circuit_breaker_cooldown' and 'circuit_breaker_serve_stale' fields of
+// the auth method config. If no threshold is set, the circuit breaker is
+// disabled.
+func circuitBreaker(config map[string]interface{}) (*helper.BreakerOptions, error) {
+	raw, ok := config["circuit_breaker_threshold"]
+	if !ok {
+		return nil, nil
+	}
+
+	threshold, err := parseutil.SafeParseInt(raw)
+	if err != nil || threshold < 1 {
+		return nil, xerrors.New("'circuit_breaker_threshold' must be a positive integer")
+	}
+
+	opts := &helper.BreakerOptions{Threshold: threshold, Cooldown: defaultBreakerCooldown}
+
+	if raw, ok = config["circuit_breaker_cooldown"]; ok {
+		if opts.Cooldown, err = parseutil.ParseDurationSecond(raw); err != nil {
+			return nil, xerrors.Errorf("error parsing 'circuit_breaker_cooldown': %w", err)
+		}
+
+		if opts.Cooldown <= 0 {
+			return nil, xerrors.New("'circuit_breaker_cooldown' must be positive")
+		}
+	}
+
+	if raw, ok = config["circuit_breaker_serve_stale"]; ok {
+		if opts.ServeStale, err = parseutil.ParseBool(raw); err != nil {
+			return nil, xerrors.New("'circuit_breaker_serve_stale' must be a boolean")
+		}
+	}
+
+	return opts, nil
+}
+
+// auditLogPath parses the 'audit_log' field of the auth method config, the
+// path of the audit log, and expands it. If it is not set, no audit log is
+// written.
+func auditLogPath(config map[string]interface{}) (string, error) {
+	raw, ok := config["audit_log"]
+	if !ok {
+		return "", nil
+	}
+
+	path, ok := raw.(string)
+	if !ok || path == "" {
+		return "", xerrors.New("'audit_log' must be a non-empty string")
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", xerrors.Errorf("error expanding 'audit_log': %w", err)
+	}
+
+	return path, nil
+}
+
+// revokeOnExit parses the 'revoke_on_exit' field of the auth method
+// config.
+func revokeOnExit(config map[string]interface{}) (bool, error) {
+	raw, ok := config["revoke_on_exit"]
+	if !ok {
+		return false, nil
+	}
+
+	revoke, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return false, xerrors.New("'revoke_on_exit' must be a boolean")
+	}
+
+	return revoke, nil
+}
+
+// MemoryHardening parses the 'memory_hardening' field of the auth method
+// config, which locks the memory of the helper, zeroes the credentials it
+// writes and scrubs them from the log.
+func MemoryHardening(config map[string]interface{}) (bool, error) {
+	raw, ok := config["memory_hardening"]
+	if !ok {
+		return false, nil
+	}
+
+	hardened, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return false, xerrors.New("'memory_hardening' must be a boolean")
+	}
+
+	return hardened, nil
+}
+
+// rotationOverlap parses the 'rotation_overlap' field of the auth method
+// config. If it is not set, the previous versions of rotated secrets are
+// not kept.
+func rotationOverlap(config map[string]interface{}) (time.Duration, error) {
+	raw, ok := config["rotation_overlap"]
+	if !ok {
+		return 0, nil
+	}
+
+	overlap, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, xerrors.Errorf("error parsing 'rotation_overlap': %w", err)
+	}
+
+	return overlap, nil
+}
+
+// ValidateConfig parses the fields of the auth method config which are
+// read by NewFromConfig, without creating anything, and returns the
+// problems with them.
+func ValidateConfig(config map[string]interface{}) []string {
+	var problems []string
+
+	check := func(context string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", context, err))
+		}
+	}
+
+	_, err := SharedDaemon(config)
+	check("invalid 'shared_daemon'", err)
+
+	_, _, err = newCacheBackend(config, "", hclog.NewNullLogger())
+	check("invalid cache backend", err)
+
+	_, err = slowRequestThreshold(config)
+	check("invalid 'slow_request_threshold'", err)
+
+	_, err = helperTimeout(config)
+	check("invalid 'helper_timeout'", err)
+
+	_, err = authTimeout("", config)
+	check("invalid 'auth_timeout'", err)
+
+	_, err = newTracer(config)
+	check("invalid 'otlp_endpoint'", err)
+
+	_, _, err = proxyConfig(config)
+	check("invalid proxy options", err)
+
+	_, err = coalesceWindow(config)
+	check("invalid 'coalesce_window'", err)
+
+	_, err = rotationOverlap(config)
+	check("invalid 'rotation_overlap'", err)
+
+	_, err = circuitBreaker(config)
+	check("invalid circuit breaker options", err)
+
+	_, err = MemoryHardening(config)
+	check("invalid 'memory_hardening'", err)
+
+	_, err = revokeOnExit(config)
+	check("invalid 'revoke_on_exit'", err)
+
+	_, err = auditLogPath(config)
+	check("invalid 'audit_log'", err)
+
+	return problems
+}
@@ -0,0 +1,917 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+func TestCacheDir(t *testing.T) {
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// Without user IDs, the cache directory itself is used
+	uidDir := ""
+	if uid := os.Getuid(); uid != -1 {
+		uidDir = fmt.Sprintf("uid-%d", uid)
+	}
+
+	cases := []struct {
+		name   string
+		env    string
+		config map[string]interface{}
+		shared bool
+		dir    string
+		err    string
+	}{
+		{
+			name:   "cache-dir-from-env",
+			env:    "testdata/cache-env",
+			shared: true,
+			dir:    "testdata/cache-env",
+		},
+		{
+			name:   "cache-dir-from-config",
+			config: map[string]interface{}{"cache_dir": "testdata/cache-config"},
+			shared: true,
+			dir:    "testdata/cache-config",
+		},
+		{
+			name:   "scoped-to-user",
+			config: map[string]interface{}{"cache_dir": "testdata/cache-config"},
+			dir:    filepath.Join("testdata/cache-config", uidDir),
+		},
+		{
+			name:   "in-home-dir",
+			config: map[string]interface{}{"cache_dir": "~/cache"},
+			dir:    filepath.Join(home, "cache"),
+		},
+		{
+			name:   "error-expanding-cache-dir",
+			config: map[string]interface{}{"cache_dir": "~asdgweq"},
+			err:    "error expanding cache directory : cannot expand user-specific home dir",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(envCacheDir, tc.env)
+			defer os.Unsetenv(envCacheDir)
+
+			dir, err := CacheDir(tc.config, tc.shared)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(strings.TrimSuffix(dir, uidDir))
+			if dir != tc.dir {
+				t.Fatalf("Expected cache directory %q, got %q", tc.dir, dir)
+			}
+			if _, err = os.Stat(dir); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNewSecretCache(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      map[string]interface{}
+		enableCache bool
+		enabled     bool
+		err         string
+	}{
+		{
+			name:        "not-configured",
+			config:      map[string]interface{}{},
+			enableCache: true,
+		},
+		{
+			name:   "caching-disabled",
+			config: map[string]interface{}{"cache_leased_secrets": true},
+		},
+		{
+			name:        "enabled",
+			config:      map[string]interface{}{"cache_leased_secrets": "true"},
+			enableCache: true,
+			enabled:     true,
+		},
+		{
+			name:        "bad-value",
+			config:      map[string]interface{}{"cache_leased_secrets": "sometimes"},
+			enableCache: true,
+			err:         "'cache_leased_secrets' must be a boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			secretCache, err := newSecretCache(tc.config, tc.enableCache, cache.NewMemoryCache(), hclog.NewNullLogger())
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if enabled := secretCache != nil; enabled != tc.enabled {
+				t.Fatalf("Expected secret cache enabled to be %t, got %t", tc.enabled, enabled)
+			}
+		})
+	}
+}
+
+func TestNewCacheBackend(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		backend  cache.Cache
+		explicit bool
+		err      string
+	}{
+		{
+			name:    "default",
+			config:  map[string]interface{}{},
+			backend: &cache.FileCache{},
+		},
+		{
+			name:     "memory",
+			config:   map[string]interface{}{"cache_backend": "memory"},
+			backend:  &cache.MemoryCache{},
+			explicit: true,
+		},
+		{
+			name:     "keyring",
+			config:   map[string]interface{}{"cache_backend": "keyring", "keyring_helper": "pass"},
+			backend:  &cache.KeyringCache{},
+			explicit: true,
+		},
+		{
+			name:   "unsupported",
+			config: map[string]interface{}{"cache_backend": "redis"},
+			err:    `unsupported cache backend "redis": must be one of file, memory, keyring, wincred or keychain`,
+		},
+		{
+			name:   "bad-helper",
+			config: map[string]interface{}{"cache_backend": "keyring", "keyring_helper": 1},
+			err:    "'keyring_helper' must be a string",
+		},
+		{
+			name:   "bad-keychain-service",
+			config: map[string]interface{}{"cache_backend": "keychain", "keychain_service": true},
+			err:    "'keychain_service' must be a string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend, explicit, err := newCacheBackend(tc.config, t.TempDir(), hclog.NewNullLogger())
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, expected := fmt.Sprintf("%T", backend), fmt.Sprintf("%T", tc.backend); got != expected {
+				t.Fatalf("Expected a %s backend, got %s", expected, got)
+			}
+			if explicit != tc.explicit {
+				t.Fatalf("Expected explicit to be %t, got %t", tc.explicit, explicit)
+			}
+		})
+	}
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	cases := []struct {
+		name      string
+		config    map[string]interface{}
+		threshold time.Duration
+		err       string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:      "duration",
+			config:    map[string]interface{}{"slow_request_threshold": "1500ms"},
+			threshold: 1500 * time.Millisecond,
+		},
+		{
+			name:      "seconds",
+			config:    map[string]interface{}{"slow_request_threshold": 2},
+			threshold: 2 * time.Second,
+		},
+		{
+			name:   "bad-value",
+			config: map[string]interface{}{"slow_request_threshold": "slow"},
+			err:    "error parsing 'slow_request_threshold': time: invalid duration \"slow\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			threshold, err := slowRequestThreshold(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if threshold != tc.threshold {
+				t.Fatalf("Expected threshold %s, got %s", tc.threshold, threshold)
+			}
+		})
+	}
+}
+
+func TestHelperTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  map[string]interface{}
+		timeout time.Duration
+		err     string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:    "duration",
+			config:  map[string]interface{}{"helper_timeout": "45s"},
+			timeout: 45 * time.Second,
+		},
+		{
+			name:    "seconds",
+			config:  map[string]interface{}{"helper_timeout": 20},
+			timeout: 20 * time.Second,
+		},
+		{
+			name:   "bad-value",
+			config: map[string]interface{}{"helper_timeout": "forever"},
+			err:    "error parsing 'helper_timeout': time: invalid duration \"forever\"",
+		},
+		{
+			name:   "not-positive",
+			config: map[string]interface{}{"helper_timeout": 0},
+			err:    "'helper_timeout' must be positive",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			timeout, err := helperTimeout(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if timeout != tc.timeout {
+				t.Fatalf("Expected timeout %s, got %s", tc.timeout, timeout)
+			}
+		})
+	}
+}
+
+func TestAuthTimeout(t *testing.T) {
+	cases := []struct {
+		name       string
+		methodType string
+		config     map[string]interface{}
+		timeout    time.Duration
+		err        string
+	}{
+		{
+			name:       "not-configured",
+			methodType: "aws",
+			config:     map[string]interface{}{},
+		},
+		{
+			name:       "oidc-default",
+			methodType: "oidc",
+			config:     map[string]interface{}{},
+			timeout:    2 * time.Minute,
+		},
+		{
+			name:       "duration",
+			methodType: "oidc",
+			config:     map[string]interface{}{"auth_timeout": "5m"},
+			timeout:    5 * time.Minute,
+		},
+		{
+			name:       "seconds",
+			methodType: "aws",
+			config:     map[string]interface{}{"auth_timeout": 10},
+			timeout:    10 * time.Second,
+		},
+		{
+			name:       "bad-value",
+			methodType: "aws",
+			config:     map[string]interface{}{"auth_timeout": "forever"},
+			err:        "error parsing 'auth_timeout': time: invalid duration \"forever\"",
+		},
+		{
+			name:       "too-short",
+			methodType: "oidc",
+			config:     map[string]interface{}{"auth_timeout": "500ms"},
+			err:        "'auth_timeout' must be at least one second",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			timeout, err := authTimeout(tc.methodType, tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if timeout != tc.timeout {
+				t.Fatalf("Expected timeout %s, got %s", tc.timeout, timeout)
+			}
+		})
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		traced bool
+		err    string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "endpoint",
+			config: map[string]interface{}{"otlp_endpoint": "http://localhost:4318"},
+			traced: true,
+		},
+		{
+			name:   "empty",
+			config: map[string]interface{}{"otlp_endpoint": ""},
+			err:    "'otlp_endpoint' must be a non-empty string",
+		},
+		{
+			name:   "bad-scheme",
+			config: map[string]interface{}{"otlp_endpoint": "localhost:4318"},
+			err:    "error parsing 'otlp_endpoint': OTLP endpoint \"localhost:4318\" must be an http or https URL",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer, err := newTracer(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (tracer != nil) != tc.traced {
+				t.Fatalf("Expected a tracer: %v, got %v", tc.traced, tracer)
+			}
+		})
+	}
+}
+
+func TestNewTTLCache(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      map[string]interface{}
+		enableCache bool
+		enabled     bool
+		err         string
+	}{
+		{
+			name:        "not-configured",
+			config:      map[string]interface{}{},
+			enableCache: true,
+		},
+		{
+			name:   "caching-disabled",
+			config: map[string]interface{}{"secret_cache_ttl": "30s"},
+		},
+		{
+			name:        "zero",
+			config:      map[string]interface{}{"secret_cache_ttl": 0},
+			enableCache: true,
+		},
+		{
+			name:        "enabled",
+			config:      map[string]interface{}{"secret_cache_ttl": "30s"},
+			enableCache: true,
+			enabled:     true,
+		},
+		{
+			name:        "bad-value",
+			config:      map[string]interface{}{"secret_cache_ttl": "briefly"},
+			enableCache: true,
+			err:         "error parsing 'secret_cache_ttl': time: invalid duration \"briefly\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttlCache, err := newTTLCache(tc.config, tc.enableCache, cache.NewMemoryCache(), hclog.NewNullLogger())
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if enabled := ttlCache != nil; enabled != tc.enabled {
+				t.Fatalf("Expected secret cache enabled to be %t, got %t", tc.enabled, enabled)
+			}
+		})
+	}
+}
+
+func TestNewCoalesceCache(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      map[string]interface{}
+		enableCache bool
+		enabled     bool
+		err         string
+	}{
+		{
+			name:        "not-configured",
+			config:      map[string]interface{}{},
+			enableCache: true,
+		},
+		{
+			name:   "caching-disabled",
+			config: map[string]interface{}{"coalesce_window": "5s"},
+		},
+		{
+			name:        "zero",
+			config:      map[string]interface{}{"coalesce_window": 0},
+			enableCache: true,
+		},
+		{
+			name:        "enabled",
+			config:      map[string]interface{}{"coalesce_window": "5s"},
+			enableCache: true,
+			enabled:     true,
+		},
+		{
+			name:        "negative",
+			config:      map[string]interface{}{"coalesce_window": "-5s"},
+			enableCache: true,
+			err:         "'coalesce_window' must not be negative",
+		},
+		{
+			name:        "bad-value",
+			config:      map[string]interface{}{"coalesce_window": "briefly"},
+			enableCache: true,
+			err:         "error parsing 'coalesce_window': time: invalid duration \"briefly\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			coalesceCache, err := newCoalesceCache(tc.config, tc.enableCache, cache.NewMemoryCache(), hclog.NewNullLogger())
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if enabled := coalesceCache != nil; enabled != tc.enabled {
+				t.Fatalf("Expected coalesce cache enabled to be %t, got %t", tc.enabled, enabled)
+			}
+		})
+	}
+}
+
+func TestProxyConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		paths  []string
+		ttl    time.Duration
+		err    string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "default-ttl",
+			config: map[string]interface{}{"proxy_allowed_paths": []interface{}{"secret/ci/*"}},
+			paths:  []string{"secret/ci/*"},
+			ttl:    defaultProxyCacheTTL,
+		},
+		{
+			name: "ttl",
+			config: map[string]interface{}{
+				"proxy_allowed_paths": []interface{}{"secret/ci/*", "secret/npm"},
+				"proxy_cache_ttl":     "0s",
+			},
+			paths: []string{"secret/ci/*", "secret/npm"},
+		},
+		{
+			name:   "not-a-list",
+			config: map[string]interface{}{"proxy_allowed_paths": "secret/ci/*"},
+			err:    "'proxy_allowed_paths' must be a list of strings",
+		},
+		{
+			name:   "everything",
+			config: map[string]interface{}{"proxy_allowed_paths": []interface{}{"*"}},
+			err:    "'proxy_allowed_paths' must be a list of non-empty paths",
+		},
+		{
+			name: "bad-ttl",
+			config: map[string]interface{}{
+				"proxy_allowed_paths": []interface{}{"secret/ci/*"},
+				"proxy_cache_ttl":     "soon",
+			},
+			err: "error parsing 'proxy_cache_ttl': time: invalid duration \"soon\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths, ttl, err := proxyConfig(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.paths, paths); diff != "" {
+				t.Fatalf("Paths differ:\n%s", diff)
+			}
+			if ttl != tc.ttl {
+				t.Fatalf("Expected TTL %s, got %s", tc.ttl, ttl)
+			}
+		})
+	}
+}
+
+func TestRotationOverlap(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  map[string]interface{}
+		overlap time.Duration
+		err     string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:    "duration",
+			config:  map[string]interface{}{"rotation_overlap": "10m"},
+			overlap: 10 * time.Minute,
+		},
+		{
+			name:    "seconds",
+			config:  map[string]interface{}{"rotation_overlap": 90},
+			overlap: 90 * time.Second,
+		},
+		{
+			name:   "bad-value",
+			config: map[string]interface{}{"rotation_overlap": "a while"},
+			err:    "error parsing 'rotation_overlap': time: invalid duration \"a while\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			overlap, err := rotationOverlap(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if overlap != tc.overlap {
+				t.Fatalf("Expected overlap %s, got %s", tc.overlap, overlap)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  map[string]interface{}
+		breaker *helper.BreakerOptions
+		err     string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:    "defaults",
+			config:  map[string]interface{}{"circuit_breaker_threshold": 5},
+			breaker: &helper.BreakerOptions{Threshold: 5, Cooldown: time.Minute},
+		},
+		{
+			name: "all",
+			config: map[string]interface{}{
+				"circuit_breaker_threshold":   "3",
+				"circuit_breaker_cooldown":    "5m",
+				"circuit_breaker_serve_stale": true,
+			},
+			breaker: &helper.BreakerOptions{Threshold: 3, Cooldown: 5 * time.Minute, ServeStale: true},
+		},
+		{
+			name:   "bad-threshold",
+			config: map[string]interface{}{"circuit_breaker_threshold": 0},
+			err:    "'circuit_breaker_threshold' must be a positive integer",
+		},
+		{
+			name: "bad-cooldown",
+			config: map[string]interface{}{
+				"circuit_breaker_threshold": 3,
+				"circuit_breaker_cooldown":  "a while",
+			},
+			err: "error parsing 'circuit_breaker_cooldown': time: invalid duration \"a while\"",
+		},
+		{
+			name: "cooldown-not-positive",
+			config: map[string]interface{}{
+				"circuit_breaker_threshold": 3,
+				"circuit_breaker_cooldown":  0,
+			},
+			err: "'circuit_breaker_cooldown' must be positive",
+		},
+		{
+			name: "bad-serve-stale",
+			config: map[string]interface{}{
+				"circuit_breaker_threshold":   3,
+				"circuit_breaker_serve_stale": "sometimes",
+			},
+			err: "'circuit_breaker_serve_stale' must be a boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			breaker, err := circuitBreaker(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.breaker, breaker); diff != "" {
+				t.Fatalf("Circuit breaker options differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMemoryHardening(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   map[string]interface{}
+		hardened bool
+		err      string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:     "enabled",
+			config:   map[string]interface{}{"memory_hardening": "true"},
+			hardened: true,
+		},
+		{
+			name:   "bad",
+			config: map[string]interface{}{"memory_hardening": "always"},
+			err:    "'memory_hardening' must be a boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hardened, err := MemoryHardening(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hardened != tc.hardened {
+				t.Fatalf("Expected %v, got %v", tc.hardened, hardened)
+			}
+		})
+	}
+}
+
+func TestRevokeOnExit(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		revoke bool
+		err    string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "enabled",
+			config: map[string]interface{}{"revoke_on_exit": true},
+			revoke: true,
+		},
+		{
+			name:   "bad",
+			config: map[string]interface{}{"revoke_on_exit": "eventually"},
+			err:    "'revoke_on_exit' must be a boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			revoke, err := revokeOnExit(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoke != tc.revoke {
+				t.Fatalf("Expected %v, got %v", tc.revoke, revoke)
+			}
+		})
+	}
+}
+
+func TestAuditLogPath(t *testing.T) {
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		path   string
+		err    string
+	}{
+		{
+			name:   "not-configured",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "absolute",
+			config: map[string]interface{}{"audit_log": "/var/log/dcvl/audit.jsonl"},
+			path:   "/var/log/dcvl/audit.jsonl",
+		},
+		{
+			name:   "home",
+			config: map[string]interface{}{"audit_log": "~/.docker-credential-vault-login/audit.jsonl"},
+			path:   filepath.Join(home, ".docker-credential-vault-login", "audit.jsonl"),
+		},
+		{
+			name:   "not-a-string",
+			config: map[string]interface{}{"audit_log": true},
+			err:    "'audit_log' must be a non-empty string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := auditLogPath(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tc.path {
+				t.Fatalf("Expected %q, got %q", tc.path, path)
+			}
+		})
+	}
+}
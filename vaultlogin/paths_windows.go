@@ -0,0 +1,34 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DefaultCacheDir is the directory in which state is persisted between
+// invocations unless another one is configured. On Windows, it is in the
+// roaming application data of the user (%APPDATA%).
+var DefaultCacheDir = appDataDir()
+
+// appDataDir returns the directory of the helper in %APPDATA%, falling
+// back to its usual location in the profile of the user.
+func appDataDir() string {
+	if dir := os.Getenv("APPDATA"); dir != "" {
+		return filepath.Join(dir, "docker-credential-vault-login")
+	}
+
+	return `~\AppData\Roaming\docker-credential-vault-login`
+}
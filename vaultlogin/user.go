@@ -0,0 +1,173 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+const envSharedDaemon = "DCVL_SHARED_DAEMON"
+
+// SharedDaemon reports whether the paths of the configuration file are
+// shared by every user, as is the case when one system-wide daemon serves
+// all of the users of a host. It is taken from the DCVL_SHARED_DAEMON
+// environment variable or, if it is not set, the 'shared_daemon' config
+// value. By default, paths are not shared.
+func SharedDaemon(config map[string]interface{}) (bool, error) {
+	if v := os.Getenv(envSharedDaemon); v != "" {
+		shared, err := parseutil.ParseBool(v)
+		if err != nil {
+			return false, xerrors.Errorf("value of %s could not be converted to boolean", envSharedDaemon)
+		}
+
+		return shared, nil
+	}
+
+	raw, ok := config["shared_daemon"]
+	if !ok {
+		return false, nil
+	}
+
+	shared, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return false, xerrors.New("'shared_daemon' must be a boolean")
+	}
+
+	return shared, nil
+}
+
+// UserDir returns the subdirectory of dir which belongs to the current
+// user (e.g. /var/cache/dcvl/uid-1000) and creates it, readable only by
+// the user. If dir does not exist, it is created writable by every user,
+// but with the sticky bit set like /tmp, so that other users can create
+// their own subdirectories. On platforms without user IDs, dir itself is
+// returned.
+func UserDir(dir string) (string, error) {
+	uid := os.Getuid()
+	if uid == -1 {
+		return dir, os.MkdirAll(dir, 0o700)
+	}
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return "", xerrors.Errorf("error creating directory %s: %w", dir, err)
+		}
+
+		if err = os.Chmod(dir, 0o777|os.ModeSticky); err != nil {
+			return "", xerrors.Errorf("error setting permissions of directory %s: %w", dir, err)
+		}
+	}
+
+	sub := filepath.Join(dir, fmt.Sprintf("uid-%d", uid))
+	if err := os.Mkdir(sub, 0o700); err != nil && !os.IsExist(err) {
+		return "", xerrors.Errorf("error creating directory %s: %w", sub, err)
+	}
+
+	// Another user may have created the directory first to read the
+	// files written to it
+	if err := checkOwner(sub, uid); err != nil {
+		return "", err
+	}
+
+	return sub, nil
+}
+
+// writesSinks reports whether the helper writes the tokens it obtains to
+// the sinks, which it only does if caching is enabled and it logs in
+// itself. The sinks of the vault_agent method are written by a Vault agent,
+// so they are read where the agent writes them.
+func writesSinks(method string, enableCache bool) bool {
+	switch method {
+	case "token", "vault_agent", "vault_agent_proxy":
+		return false
+	}
+
+	return enableCache
+}
+
+// scopeSinksToUser moves the file of every file sink outside the home
+// directory of the user into the user's subdirectory (see UserDir) of the
+// directory containing it, so that users sharing a configuration file
+// don't share cached tokens.
+func scopeSinksToUser(sinks []*vaultconfig.Sink) error {
+	for i, sink := range sinks {
+		if sink.Type != "file" {
+			continue
+		}
+
+		path, ok := sink.Config["path"].(string)
+		if !ok || path == "" {
+			continue
+		}
+
+		path, err := homedir.Expand(path)
+		if err != nil {
+			return xerrors.Errorf("error expanding path of sink %d: %w", i+1, err)
+		}
+
+		if InHomeDir(path) {
+			continue
+		}
+
+		if path, err = scopeFileToUser(path); err != nil {
+			return xerrors.Errorf("error creating directory of sink %d: %w", i+1, err)
+		}
+
+		sink.Config["path"] = path
+	}
+
+	return nil
+}
+
+// scopeFileToUser returns the path of the file moved into the user's
+// subdirectory (see UserDir) of the directory containing it, unless it is
+// in the home directory of the user.
+func scopeFileToUser(path string) (string, error) {
+	if InHomeDir(path) {
+		return path, nil
+	}
+
+	dir, err := UserDir(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// InHomeDir reports whether the path is in the home directory of the
+// user, which no other user can write to.
+func InHomeDir(path string) bool {
+	home, err := homedir.Dir()
+	if err != nil || home == "" {
+		return false
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(home, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
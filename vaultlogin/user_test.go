@@ -0,0 +1,174 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+func TestSharedDaemon(t *testing.T) {
+	cases := []struct {
+		name   string
+		env    string
+		config map[string]interface{}
+		shared bool
+		err    string
+	}{
+		{
+			name:   "default",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "config",
+			config: map[string]interface{}{"shared_daemon": true},
+			shared: true,
+		},
+		{
+			name:   "env-overrides-config",
+			env:    "false",
+			config: map[string]interface{}{"shared_daemon": "true"},
+		},
+		{
+			name:   "bad-config",
+			config: map[string]interface{}{"shared_daemon": "sometimes"},
+			err:    "'shared_daemon' must be a boolean",
+		},
+		{
+			name:   "bad-env",
+			env:    "sometimes",
+			config: map[string]interface{}{},
+			err:    "value of DCVL_SHARED_DAEMON could not be converted to boolean",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envSharedDaemon, tc.env)
+
+			shared, err := SharedDaemon(tc.config)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shared != tc.shared {
+				t.Fatalf("Expected shared to be %t, got %t", tc.shared, shared)
+			}
+		})
+	}
+}
+
+func TestUserDir(t *testing.T) {
+	if os.Getuid() == -1 {
+		t.Skip("platform has no user IDs")
+	}
+
+	parent := filepath.Join(t.TempDir(), "shared")
+
+	dir, err := UserDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := filepath.Join(parent, fmt.Sprintf("uid-%d", os.Getuid())); dir != expected {
+		t.Fatalf("Expected directory %q, got %q", expected, dir)
+	}
+
+	info, err := os.Stat(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSticky == 0 || info.Mode().Perm() != 0o777 {
+		t.Fatalf("Expected %s to be world-writable with the sticky bit set, got %s", parent, info.Mode())
+	}
+
+	info, err = os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o700 {
+		t.Fatalf("Expected %s to only be accessible by its owner, got %s", dir, info.Mode())
+	}
+
+	// Existing directories are reused
+	if _, err = UserDir(parent); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("owned-by-other-user", func(t *testing.T) {
+		if os.Getuid() != 0 {
+			t.Skip("changing the owner of a directory requires root")
+		}
+
+		if err = os.Chown(dir, 12345, 12345); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = UserDir(parent)
+		if err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		expected := fmt.Sprintf("%s is not a directory owned by user 0", dir)
+		if err.Error() != expected {
+			t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), expected))
+		}
+	})
+}
+
+func TestScopeSinksToUser(t *testing.T) {
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	shared := t.TempDir()
+
+	sinks := []*vaultconfig.Sink{
+		{Type: "file", Config: map[string]interface{}{"path": filepath.Join(shared, "token")}},
+		{Type: "file", Config: map[string]interface{}{"path": "~/token"}},
+	}
+
+	if err := scopeSinksToUser(sinks); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(shared, fmt.Sprintf("uid-%d", os.Getuid()), "token"),
+		"~/token",
+	}
+	if os.Getuid() == -1 {
+		expected[0] = filepath.Join(shared, "token")
+	}
+
+	got := []string{sinks[0].Config["path"].(string), sinks[1].Config["path"].(string)}
+	if !cmp.Equal(expected, got) {
+		t.Fatalf("Paths differ:\n%v", cmp.Diff(expected, got))
+	}
+}
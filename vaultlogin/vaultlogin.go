@@ -0,0 +1,410 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package vaultlogin embeds the Vault-backed credential helper in other Go
+// programs, such as custom CLIs and CI agents, so that they can look up
+// Docker credentials without running the docker-credential-vault-login
+// binary. The helper is configured with the same configuration file as
+// the binary:
+//
+//	h, err := vaultlogin.New(vaultlogin.Options{
+//		ConfigFile: "/etc/docker-credential-vault-login/config.hcl",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	username, secret, err := h.Get("123456789012.dkr.ecr.us-east-1.amazonaws.com")
+//
+// The Helper implements credentials.Helper, so it can also be served with
+// credentials.Serve. Get and ReadSecret may be called concurrently.
+package vaultlogin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	vaultconfig "github.com/hashicorp/vault/command/agent/config"
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/cache"
+	"github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/harden"
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+	"github.com/morningconsult/docker-credential-vault-login/telemetry"
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+// Helper looks up Docker credentials in Vault. It implements
+// credentials.Helper.
+type Helper = helper.Helper
+
+// Options configure the Helper created by New.
+type Options struct {
+	// ConfigFile is the path to the configuration file. It is required.
+	ConfigFile string
+
+	// CacheDir is the directory in which state is persisted between
+	// invocations. If it is empty, the same directory as the binary's is
+	// used (see CacheDir).
+	CacheDir string
+
+	// DisableCache disables the caching of tokens and secrets.
+	DisableCache bool
+
+	// Logger receives the logs of the helper. If it is nil, nothing is
+	// logged.
+	Logger hclog.Logger
+}
+
+// New parses the configuration file and creates a Helper from it.
+func New(opts Options) (*Helper, error) {
+	if opts.ConfigFile == "" {
+		return nil, xerrors.New("a configuration file must be provided")
+	}
+
+	configFile, err := homedir.Expand(opts.ConfigFile)
+	if err != nil {
+		return nil, xerrors.Errorf("error expanding path of configuration file %s: %w", opts.ConfigFile, err)
+	}
+
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing configuration file %s: %w", configFile, err)
+	}
+
+	configData, err := os.ReadFile(configFile) // nolint: gosec
+	if err != nil {
+		return nil, xerrors.Errorf("error reading configuration file %s: %w", configFile, err)
+	}
+
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		shared, err := SharedDaemon(cfg.AutoAuth.Method.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		if cacheDir, err = CacheDir(cfg.AutoAuth.Method.Config, shared); err != nil {
+			return nil, xerrors.Errorf("error creating cache directory: %w", err)
+		}
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	return NewFromConfig(cfg, configData, !opts.DisableCache, cacheDir, logger)
+}
+
+// NewFromConfig creates a Helper from the configuration parsed from
+// configData, the contents of a configuration file, with
+// config.ParseConfig.
+func NewFromConfig(
+	cfg *vaultconfig.Config,
+	configData []byte,
+	enableCache bool,
+	cacheDir string,
+	logger hclog.Logger,
+) (*Helper, error) {
+	// Keep the cached tokens of users sharing the configuration apart
+	shared, err := SharedDaemon(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	if !shared && writesSinks(cfg.AutoAuth.Method.Type, enableCache) {
+		if err = scopeSinksToUser(cfg.AutoAuth.Sinks); err != nil {
+			return nil, xerrors.Errorf("error scoping sinks to user: %w", err)
+		}
+	}
+
+	// Keep the credentials read out of the log
+	hardened, err := MemoryHardening(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var scrubber *harden.Scrubber
+	if hardened {
+		scrubber = harden.NewScrubber()
+		logger = scrubber.Logger(logger)
+	}
+
+	// Parse the auth methods to fall back to
+	fallbackMethods, err := config.ParseFallbackMethods(configData)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing fallback auth methods: %w", err)
+	}
+
+	// Build secrets table
+	secretsTable, err := config.BuildSecretsTable(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error building secrets table: %w", err)
+	}
+
+	// Parse the expected shape of the secrets
+	responsePin, err := vault.NewResponsePin(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing pinned response: %w", err)
+	}
+
+	// Parse the wrapping token from which to bootstrap
+	bootstrap, err := vault.NewBootstrapOptions(cfg.AutoAuth.Method)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing bootstrap options: %w", err)
+	}
+
+	// Create new Vault client
+	client, err := vault.NewClient(cfg.AutoAuth.Method, cfg.Vault)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating new Vault client: %w", err)
+	}
+
+	// Fail over to the next Vault node if the current one is unavailable
+	addresses, err := config.ParseVaultAddresses(configData)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing Vault addresses: %w", err)
+	}
+
+	// Configure the client for HCP Vault
+	hcp, err := vault.NewHCPOptions(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing HCP options: %w", err)
+	}
+
+	if err = vault.ConfigureHCP(client, cfg.AutoAuth.Method, hcp, logger); err != nil {
+		return nil, xerrors.Errorf("error configuring HCP Vault: %w", err)
+	}
+
+	// The health of the nodes is only checked once the helper needs Vault,
+	// so that credentials served from a cache need no request at all
+	var selectAddress func(ctx context.Context) error
+	if len(addresses) > 0 {
+		selectAddress = func(ctx context.Context) error {
+			if err := vault.SelectAddress(ctx, client, addresses, cacheDir, logger); err != nil {
+				return err
+			}
+
+			// The HCP endpoint is derived from the address selected
+			return vault.ConfigureHCP(client, cfg.AutoAuth.Method, hcp, logger)
+		}
+	}
+
+	// Configure client-controlled consistency
+	if err = vault.ConfigureConsistency(client, cfg.APIProxy); err != nil {
+		return nil, xerrors.Errorf("error configuring Vault client consistency: %w", err)
+	}
+
+	// Configure retries of transient errors
+	retryPolicy, err := vault.NewRetryPolicy(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing retry policy: %w", err)
+	}
+
+	vault.ConfigureRetries(client, retryPolicy)
+
+	// Limit the rate of requests to Vault
+	rateLimit, err := vault.NewRateLimit(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing rate limit: %w", err)
+	}
+
+	vault.ConfigureRateLimit(client, rateLimit)
+
+	// Create the backend of the caches
+	store, cacheTokens, err := newCacheBackend(cfg.AutoAuth.Method.Config, cacheDir, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenCache cache.Cache
+	if cacheTokens && enableCache {
+		tokenCache = store
+	}
+
+	// Create the cache of leased secrets
+	secretCache, err := newSecretCache(cfg.AutoAuth.Method.Config, enableCache, store, logger)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating secret cache: %w", err)
+	}
+
+	if err = os.Remove(filepath.Join(cacheDir, legacySecretCacheFile)); err != nil && !os.IsNotExist(err) {
+		logger.Error("error removing legacy secret cache", "error", err)
+	}
+
+	// Configure reporting of slow requests
+	slowThreshold, err := slowRequestThreshold(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound how long a credential request may take
+	timeout, err := helperTimeout(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound how long a login may take
+	loginTimeout, err := authTimeout(cfg.AutoAuth.Method.Type, cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Revoke the token on exit unless it is cached to be reused
+	revoke, err := revokeOnExit(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the audit log of the credential requests
+	auditLog, err := auditLogPath(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	if auditLog != "" {
+		if !shared && writesSinks(cfg.AutoAuth.Method.Type, enableCache) {
+			if auditLog, err = scopeFileToUser(auditLog); err != nil {
+				return nil, xerrors.Errorf("error creating directory of audit log: %w", err)
+			}
+		}
+
+		if err = os.MkdirAll(filepath.Dir(auditLog), 0o750); err != nil {
+			return nil, xerrors.Errorf("error creating directory of audit log: %w", err)
+		}
+	}
+
+	metrics, err := telemetry.New(cfg.Telemetry)
+	if err != nil {
+		return nil, xerrors.Errorf("error configuring telemetry: %w", err)
+	}
+
+	// Configure the export of traces
+	tracer, err := newTracer(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the short-lived cache of every secret
+	ttlCache, err := newTTLCache(cfg.AutoAuth.Method.Config, enableCache, store, logger)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating secret cache: %w", err)
+	}
+
+	// Create the cache by which concurrent requests share secrets
+	coalesceCache, err := newCoalesceCache(cfg.AutoAuth.Method.Config, enableCache, store, logger)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating coalesce cache: %w", err)
+	}
+
+	// Create the cache of the last-known-good credentials
+	staleOpts, err := config.ParseStaleOptions(configData)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing stale cache options: %w", err)
+	}
+
+	var staleCache *cache.TTLCache
+	if staleOpts.UseStaleOnError && enableCache {
+		staleCache = cache.NewStaleCache(logger.Named("cache"), store, staleOpts.MaxStale)
+	}
+
+	// Configure the ECR token mode
+	ecr, err := vault.NewECROptions(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing ECR options: %w", err)
+	}
+
+	// Configure the GCR token mode
+	gcr, err := vault.NewGCROptions(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing GCR options: %w", err)
+	}
+
+	// Configure the ACR token mode
+	acr, err := vault.NewACROptions(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing ACR options: %w", err)
+	}
+
+	// Configure the paths which other tools may read through the proxy
+	proxyPaths, proxyTTL, err := proxyConfig(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure how long the previous version of a rotated secret is kept
+	rotationOverlap, err := rotationOverlap(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure failing fast while Vault is unavailable
+	breaker, err := circuitBreaker(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure the external program which provides credentials
+	credentialExec, err := vault.NewCredentialExecOptions(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing credential_exec: %w", err)
+	}
+
+	// Configure the break-glass static credentials
+	staticCredentials, err := config.BuildStaticCredentials(cfg.AutoAuth.Method.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing static credentials: %w", err)
+	}
+
+	return helper.New(helper.Options{
+		Logger:          logger,
+		Client:          client,
+		Secret:          secretsTable,
+		EnableCache:     enableCache,
+		AuthConfig:      cfg.AutoAuth,
+		CacheDir:        cacheDir,
+		FallbackMethods: fallbackMethods,
+		ResponsePin:     responsePin,
+		Bootstrap:       bootstrap,
+		TokenCache:      tokenCache,
+		SecretCache:     secretCache,
+		TTLCache:        ttlCache,
+		StaleCache:      staleCache,
+		CoalesceCache:   coalesceCache,
+		SelectAddress:   selectAddress,
+		ECR:             ecr,
+		GCR:             gcr,
+		ACR:             acr,
+		ProxyPaths:      proxyPaths,
+		ProxyCacheTTL:   proxyTTL,
+		RotationOverlap: rotationOverlap,
+
+		SlowRequestThreshold: slowThreshold,
+		Timeout:              timeout,
+		AuthTimeout:          int64(loginTimeout / time.Second),
+		RevokeOnExit:         revoke && !enableCache,
+		AuditLog:             auditLog,
+		Breaker:              breaker,
+		Metrics:              metrics,
+		Tracer:               tracer,
+		CredentialExec:       credentialExec,
+		StaticCredentials:    staticCredentials,
+		Scrubber:             scrubber,
+	}), nil
+}
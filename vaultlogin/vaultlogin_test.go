@@ -0,0 +1,218 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/vaultlogintest"
+)
+
+const testConfig = `vault {
+	address = %q
+}
+
+auto_auth {
+	method "token" {
+		config = {
+			token  = %q
+			secret = "secret/docker/creds"
+		}
+	}
+}
+`
+
+func TestNew(t *testing.T) {
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+	)
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.hcl")
+	data := fmt.Sprintf(testConfig, fake.Address(), fake.RootToken())
+	if err := os.WriteFile(configFile, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		opts Options
+		err  string
+	}{
+		{
+			name: "success",
+			opts: Options{ConfigFile: configFile, CacheDir: dir, DisableCache: true},
+		},
+		{
+			name: "no-config-file",
+			opts: Options{CacheDir: dir},
+			err:  "a configuration file must be provided",
+		},
+		{
+			name: "missing-config-file",
+			opts: Options{ConfigFile: filepath.Join(dir, "missing.hcl"), CacheDir: dir},
+			err: fmt.Sprintf("error parsing configuration file %s: stat %s: no such file or directory",
+				filepath.Join(dir, "missing.hcl"), filepath.Join(dir, "missing.hcl")),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := New(tc.opts)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, err.Error()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var helper credentials.Helper = h
+
+			username, password, err := helper.Get("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username != "test@user.com" || password != "secure password" {
+				t.Fatalf("Expected test@user.com/secure password, got %s/%s", username, password)
+			}
+		})
+	}
+}
+
+const testSinkConfig = `vault {
+	address = %q
+}
+
+auto_auth {
+	method %q {
+		mount_path = "auth/approle"
+		config     = {
+			secret                              = "secret/docker/creds"
+			role_id_file_path                   = %q
+			secret_id_file_path                 = %q
+			remove_secret_id_file_after_reading = false
+		}
+	}
+
+	sink "file" {
+		config = {
+			path = %q
+		}
+	}
+}
+`
+
+func TestNewFromConfig_Sinks(t *testing.T) {
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(envSharedDaemon, "")
+
+	fake := vaultlogintest.NewFakeVault(t,
+		vaultlogintest.WithKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "secure password",
+		}),
+		vaultlogintest.WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	for file, data := range map[string]string{roleIDFile: "role-id", secretIDFile: "secret-id"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name        string
+		method      string
+		enableCache bool
+		scoped      bool
+	}{
+		{
+			// The sink is written by a Vault agent
+			name:        "vault-agent",
+			method:      "vault_agent",
+			enableCache: true,
+		},
+		{
+			name:        "approle",
+			method:      "approle",
+			enableCache: true,
+			scoped:      os.Getuid() != -1,
+		},
+		{
+			// The sink is neither read nor written
+			name:   "approle-no-cache",
+			method: "approle",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// The sink is outside the home directory, e.g. /run/vault
+			sinkDir := t.TempDir()
+			sinkFile := filepath.Join(sinkDir, "agent-token")
+			if err := os.WriteFile(sinkFile, []byte(fake.RootToken()), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			data := []byte(fmt.Sprintf(testSinkConfig, fake.Address(), tc.method, roleIDFile, secretIDFile, sinkFile))
+
+			cfg, err := config.ParseConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h, err := NewFromConfig(cfg, data, tc.enableCache, t.TempDir(), hclog.NewNullLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := sinkFile
+			if tc.scoped {
+				expected = filepath.Join(sinkDir, fmt.Sprintf("uid-%d", os.Getuid()), "agent-token")
+			}
+
+			if got := cfg.AutoAuth.Sinks[0].Config["path"]; got != expected {
+				t.Fatalf("Expected the sink %s, got %v", expected, got)
+			}
+
+			if _, _, err = h.Get(""); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
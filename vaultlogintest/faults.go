@@ -0,0 +1,252 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sealedError is the error with which Vault responds while it is sealed.
+const sealedError = "Vault is sealed"
+
+// Fault is a failure which the fake injects into its responses. Use
+// Latency, FailWith, Sealed or ResetConnection to create one.
+type Fault struct {
+	// Request is the number of the request, starting at 1, to which the
+	// fault applies. If it is zero, the fault applies to every request.
+	Request int
+
+	// Delay is how long the fake waits before it responds.
+	Delay time.Duration
+
+	// Status is the HTTP status of the error response. If it is zero and
+	// Reset is false, the request is processed as usual after the delay.
+	Status int
+
+	// Errors are the errors of the error response.
+	Errors []string
+
+	// Reset closes the connection without responding.
+	Reset bool
+}
+
+// Latency delays the response by d.
+func Latency(d time.Duration) Fault {
+	return Fault{Delay: d}
+}
+
+// FailWith responds with the HTTP status and errors, e.g. 429, 500 or
+// 503.
+func FailWith(status int, errs ...string) Fault {
+	return Fault{Status: status, Errors: errs}
+}
+
+// Sealed responds as Vault does while it is sealed. To seal the whole
+// fake, including its health, use FakeVault.Seal instead.
+func Sealed() Fault {
+	return FailWith(http.StatusServiceUnavailable, sealedError)
+}
+
+// ResetConnection closes the connection without responding, as a load
+// balancer or a crashing server does.
+func ResetConnection() Fault {
+	return Fault{Reset: true}
+}
+
+// OnRequest returns a copy of the fault which only applies to the nth
+// request.
+func (f Fault) OnRequest(n int) Fault {
+	f.Request = n
+	return f
+}
+
+// After returns a copy of the fault which is only applied after the
+// delay.
+func (f Fault) After(delay time.Duration) Fault {
+	f.Delay = delay
+	return f
+}
+
+// injectedFault is a fault of a path and the number of requests made to
+// the path before the fault was injected.
+type injectedFault struct {
+	Fault
+	base int
+}
+
+// WithFaults injects faults into the responses to path (e.g.
+// "secret/docker" or "auth/approle/login"), or to every path if path is
+// empty. The requests are counted separately for every path, or across
+// all paths if path is empty. If several faults apply to a request, the
+// first one is used. For example,
+//
+//	WithFaults("secret/docker", FailWith(http.StatusTooManyRequests).OnRequest(2), ResetConnection().OnRequest(3))
+//
+// rate-limits the second read of "secret/docker", resets the connection
+// of the third and processes the others as usual.
+func WithFaults(path string, faults ...Fault) Option {
+	return func(f *FakeVault) {
+		f.injectFaults(path, faults)
+	}
+}
+
+// InjectFaults injects faults into the responses to path, like
+// WithFaults. The request numbers of the faults count from the next
+// request to path.
+func (f *FakeVault) InjectFaults(path string, faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.injectFaults(path, faults)
+}
+
+// ClearFaults removes the faults injected into the responses to path.
+func (f *FakeVault) ClearFaults(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.faults, strings.Trim(path, "/"))
+}
+
+// Seal seals the fake: its health reports it as sealed and every other
+// request fails as it does when Vault is sealed, until Unseal is called.
+func (f *FakeVault) Seal() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sealed = true
+}
+
+// Unseal unseals the fake.
+func (f *FakeVault) Unseal() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sealed = false
+}
+
+func (f *FakeVault) injectFaults(path string, faults []Fault) {
+	path = strings.Trim(path, "/")
+
+	base := f.requests[path]
+	if path == "" {
+		base = f.total
+	}
+
+	for _, fault := range faults {
+		f.faults[path] = append(f.faults[path], injectedFault{Fault: fault, base: base})
+	}
+}
+
+// fault returns the first fault which applies to the current request to
+// path, if any. f.mu must be held.
+func (f *FakeVault) fault(path string) (Fault, bool) {
+	for _, p := range []string{path, ""} {
+		n := f.requests[p]
+		if p == "" {
+			n = f.total
+		}
+
+		for _, fault := range f.faults[p] {
+			if fault.Request == 0 || fault.base+fault.Request == n {
+				return fault.Fault, true
+			}
+		}
+	}
+
+	return Fault{}, false
+}
+
+// applyFault applies the fault which applies to the current request, if
+// any. It reports whether the request should be processed as usual. f.mu
+// must be held; it is released while waiting.
+func (f *FakeVault) applyFault(w http.ResponseWriter, r *http.Request, path string) bool {
+	fault, ok := f.fault(path)
+	if !ok {
+		return true
+	}
+
+	if fault.Delay > 0 {
+		f.mu.Unlock()
+
+		timer := time.NewTimer(fault.Delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+		}
+
+		f.mu.Lock()
+	}
+
+	switch {
+	case fault.Reset:
+		resetConnection(w)
+	case fault.Status != 0:
+		respondError(w, fault.Status, fault.Errors...)
+	default:
+		return true
+	}
+
+	return false
+}
+
+// resetConnection closes the connection of the response. The connection
+// is reset rather than closed gracefully where possible.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		// HTTP/2 streams cannot be hijacked, so abort the stream instead
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0) // nolint: errcheck
+	}
+
+	conn.Close() // nolint: errcheck
+}
+
+// respondSealed responds as Vault does while it is sealed. Health checks
+// may ask for another status than 503 with the sealedcode parameter.
+func respondSealed(w http.ResponseWriter, r *http.Request, path string) {
+	if path != "sys/health" {
+		respondError(w, http.StatusServiceUnavailable, sealedError)
+		return
+	}
+
+	status := http.StatusServiceUnavailable
+	if code, err := strconv.Atoi(r.URL.Query().Get("sealedcode")); err == nil {
+		status = code
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck
+		"initialized": true,
+		"sealed":      true,
+		"standby":     true,
+		"version":     fakeVersion,
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// NewInvoker returns a ProgramFunc which runs helper in-process the same
+// way the Docker CLI runs a credential helper binary. Use it with the
+// functions of the github.com/docker/docker-credential-helpers/client
+// package, e.g.:
+//
+//	creds, err := client.Get(vaultlogintest.NewInvoker(helper), "registry.example.com")
+func NewInvoker(helper credentials.Helper) client.ProgramFunc {
+	return func(args ...string) client.Program {
+		return &program{helper: helper, args: args}
+	}
+}
+
+type program struct {
+	helper credentials.Helper
+	args   []string
+	in     io.Reader
+}
+
+// Output runs the helper. Like a credential helper binary, it writes any
+// error to its output and reports that it exited unsuccessfully.
+func (p *program) Output() ([]byte, error) {
+	if len(p.args) != 1 {
+		return nil, errors.New("credential helpers take exactly one argument")
+	}
+
+	in := p.in
+	if in == nil {
+		in = &bytes.Buffer{}
+	}
+
+	var out bytes.Buffer
+	if err := credentials.HandleCommand(p.helper, p.args[0], in, &out); err != nil {
+		out.Reset()
+		out.WriteString(err.Error())
+
+		return out.Bytes(), errors.New("exit status 1")
+	}
+
+	return out.Bytes(), nil
+}
+
+func (p *program) Input(in io.Reader) {
+	p.in = in
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+func TestInvoker(t *testing.T) {
+	fake := NewFakeVault(t,
+		WithKVv2("secret/data/docker", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "correct horse battery staple",
+		}),
+		WithAppRole("role-id", "secret-id"),
+	)
+
+	dir := t.TempDir()
+	roleIDFile := filepath.Join(dir, "role-id")
+	secretIDFile := filepath.Join(dir, "secret-id")
+	if err := os.WriteFile(roleIDFile, []byte("role-id"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secretIDFile, []byte("secret-id"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := helper.New(helper.Options{
+		Logger:      hclog.NewNullLogger(),
+		Client:      fake.Client(),
+		Secret:      staticSecret("secret/data/docker"),
+		AuthTimeout: 3,
+		AuthConfig: &config.AutoAuth{
+			Method: &config.Method{
+				Type:      "approle",
+				MountPath: "auth/approle",
+				Config: map[string]interface{}{
+					"role_id_file_path":                   roleIDFile,
+					"secret_id_file_path":                 secretIDFile,
+					"remove_secret_id_file_after_reading": false,
+				},
+			},
+		},
+	})
+	invoker := NewInvoker(h)
+
+	t.Run("get", func(t *testing.T) {
+		creds, err := client.Get(invoker, "registry.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := &credentials.Credentials{
+			ServerURL: "registry.example.com",
+			Username:  "test@user.com",
+			Secret:    "correct horse battery staple",
+		}
+		if !cmp.Equal(expected, creds) {
+			t.Fatalf("Credentials differ:\n%v", cmp.Diff(expected, creds))
+		}
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		fake.DeleteSecret("secret/data/docker")
+
+		_, err := client.Get(invoker, "registry.example.com")
+		if !credentials.IsErrCredentialsNotFound(err) {
+			t.Fatalf("Expected a credentials not found error, got %v", err)
+		}
+	})
+
+	t.Run("store", func(t *testing.T) {
+		err := client.Store(invoker, &credentials.Credentials{
+			ServerURL: "registry.example.com",
+			Username:  "test@user.com",
+			Secret:    "secret",
+		})
+		if err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+		expected := "error storing credentials - err: exit status 1, out: `not implemented`"
+		if err.Error() != expected {
+			t.Fatalf("Errors differ:\n%v", cmp.Diff(expected, err.Error()))
+		}
+	})
+}
+
+type staticSecret string
+
+func (s staticSecret) GetPath(string) (string, error) {
+	return string(s), nil
+}
+
+func (s staticSecret) FieldKeys(string) (string, string) {
+	return "", ""
+}
+
+func (s staticSecret) IdentityTokenKey(string) string {
+	return ""
+}
+
+func (s staticSecret) IdentityTokenUsername(string) (string, bool) {
+	return "", false
+}
+
+func (s staticSecret) Templates(string) (string, string) {
+	return "", ""
+}
+
+func (s staticSecret) UsernamePath(string) string {
+	return ""
+}
+
+func (s staticSecret) Registries() []string {
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WithKubernetesRole enables Kubernetes logins at "auth/kubernetes" for
+// the role. A login succeeds if its JWT, which is not verified, is a well
+// formed service account token which has not expired and whose claims
+// have the values of boundClaims, e.g.
+//
+//	WithKubernetesRole("ci", map[string]string{"sub": "system:serviceaccount:ci:builder"})
+func WithKubernetesRole(role string, boundClaims map[string]string) Option {
+	return withJWTRole("kubernetes", role, boundClaims)
+}
+
+// WithJWTRole enables JWT logins at "auth/jwt" for the role. Logins are
+// validated like those of WithKubernetesRole.
+func WithJWTRole(role string, boundClaims map[string]string) Option {
+	return withJWTRole("jwt", role, boundClaims)
+}
+
+func withJWTRole(mount, role string, boundClaims map[string]string) Option {
+	return func(f *FakeVault) {
+		if f.jwtRoles[mount] == nil {
+			f.jwtRoles[mount] = make(map[string]map[string]string)
+		}
+
+		f.jwtRoles[mount][role] = boundClaims
+	}
+}
+
+// validateJWTLogin validates a login with the JWT to the role of the
+// Kubernetes or JWT auth method mounted at mount. f.mu must be held.
+func (f *FakeVault) validateJWTLogin(mount, role, jwt string) error {
+	switch {
+	case role == "":
+		return fmt.Errorf("missing role")
+	case jwt == "":
+		return fmt.Errorf("missing jwt")
+	}
+
+	boundClaims, ok := f.jwtRoles[mount][role]
+	if !ok {
+		return fmt.Errorf("role %q could not be found", role)
+	}
+
+	claims, err := parseJWTClaims(jwt)
+	if err != nil {
+		return fmt.Errorf("error validating token: %w", err)
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && !f.clock.Now().Before(time.Unix(int64(exp), 0)) {
+		return fmt.Errorf("error validating token: token is expired")
+	}
+
+	for claim, want := range boundClaims {
+		if got, _ := claims[claim].(string); got != want {
+			return fmt.Errorf("error validating claims: claim %q does not match any associated bound claim values", claim)
+		}
+	}
+
+	return nil
+}
+
+// parseJWTClaims returns the claims of a JWT without verifying it.
+func parseJWTClaims(jwt string) (map[string]interface{}, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is malformed")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("token is malformed: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("token is malformed: %w", err)
+	}
+
+	return claims, nil
+}
+
+// NewJWT returns an unsigned JWT with the claims, for logins with the
+// roles of WithKubernetesRole and WithJWTRole. The fake does not verify
+// the signatures of JWTs.
+func NewJWT(claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
@@ -0,0 +1,322 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kvv2Secret is a secret of a KV version 2 mount with every version
+// written to it.
+type kvv2Secret struct {
+	versions       []kvv2Version
+	customMetadata map[string]interface{}
+	created        time.Time
+	updated        time.Time
+}
+
+type kvv2Version struct {
+	data    map[string]interface{}
+	created time.Time
+	deleted time.Time
+}
+
+// WithCustomMetadata sets the custom_metadata of a KV version 2 secret,
+// which is returned with every version of the secret. The path is the API
+// path of the secret, including the "data" segment.
+func WithCustomMetadata(path string, metadata map[string]interface{}) Option {
+	return func(f *FakeVault) {
+		if mount, name, ok := splitKVv2Path(path); ok {
+			f.kvv2Entry(mount, name).customMetadata = metadata
+		}
+	}
+}
+
+// DeleteVersion deletes a version of a KV version 2 secret, as "vault kv
+// delete -versions" does. The version can no longer be read, but remains
+// in the metadata of the secret. The path is the API path of the secret,
+// including the "data" segment.
+func (f *FakeVault) DeleteVersion(path string, version int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	mount, name, ok := splitKVv2Path(path)
+	if !ok {
+		return
+	}
+
+	if secret := f.kvv2[mount][name]; secret != nil && version > 0 && version <= len(secret.versions) {
+		secret.versions[version-1].deleted = time.Now().UTC()
+	}
+}
+
+// splitKVv2Path splits the API path of a KV version 2 secret into the
+// path of its mount and its name, e.g. "secret/data/docker/creds" into
+// "secret" and "docker/creds".
+func splitKVv2Path(path string) (mount, name string, ok bool) {
+	path = strings.Trim(path, "/")
+
+	i := strings.Index(path, "/data/")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	mount, name = path[:i], path[i+len("/data/"):]
+
+	return mount, name, name != ""
+}
+
+// putKVv2 writes a new version of the secret at the API path. It reports
+// whether the path is that of a KV version 2 secret. f.mu must be held.
+func (f *FakeVault) putKVv2(path string, data map[string]interface{}) bool {
+	mount, name, ok := splitKVv2Path(path)
+	if !ok {
+		return false
+	}
+
+	secret := f.kvv2Entry(mount, name)
+
+	now := time.Now().UTC()
+	secret.versions = append(secret.versions, kvv2Version{data: data, created: now})
+	secret.updated = now
+
+	return true
+}
+
+// kvv2Entry returns the secret of the mount, which is created if it does
+// not exist. f.mu must be held, unless f is not serving yet.
+func (f *FakeVault) kvv2Entry(mount, name string) *kvv2Secret {
+	if f.kvv2[mount] == nil {
+		f.kvv2[mount] = make(map[string]*kvv2Secret)
+	}
+
+	secret := f.kvv2[mount][name]
+	if secret == nil {
+		now := time.Now().UTC()
+		secret = &kvv2Secret{created: now, updated: now}
+		f.kvv2[mount][name] = secret
+	}
+
+	return secret
+}
+
+// hasKVv2 reports whether a version of the secret at the API path can be
+// read.
+func (f *FakeVault) hasKVv2(path string) bool {
+	mount, name, ok := splitKVv2Path(path)
+	if !ok {
+		return false
+	}
+
+	secret := f.kvv2[mount][name]
+
+	return secret != nil && len(secret.versions) > 0 && secret.versions[len(secret.versions)-1].deleted.IsZero()
+}
+
+// handleKVv2 serves the data and metadata endpoints of the KV version 2
+// mounts. It reports whether path belongs to one. f.mu must be held.
+func (f *FakeVault) handleKVv2(w http.ResponseWriter, r *http.Request, path string) bool {
+	for mount, secrets := range f.kvv2 {
+		switch {
+		case strings.HasPrefix(path, mount+"/data/") && r.Method == http.MethodGet:
+			f.readKVv2(w, r, secrets[strings.TrimPrefix(path, mount+"/data/")])
+		case isList(r) && (path == mount+"/metadata" || strings.HasPrefix(path, mount+"/metadata/")):
+			listKVv2(w, secrets, strings.TrimPrefix(strings.TrimPrefix(path, mount+"/metadata"), "/"))
+		case strings.HasPrefix(path, mount+"/metadata/") && r.Method == http.MethodGet:
+			readKVv2Metadata(w, secrets[strings.TrimPrefix(path, mount+"/metadata/")])
+		default:
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// readKVv2 responds with the version of the secret given by the version
+// query parameter, or with its current version.
+func (f *FakeVault) readKVv2(w http.ResponseWriter, r *http.Request, secret *kvv2Secret) {
+	if secret == nil || len(secret.versions) == 0 {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	version := len(secret.versions)
+
+	if raw := r.URL.Query().Get("version"); raw != "" && raw != "0" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			respondError(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+
+		if n > len(secret.versions) {
+			respondError(w, http.StatusNotFound)
+			return
+		}
+
+		version = n
+	}
+
+	v := secret.versions[version-1]
+
+	metadata := map[string]interface{}{
+		"created_time":    formatTime(v.created),
+		"custom_metadata": secret.customMetadata,
+		"deletion_time":   formatTime(v.deleted),
+		"destroyed":       false,
+		"version":         version,
+	}
+
+	// Like Vault, the metadata of a deleted version is returned with a
+	// 404 so that clients can tell it apart from a missing secret
+	if !v.deleted.IsZero() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck
+			"data": map[string]interface{}{"data": nil, "metadata": metadata},
+		})
+
+		return
+	}
+
+	respond(w, map[string]interface{}{"data": map[string]interface{}{"data": v.data, "metadata": metadata}})
+}
+
+func readKVv2Metadata(w http.ResponseWriter, secret *kvv2Secret) {
+	if secret == nil {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	versions := make(map[string]interface{}, len(secret.versions))
+	for i, v := range secret.versions {
+		versions[strconv.Itoa(i+1)] = map[string]interface{}{
+			"created_time":  formatTime(v.created),
+			"deletion_time": formatTime(v.deleted),
+			"destroyed":     false,
+		}
+	}
+
+	oldest := 0
+	if len(secret.versions) > 0 {
+		oldest = 1
+	}
+
+	respond(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"cas_required":         false,
+			"created_time":         formatTime(secret.created),
+			"current_version":      len(secret.versions),
+			"custom_metadata":      secret.customMetadata,
+			"delete_version_after": "0s",
+			"max_versions":         0,
+			"oldest_version":       oldest,
+			"updated_time":         formatTime(secret.updated),
+			"versions":             versions,
+		},
+	})
+}
+
+// listKVv2 responds with the names of the secrets and folders directly
+// under the prefix. Folders end with a slash.
+func listKVv2(w http.ResponseWriter, secrets map[string]*kvv2Secret, prefix string) {
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	seen := make(map[string]bool)
+	keys := []string{}
+
+	for name := range secrets {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(name, prefix)
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	sort.Strings(keys)
+
+	respond(w, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+}
+
+// handleMounts serves sys/internal/ui/mounts/<path>, which the Vault CLI
+// uses to find out the mount of a path and its KV version. The first
+// segment of a KV version 1 secret is taken to be its mount.
+func (f *FakeVault) handleMounts(w http.ResponseWriter, path string) {
+	path = strings.TrimPrefix(path, "sys/internal/ui/mounts/")
+
+	mount, version := "", ""
+
+	for m := range f.kvv2 {
+		if (path == m || strings.HasPrefix(path, m+"/")) && len(m) > len(mount) {
+			mount, version = m, "2"
+		}
+	}
+
+	if mount == "" {
+		for p := range f.secrets {
+			if m := strings.SplitN(p, "/", 2)[0]; path == m || strings.HasPrefix(path, m+"/") {
+				mount, version = m, "1"
+			}
+		}
+	}
+
+	if mount == "" {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	respond(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"path":    mount + "/",
+			"type":    "kv",
+			"options": map[string]interface{}{"version": version},
+		},
+	})
+}
+
+func isList(r *http.Request) bool {
+	return r.Method == "LIST" || (r.Method == http.MethodGet && r.URL.Query().Get("list") == "true")
+}
+
+// formatTime formats t as Vault does, or returns an empty string if t is
+// zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
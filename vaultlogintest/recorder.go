@@ -0,0 +1,116 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RecordedRequest is a request made to the fake.
+type RecordedRequest struct {
+	// Method is the HTTP method of the request, e.g. "GET" or "LIST".
+	Method string
+
+	// Path is the API path of the request, without the "/v1/" prefix
+	// (e.g. "secret/docker" or "auth/approle/login").
+	Path string
+
+	// Query is the query of the request.
+	Query url.Values
+
+	// Header is the header of the request.
+	Header http.Header
+
+	// Token is the Vault token of the request, if any.
+	Token string
+
+	// Data is the JSON body of the request, if any.
+	Data map[string]interface{}
+
+	// Time is when the fake received the request.
+	Time time.Time
+}
+
+// Recorded returns the requests made to path, or every request if path
+// is empty, in the order they were received.
+func (f *FakeVault) Recorded(path string) []RecordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path = strings.Trim(path, "/")
+
+	var recorded []RecordedRequest
+
+	for _, r := range f.recorded {
+		if path == "" || r.Path == path {
+			recorded = append(recorded, r)
+		}
+	}
+
+	return recorded
+}
+
+// AssertRequests reports an error to t unless n requests were made to
+// path, or to any path if path is empty. t may be the *testing.T or
+// *testing.B of any test, not only that of the fake.
+func (f *FakeVault) AssertRequests(t testing.TB, path string, n int) {
+	t.Helper()
+
+	if got := len(f.Recorded(path)); got != n {
+		t.Errorf("Expected %d requests to %q, got %d", n, path, got)
+	}
+}
+
+// AssertLastRequest reports an error to t unless the last request made to
+// path has the method and its JSON body has the fields of data, among
+// others.
+func (f *FakeVault) AssertLastRequest(t testing.TB, path, method string, data map[string]interface{}) {
+	t.Helper()
+
+	recorded := f.Recorded(path)
+	if len(recorded) == 0 {
+		t.Errorf("Expected a request to %q, got none", path)
+		return
+	}
+
+	last := recorded[len(recorded)-1]
+
+	if last.Method != method {
+		t.Errorf("Expected the last request to %q to be a %s request, got %s", path, method, last.Method)
+	}
+
+	for key, want := range data {
+		if got, ok := last.Data[key]; !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected the field %q of the last request to %q to be %v, got %v", key, path, want, got)
+		}
+	}
+}
+
+// record records a request. f.mu must be held.
+func (f *FakeVault) record(r *http.Request, path string, data map[string]interface{}) {
+	f.recorded = append(f.recorded, RecordedRequest{
+		Method: r.Method,
+		Path:   path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Token:  r.Header.Get("X-Vault-Token"),
+		Data:   data,
+		Time:   f.clock.Now(),
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BadCertificate is a way in which the certificate presented by the fake
+// is invalid. Use it with WithBadCertificate.
+type BadCertificate int
+
+const (
+	// CertificateExpired is a certificate signed by the CA of the fake
+	// which expired a day ago.
+	CertificateExpired BadCertificate = iota + 1
+
+	// CertificateUntrusted is a certificate signed by a CA other than the
+	// one returned by CACert.
+	CertificateUntrusted
+
+	// CertificateWrongHost is a certificate signed by the CA of the fake
+	// which is valid for another host than the one the fake listens on.
+	CertificateWrongHost
+)
+
+// fakeTLS is the certificate authority of a fake which serves over TLS.
+type fakeTLS struct {
+	bad     BadCertificate
+	dir     string
+	caPEM   []byte
+	caFile  string
+	keyPair tls.Certificate
+}
+
+// WithTLS serves the fake over TLS with a certificate for 127.0.0.1 and
+// localhost, signed by a CA generated for the fake. CACert and CACertFile
+// return the CA, and the clients returned by Client trust it.
+func WithTLS() Option {
+	return func(f *FakeVault) {
+		if f.tls == nil {
+			f.tls = &fakeTLS{}
+		}
+	}
+}
+
+// WithBadCertificate serves the fake over TLS, like WithTLS, but presents
+// a certificate which clients trusting the CA of the fake must reject.
+func WithBadCertificate(bad BadCertificate) Option {
+	return func(f *FakeVault) {
+		f.tls = &fakeTLS{bad: bad}
+	}
+}
+
+// CACert returns the PEM-encoded certificate of the CA of the fake, or
+// nil if it does not serve over TLS.
+func (f *FakeVault) CACert() []byte {
+	if f.tls == nil {
+		return nil
+	}
+
+	return f.tls.caPEM
+}
+
+// CACertFile returns the path of a file holding the certificate of the CA
+// of the fake, e.g. for the ca_cert of a Vault address or the VAULT_CACERT
+// environment variable. It returns an empty string if the fake does not
+// serve over TLS. The file is removed when the fake is closed.
+func (f *FakeVault) CACertFile() string {
+	return f.tls.file()
+}
+
+func (t *fakeTLS) file() string {
+	if t == nil {
+		return ""
+	}
+
+	return t.caFile
+}
+
+// remove removes the files of the CA, if any.
+func (t *fakeTLS) remove() {
+	if t != nil && t.dir != "" {
+		os.RemoveAll(t.dir) // nolint: errcheck
+	}
+}
+
+// generate creates the CA of the fake and the certificate it presents, and
+// writes the CA to a temporary directory.
+func (t *fakeTLS) generate() error {
+	ca, caKey, caPEM, err := newCA("vaultlogintest CA")
+	if err != nil {
+		return err
+	}
+
+	signer, signerKey := ca, caKey
+	if t.bad == CertificateUntrusted {
+		if signer, signerKey, _, err = newCA("vaultlogintest untrusted CA"); err != nil {
+			return err
+		}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "vaultlogintest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	switch t.bad {
+	case CertificateExpired:
+		template.NotBefore = time.Now().Add(-48 * time.Hour)
+		template.NotAfter = time.Now().Add(-24 * time.Hour)
+	case CertificateWrongHost:
+		template.DNSNames = []string{"vault.invalid"}
+		template.IPAddresses = nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		return err
+	}
+
+	if t.dir, err = os.MkdirTemp("", "vaultlogintest"); err != nil {
+		return err
+	}
+
+	t.caPEM = caPEM
+	t.keyPair = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	t.caFile = filepath.Join(t.dir, "ca.pem")
+
+	return os.WriteFile(t.caFile, caPEM, 0600)
+}
+
+func newCA(name string) (*x509.Certificate, *ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+// defaultTokenMaxTTL is the default maximum TTL of the tokens issued by
+// the fake, which is that of Vault.
+const defaultTokenMaxTTL = 768 * time.Hour
+
+// fakeToken is a token issued by the fake. The root token has no expiry.
+type fakeToken struct {
+	issued  time.Time
+	expires time.Time
+	ttl     time.Duration
+}
+
+// WithTokenMaxTTL sets the maximum TTL of the tokens issued by the fake,
+// beyond which they cannot be renewed. It defaults to 768 hours.
+func WithTokenMaxTTL(ttl time.Duration) Option {
+	return func(f *FakeVault) {
+		f.tokenMaxTTL = ttl
+	}
+}
+
+// WithClock sets the clock by which the fake issues tokens and expires
+// them, such as the fake clock of the clock package. It defaults to the
+// system clock.
+func WithClock(clk clock.Clock) Option {
+	return func(f *FakeVault) {
+		f.clock = clk
+	}
+}
+
+// TokenTTL returns the remaining TTL of a token, or zero if the token does
+// not exist, has expired or never expires.
+func (f *FakeVault) TokenTTL(token string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.token(token)
+	if !ok || t.expires.IsZero() {
+		return 0
+	}
+
+	return t.expires.Sub(f.clock.Now())
+}
+
+// issueToken issues a new token with the TTL of the tokens of the fake.
+// f.mu must be held.
+func (f *FakeVault) issueToken() string {
+	f.issued++
+
+	token := fmt.Sprintf("hvs.fake-token-%d", f.issued)
+
+	now := f.clock.Now()
+	f.tokens[token] = fakeToken{issued: now, expires: now.Add(f.tokenTTL), ttl: f.tokenTTL}
+
+	return token
+}
+
+// token returns the token if it exists and has not expired. Expired tokens
+// are removed, as Vault revokes them. f.mu must be held.
+func (f *FakeVault) token(token string) (fakeToken, bool) {
+	t, ok := f.tokens[token]
+	if !ok {
+		return fakeToken{}, false
+	}
+
+	if !t.expires.IsZero() && !f.clock.Now().Before(t.expires) {
+		delete(f.tokens, token)
+		return fakeToken{}, false
+	}
+
+	return t, true
+}
+
+// valid reports whether the token exists and has not expired. f.mu must
+// be held.
+func (f *FakeVault) valid(token string) bool {
+	_, ok := f.token(token)
+	return ok
+}
+
+// ttl returns the remaining TTL of a token in seconds, or zero if it
+// never expires. f.mu must be held.
+func (f *FakeVault) ttl(token string) int {
+	t := f.tokens[token]
+	if t.expires.IsZero() {
+		return 0
+	}
+
+	return int(t.expires.Sub(f.clock.Now()).Round(time.Second) / time.Second)
+}
+
+// lookupSelf responds with the properties of the token of the request.
+// f.mu must be held.
+func (f *FakeVault) lookupSelf(w http.ResponseWriter, token string) {
+	t := f.tokens[token]
+
+	var expireTime interface{}
+	if !t.expires.IsZero() {
+		expireTime = t.expires.UTC().Format(time.RFC3339Nano)
+	}
+
+	respond(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"id":               token,
+			"accessor":         "accessor-" + token,
+			"policies":         f.policies(token),
+			"creation_time":    t.issued.Unix(),
+			"creation_ttl":     int(t.ttl.Seconds()),
+			"issue_time":       t.issued.UTC().Format(time.RFC3339Nano),
+			"expire_time":      expireTime,
+			"explicit_max_ttl": 0,
+			"ttl":              f.ttl(token),
+			"renewable":        !t.expires.IsZero(),
+			"type":             "service",
+		},
+	})
+}
+
+// renewSelf extends the TTL of the token of the request by the increment
+// of the request, or by the TTL of the tokens of the fake, up to their
+// maximum TTL. f.mu must be held.
+func (f *FakeVault) renewSelf(w http.ResponseWriter, token string, increment interface{}) {
+	t := f.tokens[token]
+	if t.expires.IsZero() {
+		respondError(w, http.StatusBadRequest, "lease is not renewable")
+		return
+	}
+
+	ttl := f.tokenTTL
+	if increment != nil {
+		d, err := parseutil.ParseDurationSecond(increment)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid increment")
+			return
+		}
+
+		if d > 0 {
+			ttl = d
+		}
+	}
+
+	now := f.clock.Now()
+
+	t.expires = now.Add(ttl)
+	if max := t.issued.Add(f.tokenMaxTTL); t.expires.After(max) {
+		t.expires = max
+	}
+
+	f.tokens[token] = t
+
+	respond(w, map[string]interface{}{"auth": f.auth(token)})
+}
@@ -0,0 +1,702 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package vaultlogintest provides utilities for testing integrations with
+// the credential helper without running a real Vault server or the Docker
+// CLI.
+package vaultlogintest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+)
+
+const (
+	defaultTokenTTL = time.Hour
+
+	// fakeVersion is the version of Vault reported by the fake.
+	fakeVersion = "1.15.4"
+)
+
+// FakeVault is an in-memory imitation of the parts of the Vault HTTP API
+// used by the credential helper: reading KV and dynamic secrets (including
+// the versions and metadata of KV version 2 secrets), logging in with the
+// AppRole, userpass, Kubernetes and JWT methods (optionally
+// response-wrapped), unwrapping, looking up, renewing and revoking tokens,
+// looking up and renewing leases, and reporting its health, the mounts of
+// paths and the capabilities of a token. Every valid token may read every secret. The
+// responses to the logins of a role can be scripted with WithLoginBehavior,
+// and latency, errors and connection resets can be injected into the
+// responses to any path with WithFaults.
+type FakeVault struct {
+	t      testing.TB
+	server *httptest.Server
+	tls    *fakeTLS
+
+	mu          sync.Mutex
+	rootToken   string
+	issued      int
+	clock       clock.Clock
+	tokens      map[string]fakeToken
+	tokenTTL    time.Duration
+	tokenMaxTTL time.Duration
+	secrets     map[string]interface{}
+	kvv2        map[string]map[string]*kvv2Secret
+	dynamic     map[string]dynamicSecret
+	leases      map[string]dynamicSecret
+	approles    map[string]string
+	userpass    map[string]string
+	jwtRoles    map[string]map[string]map[string]string
+	wrapped     map[string]interface{}
+	requests    map[string]int
+	recorded    []RecordedRequest
+	total       int
+	faults      map[string][]injectedFault
+	sealed      bool
+	behaviors   map[string][]LoginResponse
+	attempts    map[string]int
+}
+
+// Option configures a FakeVault.
+type Option func(*FakeVault)
+
+// WithKVv1 stores data in a KV version 1 secret at path.
+func WithKVv1(path string, data map[string]interface{}) Option {
+	return func(f *FakeVault) {
+		f.setSecret(path, kvv1(data))
+	}
+}
+
+// WithKVv2 stores data in a new version of a KV version 2 secret. The path
+// is the API path of the secret, including the "data" segment (e.g.
+// "secret/data/docker"); the part before it is the path of the mount.
+func WithKVv2(path string, data map[string]interface{}) Option {
+	return func(f *FakeVault) {
+		f.SetKVv2(path, data)
+	}
+}
+
+// WithDynamicSecret stores data in a secret at path which, like the
+// secrets of dynamic secrets engines, gets a new renewable lease with the
+// given TTL every time it is read.
+func WithDynamicSecret(path string, data map[string]interface{}, ttl time.Duration) Option {
+	return func(f *FakeVault) {
+		f.dynamic[strings.Trim(path, "/")] = dynamicSecret{data: data, ttl: ttl}
+	}
+}
+
+// WithAppRole enables AppRole logins at "auth/approle" with the given role
+// ID and secret ID.
+func WithAppRole(roleID, secretID string) Option {
+	return func(f *FakeVault) {
+		f.approles[roleID] = secretID
+	}
+}
+
+// WithUserpass enables userpass logins at "auth/userpass" with the given
+// username and password.
+func WithUserpass(username, password string) Option {
+	return func(f *FakeVault) {
+		f.userpass[username] = password
+	}
+}
+
+// LoginResponse is how the fake responds to a login attempt. Use
+// RespondSuccess or RespondError to create one.
+type LoginResponse struct {
+	// Status is the HTTP status of the error response. If it is zero, the
+	// login is processed as usual.
+	Status int
+
+	// Errors are the errors of the error response.
+	Errors []string
+
+	// Delay is how long the fake waits before it responds.
+	Delay time.Duration
+}
+
+// RespondSuccess processes the login as usual, so it succeeds if the
+// credentials are valid.
+func RespondSuccess() LoginResponse {
+	return LoginResponse{}
+}
+
+// RespondError responds to the login with the HTTP status and errors.
+func RespondError(status int, errs ...string) LoginResponse {
+	return LoginResponse{Status: status, Errors: errs}
+}
+
+// After returns a copy of the response which is only sent after the
+// delay.
+func (r LoginResponse) After(delay time.Duration) LoginResponse {
+	r.Delay = delay
+	return r
+}
+
+// WithLoginBehavior sets how the fake responds to the logins of a role,
+// which is the role ID of an AppRole login, the username of a userpass
+// login or the role of a Kubernetes or JWT login. The responses are used in order, one per login attempt, and the
+// last one is used for all further attempts. For example,
+//
+//	WithLoginBehavior("flaky", RespondError(http.StatusInternalServerError), RespondSuccess())
+//
+// fails the first login of the "flaky" role and processes the others as
+// usual.
+func WithLoginBehavior(role string, responses ...LoginResponse) Option {
+	return func(f *FakeVault) {
+		f.behaviors[role] = responses
+	}
+}
+
+// WithTokenTTL sets the TTL of the tokens issued by the fake. It defaults
+// to one hour.
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(f *FakeVault) {
+		f.tokenTTL = ttl
+	}
+}
+
+// NewFakeVault starts a FakeVault which is closed when the test ends. It
+// listens on a random port of the loopback interface as soon as it is
+// returned, so clients can be pointed at Address right away.
+func NewFakeVault(t testing.TB, opts ...Option) *FakeVault {
+	t.Helper()
+
+	f, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.t = t
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// New starts a FakeVault outside of a test, e.g. in a benchmark or an
+// example program. Unlike NewFakeVault, it must be closed with Close.
+func New(opts ...Option) (*FakeVault, error) {
+	f := &FakeVault{
+		rootToken:   "root",
+		clock:       clock.System(),
+		tokens:      make(map[string]fakeToken),
+		tokenTTL:    defaultTokenTTL,
+		tokenMaxTTL: defaultTokenMaxTTL,
+		secrets:     make(map[string]interface{}),
+		kvv2:        make(map[string]map[string]*kvv2Secret),
+		dynamic:     make(map[string]dynamicSecret),
+		leases:      make(map[string]dynamicSecret),
+		approles:    make(map[string]string),
+		userpass:    make(map[string]string),
+		jwtRoles:    make(map[string]map[string]map[string]string),
+		wrapped:     make(map[string]interface{}),
+		requests:    make(map[string]int),
+		faults:      make(map[string][]injectedFault),
+		behaviors:   make(map[string][]LoginResponse),
+		attempts:    make(map[string]int),
+	}
+	f.tokens[f.rootToken] = fakeToken{issued: f.clock.Now()}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	f.server = httptest.NewUnstartedServer(http.HandlerFunc(f.handle))
+
+	if f.tls != nil {
+		if err := f.tls.generate(); err != nil {
+			return nil, fmt.Errorf("error generating the certificates of the fake: %w", err)
+		}
+
+		// Clients rejecting the certificate are expected, so do not log
+		// the failed handshakes
+		f.server.Config.ErrorLog = log.New(io.Discard, "", 0)
+		f.server.TLS = &tls.Config{Certificates: []tls.Certificate{f.tls.keyPair}} // nolint: gosec
+		f.server.StartTLS()
+	} else {
+		f.server.Start()
+	}
+
+	return f, nil
+}
+
+// Close stops the fake right away, closing the connections of the
+// requests in flight, and removes its files.
+func (f *FakeVault) Close() {
+	f.server.Close()
+	f.tls.remove()
+}
+
+// Address returns the address of the fake.
+func (f *FakeVault) Address() string {
+	return f.server.URL
+}
+
+// Port returns the port the fake listens on.
+func (f *FakeVault) Port() int {
+	return f.server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// Shutdown stops the fake gracefully: it stops accepting connections and
+// waits for the requests in flight to complete or for ctx to be done,
+// whichever comes first. Connections still open then are closed. It
+// returns the error of ctx if the requests did not complete.
+func (f *FakeVault) Shutdown(ctx context.Context) error {
+	err := f.server.Config.Shutdown(ctx)
+	f.server.Close()
+
+	return err
+}
+
+// RootToken returns a token which never expires.
+func (f *FakeVault) RootToken() string {
+	return f.rootToken
+}
+
+// Client returns a new Vault API client which talks to the fake and has
+// no token. If the fake serves over TLS, the client trusts its CA. It
+// fails the test of the fake, or panics if the fake was started with New,
+// if the client cannot be created; use NewClient to handle the error.
+func (f *FakeVault) Client() *api.Client {
+	client, err := f.NewClient()
+	if err != nil {
+		if f.t == nil {
+			panic(err)
+		}
+
+		f.t.Helper()
+		f.t.Fatal(err)
+	}
+
+	return client
+}
+
+// NewClient returns a new Vault API client like Client, or the error with
+// which it could not be created.
+func (f *FakeVault) NewClient() (*api.Client, error) {
+	config := api.DefaultConfig()
+	config.Address = f.Address()
+
+	if f.tls != nil {
+		if err := config.ConfigureTLS(&api.TLSConfig{CACertBytes: f.tls.caPEM}); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client.ClearToken()
+
+	return client, nil
+}
+
+// SetKVv1 stores data in a KV version 1 secret at path, replacing any
+// secret already stored there.
+func (f *FakeVault) SetKVv1(path string, data map[string]interface{}) {
+	f.setSecret(path, kvv1(data))
+}
+
+// SetKVv2 stores data in a new version of the KV version 2 secret at path,
+// which becomes its current version.
+func (f *FakeVault) SetKVv2(path string, data map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.putKVv2(path, data) {
+		f.secrets[strings.Trim(path, "/")] = kvv2(data)
+	}
+}
+
+// DeleteSecret deletes the secret at path. A KV version 2 secret is
+// deleted with all of its versions and metadata.
+func (f *FakeVault) DeleteSecret(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if mount, name, ok := splitKVv2Path(path); ok {
+		delete(f.kvv2[mount], name)
+	}
+
+	delete(f.secrets, strings.Trim(path, "/"))
+}
+
+// RevokeToken revokes a token so that subsequent requests using it fail.
+func (f *FakeVault) RevokeToken(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.tokens, token)
+}
+
+// RevokeLease revokes a lease so that subsequent attempts to renew or look
+// it up fail.
+func (f *FakeVault) RevokeLease(leaseID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.leases, leaseID)
+}
+
+// WrapToken issues a new token and returns a wrapping token whose
+// response-wrapped auth response holds it, as created by
+// "vault token create -wrap-ttl".
+func (f *FakeVault) WrapToken() (wrappingToken, token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token = f.issueToken()
+
+	return f.wrap(map[string]interface{}{"auth": f.auth(token)}), token
+}
+
+// WrapData returns a wrapping token whose response-wrapped response holds
+// data, such as the SecretID of an AppRole.
+func (f *FakeVault) WrapData(data map[string]interface{}) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.wrap(map[string]interface{}{"data": data})
+}
+
+// Requests returns the number of requests made to path (e.g.
+// "auth/approle/login" or "secret/docker").
+func (f *FakeVault) Requests(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests[strings.Trim(path, "/")]
+}
+
+func (f *FakeVault) setSecret(path string, secret interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.secrets[strings.Trim(path, "/")] = secret
+}
+
+func (f *FakeVault) handle(w http.ResponseWriter, r *http.Request) { // nolint: gocyclo
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+
+	var (
+		body    map[string]interface{}
+		bodyErr error
+	)
+
+	if r.Body != nil && r.ContentLength != 0 {
+		bodyErr = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests[path]++
+	f.total++
+	f.record(r, path, body)
+
+	if !f.applyFault(w, r, path) {
+		return
+	}
+
+	if f.sealed {
+		respondSealed(w, r, path)
+		return
+	}
+
+	if bodyErr != nil {
+		respondError(w, http.StatusBadRequest, "error decoding request body")
+		return
+	}
+
+	str := func(key string) string {
+		s, _ := body[key].(string)
+		return s
+	}
+
+	switch {
+	case path == "auth/approle/login" && isWrite(r):
+		if !f.loginBehavior(w, r, str("role_id")) {
+			return
+		}
+
+		secretID, ok := f.approles[str("role_id")]
+		if !ok || secretID != str("secret_id") {
+			respondError(w, http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+
+		f.login(w, r)
+	case strings.HasPrefix(path, "auth/userpass/login/") && isWrite(r):
+		username := strings.TrimPrefix(path, "auth/userpass/login/")
+		if !f.loginBehavior(w, r, username) {
+			return
+		}
+
+		password, ok := f.userpass[username]
+		if !ok || password != str("password") {
+			respondError(w, http.StatusBadRequest, "invalid username or password")
+			return
+		}
+
+		f.login(w, r)
+	case (path == "auth/kubernetes/login" || path == "auth/jwt/login") && isWrite(r):
+		if !f.loginBehavior(w, r, str("role")) {
+			return
+		}
+
+		mount := strings.TrimSuffix(strings.TrimPrefix(path, "auth/"), "/login")
+		if err := f.validateJWTLogin(mount, str("role"), str("jwt")); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		f.login(w, r)
+	case path == "sys/wrapping/unwrap" && isWrite(r):
+		wrappingToken := str("token")
+		if wrappingToken == "" {
+			wrappingToken = r.Header.Get("X-Vault-Token")
+		}
+
+		resp, ok := f.wrapped[wrappingToken]
+		if !ok {
+			respondError(w, http.StatusBadRequest, "wrapping token is not valid or does not exist")
+			return
+		}
+
+		// Wrapping tokens may only be used once
+		delete(f.wrapped, wrappingToken)
+		respond(w, resp)
+	case path == "sys/health" && r.Method == http.MethodGet:
+		respond(w, map[string]interface{}{
+			"initialized": true,
+			"sealed":      false,
+			"standby":     false,
+			"version":     fakeVersion,
+		})
+	case !f.valid(r.Header.Get("X-Vault-Token")):
+		respondError(w, http.StatusForbidden, "permission denied")
+	case path == "auth/token/lookup-self":
+		f.lookupSelf(w, r.Header.Get("X-Vault-Token"))
+	case path == "sys/capabilities-self" && isWrite(r):
+		// Every token may read the secrets which exist
+		capabilities := []string{"deny"}
+		if r.Header.Get("X-Vault-Token") == f.rootToken {
+			capabilities = []string{"root"}
+		} else if p := strings.Trim(str("path"), "/"); f.secrets[p] != nil || f.hasKVv2(p) || f.dynamic[p].data != nil {
+			capabilities = []string{"read"}
+		}
+
+		respond(w, map[string]interface{}{
+			"data": map[string]interface{}{"capabilities": capabilities, str("path"): capabilities},
+		})
+	case path == "auth/token/renew-self" && isWrite(r):
+		f.renewSelf(w, r.Header.Get("X-Vault-Token"), body["increment"])
+	case path == "auth/token/revoke-self" && isWrite(r):
+		delete(f.tokens, r.Header.Get("X-Vault-Token"))
+		w.WriteHeader(http.StatusNoContent)
+	case path == "sys/leases/renew" || path == "sys/leases/lookup":
+		lease, ok := f.leases[str("lease_id")]
+		if !ok {
+			respondError(w, http.StatusBadRequest, "invalid lease")
+			return
+		}
+
+		ttl := int(lease.ttl.Seconds())
+		if path == "sys/leases/lookup" {
+			respond(w, map[string]interface{}{
+				"data": map[string]interface{}{"id": str("lease_id"), "ttl": ttl, "renewable": true},
+			})
+
+			return
+		}
+
+		respond(w, map[string]interface{}{"lease_id": str("lease_id"), "lease_duration": ttl, "renewable": true})
+	case strings.HasPrefix(path, "sys/internal/ui/mounts/") && r.Method == http.MethodGet:
+		f.handleMounts(w, path)
+	case f.handleKVv2(w, r, path):
+	case r.Method == http.MethodGet && f.dynamic[path].data != nil:
+		secret := f.dynamic[path]
+
+		f.issued++
+
+		leaseID := fmt.Sprintf("%s/fake-lease-%d", path, f.issued)
+		f.leases[leaseID] = secret
+
+		respond(w, map[string]interface{}{
+			"lease_id":       leaseID,
+			"lease_duration": int(secret.ttl.Seconds()),
+			"renewable":      true,
+			"data":           secret.data,
+		})
+	case r.Method == http.MethodGet:
+		secret, ok := f.secrets[path]
+		if !ok {
+			respondError(w, http.StatusNotFound)
+			return
+		}
+
+		respond(w, secret)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+// loginBehavior applies the next response configured for the role with
+// WithLoginBehavior. It reports whether the login should be processed as
+// usual. f.mu must be held; it is released while waiting.
+func (f *FakeVault) loginBehavior(w http.ResponseWriter, r *http.Request, role string) bool {
+	responses := f.behaviors[role]
+	if len(responses) == 0 {
+		return true
+	}
+
+	i := f.attempts[role]
+	if i >= len(responses) {
+		i = len(responses) - 1
+	}
+
+	f.attempts[role]++
+
+	resp := responses[i]
+
+	if resp.Delay > 0 {
+		f.mu.Unlock()
+
+		timer := time.NewTimer(resp.Delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+		}
+
+		f.mu.Lock()
+	}
+
+	if resp.Status == 0 {
+		return true
+	}
+
+	respondError(w, resp.Status, resp.Errors...)
+
+	return false
+}
+
+func (f *FakeVault) login(w http.ResponseWriter, r *http.Request) {
+	token := f.issueToken()
+
+	resp := map[string]interface{}{"auth": f.auth(token)}
+
+	wrapTTL, err := time.ParseDuration(r.Header.Get("X-Vault-Wrap-TTL"))
+	if err != nil {
+		respond(w, resp)
+		return
+	}
+
+	wrappingToken := f.wrap(resp)
+
+	respond(w, map[string]interface{}{
+		"wrap_info": map[string]interface{}{
+			"token":         wrappingToken,
+			"accessor":      "accessor-" + wrappingToken,
+			"ttl":           int(wrapTTL.Seconds()),
+			"creation_time": time.Now().UTC().Format(time.RFC3339Nano),
+			"creation_path": r.URL.Path,
+		},
+	})
+}
+
+// wrap stores resp to be unwrapped once with the wrapping token returned.
+func (f *FakeVault) wrap(resp map[string]interface{}) string {
+	f.issued++
+
+	wrappingToken := fmt.Sprintf("hvs.fake-wrapping-token-%d", f.issued)
+	f.wrapped[wrappingToken] = resp
+
+	return wrappingToken
+}
+
+func (f *FakeVault) auth(token string) map[string]interface{} {
+	return map[string]interface{}{
+		"client_token":   token,
+		"accessor":       "accessor-" + token,
+		"policies":       f.policies(token),
+		"lease_duration": f.ttl(token),
+		"renewable":      token != f.rootToken,
+	}
+}
+
+func (f *FakeVault) policies(token string) []string {
+	if token == f.rootToken {
+		return []string{"root"}
+	}
+
+	return []string{"default"}
+}
+
+type dynamicSecret struct {
+	data map[string]interface{}
+	ttl  time.Duration
+}
+
+func kvv1(data map[string]interface{}) interface{} {
+	return map[string]interface{}{"data": data}
+}
+
+func kvv2(data map[string]interface{}) interface{} {
+	return map[string]interface{}{
+		"data": map[string]interface{}{
+			"data": data,
+			"metadata": map[string]interface{}{
+				"created_time": time.Now().UTC().Format(time.RFC3339Nano),
+				"version":      1,
+			},
+		},
+	}
+}
+
+func isWrite(r *http.Request) bool {
+	return r.Method == http.MethodPost || r.Method == http.MethodPut
+}
+
+func respond(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body) // nolint: errcheck
+}
+
+func respondError(w http.ResponseWriter, status int, errs ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if errs == nil {
+		errs = []string{}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs}) // nolint: errcheck
+}
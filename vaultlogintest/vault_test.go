@@ -0,0 +1,1099 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vaultlogintest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+
+	"github.com/morningconsult/docker-credential-vault-login/clock"
+	"github.com/morningconsult/docker-credential-vault-login/vault"
+)
+
+func TestFakeVault(t *testing.T) {
+	creds := map[string]interface{}{
+		"username": "test@user.com",
+		"password": "correct horse battery staple",
+	}
+
+	fake := NewFakeVault(t,
+		WithKVv1("secret/docker/creds", creds),
+		WithKVv2("kv/data/docker/creds", creds),
+		WithAppRole("role-id", "secret-id"),
+		WithUserpass("jdoe", "hunter2"),
+		WithDynamicSecret("registry/creds/ci", creds, time.Hour),
+		WithTokenTTL(time.Minute),
+	)
+	client := fake.Client()
+
+	t.Run("rejects-requests-without-token", func(t *testing.T) {
+		if _, err := vault.GetCredentials("secret/docker/creds", client); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+
+	t.Run("approle-login", func(t *testing.T) {
+		secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   "role-id",
+			"secret_id": "secret-id",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret.Auth.LeaseDuration != 60 {
+			t.Fatalf("Expected a lease duration of 60s, got %ds", secret.Auth.LeaseDuration)
+		}
+
+		if _, err = client.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   "role-id",
+			"secret_id": "wrong",
+		}); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+
+	t.Run("userpass-login", func(t *testing.T) {
+		if _, err := client.Logical().Write("auth/userpass/login/jdoe", map[string]interface{}{
+			"password": "hunter2",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("wrapped-login", func(t *testing.T) {
+		wrapClient := fake.Client()
+		wrapClient.SetWrappingLookupFunc(func(string, string) string { return "5m" })
+
+		secret, err := wrapClient.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   "role-id",
+			"secret_id": "secret-id",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret.WrapInfo == nil || secret.WrapInfo.TTL != 300 {
+			t.Fatalf("Expected the response to be wrapped for 300s, got %+v", secret.WrapInfo)
+		}
+
+		unwrapped, err := fake.Client().Logical().Unwrap(secret.WrapInfo.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unwrapped.Auth == nil || unwrapped.Auth.ClientToken == "" {
+			t.Fatalf("Expected the unwrapped response to contain a token, got %+v", unwrapped)
+		}
+
+		if _, err = fake.Client().Logical().Unwrap(secret.WrapInfo.Token); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+
+	t.Run("reads-secrets", func(t *testing.T) {
+		client.SetToken(fake.RootToken())
+		defer client.ClearToken()
+
+		requests := fake.Requests("secret/docker/creds")
+
+		for _, path := range []string{"secret/docker/creds", "kv/data/docker/creds"} {
+			got, err := vault.GetCredentials(path, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(creds, got.Fields) {
+				t.Fatalf("Secrets differ:\n%v", cmp.Diff(creds, got.Fields))
+			}
+		}
+
+		if _, err := vault.GetCredentials("secret/nonexistent", client); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		if n := fake.Requests("secret/docker/creds") - requests; n != 1 {
+			t.Fatalf("Expected 1 request, got %d", n)
+		}
+	})
+
+	t.Run("updates-secrets", func(t *testing.T) {
+		client.SetToken(fake.RootToken())
+		defer client.ClearToken()
+
+		fake.SetKVv1("secret/docker/creds", map[string]interface{}{
+			"username": "test@user.com",
+			"password": "rotated",
+		})
+		got, err := vault.GetCredentials("secret/docker/creds", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Password != "rotated" {
+			t.Fatalf("Expected password %q, got %q", "rotated", got.Password)
+		}
+
+		fake.DeleteSecret("secret/docker/creds")
+		if _, err = vault.GetCredentials("secret/docker/creds", client); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+
+	t.Run("token-lifecycle", func(t *testing.T) {
+		secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   "role-id",
+			"secret_id": "secret-id",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := secret.Auth.ClientToken
+
+		if _, err = client.Auth().Token().RenewTokenAsSelf(token, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		fake.RevokeToken(token)
+		if _, err = client.Auth().Token().RenewTokenAsSelf(token, 0); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+
+	t.Run("revoke-self", func(t *testing.T) {
+		secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   "role-id",
+			"secret_id": "secret-id",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client.SetToken(secret.Auth.ClientToken)
+		defer client.ClearToken()
+
+		if err = client.Auth().Token().RevokeSelf(""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = client.Auth().Token().LookupSelf(); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+
+	t.Run("health-and-capabilities", func(t *testing.T) {
+		health, err := client.Sys().Health()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if health.Sealed || health.Version != fakeVersion {
+			t.Fatalf("Expected an unsealed Vault %s, got %+v", fakeVersion, health)
+		}
+
+		secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   "role-id",
+			"secret_id": "secret-id",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client.SetToken(secret.Auth.ClientToken)
+		defer client.ClearToken()
+
+		for path, expected := range map[string][]string{
+			"kv/data/docker/creds": {"read"},
+			"registry/creds/ci":    {"read"},
+			"secret/nonexistent":   {"deny"},
+		} {
+			capabilities, err := client.Sys().CapabilitiesSelf(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(expected, capabilities) {
+				t.Errorf("Capabilities of %s differ:\n%v", path, cmp.Diff(expected, capabilities))
+			}
+		}
+	})
+
+	t.Run("leases", func(t *testing.T) {
+		client.SetToken(fake.RootToken())
+		defer client.ClearToken()
+
+		got, err := vault.GetCredentials("registry/creds/ci", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.LeaseID == "" || got.LeaseDuration != time.Hour || !got.Renewable {
+			t.Fatalf("Expected a renewable lease of 1h, got %q (%s, renewable: %t)",
+				got.LeaseID, got.LeaseDuration, got.Renewable)
+		}
+
+		again, err := vault.GetCredentials("registry/creds/ci", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.LeaseID == got.LeaseID {
+			t.Fatal("expected every read to create a new lease")
+		}
+
+		if _, err = client.Sys().Renew(got.LeaseID, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = client.Sys().Lookup(got.LeaseID); err != nil {
+			t.Fatal(err)
+		}
+
+		fake.RevokeLease(got.LeaseID)
+		if _, err = client.Sys().Renew(got.LeaseID, 0); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+}
+
+func TestFakeVault_KVv2(t *testing.T) {
+	fake := NewFakeVault(t,
+		WithKVv1("kv1/docker/creds", map[string]interface{}{"username": "v1", "password": "v1"}),
+		WithKVv2("secret/data/docker/creds", map[string]interface{}{"user": "jdoe", "secret": "first"}),
+		WithKVv2("secret/data/docker/team/ci", map[string]interface{}{"user": "ci", "secret": "ci"}),
+		WithCustomMetadata("secret/data/docker/creds", map[string]interface{}{
+			vault.MetadataUsernameKey: "user",
+			vault.MetadataPasswordKey: "secret",
+		}),
+	)
+	fake.SetKVv2("secret/data/docker/creds", map[string]interface{}{"user": "jdoe", "secret": "second"})
+
+	client := fake.Client()
+	client.SetToken(fake.RootToken())
+
+	t.Run("reads-versions", func(t *testing.T) {
+		cases := []struct {
+			version string
+			want    string
+		}{
+			{"", "second"},
+			{"0", "second"},
+			{"1", "first"},
+			{"2", "second"},
+		}
+
+		for _, tc := range cases {
+			secret, err := client.Logical().ReadWithData("secret/data/docker/creds", map[string][]string{
+				"version": {tc.version},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := secret.Data["data"].(map[string]interface{})
+			if got := data["secret"]; got != tc.want {
+				t.Errorf("version %q: expected %q, got %v", tc.version, tc.want, got)
+			}
+		}
+
+		secret, err := client.Logical().ReadWithData("secret/data/docker/creds", map[string][]string{
+			"version": {"3"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != nil {
+			t.Fatalf("Expected no secret, got %+v", secret)
+		}
+	})
+
+	t.Run("returns-custom-metadata", func(t *testing.T) {
+		got, err := vault.GetCredentials("secret/data/docker/creds", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]interface{}{"user": "jdoe", "secret": "second"}
+		if !cmp.Equal(want, got.Fields) {
+			t.Fatalf("Secrets differ:\n%v", cmp.Diff(want, got.Fields))
+		}
+		if got.Username != "jdoe" || got.Password != "second" {
+			t.Fatalf("Expected the credentials named by the custom_metadata, got %q and %q", got.Username, got.Password)
+		}
+	})
+
+	t.Run("reads-metadata", func(t *testing.T) {
+		secret, err := client.Logical().Read("secret/metadata/docker/creds")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v := secret.Data["current_version"]; fmt.Sprint(v) != "2" {
+			t.Fatalf("Expected current_version 2, got %v", v)
+		}
+		if versions, _ := secret.Data["versions"].(map[string]interface{}); len(versions) != 2 {
+			t.Fatalf("Expected 2 versions, got %v", secret.Data["versions"])
+		}
+
+		if secret, err = client.Logical().Read("secret/metadata/docker/nonexistent"); err != nil || secret != nil {
+			t.Fatalf("Expected no secret and no error, got %+v and %v", secret, err)
+		}
+	})
+
+	t.Run("lists-secrets", func(t *testing.T) {
+		cases := []struct {
+			path string
+			want []interface{}
+		}{
+			{"secret/metadata", []interface{}{"docker/"}},
+			{"secret/metadata/docker", []interface{}{"creds", "team/"}},
+			{"secret/metadata/docker/team/", []interface{}{"ci"}},
+		}
+
+		for _, tc := range cases {
+			secret, err := client.Logical().List(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret == nil {
+				t.Fatalf("%s: expected keys but received none", tc.path)
+			}
+
+			if !cmp.Equal(tc.want, secret.Data["keys"]) {
+				t.Errorf("%s: keys differ:\n%v", tc.path, cmp.Diff(tc.want, secret.Data["keys"]))
+			}
+		}
+	})
+
+	t.Run("deletes-versions", func(t *testing.T) {
+		fake.SetKVv2("secret/data/docker/team/ci", map[string]interface{}{"user": "ci", "secret": "rotated"})
+		fake.DeleteVersion("secret/data/docker/team/ci", 2)
+
+		if _, err := vault.GetCredentials("secret/data/docker/team/ci", client); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		secret, err := client.Logical().ReadWithData("secret/data/docker/team/ci", map[string][]string{
+			"version": {"1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := secret.Data["data"].(map[string]interface{}); data["secret"] != "ci" {
+			t.Fatalf("Expected the first version to remain readable, got %v", secret.Data)
+		}
+
+		fake.DeleteSecret("secret/data/docker/team/ci")
+
+		if secret, err = client.Logical().Read("secret/metadata/docker/team/ci"); err != nil || secret != nil {
+			t.Fatalf("Expected no secret and no error, got %+v and %v", secret, err)
+		}
+	})
+
+	t.Run("reports-mounts", func(t *testing.T) {
+		cases := []struct {
+			path    string
+			mount   string
+			version string
+		}{
+			{"secret/docker/creds", "secret/", "2"},
+			{"secret/data/docker/creds", "secret/", "2"},
+			{"kv1/docker/creds", "kv1/", "1"},
+		}
+
+		for _, tc := range cases {
+			secret, err := client.Logical().Read("sys/internal/ui/mounts/" + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options, _ := secret.Data["options"].(map[string]interface{})
+			got := []interface{}{secret.Data["path"], secret.Data["type"], options["version"]}
+			want := []interface{}{tc.mount, "kv", tc.version}
+			if !cmp.Equal(want, got) {
+				t.Errorf("%s: mounts differ:\n%v", tc.path, cmp.Diff(want, got))
+			}
+		}
+
+		if _, err := client.Logical().Read("sys/internal/ui/mounts/nonexistent/path"); err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+	})
+}
+
+func TestFakeVault_WithLoginBehavior(t *testing.T) {
+	fake := NewFakeVault(t,
+		WithAppRole("forbidden", "secret-id"),
+		WithAppRole("slow", "secret-id"),
+		WithAppRole("flaky", "secret-id"),
+		WithUserpass("locked", "hunter2"),
+		WithLoginBehavior("forbidden", RespondError(http.StatusForbidden, "permission denied")),
+		WithLoginBehavior("slow", RespondSuccess().After(100*time.Millisecond)),
+		WithLoginBehavior("flaky", RespondError(http.StatusInternalServerError), RespondSuccess()),
+		WithLoginBehavior("locked", RespondError(http.StatusTooManyRequests, "too many attempts")),
+	)
+
+	// Do not let the client retry the 5xx and 429 responses
+	client := func() *api.Client {
+		c := fake.Client()
+		c.SetMaxRetries(0)
+
+		return c
+	}
+
+	approle := func(roleID string) func() error {
+		return func() error {
+			_, err := client().Logical().Write("auth/approle/login", map[string]interface{}{
+				"role_id":   roleID,
+				"secret_id": "secret-id",
+			})
+			return err
+		}
+	}
+
+	cases := []struct {
+		name     string
+		login    func() error
+		errs     []bool
+		minDelay time.Duration
+	}{
+		{
+			name:  "forbidden",
+			login: approle("forbidden"),
+			errs:  []bool{true, true},
+		},
+		{
+			name:     "delayed-success",
+			login:    approle("slow"),
+			errs:     []bool{false},
+			minDelay: 100 * time.Millisecond,
+		},
+		{
+			name:  "fails-then-succeeds",
+			login: approle("flaky"),
+			errs:  []bool{true, false, false},
+		},
+		{
+			name: "userpass",
+			login: func() error {
+				_, err := client().Logical().Write("auth/userpass/login/locked", map[string]interface{}{
+					"password": "hunter2",
+				})
+				return err
+			},
+			errs: []bool{true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs []bool
+
+			start := time.Now()
+
+			for range tc.errs {
+				errs = append(errs, tc.login() != nil)
+			}
+
+			if !cmp.Equal(tc.errs, errs) {
+				t.Fatalf("Login failures differ:\n%v", cmp.Diff(tc.errs, errs))
+			}
+			if elapsed := time.Since(start); elapsed < tc.minDelay {
+				t.Fatalf("Expected the login to take at least %s, took %s", tc.minDelay, elapsed)
+			}
+		})
+	}
+
+	t.Run("error-response", func(t *testing.T) {
+		err := approle("forbidden")()
+		if err == nil {
+			t.Fatal("expected an error but didn't receive one")
+		}
+
+		respErr, ok := err.(*api.ResponseError)
+		if !ok || respErr.StatusCode != http.StatusForbidden {
+			t.Fatalf("Expected a %d response, got %s", http.StatusForbidden, fmt.Sprint(err))
+		}
+	})
+}
+
+func TestFakeVault_Shutdown(t *testing.T) {
+	fake := NewFakeVault(t)
+
+	if !strings.HasSuffix(fake.Address(), ":"+strconv.Itoa(fake.Port())) {
+		t.Fatalf("Expected the address %s to end with the port %d", fake.Address(), fake.Port())
+	}
+
+	client := fake.Client()
+	client.SetMaxRetries(0)
+
+	// The fake listens as soon as it is returned
+	if _, err := client.Sys().Health(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := fake.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Sys().Health(); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+}
+
+func TestFakeVault_TLS(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  Option
+		err  string
+	}{
+		{
+			name: "valid",
+			opt:  WithTLS(),
+		},
+		{
+			name: "expired",
+			opt:  WithBadCertificate(CertificateExpired),
+			err:  "certificate has expired",
+		},
+		{
+			name: "untrusted",
+			opt:  WithBadCertificate(CertificateUntrusted),
+			err:  "certificate signed by unknown authority",
+		},
+		{
+			name: "wrong-host",
+			opt:  WithBadCertificate(CertificateWrongHost),
+			err:  "doesn't contain any IP SANs",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fake := NewFakeVault(t, tc.opt)
+
+			if !strings.HasPrefix(fake.Address(), "https://") {
+				t.Fatalf("Expected an HTTPS address, got %s", fake.Address())
+			}
+
+			config := api.DefaultConfig()
+			config.Address = fake.Address()
+			config.MaxRetries = 0
+			if err := config.ConfigureTLS(&api.TLSConfig{CACert: fake.CACertFile()}); err != nil {
+				t.Fatal(err)
+			}
+
+			fileClient, err := api.NewClient(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := fake.Client()
+			client.SetMaxRetries(0)
+
+			for _, c := range []*api.Client{client, fileClient} {
+				_, err := c.Sys().Health()
+				if tc.err == "" {
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					continue
+				}
+
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Expected an error containing %q, got %v", tc.err, err)
+				}
+			}
+		})
+	}
+
+	if fake := NewFakeVault(t); fake.CACert() != nil || fake.CACertFile() != "" {
+		t.Fatal("Expected no CA for a fake which does not serve over TLS")
+	}
+}
+
+func TestFakeVault_WithFaults(t *testing.T) {
+	creds := map[string]interface{}{"username": "test@user.com", "password": "hunter2"}
+
+	cases := []struct {
+		name   string
+		path   string
+		faults []Fault
+		// errs are the expected errors of three consecutive reads, or ""
+		// if the read succeeds
+		errs []string
+	}{
+		{
+			name:   "rate-limited-nth-request",
+			path:   "secret/docker",
+			faults: []Fault{FailWith(http.StatusTooManyRequests, "rate limited").OnRequest(2)},
+			errs:   []string{"", "Code: 429", ""},
+		},
+		{
+			name:   "every-request-of-any-path",
+			faults: []Fault{FailWith(http.StatusInternalServerError)},
+			errs:   []string{"Code: 500", "Code: 500", "Code: 500"},
+		},
+		{
+			name:   "sealed",
+			path:   "secret/docker",
+			faults: []Fault{Sealed().OnRequest(1)},
+			errs:   []string{"Vault is sealed", "", ""},
+		},
+		{
+			name:   "first-fault-wins",
+			path:   "secret/docker",
+			faults: []Fault{ResetConnection().OnRequest(3), FailWith(http.StatusServiceUnavailable)},
+			errs:   []string{"Code: 503", "Code: 503", "connection reset"},
+		},
+		{
+			name:   "other-path",
+			path:   "secret/other",
+			faults: []Fault{FailWith(http.StatusInternalServerError)},
+			errs:   []string{"", "", ""},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fake := NewFakeVault(t, WithKVv1("secret/docker", creds), WithFaults(tc.path, tc.faults...))
+
+			client := fake.Client()
+			client.SetMaxRetries(0)
+			client.SetToken(fake.RootToken())
+
+			for i, want := range tc.errs {
+				_, err := client.Logical().Read("secret/docker")
+
+				switch {
+				case want == "" && err != nil:
+					t.Fatalf("read %d: %v", i+1, err)
+				case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+					t.Fatalf("read %d: expected an error containing %q, got %v", i+1, want, err)
+				}
+			}
+		})
+	}
+
+	t.Run("latency", func(t *testing.T) {
+		fake := NewFakeVault(t, WithFaults("sys/health", Latency(100*time.Millisecond)))
+
+		start := time.Now()
+		if _, err := fake.Client().Sys().Health(); err != nil {
+			t.Fatal(err)
+		}
+
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Fatalf("Expected the response to take at least 100ms, took %v", elapsed)
+		}
+	})
+
+	t.Run("inject-and-clear", func(t *testing.T) {
+		fake := NewFakeVault(t, WithKVv1("secret/docker", creds))
+
+		client := fake.Client()
+		client.SetMaxRetries(0)
+		client.SetToken(fake.RootToken())
+
+		for i := 0; i < 2; i++ {
+			if _, err := client.Logical().Read("secret/docker"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Request numbers count from the injection
+		fake.InjectFaults("secret/docker", FailWith(http.StatusBadGateway).OnRequest(1))
+
+		if _, err := client.Logical().Read("secret/docker"); err == nil || !strings.Contains(err.Error(), "Code: 502") {
+			t.Fatalf("Expected a 502 error, got %v", err)
+		}
+
+		fake.InjectFaults("secret/docker", FailWith(http.StatusBadGateway))
+		fake.ClearFaults("secret/docker")
+
+		if _, err := client.Logical().Read("secret/docker"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("seal-and-failover", func(t *testing.T) {
+		sealed := NewFakeVault(t, WithKVv1("secret/docker", creds))
+		healthy := NewFakeVault(t)
+		sealed.Seal()
+
+		client := sealed.Client()
+		client.SetMaxRetries(0)
+		client.SetToken(sealed.RootToken())
+
+		health, err := client.Sys().Health()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !health.Sealed {
+			t.Fatal("Expected the fake to report that it is sealed")
+		}
+
+		if _, err = client.Logical().Read("secret/docker"); err == nil || !strings.Contains(err.Error(), "Vault is sealed") {
+			t.Fatalf("Expected an error containing %q, got %v", "Vault is sealed", err)
+		}
+
+		nodes := []vault.Node{{Address: sealed.Address()}, {Address: healthy.Address()}}
+		if err = vault.SelectAddress(context.Background(), client, nodes, "", hclog.NewNullLogger()); err != nil {
+			t.Fatal(err)
+		}
+		if client.Address() != healthy.Address() {
+			t.Fatalf("Expected the address %s, got %s", healthy.Address(), client.Address())
+		}
+
+		sealed.Unseal()
+
+		if err = client.SetAddress(sealed.Address()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = client.Logical().Read("secret/docker"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestFakeVault_TokenTTL(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+
+	fake := NewFakeVault(t,
+		WithKVv1("secret/docker", map[string]interface{}{"username": "test@user.com", "password": "hunter2"}),
+		WithAppRole("role-id", "secret-id"),
+		WithTokenTTL(time.Hour),
+		WithTokenMaxTTL(3*time.Hour),
+		WithClock(clk),
+	)
+
+	client := fake.Client()
+	client.SetMaxRetries(0)
+
+	secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
+		"role_id":   "role-id",
+		"secret_id": "secret-id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := secret.Auth.ClientToken
+	client.SetToken(token)
+
+	lookupTTL := func() int {
+		t.Helper()
+
+		secret, err := client.Auth().Token().LookupSelf()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ttl, err := secret.TokenTTL()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return int(ttl.Seconds())
+	}
+
+	clk.Advance(30 * time.Minute)
+
+	if ttl := lookupTTL(); ttl != 1800 {
+		t.Fatalf("Expected a TTL of 1800s, got %ds", ttl)
+	}
+
+	cases := []struct {
+		name      string
+		advance   time.Duration
+		increment int
+		want      int
+	}{
+		{"default-increment", 0, 0, 3600},
+		{"increment", 0, 7200, 7200},
+		// The token was issued 2h20m ago, so it may live for another 40m
+		{"capped-by-max-ttl", 110 * time.Minute, 3600, 2400},
+	}
+
+	for _, tc := range cases {
+		clk.Advance(tc.advance)
+
+		secret, err := client.Auth().Token().RenewSelf(tc.increment)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if secret.Auth.LeaseDuration != tc.want {
+			t.Errorf("%s: expected a lease duration of %ds, got %ds", tc.name, tc.want, secret.Auth.LeaseDuration)
+		}
+		if ttl := fake.TokenTTL(token); ttl != time.Duration(tc.want)*time.Second {
+			t.Errorf("%s: expected a TTL of %ds, got %v", tc.name, tc.want, ttl)
+		}
+	}
+
+	if _, err = client.Logical().Read("secret/docker"); err != nil {
+		t.Fatal(err)
+	}
+
+	clk.Advance(40 * time.Minute)
+
+	if _, err = client.Logical().Read("secret/docker"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("Expected an error containing %q, got %v", "permission denied", err)
+	}
+	if _, err = client.Auth().Token().RenewSelf(0); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+	if ttl := fake.TokenTTL(token); ttl != 0 {
+		t.Fatalf("Expected no TTL for an expired token, got %v", ttl)
+	}
+
+	// The root token never expires
+	client.SetToken(fake.RootToken())
+
+	if ttl := lookupTTL(); ttl != 0 {
+		t.Fatalf("Expected no TTL for the root token, got %ds", ttl)
+	}
+	if _, err = client.Auth().Token().RenewSelf(0); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+}
+
+func TestFakeVault_Recorded(t *testing.T) {
+	fake := NewFakeVault(t,
+		WithKVv1("secret/docker", map[string]interface{}{"username": "test@user.com", "password": "hunter2"}),
+		WithAppRole("role-id", "secret-id"),
+		WithFaults("secret/docker", FailWith(http.StatusInternalServerError).OnRequest(1)),
+	)
+
+	client := fake.Client()
+	client.SetMaxRetries(0)
+
+	secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
+		"role_id":   "role-id",
+		"secret_id": "secret-id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetToken(secret.Auth.ClientToken)
+
+	// Requests which fail are recorded too
+	if _, err = client.Logical().Read("secret/docker"); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+	if _, err = client.Logical().ReadWithData("secret/docker", map[string][]string{"version": {"1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.AssertRequests(t, "", 3)
+	fake.AssertRequests(t, "secret/docker", 2)
+	fake.AssertRequests(t, "secret/other", 0)
+	fake.AssertLastRequest(t, "auth/approle/login", http.MethodPut, map[string]interface{}{"role_id": "role-id"})
+
+	recorded := fake.Recorded("/secret/docker/")
+
+	got := []string{recorded[0].Method, recorded[0].Token, recorded[1].Query.Get("version")}
+	want := []string{http.MethodGet, secret.Auth.ClientToken, "1"}
+	if !cmp.Equal(want, got) {
+		t.Fatalf("Requests differ:\n%v", cmp.Diff(want, got))
+	}
+
+	failing := &recordingTB{TB: t}
+	fake.AssertRequests(failing, "secret/docker", 1)
+	fake.AssertLastRequest(failing, "secret/docker", http.MethodPut, nil)
+	fake.AssertLastRequest(failing, "auth/approle/login", http.MethodPut, map[string]interface{}{"role_id": "other"})
+
+	if failing.errors != 3 {
+		t.Fatalf("Expected 3 failed assertions, got %d", failing.errors)
+	}
+}
+
+// recordingTB counts the errors reported to it instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errors int
+}
+
+func (r *recordingTB) Errorf(string, ...interface{}) {
+	r.errors++
+}
+
+func TestNew(t *testing.T) {
+	fake, err := New(WithTLS(), WithKVv1("secret/docker", map[string]interface{}{"username": "test@user.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := fake.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetMaxRetries(0)
+	client.SetToken(fake.RootToken())
+
+	if _, err = client.Logical().Read("secret/docker"); err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := fake.CACertFile()
+	if _, err = os.Stat(caFile); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Close()
+
+	if _, err = client.Logical().Read("secret/docker"); err == nil {
+		t.Fatal("expected an error but didn't receive one")
+	}
+	if _, err = os.Stat(caFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected the CA file to be removed, got %v", err)
+	}
+}
+
+func TestFakeVault_JWTLogins(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+
+	fake := NewFakeVault(t,
+		WithKubernetesRole("builder", map[string]string{"sub": "system:serviceaccount:ci:builder"}),
+		WithJWTRole("ci", map[string]string{"iss": "https://ci.example.com", "repository": "acme/app"}),
+		WithClock(clk),
+	)
+
+	validJWT := NewJWT(map[string]interface{}{
+		"iss":        "https://ci.example.com",
+		"sub":        "system:serviceaccount:ci:builder",
+		"repository": "acme/app",
+		"exp":        clk.Now().Add(time.Hour).Unix(),
+	})
+
+	cases := []struct {
+		name string
+		path string
+		data map[string]interface{}
+		err  string
+	}{
+		{
+			name: "kubernetes",
+			path: "auth/kubernetes/login",
+			data: map[string]interface{}{"role": "builder", "jwt": validJWT},
+		},
+		{
+			name: "jwt",
+			path: "auth/jwt/login",
+			data: map[string]interface{}{"role": "ci", "jwt": validJWT},
+		},
+		{
+			name: "missing-role",
+			path: "auth/jwt/login",
+			data: map[string]interface{}{"jwt": validJWT},
+			err:  "missing role",
+		},
+		{
+			name: "missing-jwt",
+			path: "auth/kubernetes/login",
+			data: map[string]interface{}{"role": "builder"},
+			err:  "missing jwt",
+		},
+		{
+			name: "role-of-other-method",
+			path: "auth/kubernetes/login",
+			data: map[string]interface{}{"role": "ci", "jwt": validJWT},
+			err:  `role "ci" could not be found`,
+		},
+		{
+			name: "malformed-jwt",
+			path: "auth/jwt/login",
+			data: map[string]interface{}{"role": "ci", "jwt": "not-a-jwt"},
+			err:  "token is malformed",
+		},
+		{
+			name: "expired-jwt",
+			path: "auth/jwt/login",
+			data: map[string]interface{}{"role": "ci", "jwt": NewJWT(map[string]interface{}{
+				"iss":        "https://ci.example.com",
+				"repository": "acme/app",
+				"exp":        clk.Now().Add(-time.Minute).Unix(),
+			})},
+			err: "token is expired",
+		},
+		{
+			name: "unbound-claim",
+			path: "auth/jwt/login",
+			data: map[string]interface{}{"role": "ci", "jwt": NewJWT(map[string]interface{}{
+				"iss":        "https://ci.example.com",
+				"repository": "acme/other",
+			})},
+			err: `claim "repository" does not match`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.Client()
+			client.SetMaxRetries(0)
+
+			secret, err := client.Logical().Write(tc.path, tc.data)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Expected an error containing %q, got %v", tc.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret.Auth == nil || secret.Auth.ClientToken == "" {
+				t.Fatalf("Expected the response to contain a token, got %+v", secret)
+			}
+		})
+	}
+
+	t.Run("kubernetes-auth-method", func(t *testing.T) {
+		tokenPath := filepath.Join(t.TempDir(), "token")
+		if err := os.WriteFile(tokenPath, []byte(validJWT), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		method, err := vault.BuildAuthMethod(&config.Method{
+			Type:      "kubernetes",
+			MountPath: "auth/kubernetes",
+			Config:    map[string]interface{}{"role": "builder", "token_path": tokenPath},
+		}, hclog.NewNullLogger(), vault.MethodOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := fake.Client()
+
+		path, _, data, err := method.Authenticate(context.Background(), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = client.Logical().Write(path, data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
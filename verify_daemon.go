@@ -0,0 +1,161 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/config"
+	"github.com/morningconsult/docker-credential-vault-login/discovery"
+	"github.com/morningconsult/docker-credential-vault-login/helper"
+)
+
+const (
+	verifyDaemonTimeout = 2 * time.Minute
+
+	// helperPrefix is the prefix of the names of the credential helper
+	// binaries run by the Docker CLI.
+	helperPrefix = "docker-credential-"
+)
+
+// credentialGetter returns the credentials of a registry.
+type credentialGetter interface {
+	Get(serverURL string) (string, string, error)
+}
+
+// credentialHelperName returns the name under which the Docker CLI runs
+// this binary, e.g. "vault-login" for docker-credential-vault-login.
+func credentialHelperName() string {
+	name := filepath.Base(os.Args[0])
+	if !strings.HasPrefix(name, helperPrefix) {
+		return "vault-login"
+	}
+
+	return strings.TrimPrefix(name, helperPrefix)
+}
+
+// runVerifyDaemon checks that the Docker CLI uses the credential helper
+// named helperName for the registry of an image, that the helper returns
+// its credentials, and that the Docker daemon can fetch the manifest of
+// the image with them. The image is not pulled.
+func runVerifyDaemon(h credentialGetter, helperName string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("verify-daemon", flag.ContinueOnError)
+	dockerHost := flags.String("docker-host", "", "address of the Docker daemon (default: $DOCKER_HOST "+
+		"or unix:///var/run/docker.sock)")
+	jsonFormat := flags.Bool("json", false, "print the report as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return xerrors.New("expected exactly one image, e.g. registry.example.com/app:latest")
+	}
+
+	image := flags.Arg(0)
+
+	registry := discovery.Registry(image)
+	if registry == "" {
+		return xerrors.Errorf("invalid image %q", image)
+	}
+
+	client, err := discovery.NewDockerClient(*dockerHost)
+	if err != nil {
+		return xerrors.Errorf("error creating Docker client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyDaemonTimeout)
+	defer cancel()
+
+	checks := []helper.Check{checkDockerConfig(registry, helperName)}
+
+	username, secret, err := h.Get(registry)
+	if err != nil {
+		checks = append(checks, helper.Check{
+			Name:   "credentials",
+			Detail: fmt.Sprintf("the helper returned no credentials for %s: %v", registry, err),
+		})
+	} else {
+		checks = append(checks,
+			helper.Check{
+				Name:   "credentials",
+				OK:     true,
+				Detail: fmt.Sprintf("the helper returned credentials for %s", registry),
+			},
+			checkDistribution(ctx, client, image, registry, username, secret),
+		)
+	}
+
+	return writeReport(checks, *jsonFormat, out)
+}
+
+// checkDockerConfig checks that the configuration file of the Docker CLI
+// selects the credential helper for the registry.
+func checkDockerConfig(registry, helperName string) helper.Check {
+	check := helper.Check{Name: "docker config"}
+
+	name, path, err := config.DockerCredentialHelper(registry)
+
+	switch {
+	case err != nil:
+		check.Detail = err.Error()
+	case name == helperName:
+		check.OK = true
+		check.Detail = fmt.Sprintf("%s selects %s%s for %s", path, helperPrefix, name, registry)
+	case name == "":
+		check.Detail = fmt.Sprintf("%s selects no credential helper for %s; add %q: %q to 'credHelpers'",
+			path, registry, registry, helperName)
+	default:
+		check.Detail = fmt.Sprintf("%s selects %s%s instead of %s%s for %s; add %q: %q to 'credHelpers'",
+			path, helperPrefix, name, helperPrefix, helperName, registry, registry, helperName)
+	}
+
+	return check
+}
+
+// checkDistribution checks that the Docker daemon can fetch the manifest
+// of the image with the credentials.
+func checkDistribution(
+	ctx context.Context,
+	client *discovery.DockerClient,
+	image, registry, username, secret string,
+) helper.Check {
+	check := helper.Check{Name: "docker daemon"}
+
+	auth, err := discovery.EncodeRegistryAuth(registry, username, secret)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	digest, err := client.DistributionDigest(ctx, image, auth)
+	if err != nil {
+		check.Detail = fmt.Sprintf("the Docker daemon could not fetch the manifest of %s: %v", image, err)
+		return check
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("the Docker daemon fetched the manifest of %s (%s)", image, digest)
+
+	return check
+}
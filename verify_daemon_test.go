@@ -0,0 +1,147 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type stubGetter map[string][2]string
+
+func (s stubGetter) Get(serverURL string) (string, string, error) {
+	creds, ok := s[serverURL]
+	if !ok {
+		return "", "", errors.New("credentials not found in native keychain")
+	}
+
+	return creds[0], creds[1], nil
+}
+
+func TestRunVerifyDaemon(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+
+		var auth map[string]string
+		json.Unmarshal(data, &auth) // nolint: errcheck
+
+		if auth["password"] != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"unauthorized: authentication required"}`))
+
+			return
+		}
+
+		w.Write([]byte(`{"Descriptor":{"digest":"sha256:abcd"}}`))
+	}))
+	defer daemon.Close()
+
+	dockerConfig := t.TempDir()
+	configFile := filepath.Join(dockerConfig, "config.json")
+	if err := os.WriteFile(configFile, []byte(`{"credHelpers":{
+		"registry.example.com": "vault-login",
+		"other.example.com": "vault-login",
+		"quay.io": "desktop"
+	}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	getter := stubGetter{
+		"registry.example.com": {"jdoe", "hunter2"},
+		"other.example.com":    {"jdoe", "wrong"},
+		"quay.io":              {"jdoe", "hunter2"},
+	}
+
+	cases := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name: "success",
+			args: []string{"registry.example.com/app:1"},
+			expected: "ok    docker config: %s selects docker-credential-vault-login for registry.example.com\n" +
+				"ok    credentials: the helper returned credentials for registry.example.com\n" +
+				"ok    docker daemon: the Docker daemon fetched the manifest of registry.example.com/app:1 " +
+				"(sha256:abcd)\n",
+		},
+		{
+			name: "other-helper",
+			args: []string{"quay.io/org/app:1"},
+			expected: "FAIL  docker config: %s selects docker-credential-desktop instead of " +
+				"docker-credential-vault-login for quay.io; add \"quay.io\": \"vault-login\" to 'credHelpers'\n" +
+				"ok    credentials: the helper returned credentials for quay.io\n" +
+				"ok    docker daemon: the Docker daemon fetched the manifest of quay.io/org/app:1 (sha256:abcd)\n",
+			err: "1 of 3 check(s) failed",
+		},
+		{
+			name: "no-credentials",
+			args: []string{"unknown.example.com/app:1"},
+			expected: "FAIL  docker config: %s selects no credential helper for unknown.example.com; " +
+				"add \"unknown.example.com\": \"vault-login\" to 'credHelpers'\n" +
+				"FAIL  credentials: the helper returned no credentials for unknown.example.com: " +
+				"credentials not found in native keychain\n",
+			err: "2 of 2 check(s) failed",
+		},
+		{
+			name: "unauthorized",
+			args: []string{"other.example.com/app:1"},
+			expected: "ok    docker config: %s selects docker-credential-vault-login for other.example.com\n" +
+				"ok    credentials: the helper returned credentials for other.example.com\n" +
+				"FAIL  docker daemon: the Docker daemon could not fetch the manifest of other.example.com/app:1: " +
+				"error inspecting distribution: unauthorized: authentication required\n",
+			err: "1 of 3 check(s) failed",
+		},
+		{
+			name: "no-image",
+			err:  "expected exactly one image, e.g. registry.example.com/app:latest",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			args := append([]string{"-docker-host", daemon.URL}, tc.args...)
+
+			err := runVerifyDaemon(getter, "vault-login", args, &out)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Errors differ:\n%v", cmp.Diff(tc.err, fmt.Sprint(err)))
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := strings.ReplaceAll(tc.expected, "%s", configFile)
+			if diff := cmp.Diff(expected, out.String()); diff != "" {
+				t.Fatalf("Output differs:\n%s", diff)
+			}
+		})
+	}
+}
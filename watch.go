@@ -0,0 +1,197 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/docker-credential-vault-login/admin"
+	"github.com/morningconsult/docker-credential-vault-login/discovery"
+	"github.com/morningconsult/docker-credential-vault-login/probe"
+	"github.com/morningconsult/docker-credential-vault-login/proxy"
+)
+
+// runWatch runs the helper as a daemon which periodically prefetches the
+// credentials of every registry referenced by the images known to the
+// local Docker daemon or containerd, or by the pods of a Kubernetes cluster,
+// whose new pods are also watched. Unless disabled, the admin API is served on a unix
+// socket while the daemon runs, as is the proxy if any path may be read
+// through it.
+func runWatch(d *daemon, logger hclog.Logger, args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := flags.Duration("interval", time.Minute, "how often to list images and prefetch credentials")
+	source := flags.String("source", "docker", "where to list images: docker, containerd or kubernetes")
+	dockerHost := flags.String("docker-host", "", "address of the Docker daemon (default: $DOCKER_HOST "+
+		"or unix:///var/run/docker.sock)")
+	containerdAddress := flags.String("containerd-address", discovery.DefaultContainerdAddress,
+		"socket of the containerd API")
+	kubeHost := flags.String("kube-host", "", "URL of the Kubernetes API server (default: the API server "+
+		"of the cluster the helper runs in)")
+	kubeTokenFile := flags.String("kube-token-file", "", "file holding the Kubernetes bearer token "+
+		"(default: the token of the service account of the pod)")
+	kubeCAFile := flags.String("kube-ca-file", "", "file holding the CA certificates of the Kubernetes API server "+
+		"(default: the CA certificate of the service account of the pod)")
+	kubeNode := flags.String("kube-node", os.Getenv(discovery.EnvNodeName), "only watch the pods of this node "+
+		"(default: $"+discovery.EnvNodeName+")")
+	sockets := addSocketFlags(flags)
+
+	var namespaces repeatedFlag
+
+	flags.Var(&namespaces, "containerd-namespace", "containerd namespace to list the images of; may be "+
+		"repeated (default: every namespace)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		lister discovery.ImageLister
+		err    error
+	)
+
+	switch *source {
+	case "docker":
+		if lister, err = discovery.NewDockerClient(*dockerHost); err != nil {
+			return xerrors.Errorf("error creating Docker client: %w", err)
+		}
+	case "containerd":
+		lister = discovery.NewContainerdClient(*containerdAddress, namespaces)
+	case "kubernetes":
+		lister, err = discovery.NewKubernetesClient(discovery.KubernetesOptions{
+			Host:      *kubeHost,
+			TokenFile: *kubeTokenFile,
+			CAFile:    *kubeCAFile,
+			NodeName:  *kubeNode,
+		})
+		if err != nil {
+			return xerrors.Errorf("error creating Kubernetes client: %w", err)
+		}
+	default:
+		return xerrors.Errorf("unsupported image source %q", *source)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err = sockets.serve(ctx, d, logger); err != nil {
+		return err
+	}
+
+	go reloadOnHangup(ctx, d, logger)
+
+	watcher := discovery.NewWatcher(discovery.WatcherOptions{
+		Logger:   logger.Named("discovery"),
+		Lister:   lister,
+		Interval: *interval,
+		Prefetch: func(registry string) error {
+			_, _, err := d.Get(registry)
+			return err
+		},
+	})
+
+	return watcher.Run(ctx)
+}
+
+// socketFlags are the flags of the daemons which configure the admin API,
+// the proxy and the health probes.
+type socketFlags struct {
+	adminSocket  *string
+	disableAdmin *bool
+	proxySocket  *string
+	healthAddr   *string
+}
+
+func addSocketFlags(flags *flag.FlagSet) *socketFlags {
+	return &socketFlags{
+		adminSocket: flags.String("admin-socket", "", "path to the admin socket (default: admin.sock in the "+
+			"cache directory)"),
+		disableAdmin: flags.Bool("disable-admin", false, "do not serve the admin API"),
+		proxySocket: flags.String("proxy-socket", "", "path to the proxy socket (default: proxy.sock in the "+
+			"cache directory)"),
+		healthAddr: flags.String("health-addr", "", "loopback address on which /healthz and /readyz are "+
+			"served, e.g. 127.0.0.1:8089 (default: not served)"),
+	}
+}
+
+// serve serves the admin API, unless disabled, the proxy, if any path may
+// be read through it, and the health probes, if enabled, until the context
+// is canceled.
+func (f *socketFlags) serve(ctx context.Context, d *daemon, logger hclog.Logger) error {
+	if *f.healthAddr != "" {
+		if err := probe.CheckAddress(*f.healthAddr); err != nil {
+			return err
+		}
+
+		server := probe.NewServer(probe.ServerOptions{
+			Logger:  logger.Named("health"),
+			Checker: d,
+			Address: *f.healthAddr,
+		})
+
+		go func() {
+			if err := server.Serve(ctx); err != nil {
+				logger.Error("error serving health probes", "error", err)
+			}
+		}()
+	}
+
+	if !*f.disableAdmin {
+		socketPath := *f.adminSocket
+		if socketPath == "" {
+			socketPath = filepath.Join(d.cacheDir, adminSocketFile)
+		}
+
+		server := admin.NewServer(admin.ServerOptions{
+			Logger:     logger.Named("admin"),
+			Handler:    d,
+			SocketPath: socketPath,
+		})
+
+		go func() {
+			if err := server.Serve(ctx); err != nil {
+				logger.Error("error serving admin API", "error", err)
+			}
+		}()
+	}
+
+	if d.ProxyEnabled() {
+		socketPath := *f.proxySocket
+		if socketPath == "" {
+			socketPath = filepath.Join(d.cacheDir, proxySocketFile)
+		}
+
+		server := proxy.NewServer(proxy.ServerOptions{
+			Logger:     logger.Named("proxy"),
+			Reader:     d,
+			SocketPath: socketPath,
+		})
+
+		go func() {
+			if err := server.Serve(ctx); err != nil {
+				logger.Error("error serving proxy", "error", err)
+			}
+		}()
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestRunWatch(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "bad-flag",
+			args: []string{"-interval", "often"},
+			err:  `invalid value "often" for flag -interval: parse error`,
+		},
+		{
+			name: "bad-docker-host",
+			args: []string{"-docker-host", "npipe:////./pipe/docker_engine"},
+			err:  `error creating Docker client: unsupported Docker host scheme "npipe"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := runWatch(nil, hclog.NewNullLogger(), tc.args)
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if err.Error() != tc.err {
+				t.Fatalf("Results differ:\n%v", cmp.Diff(err.Error(), tc.err))
+			}
+		})
+	}
+}